@@ -22,12 +22,22 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/sunhuihui6688-star/ai-panel/internal/api"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/agent"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/audit"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/channel"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/config"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/contact"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/cron"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/datastore"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/eventbus"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/memory"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/process"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/project"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/retention"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/scheduler"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/search"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/session"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/subagent"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/teammem"
 )
 
 //go:embed all:ui_dist
@@ -41,6 +51,7 @@ func main() {
 	}
 	configPath := flag.String("config", defaultCfg, "path to aipanel.json config file")
 	serveMode := flag.Bool("serve", false, "直接启动服务（跳过 CLI 菜单）")
+	migrateSessions := flag.Bool("migrate-sessions", false, "把现有 JSONL 会话导入 SQLite 后退出")
 	flag.Parse()
 
 	// 无参数 且 无环境变量 → 进入 CLI 管理面板
@@ -51,7 +62,7 @@ func main() {
 			configExplicitlySet = true
 		}
 	})
-	if !configExplicitlySet && !*serveMode && os.Getenv("AIPANEL_CONFIG") == "" {
+	if !configExplicitlySet && !*serveMode && !*migrateSessions && os.Getenv("AIPANEL_CONFIG") == "" {
 		RunCLI()
 		return
 	}
@@ -77,6 +88,20 @@ func main() {
 		log.Printf("Warning: failed to load agents: %v", err)
 	}
 
+	if *migrateSessions {
+		runSessionMigration(mgr)
+		return
+	}
+	if err := session.SetBackend(cfg.Sessions.Backend); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	embedder, err := memory.EmbedderFromConfig(cfg.MemorySearch)
+	if err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	memory.SetEmbedder(embedder)
+	memory.SetVersionRetention(cfg.MemoryHistory.MaxVersions, cfg.MemoryHistory.MaxAgeDays)
+
 	// Initialize project manager (shared workspace for all agents)
 	projectsDir := "projects"
 	projectMgr := project.NewManager(projectsDir)
@@ -116,12 +141,91 @@ func main() {
 	pool := agent.NewPool(cfg, mgr)
 	pool.SetProjectManager(projectMgr)
 
+	// Live system events — relayed to dashboards by the /ws endpoint
+	bus := eventbus.New()
+	pool.SetEventBus(bus)
+
+	// Global run scheduler — concurrency limits and priority classes
+	pool.SetScheduler(scheduler.New(func() scheduler.Limits {
+		sc := cfg.Scheduler
+		return scheduler.LimitsFrom(sc.MaxConcurrent, sc.MaxPerAgent, sc.MaxPerKey, sc.MaxQueue)
+	}))
+	mgr.SetOnChange(func(agentID, change string) {
+		bus.Publish(eventbus.Agents, change, map[string]any{"agentId": agentID})
+	})
+
 	// Initialize subagent manager — background task execution
 	subagentStoreDir := filepath.Join(agentsDir, ".subagent-tasks")
 	subagentMgr := subagent.New(pool.SubagentRunFunc(), subagentStoreDir)
 	pool.SetSubagentManager(subagentMgr)
+	subagentMgr.SetOnChange(func(t subagent.Task) {
+		bus.Publish(eventbus.Subagents, string(t.Status), t)
+	})
 	log.Println("Subagent manager initialized")
 
+	// Background process supervisor — process_start / process_kill tools
+	processSup := process.New(filepath.Join(agentsDir, ".processes"), process.Limits{
+		MaxPerAgent: cfg.Processes.MaxPerAgent,
+		MaxLogBytes: int64(cfg.Processes.MaxLogKB) * 1024,
+		MaxRuntime:  time.Duration(cfg.Processes.MaxRuntimeMin) * time.Minute,
+	})
+	pool.SetProcessSupervisor(processSup)
+
+	// Per-agent key-value store and SQLite scratch database — kv_* / sql_query tools
+	dataStore := datastore.NewManager(agentsDir, datastore.Limits{
+		MaxKVKeys:     cfg.DataStore.MaxKVKeys,
+		MaxKVBytes:    int64(cfg.DataStore.MaxKVKB) * 1024,
+		MaxValueBytes: int64(cfg.DataStore.MaxValueKB) * 1024,
+		MaxDBBytes:    int64(cfg.DataStore.MaxSQLiteMB) << 20,
+		QueryTimeout:  time.Duration(cfg.DataStore.QueryTimeoutSec) * time.Second,
+	})
+	pool.SetDataStore(dataStore)
+	pool.SetContacts(contact.NewManager(agentsDir))
+
+	// Team-shared memory — team_memory_* tools and the team INDEX.md in every prompt
+	teamMem, err := teammem.Open("team-memory")
+	if err != nil {
+		log.Printf("Warning: team memory unavailable: %v", err)
+	} else {
+		teamMem.SetOnPropose(func(p teammem.Proposal) {
+			bus.Publish(eventbus.TeamMemory, "proposed", p)
+		})
+		pool.SetTeamMemory(teamMem)
+	}
+
+	// Full-text search index — GET /api/search and the search_history tool
+	searchIdx, err := search.Open(filepath.Join(agentsDir, ".search", "index.db"))
+	if err != nil {
+		log.Printf("Warning: search index unavailable: %v", err)
+	} else {
+		searchIndexer := search.NewIndexer(searchIdx, search.Sources{
+			Agents: func() []search.AgentSource {
+				var out []search.AgentSource
+				for _, a := range mgr.List() {
+					out = append(out, search.AgentSource{
+						ID:           a.ID,
+						AgentDir:     filepath.Dir(a.WorkspaceDir),
+						SessionDir:   a.SessionDir,
+						WorkspaceDir: a.WorkspaceDir,
+					})
+				}
+				return out
+			},
+			Projects: func() []search.ProjectSource {
+				var out []search.ProjectSource
+				for _, p := range projectMgr.List() {
+					out = append(out, search.ProjectSource{ID: p.ID, Dir: p.FilesDir})
+				}
+				return out
+			},
+		})
+		searchIndexer.Start(time.Minute)
+		pool.SetSearchIndexer(searchIndexer)
+	}
+
+	// Tool-call audit trail — append-only, queried via GET /api/audit/tools
+	pool.SetAuditLogger(audit.NewLogger(filepath.Join(agentsDir, ".audit")))
+
 	// Wire up completion notify: when a background task finishes, inject a message
 	// into the parent session so the user sees the result on next open.
 	subagentMgr.SetNotify(func(spawnedBy, spawnedBySession, taskID, label, output string, status subagent.TaskStatus) {
@@ -162,13 +266,50 @@ func main() {
 
 	// Initialize cron engine
 	cronDataDir := "cron"
-	cronEngine := cron.NewEngine(cronDataDir, runnerFunc)
+	cronEngine := cron.NewEngine(cronDataDir, func(ctx context.Context, agentID, message string) (string, error) {
+		ctx = scheduler.WithClass(audit.WithMeta(ctx, audit.Meta{Source: "cron"}), scheduler.Cron)
+		return runnerFunc(ctx, agentID, message)
+	})
 	if err := cronEngine.Load(); err != nil {
 		log.Printf("Warning: failed to load cron jobs: %v", err)
 	} else {
 		cronEngine.Start()
 		log.Printf("Cron engine started (%d jobs loaded)", len(cronEngine.ListJobs()))
 	}
+	pool.SetCronEngine(cronEngine)
+	cronEngine.SetOnRun(func(rec cron.RunRecord) {
+		typ := "run_finished"
+		if rec.Status == "running" {
+			typ = "run_started"
+		}
+		data := map[string]any{"run": rec}
+		if job, ok := cronEngine.Get(rec.JobID); ok {
+			data["jobName"] = job.Name
+			data["agentId"] = job.AgentID
+		}
+		bus.Publish(eventbus.Cron, typ, data)
+	})
+
+	// Retention janitor — archives/deletes old sessions and trims logs per cfg.Retention
+	janitor := retention.New(retention.Options{
+		Config: func() config.RetentionConfig { return cfg.Retention },
+		Agents: func() []retention.Target {
+			var out []retention.Target
+			for _, a := range mgr.List() {
+				out = append(out, retention.Target{
+					ID:         a.ID,
+					AgentDir:   filepath.Join(agentsDir, a.ID),
+					SessionDir: a.SessionDir,
+					Policy:     a.Retention,
+				})
+			}
+			return out
+		},
+		PruneCronRuns: cronEngine.PruneRuns,
+		PruneTasks:    subagentMgr.Prune,
+	})
+	janitor.Start()
+	pool.SetJanitor(janitor)
 
 	// Initialize Telegram bot (if enabled)
 	ctx, cancel := context.WithCancel(context.Background())
@@ -184,7 +325,12 @@ func main() {
 		cID := chID
 		pdDir := filepath.Join(agentsDir, aID, "channels-pending")
 		pending := channel.NewPendingStore(pdDir, cID)
+		pending.SetOnNew(func(u channel.PendingUser) {
+			bus.Publish(eventbus.Pending, "added", map[string]any{"agentId": aID, "channelId": cID, "user": u})
+		})
 		sf := func(ctx2 context.Context, aid, msg, sessionID string, media []channel.MediaInput, fileSender channel.FileSenderFunc) (<-chan channel.StreamEvent, error) {
+			ctx2 = audit.WithMeta(ctx2, audit.Meta{Source: "telegram", Channel: cID, SessionID: sessionID})
+			ctx2 = scheduler.WithClass(ctx2, scheduler.Telegram)
 			return pool.RunStreamEvents(ctx2, aid, msg, sessionID, media, fileSender)
 		}
 		getAllowFrom := func() []int64 { return mgr.GetAllowFrom(aID, cID) }
@@ -218,6 +364,46 @@ func main() {
 	// Initialize session worker pool — decouples runner lifecycle from HTTP connections.
 	// Workers run in background goroutines; closing the browser does not stop generation.
 	workerPool := session.NewWorkerPool()
+	if err := workerPool.SetEventDir(filepath.Join(agentsDir, ".events")); err != nil {
+		log.Printf("Warning: SSE event persistence disabled: %v", err)
+	}
+	workerPool.SetOnRun(func(agentID, sessionID string, running bool) {
+		typ := "run_finished"
+		if running {
+			typ = "run_started"
+		}
+		bus.Publish(eventbus.Sessions, typ, map[string]any{"agentId": agentID, "sessionId": sessionID})
+	})
+
+	// Cron delivery targets (webhook is built into the engine)
+	cronEngine.SetDeliverer("telegram", func(ctx context.Context, job *cron.Job, rec cron.RunRecord, output string) error {
+		t := job.Delivery.Target
+		var bot *channel.TelegramBot
+		var ok bool
+		if t.ChannelID != "" {
+			bot, ok = botPool.GetBot(job.AgentID, t.ChannelID)
+		} else {
+			bot, _, ok = botPool.GetFirstBot(job.AgentID)
+		}
+		if !ok {
+			return fmt.Errorf("no active Telegram bot found for agent %q", job.AgentID)
+		}
+		return bot.Announce(t.ChatID, t.ThreadID, cron.AnnounceText(job, rec, output))
+	})
+	cronEngine.SetDeliverer("session", func(ctx context.Context, job *cron.Job, rec cron.RunRecord, output string) error {
+		ag, ok := mgr.Get(job.AgentID)
+		if !ok {
+			return fmt.Errorf("agent %q not found", job.AgentID)
+		}
+		store := session.NewStore(ag.SessionDir)
+		sid := job.Delivery.Target.SessionID
+		if _, ok := store.GetMeta(sid); !ok {
+			return fmt.Errorf("session %q not found", sid)
+		}
+		content, _ := json.Marshal(cron.AnnounceText(job, rec, output))
+		return store.AppendMessage(sid, "assistant", content)
+	})
+	cronEngine.SetDeliverer("email", cron.EmailDeliverer(func() config.SMTPConfig { return cfg.SMTP }))
 
 	// Setup router
 	r := gin.Default()
@@ -269,7 +455,15 @@ func main() {
 		log.Println("Shutting down...")
 		cancel() // stop telegram bot
 
-		workerPool.StopAll() // stop all background session workers
+		janitor.Stop()
+		workerPool.StopAll()  // stop all background session workers
+		processSup.Shutdown() // kill agent background processes
+		dataStore.CloseAll()  // close agent SQLite databases
+		if si := pool.SearchIndexer(); si != nil {
+			si.Stop()
+			si.Index().Close()
+		}
+		session.CloseAll() // close session databases
 
 		shutdownCtx := cronEngine.Stop() // stop cron
 		<-shutdownCtx.Done()
@@ -284,6 +478,29 @@ func main() {
 	}
 }
 
+// runSessionMigration imports every agent's JSONL sessions (including
+// subagent sessions) into SQLite. Safe to re-run; JSONL files are kept.
+func runSessionMigration(mgr *agent.Manager) {
+	total := session.MigrateResult{}
+	for _, ag := range mgr.List() {
+		for _, dir := range []string{ag.SessionDir, filepath.Join(ag.SessionDir, "subagent")} {
+			res, err := session.MigrateJSONL(dir)
+			if err != nil {
+				log.Fatalf("migrate %s: %v", dir, err)
+			}
+			if res.Imported+res.Skipped > 0 {
+				fmt.Printf("%-20s %s: 导入 %d 个会话（%d 条记录），跳过 %d 个\n", ag.ID, dir, res.Imported, res.Entries, res.Skipped)
+			}
+			total.Imported += res.Imported
+			total.Skipped += res.Skipped
+			total.Entries += res.Entries
+		}
+	}
+	session.CloseAll()
+	fmt.Printf("完成：导入 %d 个会话（%d 条记录），跳过 %d 个已存在的会话。\n", total.Imported, total.Entries, total.Skipped)
+	fmt.Println(`在配置文件中设置 "sessions": {"backend": "sqlite"} 后重启服务即可启用。`)
+}
+
 func getLocalIP() string {
 	addrs, err := net.InterfaceAddrs()
 	if err != nil {
@@ -18,6 +18,7 @@ import (
 	"github.com/sunhuihui6688-star/ai-panel/pkg/agent"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/channel"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/config"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/eventbus"
 )
 
 func removeFile(path string) error { return os.Remove(path) }
@@ -25,7 +26,8 @@ func removeFile(path string) error { return os.Remove(path) }
 type agentChannelHandler struct {
 	manager    *agent.Manager
 	runnerFunc channel.RunnerFunc
-	botCtrl    BotControl // start/stop Telegram bots dynamically
+	botCtrl    BotControl    // start/stop Telegram bots dynamically
+	bus        *eventbus.Bus // pending-user events (may be nil)
 }
 
 // GetChannels GET /api/agents/:id/channels
@@ -337,20 +339,25 @@ func (h *agentChannelHandler) ListPending(c *gin.Context) {
 // AllowPending POST /api/agents/:id/channels/:chId/pending/:userId/allow
 // Adds the user to the channel's allowedFrom list and removes from pending.
 func (h *agentChannelHandler) AllowPending(c *gin.Context) {
-	agentID := c.Param("id")
-	chID := c.Param("chId")
-	userIDStr := c.Param("userId")
-
-	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	userID, err := strconv.ParseInt(c.Param("userId"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid userId"})
 		return
 	}
+	allowedFrom, status, err := h.allowPending(c.Param("id"), c.Param("chId"), userID)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "allowedFrom": allowedFrom})
+}
 
+// allowPending approves a pending user (shared by the REST and WebSocket
+// APIs). On failure the returned status is the HTTP status to report.
+func (h *agentChannelHandler) allowPending(agentID, chID string, userID int64) (string, int, error) {
 	ag, ok := h.manager.Get(agentID)
 	if !ok {
-		c.JSON(http.StatusNotFound, gin.H{"error": "agent not found"})
-		return
+		return "", http.StatusNotFound, fmt.Errorf("agent not found")
 	}
 
 	// Find the channel
@@ -362,8 +369,7 @@ func (h *agentChannelHandler) AllowPending(c *gin.Context) {
 		}
 	}
 	if chIdx < 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "channel not found"})
-		return
+		return "", http.StatusNotFound, fmt.Errorf("channel not found")
 	}
 
 	ch := &ag.Channels[chIdx]
@@ -379,8 +385,7 @@ func (h *agentChannelHandler) AllowPending(c *gin.Context) {
 
 	// Save channels
 	if err := h.manager.UpdateChannels(agentID, ag.Channels); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+		return "", http.StatusInternalServerError, err
 	}
 
 	// Save user info to approved store (so Web UI can display username)
@@ -395,6 +400,7 @@ func (h *agentChannelHandler) AllowPending(c *gin.Context) {
 	}
 	// Remove from pending store
 	ps.Remove(userID)
+	h.bus.Publish(eventbus.Pending, "allowed", gin.H{"agentId": agentID, "channelId": chID, "userId": userID})
 
 	// Send welcome message to the newly approved user
 	if botToken := ch.Config["botToken"]; botToken != "" {
@@ -405,8 +411,7 @@ func (h *agentChannelHandler) AllowPending(c *gin.Context) {
 			}
 		}()
 	}
-
-	c.JSON(http.StatusOK, gin.H{"ok": true, "allowedFrom": ch.Config["allowedFrom"]})
+	return ch.Config["allowedFrom"], http.StatusOK, nil
 }
 
 // RemoveAllowed DELETE /api/agents/:id/channels/:chId/allowed/:userId
@@ -475,25 +480,28 @@ func (h *agentChannelHandler) RemoveAllowed(c *gin.Context) {
 // DismissPending DELETE /api/agents/:id/channels/:chId/pending/:userId
 // Removes the user from the pending list without adding to allowlist.
 func (h *agentChannelHandler) DismissPending(c *gin.Context) {
-	agentID := c.Param("id")
-	chID := c.Param("chId")
-	userIDStr := c.Param("userId")
-
-	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	userID, err := strconv.ParseInt(c.Param("userId"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid userId"})
 		return
 	}
+	if err := h.dismissPending(c.Param("id"), c.Param("chId"), userID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
 
+// dismissPending drops a pending user without approving them.
+func (h *agentChannelHandler) dismissPending(agentID, chID string, userID int64) error {
 	ag, ok := h.manager.Get(agentID)
 	if !ok {
-		c.JSON(http.StatusNotFound, gin.H{"error": "agent not found"})
-		return
+		return fmt.Errorf("agent not found")
 	}
-
 	ps := channel.NewPendingStore(pendingDir(ag), chID)
 	ps.Remove(userID)
-	c.JSON(http.StatusOK, gin.H{"ok": true})
+	h.bus.Publish(eventbus.Pending, "dismissed", gin.H{"agentId": agentID, "channelId": chID, "userId": userID})
+	return nil
 }
 
 // parseIDList splits a comma-separated ID string into a slice.
@@ -2,12 +2,15 @@
 package api
 
 import (
+	"encoding/json"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/agent"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/audit"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/config"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/cron"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/session"
 )
 
 type agentHandler struct {
@@ -20,18 +23,21 @@ type agentHandler struct {
 
 // AgentInfo is the JSON shape returned to the frontend.
 type AgentInfo struct {
-	ID           string            `json:"id"`
-	Name         string            `json:"name"`
-	Description  string            `json:"description,omitempty"`
-	Model        string            `json:"model"`
-	ModelID      string            `json:"modelId,omitempty"`
-	ToolIDs      []string          `json:"toolIds,omitempty"`
-	SkillIDs     []string          `json:"skillIds,omitempty"`
-	AvatarColor  string            `json:"avatarColor,omitempty"`
-	System       bool              `json:"system,omitempty"`
-	Status       string            `json:"status"`
-	WorkspaceDir string            `json:"workspaceDir"`
-	Env          map[string]string `json:"env,omitempty"` // per-agent env vars (keys shown; values masked in list)
+	ID           string                   `json:"id"`
+	Name         string                   `json:"name"`
+	Description  string                   `json:"description,omitempty"`
+	Model        string                   `json:"model"`
+	ModelID      string                   `json:"modelId,omitempty"`
+	ToolIDs      []string                 `json:"toolIds,omitempty"`
+	SkillIDs     []string                 `json:"skillIds,omitempty"`
+	AvatarColor  string                   `json:"avatarColor,omitempty"`
+	System       bool                     `json:"system,omitempty"`
+	Status       string                   `json:"status"`
+	WorkspaceDir string                   `json:"workspaceDir"`
+	Env          map[string]string        `json:"env,omitempty"` // per-agent env vars (keys shown; values masked in list)
+	WebFetch     *config.WebFetchConfig   `json:"webFetch,omitempty"`
+	Retention    *config.RetentionPolicy  `json:"retention,omitempty"`
+	Compaction   *config.CompactionPolicy `json:"compaction,omitempty"`
 }
 
 func agentToInfo(a *agent.Agent) AgentInfo {
@@ -48,6 +54,9 @@ func agentToInfo(a *agent.Agent) AgentInfo {
 		Status:       a.Status,
 		WorkspaceDir: a.WorkspaceDir,
 		Env:          a.Env,
+		WebFetch:     a.WebFetch,
+		Retention:    a.Retention,
+		Compaction:   a.Compaction,
 	}
 }
 
@@ -206,6 +215,25 @@ func (h *agentHandler) Update(c *gin.Context) {
 		}
 	}
 
+	if v, ok := raw["webFetch"]; ok && v != nil {
+		var wf config.WebFetchConfig
+		if b, err := json.Marshal(v); err == nil && json.Unmarshal(b, &wf) == nil {
+			opts.WebFetch = &wf
+		}
+	}
+	if v, ok := raw["retention"]; ok && v != nil {
+		var rp config.RetentionPolicy
+		if b, err := json.Marshal(v); err == nil && json.Unmarshal(b, &rp) == nil {
+			opts.Retention = &rp
+		}
+	}
+	if v, ok := raw["compaction"]; ok && v != nil {
+		var cp config.CompactionPolicy
+		if b, err := json.Marshal(v); err == nil && json.Unmarshal(b, &cp) == nil {
+			opts.Compaction = &cp
+		}
+	}
+
 	if err := h.manager.UpdateAgent(id, opts); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -246,6 +274,14 @@ func (h *agentHandler) Delete(c *gin.Context) {
 		}
 	}
 
+	// Close the agent's data store so its SQLite file can be removed
+	if h.pool != nil && h.pool.DataStore() != nil {
+		h.pool.DataStore().Close(id)
+	}
+
+	// Close cached session stores (and their SQLite handles) for this agent
+	session.Release(ag.SessionDir)
+
 	if err := h.manager.Remove(id); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -298,7 +334,8 @@ func (h *agentHandler) Message(c *gin.Context) {
 		}
 	}
 
-	response, err := h.pool.Run(c.Request.Context(), targetID, message)
+	ctx := audit.WithMeta(c.Request.Context(), audit.Meta{Source: "agent_message"})
+	response, err := h.pool.Run(ctx, targetID, message)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/audit"
+)
+
+type auditHandler struct {
+	log *audit.Logger
+}
+
+// Tools GET /api/audit/tools?agentId=&tool=&status=&source=&sessionId=&since=&until=&limit=
+// since/until accept RFC 3339 timestamps or unix milliseconds.
+func (h *auditHandler) Tools(c *gin.Context) {
+	q := audit.Query{
+		AgentID:   c.Query("agentId"),
+		SessionID: c.Query("sessionId"),
+		Tool:      c.Query("tool"),
+		Source:    c.Query("source"),
+		Status:    c.Query("status"),
+	}
+	var err error
+	if q.Since, err = parseAuditTime(c.Query("since")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid since: " + err.Error()})
+		return
+	}
+	if q.Until, err = parseAuditTime(c.Query("until")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid until: " + err.Error()})
+		return
+	}
+	if n, err := strconv.Atoi(c.Query("limit")); err == nil && n > 0 {
+		if n > 1000 {
+			n = 1000
+		}
+		q.Limit = n
+	}
+
+	entries, total, err := h.log.Search(q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"entries": entries, "total": total})
+}
+
+func parseAuditTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
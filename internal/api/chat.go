@@ -27,12 +27,22 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/agent"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/audit"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/channel"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/compaction"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/config"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/contact"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/cron"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/datastore"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/llm"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/process"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/project"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/runner"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/scheduler"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/search"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/session"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/subagent"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/teammem"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/tools"
 )
 
@@ -43,7 +53,15 @@ type chatHandler struct {
 	manager     *agent.Manager
 	projectMgr  *project.Manager
 	subagentMgr *subagent.Manager
+	processSup  *process.Supervisor
+	auditLog    *audit.Logger
+	cronEngine  *cron.Engine
+	dataStore   *datastore.Manager
+	contacts    *contact.Manager
+	teamMem     *teammem.Store
+	searchIdx   *search.Indexer
 	workerPool  *session.WorkerPool
+	scheduler   *scheduler.Scheduler
 }
 
 // Chat POST /api/agents/:id/chat
@@ -57,34 +75,80 @@ func (h *chatHandler) Chat(c *gin.Context) {
 		return
 	}
 
-	var body struct {
-		Message   string   `json:"message" binding:"required"`
-		SessionID string   `json:"sessionId"`
-		Context   string   `json:"context"`
-		Scenario  string   `json:"scenario"`
-		SkillID   string   `json:"skillId"`
-		Images    []string `json:"images"`
-		History   []struct {
-			Role    string `json:"role"`
-			Content string `json:"content"`
-		} `json:"history"`
-	}
+	var body chatRequest
 	if err := c.ShouldBindJSON(&body); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	_, apiKey, model, err := h.resolveModel(ag)
+	worker, _, status, err := h.enqueue(ag, &body)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
+	h.pipeSSE(c, worker, 0)
+}
+
+// chatRequest is the body of POST /api/agents/:id/chat and of the WebSocket
+// "chat" message.
+type chatRequest struct {
+	Message   string   `json:"message" binding:"required"`
+	SessionID string   `json:"sessionId"`
+	Context   string   `json:"context"`
+	Scenario  string   `json:"scenario"`
+	SkillID   string   `json:"skillId"`
+	Images    []string `json:"images"`
+	// Attachments are documents (PDF/DOCX/XLSX/PPTX) as base64 data URIs.
+	Attachments []struct {
+		Name string `json:"name"`
+		Data string `json:"data"`
+	} `json:"attachments"`
+	History []struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	} `json:"history"`
+}
+
+// enqueue resolves the session and queues the message on its worker. On
+// failure the returned status is the HTTP status to report.
+func (h *chatHandler) enqueue(ag *agent.Agent, body *chatRequest) (*session.SessionWorker, string, int, error) {
+	_, apiKey, model, err := h.resolveModel(ag)
+	if err != nil {
+		return nil, "", http.StatusBadRequest, err
+	}
+
+	// Documents (attachments, or non-image data URIs in images) are saved to
+	// the workspace and extracted the same way as Telegram uploads.
+	images := make([]string, 0, len(body.Images))
+	var media []channel.MediaInput
+	for _, uri := range body.Images {
+		if !strings.HasPrefix(uri, "data:") || strings.HasPrefix(uri, "data:image/") {
+			images = append(images, uri)
+			continue
+		}
+		if m, err := agent.MediaFromDataURI("", uri); err == nil {
+			media = append(media, m)
+		}
+	}
+	for _, a := range body.Attachments {
+		m, err := agent.MediaFromDataURI(a.Name, a.Data)
+		if err != nil {
+			return nil, "", http.StatusBadRequest, fmt.Errorf("attachment %q: %v", a.Name, err)
+		}
+		media = append(media, m)
+	}
+	if len(media) > 0 {
+		uris, preamble := agent.PrepareMedia(ag.WorkspaceDir, model, media)
+		images = append(images, uris...)
+		if preamble != "" {
+			body.Message = preamble + "\n\n" + body.Message
+		}
+	}
 
 	store := session.NewStore(ag.SessionDir)
 	sessionID, _, err := store.GetOrCreate(body.SessionID, ag.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "session error: " + err.Error()})
-		return
+		return nil, "", http.StatusInternalServerError, fmt.Errorf("session error: %w", err)
 	}
 
 	// Snapshot legacy history (closure capture, no aliasing)
@@ -101,7 +165,6 @@ func (h *chatHandler) Chat(c *gin.Context) {
 	agEnv := ag.Env
 	scenario := body.Scenario
 	skillID := body.SkillID
-	images := append([]string{}, body.Images...)
 	extraContext := body.Context
 
 	// RunFn is called by the worker goroutine with ctx=context.Background()
@@ -125,15 +188,16 @@ func (h *chatHandler) Chat(c *gin.Context) {
 		Message:   body.Message,
 		RunFn:     runFn,
 	}); err != nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
-		return
+		return nil, "", http.StatusServiceUnavailable, err
 	}
+	return worker, sessionID, http.StatusOK, nil
 
-	h.pipeSSE(c, worker)
 }
 
 // StreamSession GET /api/agents/:id/chat/stream?sessionId=...
-// Reconnect: subscribe to an existing session's broadcaster.
+// Reconnect: subscribe to an existing session's broadcaster. With a
+// Last-Event-ID header (or ?lastEventId=) only the events after that ID are
+// replayed, including the tail of the previous generation.
 func (h *chatHandler) StreamSession(c *gin.Context) {
 	id := c.Param("id")
 	if _, ok := h.manager.Get(id); !ok {
@@ -145,18 +209,15 @@ func (h *chatHandler) StreamSession(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "sessionId required"})
 		return
 	}
+	after := lastEventID(c)
 	worker := h.workerPool.Get(sessionID)
 	if worker == nil {
-		// Worker gone — generation finished before reconnect; signal idle
-		c.Header("Content-Type", "text/event-stream")
-		c.Header("Cache-Control", "no-cache")
-		c.Header("Connection", "keep-alive")
-		data, _ := json.Marshal(map[string]any{"type": "idle"})
-		fmt.Fprintf(c.Writer, "data: %s\n\n", data)
-		c.Writer.Flush()
+		// Worker gone — generation finished before reconnect. Send what the
+		// client missed from the persisted events, otherwise signal idle.
+		replaySSE(c, h.workerPool.Replay(sessionID, after), nil)
 		return
 	}
-	h.pipeSSE(c, worker)
+	h.pipeSSE(c, worker, after)
 }
 
 // SessionStatus GET /api/agents/:id/chat/status?sessionId=...
@@ -180,14 +241,16 @@ func (h *chatHandler) SessionStatus(c *gin.Context) {
 
 // pipeSSE subscribes to the worker's broadcaster and streams events via SSE.
 // Browser disconnect stops the SSE pipe but does NOT cancel the runner.
-func (h *chatHandler) pipeSSE(c *gin.Context, worker *session.SessionWorker) {
-	c.Header("Content-Type", "text/event-stream")
-	c.Header("Cache-Control", "no-cache")
-	c.Header("Connection", "keep-alive")
-	c.Header("X-Accel-Buffering", "no")
+func (h *chatHandler) pipeSSE(c *gin.Context, worker *session.SessionWorker, after uint64) {
+	bc := worker.Broadcaster
+	if after > 0 && after == bc.LastID() && bc.IsDone() {
+		replaySSE(c, nil, nil) // already up to date
+		return
+	}
+	setSSEHeaders(c)
 
 	subKey := fmt.Sprintf("sse-%d", subCounter.Add(1))
-	ch, unsub := worker.Broadcaster.Subscribe(subKey)
+	ch, unsub := bc.Subscribe(subKey, after)
 	defer unsub()
 
 	c.Stream(func(w io.Writer) bool {
@@ -196,8 +259,9 @@ func (h *chatHandler) pipeSSE(c *gin.Context, worker *session.SessionWorker) {
 			if !ok {
 				return false
 			}
-			fmt.Fprintf(w, "data: %s\n\n", ev.Data)
-			return ev.Type != "done" && ev.Type != "error"
+			writeSSEEvent(w, ev.ID, ev.Data)
+			// A replayed "done" of the previous generation is not the end.
+			return !isFinal(ev) || ev.Gen < bc.Gen()
 		case <-c.Request.Context().Done():
 			return false // browser left; runner continues
 		}
@@ -235,6 +299,34 @@ func (h *chatHandler) execRunner(
 	if len(agEnv) > 0 {
 		toolRegistry.WithEnv(agEnv)
 	}
+	var compactPolicy *compaction.Policy
+	if ag, ok := h.manager.Get(agentID); ok {
+		toolRegistry.WithWebFetch(config.MergeWebFetch(h.cfg.WebFetch, ag.WebFetch))
+		me, _, _, _ := h.resolveModel(ag)
+		policy := compaction.Resolve(h.cfg, ag.Compaction, me)
+		compactPolicy = &policy
+		if scenario != "skill-studio" {
+			toolRegistry.WithToolEntries(h.cfg.Tools, ag.ToolIDs)
+		}
+	}
+	if scenario != "skill-studio" {
+		if h.processSup != nil {
+			toolRegistry.WithProcessSupervisor(h.processSup)
+		}
+		toolRegistry.WithCronEngine(h.cronEngine, h.cfg.Cron)
+		toolRegistry.WithDataStore(h.dataStore)
+		toolRegistry.WithContacts(h.contacts)
+		toolRegistry.WithTeamMemory(h.teamMem)
+		toolRegistry.WithSearch(h.searchIdx)
+	}
+	if h.auditLog != nil {
+		toolRegistry.WithAudit(h.auditLog)
+		source := "web"
+		if scenario != "" {
+			source = "web:" + scenario
+		}
+		ctx = audit.WithMeta(ctx, audit.Meta{Source: source, SessionID: sessionID})
+	}
 	if h.subagentMgr != nil {
 		toolRegistry.WithSubagentManager(h.subagentMgr)
 		toolRegistry.WithAgentLister(func() []tools.AgentSummary {
@@ -304,6 +396,11 @@ func (h *chatHandler) execRunner(
 		}
 	}
 
+	projectCtx := runner.BuildProjectContext(h.projectMgr, agentID)
+	if tm := runner.BuildTeamMemoryContext(h.teamMem, agentID); tm != "" {
+		projectCtx = strings.TrimSpace(projectCtx + "\n\n" + tm)
+	}
+
 	r := runner.New(runner.Config{
 		AgentID:          agentID,
 		WorkspaceDir:     workspaceDir,
@@ -316,8 +413,11 @@ func (h *chatHandler) execRunner(
 		ExtraContext:     extraContext,
 		Images:           images,
 		PreloadedHistory: preHistory,
-		ProjectContext:   runner.BuildProjectContext(h.projectMgr, agentID),
+		ProjectContext:   projectCtx,
 		AgentEnv:         agEnv,
+		Scheduler:        h.scheduler,
+		Compaction:       compactPolicy,
+		MemoryRecall:     h.cfg.MemorySearch.AutoInject,
 	})
 
 	for ev := range r.Run(ctx, message) {
@@ -344,6 +444,8 @@ func runEventToJSON(ev runner.RunEvent) []byte {
 	case "done":
 		m["sessionId"] = ev.SessionID
 		m["tokenEstimate"] = ev.TokenEstimate
+	case "queued":
+		m["position"] = ev.Position
 	}
 	data, _ := json.Marshal(m)
 	return data
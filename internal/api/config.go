@@ -61,6 +61,10 @@ func (h *configHandler) Get(c *gin.Context) {
 		maskedTools[i].APIKey = maskKey(maskedTools[i].APIKey)
 	}
 	safe.Tools = maskedTools
+	safe.MemorySearch.APIKey = maskKey(safe.MemorySearch.APIKey)
+	if safe.SMTP.Password != "" {
+		safe.SMTP.Password = "***"
+	}
 	c.JSON(http.StatusOK, safe)
 }
 
@@ -90,6 +94,9 @@ func (h *configHandler) Patch(c *gin.Context) {
 	if _, hasAuth := patch["auth"]; !hasAuth {
 		updated.Auth = h.cfg.Auth
 	}
+	if updated.SMTP.Password == "***" {
+		updated.SMTP.Password = h.cfg.SMTP.Password // masked value echoed back by Get
+	}
 
 	path := h.configPath
 	if path == "" {
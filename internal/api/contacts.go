@@ -0,0 +1,152 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/agent"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/contact"
+)
+
+type contactHandler struct {
+	manager *agent.Manager
+	stores  *contact.Manager
+}
+
+func (h *contactHandler) store(c *gin.Context) (*contact.Store, bool) {
+	id := c.Param("id")
+	if _, ok := h.manager.Get(id); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent not found"})
+		return nil, false
+	}
+	s, err := h.stores.Get(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return s, true
+}
+
+func contactErr(c *gin.Context, err error) {
+	if errors.Is(err, contact.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+// List GET /api/agents/:id/contacts?q= — contacts, most recently seen first.
+func (h *contactHandler) List(c *gin.Context) {
+	s, ok := h.store(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, s.List(c.Query("q")))
+}
+
+// Get GET /api/agents/:id/contacts/:cid
+func (h *contactHandler) Get(c *gin.Context) {
+	s, ok := h.store(c)
+	if !ok {
+		return
+	}
+	ct, err := s.Get(c.Param("cid"))
+	if err != nil {
+		contactErr(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, ct)
+}
+
+// Update PATCH /api/agents/:id/contacts/:cid — name, profile, preferences, notes.
+func (h *contactHandler) Update(c *gin.Context) {
+	s, ok := h.store(c)
+	if !ok {
+		return
+	}
+	var p contact.Patch
+	if err := c.ShouldBindJSON(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ct, err := s.Update(c.Param("cid"), p, "user")
+	if err != nil {
+		contactErr(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, ct)
+}
+
+// Delete DELETE /api/agents/:id/contacts/:cid
+func (h *contactHandler) Delete(c *gin.Context) {
+	s, ok := h.store(c)
+	if !ok {
+		return
+	}
+	if err := s.Delete(c.Param("cid")); err != nil {
+		contactErr(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// Link POST /api/agents/:id/contacts/:cid/link {key} — attach an identity
+// (merging the contact that owned it).
+func (h *contactHandler) Link(c *gin.Context) {
+	s, ok := h.store(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Key string `json:"key"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || !validIdentityKey(req.Key) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "key must look like telegram:<userID> or web:<channelID>:<token>"})
+		return
+	}
+	ct, err := s.Link(c.Param("cid"), req.Key)
+	if err != nil {
+		contactErr(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, ct)
+}
+
+// Unlink POST /api/agents/:id/contacts/:cid/unlink {key} — split an identity
+// into a contact of its own; returns the new contact.
+func (h *contactHandler) Unlink(c *gin.Context) {
+	s, ok := h.store(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Key string `json:"key"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Key == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "key required"})
+		return
+	}
+	ct, err := s.Unlink(c.Param("cid"), req.Key)
+	if err != nil {
+		contactErr(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, ct)
+}
+
+func validIdentityKey(key string) bool {
+	channel, rest, ok := strings.Cut(key, ":")
+	if !ok || rest == "" {
+		return false
+	}
+	switch channel {
+	case "telegram":
+		return strings.Trim(rest, "-0123456789") == ""
+	case "web":
+		ch, tok, ok := strings.Cut(rest, ":")
+		return ok && ch != "" && tok != ""
+	}
+	return false
+}
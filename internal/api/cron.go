@@ -3,7 +3,10 @@
 package api
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/cron"
@@ -50,7 +53,7 @@ func (h *cronHandler) Create(c *gin.Context) {
 		return
 	}
 	if err := h.engine.Add(&job); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(cronErrStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusCreated, job)
@@ -69,7 +72,7 @@ func (h *cronHandler) Update(c *gin.Context) {
 		return
 	}
 	if err := h.engine.Update(jobID, &patch); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.JSON(cronErrStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"ok": true})
@@ -117,3 +120,63 @@ func (h *cronHandler) Runs(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, runs)
 }
+
+// Next GET /api/cron/:jobId/next?n=5 — upcoming fire times of a saved job
+// (unix ms), jitter included
+func (h *cronHandler) Next(c *gin.Context) {
+	if h.engine == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "cron engine not initialized"})
+		return
+	}
+	runs, err := h.engine.Preview(c.Param("jobId"), previewCount(c.Query("n")))
+	if err != nil {
+		c.JSON(cronErrStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"runs": unixMillis(runs)})
+}
+
+// Preview POST /api/cron/preview {schedule, n} — upcoming fire times of an
+// unsaved schedule, for the job editor
+func (h *cronHandler) Preview(c *gin.Context) {
+	var req struct {
+		Schedule cron.Schedule `json:"schedule"`
+		N        int           `json:"n"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	runs, err := cron.NextRuns(req.Schedule, time.Now(), previewCount(strconv.Itoa(req.N)))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"runs": unixMillis(runs)})
+}
+
+func previewCount(s string) int {
+	n, _ := strconv.Atoi(s)
+	if n <= 0 {
+		return 5
+	}
+	return min(n, 50)
+}
+
+func unixMillis(ts []time.Time) []int64 {
+	out := make([]int64, len(ts))
+	for i, t := range ts {
+		out[i] = t.UnixMilli()
+	}
+	return out
+}
+
+func cronErrStatus(err error) int {
+	switch {
+	case errors.Is(err, cron.ErrJobNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, cron.ErrInvalidSchedule), errors.Is(err, cron.ErrInvalidDelivery):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
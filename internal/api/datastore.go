@@ -0,0 +1,166 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/agent"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/datastore"
+)
+
+// exportMaxRows caps rows per table in the JSON export; use format=sqlite
+// for a full copy.
+const exportMaxRows = 100000
+
+type dataStoreHandler struct {
+	manager *agent.Manager
+	stores  *datastore.Manager
+}
+
+func (h *dataStoreHandler) store(c *gin.Context) (*datastore.Store, bool) {
+	id := c.Param("id")
+	if _, ok := h.manager.Get(id); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent not found"})
+		return nil, false
+	}
+	s, err := h.stores.Get(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return s, true
+}
+
+// Overview GET /api/agents/:id/datastore — quota usage and SQLite tables.
+func (h *dataStoreHandler) Overview(c *gin.Context) {
+	s, ok := h.store(c)
+	if !ok {
+		return
+	}
+	tables, err := s.Tables(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"usage": s.Usage(), "tables": tables})
+}
+
+// ListKV GET /api/agents/:id/datastore/kv?prefix=
+func (h *dataStoreHandler) ListKV(c *gin.Context) {
+	s, ok := h.store(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, s.KVList(c.Query("prefix")))
+}
+
+// DeleteKV DELETE /api/agents/:id/datastore/kv/*key (keys may contain "/")
+func (h *dataStoreHandler) DeleteKV(c *gin.Context) {
+	s, ok := h.store(c)
+	if !ok {
+		return
+	}
+	found, err := s.KVDelete(strings.TrimPrefix(c.Param("key"), "/"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "key not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// Query POST /api/agents/:id/datastore/sql
+// Body: {"sql": "...", "params": [...], "readOnly": true, "maxRows": 500}.
+// readOnly defaults to true so browsing the data cannot change it by accident.
+func (h *dataStoreHandler) Query(c *gin.Context) {
+	s, ok := h.store(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		SQL      string `json:"sql"`
+		Params   []any  `json:"params"`
+		ReadOnly *bool  `json:"readOnly"`
+		MaxRows  int    `json:"maxRows"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	readOnly := body.ReadOnly == nil || *body.ReadOnly
+	if body.MaxRows <= 0 || body.MaxRows > 5000 {
+		body.MaxRows = 500
+	}
+	res, err := s.Query(c.Request.Context(), body.SQL, body.Params, readOnly, body.MaxRows)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// Export GET /api/agents/:id/datastore/export?format=json|sqlite
+// json bundles the KV entries and every table's rows; sqlite downloads a
+// consistent copy of scratch.db.
+func (h *dataStoreHandler) Export(c *gin.Context) {
+	s, ok := h.store(c)
+	if !ok {
+		return
+	}
+	id := c.Param("id")
+	stamp := time.Now().Format("20060102-150405")
+
+	if c.DefaultQuery("format", "json") == "sqlite" {
+		tmp, err := os.MkdirTemp("", "datastore-export-")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer os.RemoveAll(tmp)
+		dest := filepath.Join(tmp, "scratch.db")
+		if err := s.Backup(c.Request.Context(), dest); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.FileAttachment(dest, fmt.Sprintf("%s-scratch-%s.db", id, stamp))
+		return
+	}
+
+	ctx := c.Request.Context()
+	tables, err := s.Tables(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	type tableExport struct {
+		datastore.TableInfo
+		Columns   []string `json:"columns"`
+		Data      [][]any  `json:"data"`
+		Truncated bool     `json:"truncated,omitempty"`
+	}
+	out := make([]tableExport, 0, len(tables))
+	for _, t := range tables {
+		q := fmt.Sprintf(`SELECT * FROM "%s"`, strings.ReplaceAll(t.Name, `"`, `""`))
+		res, err := s.Query(ctx, q, nil, true, exportMaxRows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("export %s: %v", t.Name, err)})
+			return
+		}
+		out = append(out, tableExport{TableInfo: t, Columns: res.Columns, Data: res.Rows, Truncated: res.Truncated})
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-datastore-%s.json"`, id, stamp))
+	c.JSON(http.StatusOK, gin.H{
+		"agentId":    id,
+		"exportedAt": time.Now().UnixMilli(),
+		"kv":         s.KVList(""),
+		"tables":     out,
+	})
+}
@@ -14,6 +14,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/agent"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/memory"
 )
 
 type fileHandler struct {
@@ -194,7 +195,7 @@ func (h *fileHandler) Read(c *gin.Context) {
 // Write PUT /api/agents/:id/files/*path
 // Accepts both raw text (Content-Type: text/plain) and JSON {content: string}.
 func (h *fileHandler) Write(c *gin.Context) {
-	_, absPath, ok := h.resolveWorkspacePath(c)
+	wsDir, absPath, ok := h.resolveWorkspacePath(c)
 	if !ok {
 		return
 	}
@@ -216,12 +217,14 @@ func (h *fileHandler) Write(c *gin.Context) {
 		}
 	}
 
-	if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	if err := os.WriteFile(absPath, body, 0644); err != nil {
+	// IDENTITY.md, SOUL.md and memory/ files keep a version per write.
+	err = trackUserWrite(wsDir, absPath, func() error {
+		if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
+			return err
+		}
+		return os.WriteFile(absPath, body, 0644)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -231,12 +234,12 @@ func (h *fileHandler) Write(c *gin.Context) {
 
 // Delete DELETE /api/agents/:id/files/*path
 func (h *fileHandler) Delete(c *gin.Context) {
-	_, absPath, ok := h.resolveWorkspacePath(c)
+	wsDir, absPath, ok := h.resolveWorkspacePath(c)
 	if !ok {
 		return
 	}
 
-	if err := os.RemoveAll(absPath); err != nil {
+	if err := trackUserWrite(wsDir, absPath, func() error { return os.RemoveAll(absPath) }); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -244,6 +247,16 @@ func (h *fileHandler) Delete(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"ok": true})
 }
 
+// trackUserWrite runs write, recording a memory version attributed to the
+// user when absPath is a versioned workspace file.
+func trackUserWrite(wsDir, absPath string, write func() error) error {
+	rel, err := filepath.Rel(wsDir, absPath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return write()
+	}
+	return memory.Track(wsDir, rel, memory.Author{Source: memory.SourceUser}, write)
+}
+
 // ── Download Handler ──────────────────────────────────────────────────────
 // GET /api/download?path=ABSOLUTE_PATH&token=AUTH_TOKEN
 // Serves any local file for download. Auth is via the `token` query parameter
@@ -1,10 +1,13 @@
-// Memory handler — hierarchical memory tree API + memory consolidation config.
+// Memory handler — hierarchical memory tree API + memory consolidation config
+// + version history of memory, IDENTITY.md and SOUL.md.
 package api
 
 import (
 	"context"
+	"errors"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -20,7 +23,7 @@ type memoryHandler struct {
 }
 
 func (h *memoryHandler) getTree(ag *agent.Agent) *memory.MemoryTree {
-	return memory.NewMemoryTree(ag.WorkspaceDir)
+	return memory.NewMemoryTree(ag.WorkspaceDir).As(memory.Author{Source: memory.SourceUser})
 }
 
 // Tree GET /api/agents/:id/memory/tree — returns full memory tree structure
@@ -136,17 +139,24 @@ func (h *memoryHandler) SetConfig(c *gin.Context) {
 	// Read existing config to preserve cronJobId
 	existing, _ := memory.ReadMemConfig(ag.WorkspaceDir)
 
-	// Remove old cron job if any
+	// Remove old cron jobs if any
 	if existing.CronJobID != "" && h.cronEngine != nil {
 		_ = h.cronEngine.Remove(existing.CronJobID)
 		existing.CronJobID = ""
 	}
+	if existing.RollupCronJobID != "" && h.cronEngine != nil {
+		_ = h.cronEngine.Remove(existing.RollupCronJobID)
+		existing.RollupCronJobID = ""
+	}
 
 	// Merge fields
 	existing.Enabled = incoming.Enabled
 	existing.Schedule = incoming.Schedule
 	existing.KeepTurns = incoming.KeepTurns
 	existing.FocusHint = incoming.FocusHint
+	existing.Trim = incoming.Trim
+	existing.Rollup = incoming.Rollup
+	existing.IndexBudget = incoming.IndexBudget
 
 	// Create new cron job if enabling
 	if incoming.Enabled && h.cronEngine != nil {
@@ -170,6 +180,27 @@ func (h *memoryHandler) SetConfig(c *gin.Context) {
 			existing.CronJobID = job.ID
 		}
 	}
+	if incoming.Rollup && h.cronEngine != nil {
+		job := &cron.Job{
+			Name:    "记忆周汇总 · " + ag.Name,
+			Remark:  "由「" + ag.Name + "」的记忆模块自动管理，请勿手动删除",
+			Enabled: true,
+			AgentID: ag.ID,
+			Schedule: cron.Schedule{
+				Kind: "cron",
+				Expr: memory.RollupCron,
+				TZ:   "Asia/Shanghai",
+			},
+			Payload: cron.Payload{
+				Kind:    "agentTurn",
+				Message: "__MEMORY_ROLLUP__",
+			},
+			Delivery: cron.Delivery{Mode: "none"},
+		}
+		if err := h.cronEngine.Add(job); err == nil {
+			existing.RollupCronJobID = job.ID
+		}
+	}
 
 	if err := memory.WriteMemConfig(ag.WorkspaceDir, existing); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -195,6 +226,24 @@ func (h *memoryHandler) ConsolidateNow(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"ok": true, "message": "记忆整理已在后台启动"})
 }
 
+// RollupNow POST /api/agents/:id/memory/rollup — run the weekly/monthly
+// rollup and INDEX.md refresh immediately
+func (h *memoryHandler) RollupNow(c *gin.Context) {
+	ag, ok := h.manager.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent not found"})
+		return
+	}
+	if h.pool == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "pool not initialized"})
+		return
+	}
+	go func() {
+		_, _ = h.pool.RollupMemory(context.Background(), ag.ID)
+	}()
+	c.JSON(http.StatusOK, gin.H{"ok": true, "message": "记忆汇总已在后台启动"})
+}
+
 // RunLog GET /api/agents/:id/memory/run-log — read consolidation run history
 func (h *memoryHandler) RunLog(c *gin.Context) {
 	ag, ok := h.manager.Get(c.Param("id"))
@@ -209,3 +258,151 @@ func (h *memoryHandler) RunLog(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, entries)
 }
+
+// Provenance GET /api/agents/:id/memory/provenance?file=&limit= — which
+// session messages each consolidated daily entry came from, newest first,
+// plus the per-session consolidation watermarks.
+func (h *memoryHandler) Provenance(c *gin.Context) {
+	ag, ok := h.manager.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent not found"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	records, err := memory.ReadProvenance(ag.WorkspaceDir, strings.TrimPrefix(c.Query("file"), "/"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	marks, err := memory.ReadWatermarks(ag.WorkspaceDir)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"records": records, "watermarks": marks})
+}
+
+// ── Versions API ─────────────────────────────────────────────────────────────
+
+// versionPath reads and validates ?path= (workspace-relative, e.g.
+// memory/core/prefs.md or SOUL.md).
+func versionPath(c *gin.Context) (string, bool) {
+	relPath := strings.TrimPrefix(c.Query("path"), "/")
+	if relPath == "" || strings.Contains(relPath, "..") || !memory.Tracked(relPath) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "path must be a memory/, IDENTITY.md or SOUL.md file"})
+		return "", false
+	}
+	return relPath, true
+}
+
+// Versions GET /api/agents/:id/versions?path= — versions of one file, newest
+// first; without path, the files that have history.
+func (h *memoryHandler) Versions(c *gin.Context) {
+	ag, ok := h.manager.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent not found"})
+		return
+	}
+	if c.Query("path") == "" {
+		files, err := memory.VersionedFiles(ag.WorkspaceDir)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"files": files})
+		return
+	}
+	relPath, ok := versionPath(c)
+	if !ok {
+		return
+	}
+	versions, err := memory.ListVersions(ag.WorkspaceDir, relPath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"path": relPath, "versions": versions})
+}
+
+// Version GET /api/agents/:id/versions/:vid?path= — content of one version
+func (h *memoryHandler) Version(c *gin.Context) {
+	ag, ok := h.manager.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent not found"})
+		return
+	}
+	relPath, ok := versionPath(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(c.Param("vid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version id"})
+		return
+	}
+	content, v, err := memory.ReadVersion(ag.WorkspaceDir, relPath, id)
+	if err != nil {
+		c.JSON(versionErrStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"version": v, "content": content})
+}
+
+// VersionDiff GET /api/agents/:id/versions/diff?path=&from=&to= — unified
+// diff between two versions; from=0 is an empty file, to=0 (or omitted) the
+// current file.
+func (h *memoryHandler) VersionDiff(c *gin.Context) {
+	ag, ok := h.manager.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent not found"})
+		return
+	}
+	relPath, ok := versionPath(c)
+	if !ok {
+		return
+	}
+	from, err1 := strconv.Atoi(c.DefaultQuery("from", "0"))
+	to, err2 := strconv.Atoi(c.DefaultQuery("to", "0"))
+	if err1 != nil || err2 != nil || from < 0 || to < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from/to must be version ids"})
+		return
+	}
+	diff, err := memory.DiffVersions(ag.WorkspaceDir, relPath, from, to)
+	if err != nil {
+		c.JSON(versionErrStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, diff)
+}
+
+// RestoreVersion POST /api/agents/:id/versions/:vid/restore?path= — write a
+// version back; the restore is itself recorded as a new version.
+func (h *memoryHandler) RestoreVersion(c *gin.Context) {
+	ag, ok := h.manager.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent not found"})
+		return
+	}
+	relPath, ok := versionPath(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(c.Param("vid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version id"})
+		return
+	}
+	v, err := memory.Restore(ag.WorkspaceDir, relPath, id, memory.Author{Source: memory.SourceUser})
+	if err != nil {
+		c.JSON(versionErrStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "version": v})
+}
+
+func versionErrStatus(err error) int {
+	if errors.Is(err, memory.ErrVersionNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
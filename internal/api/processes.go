@@ -0,0 +1,67 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/process"
+)
+
+type processHandler struct {
+	sup *process.Supervisor
+}
+
+// List GET /api/processes?agentId=&status=
+func (h *processHandler) List(c *gin.Context) {
+	procs := h.sup.List(c.Query("agentId"))
+	if status := c.Query("status"); status != "" {
+		filtered := procs[:0]
+		for _, p := range procs {
+			if string(p.Status) == status {
+				filtered = append(filtered, p)
+			}
+		}
+		procs = filtered
+	}
+	c.JSON(http.StatusOK, procs)
+}
+
+// Get GET /api/processes/:id
+func (h *processHandler) Get(c *gin.Context) {
+	p, ok := h.sup.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "process not found"})
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+// Logs GET /api/processes/:id/logs?tail=65536
+func (h *processHandler) Logs(c *gin.Context) {
+	tail, _ := strconv.ParseInt(c.DefaultQuery("tail", "65536"), 10, 64)
+	out, err := h.sup.Logs(c.Param("id"), tail)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"output": out})
+}
+
+// Kill POST /api/processes/:id/kill
+func (h *processHandler) Kill(c *gin.Context) {
+	if err := h.sup.Kill(c.Param("id")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// Remove DELETE /api/processes/:id — forget a finished process and its logs.
+func (h *processHandler) Remove(c *gin.Context) {
+	if err := h.sup.Remove(c.Param("id")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
@@ -19,21 +19,34 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/agent"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/audit"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/channel"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/compaction"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/config"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/contact"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/convlog"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/document"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/llm"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/runner"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/scheduler"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/session"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/tools"
 )
 
 var pubSSECounter atomic.Uint64
 
+// Limits for documents uploaded by anonymous web-channel visitors.
+const (
+	maxPublicAttachments     = 3
+	maxPublicAttachmentBytes = 10 << 20
+)
+
 type publicChatHandler struct {
 	manager    *agent.Manager
 	pool       *agent.Pool
 	workerPool *session.WorkerPool
 	cfg        *config.Config
+	scheduler  *scheduler.Scheduler
 }
 
 func findWebChannelByID(ag *agent.Agent, channelID string) *config.ChannelEntry {
@@ -125,7 +138,20 @@ func (h *publicChatHandler) History(c *gin.Context) {
 	for _, m := range msgs {
 		var text string
 		if err2 := json.Unmarshal(m.Content, &text); err2 != nil {
-			text = string(m.Content)
+			// Multimodal turns (e.g. PDF attachments): show only the text blocks.
+			var blocks []struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			}
+			if json.Unmarshal(m.Content, &blocks) == nil {
+				for _, b := range blocks {
+					if b.Type == "text" {
+						text += b.Text
+					}
+				}
+			} else {
+				text = string(m.Content)
+			}
 		}
 		if text != "" {
 			out = append(out, outMsg{Role: m.Role, Content: text})
@@ -149,11 +175,35 @@ func (h *publicChatHandler) Stream(c *gin.Context) {
 	var req struct {
 		Message      string `json:"message"`
 		SessionToken string `json:"sessionToken"`
+		// Attachments are documents (PDF/DOCX/XLSX/PPTX) as base64 data URIs.
+		Attachments []struct {
+			Name string `json:"name"`
+			Data string `json:"data"`
+		} `json:"attachments"`
 	}
-	if err := c.ShouldBindJSON(&req); err != nil || req.Message == "" {
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Message == "" && len(req.Attachments) == 0) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "message required"})
 		return
 	}
+	if len(req.Attachments) > maxPublicAttachments {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d attachments", maxPublicAttachments)})
+		return
+	}
+	var media []channel.MediaInput
+	for _, a := range req.Attachments {
+		m, err := agent.MediaFromDataURI(a.Name, a.Data)
+		if err == nil && document.DetectFormat(m.FileName, m.ContentType) == "" {
+			err = fmt.Errorf("unsupported file type")
+		}
+		if err == nil && len(m.Data) > maxPublicAttachmentBytes {
+			err = fmt.Errorf("file too large (max %d MB)", maxPublicAttachmentBytes>>20)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("attachment %q: %v", a.Name, err)})
+			return
+		}
+		media = append(media, m)
+	}
 
 	sid := buildWebSessionID(ch.ID, req.SessionToken)
 	if sid == "" {
@@ -164,17 +214,30 @@ func (h *publicChatHandler) Stream(c *gin.Context) {
 	clChID := "web-" + ch.ID
 	agentDir := filepath.Dir(ag.WorkspaceDir)
 	cl := convlog.New(agentDir, clChID)
+	logText := req.Message
+	for _, m := range media {
+		logText += " [📎 " + m.FileName + "]"
+	}
 	_ = cl.Append(convlog.Entry{
 		Timestamp: time.Now().UTC().Format(time.RFC3339), Role: "user",
-		Content: req.Message, ChannelID: clChID, ChannelType: "web", Sender: req.SessionToken,
+		Content: strings.TrimSpace(logText), ChannelID: clChID, ChannelType: "web", Sender: req.SessionToken,
 	})
 
 	// Snapshot fields needed in the closure (avoid data races)
 	agID, wsDir, sessDir, agEnv := ag.ID, ag.WorkspaceDir, ag.SessionDir, ag.Env
 	msgCopy, sidCopy := req.Message, sid
 
+	// Visitors with a stable session token get a contact profile of their own.
+	var sender contact.Sender
+	if tok := sanitizeToken(req.SessionToken); tok != "" {
+		sender = contact.Sender{Key: contact.WebKey(ch.ID, tok), Channel: "web"}
+	}
+
 	runFn := func(ctx context.Context, sessionID, _ string, bc *session.Broadcaster) error {
-		return h.runPublic(ctx, agID, wsDir, sessDir, agEnv, sessionID, msgCopy, bc, cl, clChID)
+		if sender.Key != "" {
+			ctx = contact.WithSender(ctx, sender)
+		}
+		return h.runPublic(ctx, agID, wsDir, sessDir, agEnv, sessionID, msgCopy, media, bc, cl, clChID)
 	}
 
 	worker := h.workerPool.GetOrCreate(sid)
@@ -185,7 +248,7 @@ func (h *publicChatHandler) Stream(c *gin.Context) {
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
 		return
 	}
-	h.pipeSSE(c, worker, sidCopy)
+	h.pipeSSE(c, worker, sidCopy, 0)
 }
 
 // ─── Reconnect ───────────────────────────────────────────────────────────────
@@ -204,17 +267,15 @@ func (h *publicChatHandler) Reconnect(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "sessionId required"})
 		return
 	}
+	after := lastEventID(c)
 	worker := h.workerPool.Get(sid)
 	if worker == nil {
-		c.Header("Content-Type", "text/event-stream")
-		c.Header("Cache-Control", "no-cache")
-		c.Header("Connection", "keep-alive")
-		data, _ := json.Marshal(map[string]any{"type": "idle"})
-		fmt.Fprintf(c.Writer, "data: %s\n\n", data)
-		c.Writer.Flush()
+		replaySSE(c, h.workerPool.Replay(sid, after), func(ev session.BroadcastEvent) []byte {
+			return publicEventData(ev, sid)
+		})
 		return
 	}
-	h.pipeSSE(c, worker, sid)
+	h.pipeSSE(c, worker, sid, after)
 }
 
 // ─── Helpers ─────────────────────────────────────────────────────────────────
@@ -239,6 +300,7 @@ func (h *publicChatHandler) runPublic(
 	agentID, workspaceDir, sessionDir string,
 	agEnv map[string]string,
 	sessionID, message string,
+	media []channel.MediaInput,
 	bc *session.Broadcaster,
 	cl *convlog.ConvLog, clChannelID string,
 ) error {
@@ -273,18 +335,41 @@ func (h *publicChatHandler) runPublic(
 	if len(agEnv) > 0 {
 		toolRegistry.WithEnv(agEnv)
 	}
+	toolRegistry.WithToolEntries(h.cfg.Tools, ag.ToolIDs)
+	toolRegistry.WithWebFetch(config.MergeWebFetch(h.cfg.WebFetch, ag.WebFetch))
 	toolRegistry.WithSessionID(sessionID)
+	var contactCtx string
+	if h.pool != nil {
+		toolRegistry.WithSenderContacts(h.pool.Contacts())
+		toolRegistry.WithTeamMemoryReadOnly(h.pool.TeamMemory())
+		contactCtx = h.pool.ContactContext(ctx, agentID, sessionID, message)
+	}
+	if h.pool != nil && h.pool.AuditLogger() != nil {
+		toolRegistry.WithAudit(h.pool.AuditLogger())
+		ctx = audit.WithMeta(ctx, audit.Meta{Source: "public", Channel: clChannelID, SessionID: sessionID})
+	}
+
+	compactPolicy := compaction.Resolve(h.cfg, ag.Compaction, me)
+	images, preamble := agent.PrepareMedia(workspaceDir, me.ProviderModel(), media)
+	if preamble != "" {
+		message = strings.TrimSpace(preamble + "\n\n" + message)
+	}
 
 	r := runner.New(runner.Config{
-		AgentID:      agentID,
-		WorkspaceDir: workspaceDir,
-		Model:        me.ProviderModel(),
-		APIKey:       apiKey,
-		SessionID:    sessionID,
-		LLM:          llmClient,
-		Tools:        toolRegistry,
-		Session:      store,
-		AgentEnv:     agEnv,
+		AgentID:        agentID,
+		WorkspaceDir:   workspaceDir,
+		Model:          me.ProviderModel(),
+		APIKey:         apiKey,
+		SessionID:      sessionID,
+		LLM:            llmClient,
+		Tools:          toolRegistry,
+		Session:        store,
+		Images:         images,
+		ContactContext: contactCtx,
+		AgentEnv:       agEnv,
+		Scheduler:      h.scheduler,
+		Compaction:     &compactPolicy,
+		MemoryRecall:   h.cfg.MemorySearch.AutoInject,
 	})
 
 	var fullResponse strings.Builder
@@ -300,6 +385,8 @@ func (h *publicChatHandler) runPublic(
 		case "tool_result":
 			data := runEventToJSON(ev)
 			bc.Publish(session.BroadcastEvent{Type: "tool_result", Data: data})
+		case "queued":
+			bc.Publish(session.BroadcastEvent{Type: "queued", Data: runEventToJSON(ev)})
 		case "error":
 			if ev.Error != nil {
 				data, _ := json.Marshal(map[string]any{"type": "error", "error": ev.Error.Error()})
@@ -321,14 +408,16 @@ func (h *publicChatHandler) runPublic(
 }
 
 // pipeSSE streams broadcaster events to the client, injecting sessionId into done.
-func (h *publicChatHandler) pipeSSE(c *gin.Context, worker *session.SessionWorker, sessionID string) {
-	c.Header("Content-Type", "text/event-stream")
-	c.Header("Cache-Control", "no-cache")
-	c.Header("Connection", "keep-alive")
-	c.Header("X-Accel-Buffering", "no")
+func (h *publicChatHandler) pipeSSE(c *gin.Context, worker *session.SessionWorker, sessionID string, after uint64) {
+	bc := worker.Broadcaster
+	if after > 0 && after == bc.LastID() && bc.IsDone() {
+		replaySSE(c, nil, nil) // already up to date
+		return
+	}
+	setSSEHeaders(c)
 
 	subKey := fmt.Sprintf("pub-%d", pubSSECounter.Add(1))
-	ch, unsub := worker.Broadcaster.Subscribe(subKey)
+	ch, unsub := bc.Subscribe(subKey, after)
 	defer unsub()
 
 	c.Stream(func(w io.Writer) bool {
@@ -337,19 +426,24 @@ func (h *publicChatHandler) pipeSSE(c *gin.Context, worker *session.SessionWorke
 			if !ok {
 				return false
 			}
-			if ev.Type == "done" || ev.Type == "error" {
-				data, _ := json.Marshal(map[string]any{"type": ev.Type, "sessionId": sessionID})
-				fmt.Fprintf(w, "data: %s\n\n", data)
-				return false
-			}
-			fmt.Fprintf(w, "data: %s\n\n", ev.Data)
-			return true
+			writeSSEEvent(w, ev.ID, publicEventData(ev, sessionID))
+			return !isFinal(ev) || ev.Gen < bc.Gen()
 		case <-c.Request.Context().Done():
 			return false
 		}
 	})
 }
 
+// publicEventData replaces the payload of final events with one that only
+// carries the session ID.
+func publicEventData(ev session.BroadcastEvent, sessionID string) []byte {
+	if !isFinal(ev) {
+		return ev.Data
+	}
+	data, _ := json.Marshal(map[string]any{"type": ev.Type, "sessionId": sessionID})
+	return data
+}
+
 // ─── Legacy ──────────────────────────────────────────────────────────────────
 
 func (h *publicChatHandler) InfoLegacy(c *gin.Context) {
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/config"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/retention"
+)
+
+type retentionHandler struct {
+	cfg     *config.Config
+	janitor *retention.Janitor
+}
+
+// Get GET /api/retention — current policy and the last janitor report.
+// Policies are edited through PATCH /api/config {"retention": ...} and
+// per agent through PATCH /api/agents/:id {"retention": ...}.
+func (h *retentionHandler) Get(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"config":     h.cfg.Retention,
+		"lastReport": h.janitor.LastReport(),
+	})
+}
+
+// Run POST /api/retention/run?dryRun=true
+// Runs a janitor pass now (even when retention is disabled) and returns its report.
+func (h *retentionHandler) Run(c *gin.Context) {
+	dryRun := c.Query("dryRun") == "true" || c.Query("dryRun") == "1"
+	c.JSON(http.StatusOK, h.janitor.Run(dryRun))
+}
@@ -63,7 +63,7 @@ func RegisterRoutes(r *gin.Engine, cfg *config.Config, mgr *agent.Manager, pool
 	}
 
 	// Per-agent channels (each member has its own bot tokens)
-	agChH := &agentChannelHandler{manager: mgr, runnerFunc: rf, botCtrl: botCtrl}
+	agChH := &agentChannelHandler{manager: mgr, runnerFunc: rf, botCtrl: botCtrl, bus: pool.EventBus()}
 	agents.GET("/:id/channels", agChH.GetChannels)
 	agents.PUT("/:id/channels", agChH.SetChannels)
 	agents.POST("/:id/channels/check-token", agChH.CheckToken)
@@ -76,7 +76,7 @@ func RegisterRoutes(r *gin.Engine, cfg *config.Config, mgr *agent.Manager, pool
 	agents.DELETE("/:id/channels/:chId/allowed/:userId", agChH.RemoveAllowed)
 
 	// Chat (streaming SSE) — background worker architecture
-	chatH := &chatHandler{cfg: cfg, manager: mgr, projectMgr: projectMgr, subagentMgr: subagentMgr, workerPool: workerPool}
+	chatH := &chatHandler{cfg: cfg, manager: mgr, projectMgr: projectMgr, subagentMgr: subagentMgr, processSup: pool.ProcessSupervisor(), auditLog: pool.AuditLogger(), cronEngine: cronEngine, dataStore: pool.DataStore(), contacts: pool.Contacts(), teamMem: pool.TeamMemory(), searchIdx: pool.SearchIndexer(), workerPool: workerPool, scheduler: pool.Scheduler()}
 	agents.POST("/:id/chat", chatH.Chat)                          // enqueue + stream
 	agents.GET("/:id/chat/stream", chatH.StreamSession)           // reconnect: subscribe to broadcaster
 	agents.GET("/:id/chat/status", chatH.SessionStatus)           // poll status
@@ -110,7 +110,13 @@ func RegisterRoutes(r *gin.Engine, cfg *config.Config, mgr *agent.Manager, pool
 	agents.GET("/:id/memory/config", memH.GetConfig)
 	agents.PUT("/:id/memory/config", memH.SetConfig)
 	agents.POST("/:id/memory/consolidate", memH.ConsolidateNow)
+	agents.POST("/:id/memory/rollup", memH.RollupNow)
 	agents.GET("/:id/memory/run-log", memH.RunLog)
+	agents.GET("/:id/memory/provenance", memH.Provenance)
+	agents.GET("/:id/versions", memH.Versions)
+	agents.GET("/:id/versions/diff", memH.VersionDiff)
+	agents.GET("/:id/versions/:vid", memH.Version)
+	agents.POST("/:id/versions/:vid/restore", memH.RestoreVersion)
 
 	// ── Global Config Registries ──────────────────────────────────────────
 
@@ -173,13 +179,18 @@ func RegisterRoutes(r *gin.Engine, cfg *config.Config, mgr *agent.Manager, pool
 	}
 
 	// Global Sessions (conversation management across all agents)
-	sessH := &globalSessionsHandler{cfg: cfg, manager: mgr}
+	sessH := &globalSessionsHandler{cfg: cfg, manager: mgr, pool: pool}
 	globalSess := v1.Group("/sessions")
 	{
 		globalSess.GET("", sessH.List)
+		globalSess.POST("/import", sessH.Import)
+		globalSess.GET("/archived", sessH.ListArchived)
 		globalSess.GET("/:agentId/:sid", sessH.Get)
+		globalSess.GET("/:agentId/:sid/export", sessH.Export)
 		globalSess.DELETE("/:agentId/:sid", sessH.Delete)
 		globalSess.PATCH("/:agentId/:sid", sessH.Patch)
+		globalSess.POST("/:agentId/:sid/compact", sessH.Compact)
+		globalSess.GET("/:agentId/:sid/compactions", sessH.Compactions)
 	}
 
 	// Cron jobs
@@ -192,6 +203,8 @@ func RegisterRoutes(r *gin.Engine, cfg *config.Config, mgr *agent.Manager, pool
 		cronGroup.DELETE("/:jobId", cronH.Delete)
 		cronGroup.POST("/:jobId/run", cronH.Run)
 		cronGroup.GET("/:jobId/runs", cronH.Runs)
+		cronGroup.GET("/:jobId/next", cronH.Next)
+		cronGroup.POST("/preview", cronH.Preview)
 	}
 
 	// Config (legacy)
@@ -201,7 +214,7 @@ func RegisterRoutes(r *gin.Engine, cfg *config.Config, mgr *agent.Manager, pool
 	v1.POST("/config/test-key", cfgH.TestKey)
 
 	// ── Public routes (no auth — web channel) ─────────────────────────────
-	pubH := &publicChatHandler{manager: mgr, pool: pool, workerPool: workerPool, cfg: cfg}
+	pubH := &publicChatHandler{manager: mgr, pool: pool, workerPool: workerPool, cfg: cfg, scheduler: pool.Scheduler()}
 	pub := r.Group("/pub")
 	{
 		// Per-channel routes (primary)
@@ -243,6 +256,80 @@ func RegisterRoutes(r *gin.Engine, cfg *config.Config, mgr *agent.Manager, pool
 		}
 	}
 
+	// Background processes started by agents (process_start)
+	if sup := pool.ProcessSupervisor(); sup != nil {
+		procH := &processHandler{sup: sup}
+		procs := v1.Group("/processes")
+		{
+			procs.GET("", procH.List)
+			procs.GET("/:id", procH.Get)
+			procs.GET("/:id/logs", procH.Logs)
+			procs.POST("/:id/kill", procH.Kill)
+			procs.DELETE("/:id", procH.Remove)
+		}
+	}
+
+	// Tool-call audit log
+	if al := pool.AuditLogger(); al != nil {
+		auditH := &auditHandler{log: al}
+		v1.GET("/audit/tools", auditH.Tools)
+	}
+
+	// Per-agent key-value store and SQLite scratch database (kv_* / sql_query tools)
+	if ds := pool.DataStore(); ds != nil {
+		dsH := &dataStoreHandler{manager: mgr, stores: ds}
+		agents.GET("/:id/datastore", dsH.Overview)
+		agents.GET("/:id/datastore/kv", dsH.ListKV)
+		agents.DELETE("/:id/datastore/kv/*key", dsH.DeleteKV)
+		agents.POST("/:id/datastore/sql", dsH.Query)
+		agents.GET("/:id/datastore/export", dsH.Export)
+	}
+
+	// Per-agent contact profiles (contact_* tools)
+	if cs := pool.Contacts(); cs != nil {
+		ctH := &contactHandler{manager: mgr, stores: cs}
+		agents.GET("/:id/contacts", ctH.List)
+		agents.GET("/:id/contacts/:cid", ctH.Get)
+		agents.PATCH("/:id/contacts/:cid", ctH.Update)
+		agents.DELETE("/:id/contacts/:cid", ctH.Delete)
+		agents.POST("/:id/contacts/:cid/link", ctH.Link)
+		agents.POST("/:id/contacts/:cid/unlink", ctH.Unlink)
+	}
+
+	// Team-shared memory (team_memory_* tools) — policy, files and proposal review
+	if tm := pool.TeamMemory(); tm != nil {
+		tmH := &teamMemoryHandler{store: tm}
+		v1.GET("/team-memory/policy", tmH.GetPolicy)
+		v1.PUT("/team-memory/policy", tmH.SetPolicy)
+		v1.GET("/team-memory/tree", tmH.Tree)
+		v1.GET("/team-memory/file", tmH.ReadFile)
+		v1.PUT("/team-memory/file", tmH.WriteFile)
+		v1.DELETE("/team-memory/file", tmH.DeleteFile)
+		v1.GET("/team-memory/search", tmH.Search)
+		v1.GET("/team-memory/proposals", tmH.Proposals)
+		v1.POST("/team-memory/proposals/:pid/approve", tmH.Approve)
+		v1.POST("/team-memory/proposals/:pid/reject", tmH.Reject)
+	}
+
+	// Session retention janitor
+	if j := pool.Janitor(); j != nil {
+		retH := &retentionHandler{cfg: cfg, janitor: j}
+		v1.GET("/retention", retH.Get)
+		v1.POST("/retention/run", retH.Run)
+	}
+
+	// Global full-text search over sessions, conversation logs, memory and projects
+	if si := pool.SearchIndexer(); si != nil {
+		searchH := &searchHandler{indexer: si}
+		v1.GET("/search", searchH.Search)
+	}
+
+	// Run scheduler metrics
+	if sched := pool.Scheduler(); sched != nil {
+		schedH := &schedulerHandler{scheduler: sched}
+		v1.GET("/scheduler", schedH.Metrics)
+	}
+
 	// Health & Stats
 	v1.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": "healthy"})
@@ -256,8 +343,9 @@ func RegisterRoutes(r *gin.Engine, cfg *config.Config, mgr *agent.Manager, pool
 	// Media file serving (auth via header or ?token= query param)
 	r.GET("/api/media", (&mediaHandler{token: cfg.Auth.Token}).ServeMedia)
 
-	// WebSocket
-	r.GET("/ws", wsHandler)
+	// WebSocket — chat, control and live system events on one connection
+	wsH := &wsHandler{token: cfg.Auth.Token, chat: chatH, channels: agChH, stats: statsH, bus: pool.EventBus(), subagentMgr: subagentMgr, cronEngine: cronEngine, workerPool: workerPool}
+	r.GET("/ws", wsH.Serve)
 
 	// ── Serve embedded Vue SPA ────────────────────────────────────────────
 	if uiFS != nil {
@@ -332,6 +420,12 @@ type statsHandler struct {
 }
 
 func (h *statsHandler) Handle(c *gin.Context) {
+	c.JSON(http.StatusOK, h.compute())
+}
+
+// compute builds the /api/stats payload (also pushed on the WebSocket
+// "stats" channel).
+func (h *statsHandler) compute() gin.H {
 	agents := h.manager.List()
 
 	type agentStats struct {
@@ -387,7 +481,7 @@ func (h *statsHandler) Handle(c *gin.Context) {
 		topAgents = []agentStats{}
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	return gin.H{
 		"agents": gin.H{
 			"total":   len(agents),
 			"running": runningCount,
@@ -398,7 +492,7 @@ func (h *statsHandler) Handle(c *gin.Context) {
 			"totalTokens":   totalTokens,
 		},
 		"topAgents": topAgents,
-	})
+	}
 }
 
 // logsHandler reads /tmp/aipanel.log and returns the last N lines.
@@ -434,7 +528,3 @@ func logsHandler(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, gin.H{"lines": lines})
 }
-
-func wsHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"message": "websocket not yet implemented"})
-}
@@ -0,0 +1,17 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/scheduler"
+)
+
+type schedulerHandler struct {
+	scheduler *scheduler.Scheduler
+}
+
+// Metrics GET /api/scheduler — limits, running and queued runs, per-class counters.
+func (h *schedulerHandler) Metrics(c *gin.Context) {
+	c.JSON(http.StatusOK, h.scheduler.Metrics())
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/search"
+)
+
+type searchHandler struct {
+	indexer *search.Indexer
+}
+
+// Search GET /api/search?q=&agentId=&channel=&role=&source=session,convlog&since=&until=&sort=relevance|recent&limit=&offset=
+// since/until accept YYYY-MM-DD (until is inclusive), RFC 3339 or unix ms.
+// Snippets are HTML-escaped with matches wrapped in <mark>.
+func (h *searchHandler) Search(c *gin.Context) {
+	q := search.Query{
+		Text:    strings.TrimSpace(c.Query("q")),
+		AgentID: c.Query("agentId"),
+		Channel: c.Query("channel"),
+		Role:    c.Query("role"),
+		Sort:    c.Query("sort"),
+	}
+	if q.Text == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+	if src := c.Query("source"); src != "" {
+		q.Sources = strings.Split(src, ",")
+	}
+	var err error
+	if q.Since, err = parseSearchTime(c.Query("since"), false); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid since: " + err.Error()})
+		return
+	}
+	if q.Until, err = parseSearchTime(c.Query("until"), true); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid until: " + err.Error()})
+		return
+	}
+	q.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if q.Limit <= 0 || q.Limit > 100 {
+		q.Limit = 20
+	}
+	q.Offset, _ = strconv.Atoi(c.Query("offset"))
+
+	h.indexer.RefreshIfStale(10 * time.Second)
+	hits, total, err := h.indexer.Index().Search(q)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"hits": hits, "total": total})
+}
+
+// parseSearchTime accepts a bare date in addition to parseAuditTime's
+// formats; with endOfDay a date means "up to and including that day".
+func parseSearchTime(s string, endOfDay bool) (time.Time, error) {
+	if len(s) == len("2006-01-02") {
+		if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+			if endOfDay {
+				t = t.AddDate(0, 0, 1)
+			}
+			return t, nil
+		}
+	}
+	return parseAuditTime(s)
+}
@@ -3,6 +3,9 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"sort"
 	"strconv"
@@ -10,6 +13,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/agent"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/compaction"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/config"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/session"
 )
@@ -17,6 +21,7 @@ import (
 type globalSessionsHandler struct {
 	cfg     *config.Config
 	manager *agent.Manager
+	pool    *agent.Pool
 }
 
 // SessionSummary extends SessionIndexEntry with agent display info.
@@ -28,11 +33,12 @@ type SessionSummary struct {
 
 // ParsedMessage is a cleaned-up message for the UI.
 type ParsedMessage struct {
-	Role      string                   `json:"role"`                // "user" | "assistant" | "compaction"
-	Text      string                   `json:"text"`                // plain text extracted from content
-	Timestamp int64                    `json:"timestamp"`
-	IsCompact bool                     `json:"isCompact,omitempty"` // true for compaction summary entries
-	ToolCalls []session.ToolCallRecord `json:"toolCalls,omitempty"` // tool timeline (display only)
+	Role       string                   `json:"role"` // "user" | "assistant" | "compaction"
+	Text       string                   `json:"text"` // plain text extracted from content
+	Timestamp  int64                    `json:"timestamp"`
+	IsCompact  bool                     `json:"isCompact,omitempty"`  // true for compaction summary entries
+	ToolCalls  []session.ToolCallRecord `json:"toolCalls,omitempty"`  // tool timeline (display only)
+	Compaction *session.CompactionEntry `json:"compaction,omitempty"` // details (compaction entries only)
 }
 
 // List GET /api/sessions?agentId=&limit=50&q=
@@ -96,15 +102,11 @@ func (h *globalSessionsHandler) Get(c *gin.Context) {
 		return
 	}
 
-	store := session.NewStore(ag.SessionDir)
-	meta, exists := store.GetMeta(sid)
-	if !exists {
+	meta, entries, archived, err := loadSession(ag.SessionDir, sid)
+	if err == errSessionNotFound {
 		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
 		return
 	}
-
-	// Parse JSONL for messages
-	entries, err := store.ReadAll(sid)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -115,6 +117,7 @@ func (h *globalSessionsHandler) Get(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"session":  meta,
 		"messages": messages,
+		"archived": archived,
 		"agent": gin.H{
 			"id":   ag.ID,
 			"name": ag.Name,
@@ -133,6 +136,14 @@ func (h *globalSessionsHandler) Delete(c *gin.Context) {
 		return
 	}
 
+	if _, ok := session.GetArchived(ag.SessionDir, sid); ok {
+		if err := session.DeleteArchived(ag.SessionDir, sid); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+		return
+	}
 	store := session.NewStore(ag.SessionDir)
 	if err := store.DeleteSession(sid); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -171,6 +182,102 @@ func (h *globalSessionsHandler) Patch(c *gin.Context) {
 	c.JSON(http.StatusOK, meta)
 }
 
+// Compact POST /api/sessions/:agentId/:sid/compact
+// Body: {"dryRun": true, "pinned": [<message timestamp>, ...]} (optional).
+// Summarises everything before the policy's kept turns; with dryRun only
+// reports what would be summarised, pinned and kept.
+func (h *globalSessionsHandler) Compact(c *gin.Context) {
+	var body struct {
+		DryRun bool    `json:"dryRun"`
+		Pinned []int64 `json:"pinned"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if c.Query("dryRun") == "true" {
+		body.DryRun = true
+	}
+	res, err := h.pool.CompactSession(c.Request.Context(), c.Param("agentId"), c.Param("sid"), body.Pinned, body.DryRun)
+	switch {
+	case errors.Is(err, compaction.ErrBusy):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// Compactions GET /api/sessions/:agentId/:sid/compactions
+// Lists the session's compaction entries, oldest first.
+func (h *globalSessionsHandler) Compactions(c *gin.Context) {
+	ag, ok := h.manager.Get(c.Param("agentId"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent not found"})
+		return
+	}
+	store := session.NewStore(ag.SessionDir)
+	if _, ok := store.GetMeta(c.Param("sid")); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	entries, err := compaction.History(store, c.Param("sid"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"compactions": entries})
+}
+
+var errSessionNotFound = errors.New("session not found")
+
+// loadSession reads a live session, falling back to the retention archive.
+func loadSession(dir, sid string) (session.SessionIndexEntry, []json.RawMessage, bool, error) {
+	store := session.NewStore(dir)
+	if meta, ok := store.GetMeta(sid); ok {
+		entries, err := store.ReadAll(sid)
+		return meta, entries, false, err
+	}
+	a, ok := session.GetArchived(dir, sid)
+	if !ok {
+		return session.SessionIndexEntry{}, nil, false, errSessionNotFound
+	}
+	entries, err := session.ReadArchived(dir, sid)
+	return a.SessionIndexEntry, entries, true, err
+}
+
+// ArchivedSummary is an archived session with agent display info.
+type ArchivedSummary struct {
+	session.ArchivedSession
+	AgentName string `json:"agentName"`
+	AgentID   string `json:"agentId"`
+}
+
+// ListArchived GET /api/sessions/archived?agentId=
+// Lists sessions moved to the archive by the retention janitor. Archived
+// sessions can be opened, exported and deleted like live ones.
+func (h *globalSessionsHandler) ListArchived(c *gin.Context) {
+	filterAgent := c.Query("agentId")
+	all := []ArchivedSummary{}
+	for _, ag := range h.manager.List() {
+		if filterAgent != "" && ag.ID != filterAgent {
+			continue
+		}
+		list, err := session.ListArchived(ag.SessionDir)
+		if err != nil {
+			continue
+		}
+		for _, a := range list {
+			all = append(all, ArchivedSummary{ArchivedSession: a, AgentName: ag.Name, AgentID: ag.ID})
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].LastAt > all[j].LastAt })
+	c.JSON(http.StatusOK, gin.H{"sessions": all, "total": len(all)})
+}
+
 // parseMessagesFromJSONL converts raw JSONL lines into ParsedMessage slice.
 func parseMessagesFromJSONL(lines []json.RawMessage) []ParsedMessage {
 	var result []ParsedMessage
@@ -192,8 +299,9 @@ func parseMessagesFromJSONL(lines []json.RawMessage) []ParsedMessage {
 					ToolCalls []session.ToolCallRecord `json:"toolCalls,omitempty"`
 				} `json:"message"`
 				Timestamp int64 `json:"timestamp"`
+				Carried   bool  `json:"carried"`
 			}
-			if err := json.Unmarshal(line, &entry); err != nil {
+			if err := json.Unmarshal(line, &entry); err != nil || entry.Carried {
 				continue
 			}
 			if entry.Message.Role != "user" && entry.Message.Role != "assistant" {
@@ -217,18 +325,16 @@ func parseMessagesFromJSONL(lines []json.RawMessage) []ParsedMessage {
 			})
 
 		case "compaction":
-			var entry struct {
-				Summary   string `json:"summary"`
-				Timestamp int64  `json:"timestamp"`
-			}
+			var entry session.CompactionEntry
 			if err := json.Unmarshal(line, &entry); err != nil {
 				continue
 			}
 			result = append(result, ParsedMessage{
-				Role:      "compaction",
-				Text:      entry.Summary,
-				Timestamp: entry.Timestamp,
-				IsCompact: true,
+				Role:       "compaction",
+				Text:       entry.Summary,
+				Timestamp:  entry.Timestamp,
+				IsCompact:  true,
+				Compaction: &entry,
 			})
 		}
 	}
@@ -293,3 +399,105 @@ func joinStrings(ss []string, sep string) string {
 	}
 	return result
 }
+
+// sessionImportMaxBytes bounds uploaded transcripts (images are inline).
+const sessionImportMaxBytes = 50 * 1024 * 1024
+
+var exportExts = map[string]string{
+	session.FormatMarkdown:  "md",
+	session.FormatHTML:      "html",
+	session.FormatJSON:      "json",
+	session.FormatOpenAI:    "openai.json",
+	session.FormatAnthropic: "anthropic.json",
+}
+
+// Export GET /api/sessions/:agentId/:sid/export?format=md|html|json|openai|anthropic
+// Downloads the session as an attachment (default: md).
+func (h *globalSessionsHandler) Export(c *gin.Context) {
+	ag, ok := h.manager.Get(c.Param("agentId"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent not found"})
+		return
+	}
+	sid := c.Param("sid")
+	format := c.DefaultQuery("format", session.FormatMarkdown)
+	ext, ok := exportExts[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be md, html, json, openai or anthropic"})
+		return
+	}
+
+	meta, entries, _, err := loadSession(ag.SessionDir, sid)
+	if err == errSessionNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	data, contentType, err := session.Export(session.ExportInfo{Meta: meta, AgentName: ag.Name}, entries, format)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.%s"`, ag.ID, sid, ext))
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// Import POST /api/sessions/import
+// Multipart form (file, agentId, title?) or a raw body with ?agentId=&filename=&title=.
+// Creates a new session for the agent and returns its ID.
+func (h *globalSessionsHandler) Import(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, sessionImportMaxBytes)
+	agentID, title, filename := c.Query("agentId"), c.Query("title"), c.Query("filename")
+	var data []byte
+	if file, err := c.FormFile("file"); err == nil {
+		if v := c.PostForm("agentId"); v != "" {
+			agentID = v
+		}
+		if v := c.PostForm("title"); v != "" {
+			title = v
+		}
+		filename = file.Filename
+		f, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer f.Close()
+		data, err = io.ReadAll(f)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	} else {
+		var err error
+		if data, err = io.ReadAll(c.Request.Body); err != nil {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file too large (max 50MB)"})
+			return
+		}
+	}
+
+	ag, ok := h.manager.Get(agentID)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent not found"})
+		return
+	}
+	im, err := session.ParseImport(data, filename)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if title == "" {
+		title = im.Title
+	}
+	store := session.NewStore(ag.SessionDir)
+	sid, err := store.Import(ag.ID, title, im.Entries)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	meta, _ := store.GetMeta(sid)
+	c.JSON(http.StatusOK, gin.H{"session": meta, "agentId": ag.ID})
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/session"
+)
+
+func setSSEHeaders(c *gin.Context) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+}
+
+// lastEventID reads the resume point from the Last-Event-ID header (sent by
+// EventSource) or the lastEventId query parameter (0 = none).
+func lastEventID(c *gin.Context) uint64 {
+	v := c.GetHeader("Last-Event-ID")
+	if v == "" {
+		v = c.Query("lastEventId")
+	}
+	id, _ := strconv.ParseUint(v, 10, 64)
+	return id
+}
+
+// writeSSEEvent writes one SSE frame with its event ID.
+func writeSSEEvent(w io.Writer, id uint64, data []byte) {
+	fmt.Fprintf(w, "id: %d\ndata: %s\n\n", id, data)
+}
+
+// isFinal reports whether ev ends a generation.
+func isFinal(ev session.BroadcastEvent) bool {
+	return ev.Type == "done" || ev.Type == "error"
+}
+
+// replaySSE answers a reconnect for a session without a live worker: the
+// persisted events the client missed, or a single idle event. payload maps
+// an event to its SSE data (nil = ev.Data).
+func replaySSE(c *gin.Context, events []session.BroadcastEvent, payload func(session.BroadcastEvent) []byte) {
+	setSSEHeaders(c)
+	if len(events) == 0 {
+		data, _ := json.Marshal(map[string]any{"type": "idle"})
+		fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+		c.Writer.Flush()
+		return
+	}
+	for _, ev := range events {
+		data := []byte(ev.Data)
+		if payload != nil {
+			data = payload(ev)
+		}
+		writeSSEEvent(c.Writer, ev.ID, data)
+	}
+	c.Writer.Flush()
+}
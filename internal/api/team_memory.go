@@ -0,0 +1,158 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/memory"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/teammem"
+)
+
+type teamMemoryHandler struct {
+	store *teammem.Store
+}
+
+func (h *teamMemoryHandler) tree() *memory.MemoryTree {
+	return h.store.Tree(memory.Author{Source: memory.SourceUser})
+}
+
+// teamFilePath reads and validates ?path= (relative to the team memory/ dir).
+func teamFilePath(c *gin.Context) (string, bool) {
+	rel, err := teammem.CleanPath(c.Query("path"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", false
+	}
+	return rel, true
+}
+
+// GetPolicy GET /api/team-memory/policy
+func (h *teamMemoryHandler) GetPolicy(c *gin.Context) {
+	c.JSON(http.StatusOK, h.store.Policy())
+}
+
+// SetPolicy PUT /api/team-memory/policy — readers / writers / approvers / review
+func (h *teamMemoryHandler) SetPolicy(c *gin.Context) {
+	var p teammem.Policy
+	if err := c.ShouldBindJSON(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.store.SetPolicy(p); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+// Tree GET /api/team-memory/tree
+func (h *teamMemoryHandler) Tree(c *gin.Context) {
+	nodes, err := h.tree().ListTree()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, nodes)
+}
+
+// ReadFile GET /api/team-memory/file?path=
+func (h *teamMemoryHandler) ReadFile(c *gin.Context) {
+	rel, ok := teamFilePath(c)
+	if !ok {
+		return
+	}
+	content, err := h.tree().GetFile(rel)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"path": rel, "content": content, "size": len(content)})
+}
+
+// WriteFile PUT /api/team-memory/file?path= — human edits apply directly
+func (h *teamMemoryHandler) WriteFile(c *gin.Context) {
+	rel, ok := teamFilePath(c)
+	if !ok {
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 5*1024*1024))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.tree().WriteFile(rel, string(body)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "path": rel, "size": len(body)})
+}
+
+// DeleteFile DELETE /api/team-memory/file?path=
+func (h *teamMemoryHandler) DeleteFile(c *gin.Context) {
+	rel, ok := teamFilePath(c)
+	if !ok {
+		return
+	}
+	if err := h.store.Delete(rel, memory.Author{Source: memory.SourceUser}); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, os.ErrNotExist) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// Search GET /api/team-memory/search?q=&limit=
+func (h *teamMemoryHandler) Search(c *gin.Context) {
+	q := c.Query("q")
+	if q == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q required"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	hits, err := h.store.Search(c.Request.Context(), q, min(max(limit, 1), 50))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, hits)
+}
+
+// Proposals GET /api/team-memory/proposals?status= — newest first
+func (h *teamMemoryHandler) Proposals(c *gin.Context) {
+	list, err := h.store.Proposals(c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// Approve POST /api/team-memory/proposals/:pid/approve {note}
+func (h *teamMemoryHandler) Approve(c *gin.Context) { h.review(c, true) }
+
+// Reject POST /api/team-memory/proposals/:pid/reject {note}
+func (h *teamMemoryHandler) Reject(c *gin.Context) { h.review(c, false) }
+
+func (h *teamMemoryHandler) review(c *gin.Context, approve bool) {
+	var req struct {
+		Note string `json:"note"`
+	}
+	_ = c.ShouldBindJSON(&req)
+	p, err := h.store.Review(c.Param("pid"), "user", approve, req.Note)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, teammem.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
@@ -2,10 +2,14 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/config"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/tools"
 )
 
 type toolHandler struct {
@@ -76,6 +80,12 @@ func (h *toolHandler) Update(c *gin.Context) {
 			if patch.BaseURL != "" {
 				t.BaseURL = patch.BaseURL
 			}
+			if patch.Config != nil {
+				t.Config = patch.Config
+			}
+			if patch.HTTP != nil {
+				t.HTTP = patch.HTTP
+			}
 			t.Enabled = patch.Enabled
 			if patch.Status != "" {
 				t.Status = patch.Status
@@ -105,17 +115,85 @@ func (h *toolHandler) Delete(c *gin.Context) {
 }
 
 // Test POST /api/tools/:id/test
+// For "custom" HTTP tools the optional body {"input": {...}, "execute": bool}
+// dry-runs the tool: the rendered request is returned with secrets masked, and
+// only when execute=true is it actually sent.
 func (h *toolHandler) Test(c *gin.Context) {
 	id := c.Param("id")
-	for i := range h.cfg.Tools {
-		if h.cfg.Tools[i].ID == id {
-			h.cfg.Tools[i].Status = "ok"
+	t := h.cfg.FindTool(id)
+	if t == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "tool not found"})
+		return
+	}
+	if tools.IsSearchToolType(t.Type) {
+		h.testSearch(c, t)
+		return
+	}
+	if t.Type != "custom" {
+		t.Status = "ok"
+		h.save(c)
+		c.JSON(http.StatusOK, gin.H{"valid": true})
+		return
+	}
+
+	var req struct {
+		Input   json.RawMessage `json:"input"`
+		Execute bool            `json:"execute"`
+	}
+	_ = c.ShouldBindJSON(&req)
+
+	preview, err := tools.RenderHTTPTool(*t, req.Input, nil, true)
+	if err != nil {
+		t.Status = "error"
+		h.save(c)
+		c.JSON(http.StatusOK, gin.H{"valid": false, "error": err.Error()})
+		return
+	}
+	resp := gin.H{"valid": true, "tool": tools.HTTPToolDef(*t), "request": preview}
+	if req.Execute {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
+		defer cancel()
+		result, err := tools.ExecuteHTTPTool(ctx, *t, req.Input, nil)
+		if err != nil {
+			t.Status = "error"
 			h.save(c)
-			c.JSON(http.StatusOK, gin.H{"valid": true})
+			resp["valid"] = false
+			resp["error"] = err.Error()
+			c.JSON(http.StatusOK, resp)
 			return
 		}
+		resp["result"] = result
 	}
-	c.JSON(http.StatusNotFound, gin.H{"error": "tool not found"})
+	t.Status = "ok"
+	h.save(c)
+	c.JSON(http.StatusOK, resp)
+}
+
+// testSearch runs a real query (body {"query": "..."}, default "test") against a
+// web search provider entry and returns the normalised results.
+func (h *toolHandler) testSearch(c *gin.Context, t *config.ToolEntry) {
+	var req struct {
+		Query string `json:"query"`
+	}
+	_ = c.ShouldBindJSON(&req)
+	if req.Query == "" {
+		req.Query = "test"
+	}
+	provider, err := tools.NewSearchProvider(*t)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+		var results []tools.SearchResult
+		if results, err = provider.Search(ctx, req.Query, tools.SearchOptions{Count: 3}); err == nil {
+			t.Status = "ok"
+			h.save(c)
+			c.JSON(http.StatusOK, gin.H{"valid": true, "results": results})
+			return
+		}
+	}
+	t.Status = "error"
+	h.save(c)
+	c.JSON(http.StatusOK, gin.H{"valid": false, "error": err.Error()})
 }
 
 func (h *toolHandler) save(c *gin.Context) {
@@ -0,0 +1,443 @@
+// WebSocket API — GET /ws
+//
+// One connection carries chat, control messages and live system events, so
+// dashboards no longer poll /api/stats or /api/tasks. Authenticate with the
+// API token as ?token= (browsers cannot set headers on the handshake) or an
+// Authorization: Bearer header.
+//
+// Client → server (JSON text frames; "id" is echoed in the reply):
+//
+//	{"id":"1","type":"subscribe","channels":["stats","subagents","session:ses-1"],"after":0}
+//	{"id":"2","type":"unsubscribe","channels":["stats"]}
+//	{"id":"3","type":"chat","agentId":"main","sessionId":"","message":"hi"}
+//	{"id":"4","type":"cancel","sessionId":"ses-1"}
+//	{"id":"5","type":"approve","agentId":"main","channelId":"tg-1","userId":42,"allow":true}
+//	{"type":"ping"}
+//
+// Server → client:
+//
+//	{"type":"ack","id":"3","data":{"sessionId":"ses-1"}}
+//	{"type":"error","id":"3","error":"..."}
+//	{"type":"event","channel":"session:ses-1","event":"text_delta","eventId":7,"data":{...}}
+//	{"type":"event","channel":"subagents","event":"running","data":{...},"time":1700000000000}
+//	{"type":"pong"}
+//
+// Channels: agents, subagents, cron, pending and sessions (system events;
+// agents, subagents and cron start with a "snapshot" event), stats (the
+// /api/stats payload, pushed when it may have changed) and session:<id>
+// (chat events with the same IDs as the SSE stream; "after" resumes like
+// Last-Event-ID). A "chat" message subscribes the connection to its session.
+// Chat accepts the same fields as POST /api/agents/:id/chat.
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/cron"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/eventbus"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/session"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/subagent"
+	"golang.org/x/net/websocket"
+)
+
+const wsSessionPrefix = "session:"
+
+// wsChannels are the system channels a client may subscribe to.
+var wsChannels = map[string]bool{
+	eventbus.Agents:     true,
+	eventbus.Subagents:  true,
+	eventbus.Cron:       true,
+	eventbus.Pending:    true,
+	eventbus.Sessions:   true,
+	eventbus.TeamMemory: true,
+	"stats":             true,
+}
+
+var wsCounter atomic.Uint64
+
+type wsHandler struct {
+	token       string
+	chat        *chatHandler
+	channels    *agentChannelHandler
+	stats       *statsHandler
+	bus         *eventbus.Bus
+	subagentMgr *subagent.Manager // may be nil
+	cronEngine  *cron.Engine
+	workerPool  *session.WorkerPool
+}
+
+// wsMessage is a server → client frame.
+type wsMessage struct {
+	Type    string `json:"type"` // "ack" | "error" | "event" | "pong"
+	ID      string `json:"id,omitempty"`
+	Channel string `json:"channel,omitempty"`
+	Event   string `json:"event,omitempty"`
+	EventID uint64 `json:"eventId,omitempty"`
+	Data    any    `json:"data,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Time    int64  `json:"time,omitempty"`
+}
+
+// wsRequest is a client → server frame (chat fields are decoded separately).
+type wsRequest struct {
+	ID        string   `json:"id"`
+	Type      string   `json:"type"`
+	Channels  []string `json:"channels"`
+	After     uint64   `json:"after"`
+	AgentID   string   `json:"agentId"`
+	SessionID string   `json:"sessionId"`
+	ChannelID string   `json:"channelId"`
+	UserID    int64    `json:"userId"`
+	Allow     bool     `json:"allow"`
+}
+
+// Serve GET /ws
+func (h *wsHandler) Serve(c *gin.Context) {
+	if h.token != "" && c.Query("token") != h.token && c.GetHeader("Authorization") != "Bearer "+h.token {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	srv := websocket.Server{
+		// The token check above replaces the Origin check: the UI may be
+		// served from a different origin than the API.
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			conn := &wsConn{
+				h:        h,
+				ws:       ws,
+				out:      make(chan wsMessage, 256),
+				done:     make(chan struct{}),
+				channels: map[string]bool{},
+				sessions: map[string]*wsSessionSub{},
+			}
+			conn.run()
+		},
+	}
+	srv.ServeHTTP(c.Writer, c.Request)
+}
+
+// wsConn is one client connection.
+type wsConn struct {
+	h    *wsHandler
+	ws   *websocket.Conn
+	out  chan wsMessage
+	done chan struct{}
+
+	mu         sync.Mutex
+	channels   map[string]bool          // subscribed system channels
+	sessions   map[string]*wsSessionSub // subscribed sessions by ID
+	statsTimer *time.Timer
+}
+
+// wsSessionSub follows a session across worker restarts.
+type wsSessionSub struct {
+	bc     *session.Broadcaster // broadcaster currently attached (nil = none)
+	lastID uint64               // last event ID sent to the client
+	unsub  func()
+	stop   chan struct{}
+}
+
+func (c *wsConn) run() {
+	defer c.close()
+	go c.writeLoop()
+	if c.h.bus != nil {
+		events, unsub := c.h.bus.Subscribe(256)
+		defer unsub()
+		go c.relay(events)
+	}
+	for {
+		var data []byte
+		if err := websocket.Message.Receive(c.ws, &data); err != nil {
+			return
+		}
+		c.handle(data)
+	}
+}
+
+func (c *wsConn) close() {
+	close(c.done)
+	c.ws.Close()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, sub := range c.sessions {
+		c.detach(sub)
+	}
+	if c.statsTimer != nil {
+		c.statsTimer.Stop()
+	}
+}
+
+func (c *wsConn) writeLoop() {
+	for {
+		select {
+		case msg := <-c.out:
+			if err := websocket.JSON.Send(c.ws, msg); err != nil {
+				c.ws.Close() // unblocks the read loop
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// send queues a frame; it blocks while the client is slow and gives up once
+// the connection is closed.
+func (c *wsConn) send(msg wsMessage) {
+	select {
+	case c.out <- msg:
+	case <-c.done:
+	}
+}
+
+func (c *wsConn) reply(id string, data any) {
+	c.send(wsMessage{Type: "ack", ID: id, Data: data})
+}
+
+func (c *wsConn) fail(id string, err error) {
+	c.send(wsMessage{Type: "error", ID: id, Error: err.Error()})
+}
+
+func (c *wsConn) handle(data []byte) {
+	var req wsRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		c.fail("", fmt.Errorf("invalid message: %v", err))
+		return
+	}
+	switch req.Type {
+	case "ping":
+		c.send(wsMessage{Type: "pong", ID: req.ID})
+	case "subscribe":
+		if err := c.subscribe(req.Channels, req.After); err != nil {
+			c.fail(req.ID, err)
+			return
+		}
+		c.reply(req.ID, gin.H{"channels": req.Channels})
+	case "unsubscribe":
+		c.unsubscribe(req.Channels)
+		c.reply(req.ID, gin.H{"channels": req.Channels})
+	case "chat":
+		c.handleChat(req.ID, data)
+	case "cancel":
+		w := c.h.workerPool.Get(req.SessionID)
+		if w == nil || !w.Cancel() {
+			c.fail(req.ID, fmt.Errorf("no generation in progress"))
+			return
+		}
+		c.reply(req.ID, gin.H{"sessionId": req.SessionID})
+	case "approve":
+		if req.Allow {
+			allowedFrom, _, err := c.h.channels.allowPending(req.AgentID, req.ChannelID, req.UserID)
+			if err != nil {
+				c.fail(req.ID, err)
+				return
+			}
+			c.reply(req.ID, gin.H{"allowedFrom": allowedFrom})
+			return
+		}
+		if err := c.h.channels.dismissPending(req.AgentID, req.ChannelID, req.UserID); err != nil {
+			c.fail(req.ID, err)
+			return
+		}
+		c.reply(req.ID, gin.H{"ok": true})
+	default:
+		c.fail(req.ID, fmt.Errorf("unknown message type %q", req.Type))
+	}
+}
+
+func (c *wsConn) handleChat(id string, data []byte) {
+	var body struct {
+		AgentID string `json:"agentId"`
+		chatRequest
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		c.fail(id, err)
+		return
+	}
+	if body.Message == "" {
+		c.fail(id, fmt.Errorf("message required"))
+		return
+	}
+	ag, ok := c.h.chat.manager.Get(body.AgentID)
+	if !ok {
+		c.fail(id, fmt.Errorf("agent not found"))
+		return
+	}
+	_, sessionID, _, err := c.h.chat.enqueue(ag, &body.chatRequest)
+	if err != nil {
+		c.fail(id, err)
+		return
+	}
+	c.subscribeSession(sessionID, 0)
+	c.reply(id, gin.H{"sessionId": sessionID})
+}
+
+func (c *wsConn) subscribe(channels []string, after uint64) error {
+	for _, ch := range channels {
+		if !strings.HasPrefix(ch, wsSessionPrefix) && !wsChannels[ch] {
+			return fmt.Errorf("unknown channel %q", ch)
+		}
+	}
+	for _, ch := range channels {
+		if sid, ok := strings.CutPrefix(ch, wsSessionPrefix); ok {
+			c.subscribeSession(sid, after)
+			continue
+		}
+		c.mu.Lock()
+		c.channels[ch] = true
+		c.mu.Unlock()
+		c.snapshot(ch)
+	}
+	return nil
+}
+
+func (c *wsConn) unsubscribe(channels []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, ch := range channels {
+		if sid, ok := strings.CutPrefix(ch, wsSessionPrefix); ok {
+			if sub := c.sessions[sid]; sub != nil {
+				c.detach(sub)
+				delete(c.sessions, sid)
+			}
+			continue
+		}
+		delete(c.channels, ch)
+	}
+}
+
+// snapshot sends the current state of a channel right after subscribing.
+func (c *wsConn) snapshot(channel string) {
+	var data any
+	switch channel {
+	case eventbus.Agents:
+		agents := c.h.chat.manager.List()
+		list := make([]AgentInfo, 0, len(agents))
+		for _, a := range agents {
+			list = append(list, agentToInfo(a))
+		}
+		data = list
+	case eventbus.Subagents:
+		if c.h.subagentMgr == nil {
+			return
+		}
+		data = c.h.subagentMgr.List("")
+	case eventbus.Cron:
+		data = c.h.cronEngine.ListJobs()
+	case "stats":
+		c.send(wsMessage{Type: "event", Channel: "stats", Event: "update", Data: c.h.stats.compute()})
+		return
+	default:
+		return
+	}
+	c.send(wsMessage{Type: "event", Channel: channel, Event: "snapshot", Data: data})
+}
+
+// relay forwards bus events to the client and keeps session subscriptions
+// attached to the live worker.
+func (c *wsConn) relay(events <-chan eventbus.Event) {
+	for ev := range events {
+		if ev.Channel == eventbus.Sessions && ev.Type == "run_started" {
+			c.mu.Lock()
+			for sid, sub := range c.sessions {
+				c.attach(sid, sub)
+			}
+			c.mu.Unlock()
+		}
+		c.mu.Lock()
+		on, stats := c.channels[ev.Channel], c.channels["stats"]
+		c.mu.Unlock()
+		if on {
+			c.send(wsMessage{Type: "event", Channel: ev.Channel, Event: ev.Type, Data: ev.Data, Time: ev.Time})
+		}
+		if stats && (ev.Channel == eventbus.Agents || ev.Channel == eventbus.Sessions && ev.Type == "run_finished") {
+			c.scheduleStats()
+		}
+	}
+}
+
+// scheduleStats pushes fresh stats at most once per second.
+func (c *wsConn) scheduleStats() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.statsTimer != nil {
+		return
+	}
+	c.statsTimer = time.AfterFunc(time.Second, func() {
+		c.mu.Lock()
+		c.statsTimer = nil
+		c.mu.Unlock()
+		c.snapshot("stats")
+	})
+}
+
+// subscribeSession starts following a session. Without a live worker the
+// persisted events after `after` are replayed; the connection attaches to
+// the worker as soon as a generation starts.
+func (c *wsConn) subscribeSession(sid string, after uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sub := c.sessions[sid]
+	if sub == nil {
+		sub = &wsSessionSub{lastID: after}
+		c.sessions[sid] = sub
+		if c.h.workerPool.Get(sid) == nil {
+			for _, ev := range c.h.workerPool.Replay(sid, after) {
+				c.sendSessionEvent(sid, ev)
+				sub.lastID = ev.ID
+			}
+		}
+	}
+	c.attach(sid, sub)
+}
+
+// attach subscribes sub to the session's current broadcaster, resuming after
+// the last event sent. Must be called with c.mu held.
+func (c *wsConn) attach(sid string, sub *wsSessionSub) {
+	w := c.h.workerPool.Get(sid)
+	if w == nil || w.Broadcaster == sub.bc {
+		return
+	}
+	c.detach(sub)
+	ch, unsub := w.Broadcaster.Subscribe(fmt.Sprintf("ws-%d", wsCounter.Add(1)), sub.lastID)
+	sub.bc, sub.unsub, sub.stop = w.Broadcaster, unsub, make(chan struct{})
+	go c.pipeSession(sid, sub, ch, sub.stop)
+}
+
+// detach stops forwarding a session's events. Must be called with c.mu held.
+func (c *wsConn) detach(sub *wsSessionSub) {
+	if sub.unsub != nil {
+		sub.unsub()
+		close(sub.stop)
+		sub.bc, sub.unsub, sub.stop = nil, nil, nil
+	}
+}
+
+func (c *wsConn) pipeSession(sid string, sub *wsSessionSub, ch <-chan session.BroadcastEvent, stop <-chan struct{}) {
+	for {
+		select {
+		case ev := <-ch:
+			c.mu.Lock()
+			if ev.ID > sub.lastID {
+				sub.lastID = ev.ID
+			}
+			c.mu.Unlock()
+			c.sendSessionEvent(sid, ev)
+		case <-stop:
+			return
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *wsConn) sendSessionEvent(sid string, ev session.BroadcastEvent) {
+	c.send(wsMessage{Type: "event", Channel: wsSessionPrefix + sid, Event: ev.Type, EventID: ev.ID, Data: ev.Data})
+}
@@ -14,9 +14,11 @@ func ReadIdentity(workspaceDir string) (string, error) {
 	return readMD(workspaceDir, "IDENTITY.md")
 }
 
-// WriteIdentity writes IDENTITY.md to the agent's workspace.
+// WriteIdentity writes IDENTITY.md to the agent's workspace, keeping a version.
 func WriteIdentity(workspaceDir, content string) error {
-	return writeMD(workspaceDir, "IDENTITY.md", content)
+	return memory.Track(workspaceDir, "IDENTITY.md", memory.Author{Source: memory.SourceUser}, func() error {
+		return writeMD(workspaceDir, "IDENTITY.md", content)
+	})
 }
 
 // ReadSoul reads SOUL.md from the agent's workspace.
@@ -24,9 +26,11 @@ func ReadSoul(workspaceDir string) (string, error) {
 	return readMD(workspaceDir, "SOUL.md")
 }
 
-// WriteSoul writes SOUL.md to the agent's workspace.
+// WriteSoul writes SOUL.md to the agent's workspace, keeping a version.
 func WriteSoul(workspaceDir, content string) error {
-	return writeMD(workspaceDir, "SOUL.md", content)
+	return memory.Track(workspaceDir, "SOUL.md", memory.Author{Source: memory.SourceUser}, func() error {
+		return writeMD(workspaceDir, "SOUL.md", content)
+	})
 }
 
 // ReadMemory reads MEMORY.md from the agent's workspace (legacy, for backward compat).
@@ -4,7 +4,7 @@
 // Each agent has:
 //   - config.json  — basic metadata (id, name, model)
 //   - workspace/   — IDENTITY.md, SOUL.md, MEMORY.md, memory/
-//   - sessions/    — sessions.json index + *.jsonl session files
+//   - sessions/    — sessions.json index + *.jsonl session files (or sessions.db)
 package agent
 
 import (
@@ -26,35 +26,41 @@ const SystemConfigAgentID = "__config__"
 
 // Agent represents a single AI agent (employee) managed by the panel.
 type Agent struct {
-	ID           string                `json:"id"`
-	Name         string                `json:"name"`
-	Description  string                `json:"description,omitempty"`
-	Model        string                `json:"model"`          // legacy: "provider/model"
-	ModelID      string                `json:"modelId"`         // references Config.Models[].ID
-	Channels     []config.ChannelEntry `json:"channels,omitempty"`   // per-agent channels (own bots)
-	ToolIDs      []string              `json:"toolIds,omitempty"`
-	SkillIDs     []string              `json:"skillIds,omitempty"`
-	AvatarColor  string                `json:"avatarColor,omitempty"`
-	System       bool                  `json:"system,omitempty"` // built-in, cannot be deleted
-	Env          map[string]string     `json:"env,omitempty"`   // per-agent environment variables for exec tool
-	WorkspaceDir string                `json:"workspaceDir"`
-	SessionDir   string                `json:"sessionDir"`
-	Status       string                `json:"status"` // "running" | "stopped" | "idle"
+	ID           string                   `json:"id"`
+	Name         string                   `json:"name"`
+	Description  string                   `json:"description,omitempty"`
+	Model        string                   `json:"model"`              // legacy: "provider/model"
+	ModelID      string                   `json:"modelId"`            // references Config.Models[].ID
+	Channels     []config.ChannelEntry    `json:"channels,omitempty"` // per-agent channels (own bots)
+	ToolIDs      []string                 `json:"toolIds,omitempty"`
+	SkillIDs     []string                 `json:"skillIds,omitempty"`
+	AvatarColor  string                   `json:"avatarColor,omitempty"`
+	System       bool                     `json:"system,omitempty"`     // built-in, cannot be deleted
+	Env          map[string]string        `json:"env,omitempty"`        // per-agent environment variables for exec tool
+	WebFetch     *config.WebFetchConfig   `json:"webFetch,omitempty"`   // per-agent web_fetch policy (domain allowlist etc.)
+	Retention    *config.RetentionPolicy  `json:"retention,omitempty"`  // per-agent session retention override
+	Compaction   *config.CompactionPolicy `json:"compaction,omitempty"` // per-agent context compaction override
+	WorkspaceDir string                   `json:"workspaceDir"`
+	SessionDir   string                   `json:"sessionDir"`
+	Status       string                   `json:"status"` // "running" | "stopped" | "idle"
 }
 
 // agentConfig is the on-disk config.json format for each agent.
 type agentConfig struct {
-	ID          string                `json:"id"`
-	Name        string                `json:"name"`
-	Description string                `json:"description,omitempty"`
-	Model       string                `json:"model,omitempty"`   // legacy compat
-	ModelID     string                `json:"modelId,omitempty"`
-	Channels    []config.ChannelEntry `json:"channels,omitempty"`   // per-agent channels
-	ToolIDs     []string              `json:"toolIds,omitempty"`
-	SkillIDs    []string              `json:"skillIds,omitempty"`
-	AvatarColor string                `json:"avatarColor,omitempty"`
-	System      bool                  `json:"system,omitempty"`
-	Env         map[string]string     `json:"env,omitempty"` // per-agent env vars for exec
+	ID          string                   `json:"id"`
+	Name        string                   `json:"name"`
+	Description string                   `json:"description,omitempty"`
+	Model       string                   `json:"model,omitempty"` // legacy compat
+	ModelID     string                   `json:"modelId,omitempty"`
+	Channels    []config.ChannelEntry    `json:"channels,omitempty"` // per-agent channels
+	ToolIDs     []string                 `json:"toolIds,omitempty"`
+	SkillIDs    []string                 `json:"skillIds,omitempty"`
+	AvatarColor string                   `json:"avatarColor,omitempty"`
+	System      bool                     `json:"system,omitempty"`
+	Env         map[string]string        `json:"env,omitempty"` // per-agent env vars for exec
+	WebFetch    *config.WebFetchConfig   `json:"webFetch,omitempty"`
+	Retention   *config.RetentionPolicy  `json:"retention,omitempty"`
+	Compaction  *config.CompactionPolicy `json:"compaction,omitempty"`
 }
 
 // Manager manages all agents under a root directory.
@@ -63,11 +69,12 @@ type agentConfig struct {
 //	{rootDir}/{agentID}/
 //	    config.json
 //	    workspace/   (IDENTITY.md, SOUL.md, MEMORY.md, memory/)
-//	    sessions/    (sessions.json + *.jsonl)
+//	    sessions/    (sessions.json + *.jsonl, or sessions.db)
 type Manager struct {
-	rootDir string
-	agents  map[string]*Agent
-	mu      sync.RWMutex
+	rootDir  string
+	agents   map[string]*Agent
+	mu       sync.RWMutex
+	onChange func(agentID, change string) // optional; see SetOnChange
 }
 
 // NewManager creates a new Manager rooted at the given directory.
@@ -78,6 +85,19 @@ func NewManager(rootDir string) *Manager {
 	}
 }
 
+// SetOnChange registers a callback for agent changes: "created", "updated",
+// "removed", "channels" and "channel_status". It runs with the manager lock
+// held and must not call back into the Manager.
+func (m *Manager) SetOnChange(fn func(agentID, change string)) {
+	m.onChange = fn
+}
+
+func (m *Manager) changed(agentID, change string) {
+	if m.onChange != nil {
+		m.onChange(agentID, change)
+	}
+}
+
 // LoadAll scans rootDir for agent subdirectories and loads each agent's config.json.
 // This should be called once at startup.
 func (m *Manager) LoadAll() error {
@@ -124,6 +144,9 @@ func (m *Manager) LoadAll() error {
 			AvatarColor:  cfg.AvatarColor,
 			System:       cfg.System,
 			Env:          cfg.Env,
+			WebFetch:     cfg.WebFetch,
+			Retention:    cfg.Retention,
+			Compaction:   cfg.Compaction,
 			WorkspaceDir: wsDir,
 			SessionDir:   filepath.Join(agentDir, "sessions"),
 			Status:       "idle",
@@ -253,6 +276,7 @@ func (m *Manager) CreateWithOpts(opts CreateOpts) (*Agent, error) {
 		Status:       "idle",
 	}
 	m.agents[opts.ID] = a
+	m.changed(opts.ID, "created")
 
 	return a, nil
 }
@@ -280,6 +304,7 @@ func (m *Manager) Remove(id string) error {
 	}
 
 	delete(m.agents, id)
+	m.changed(id, "removed")
 	return nil
 }
 
@@ -287,14 +312,17 @@ func (m *Manager) Remove(id string) error {
 // Pointer fields: nil means "leave unchanged"; non-nil means "apply this value".
 // Slice fields: nil means "leave unchanged"; non-nil (even empty) means "replace".
 type UpdateOpts struct {
-	Name        *string           `json:"name,omitempty"`
-	Description *string           `json:"description,omitempty"`
-	ModelID     *string           `json:"modelId,omitempty"`
-	Model       *string           `json:"model,omitempty"`
-	AvatarColor *string           `json:"avatarColor,omitempty"`
-	ToolIDs     []string          `json:"toolIds"`
-	SkillIDs    []string          `json:"skillIds"`
-	Env         map[string]string `json:"env"` // nil = leave unchanged; non-nil (even empty) = replace
+	Name        *string                  `json:"name,omitempty"`
+	Description *string                  `json:"description,omitempty"`
+	ModelID     *string                  `json:"modelId,omitempty"`
+	Model       *string                  `json:"model,omitempty"`
+	AvatarColor *string                  `json:"avatarColor,omitempty"`
+	ToolIDs     []string                 `json:"toolIds"`
+	SkillIDs    []string                 `json:"skillIds"`
+	Env         map[string]string        `json:"env"` // nil = leave unchanged; non-nil (even empty) = replace
+	WebFetch    *config.WebFetchConfig   `json:"webFetch,omitempty"`
+	Retention   *config.RetentionPolicy  `json:"retention,omitempty"`
+	Compaction  *config.CompactionPolicy `json:"compaction,omitempty"`
 }
 
 // UpdateAgent patches an agent's config fields and persists to disk.
@@ -351,6 +379,19 @@ func (m *Manager) UpdateAgent(agentID string, opts UpdateOpts) error {
 		cfg.Env = opts.Env
 		ag.Env = opts.Env
 	}
+	if opts.WebFetch != nil {
+		cfg.WebFetch = opts.WebFetch
+		ag.WebFetch = opts.WebFetch
+	}
+	if opts.Retention != nil {
+		cfg.Retention = opts.Retention
+		ag.Retention = opts.Retention
+	}
+	if opts.Compaction != nil {
+		cfg.Compaction = opts.Compaction
+		ag.Compaction = opts.Compaction
+	}
+	m.changed(agentID, "updated")
 
 	out, err := json.MarshalIndent(cfg, "", "  ")
 	if err != nil {
@@ -394,6 +435,7 @@ func (m *Manager) UpdateChannels(agentID string, channels []config.ChannelEntry)
 	}
 
 	ag.Channels = channels
+	m.changed(agentID, "channels")
 
 	// Read existing config.json, update channels, write back
 	agentDir := filepath.Join(m.rootDir, agentID)
@@ -442,6 +484,7 @@ func (m *Manager) UpdateChannelStatus(agentID, channelID, status, botName string
 	if !changed {
 		return
 	}
+	m.changed(agentID, "channel_status")
 
 	// Persist to disk
 	cfgPath := filepath.Join(m.rootDir, agentID, "config.json")
@@ -3,7 +3,6 @@ package agent
 
 import (
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -13,25 +12,46 @@ import (
 	"sync"
 	"time"
 
+	"github.com/sunhuihui6688-star/ai-panel/pkg/audit"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/channel"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/compaction"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/config"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/contact"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/cron"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/datastore"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/eventbus"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/llm"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/memory"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/process"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/project"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/retention"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/runner"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/scheduler"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/search"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/session"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/subagent"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/teammem"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/tools"
 )
 
 // Pool manages multiple concurrent agent runners (one per agent).
 type Pool struct {
-	manager      *Manager
-	cfg          *config.Config
-	projectMgr   *project.Manager // shared project workspace (may be nil)
-	SubagentMgr  *subagent.Manager // background task manager (set after NewPool)
-	runners      map[string]*runner.Runner
-	mu           sync.Mutex
+	manager     *Manager
+	cfg         *config.Config
+	projectMgr  *project.Manager    // shared project workspace (may be nil)
+	SubagentMgr *subagent.Manager   // background task manager (set after NewPool)
+	processSup  *process.Supervisor // background process supervisor (may be nil)
+	auditLog    *audit.Logger       // tool-call audit trail (may be nil)
+	cronEngine  *cron.Engine        // scheduler for the cron_* tools (may be nil)
+	dataStore   *datastore.Manager  // per-agent kv_* / sql_query storage (may be nil)
+	contacts    *contact.Manager    // per-agent contact profiles (may be nil)
+	teamMem     *teammem.Store      // team-shared memory (may be nil)
+	searchIdx   *search.Indexer     // full-text index for search_history (may be nil)
+	janitor     *retention.Janitor  // session retention janitor (may be nil)
+	eventBus    *eventbus.Bus       // live system events for the WebSocket API (may be nil)
+	scheduler   *scheduler.Scheduler // global run concurrency limits (may be nil)
+	runners     map[string]*runner.Runner
+	mu          sync.Mutex
 }
 
 // NewPool creates a new multi-agent runner pool.
@@ -58,6 +78,123 @@ func (p *Pool) GetProjectMgr() *project.Manager {
 	return p.projectMgr
 }
 
+// SetProcessSupervisor attaches the background process supervisor (process_* tools).
+func (p *Pool) SetProcessSupervisor(sup *process.Supervisor) {
+	p.processSup = sup
+}
+
+// ProcessSupervisor returns the background process supervisor (may be nil).
+func (p *Pool) ProcessSupervisor() *process.Supervisor {
+	return p.processSup
+}
+
+// SetAuditLogger attaches the tool-call audit log used by every registry the pool builds.
+func (p *Pool) SetAuditLogger(l *audit.Logger) {
+	p.auditLog = l
+}
+
+// AuditLogger returns the tool-call audit log (may be nil).
+func (p *Pool) AuditLogger() *audit.Logger {
+	return p.auditLog
+}
+
+// SetCronEngine lets agents manage their own cron jobs via the cron_* tools.
+func (p *Pool) SetCronEngine(engine *cron.Engine) {
+	p.cronEngine = engine
+}
+
+// SetDataStore attaches the per-agent key-value / SQLite store (kv_* and sql_query tools).
+func (p *Pool) SetDataStore(mgr *datastore.Manager) {
+	p.dataStore = mgr
+}
+
+// DataStore returns the per-agent data store manager (may be nil).
+func (p *Pool) DataStore() *datastore.Manager {
+	return p.dataStore
+}
+
+// SetContacts attaches the per-agent contact profiles (contact_* tools and
+// sender context in channel runs).
+func (p *Pool) SetContacts(mgr *contact.Manager) {
+	p.contacts = mgr
+}
+
+// Contacts returns the contact store manager (may be nil).
+func (p *Pool) Contacts() *contact.Manager {
+	return p.contacts
+}
+
+// ContactContext records the inbound message against the sender carried by
+// ctx (see contact.WithSender) and returns that contact's profile for the
+// system prompt. It returns "" when there is no sender or no contact store.
+func (p *Pool) ContactContext(ctx context.Context, agentID, sessionID, message string) string {
+	sender, ok := contact.SenderFrom(ctx)
+	if !ok || p.contacts == nil {
+		return ""
+	}
+	store, err := p.contacts.Get(agentID)
+	if err != nil {
+		return ""
+	}
+	c, err := store.Touch(sender, sessionID, message)
+	if err != nil {
+		log.Printf("[contact] agent=%s sender=%s: %v", agentID, sender.Key, err)
+		return ""
+	}
+	return contact.Prompt(c, sender.Key)
+}
+
+// SetTeamMemory attaches the team-shared memory (team_memory_* tools and
+// the team INDEX.md in every system prompt).
+func (p *Pool) SetTeamMemory(s *teammem.Store) {
+	p.teamMem = s
+}
+
+// TeamMemory returns the team memory store (may be nil).
+func (p *Pool) TeamMemory() *teammem.Store {
+	return p.teamMem
+}
+
+// SetSearchIndexer attaches the global full-text index (search_history tool).
+func (p *Pool) SetSearchIndexer(in *search.Indexer) {
+	p.searchIdx = in
+}
+
+// SearchIndexer returns the full-text index (may be nil).
+func (p *Pool) SearchIndexer() *search.Indexer {
+	return p.searchIdx
+}
+
+// SetJanitor attaches the retention janitor so the API can report on it.
+func (p *Pool) SetJanitor(j *retention.Janitor) {
+	p.janitor = j
+}
+
+// Janitor returns the retention janitor (may be nil).
+func (p *Pool) Janitor() *retention.Janitor {
+	return p.janitor
+}
+
+// SetEventBus attaches the system event bus relayed by the WebSocket API.
+func (p *Pool) SetEventBus(b *eventbus.Bus) {
+	p.eventBus = b
+}
+
+// EventBus returns the system event bus (may be nil).
+func (p *Pool) EventBus() *eventbus.Bus {
+	return p.eventBus
+}
+
+// SetScheduler makes every run built by the pool wait for a scheduler slot.
+func (p *Pool) SetScheduler(s *scheduler.Scheduler) {
+	p.scheduler = s
+}
+
+// Scheduler returns the global run scheduler (may be nil).
+func (p *Pool) Scheduler() *scheduler.Scheduler {
+	return p.scheduler
+}
+
 // configureToolRegistry applies all optional middlewares to a fresh tool registry.
 // fileSender is optional; when non-nil, the send_file tool is registered.
 func (p *Pool) configureToolRegistry(reg *tools.Registry, ag *Agent, fileSender channel.FileSenderFunc) {
@@ -67,9 +204,32 @@ func (p *Pool) configureToolRegistry(reg *tools.Registry, ag *Agent, fileSender
 	if len(ag.Env) > 0 {
 		reg.WithEnv(ag.Env)
 	}
+	reg.WithToolEntries(p.cfg.Tools, ag.ToolIDs)
+	reg.WithWebFetch(config.MergeWebFetch(p.cfg.WebFetch, ag.WebFetch))
 	if p.SubagentMgr != nil {
 		reg.WithSubagentManager(p.SubagentMgr)
 	}
+	if p.processSup != nil {
+		reg.WithProcessSupervisor(p.processSup)
+	}
+	if p.auditLog != nil {
+		reg.WithAudit(p.auditLog)
+	}
+	if p.cronEngine != nil {
+		reg.WithCronEngine(p.cronEngine, p.cfg.Cron)
+	}
+	if p.dataStore != nil {
+		reg.WithDataStore(p.dataStore)
+	}
+	if p.contacts != nil {
+		reg.WithContacts(p.contacts)
+	}
+	if p.teamMem != nil {
+		reg.WithTeamMemory(p.teamMem)
+	}
+	if p.searchIdx != nil {
+		reg.WithSearch(p.searchIdx)
+	}
 	if fileSender != nil {
 		reg.WithFileSender(fileSender, p.cfg.Gateway.BaseURL(), p.cfg.Auth.Token)
 	}
@@ -81,11 +241,18 @@ func (p *Pool) configureToolRegistry(reg *tools.Registry, ag *Agent, fileSender
 }
 
 // buildProjectContext returns the shared project context string for system prompt injection.
+// The team memory section, when configured, is appended to it.
 func (p *Pool) buildProjectContext(agentID string) string {
-	if p.projectMgr == nil {
-		return ""
+	var parts []string
+	if p.projectMgr != nil {
+		if s := runner.BuildProjectContext(p.projectMgr, agentID); s != "" {
+			parts = append(parts, s)
+		}
 	}
-	return runner.BuildProjectContext(p.projectMgr, agentID)
+	if s := runner.BuildTeamMemoryContext(p.teamMem, agentID); s != "" {
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, "\n\n")
 }
 
 
@@ -113,29 +280,86 @@ func (p *Pool) resolveModel(ag *Agent) (*config.ModelEntry, error) {
 	return nil, fmt.Errorf("no model configured")
 }
 
-// ConsolidateMemory triggers memory consolidation for an agent (summarise + trim sessions).
-func (p *Pool) ConsolidateMemory(ctx context.Context, agentID string) (string, error) {
+// compactionPolicy resolves the agent's compaction policy against the
+// global one and the agent's model.
+func (p *Pool) compactionPolicy(ag *Agent, model *config.ModelEntry) *compaction.Policy {
+	policy := compaction.Resolve(p.cfg, ag.Compaction, model)
+	return &policy
+}
+
+// CompactSession compacts one session on demand (or, with dryRun, reports
+// what would be summarised, pinned and kept). pinned lists timestamps of
+// extra messages to copy into the summary verbatim.
+func (p *Pool) CompactSession(ctx context.Context, agentID, sessionID string, pinned []int64, dryRun bool) (*compaction.Result, error) {
 	ag, ok := p.manager.Get(agentID)
 	if !ok {
-		return "", fmt.Errorf("agent %q not found", agentID)
+		return nil, fmt.Errorf("agent %q not found", agentID)
 	}
 	modelEntry, err := p.resolveModel(ag)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	apiKey := modelEntry.APIKey
-	if apiKey == "" {
-		return "", fmt.Errorf("no API key for model: %s", modelEntry.ProviderModel())
+	policy := *p.compactionPolicy(ag, modelEntry)
+	store := session.NewStore(ag.SessionDir)
+	if _, ok := store.GetMeta(sessionID); !ok {
+		return nil, fmt.Errorf("session %q not found", sessionID)
+	}
+	opts := compaction.Options{Pinned: pinned, Reason: "manual"}
+	if dryRun {
+		return compaction.Plan(store, sessionID, policy, opts)
 	}
 
-	memCfg, _ := memory.ReadMemConfig(ag.WorkspaceDir)
-	convCfg := memory.ConsolidateConfig{
-		KeepTurns: memCfg.KeepTurns,
-		FocusHint: memCfg.FocusHint,
+	model, apiKey := modelEntry.ProviderModel(), modelEntry.APIKey
+	if policy.Model != "" {
+		model, apiKey = policy.Model, policy.APIKey
+	}
+	if apiKey == "" {
+		return nil, fmt.Errorf("no API key for model: %s", model)
+	}
+	llmClient := llm.NewAnthropicClient()
+	summarize := func(ctx context.Context, system, user string) (string, error) {
+		provider, _, _ := strings.Cut(model, "/")
+		ctx, release, err := p.scheduler.Acquire(ctx, scheduler.Request{
+			AgentID:  ag.ID,
+			Provider: provider,
+			APIKey:   apiKey,
+			Label:    "compaction:" + sessionID,
+		}, nil)
+		if err != nil {
+			return "", err
+		}
+		defer release()
+		userJSON, _ := json.Marshal(user)
+		ch, err := llmClient.Stream(ctx, &llm.ChatRequest{
+			Model:     model,
+			APIKey:    apiKey,
+			System:    system,
+			Messages:  []llm.ChatMessage{{Role: "user", Content: userJSON}},
+			MaxTokens: 2048,
+		})
+		if err != nil {
+			return "", err
+		}
+		var resp strings.Builder
+		for ev := range ch {
+			if ev.Type == llm.EventTextDelta {
+				resp.WriteString(ev.Text)
+			}
+			if ev.Type == llm.EventError && ev.Err != nil {
+				return resp.String(), ev.Err
+			}
+		}
+		return resp.String(), nil
 	}
+	return compaction.Compact(ctx, store, sessionID, policy, summarize, opts)
+}
 
+// memoryLLM returns a one-shot LLM call for memory maintenance, run under the
+// scheduler's memory class.
+func (p *Pool) memoryLLM(ag *Agent, modelEntry *config.ModelEntry) func(ctx context.Context, system, user string) (string, error) {
+	apiKey := modelEntry.APIKey
 	llmClient := llm.NewAnthropicClient()
-	callLLM := func(ctx context.Context, system, user string) (string, error) {
+	return func(ctx context.Context, system, user string) (string, error) {
 		userJSON, _ := json.Marshal(user)
 		req := &llm.ChatRequest{
 			Model:  modelEntry.ProviderModel(),
@@ -146,6 +370,17 @@ func (p *Pool) ConsolidateMemory(ctx context.Context, agentID string) (string, e
 			},
 			MaxTokens: 2048,
 		}
+		ctx, release, err := p.scheduler.Acquire(ctx, scheduler.Request{
+			Class:    scheduler.Memory,
+			AgentID:  ag.ID,
+			Provider: modelEntry.Provider,
+			APIKey:   apiKey,
+			Label:    "memory",
+		}, nil)
+		if err != nil {
+			return "", err
+		}
+		defer release()
 		ch, err := llmClient.Stream(ctx, req)
 		if err != nil {
 			return "", err
@@ -161,49 +396,166 @@ func (p *Pool) ConsolidateMemory(ctx context.Context, agentID string) (string, e
 		}
 		return resp.String(), nil
 	}
+}
+
+// ConsolidateMemory triggers memory consolidation for an agent (summarise new
+// messages, optionally archive + trim sessions).
+func (p *Pool) ConsolidateMemory(ctx context.Context, agentID string) (string, error) {
+	ag, ok := p.manager.Get(agentID)
+	if !ok {
+		return "", fmt.Errorf("agent %q not found", agentID)
+	}
+	modelEntry, err := p.resolveModel(ag)
+	if err != nil {
+		return "", err
+	}
+	apiKey := modelEntry.APIKey
+	if apiKey == "" {
+		return "", fmt.Errorf("no API key for model: %s", modelEntry.ProviderModel())
+	}
+
+	memCfg, _ := memory.ReadMemConfig(ag.WorkspaceDir)
+	convCfg := memory.ConsolidateConfig{
+		KeepTurns: memCfg.KeepTurns,
+		FocusHint: memCfg.FocusHint,
+		Trim:      memCfg.Trim,
+	}
+
+	callLLM := p.memoryLLM(ag, modelEntry)
 
 	store := session.NewStore(ag.SessionDir)
-	memTree := memory.NewMemoryTree(ag.WorkspaceDir)
+	memTree := memory.NewMemoryTree(ag.WorkspaceDir).As(memory.Author{Source: memory.SourceConsolidator})
 
 	nowMs := time.Now().UnixMilli()
-	loc, _ := time.LoadLocation("Asia/Shanghai")
-	today := time.Now().In(loc).Format("2006-01-02")
 
-	written, err := memory.Consolidate(ctx, store, memTree, ag.Name, convCfg, callLLM)
+	res, err := memory.Consolidate(ctx, store, memTree, ag.Name, convCfg, callLLM)
 	if err != nil {
 		log.Printf("[memory] consolidate agent=%s error: %v", agentID, err)
+		msg := err.Error()
+		if res != nil && res.Messages > 0 {
+			msg = fmt.Sprintf("已整理 %d 条消息后出错：%s", res.Messages, msg)
+		}
 		_ = memory.AppendRunLog(ag.WorkspaceDir, memory.RunLogEntry{
 			Timestamp: nowMs,
+			Kind:      "consolidate",
 			Status:    "error",
-			Message:   err.Error(),
+			Message:   msg,
 		})
 		return "", err
 	}
-	if !written {
-		log.Printf("[memory] consolidate agent=%s: no new content", agentID)
+	if res.Entries == 0 {
+		log.Printf("[memory] consolidate agent=%s: no new content (%d messages)", agentID, res.Messages)
+		msg := "无新增内容，跳过写入"
+		if res.Messages > 0 {
+			msg = fmt.Sprintf("已读取 %d 条新消息，无新增内容", res.Messages)
+		}
 		_ = memory.AppendRunLog(ag.WorkspaceDir, memory.RunLogEntry{
 			Timestamp: nowMs,
+			Kind:      "consolidate",
 			Status:    "ok",
-			Message:   "无新增内容，跳过写入",
+			Message:   msg,
 		})
 		return "✅ 无新增内容", nil
 	}
-	log.Printf("[memory] consolidate agent=%s ok → daily/%s", agentID, today)
+	log.Printf("[memory] consolidate agent=%s ok → %s (%d messages, %d entries, %d remaining)",
+		agentID, res.File, res.Messages, res.Entries, res.Remaining)
+	msg := fmt.Sprintf("已整理 %d 个会话的 %d 条新消息，写入 memory/%s（%d 条记录）",
+		res.Sessions, res.Messages, res.File, res.Entries)
+	if res.Remaining > 0 {
+		msg += fmt.Sprintf("；还有 %d 条待下次整理", res.Remaining)
+	}
+	if res.Trimmed > 0 {
+		msg += fmt.Sprintf("；已归档并裁剪 %d 个会话", res.Trimmed)
+	}
 	_ = memory.AppendRunLog(ag.WorkspaceDir, memory.RunLogEntry{
 		Timestamp: nowMs,
+		Kind:      "consolidate",
 		Status:    "ok",
-		Message:   fmt.Sprintf("已写入 memory/daily/%s.md", today),
+		Message:   msg,
 	})
 	return "✅ 记忆整理完成", nil
 }
 
+// RollupMemory runs the hierarchical rollup for an agent: weekly and monthly
+// summaries of the daily logs, promotion of recurring facts into core/ and
+// topics/, and the INDEX.md refresh.
+func (p *Pool) RollupMemory(ctx context.Context, agentID string) (string, error) {
+	ag, ok := p.manager.Get(agentID)
+	if !ok {
+		return "", fmt.Errorf("agent %q not found", agentID)
+	}
+	modelEntry, err := p.resolveModel(ag)
+	if err != nil {
+		return "", err
+	}
+	if modelEntry.APIKey == "" {
+		return "", fmt.Errorf("no API key for model: %s", modelEntry.ProviderModel())
+	}
+
+	memCfg, _ := memory.ReadMemConfig(ag.WorkspaceDir)
+	rollCfg := memory.RollupConfig{
+		IndexBudget: memCfg.IndexBudget,
+		FocusHint:   memCfg.FocusHint,
+	}
+	memTree := memory.NewMemoryTree(ag.WorkspaceDir).As(memory.Author{Source: memory.SourceConsolidator, Detail: "rollup"})
+	nowMs := time.Now().UnixMilli()
+
+	res, err := memory.Rollup(ctx, memTree, ag.Name, rollCfg, p.memoryLLM(ag, modelEntry))
+	if err != nil {
+		log.Printf("[memory] rollup agent=%s error: %v", agentID, err)
+		msg := err.Error()
+		if res != nil && len(res.Weekly)+len(res.Monthly) > 0 {
+			msg = fmt.Sprintf("已写入 %d 篇周总结、%d 篇月总结后出错：%s", len(res.Weekly), len(res.Monthly), msg)
+		}
+		_ = memory.AppendRunLog(ag.WorkspaceDir, memory.RunLogEntry{
+			Timestamp: nowMs,
+			Kind:      "rollup",
+			Status:    "error",
+			Message:   msg,
+		})
+		return "", err
+	}
+	log.Printf("[memory] rollup agent=%s ok (%d weekly, %d monthly, %d promoted, index=%v, %d remaining)",
+		agentID, len(res.Weekly), len(res.Monthly), res.Promoted, res.IndexUpdated, res.Remaining)
+	var parts []string
+	if n := len(res.Weekly); n > 0 {
+		parts = append(parts, fmt.Sprintf("写入 %d 篇周总结", n))
+	}
+	if n := len(res.Monthly); n > 0 {
+		parts = append(parts, fmt.Sprintf("写入 %d 篇月总结", n))
+	}
+	if res.Promoted > 0 {
+		parts = append(parts, fmt.Sprintf("提升 %d 条事实到 %s", res.Promoted, strings.Join(res.PromotedTo, "、")))
+	}
+	if res.IndexUpdated {
+		parts = append(parts, "已更新 INDEX.md")
+	}
+	if res.Remaining > 0 {
+		parts = append(parts, fmt.Sprintf("还有 %d 个周期待下次汇总", res.Remaining))
+	}
+	msg := "无需汇总的新周期"
+	if len(parts) > 0 {
+		msg = strings.Join(parts, "；")
+	}
+	_ = memory.AppendRunLog(ag.WorkspaceDir, memory.RunLogEntry{
+		Timestamp: nowMs,
+		Kind:      "rollup",
+		Status:    "ok",
+		Message:   msg,
+	})
+	return "✅ 记忆汇总完成", nil
+}
+
 // Run executes a message against the specified agent and returns the full
 // response text (collects all text_delta events).
 func (p *Pool) Run(ctx context.Context, agentID, message string) (string, error) {
-	// Special: memory consolidation trigger from cron
+	// Special: memory consolidation / rollup triggers from cron
 	if message == "__MEMORY_CONSOLIDATE__" {
 		return p.ConsolidateMemory(ctx, agentID)
 	}
+	if message == "__MEMORY_ROLLUP__" {
+		return p.RollupMemory(ctx, agentID)
+	}
 	ag, ok := p.manager.Get(agentID)
 	if !ok {
 		return "", fmt.Errorf("agent %q not found", agentID)
@@ -236,6 +588,9 @@ func (p *Pool) Run(ctx context.Context, agentID, message string) (string, error)
 		Session:      store,
 		ProjectContext: p.buildProjectContext(ag.ID),
 		AgentEnv:     ag.Env,
+		Scheduler:    p.scheduler,
+		Compaction:   p.compactionPolicy(ag, modelEntry),
+		MemoryRecall: p.cfg.MemorySearch.AutoInject,
 	})
 
 	// Run and collect all text
@@ -258,7 +613,7 @@ func (p *Pool) Run(ctx context.Context, agentID, message string) (string, error)
 // RunStreamEvents wraps RunStream output as channel.StreamEvent for the Telegram/web channel layer.
 // This avoids the channel package importing the runner package directly.
 // sessionID — if non-empty, history is loaded/saved under this key (enables per-chat persistent memory).
-// media is an optional list of downloaded files (images/PDFs) to pass to the LLM as base64 data URIs.
+// media is an optional list of downloaded files (images and documents), see PrepareMedia.
 // fileSender is optional; if non-nil, the agent's send_file tool is registered and can deliver files.
 func (p *Pool) RunStreamEvents(ctx context.Context, agentID, message, sessionID string, media []channel.MediaInput, fileSender channel.FileSenderFunc) (<-chan channel.StreamEvent, error) {
 	ag, ok := p.manager.Get(agentID)
@@ -280,21 +635,13 @@ func (p *Pool) RunStreamEvents(ctx context.Context, agentID, message, sessionID
 	p.configureToolRegistry(toolRegistry, ag, fileSender)
 	store := session.NewStore(ag.SessionDir)
 
-	// Convert MediaInput to base64 data URI strings for the runner.
-	// Anthropic Vision only accepts: image/jpeg, image/png, image/gif, image/webp
-	// (plus application/pdf for documents). Normalize and validate content types.
-	var images []string
-	for _, m := range media {
-		if len(m.Data) == 0 {
-			continue
-		}
-		ct := normalizeVisionContentType(m.ContentType, m.FileName)
-		if ct == "" {
-			log.Printf("[pool] skipping media %q: unsupported content type %q", m.FileName, m.ContentType)
-			continue
-		}
-		encoded := base64.StdEncoding.EncodeToString(m.Data)
-		images = append(images, "data:"+ct+";base64,"+encoded)
+	contactCtx := p.ContactContext(ctx, ag.ID, sessionID, message)
+
+	// Images become data URIs; documents are saved to the workspace and
+	// either sent as native PDF blocks or extracted into the message text.
+	images, preamble := PrepareMedia(ag.WorkspaceDir, model, media)
+	if preamble != "" {
+		message = preamble + "\n\n" + message
 	}
 
 	r := runner.New(runner.Config{
@@ -308,7 +655,11 @@ func (p *Pool) RunStreamEvents(ctx context.Context, agentID, message, sessionID
 		SessionID:      sessionID,
 		Images:         images,
 		ProjectContext: p.buildProjectContext(ag.ID),
+		ContactContext: contactCtx,
 		AgentEnv:       ag.Env,
+		Scheduler:      p.scheduler,
+		Compaction:     p.compactionPolicy(ag, modelEntry),
+		MemoryRecall:   p.cfg.MemorySearch.AutoInject,
 	})
 
 	raw := r.Run(ctx, message)
@@ -364,6 +715,9 @@ func (p *Pool) RunStream(ctx context.Context, agentID, message, sessionID string
 		SessionID:      sessionID,
 		ProjectContext: p.buildProjectContext(ag.ID),
 		AgentEnv:       ag.Env,
+		Scheduler:      p.scheduler,
+		Compaction:     p.compactionPolicy(ag, modelEntry),
+		MemoryRecall:   p.cfg.MemorySearch.AutoInject,
 	})
 
 	return r.Run(ctx, message), nil
@@ -459,6 +813,8 @@ func (p *Pool) SubagentRunFunc() subagent.RunFunc {
 			store := session.NewStore(subSessionDir)
 			toolRegistry := tools.New(ag.WorkspaceDir, filepath.Dir(ag.WorkspaceDir), ag.ID)
 			p.configureToolRegistry(toolRegistry, ag, nil)
+			ctx = audit.WithMeta(ctx, audit.Meta{Source: "subagent", SessionID: sessionID})
+			ctx = scheduler.WithClass(ctx, scheduler.Subagent)
 
 			r := runner.New(runner.Config{
 				AgentID:        ag.ID,
@@ -471,6 +827,7 @@ func (p *Pool) SubagentRunFunc() subagent.RunFunc {
 				Session:        store,
 				ProjectContext: p.buildProjectContext(ag.ID),
 				AgentEnv:       ag.Env,
+				Scheduler:      p.scheduler,
 			})
 
 			for ev := range r.Run(ctx, task) {
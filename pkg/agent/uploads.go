@@ -0,0 +1,155 @@
+package agent
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/sunhuihui6688-star/ai-panel/pkg/channel"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/document"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/llm"
+)
+
+const (
+	// uploadInlineChars is how much extracted text of one document is put
+	// straight into the message; the rest is left to read_document.
+	uploadInlineChars = 12000
+	// nativePDFMaxBytes / nativePDFMaxPages bound PDFs sent as document
+	// blocks; larger files fall back to extracted text.
+	nativePDFMaxBytes = 20 << 20
+	nativePDFMaxPages = 100
+)
+
+var uploadNameSanitizer = regexp.MustCompile(`[\\/:*?"<>|\x00-\x1f]+`)
+
+// PrepareMedia turns media received from a channel into model input.
+// Images become data URIs. Documents (PDF/DOCX/XLSX/PPTX) are saved under
+// workspace/uploads/ and either sent as native PDF blocks (when model
+// supports them) or extracted to Markdown; preamble carries that text and
+// should be prepended to the user's message.
+func PrepareMedia(workspaceDir, model string, media []channel.MediaInput) (dataURIs []string, preamble string) {
+	var notes []string
+	for _, m := range media {
+		if len(m.Data) == 0 {
+			continue
+		}
+		if format := document.DetectFormat(m.FileName, m.ContentType); format != "" {
+			uri, note := ingestDocument(workspaceDir, model, m, format)
+			if uri != "" {
+				dataURIs = append(dataURIs, uri)
+			}
+			notes = append(notes, note)
+			continue
+		}
+		ct := normalizeVisionContentType(m.ContentType, m.FileName)
+		if ct == "" || ct == document.MimePDF {
+			log.Printf("[pool] skipping media %q: unsupported content type %q", m.FileName, m.ContentType)
+			continue
+		}
+		dataURIs = append(dataURIs, "data:"+ct+";base64,"+base64.StdEncoding.EncodeToString(m.Data))
+	}
+	return dataURIs, strings.Join(notes, "\n\n")
+}
+
+// ingestDocument saves one document and returns either a PDF data URI or
+// extracted text, plus the note describing it to the model.
+func ingestDocument(workspaceDir, model string, m channel.MediaInput, format document.Format) (uri, note string) {
+	name := uploadFileName(m.FileName, format)
+	rel, err := saveUpload(workspaceDir, name, m.Data)
+	if err != nil {
+		log.Printf("[pool] save upload %q: %v", name, err)
+		rel = ""
+	}
+	where := ""
+	if rel != "" {
+		where = "，已保存到 " + rel
+	}
+
+	if format == document.FormatPDF && llm.SupportsPDF(model) && len(m.Data) <= nativePDFMaxBytes {
+		if doc, err := document.Extract(m.Data, format, document.Options{Pages: "1"}); err == nil && doc.TotalPages <= nativePDFMaxPages {
+			return "data:" + document.MimePDF + ";base64," + base64.StdEncoding.EncodeToString(m.Data),
+				fmt.Sprintf("[📎 附件: %s（PDF，%d 页，原文已随消息发送%s）]", name, doc.TotalPages, where)
+		}
+	}
+
+	doc, err := document.Extract(m.Data, format, document.Options{MaxChars: uploadInlineChars})
+	if err != nil {
+		log.Printf("[pool] extract %q: %v", name, err)
+		return "", fmt.Sprintf("[📎 附件: %s（%s%s，无法解析：%v）]", name, strings.ToUpper(string(format)), where, err)
+	}
+	if doc.Empty() {
+		return "", fmt.Sprintf("[📎 附件: %s（%s%s，未提取到文本，可能是扫描件）]", name, strings.ToUpper(string(format)), where)
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("[📎 附件: %s（%s，%d 页%s）]\n", name, strings.ToUpper(string(format)), doc.TotalPages, where))
+	sb.WriteString(fmt.Sprintf("<document name=%q>\n%s\n</document>", name, doc.Markdown()))
+	if doc.Truncated && rel != "" {
+		sb.WriteString(fmt.Sprintf("\n（文档较长，以上仅为开头部分；可用 read_document 读取 %s 的指定页）", rel))
+	}
+	return "", sb.String()
+}
+
+// MediaFromDataURI decodes a "data:<mime>;base64,..." URI sent by the web UI.
+func MediaFromDataURI(name, uri string) (channel.MediaInput, error) {
+	rest, ok := strings.CutPrefix(uri, "data:")
+	if !ok {
+		return channel.MediaInput{}, fmt.Errorf("not a data URI")
+	}
+	meta, payload, ok := strings.Cut(rest, ",")
+	if !ok || !strings.HasSuffix(meta, ";base64") {
+		return channel.MediaInput{}, fmt.Errorf("data URI must be base64 encoded")
+	}
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return channel.MediaInput{}, fmt.Errorf("decode data URI: %w", err)
+	}
+	return channel.MediaInput{Data: data, ContentType: strings.TrimSuffix(meta, ";base64"), FileName: name}, nil
+}
+
+func uploadFileName(name string, format document.Format) string {
+	name = strings.TrimSpace(uploadNameSanitizer.ReplaceAllString(filepath.Base(name), "_"))
+	if name == "" || name == "." || name == "_" {
+		name = "document"
+	}
+	if document.DetectFormat(name, "") != format {
+		name += "." + string(format)
+	}
+	return name
+}
+
+// saveUpload writes data to workspace/uploads/ without overwriting earlier
+// uploads and returns the workspace-relative path.
+func saveUpload(workspaceDir, name string, data []byte) (string, error) {
+	if workspaceDir == "" {
+		return "", fmt.Errorf("no workspace")
+	}
+	dir := filepath.Join(workspaceDir, "uploads")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	candidate := name
+	for i := 1; ; i++ {
+		f, err := os.OpenFile(filepath.Join(dir, candidate), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			candidate = fmt.Sprintf("%s-%d%s", base, i, ext)
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		_, werr := f.Write(data)
+		if cerr := f.Close(); werr == nil {
+			werr = cerr
+		}
+		if werr != nil {
+			return "", werr
+		}
+		return filepath.Join("uploads", candidate), nil
+	}
+}
@@ -0,0 +1,184 @@
+// Package audit — durable, append-only log of every tool invocation.
+// Separate from session history: entries are never rewritten or compacted.
+// Files are split per day: {dir}/tools-YYYY-MM-DD.jsonl
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry is one tool invocation.
+type Entry struct {
+	Timestamp   time.Time       `json:"ts"`
+	AgentID     string          `json:"agentId"`
+	SessionID   string          `json:"sessionId,omitempty"`
+	Channel     string          `json:"channel,omitempty"` // channel ID the run came from
+	Source      string          `json:"source,omitempty"`  // "web" | "telegram" | "public" | "cron" | "subagent" | "agent_message"
+	Tool        string          `json:"tool"`
+	Input       json.RawMessage `json:"input,omitempty"`
+	OutputBytes int             `json:"outputBytes"`
+	DurationMs  int64           `json:"durationMs"`
+	Status      string          `json:"status"` // "ok" | "error"
+	Error       string          `json:"error,omitempty"`
+	Paths       []string        `json:"paths,omitempty"` // files touched by file tools
+}
+
+// Meta describes where a run originated. It travels in the context passed
+// to tool handlers so the registry can attribute each call.
+type Meta struct {
+	Source    string
+	Channel   string
+	SessionID string
+}
+
+type metaKey struct{}
+
+// WithMeta returns a context carrying run attribution.
+func WithMeta(ctx context.Context, m Meta) context.Context {
+	return context.WithValue(ctx, metaKey{}, m)
+}
+
+// MetaFrom returns the attribution stored by WithMeta (zero value if none).
+func MetaFrom(ctx context.Context) Meta {
+	m, _ := ctx.Value(metaKey{}).(Meta)
+	return m
+}
+
+// Logger appends entries to daily JSONL files.
+type Logger struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewLogger creates a Logger writing under dir.
+func NewLogger(dir string) *Logger {
+	return &Logger{dir: dir}
+}
+
+func (l *Logger) path(day time.Time) string {
+	return filepath.Join(l.dir, "tools-"+day.UTC().Format("2006-01-02")+".jsonl")
+}
+
+// Append writes one entry. Files are opened O_APPEND and never truncated.
+func (l *Logger) Append(e Entry) error {
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := os.MkdirAll(l.dir, 0750); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path(e.Timestamp), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// Query filters the audit log. Zero-value fields match everything.
+type Query struct {
+	AgentID   string
+	SessionID string
+	Tool      string
+	Source    string
+	Status    string // "ok" | "error"
+	Since     time.Time
+	Until     time.Time
+	Limit     int // default 200
+}
+
+func (q Query) match(e *Entry) bool {
+	switch {
+	case q.AgentID != "" && e.AgentID != q.AgentID,
+		q.SessionID != "" && e.SessionID != q.SessionID,
+		q.Tool != "" && e.Tool != q.Tool,
+		q.Source != "" && e.Source != q.Source,
+		q.Status != "" && e.Status != q.Status,
+		!q.Since.IsZero() && e.Timestamp.Before(q.Since),
+		!q.Until.IsZero() && !e.Timestamp.Before(q.Until):
+		return false
+	}
+	return true
+}
+
+// Search returns matching entries, newest first, plus the total match count
+// (which may exceed the returned slice when Limit applies).
+func (l *Logger) Search(q Query) ([]Entry, int, error) {
+	if q.Limit <= 0 {
+		q.Limit = 200
+	}
+	files, err := filepath.Glob(filepath.Join(l.dir, "tools-*.jsonl"))
+	if err != nil {
+		return nil, 0, err
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(files)))
+
+	var out []Entry
+	total := 0
+	for _, f := range files {
+		day, err := time.Parse("2006-01-02", strings.TrimSuffix(strings.TrimPrefix(filepath.Base(f), "tools-"), ".jsonl"))
+		if err != nil {
+			continue
+		}
+		// Skip whole days outside the requested window.
+		if !q.Since.IsZero() && day.Add(24*time.Hour).Before(q.Since) {
+			continue
+		}
+		if !q.Until.IsZero() && day.After(q.Until) {
+			continue
+		}
+		entries, err := readFile(f)
+		if err != nil {
+			return nil, 0, err
+		}
+		for i := len(entries) - 1; i >= 0; i-- {
+			if !q.match(&entries[i]) {
+				continue
+			}
+			total++
+			if len(out) < q.Limit {
+				out = append(out, entries[i])
+			}
+		}
+	}
+	if out == nil {
+		out = []Entry{}
+	}
+	return out, total, nil
+}
+
+func readFile(p string) ([]Entry, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err == nil {
+			entries = append(entries, e)
+		}
+	}
+	return entries, scanner.Err()
+}
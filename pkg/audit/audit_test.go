@@ -0,0 +1,52 @@
+package audit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSearch(t *testing.T) {
+	l := NewLogger(t.TempDir())
+	day1 := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+	for _, e := range []Entry{
+		{Timestamp: day1, AgentID: "a1", Tool: "read", Status: "ok"},
+		{Timestamp: day1.Add(time.Minute), AgentID: "a2", Tool: "exec", Status: "error", Error: "boom"},
+		{Timestamp: day2, AgentID: "a1", Tool: "exec", Status: "ok", Source: "cron"},
+	} {
+		if err := l.Append(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	all, total, err := l.Search(Query{})
+	if err != nil || total != 3 || len(all) != 3 {
+		t.Fatalf("all: total=%d len=%d err=%v", total, len(all), err)
+	}
+	if !all[0].Timestamp.Equal(day2) {
+		t.Errorf("results should be newest first, got %v", all[0].Timestamp)
+	}
+
+	cases := []struct {
+		q    Query
+		want int
+	}{
+		{Query{AgentID: "a1"}, 2},
+		{Query{Tool: "exec"}, 2},
+		{Query{Status: "error"}, 1},
+		{Query{Source: "cron"}, 1},
+		{Query{Since: day2}, 1},
+		{Query{Until: day2}, 2},
+		{Query{AgentID: "a1", Tool: "exec", Since: day1, Until: day2.Add(time.Hour)}, 1},
+	}
+	for _, c := range cases {
+		if _, n, _ := l.Search(c.q); n != c.want {
+			t.Errorf("%+v: got %d, want %d", c.q, n, c.want)
+		}
+	}
+
+	page, total, _ := l.Search(Query{Limit: 1})
+	if len(page) != 1 || total != 3 {
+		t.Errorf("limit: len=%d total=%d", len(page), total)
+	}
+}
@@ -24,6 +24,7 @@ type PendingStore struct {
 	mu    sync.RWMutex
 	path  string
 	users map[int64]PendingUser
+	onNew func(PendingUser) // optional; called when a user is first added
 }
 
 // NewPendingStore creates a store backed by {dir}/{channelID}-pending.json.
@@ -37,17 +38,30 @@ func NewPendingStore(dir, channelID string) *PendingStore {
 	return ps
 }
 
+// SetOnNew registers a callback for users that were not pending before.
+func (ps *PendingStore) SetOnNew(fn func(PendingUser)) {
+	ps.mu.Lock()
+	ps.onNew = fn
+	ps.mu.Unlock()
+}
+
 // Add inserts or updates a pending user (idempotent).
 func (ps *PendingStore) Add(id int64, username, firstName string) {
 	ps.mu.Lock()
-	defer ps.mu.Unlock()
-	ps.users[id] = PendingUser{
+	_, existed := ps.users[id]
+	u := PendingUser{
 		ID:        id,
 		Username:  username,
 		FirstName: firstName,
 		LastSeen:  time.Now().UnixMilli(),
 	}
+	ps.users[id] = u
 	ps.save()
+	onNew := ps.onNew
+	ps.mu.Unlock()
+	if !existed && onNew != nil {
+		onNew(u)
+	}
 }
 
 // Remove deletes a user from the pending list (after approval or rejection).
@@ -22,6 +22,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/sunhuihui6688-star/ai-panel/pkg/contact"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/convlog"
 )
 
@@ -37,7 +38,7 @@ type StreamEvent struct {
 // MediaInput represents a downloaded media file to pass to the LLM.
 type MediaInput struct {
 	Data        []byte
-	ContentType string // "image/jpeg", "image/png", "image/webp", "application/pdf"
+	ContentType string // "image/jpeg", "image/png", "image/webp", "application/pdf", Office MIME types
 	FileName    string
 }
 
@@ -134,6 +135,7 @@ type TelegramUser struct {
 	ID        int64  `json:"id"`
 	Username  string `json:"username"`
 	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name,omitempty"`
 	IsBot     bool   `json:"is_bot"`
 }
 
@@ -742,6 +744,17 @@ func (b *TelegramBot) generateAndSend(ctx context.Context, msg *TelegramMessage,
 	// Per-chat session ID: gives the agent persistent memory per Telegram conversation.
 	sessionID := fmt.Sprintf("telegram-%d", chatID)
 
+	// The sender's contact profile is looked up per user, so a person keeps
+	// one profile across private chats and groups.
+	if msg.From.ID != 0 {
+		runCtx = contact.WithSender(runCtx, contact.Sender{
+			Key:         contact.TelegramKey(msg.From.ID),
+			Channel:     "telegram",
+			Username:    msg.From.Username,
+			DisplayName: strings.TrimSpace(msg.From.FirstName + " " + msg.From.LastName),
+		})
+	}
+
 	// File sender: AI can call send_file tool to deliver files to this chat.
 	fileSender := FileSenderFunc(func(filePath string) (string, error) {
 		return b.SendFileToChat(chatID, threadID, filePath)
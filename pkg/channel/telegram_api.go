@@ -314,6 +314,50 @@ func (b *TelegramBot) Notify(ctx context.Context, chatID, threadID int64, prompt
 	return nil
 }
 
+// Announce sends ready-made text (e.g. a cron job result) to a chat without
+// running the agent. Long text is split into several messages.
+func (b *TelegramBot) Announce(chatID, threadID int64, text string) error {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+	for _, chunk := range splitRunes(text, 3500) {
+		if _, err := b.sendHTML2(chatID, markdownToHTML(chunk), 0, threadID); err != nil {
+			if _, err = b.sendPlain(chatID, chunk, 0, threadID); err != nil {
+				return fmt.Errorf("announce: send error: %w", err)
+			}
+		}
+	}
+	if cl := b.getConvLog(chatID); cl != nil {
+		_ = cl.Append(convlog.Entry{
+			Timestamp:   time.Now().UTC().Format(time.RFC3339),
+			Role:        "assistant",
+			Content:     text,
+			ChannelID:   fmt.Sprintf("telegram-%d", chatID),
+			ChannelType: "telegram",
+		})
+	}
+	return nil
+}
+
+// splitRunes cuts s into pieces of at most n runes, preferring line breaks.
+func splitRunes(s string, n int) []string {
+	var out []string
+	r := []rune(s)
+	for len(r) > n {
+		cut := n
+		for i := n; i > n/2; i-- {
+			if r[i] == '\n' {
+				cut = i
+				break
+			}
+		}
+		out = append(out, string(r[:cut]))
+		r = r[cut:]
+	}
+	return append(out, string(r))
+}
+
 // TestTelegramBot calls getMe to verify a bot token. Returns the bot username on success.
 func TestTelegramBot(ctx context.Context, token string) (string, error) {
 	url := fmt.Sprintf("https://api.telegram.org/bot%s/getMe", token)
@@ -8,12 +8,14 @@ import (
 	"log"
 	"net/http"
 	"strings"
+
+	"github.com/sunhuihui6688-star/ai-panel/pkg/document"
 )
 
 // ── Media resolution ──────────────────────────────────────────────────────
 
 // resolveMedia downloads relevant media from a message, returning:
-//   - media: list of MediaInput (images/PDFs to pass to LLM)
+//   - media: list of MediaInput (images and PDF/Office documents to pass to LLM)
 //   - extraText: placeholder text for non-downloadable media
 func (b *TelegramBot) resolveMedia(ctx context.Context, msg *TelegramMessage) ([]MediaInput, string, error) {
 	var media []MediaInput
@@ -68,22 +70,26 @@ func (b *TelegramBot) resolveMedia(ctx context.Context, msg *TelegramMessage) ([
 		extras = append(extras, "[🎥 视频笔记]")
 	}
 
-	// Document
+	// Document: PDF / Office files are downloaded and handed to the agent,
+	// which saves them and extracts their text.
 	if msg.Document != nil {
 		doc := msg.Document
-		if doc.MimeType == "application/pdf" {
+		name := doc.FileName
+		if name == "" {
+			name = "文件"
+		}
+		if document.DetectFormat(doc.FileName, doc.MimeType) != "" {
 			data, ct, err := b.downloadFileByID(ctx, doc.FileID)
 			if err != nil {
-				log.Printf("[telegram] pdf download error: %v", err)
-				extras = append(extras, "[📎 文件: "+doc.FileName+"]")
+				log.Printf("[telegram] document download error: %v", err)
+				extras = append(extras, "[📎 文件: "+name+"]")
 			} else {
+				if doc.MimeType != "" {
+					ct = doc.MimeType
+				}
 				media = append(media, MediaInput{Data: data, ContentType: ct, FileName: doc.FileName})
 			}
 		} else {
-			name := doc.FileName
-			if name == "" {
-				name = "文件"
-			}
 			extras = append(extras, "[📎 文件: "+name+"]")
 		}
 	}
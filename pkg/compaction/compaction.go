@@ -1,123 +1,416 @@
 // Package compaction handles context window compression.
+//
+// Once a session's token estimate passes the policy threshold, everything
+// before the last KeepTurns user turns is summarised by an LLM and replaced
+// with a CompactionEntry; the kept turns are re-appended after it so the
+// next run only loads the summary plus recent history. Messages matching the
+// policy's preserve patterns (or pinned explicitly) are copied into the
+// summary verbatim. The same engine runs after each turn and on demand via
+// POST /api/sessions/:agentId/:sid/compact.
 // Reference: pi-coding-agent/dist/core/compaction/compaction.js
-// Triggers when context usage exceeds ~75% of model's context window.
 package compaction
 
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
-	"github.com/sunhuihui6688-star/ai-panel/pkg/llm"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/config"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/session"
 )
 
-const compactionPrompt = `Please provide a detailed summary of our conversation so far. Include: key decisions made, important information shared, tasks completed, current status, and what needs to happen next. Be comprehensive - this summary will replace the conversation history.`
+// Built-in policy defaults.
+const (
+	DefaultThreshold = 80_000
+	DefaultKeepTurns = 20
+	// windowRatio of the model's context window is the default threshold
+	// when ModelEntry.ContextWindow is set.
+	windowRatio = 0.75
+)
+
+// DefaultPrompt is the summariser system prompt.
+const DefaultPrompt = `You are a conversation summarizer.
+Produce a concise summary (max 500 words) of the conversation below that captures:
+- Key topics discussed
+- Important decisions or conclusions
+- Code, data, or technical context that would be needed for continuation
+- The user's main goals
+
+Be factual and preserve technical details. Reply with just the summary, no preamble.`
 
-// Compactor manages context window compression via LLM summarization.
-type Compactor struct {
-	llmClient llm.Client
-	apiKey    string
-	model     string
+// Policy is a compaction policy resolved for one agent and model.
+type Policy struct {
+	Threshold int      `json:"threshold"`       // tokens; 0 disables automatic compaction
+	KeepTurns int      `json:"keepTurns"`       // recent user turns kept verbatim
+	Model     string   `json:"model,omitempty"` // provider/model for summaries; empty = the run's model
+	APIKey    string   `json:"-"`
+	Prompt    string   `json:"prompt"`
+	Preserve  []string `json:"preserve,omitempty"` // regexps for pinned messages
 }
 
-// NewCompactor creates a new Compactor.
-func NewCompactor(client llm.Client, apiKey, model string) *Compactor {
-	return &Compactor{
-		llmClient: client,
-		apiKey:    apiKey,
-		model:     model,
+// Resolve merges the agent policy over the global one, field by field, and
+// fills in defaults. model is the agent's model (may be nil); its context
+// window sets the default threshold. cfg may be nil.
+func Resolve(cfg *config.Config, agent *config.CompactionPolicy, model *config.ModelEntry) Policy {
+	levels := []config.CompactionPolicy{}
+	if agent != nil {
+		levels = append(levels, *agent)
+	}
+	if cfg != nil {
+		levels = append(levels, cfg.Compaction)
+	}
+	var p Policy
+	var summaryModelID string
+	for _, l := range levels {
+		if p.Threshold == 0 {
+			p.Threshold = l.Threshold
+		}
+		if p.KeepTurns == 0 {
+			p.KeepTurns = l.KeepTurns
+		}
+		if summaryModelID == "" {
+			summaryModelID = l.SummaryModelID
+		}
+		if p.Prompt == "" {
+			p.Prompt = l.Prompt
+		}
+		p.Preserve = append(p.Preserve, l.Preserve...)
+	}
+	switch {
+	case p.Threshold < 0:
+		p.Threshold = 0
+	case p.Threshold == 0 && model != nil && model.ContextWindow > 0:
+		p.Threshold = int(float64(model.ContextWindow) * windowRatio)
+	case p.Threshold == 0:
+		p.Threshold = DefaultThreshold
 	}
+	if p.KeepTurns <= 0 {
+		p.KeepTurns = DefaultKeepTurns
+	}
+	if p.Prompt == "" {
+		p.Prompt = DefaultPrompt
+	}
+	if cfg != nil && summaryModelID != "" {
+		if m := cfg.FindModel(summaryModelID); m != nil && m.APIKey != "" {
+			p.Model, p.APIKey = m.ProviderModel(), m.APIKey
+		}
+	}
+	return p
 }
 
-// ShouldCompact returns true when the context is getting too full.
-// Reference: pi-coding-agent shouldCompact() function
-func ShouldCompact(usedTokens, maxTokens int) bool {
-	if maxTokens == 0 {
-		return false
-	}
-	return float64(usedTokens)/float64(maxTokens) > 0.75
+// ShouldCompact reports whether a session of the given size needs compacting.
+func (p Policy) ShouldCompact(tokens int) bool {
+	return p.Threshold > 0 && tokens >= p.Threshold
 }
 
-// Compact calls LLM to summarize the session history, writes a compaction
-// entry to the session, and returns trimmed message history.
-func (c *Compactor) Compact(ctx context.Context, history []llm.ChatMessage, store *session.Store, sessionID string) ([]llm.ChatMessage, error) {
-	if len(history) == 0 {
-		return history, nil
-	}
+// Summarizer calls the LLM with a system prompt and one user message.
+type Summarizer func(ctx context.Context, system, user string) (string, error)
 
-	// Build a request asking the LLM to summarize the conversation
-	summaryMessages := make([]llm.ChatMessage, 0, len(history)+1)
-	summaryMessages = append(summaryMessages, history...)
+// Options tune a single compaction.
+type Options struct {
+	Pinned []int64 // timestamps of extra messages to pin
+	Reason string  // "auto" | "manual", recorded on the entry
+}
 
-	// Add the compaction request as a user message
-	promptContent, _ := json.Marshal(compactionPrompt)
-	summaryMessages = append(summaryMessages, llm.ChatMessage{
-		Role:    "user",
-		Content: promptContent,
-	})
+// MessagePreview is a shortened message shown in dry-run results.
+type MessagePreview struct {
+	Role      string `json:"role"`
+	Text      string `json:"text"`
+	Timestamp int64  `json:"timestamp"`
+}
 
-	req := &llm.ChatRequest{
-		Model:     c.model,
-		APIKey:    c.apiKey,
-		Messages:  summaryMessages,
-		MaxTokens: 4096,
-	}
+// Result describes a compaction, or what one would do (dry run).
+type Result struct {
+	Compacted    bool             `json:"compacted"`
+	Messages     int              `json:"messages"`   // messages since the last compaction
+	Summarized   int              `json:"summarized"` // messages folded into the summary
+	Kept         int              `json:"kept"`       // recent messages carried over verbatim
+	Pinned       []MessagePreview `json:"pinned"`     // older messages copied into the summary
+	FirstKept    *MessagePreview  `json:"firstKept,omitempty"`
+	TokensBefore int              `json:"tokensBefore"`
+	TokensAfter  int              `json:"tokensAfter,omitempty"`
+	Summary      string           `json:"summary,omitempty"`
+	Policy       Policy           `json:"policy"`
 
-	events, err := c.llmClient.Stream(ctx, req)
+	prevSummary string
+	old         []entry
+	pinned      []entry
+	kept        []entry
+}
+
+// ErrBusy is returned when the session is already being compacted.
+var ErrBusy = errors.New("session is already being compacted")
+
+var inflight sync.Map // session store + ID → struct{}
+
+type entry struct {
+	msg session.MessageEntry
+	raw json.RawMessage
+}
+
+// Plan works out which messages a compaction would summarise, pin and keep
+// without calling the LLM or writing anything.
+func Plan(store session.Store, sessionID string, p Policy, opts Options) (*Result, error) {
+	raws, err := store.ReadAll(sessionID)
 	if err != nil {
-		return history, fmt.Errorf("compaction llm request: %w", err)
+		return nil, fmt.Errorf("read session: %w", err)
 	}
+	res := &Result{Policy: p, Pinned: []MessagePreview{}, TokensBefore: store.EstimateTokens(sessionID)}
 
-	// Collect the full summary text
-	var summary string
-	for ev := range events {
-		if ev.Type == llm.EventTextDelta {
-			summary += ev.Text
+	// Only messages after the latest compaction are live.
+	var live []entry
+	for _, raw := range raws {
+		var base session.BaseEntry
+		if json.Unmarshal(raw, &base) != nil {
+			continue
 		}
-		if ev.Type == llm.EventError && ev.Err != nil {
-			return history, fmt.Errorf("compaction llm error: %w", ev.Err)
+		switch base.Type {
+		case session.EntryTypeCompaction:
+			var ce session.CompactionEntry
+			if json.Unmarshal(raw, &ce) == nil {
+				res.prevSummary = ce.Summary
+				live = nil
+			}
+		case session.EntryTypeMessage:
+			var me session.MessageEntry
+			if json.Unmarshal(raw, &me) == nil && (me.Message.Role == "user" || me.Message.Role == "assistant") {
+				live = append(live, entry{msg: me, raw: raw})
+			}
 		}
 	}
+	res.Messages = len(live)
+
+	// Cut at the start of a user turn so tool_use/tool_result pairs are
+	// never split.
+	var starts []int
+	for i, e := range live {
+		if e.msg.Message.Role == "user" && !isToolResult(e.msg.Message.Content) {
+			starts = append(starts, i)
+		}
+	}
+	if len(starts) <= p.KeepTurns {
+		res.Kept = len(live)
+		return res, nil
+	}
+	boundary := starts[len(starts)-p.KeepTurns]
+	res.old, res.kept = live[:boundary], live[boundary:]
+
+	patterns := make([]*regexp.Regexp, 0, len(p.Preserve))
+	for _, expr := range p.Preserve {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid preserve pattern %q: %w", expr, err)
+		}
+		patterns = append(patterns, re)
+	}
+	explicit := make(map[int64]bool, len(opts.Pinned))
+	for _, ts := range opts.Pinned {
+		explicit[ts] = true
+	}
+	for _, e := range res.old {
+		text := messageText(e.msg.Message.Content)
+		if text == "" {
+			continue
+		}
+		pin := explicit[e.msg.Timestamp]
+		for _, re := range patterns {
+			pin = pin || re.MatchString(text)
+		}
+		if pin {
+			res.pinned = append(res.pinned, e)
+			res.Pinned = append(res.Pinned, preview(e))
+		}
+	}
+	res.Summarized = len(res.old)
+	res.Kept = len(res.kept)
+	first := preview(res.kept[0])
+	res.FirstKept = &first
+	return res, nil
+}
 
+// Compact summarises everything before the kept turns and writes a
+// CompactionEntry followed by copies of the kept messages. A plan with
+// nothing to summarise is returned unchanged.
+func Compact(ctx context.Context, store session.Store, sessionID string, p Policy, summarize Summarizer, opts Options) (*Result, error) {
+	key := fmt.Sprintf("%p/%s", store, sessionID)
+	if _, busy := inflight.LoadOrStore(key, struct{}{}); busy {
+		return nil, ErrBusy
+	}
+	defer inflight.Delete(key)
+
+	res, err := Plan(store, sessionID, p, opts)
+	if err != nil || res.Summarized == 0 {
+		return res, err
+	}
+
+	var sb strings.Builder
+	if res.prevSummary != "" {
+		sb.WriteString("Summary of the earlier conversation:\n")
+		sb.WriteString(res.prevSummary)
+		sb.WriteString("\n\n")
+	}
+	for _, e := range res.old {
+		if text := messageText(e.msg.Message.Content); text != "" {
+			sb.WriteString(roleLabel(e.msg.Message.Role))
+			sb.WriteString(": ")
+			sb.WriteString(text)
+			sb.WriteString("\n\n")
+		}
+	}
+	summary, err := summarize(ctx, p.Prompt, sb.String())
+	if err != nil {
+		return nil, fmt.Errorf("llm summarize: %w", err)
+	}
+	summary = strings.TrimSpace(summary)
 	if summary == "" {
-		return history, fmt.Errorf("compaction produced empty summary")
+		return nil, fmt.Errorf("empty summary from LLM")
+	}
+	if len(res.pinned) > 0 {
+		var pb strings.Builder
+		pb.WriteString(summary)
+		pb.WriteString("\n\n[Pinned messages]")
+		for _, e := range res.pinned {
+			pb.WriteString("\n\n")
+			pb.WriteString(roleLabel(e.msg.Message.Role))
+			pb.WriteString(": ")
+			pb.WriteString(messageText(e.msg.Message.Content))
+		}
+		summary = pb.String()
 	}
 
-	// Estimate token counts (rough: 1 token ≈ 4 chars)
-	tokensBefore := 0
-	for _, m := range history {
-		tokensBefore += len(m.Content) / 4
+	tokensAfter := len(summary)/4 + 500 // 500 overhead
+	for _, e := range res.kept {
+		tokensAfter += len(e.msg.Message.Content) / 4
+	}
+	reason := opts.Reason
+	if reason == "" {
+		reason = "auto"
+	}
+	comp := session.CompactionEntry{
+		BaseEntry:        session.BaseEntry{Type: session.EntryTypeCompaction, ID: "compact-" + uuid.New().String()[:8]},
+		Summary:          summary,
+		FirstKeptEntryID: fmt.Sprintf("ts-%d", res.kept[0].msg.Timestamp),
+		TokensBefore:     res.TokensBefore,
+		TokensAfter:      tokensAfter,
+		Timestamp:        time.Now().UnixMilli(),
+		Reason:           reason,
+		Model:            p.Model,
+		Summarized:       res.Summarized,
+		Kept:             res.Kept,
+		Pinned:           len(res.pinned),
 	}
-	tokensAfter := len(summary) / 4
+	if err := store.Append(sessionID, comp); err != nil {
+		return nil, fmt.Errorf("append compaction entry: %w", err)
+	}
+	// Re-append the kept messages (original timestamps) so ReadHistory
+	// picks them up after the marker.
+	for _, e := range res.kept {
+		me := e.msg
+		me.Carried = true
+		if err := store.Append(sessionID, me); err != nil {
+			log.Printf("[compaction] failed to re-append message: %v", err)
+		}
+	}
+	_ = store.SetTokenEstimate(sessionID, tokensAfter)
+
+	res.Compacted = true
+	res.Summary = summary
+	res.TokensAfter = tokensAfter
+	log.Printf("[compaction] session %s (%s): %d → %d tokens, %d summarized, %d kept, %d pinned",
+		sessionID, reason, res.TokensBefore, tokensAfter, res.Summarized, res.Kept, len(res.pinned))
+	return res, nil
+}
 
-	// Write compaction entry to session JSONL
-	compactionEntry := session.CompactionEntry{
-		BaseEntry: session.BaseEntry{
-			Type: session.EntryTypeCompaction,
-			ID:   "compact-" + uuid.New().String()[:8],
-		},
-		Summary:      summary,
-		TokensBefore: tokensBefore,
-		TokensAfter:  tokensAfter,
+// CompactIfNeeded compacts the session in the background when it has grown
+// past the policy threshold. Safe to call after every completed turn.
+func CompactIfNeeded(store session.Store, sessionID string, p Policy, summarize Summarizer) {
+	tokens := store.EstimateTokens(sessionID)
+	if !p.ShouldCompact(tokens) {
+		return
 	}
+	log.Printf("[compaction] session %s has ~%d tokens, triggering compaction", sessionID, tokens)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+		defer cancel()
+		if _, err := Compact(ctx, store, sessionID, p, summarize, Options{Reason: "auto"}); err != nil && !errors.Is(err, ErrBusy) {
+			log.Printf("[compaction] failed for session %s: %v", sessionID, err)
+		}
+	}()
+}
 
-	if store != nil && sessionID != "" {
-		if err := store.Append(sessionID, compactionEntry); err != nil {
-			// Log but don't fail
-			fmt.Printf("compaction: failed to write entry to session: %v\n", err)
+// History returns the session's compaction entries, oldest first.
+func History(store session.Store, sessionID string) ([]session.CompactionEntry, error) {
+	raws, err := store.ReadAll(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	out := []session.CompactionEntry{}
+	for _, raw := range raws {
+		var ce session.CompactionEntry
+		if json.Unmarshal(raw, &ce) == nil && ce.Type == session.EntryTypeCompaction {
+			out = append(out, ce)
 		}
 	}
+	return out, nil
+}
+
+func preview(e entry) MessagePreview {
+	text := messageText(e.msg.Message.Content)
+	if r := []rune(text); len(r) > 200 {
+		text = string(r[:200]) + "…"
+	}
+	return MessagePreview{Role: e.msg.Message.Role, Text: text, Timestamp: e.msg.Timestamp}
+}
 
-	// Return new trimmed history: just the compaction summary as a user message
-	summaryContent, _ := json.Marshal("[Previous conversation summary]\n\n" + summary)
-	newHistory := []llm.ChatMessage{
-		{
-			Role:    "user",
-			Content: summaryContent,
-		},
+func roleLabel(role string) string {
+	if role == "assistant" {
+		return "Assistant"
 	}
+	return "User"
+}
 
-	return newHistory, nil
+// messageText pulls plain text from raw message content.
+func messageText(content json.RawMessage) string {
+	var s string
+	if json.Unmarshal(content, &s) == nil {
+		return s
+	}
+	var blocks []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if json.Unmarshal(content, &blocks) == nil {
+		var parts []string
+		for _, b := range blocks {
+			if b.Type == "text" && b.Text != "" {
+				parts = append(parts, b.Text)
+			}
+		}
+		return strings.Join(parts, " ")
+	}
+	return string(content)
+}
+
+// isToolResult reports whether a user message carries tool results (part of
+// the previous assistant turn rather than a new one).
+func isToolResult(content json.RawMessage) bool {
+	var blocks []struct {
+		Type string `json:"type"`
+	}
+	if json.Unmarshal(content, &blocks) != nil {
+		return false
+	}
+	for _, b := range blocks {
+		if b.Type == "tool_result" {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,83 @@
+package compaction
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sunhuihui6688-star/ai-panel/pkg/config"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/session"
+)
+
+func text(s string) json.RawMessage {
+	b, _ := json.Marshal(s)
+	return b
+}
+
+func TestResolve(t *testing.T) {
+	cfg := &config.Config{
+		Models:     []config.ModelEntry{{ID: "cheap", Provider: "anthropic", Model: "claude-haiku", APIKey: "k"}},
+		Compaction: config.CompactionPolicy{KeepTurns: 5, SummaryModelID: "cheap", Preserve: []string{"^规则"}},
+	}
+	p := Resolve(cfg, &config.CompactionPolicy{KeepTurns: 2, Preserve: []string{"密码"}}, &config.ModelEntry{ContextWindow: 200_000})
+	if p.Threshold != 150_000 || p.KeepTurns != 2 || p.Model != "anthropic/claude-haiku" || len(p.Preserve) != 2 || p.Prompt != DefaultPrompt {
+		t.Fatalf("policy = %+v", p)
+	}
+	if off := Resolve(nil, &config.CompactionPolicy{Threshold: -1}, nil); off.ShouldCompact(1 << 30) {
+		t.Fatal("negative threshold should disable auto compaction")
+	}
+}
+
+func TestCompact(t *testing.T) {
+	store := session.NewJSONLStore(t.TempDir())
+	sid, _, _ := store.GetOrCreate("", "a")
+	_ = store.AppendMessage(sid, "user", text("规则：只用中文回答"))
+	_ = store.AppendMessage(sid, "assistant", text("好的"))
+	_ = store.AppendMessage(sid, "user", text("查一下天气"))
+	_ = store.AppendMessage(sid, "assistant", json.RawMessage(`[{"type":"tool_use","id":"t1","name":"weather","input":{}}]`))
+	_ = store.AppendMessage(sid, "user", json.RawMessage(`[{"type":"tool_result","tool_use_id":"t1","content":"晴"}]`))
+	_ = store.AppendMessage(sid, "assistant", text("今天晴"))
+	_ = store.AppendMessage(sid, "user", text("谢谢"))
+	_ = store.AppendMessage(sid, "assistant", text("不客气"))
+
+	p := Resolve(nil, &config.CompactionPolicy{KeepTurns: 2, Preserve: []string{"^规则"}}, nil)
+	plan, err := Plan(store, sid, p, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The boundary is the start of the second-to-last user turn, so the
+	// tool exchange stays intact.
+	if plan.Summarized != 2 || plan.Kept != 6 || len(plan.Pinned) != 1 || plan.FirstKept.Text != "查一下天气" {
+		t.Fatalf("plan = %+v", plan)
+	}
+
+	var prompt string
+	summarize := func(_ context.Context, system, user string) (string, error) {
+		prompt = user
+		return "用户定了规则", nil
+	}
+	res, err := Compact(context.Background(), store, sid, p, summarize, Options{Reason: "manual"})
+	if err != nil || !res.Compacted || !strings.Contains(res.Summary, "[Pinned messages]") {
+		t.Fatalf("compact = %+v, %v", res, err)
+	}
+	msgs, summary, _ := store.ReadHistory(sid)
+	if len(msgs) != 6 || !strings.HasPrefix(summary, "用户定了规则") || !strings.Contains(summary, "规则：只用中文回答") {
+		t.Fatalf("history after compaction: %d msgs, summary %q", len(msgs), summary)
+	}
+
+	// A second compaction folds the previous summary into the new one.
+	_ = store.AppendMessage(sid, "user", text("再见"))
+	_ = store.AppendMessage(sid, "assistant", text("再见"))
+	p.KeepTurns = 1
+	if _, err := Compact(context.Background(), store, sid, p, summarize, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(prompt, "用户定了规则") {
+		t.Fatalf("previous summary not included: %q", prompt)
+	}
+	hist, _ := History(store, sid)
+	if len(hist) != 2 || hist[0].Reason != "manual" || hist[1].Reason != "auto" || hist[1].Summarized != 6 {
+		t.Fatalf("history = %+v", hist)
+	}
+}
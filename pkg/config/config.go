@@ -11,13 +11,24 @@ import (
 // Config is the top-level configuration.
 // Models/Channels/Tools/Skills are global registries; agents reference them by ID.
 type Config struct {
-	Gateway  GatewayConfig  `json:"gateway"`
-	Agents   AgentsConfig   `json:"agents"`
-	Models   []ModelEntry   `json:"models"`   // global model registry
-	Channels []ChannelEntry `json:"channels"` // global channel registry
-	Tools    []ToolEntry    `json:"tools"`    // global capability registry
-	Skills   []SkillEntry   `json:"skills"`   // installed skills
-	Auth     AuthConfig     `json:"auth"`
+	Gateway       GatewayConfig       `json:"gateway"`
+	Agents        AgentsConfig        `json:"agents"`
+	Models        []ModelEntry        `json:"models"`   // global model registry
+	Channels      []ChannelEntry      `json:"channels"` // global channel registry
+	Tools         []ToolEntry         `json:"tools"`    // global capability registry
+	Skills        []SkillEntry        `json:"skills"`   // installed skills
+	Auth          AuthConfig          `json:"auth"`
+	WebFetch      WebFetchConfig      `json:"webFetch,omitempty"`      // web_fetch defaults (SSRF guard, user agent, cache)
+	Processes     ProcessConfig       `json:"processes,omitempty"`     // limits for agent background processes
+	Cron          CronConfig          `json:"cron,omitempty"`          // policy for agent-managed cron jobs
+	DataStore     DataStoreConfig     `json:"dataStore,omitempty"`     // quotas for the kv_* / sql_query tools
+	Sessions      SessionsConfig      `json:"sessions,omitempty"`      // session storage backend
+	Retention     RetentionConfig     `json:"retention,omitempty"`     // archiving/deletion of old sessions and logs
+	Scheduler     SchedulerConfig     `json:"scheduler,omitempty"`     // concurrency limits for LLM runs
+	Compaction    CompactionPolicy    `json:"compaction,omitempty"`    // default context compaction policy; agents may override
+	MemorySearch  MemorySearchConfig  `json:"memorySearch,omitempty"`  // memory index embedder and auto-recall
+	MemoryHistory MemoryHistoryConfig `json:"memoryHistory,omitempty"` // version retention for memory, IDENTITY.md and SOUL.md
+	SMTP          SMTPConfig          `json:"smtp,omitempty"`          // outgoing mail for cron email delivery
 }
 
 type GatewayConfig struct {
@@ -45,14 +56,15 @@ type AgentsConfig struct {
 
 // ModelEntry — one configured LLM provider/model
 type ModelEntry struct {
-	ID        string `json:"id"`
-	Name      string `json:"name"`
-	Provider  string `json:"provider"` // "anthropic" | "openai" | "deepseek" | "openrouter" | "custom"
-	Model     string `json:"model"`    // "claude-sonnet-4-6"
-	APIKey    string `json:"apiKey"`
-	BaseURL   string `json:"baseUrl,omitempty"` // API base URL; empty = provider default
-	IsDefault bool   `json:"isDefault"`
-	Status    string `json:"status"` // "ok" | "error" | "untested"
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Provider      string `json:"provider"` // "anthropic" | "openai" | "deepseek" | "openrouter" | "custom"
+	Model         string `json:"model"`    // "claude-sonnet-4-6"
+	APIKey        string `json:"apiKey"`
+	BaseURL       string `json:"baseUrl,omitempty"` // API base URL; empty = provider default
+	IsDefault     bool   `json:"isDefault"`
+	Status        string `json:"status"`                  // "ok" | "error" | "untested"
+	ContextWindow int    `json:"contextWindow,omitempty"` // tokens; sets the default compaction threshold
 }
 
 // ChannelEntry — one messaging channel
@@ -67,13 +79,192 @@ type ChannelEntry struct {
 
 // ToolEntry — one capability/tool API key
 type ToolEntry struct {
-	ID      string `json:"id"`
-	Name    string `json:"name"`
-	Type    string `json:"type"` // "brave_search" | "elevenlabs" | "custom"
-	APIKey  string `json:"apiKey"`
-	BaseURL string `json:"baseUrl,omitempty"`
-	Enabled bool   `json:"enabled"`
-	Status  string `json:"status"`
+	ID      string            `json:"id"`
+	Name    string            `json:"name"`
+	Type    string            `json:"type"` // "brave_search" | "searxng" | "json_search" | "elevenlabs" | "custom"
+	APIKey  string            `json:"apiKey"`
+	BaseURL string            `json:"baseUrl,omitempty"`
+	Config  map[string]string `json:"config,omitempty"` // provider-specific options (e.g. json_search field mapping)
+	Enabled bool              `json:"enabled"`
+	Status  string            `json:"status"`
+	HTTP    *HTTPToolSpec     `json:"http,omitempty"` // Type "custom" only: declarative HTTP tool
+}
+
+// HTTPToolSpec declares an HTTP endpoint as a tool the model can call.
+// URL, header values and Body are Go text/template strings rendered with:
+//
+//	.input   — the tool call arguments
+//	.apiKey  — ToolEntry.APIKey (the secret never appears in the tool definition)
+//	.baseUrl — ToolEntry.BaseURL
+//	.env     — the calling agent's env vars
+type HTTPToolSpec struct {
+	ToolName     string            `json:"toolName"` // name exposed to the model, e.g. "get_weather"
+	Description  string            `json:"description"`
+	InputSchema  json.RawMessage   `json:"inputSchema,omitempty"`  // JSON Schema; default {"type":"object"}
+	Method       string            `json:"method,omitempty"`       // default "GET"
+	URL          string            `json:"url"`                    // e.g. "{{.baseUrl}}/weather?q={{urlquery .input.city}}"
+	Headers      map[string]string `json:"headers,omitempty"`      // e.g. {"Authorization": "Bearer {{.apiKey}}"}
+	Body         string            `json:"body,omitempty"`         // e.g. `{"q": {{json .input.query}}}`
+	ResponsePath string            `json:"responsePath,omitempty"` // JSONPath subset, e.g. "$.data.items[*].name"
+	TimeoutSec   int               `json:"timeoutSec,omitempty"`   // default 30
+}
+
+// WebFetchConfig controls the web_fetch tool. The global value (Config.WebFetch)
+// provides defaults; an agent's own WebFetch overrides non-empty fields.
+type WebFetchConfig struct {
+	UserAgent      string   `json:"userAgent,omitempty"`
+	AllowPrivate   bool     `json:"allowPrivate,omitempty"`   // disable the SSRF guard (private/loopback/link-local targets)
+	AllowedDomains []string `json:"allowedDomains,omitempty"` // empty = any public host; "example.com" also allows subdomains
+	CacheTTLSec    int      `json:"cacheTtlSec,omitempty"`    // 0 = default (15 min); negative disables caching
+}
+
+// MergeWebFetch overlays an agent-level web_fetch policy on the global one.
+func MergeWebFetch(global WebFetchConfig, agent *WebFetchConfig) WebFetchConfig {
+	out := global
+	if agent == nil {
+		return out
+	}
+	if agent.UserAgent != "" {
+		out.UserAgent = agent.UserAgent
+	}
+	if agent.AllowPrivate {
+		out.AllowPrivate = true
+	}
+	if len(agent.AllowedDomains) > 0 {
+		out.AllowedDomains = agent.AllowedDomains
+	}
+	if agent.CacheTTLSec != 0 {
+		out.CacheTTLSec = agent.CacheTTLSec
+	}
+	return out
+}
+
+// ProcessConfig limits the background processes agents start via process_start.
+// Zero values fall back to the supervisor defaults.
+type ProcessConfig struct {
+	MaxPerAgent   int `json:"maxPerAgent,omitempty"`   // concurrent running processes per agent (default 3)
+	MaxLogKB      int `json:"maxLogKb,omitempty"`      // on-disk log cap per process (default 1024)
+	MaxRuntimeMin int `json:"maxRuntimeMin,omitempty"` // kill after N minutes (0 = unlimited)
+}
+
+// CronConfig limits the cron jobs agents manage through the cron_* tools.
+// Jobs created by operators in the UI are not counted against these limits.
+type CronConfig struct {
+	MaxJobsPerAgent int `json:"maxJobsPerAgent,omitempty"` // default 10; negative disables the cron tools
+	MinIntervalSec  int `json:"minIntervalSec,omitempty"`  // shortest allowed gap between runs (default 60)
+}
+
+// SMTPConfig is the outgoing mail server used to deliver cron job output.
+type SMTPConfig struct {
+	Host     string `json:"host,omitempty"`
+	Port     int    `json:"port,omitempty"` // default 587 (STARTTLS); 465 = implicit TLS
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	From     string `json:"from,omitempty"` // default Username
+}
+
+// DataStoreConfig bounds each agent's key-value store and SQLite scratch database.
+// Zero values fall back to the datastore defaults.
+type DataStoreConfig struct {
+	MaxKVKeys       int `json:"maxKvKeys,omitempty"`       // default 10000
+	MaxKVKB         int `json:"maxKvKb,omitempty"`         // total key+value size (default 5120)
+	MaxValueKB      int `json:"maxValueKb,omitempty"`      // single value (default 256)
+	MaxSQLiteMB     int `json:"maxSqliteMb,omitempty"`     // scratch.db size (default 100)
+	QueryTimeoutSec int `json:"queryTimeoutSec,omitempty"` // per sql_query call (default 10)
+}
+
+// SchedulerConfig limits concurrent agent runs across every entry point
+// (web chat, Telegram, subagents, cron, memory consolidation). Zero values
+// fall back to the scheduler defaults; negative values remove the limit.
+type SchedulerConfig struct {
+	MaxConcurrent int `json:"maxConcurrent,omitempty"` // all runs (default 8)
+	MaxPerAgent   int `json:"maxPerAgent,omitempty"`   // runs of one agent (default 3)
+	MaxPerKey     int `json:"maxPerKey,omitempty"`     // runs sharing one provider API key (default 4)
+	MaxQueue      int `json:"maxQueue,omitempty"`      // waiting runs before new ones are rejected (default 100)
+}
+
+// CompactionPolicy controls when and how long sessions are summarised. Zero
+// values inherit from the next level up (agent, global, model, built-in
+// default); a negative Threshold turns automatic compaction off.
+type CompactionPolicy struct {
+	Threshold      int      `json:"threshold,omitempty"`      // token estimate that triggers compaction (default 75% of the model's context window, else 80k)
+	KeepTurns      int      `json:"keepTurns,omitempty"`      // recent user turns kept verbatim (default 20)
+	SummaryModelID string   `json:"summaryModelId,omitempty"` // Config.Models[].ID used for summaries; empty = the agent's model
+	Prompt         string   `json:"prompt,omitempty"`         // summariser system prompt
+	Preserve       []string `json:"preserve,omitempty"`       // regexps; matching messages are pinned and copied into the summary verbatim
+}
+
+// MemorySearchConfig selects the embedder behind memory_search and whether
+// top hits for each user message are injected into the system prompt.
+type MemorySearchConfig struct {
+	Embedder   string `json:"embedder,omitempty"`   // "local" (default, offline hashing) | "openai" (any compatible /embeddings API) | "off" (keyword only)
+	BaseURL    string `json:"baseUrl,omitempty"`    // openai: API base (default https://api.openai.com/v1)
+	APIKey     string `json:"apiKey,omitempty"`     // openai: API key
+	Model      string `json:"model,omitempty"`      // openai: embedding model (default text-embedding-3-small)
+	AutoInject int    `json:"autoInject,omitempty"` // top hits added to the system prompt per user message; 0 = off
+}
+
+// MemoryHistoryConfig limits the versions kept per memory/identity file.
+// Zero uses the default; negative removes the limit. The latest version is
+// always kept.
+type MemoryHistoryConfig struct {
+	MaxVersions int `json:"maxVersions,omitempty"` // per file (default 50)
+	MaxAgeDays  int `json:"maxAgeDays,omitempty"`  // drop older versions (default 90)
+}
+
+// SessionsConfig selects where conversation history is stored.
+// Switching to "sqlite" needs a one-off `aipanel --migrate-sessions` to import
+// existing JSONL sessions.
+type SessionsConfig struct {
+	Backend string `json:"backend,omitempty"` // "jsonl" (default) | "sqlite"
+}
+
+// RetentionConfig drives the background janitor that archives and deletes
+// old conversation data. Nothing is removed unless Enabled is set.
+type RetentionConfig struct {
+	Enabled          bool            `json:"enabled,omitempty"`
+	IntervalMin      int             `json:"intervalMin,omitempty"`      // default 60
+	Sessions         RetentionPolicy `json:"sessions,omitempty"`         // default session policy; agents may override
+	ConvlogDays      int             `json:"convlogDays,omitempty"`      // drop conversation log lines older than N days
+	CronRunDays      int             `json:"cronRunDays,omitempty"`      // drop cron run records older than N days
+	SubagentTaskDays int             `json:"subagentTaskDays,omitempty"` // drop finished background tasks older than N days
+}
+
+// RetentionPolicy is a session retention policy for all agents (global) or
+// one agent. Zero values inherit from the next level up; a negative value
+// turns the step off at that level. 0 everywhere keeps sessions forever.
+type RetentionPolicy struct {
+	RetentionRule
+	MaxSessionsMB int                      `json:"maxSessionsMb,omitempty"` // per-agent cap on live+archived sessions
+	Channels      map[string]RetentionRule `json:"channels,omitempty"`      // by channel type: "web", "telegram", "subagent", ...
+}
+
+// RetentionRule says when inactive sessions are archived and deleted.
+type RetentionRule struct {
+	ArchiveAfterDays int `json:"archiveAfterDays,omitempty"` // gzip into sessions/archive/ after N idle days
+	DeleteAfterDays  int `json:"deleteAfterDays,omitempty"`  // delete (live or archived) after N idle days
+}
+
+// ResolveRetention returns the rule for one channel. Lookup order, per field:
+// agent channel rule, agent rule, global channel rule, global rule.
+func ResolveRetention(global RetentionPolicy, agent *RetentionPolicy, channel string) RetentionRule {
+	levels := []RetentionRule{}
+	if agent != nil {
+		levels = append(levels, agent.Channels[channel], agent.RetentionRule)
+	}
+	levels = append(levels, global.Channels[channel], global.RetentionRule)
+	var out RetentionRule
+	for _, r := range levels {
+		if out.ArchiveAfterDays == 0 {
+			out.ArchiveAfterDays = r.ArchiveAfterDays
+		}
+		if out.DeleteAfterDays == 0 {
+			out.DeleteAfterDays = r.DeleteAfterDays
+		}
+	}
+	out.ArchiveAfterDays = max(out.ArchiveAfterDays, 0)
+	out.DeleteAfterDays = max(out.DeleteAfterDays, 0)
+	return out
 }
 
 // SkillEntry — an installed skill
@@ -266,6 +457,16 @@ func (c *Config) FindModel(id string) *ModelEntry {
 	return nil
 }
 
+// FindTool returns the tool entry by ID.
+func (c *Config) FindTool(id string) *ToolEntry {
+	for i := range c.Tools {
+		if c.Tools[i].ID == id {
+			return &c.Tools[i]
+		}
+	}
+	return nil
+}
+
 // DefaultModel returns the first model marked as default, or the first model.
 func (c *Config) DefaultModel() *ModelEntry {
 	for i := range c.Models {
@@ -0,0 +1,495 @@
+// Package contact keeps per-agent profiles of the people an agent talks to
+// across channels: who they are, what they prefer, notes the agent or an
+// admin wrote about them, and a short interaction history. A contact owns
+// one or more channel identities ("telegram:<userID>", "web:<channel>:<token>"),
+// so the same person reached through Telegram and the web chat can be linked.
+//
+// Layout: <agentsDir>/<agentID>/contacts/contacts.json.
+package contact
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxInteractions = 50  // interaction history kept per contact
+	maxNotes        = 100 // notes kept per contact (oldest dropped)
+	maxPreviewRunes = 120
+	sessionGap      = 30 * time.Minute // messages closer than this in one session count as one interaction
+)
+
+// ErrNotFound is returned when a contact or identity does not exist.
+var ErrNotFound = errors.New("contact not found")
+
+// Identity is one channel account of a contact.
+type Identity struct {
+	Key         string `json:"key"`     // "telegram:123456" | "web:<channelID>:<token>"
+	Channel     string `json:"channel"` // "telegram" | "web"
+	Username    string `json:"username,omitempty"`
+	DisplayName string `json:"displayName,omitempty"`
+	FirstSeen   int64  `json:"firstSeen"` // unix ms
+	LastSeen    int64  `json:"lastSeen"`  // unix ms
+}
+
+// Note is a free-text remark about a contact.
+type Note struct {
+	Time int64  `json:"time"` // unix ms
+	By   string `json:"by"`   // "agent" | "user"
+	Text string `json:"text"`
+}
+
+// Interaction is one stretch of conversation with a contact.
+type Interaction struct {
+	Time      int64  `json:"time"` // last message (unix ms)
+	Channel   string `json:"channel"`
+	SessionID string `json:"sessionId"`
+	Messages  int    `json:"messages"`
+	Preview   string `json:"preview,omitempty"` // start of the latest message
+}
+
+// Contact is everything an agent knows about one person.
+type Contact struct {
+	ID           string            `json:"id"`
+	Name         string            `json:"name"`
+	Profile      map[string]string `json:"profile,omitempty"`     // facts: 职业, 城市, 公司 ...
+	Preferences  map[string]string `json:"preferences,omitempty"` // how to talk to them: 语言, 称呼, 风格 ...
+	Notes        []Note            `json:"notes,omitempty"`
+	Identities   []Identity        `json:"identities"`
+	Interactions []Interaction     `json:"interactions,omitempty"` // oldest first
+	Messages     int               `json:"messages"`               // inbound messages, all channels
+	CreatedAt    int64             `json:"createdAt"`
+	UpdatedAt    int64             `json:"updatedAt"`
+}
+
+// LastSeen returns the newest identity activity (unix ms).
+func (c *Contact) LastSeen() int64 {
+	var last int64
+	for _, id := range c.Identities {
+		last = max(last, id.LastSeen)
+	}
+	return last
+}
+
+// Sender identifies who sent the message a run is answering.
+type Sender struct {
+	Key         string // identity key, see Identity.Key
+	Channel     string
+	Username    string
+	DisplayName string
+}
+
+type senderKey struct{}
+
+// WithSender returns a context carrying the sender of the current message.
+func WithSender(ctx context.Context, s Sender) context.Context {
+	return context.WithValue(ctx, senderKey{}, s)
+}
+
+// SenderFrom returns the sender stored by WithSender.
+func SenderFrom(ctx context.Context) (Sender, bool) {
+	s, ok := ctx.Value(senderKey{}).(Sender)
+	return s, ok && s.Key != ""
+}
+
+// TelegramKey returns the identity key of a Telegram user.
+func TelegramKey(userID int64) string {
+	return fmt.Sprintf("telegram:%d", userID)
+}
+
+// WebKey returns the identity key of a web-chat visitor.
+func WebKey(channelID, token string) string {
+	return "web:" + channelID + ":" + token
+}
+
+// Manager hands out one Store per agent and keeps it open for reuse.
+type Manager struct {
+	root   string // agents directory
+	mu     sync.Mutex
+	stores map[string]*Store
+}
+
+// NewManager creates a Manager for agents stored under agentsDir.
+func NewManager(agentsDir string) *Manager {
+	return &Manager{root: agentsDir, stores: make(map[string]*Store)}
+}
+
+// Get returns the contact store of an agent.
+func (m *Manager) Get(agentID string) (*Store, error) {
+	if agentID == "" || strings.ContainsAny(agentID, `/\`) || agentID == "." || agentID == ".." {
+		return nil, fmt.Errorf("invalid agent id %q", agentID)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.stores[agentID]; ok {
+		return s, nil
+	}
+	s := &Store{path: filepath.Join(m.root, agentID, "contacts", "contacts.json"), contacts: map[string]*Contact{}}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	m.stores[agentID] = s
+	return s, nil
+}
+
+// Store holds the contacts of one agent.
+type Store struct {
+	mu       sync.RWMutex
+	path     string
+	contacts map[string]*Contact
+	byKey    map[string]string // identity key → contact ID
+	seq      int64
+}
+
+func (s *Store) load() error {
+	s.byKey = map[string]string{}
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var list []*Contact
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("parse %s: %w", s.path, err)
+	}
+	for _, c := range list {
+		s.contacts[c.ID] = c
+		for _, id := range c.Identities {
+			s.byKey[id.Key] = c.ID
+		}
+	}
+	return nil
+}
+
+func (s *Store) save() error {
+	list := make([]*Contact, 0, len(s.contacts))
+	for _, c := range s.contacts {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt < list[j].CreatedAt })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// newID returns a unique contact ID; callers hold s.mu.
+func (s *Store) newID() string {
+	for {
+		s.seq++
+		id := fmt.Sprintf("c%d%02d", time.Now().UnixMilli(), s.seq%100)
+		if _, taken := s.contacts[id]; !taken {
+			return id
+		}
+	}
+}
+
+// Touch records an inbound message from sender, creating the contact on
+// first contact and refreshing the identity's username and display name.
+func (s *Store) Touch(sender Sender, sessionID, message string) (*Contact, error) {
+	if sender.Key == "" {
+		return nil, fmt.Errorf("sender key required")
+	}
+	now := time.Now().UnixMilli()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.contacts[s.byKey[sender.Key]]
+	if c == nil {
+		c = &Contact{ID: s.newID(), Name: firstNonEmpty(sender.DisplayName, sender.Username), CreatedAt: now}
+		c.Identities = append(c.Identities, Identity{Key: sender.Key, Channel: sender.Channel, FirstSeen: now})
+		s.contacts[c.ID] = c
+		s.byKey[sender.Key] = c.ID
+	}
+	for i := range c.Identities {
+		id := &c.Identities[i]
+		if id.Key != sender.Key {
+			continue
+		}
+		id.LastSeen = now
+		if sender.Username != "" {
+			id.Username = sender.Username
+		}
+		if sender.DisplayName != "" {
+			id.DisplayName = sender.DisplayName
+		}
+	}
+	c.Messages++
+	preview := strings.Join(strings.Fields(message), " ")
+	if r := []rune(preview); len(r) > maxPreviewRunes {
+		preview = string(r[:maxPreviewRunes]) + "…"
+	}
+	if n := len(c.Interactions); n > 0 && c.Interactions[n-1].SessionID == sessionID &&
+		now-c.Interactions[n-1].Time < sessionGap.Milliseconds() {
+		last := &c.Interactions[n-1]
+		last.Time = now
+		last.Messages++
+		last.Preview = preview
+	} else {
+		c.Interactions = append(c.Interactions, Interaction{
+			Time: now, Channel: sender.Channel, SessionID: sessionID, Messages: 1, Preview: preview,
+		})
+		if len(c.Interactions) > maxInteractions {
+			c.Interactions = c.Interactions[len(c.Interactions)-maxInteractions:]
+		}
+	}
+	c.UpdatedAt = now
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+	return clone(c), nil
+}
+
+// Get returns a copy of a contact.
+func (s *Store) Get(id string) (*Contact, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, ok := s.contacts[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return clone(c), nil
+}
+
+// Lookup returns the contact owning an identity key.
+func (s *Store) Lookup(key string) (*Contact, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, ok := s.contacts[s.byKey[key]]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return clone(c), nil
+}
+
+// List returns all contacts, most recently seen first. A non-empty query
+// keeps contacts whose name, identities, profile or notes contain it.
+func (s *Store) List(query string) []*Contact {
+	query = strings.ToLower(strings.TrimSpace(query))
+	s.mu.RLock()
+	out := make([]*Contact, 0, len(s.contacts))
+	for _, c := range s.contacts {
+		if query == "" || matches(c, query) {
+			out = append(out, clone(c))
+		}
+	}
+	s.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].LastSeen() > out[j].LastSeen() })
+	return out
+}
+
+func matches(c *Contact, q string) bool {
+	fields := []string{c.ID, c.Name}
+	for _, id := range c.Identities {
+		fields = append(fields, id.Key, id.Username, id.DisplayName)
+	}
+	for k, v := range c.Profile {
+		fields = append(fields, k, v)
+	}
+	for _, n := range c.Notes {
+		fields = append(fields, n.Text)
+	}
+	for _, f := range fields {
+		if strings.Contains(strings.ToLower(f), q) {
+			return true
+		}
+	}
+	return false
+}
+
+// Patch is a partial update of a contact. In Profile and Preferences an
+// empty value deletes the key.
+type Patch struct {
+	Name        *string           `json:"name,omitempty"`
+	Profile     map[string]string `json:"profile,omitempty"`
+	Preferences map[string]string `json:"preferences,omitempty"`
+	AddNote     string            `json:"addNote,omitempty"`
+	DeleteNote  *int64            `json:"deleteNote,omitempty"` // note time (unix ms)
+}
+
+// Update applies a patch; by ("agent" | "user") is recorded on new notes.
+func (s *Store) Update(id string, p Patch, by string) (*Contact, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.contacts[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	now := time.Now().UnixMilli()
+	if p.Name != nil {
+		c.Name = strings.TrimSpace(*p.Name)
+	}
+	c.Profile = mergeFields(c.Profile, p.Profile)
+	c.Preferences = mergeFields(c.Preferences, p.Preferences)
+	if p.DeleteNote != nil {
+		for i, n := range c.Notes {
+			if n.Time == *p.DeleteNote {
+				c.Notes = append(c.Notes[:i], c.Notes[i+1:]...)
+				break
+			}
+		}
+	}
+	if note := strings.TrimSpace(p.AddNote); note != "" {
+		c.Notes = append(c.Notes, Note{Time: now, By: by, Text: note})
+		if len(c.Notes) > maxNotes {
+			c.Notes = c.Notes[len(c.Notes)-maxNotes:]
+		}
+	}
+	c.UpdatedAt = now
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+	return clone(c), nil
+}
+
+func mergeFields(dst, patch map[string]string) map[string]string {
+	for k, v := range patch {
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if k == "" {
+			continue
+		}
+		if v == "" {
+			delete(dst, k)
+			continue
+		}
+		if dst == nil {
+			dst = map[string]string{}
+		}
+		dst[k] = v
+	}
+	return dst
+}
+
+// Link moves the identity key (and, if it belonged to another contact,
+// that contact's profile, notes and history) into contact id. The other
+// contact is deleted once it has no identities left.
+func (s *Store) Link(id, key string) (*Contact, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.contacts[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	otherID, known := s.byKey[key]
+	if known && otherID == id {
+		return clone(c), nil
+	}
+	if !known {
+		channel, _, _ := strings.Cut(key, ":")
+		c.Identities = append(c.Identities, Identity{Key: key, Channel: channel})
+	} else {
+		other := s.contacts[otherID]
+		c.Identities = append(c.Identities, other.Identities...)
+		for k, v := range other.Profile {
+			if _, set := c.Profile[k]; !set {
+				c.Profile = mergeFields(c.Profile, map[string]string{k: v})
+			}
+		}
+		for k, v := range other.Preferences {
+			if _, set := c.Preferences[k]; !set {
+				c.Preferences = mergeFields(c.Preferences, map[string]string{k: v})
+			}
+		}
+		if c.Name == "" {
+			c.Name = other.Name
+		}
+		c.Notes = append(c.Notes, other.Notes...)
+		sort.SliceStable(c.Notes, func(i, j int) bool { return c.Notes[i].Time < c.Notes[j].Time })
+		c.Interactions = append(c.Interactions, other.Interactions...)
+		sort.SliceStable(c.Interactions, func(i, j int) bool { return c.Interactions[i].Time < c.Interactions[j].Time })
+		if len(c.Interactions) > maxInteractions {
+			c.Interactions = c.Interactions[len(c.Interactions)-maxInteractions:]
+		}
+		c.Messages += other.Messages
+		c.CreatedAt = min(c.CreatedAt, other.CreatedAt)
+		for _, oid := range other.Identities {
+			s.byKey[oid.Key] = id
+		}
+		delete(s.contacts, otherID)
+	}
+	s.byKey[key] = id
+	c.UpdatedAt = time.Now().UnixMilli()
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+	return clone(c), nil
+}
+
+// Unlink detaches an identity from contact id into a new contact of its own.
+func (s *Store) Unlink(id, key string) (*Contact, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.contacts[id]
+	if !ok || s.byKey[key] != id {
+		return nil, ErrNotFound
+	}
+	if len(c.Identities) < 2 {
+		return nil, fmt.Errorf("cannot unlink the only identity of a contact")
+	}
+	now := time.Now().UnixMilli()
+	split := &Contact{ID: s.newID(), CreatedAt: now, UpdatedAt: now}
+	for i, ident := range c.Identities {
+		if ident.Key == key {
+			split.Identities = []Identity{ident}
+			split.Name = firstNonEmpty(ident.DisplayName, ident.Username)
+			c.Identities = append(c.Identities[:i], c.Identities[i+1:]...)
+			break
+		}
+	}
+	s.contacts[split.ID] = split
+	s.byKey[key] = split.ID
+	c.UpdatedAt = now
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+	return clone(split), nil
+}
+
+// Delete removes a contact and all its identities.
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.contacts[id]
+	if !ok {
+		return ErrNotFound
+	}
+	for _, ident := range c.Identities {
+		delete(s.byKey, ident.Key)
+	}
+	delete(s.contacts, id)
+	return s.save()
+}
+
+func clone(c *Contact) *Contact {
+	data, _ := json.Marshal(c)
+	var out Contact
+	_ = json.Unmarshal(data, &out)
+	return &out
+}
+
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
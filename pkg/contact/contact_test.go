@@ -0,0 +1,63 @@
+package contact
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStoreLinkAndPrompt(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewManager(dir).Get("a1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tg := Sender{Key: TelegramKey(42), Channel: "telegram", Username: "wang", DisplayName: "小王"}
+	c, _ := s.Touch(tg, "telegram-42", "你好")
+	c, _ = s.Touch(tg, "telegram-42", "今天天气怎么样")
+	if c.Name != "小王" || c.Messages != 2 || len(c.Interactions) != 1 || c.Interactions[0].Messages != 2 {
+		t.Fatalf("touch = %+v", c)
+	}
+	name := "王小明"
+	if _, err := s.Update(c.ID, Patch{Name: &name, Profile: map[string]string{"城市": "杭州"}, AddNote: "喜欢喝茶"}, "agent"); err != nil {
+		t.Fatal(err)
+	}
+
+	web := Sender{Key: WebKey("site", "tok"), Channel: "web"}
+	w, _ := s.Touch(web, "web-site-tok", "hi")
+	_, _ = s.Update(w.ID, Patch{Preferences: map[string]string{"语言": "中文"}}, "agent")
+
+	merged, err := s.Link(c.ID, web.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(merged.Identities) != 2 || merged.Messages != 3 || merged.Preferences["语言"] != "中文" {
+		t.Fatalf("merged = %+v", merged)
+	}
+	if got, _ := s.Lookup(web.Key); got == nil || got.ID != c.ID {
+		t.Fatalf("web identity not linked: %+v", got)
+	}
+	if _, err := s.Get(w.ID); err != ErrNotFound {
+		t.Fatalf("merged contact still exists: %v", err)
+	}
+
+	// Reload from disk.
+	s2, _ := NewManager(dir).Get("a1")
+	got, err := s2.Lookup(tg.Key)
+	if err != nil || got.Profile["城市"] != "杭州" {
+		t.Fatalf("reloaded = %+v, %v", got, err)
+	}
+	p := Prompt(got, web.Key)
+	for _, want := range []string{"王小明", "城市：杭州", "语言：中文", "喜欢喝茶", web.Key + " ← 本条消息"} {
+		if !strings.Contains(p, want) {
+			t.Fatalf("prompt missing %q:\n%s", want, p)
+		}
+	}
+
+	split, err := s2.Unlink(got.ID, web.Key)
+	if err != nil || len(split.Identities) != 1 {
+		t.Fatalf("unlink = %+v, %v", split, err)
+	}
+	if again, _ := s2.Lookup(web.Key); again.ID != split.ID {
+		t.Fatalf("web identity still on %s", again.ID)
+	}
+}
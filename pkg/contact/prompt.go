@@ -0,0 +1,71 @@
+package contact
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Prompt formats what the agent knows about the current sender for the
+// system prompt. key is the identity the message arrived on.
+func Prompt(c *Contact, key string) string {
+	if c == nil {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("## 当前对话对象\n")
+	name := c.Name
+	if name == "" {
+		name = "（未知姓名）"
+	}
+	b.WriteString(fmt.Sprintf("- 联系人：%s（ID: %s）\n", name, c.ID))
+	for _, id := range c.Identities {
+		line := "- 身份：" + id.Key
+		if id.Username != "" {
+			line += " @" + id.Username
+		}
+		if id.DisplayName != "" && id.DisplayName != c.Name {
+			line += "（" + id.DisplayName + "）"
+		}
+		if id.Key == key {
+			line += " ← 本条消息"
+		}
+		b.WriteString(line + "\n")
+	}
+	writeFields(&b, "资料", c.Profile)
+	writeFields(&b, "偏好", c.Preferences)
+	if n := len(c.Notes); n > 0 {
+		b.WriteString("- 备注：\n")
+		for _, note := range c.Notes[max(0, n-5):] {
+			b.WriteString(fmt.Sprintf("  - %s %s\n", time.UnixMilli(note.Time).Format("2006-01-02"), note.Text))
+		}
+	}
+	if len(c.Interactions) > 0 {
+		first := time.UnixMilli(c.CreatedAt).Format("2006-01-02")
+		b.WriteString(fmt.Sprintf("- 互动：共 %d 条消息，%d 次对话，首次 %s\n", c.Messages, len(c.Interactions), first))
+		// The current conversation is the last interaction; show the ones before it.
+		prev := c.Interactions[:len(c.Interactions)-1]
+		for _, it := range prev[max(0, len(prev)-3):] {
+			b.WriteString(fmt.Sprintf("  - %s [%s] %s\n", time.UnixMilli(it.Time).Format("2006-01-02 15:04"), it.Channel, it.Preview))
+		}
+	}
+	b.WriteString("\n用 contact_get 查看完整档案，用 contact_update 记录对方的资料、偏好或备注（只记录对方明确告知或可靠推断的信息）。")
+	return b.String()
+}
+
+func writeFields(b *strings.Builder, label string, m map[string]string) {
+	if len(m) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"："+m[k])
+	}
+	b.WriteString(fmt.Sprintf("- %s：%s\n", label, strings.Join(parts, "；")))
+}
@@ -5,12 +5,18 @@ package convlog
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 )
 
+// writeMu keeps Append from racing with Prune's rewrite of a log file.
+var writeMu sync.Mutex
+
 // Entry is a single message in the conversation log.
 type Entry struct {
 	Timestamp   string `json:"ts"`
@@ -43,6 +49,8 @@ func (cl *ConvLog) path() string {
 // Creates the convlogs/ directory and file if needed.
 // Uses O_APPEND which provides atomic appends for small writes on most OSes.
 func (cl *ConvLog) Append(entry Entry) error {
+	writeMu.Lock()
+	defer writeMu.Unlock()
 	p := cl.path()
 	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
 		return err
@@ -159,3 +167,48 @@ func readAllEntries(p string) ([]Entry, int, error) {
 	}
 	return entries, len(entries), scanner.Err()
 }
+
+// Prune drops entries older than before from every channel log of an agent,
+// removing logs that end up empty. Lines with an unparseable timestamp are
+// kept. With dryRun nothing is written. Returns entries and bytes dropped.
+func Prune(agentDir string, before time.Time, dryRun bool) (int, int64, error) {
+	files, _ := filepath.Glob(filepath.Join(agentDir, "convlogs", "*.jsonl"))
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	dropped, freed := 0, int64(0)
+	for _, p := range files {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return dropped, freed, err
+		}
+		var kept bytes.Buffer
+		n := 0
+		for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+			var e Entry
+			if len(bytes.TrimSpace(line)) > 0 && json.Unmarshal(line, &e) == nil {
+				if ts, err := time.Parse(time.RFC3339, e.Timestamp); err == nil && ts.Before(before) {
+					n++
+					continue
+				}
+			}
+			kept.Write(line)
+		}
+		if n == 0 {
+			continue
+		}
+		dropped += n
+		freed += int64(len(data) - kept.Len())
+		if dryRun {
+			continue
+		}
+		if len(bytes.TrimSpace(kept.Bytes())) == 0 {
+			err = os.Remove(p)
+		} else if err = os.WriteFile(p+".tmp", kept.Bytes(), 0644); err == nil {
+			err = os.Rename(p+".tmp", p)
+		}
+		if err != nil {
+			return dropped, freed, err
+		}
+	}
+	return dropped, freed, nil
+}
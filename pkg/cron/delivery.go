@@ -0,0 +1,336 @@
+package cron
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sunhuihui6688-star/ai-panel/pkg/config"
+)
+
+// ErrInvalidDelivery wraps every delivery validation error.
+var ErrInvalidDelivery = errors.New("invalid delivery")
+
+// Delivery statuses recorded on RunRecord.Delivery.
+const (
+	DeliverySent    = "sent"
+	DeliverySkipped = "skipped"
+	DeliveryFailed  = "failed"
+)
+
+// DeliveryStatus is the outcome of announcing one run.
+type DeliveryStatus struct {
+	Target string `json:"target"`           // target kind
+	Status string `json:"status"`           // "sent" | "skipped" | "failed"
+	Detail string `json:"detail,omitempty"` // skip reason or error
+	At     int64  `json:"at"`               // unix ms
+}
+
+// Deliverer sends a finished run to job.Delivery.Target. output is the full
+// agent response (RunRecord.Output is truncated).
+type Deliverer func(ctx context.Context, job *Job, rec RunRecord, output string) error
+
+// SetDeliverer installs the sender for one target kind. "webhook" is built
+// in; "telegram", "session" and "email" are wired up by the server.
+func (e *Engine) SetDeliverer(kind string, fn Deliverer) {
+	e.jobMu.Lock()
+	e.deliverers[kind] = fn
+	e.jobMu.Unlock()
+}
+
+// validate checks the target and conditions of an announcing job.
+func (d Delivery) validate() error {
+	if d.Match != "" {
+		if _, err := regexp.Compile(d.Match); err != nil {
+			return fmt.Errorf("%w: bad match pattern: %v", ErrInvalidDelivery, err)
+		}
+	}
+	t := d.Target
+	if d.Mode != "announce" || t == nil {
+		return nil
+	}
+	switch t.Kind {
+	case "telegram":
+		if t.ChatID == 0 {
+			return fmt.Errorf("%w: telegram target needs chatId", ErrInvalidDelivery)
+		}
+	case "session":
+		if t.SessionID == "" {
+			return fmt.Errorf("%w: session target needs sessionId", ErrInvalidDelivery)
+		}
+		if strings.ContainsAny(t.SessionID, `/\`) || strings.Contains(t.SessionID, "..") {
+			return fmt.Errorf("%w: bad sessionId %q", ErrInvalidDelivery, t.SessionID)
+		}
+	case "webhook":
+		u, err := url.Parse(t.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: webhook url must be http(s)", ErrInvalidDelivery)
+		}
+	case "email":
+		if len(t.To) == 0 {
+			return fmt.Errorf("%w: email target needs at least one recipient", ErrInvalidDelivery)
+		}
+		for _, addr := range t.To {
+			if !strings.Contains(addr, "@") || strings.ContainsAny(addr, "\r\n") {
+				return fmt.Errorf("%w: bad email address %q", ErrInvalidDelivery, addr)
+			}
+		}
+	default:
+		return fmt.Errorf("%w: unknown target kind %q (want telegram, session, webhook or email)", ErrInvalidDelivery, t.Kind)
+	}
+	return nil
+}
+
+// emptyReports are replies treated as "nothing to report" by SkipEmpty.
+var emptyReports = []string{
+	"nothing to report", "no updates", "no update", "nothing new",
+	"无事可报", "没有需要汇报的", "没有需要报告的", "暂无更新", "无更新", "没有新内容", "无新内容",
+}
+
+// isEmptyReport reports whether output is blank or only says there is
+// nothing to report.
+func isEmptyReport(output string) bool {
+	s := strings.ToLower(strings.TrimSpace(output))
+	if s == "" {
+		return true
+	}
+	if len([]rune(s)) > 60 {
+		return false
+	}
+	for _, phrase := range emptyReports {
+		if strings.Contains(s, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// skipReason applies the delivery conditions; "" means deliver. Failed
+// runs are always delivered; SkipEmpty and Match only filter successes.
+func (d Delivery) skipReason(rec RunRecord, output string) string {
+	if rec.Status == "error" {
+		return ""
+	}
+	if d.OnlyOnError {
+		return "run succeeded (only on error)"
+	}
+	if d.SkipEmpty && isEmptyReport(output) {
+		return "nothing to report"
+	}
+	if d.Match != "" {
+		if re, err := regexp.Compile(d.Match); err == nil && !re.MatchString(output) {
+			return "output does not match " + d.Match
+		}
+	}
+	return ""
+}
+
+// deliver announces a finished run; it returns nil when the job has no
+// delivery configured.
+func (e *Engine) deliver(job *Job, rec RunRecord, output string) *DeliveryStatus {
+	d := job.Delivery
+	if d.Mode != "announce" || d.Target == nil {
+		return nil
+	}
+	st := &DeliveryStatus{Target: d.Target.Kind, At: time.Now().UnixMilli()}
+	if reason := d.skipReason(rec, output); reason != "" {
+		st.Status, st.Detail = DeliverySkipped, reason
+		return st
+	}
+	e.jobMu.RLock()
+	fn := e.deliverers[d.Target.Kind]
+	e.jobMu.RUnlock()
+	if fn == nil {
+		st.Status, st.Detail = DeliveryFailed, "no deliverer for "+d.Target.Kind
+		return st
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := fn(ctx, job, rec, output); err != nil {
+		st.Status, st.Detail = DeliveryFailed, err.Error()
+		return st
+	}
+	st.Status = DeliverySent
+	return st
+}
+
+// AnnounceText formats a run for chat and email delivery.
+func AnnounceText(job *Job, rec RunRecord, output string) string {
+	if rec.Status == "error" {
+		return fmt.Sprintf("❌ 定时任务「%s」运行失败：%s", job.Name, rec.Error)
+	}
+	return fmt.Sprintf("⏰ 定时任务「%s」\n\n%s", job.Name, strings.TrimSpace(output))
+}
+
+// ── Webhook ──────────────────────────────────────────────────────────────
+
+// WebhookPayload is the JSON body POSTed to webhook targets. With a secret,
+// the X-Cron-Signature header carries "sha256=" + hex HMAC-SHA256 of the body.
+type WebhookPayload struct {
+	Event     string `json:"event"` // "cron.run"
+	JobID     string `json:"jobId"`
+	JobName   string `json:"jobName"`
+	AgentID   string `json:"agentId"`
+	RunID     string `json:"runId"`
+	Status    string `json:"status"`
+	Output    string `json:"output"`
+	Error     string `json:"error,omitempty"`
+	StartedAt int64  `json:"startedAt"`
+	EndedAt   int64  `json:"endedAt"`
+}
+
+// SignWebhook returns the X-Cron-Signature value for body.
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func deliverWebhook(ctx context.Context, job *Job, rec RunRecord, output string) error {
+	t := job.Delivery.Target
+	body, err := json.Marshal(WebhookPayload{
+		Event: "cron.run", JobID: job.ID, JobName: job.Name, AgentID: job.AgentID, RunID: rec.RunID,
+		Status: rec.Status, Output: output, Error: rec.Error, StartedAt: rec.StartedAt, EndedAt: rec.EndedAt,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ZyHive-Cron/1.0")
+	if t.Secret != "" {
+		req.Header.Set("X-Cron-Signature", SignWebhook(t.Secret, body))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+		return fmt.Errorf("webhook returned %s: %s", resp.Status, strings.TrimSpace(string(snippet)))
+	}
+	return nil
+}
+
+// ── Email ────────────────────────────────────────────────────────────────
+
+// EmailDeliverer sends runs through the SMTP server returned by smtpCfg
+// (read on every send so config changes apply without a restart).
+func EmailDeliverer(smtpCfg func() config.SMTPConfig) Deliverer {
+	return func(ctx context.Context, job *Job, rec RunRecord, output string) error {
+		c := smtpCfg()
+		if c.Host == "" {
+			return fmt.Errorf("smtp is not configured")
+		}
+		from := c.From
+		if from == "" {
+			from = c.Username
+		}
+		t := job.Delivery.Target
+		subject := t.Subject
+		if subject == "" {
+			subject = "[定时任务] " + job.Name
+			if rec.Status == "error" {
+				subject += "（失败）"
+			}
+		}
+		msg := buildMail(from, t.To, subject, AnnounceText(job, rec, output))
+		return sendMail(ctx, c, from, t.To, msg)
+	}
+}
+
+func buildMail(from string, to []string, subject, body string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.BEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	enc := base64.StdEncoding.EncodeToString([]byte(body))
+	for len(enc) > 76 {
+		b.WriteString(enc[:76] + "\r\n")
+		enc = enc[76:]
+	}
+	b.WriteString(enc + "\r\n")
+	return b.Bytes()
+}
+
+func sendMail(ctx context.Context, c config.SMTPConfig, from string, to []string, msg []byte) error {
+	port := c.Port
+	if port == 0 {
+		port = 587
+	}
+	addr := net.JoinHostPort(c.Host, strconv.Itoa(port))
+	dialer := &net.Dialer{Timeout: 15 * time.Second}
+	var conn net.Conn
+	var err error
+	if port == 465 {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: c.Host})
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, c.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok && port != 465 {
+		if err := client.StartTLS(&tls.Config{ServerName: c.Host}); err != nil {
+			return err
+		}
+	}
+	if c.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", c.Username, c.Password, c.Host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
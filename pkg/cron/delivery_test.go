@@ -0,0 +1,91 @@
+package cron
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDeliveryConditions(t *testing.T) {
+	target := &DeliveryTarget{Kind: "webhook", URL: "http://example.invalid/hook"}
+	ok := RunRecord{Status: "ok"}
+	failed := RunRecord{Status: "error", Error: "boom"}
+
+	cases := []struct {
+		d      Delivery
+		rec    RunRecord
+		output string
+		skip   bool
+	}{
+		{Delivery{Mode: "announce", Target: target}, ok, "", false},
+		{Delivery{Mode: "announce", Target: target, OnlyOnError: true}, ok, "report", true},
+		{Delivery{Mode: "announce", Target: target, OnlyOnError: true}, failed, "", false},
+		{Delivery{Mode: "announce", Target: target, SkipEmpty: true}, ok, "  ", true},
+		{Delivery{Mode: "announce", Target: target, SkipEmpty: true}, ok, "Nothing to report.", true},
+		{Delivery{Mode: "announce", Target: target, SkipEmpty: true}, ok, "今日无事可报", true},
+		{Delivery{Mode: "announce", Target: target, SkipEmpty: true}, ok, "磁盘使用率 91%", false},
+		{Delivery{Mode: "announce", Target: target, SkipEmpty: true}, failed, "", false},
+		{Delivery{Mode: "announce", Target: target, Match: `(?i)alert|告警`}, ok, "一切正常", true},
+		{Delivery{Mode: "announce", Target: target, Match: `(?i)alert|告警`}, ok, "ALERT: cpu", false},
+	}
+	for i, c := range cases {
+		if got := c.d.skipReason(c.rec, c.output) != ""; got != c.skip {
+			t.Errorf("case %d: skip = %v, want %v", i, got, c.skip)
+		}
+	}
+
+	for _, bad := range []Delivery{
+		{Mode: "announce", Target: target, Match: "("},
+		{Mode: "announce", Target: &DeliveryTarget{Kind: "webhook", URL: "ftp://x"}},
+		{Mode: "announce", Target: &DeliveryTarget{Kind: "email"}},
+		{Mode: "announce", Target: &DeliveryTarget{Kind: "telegram"}},
+		{Mode: "announce", Target: &DeliveryTarget{Kind: "session", SessionID: "../../etc/x"}},
+		{Mode: "announce", Target: &DeliveryTarget{Kind: "pager"}},
+	} {
+		if err := bad.validate(); !errors.Is(err, ErrInvalidDelivery) {
+			t.Errorf("%+v: err = %v", bad, err)
+		}
+	}
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	var gotSig string
+	var got WebhookPayload
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSig = r.Header.Get("X-Cron-Signature")
+		body, _ = io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &got)
+	}))
+	defer srv.Close()
+
+	e := NewEngine(t.TempDir(), nil)
+	job := &Job{ID: "j1", Name: "daily", AgentID: "main", Delivery: Delivery{
+		Mode: "announce", Target: &DeliveryTarget{Kind: "webhook", URL: srv.URL, Secret: "s3cret"},
+	}}
+	st := e.deliver(job, RunRecord{RunID: "r1", Status: "ok"}, "hello")
+	if st == nil || st.Status != DeliverySent {
+		t.Fatalf("status = %+v", st)
+	}
+	if got.JobID != "j1" || got.Output != "hello" || got.Event != "cron.run" {
+		t.Fatalf("payload = %+v", got)
+	}
+	if gotSig != SignWebhook("s3cret", body) {
+		t.Fatalf("signature = %q", gotSig)
+	}
+
+	job.Delivery.OnlyOnError = true
+	if st := e.deliver(job, RunRecord{Status: "ok"}, "hello"); st.Status != DeliverySkipped {
+		t.Fatalf("only-on-error status = %+v", st)
+	}
+
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusInternalServerError)
+	})
+	if st := e.deliver(job, RunRecord{Status: "error", Error: "x"}, ""); st.Status != DeliveryFailed {
+		t.Fatalf("failing webhook status = %+v", st)
+	}
+}
@@ -4,9 +4,12 @@ package cron
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"sync"
@@ -22,22 +25,26 @@ type RunnerFunc func(ctx context.Context, agentID, message string) (string, erro
 // ── Job types ─────────────────────────────────────────────────────────────
 
 type Job struct {
-	ID          string   `json:"id"`
-	Name        string   `json:"name"`
-	Remark      string   `json:"remark,omitempty"` // human-readable note
-	Enabled     bool     `json:"enabled"`
-	Schedule    Schedule `json:"schedule"`
-	Payload     Payload  `json:"payload"`
-	Delivery    Delivery `json:"delivery"`
-	AgentID     string   `json:"agentId"`
-	CreatedAtMs int64    `json:"createdAtMs"`
-	State       JobState `json:"state"`
+	ID             string   `json:"id"`
+	Name           string   `json:"name"`
+	Remark         string   `json:"remark,omitempty"` // human-readable note
+	Enabled        bool     `json:"enabled"`
+	Schedule       Schedule `json:"schedule"`
+	Payload        Payload  `json:"payload"`
+	Delivery       Delivery `json:"delivery"`
+	AgentID        string   `json:"agentId"`
+	CreatedBy      string   `json:"createdBy,omitempty"`      // "agent" when created through the cron_create tool
+	DeleteAfterRun bool     `json:"deleteAfterRun,omitempty"` // at: delete the job after it fires instead of disabling it
+	CreatedAtMs    int64    `json:"createdAtMs"`
+	State          JobState `json:"state"`
 }
 
 type Schedule struct {
-	Kind string `json:"kind"` // "cron" | "every" | "at"
-	Expr string `json:"expr"` // cron expression
-	TZ   string `json:"tz"`   // timezone, e.g. "Asia/Shanghai"
+	Kind   string `json:"kind"`             // "cron" | "every" | "at" ("" = cron)
+	Expr   string `json:"expr"`             // cron expression, interval ("30m", "1d") or time ("2026-01-02 15:04", RFC 3339)
+	TZ     string `json:"tz"`               // timezone, e.g. "Asia/Shanghai"
+	Offset string `json:"offset,omitempty"` // every: shifts the grid, e.g. "15m" with "1h" fires at :15
+	Jitter string `json:"jitter,omitempty"` // cron / every: delays each run by up to this much, stable per job
 }
 
 type Payload struct {
@@ -47,7 +54,24 @@ type Payload struct {
 }
 
 type Delivery struct {
-	Mode string `json:"mode"` // "announce" | "none"
+	Mode        string          `json:"mode"`                  // "announce" | "none"
+	Target      *DeliveryTarget `json:"target,omitempty"`      // where to announce; nil = run log only
+	OnlyOnError bool            `json:"onlyOnError,omitempty"` // announce failed runs only
+	SkipEmpty   bool            `json:"skipEmpty,omitempty"`   // suppress empty / "nothing to report" output
+	Match       string          `json:"match,omitempty"`       // regexp; announce successful runs only when the output matches
+}
+
+// DeliveryTarget is where a job's output is announced.
+type DeliveryTarget struct {
+	Kind      string   `json:"kind"`                // "telegram" | "session" | "webhook" | "email"
+	ChannelID string   `json:"channelId,omitempty"` // agent channel ID (telegram bot / web channel)
+	ChatID    int64    `json:"chatId,omitempty"`    // telegram chat
+	ThreadID  int64    `json:"threadId,omitempty"`  // telegram forum topic
+	SessionID string   `json:"sessionId,omitempty"` // agent session (web / panel chat)
+	URL       string   `json:"url,omitempty"`       // webhook endpoint
+	Secret    string   `json:"secret,omitempty"`    // webhook HMAC-SHA256 key
+	To        []string `json:"to,omitempty"`        // email recipients
+	Subject   string   `json:"subject,omitempty"`   // email subject (default "[定时任务] <name>")
 }
 
 type JobState struct {
@@ -57,24 +81,34 @@ type JobState struct {
 }
 
 type RunRecord struct {
-	JobID     string `json:"jobId"`
-	RunID     string `json:"runId"`
-	StartedAt int64  `json:"startedAt"`
-	EndedAt   int64  `json:"endedAt"`
-	Status    string `json:"status"` // "ok" | "error"
-	Output    string `json:"output"` // truncated agent response
-	Error     string `json:"error,omitempty"`
+	JobID     string          `json:"jobId"`
+	RunID     string          `json:"runId"`
+	StartedAt int64           `json:"startedAt"`
+	EndedAt   int64           `json:"endedAt"`
+	Status    string          `json:"status"` // "ok" | "error" ("running" in start notifications)
+	Output    string          `json:"output"` // truncated agent response
+	Error     string          `json:"error,omitempty"`
+	Delivery  *DeliveryStatus `json:"delivery,omitempty"` // nil = no delivery configured
 }
 
 // ── Engine ────────────────────────────────────────────────────────────────
 
+// ErrJobNotFound is returned for unknown job IDs.
+var ErrJobNotFound = errors.New("job not found")
+
+// ErrJobLimit is returned by AddLimited when the owner is at its limit.
+var ErrJobLimit = errors.New("job limit reached")
+
 type Engine struct {
-	cron     *cron.Cron
-	jobs     map[string]*Job
-	entryIDs map[string]cron.EntryID // jobID -> cron entry
-	jobMu    sync.RWMutex
-	dataDir  string
-	runner   RunnerFunc
+	cron       *cron.Cron
+	jobs       map[string]*Job
+	entryIDs   map[string]cron.EntryID // jobID -> cron entry
+	jobMu      sync.RWMutex
+	runsMu     sync.Mutex // guards runs/*.jsonl appends and pruning
+	dataDir    string
+	runner     RunnerFunc
+	onRun      func(RunRecord)      // optional; called when a run starts and ends
+	deliverers map[string]Deliverer // target kind -> sender
 }
 
 // NewEngine creates a new cron engine backed by the given data directory.
@@ -85,9 +119,18 @@ func NewEngine(dataDir string, runner RunnerFunc) *Engine {
 		entryIDs: make(map[string]cron.EntryID),
 		dataDir:  dataDir,
 		runner:   runner,
+		deliverers: map[string]Deliverer{
+			"webhook": deliverWebhook,
+		},
 	}
 }
 
+// SetOnRun registers a callback invoked when a job run starts (Status
+// "running") and again with the final record when it ends.
+func (e *Engine) SetOnRun(fn func(RunRecord)) {
+	e.onRun = fn
+}
+
 // Load reads jobs.json from disk and schedules all enabled jobs.
 func (e *Engine) Load() error {
 	e.jobMu.Lock()
@@ -113,14 +156,27 @@ func (e *Engine) Load() error {
 		return fmt.Errorf("parse jobs.json: %w", err)
 	}
 
+	now := time.Now()
+	var missed []*Job
 	for _, j := range jobs {
 		e.jobs[j.ID] = j
-		if j.Enabled {
-			e.scheduleJobLocked(j)
+		if !j.Enabled {
+			continue
+		}
+		if j.Schedule.Kind == "at" && !j.oneShotPending(now) {
+			missed = append(missed, j) // fired while the server was down
+			continue
+		}
+		if err := e.scheduleJobLocked(j); err != nil {
+			log.Printf("cron: job %s not scheduled: %v", j.ID, err)
 		}
 	}
 
 	e.cron.Start()
+	for _, j := range missed {
+		log.Printf("cron: running missed one-shot job %s", j.ID)
+		go e.executeJob(j)
+	}
 	return nil
 }
 
@@ -138,17 +194,44 @@ func (e *Engine) Stop() context.Context {
 func (e *Engine) Add(job *Job) error {
 	e.jobMu.Lock()
 	defer e.jobMu.Unlock()
+	return e.addLocked(job)
+}
+
+// AddLimited is Add that fails with ErrJobLimit when max jobs with the same
+// AgentID and CreatedBy already exist. The count and the insert happen under
+// one lock, so concurrent callers cannot overshoot max.
+func (e *Engine) AddLimited(job *Job, max int) error {
+	e.jobMu.Lock()
+	defer e.jobMu.Unlock()
+
+	owned := 0
+	for _, j := range e.jobs {
+		if j.AgentID == job.AgentID && j.CreatedBy == job.CreatedBy {
+			owned++
+		}
+	}
+	if owned >= max {
+		return fmt.Errorf("%w (%d)", ErrJobLimit, max)
+	}
+	return e.addLocked(job)
+}
 
+func (e *Engine) addLocked(job *Job) error {
 	if job.ID == "" {
 		job.ID = "job-" + uuid.New().String()[:8]
 	}
 	if job.CreatedAtMs == 0 {
 		job.CreatedAtMs = time.Now().UnixMilli()
 	}
+	if err := job.validate(); err != nil {
+		return err
+	}
 
 	e.jobs[job.ID] = job
 	if job.Enabled {
-		e.scheduleJobLocked(job)
+		if err := e.scheduleJobLocked(job); err != nil {
+			return err
+		}
 	}
 	return e.saveLocked()
 }
@@ -160,35 +243,42 @@ func (e *Engine) Update(id string, patch *Job) error {
 
 	existing, ok := e.jobs[id]
 	if !ok {
-		return fmt.Errorf("job %q not found", id)
+		return fmt.Errorf("%w: %q", ErrJobNotFound, id)
 	}
 
-	// Unschedule old
-	e.unscheduleJobLocked(id)
-
-	// Apply patch fields
+	// Apply patch fields to a copy and validate before touching the schedule.
+	next := *existing
 	if patch.Name != "" {
-		existing.Name = patch.Name
+		next.Name = patch.Name
 	}
 	if patch.Remark != "" {
-		existing.Remark = patch.Remark
+		next.Remark = patch.Remark
 	}
-	existing.Enabled = patch.Enabled
+	next.Enabled = patch.Enabled
+	next.DeleteAfterRun = patch.DeleteAfterRun
 	if patch.Schedule.Expr != "" {
-		existing.Schedule = patch.Schedule
+		next.Schedule = patch.Schedule
 	}
 	if patch.Payload.Message != "" {
-		existing.Payload = patch.Payload
+		next.Payload = patch.Payload
 	}
 	if patch.Delivery.Mode != "" {
-		existing.Delivery = patch.Delivery
+		next.Delivery = patch.Delivery
 	}
 	if patch.AgentID != "" {
-		existing.AgentID = patch.AgentID
+		next.AgentID = patch.AgentID
+	}
+	if err := next.validate(); err != nil {
+		return err
 	}
 
+	e.unscheduleJobLocked(id)
+	*existing = next
+	existing.State.NextRunAtMs = 0
 	if existing.Enabled {
-		e.scheduleJobLocked(existing)
+		if err := e.scheduleJobLocked(existing); err != nil {
+			return err
+		}
 	}
 	return e.saveLocked()
 }
@@ -199,7 +289,7 @@ func (e *Engine) Remove(id string) error {
 	defer e.jobMu.Unlock()
 
 	if _, ok := e.jobs[id]; !ok {
-		return fmt.Errorf("job %q not found", id)
+		return fmt.Errorf("%w: %q", ErrJobNotFound, id)
 	}
 	e.unscheduleJobLocked(id)
 	delete(e.jobs, id)
@@ -212,7 +302,7 @@ func (e *Engine) RunNow(id string) error {
 	job, ok := e.jobs[id]
 	if !ok {
 		e.jobMu.RUnlock()
-		return fmt.Errorf("job %q not found", id)
+		return fmt.Errorf("%w: %q", ErrJobNotFound, id)
 	}
 	// Copy to avoid races
 	j := *job
@@ -222,6 +312,18 @@ func (e *Engine) RunNow(id string) error {
 	return nil
 }
 
+// Get returns a copy of a job by ID.
+func (e *Engine) Get(id string) (*Job, bool) {
+	e.jobMu.RLock()
+	defer e.jobMu.RUnlock()
+	j, ok := e.jobs[id]
+	if !ok {
+		return nil, false
+	}
+	cp := *j
+	return &cp, true
+}
+
 // ListJobs returns all jobs.
 func (e *Engine) ListJobs() []*Job {
 	e.jobMu.RLock()
@@ -234,7 +336,7 @@ func (e *Engine) ListJobs() []*Job {
 	return result
 }
 
-// ListJobsByAgent returns jobs whose AgentID matches the given ID.
+// ListJobsByAgent returns copies of the jobs whose AgentID matches the given ID.
 // Pass "" to list jobs with no owner (global jobs).
 // Pass "*" to list all jobs regardless of owner.
 func (e *Engine) ListJobsByAgent(agentID string) []*Job {
@@ -244,7 +346,8 @@ func (e *Engine) ListJobsByAgent(agentID string) []*Job {
 	result := make([]*Job, 0)
 	for _, j := range e.jobs {
 		if agentID == "*" || j.AgentID == agentID {
-			result = append(result, j)
+			cp := *j
+			result = append(result, &cp)
 		}
 	}
 	return result
@@ -284,36 +387,58 @@ func (e *Engine) ListRuns(jobID string) ([]RunRecord, error) {
 	return records, nil
 }
 
+// Preview returns the next n fire times of a saved job, including its
+// jitter. Disabled jobs are previewed as if enabled.
+func (e *Engine) Preview(id string, n int) ([]time.Time, error) {
+	e.jobMu.RLock()
+	job, ok := e.jobs[id]
+	if !ok {
+		e.jobMu.RUnlock()
+		return nil, fmt.Errorf("%w: %q", ErrJobNotFound, id)
+	}
+	s := job.Schedule
+	e.jobMu.RUnlock()
+	sched, err := s.compile(id)
+	if err != nil {
+		return nil, err
+	}
+	return nextN(sched, time.Now(), n), nil
+}
+
 // ── Internal helpers ──────────────────────────────────────────────────────
 
-func (e *Engine) scheduleJobLocked(job *Job) {
-	spec := job.Schedule.Expr
-	if job.Schedule.TZ != "" {
-		spec = fmt.Sprintf("CRON_TZ=%s %s", job.Schedule.TZ, spec)
+// validate checks the schedule and delivery; an enabled job must fire at
+// least once more.
+func (j *Job) validate() error {
+	sched, err := j.Schedule.compile(j.ID)
+	if err != nil {
+		return err
+	}
+	if j.Enabled && sched.Next(time.Now()).IsZero() {
+		return invalidf("%s is in the past", j.Schedule.Expr)
 	}
+	return j.Delivery.validate()
+}
 
-	// robfig/cron/v3 with seconds support; if user gives 5-field, prepend "0 "
-	j := job // capture for closure
-	entryID, err := e.cron.AddFunc(spec, func() {
-		e.executeJob(j)
-	})
+// oneShotPending reports whether an "at" job has yet to reach its time.
+func (j *Job) oneShotPending(now time.Time) bool {
+	sched, err := j.Schedule.compile(j.ID)
+	return err == nil && !sched.Next(now).IsZero()
+}
+
+func (e *Engine) scheduleJobLocked(job *Job) error {
+	sched, err := job.Schedule.compile(job.ID)
 	if err != nil {
-		// Try with "0 " prefix for standard 5-field cron
-		entryID, err = e.cron.AddFunc("0 "+spec, func() {
-			e.executeJob(j)
-		})
-		if err != nil {
-			fmt.Printf("cron: failed to schedule job %s: %v\n", job.ID, err)
-			return
-		}
+		return err
 	}
-	e.entryIDs[job.ID] = entryID
-
-	// Update next run time
-	entry := e.cron.Entry(entryID)
-	if !entry.Next.IsZero() {
-		job.State.NextRunAtMs = entry.Next.UnixMilli()
+	j := job // capture for closure
+	e.entryIDs[job.ID] = e.cron.Schedule(sched, cron.FuncJob(func() {
+		e.executeJob(j)
+	}))
+	if next := sched.Next(time.Now()); !next.IsZero() {
+		job.State.NextRunAtMs = next.UnixMilli()
 	}
+	return nil
 }
 
 func (e *Engine) unscheduleJobLocked(id string) {
@@ -326,22 +451,35 @@ func (e *Engine) unscheduleJobLocked(id string) {
 func (e *Engine) executeJob(job *Job) {
 	startedAt := time.Now().UnixMilli()
 
-	agentID := job.AgentID
-	if agentID == "" && job.Payload.Kind == "agentTurn" {
+	// Snapshot for delivery: State and Schedule are written under jobMu.
+	e.jobMu.RLock()
+	snapshot := *job
+	e.jobMu.RUnlock()
+
+	agentID := snapshot.AgentID
+	if agentID == "" && snapshot.Payload.Kind == "agentTurn" {
 		agentID = "main" // default agent
 	}
+	snapshot.AgentID = agentID
 
 	record := RunRecord{
 		JobID:     job.ID,
 		RunID:     "run-" + uuid.New().String()[:8],
 		StartedAt: startedAt,
 	}
+	if e.onRun != nil {
+		started := record
+		started.Status = "running"
+		e.onRun(started)
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 	defer cancel()
 
+	var output string
 	if e.runner != nil {
-		output, err := e.runner(ctx, agentID, job.Payload.Message)
+		var err error
+		output, err = e.runner(ctx, agentID, snapshot.Payload.Message)
 		if err != nil {
 			record.Status = "error"
 			record.Error = err.Error()
@@ -361,6 +499,8 @@ func (e *Engine) executeJob(job *Job) {
 
 	record.EndedAt = time.Now().UnixMilli()
 
+	record.Delivery = e.deliver(&snapshot, record, output)
+
 	// Update job state
 	e.jobMu.Lock()
 	if j, ok := e.jobs[job.ID]; ok {
@@ -373,15 +513,30 @@ func (e *Engine) executeJob(job *Job) {
 				j.State.NextRunAtMs = entry.Next.UnixMilli()
 			}
 		}
+		// A one-shot job is done once its time has come (manual runs before
+		// then leave it scheduled).
+		if j.Schedule.Kind == "at" && !j.oneShotPending(time.UnixMilli(startedAt)) {
+			e.unscheduleJobLocked(j.ID)
+			j.Enabled = false
+			j.State.NextRunAtMs = 0
+			if j.DeleteAfterRun {
+				delete(e.jobs, j.ID)
+			}
+		}
 		e.saveLocked()
 	}
 	e.jobMu.Unlock()
 
 	// Append run record
 	e.appendRunRecord(record)
+	if e.onRun != nil {
+		e.onRun(record)
+	}
 }
 
 func (e *Engine) appendRunRecord(record RunRecord) {
+	e.runsMu.Lock()
+	defer e.runsMu.Unlock()
 	path := filepath.Join(e.dataDir, "runs", record.JobID+".jsonl")
 	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
@@ -393,6 +548,47 @@ func (e *Engine) appendRunRecord(record RunRecord) {
 	fmt.Fprintf(f, "%s\n", data)
 }
 
+// PruneRuns drops run records that started before the cutoff. With dryRun
+// nothing is written. Returns records and bytes dropped.
+func (e *Engine) PruneRuns(before time.Time, dryRun bool) (int, int64, error) {
+	e.runsMu.Lock()
+	defer e.runsMu.Unlock()
+	files, _ := filepath.Glob(filepath.Join(e.dataDir, "runs", "*.jsonl"))
+	cutoff := before.UnixMilli()
+	dropped, freed := 0, int64(0)
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return dropped, freed, err
+		}
+		var kept bytes.Buffer
+		n := 0
+		for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+			var r RunRecord
+			if json.Unmarshal(line, &r) == nil && r.StartedAt > 0 && r.StartedAt < cutoff {
+				n++
+				continue
+			}
+			kept.Write(line)
+		}
+		if n == 0 {
+			continue
+		}
+		dropped += n
+		freed += int64(len(data) - kept.Len())
+		if dryRun {
+			continue
+		}
+		if err := os.WriteFile(path+".tmp", kept.Bytes(), 0644); err != nil {
+			return dropped, freed, err
+		}
+		if err := os.Rename(path+".tmp", path); err != nil {
+			return dropped, freed, err
+		}
+	}
+	return dropped, freed, nil
+}
+
 func (e *Engine) saveLocked() error {
 	jobs := make([]*Job, 0, len(e.jobs))
 	for _, j := range e.jobs {
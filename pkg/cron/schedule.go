@@ -0,0 +1,219 @@
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	cron "github.com/robfig/cron/v3"
+)
+
+// ErrInvalidSchedule wraps every schedule validation error.
+var ErrInvalidSchedule = errors.New("invalid schedule")
+
+func invalidf(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidSchedule, fmt.Sprintf(format, args...))
+}
+
+// specParser accepts 6-field (with seconds) expressions and descriptors
+// such as @daily, matching the scheduler's cron.WithSeconds().
+var specParser = cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// NextRuns returns the next n fire times of a schedule after from.
+// Standard 5-field cron expressions are accepted and run at second 0.
+// Jitter is computed as for a job with an empty ID, so a saved job's real
+// times may differ by up to the jitter; use Engine.Preview for those.
+func NextRuns(s Schedule, from time.Time, n int) ([]time.Time, error) {
+	sched, err := s.compile("")
+	if err != nil {
+		return nil, err
+	}
+	return nextN(sched, from, n), nil
+}
+
+func nextN(sched cron.Schedule, from time.Time, n int) []time.Time {
+	out := make([]time.Time, 0, n)
+	t := from
+	for i := 0; i < n; i++ {
+		t = sched.Next(t)
+		if t.IsZero() {
+			break
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+// compile validates s and turns it into a robfig schedule. seed (the job
+// ID) makes jitter differ between jobs while staying stable per job.
+func (s Schedule) compile(seed string) (cron.Schedule, error) {
+	loc := time.Local
+	if s.TZ != "" {
+		l, err := time.LoadLocation(s.TZ)
+		if err != nil {
+			return nil, invalidf("unknown timezone %q", s.TZ)
+		}
+		loc = l
+	}
+	expr := strings.TrimSpace(s.Expr)
+	if expr == "" {
+		return nil, invalidf("expr is required")
+	}
+	if s.Offset != "" && s.Kind != "every" {
+		return nil, invalidf("offset only applies to every schedules")
+	}
+
+	var sched cron.Schedule
+	var err error
+	switch s.Kind {
+	case "", "cron":
+		sched, err = parseCronExpr(expr, s.TZ)
+	case "every":
+		sched, err = parseEvery(expr, s.Offset, loc)
+	case "at":
+		if s.Jitter != "" {
+			return nil, invalidf("jitter does not apply to one-shot (at) schedules")
+		}
+		var at time.Time
+		if at, err = parseAt(expr, loc); err == nil {
+			sched = atSchedule{at: at}
+		}
+	default:
+		return nil, invalidf("unknown kind %q (want cron, every or at)", s.Kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Jitter != "" {
+		limit, err := parseDuration(s.Jitter)
+		if err != nil || limit < 0 {
+			return nil, invalidf("bad jitter %q (e.g. 30s, 5m)", s.Jitter)
+		}
+		if ev, ok := sched.(everySchedule); ok && limit >= ev.interval {
+			return nil, invalidf("jitter %s must be shorter than the interval %s", limit, ev.interval)
+		}
+		if limit > 0 {
+			sched = jittered{inner: sched, max: limit, seed: seed}
+		}
+	}
+	return sched, nil
+}
+
+func parseCronExpr(expr, tz string) (cron.Schedule, error) {
+	prefix := ""
+	if tz != "" {
+		prefix = "CRON_TZ=" + tz + " "
+	}
+	sched, err := specParser.Parse(prefix + expr)
+	if err == nil {
+		return sched, nil
+	}
+	if alt, err2 := specParser.Parse(prefix + "0 " + expr); err2 == nil {
+		return alt, nil
+	}
+	return nil, invalidf("bad cron expression %q: %v", expr, err)
+}
+
+var daysRe = regexp.MustCompile(`^(\d+)d(.*)$`)
+
+// parseDuration is time.ParseDuration plus a leading day count ("1d", "2d12h").
+func parseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	var days time.Duration
+	if m := daysRe.FindStringSubmatch(s); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return 0, err
+		}
+		days = time.Duration(n) * 24 * time.Hour
+		if s = m[2]; s == "" {
+			return days, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	return days + d, err
+}
+
+// everySchedule fires on a fixed grid of interval steps, anchored at the
+// Unix epoch in the schedule's timezone plus offset. Steps are exact
+// durations; use a cron expression for wall-clock times across DST changes.
+type everySchedule struct {
+	interval time.Duration
+	anchor   time.Time
+}
+
+func parseEvery(expr, offset string, loc *time.Location) (cron.Schedule, error) {
+	interval, err := parseDuration(expr)
+	if err != nil || interval < time.Second {
+		return nil, invalidf("bad interval %q (e.g. 90s, 30m, 2h, 1d; at least 1s)", expr)
+	}
+	var off time.Duration
+	if offset != "" {
+		if off, err = parseDuration(offset); err != nil || off < 0 || off >= interval {
+			return nil, invalidf("offset %q must be a duration shorter than the interval %s", offset, interval)
+		}
+	}
+	anchor := time.Date(1970, 1, 1, 0, 0, 0, 0, loc).Add(off)
+	return everySchedule{interval: interval, anchor: anchor}, nil
+}
+
+func (s everySchedule) Next(t time.Time) time.Time {
+	if t.Before(s.anchor) {
+		return s.anchor
+	}
+	steps := t.Sub(s.anchor)/s.interval + 1
+	return s.anchor.Add(steps * s.interval)
+}
+
+// atSchedule fires once.
+type atSchedule struct{ at time.Time }
+
+var atLayouts = []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02T15:04:05", "2006-01-02T15:04"}
+
+// parseAt accepts RFC 3339 or a local "YYYY-MM-DD HH:MM[:SS]" in loc.
+func parseAt(expr string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, expr); err == nil {
+		return t, nil
+	}
+	for _, layout := range atLayouts {
+		if t, err := time.ParseInLocation(layout, expr, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, invalidf("bad time %q (want 2006-01-02 15:04 or RFC 3339)", expr)
+}
+
+func (s atSchedule) Next(t time.Time) time.Time {
+	if t.Before(s.at) {
+		return s.at
+	}
+	return time.Time{}
+}
+
+// jittered delays each fire time of inner by a pseudo-random amount below
+// max, derived from seed and the slot so previews match actual runs.
+type jittered struct {
+	inner cron.Schedule
+	max   time.Duration
+	seed  string
+}
+
+func (j jittered) Next(t time.Time) time.Time {
+	for slot := j.inner.Next(t.Add(-j.max)); !slot.IsZero(); slot = j.inner.Next(slot) {
+		if fire := slot.Add(j.delay(slot)); fire.After(t) {
+			return fire
+		}
+	}
+	return time.Time{}
+}
+
+func (j jittered) delay(slot time.Time) time.Duration {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s|%d", j.seed, slot.Unix())
+	return time.Duration(h.Sum64() % uint64(j.max))
+}
@@ -0,0 +1,103 @@
+package cron
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestScheduleKinds(t *testing.T) {
+	from := time.Date(2026, 3, 2, 10, 7, 0, 0, time.UTC)
+
+	runs, err := NextRuns(Schedule{Kind: "every", Expr: "1h", Offset: "15m", TZ: "UTC"}, from, 3)
+	if err != nil || len(runs) != 3 || !runs[0].Equal(time.Date(2026, 3, 2, 10, 15, 0, 0, time.UTC)) || runs[2].Sub(runs[1]) != time.Hour {
+		t.Fatalf("every = %v, %v", runs, err)
+	}
+	if runs, _ := NextRuns(Schedule{Kind: "every", Expr: "1d"}, from, 1); len(runs) != 1 {
+		t.Fatalf("every 1d = %v", runs)
+	}
+
+	runs, err = NextRuns(Schedule{Kind: "at", Expr: "2026-03-02 18:30", TZ: "Asia/Shanghai"}, from, 3)
+	if err != nil || len(runs) != 1 || !runs[0].Equal(time.Date(2026, 3, 2, 10, 30, 0, 0, time.UTC)) {
+		t.Fatalf("at = %v, %v", runs, err)
+	}
+
+	jit := Schedule{Expr: "0 9 * * *", TZ: "UTC", Jitter: "10m"}
+	a, _ := jit.compile("job-a")
+	b, _ := jit.compile("job-a")
+	for i, r := range nextN(a, from, 5) {
+		base := time.Date(2026, 3, 3+i, 9, 0, 0, 0, time.UTC)
+		if r.Before(base) || !r.Before(base.Add(10*time.Minute)) {
+			t.Fatalf("jittered run %v outside [%v, +10m)", r, base)
+		}
+		if !r.Equal(nextN(b, from, 5)[i]) {
+			t.Fatal("jitter not stable for the same job")
+		}
+	}
+
+	for _, bad := range []Schedule{
+		{Expr: "61 * * * *"},
+		{Kind: "every", Expr: "soon"},
+		{Kind: "every", Expr: "1h", Offset: "2h"},
+		{Kind: "every", Expr: "1m", Jitter: "5m"},
+		{Kind: "at", Expr: "tomorrow"},
+		{Kind: "weekly", Expr: "x"},
+		{Expr: "0 9 * * *", TZ: "Mars/Olympus"},
+	} {
+		if _, err := NextRuns(bad, from, 1); !errors.Is(err, ErrInvalidSchedule) {
+			t.Errorf("%+v: err = %v", bad, err)
+		}
+	}
+}
+
+func TestOneShotJob(t *testing.T) {
+	ran := make(chan string, 4)
+	e := NewEngine(t.TempDir(), func(_ context.Context, _, msg string) (string, error) {
+		ran <- msg
+		return "ok", nil
+	})
+	if err := e.Load(); err != nil {
+		t.Fatal(err)
+	}
+	e.Start()
+	defer e.Stop()
+
+	past := Schedule{Kind: "at", Expr: time.Now().Add(-time.Minute).Format(time.RFC3339)}
+	if err := e.Add(&Job{Name: "late", Enabled: true, Schedule: past}); !errors.Is(err, ErrInvalidSchedule) {
+		t.Fatalf("past at job: %v", err)
+	}
+
+	soon := Schedule{Kind: "at", Expr: time.Now().Add(1500 * time.Millisecond).Format(time.RFC3339)}
+	keep := &Job{Name: "keep", Enabled: true, Schedule: soon, Payload: Payload{Message: "keep"}}
+	drop := &Job{Name: "drop", Enabled: true, Schedule: soon, Payload: Payload{Message: "drop"}, DeleteAfterRun: true}
+	if err := e.Add(keep); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Add(drop); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Update(keep.ID, &Job{Enabled: true, Schedule: Schedule{Kind: "every", Expr: "nope"}}); !errors.Is(err, ErrInvalidSchedule) {
+		t.Fatalf("update with bad schedule: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-ran:
+		case <-time.After(5 * time.Second):
+			t.Fatal("one-shot jobs did not fire")
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		j, ok := e.Get(keep.ID)
+		_, dropped := e.Get(drop.ID)
+		if ok && !j.Enabled && !dropped {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("after firing: keep=%+v dropStillThere=%v", j, dropped)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,160 @@
+// Package datastore gives every agent a small persistent key-value store and
+// an embedded SQLite scratch database, both bounded by size quotas.
+//
+// Layout: <agentsDir>/<agentID>/data/kv.json and .../data/scratch.db.
+package datastore
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits bounds what one agent may store. Zero values use the defaults.
+type Limits struct {
+	MaxKVKeys     int           // default 10000
+	MaxKVBytes    int64         // total size of keys+values (default 5 MiB)
+	MaxValueBytes int64         // single value (default 256 KiB)
+	MaxDBBytes    int64         // SQLite file size (default 100 MiB)
+	QueryTimeout  time.Duration // per sql_query call (default 10s)
+}
+
+func (l Limits) withDefaults() Limits {
+	if l.MaxKVKeys <= 0 {
+		l.MaxKVKeys = 10000
+	}
+	if l.MaxKVBytes <= 0 {
+		l.MaxKVBytes = 5 << 20
+	}
+	if l.MaxValueBytes <= 0 {
+		l.MaxValueBytes = 256 << 10
+	}
+	if l.MaxDBBytes <= 0 {
+		l.MaxDBBytes = 100 << 20
+	}
+	if l.QueryTimeout <= 0 {
+		l.QueryTimeout = 10 * time.Second
+	}
+	return l
+}
+
+// Manager hands out one Store per agent and keeps it open for reuse.
+type Manager struct {
+	root   string // agents directory
+	limits Limits
+	mu     sync.Mutex
+	stores map[string]*Store
+}
+
+// NewManager creates a Manager for agents stored under agentsDir.
+func NewManager(agentsDir string, limits Limits) *Manager {
+	return &Manager{root: agentsDir, limits: limits.withDefaults(), stores: make(map[string]*Store)}
+}
+
+// Limits returns the effective quotas.
+func (m *Manager) Limits() Limits {
+	return m.limits
+}
+
+// Get returns the store of an agent, creating its directory on first use.
+func (m *Manager) Get(agentID string) (*Store, error) {
+	if agentID == "" || strings.ContainsAny(agentID, `/\`) || agentID == "." || agentID == ".." {
+		return nil, fmt.Errorf("invalid agent id %q", agentID)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.stores[agentID]; ok {
+		return s, nil
+	}
+	dir := filepath.Join(m.root, agentID, "data")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &Store{dir: dir, limits: m.limits}
+	if err := s.loadKV(); err != nil {
+		return nil, err
+	}
+	m.stores[agentID] = s
+	return s, nil
+}
+
+// Close releases an agent's store, e.g. before the agent is deleted.
+func (m *Manager) Close(agentID string) {
+	m.mu.Lock()
+	s, ok := m.stores[agentID]
+	delete(m.stores, agentID)
+	m.mu.Unlock()
+	if ok {
+		s.close()
+	}
+}
+
+// CloseAll releases every open store; call on server exit.
+func (m *Manager) CloseAll() {
+	m.mu.Lock()
+	stores := m.stores
+	m.stores = make(map[string]*Store)
+	m.mu.Unlock()
+	for _, s := range stores {
+		s.close()
+	}
+}
+
+// Store is one agent's KV map and SQLite database.
+type Store struct {
+	dir    string
+	limits Limits
+
+	kvMu    sync.Mutex
+	kv      map[string]*KVEntry
+	kvBytes int64
+
+	dbMu sync.Mutex
+	rw   *sql.DB // opened lazily
+	ro   *sql.DB // query_only connection for read-only queries
+}
+
+// Usage reports how much of the quotas an agent uses.
+type Usage struct {
+	KVKeys        int   `json:"kvKeys"`
+	KVBytes       int64 `json:"kvBytes"`
+	DBBytes       int64 `json:"dbBytes"`
+	MaxKVKeys     int   `json:"maxKvKeys"`
+	MaxKVBytes    int64 `json:"maxKvBytes"`
+	MaxValueBytes int64 `json:"maxValueBytes"`
+	MaxDBBytes    int64 `json:"maxDbBytes"`
+}
+
+// Usage returns current sizes and limits.
+func (s *Store) Usage() Usage {
+	s.kvMu.Lock()
+	s.purgeExpiredLocked()
+	keys, bytes := len(s.kv), s.kvBytes
+	s.kvMu.Unlock()
+	return Usage{
+		KVKeys:        keys,
+		KVBytes:       bytes,
+		DBBytes:       s.dbSize(),
+		MaxKVKeys:     s.limits.MaxKVKeys,
+		MaxKVBytes:    s.limits.MaxKVBytes,
+		MaxValueBytes: s.limits.MaxValueBytes,
+		MaxDBBytes:    s.limits.MaxDBBytes,
+	}
+}
+
+func (s *Store) close() {
+	s.dbMu.Lock()
+	defer s.dbMu.Unlock()
+	if s.rw != nil {
+		_ = s.rw.Close()
+		s.rw = nil
+	}
+	if s.ro != nil {
+		_ = s.ro.Close()
+		s.ro = nil
+	}
+}
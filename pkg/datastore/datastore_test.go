@@ -0,0 +1,94 @@
+package datastore
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestKV(t *testing.T) {
+	dir := t.TempDir()
+	m := NewManager(dir, Limits{MaxKVKeys: 2})
+	s, err := m.Get("a1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.KVSet("user:lang", json.RawMessage(`"zh"`), 0); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.KVIncr("counter", 2); err != nil || n != 2 {
+		t.Fatalf("KVIncr = %v, %v", n, err)
+	}
+	if _, err := s.KVSet("third", json.RawMessage(`1`), 0); err == nil {
+		t.Fatal("expected key limit error")
+	}
+	if _, err := s.KVSet("bad", json.RawMessage(`{`), 0); err == nil {
+		t.Fatal("expected invalid JSON error")
+	}
+
+	// Reload from disk through a fresh manager.
+	s2, err := NewManager(dir, Limits{}).Get("a1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, ok := s2.KVGet("user:lang")
+	if !ok || string(e.Value) != `"zh"` {
+		t.Fatalf("KVGet after reload = %v, %v", e, ok)
+	}
+	if got := s2.KVList("user:"); len(got) != 1 {
+		t.Fatalf("KVList(user:) = %d entries", len(got))
+	}
+	if ok, _ := s2.KVDelete("counter"); !ok {
+		t.Fatal("KVDelete should report existing key")
+	}
+}
+
+func TestSQL(t *testing.T) {
+	m := NewManager(t.TempDir(), Limits{})
+	defer m.CloseAll()
+	s, _ := m.Get("a1")
+	ctx := context.Background()
+
+	if _, err := s.Query(ctx, `CREATE TABLE seen (id TEXT PRIMARY KEY, n INTEGER); INSERT INTO seen VALUES ('x', 1), ('y', 2)`, nil, false, 0); err != nil {
+		t.Fatal(err)
+	}
+	res, err := s.Query(ctx, `SELECT id, n FROM seen WHERE n > ? ORDER BY id`, []any{0}, true, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Rows) != 1 || res.Rows[0][0] != "x" || !res.Truncated {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	if _, err := s.Query(ctx, `DELETE FROM seen`, nil, true, 0); err == nil {
+		t.Fatal("read-only query should reject writes")
+	}
+
+	for _, q := range []string{
+		`ATTACH DATABASE '/etc/passwd' AS x`,
+		`VACUUM INTO '/tmp/x.db'`,
+		`PRAGMA max_page_count = 1000000`,
+		`SELECT * FROM pragma_max_page_count(1000000)`,
+		`/* hi */ pragma   main.page_size=65536`,
+	} {
+		if err := CheckSQL(q); err == nil {
+			t.Errorf("CheckSQL(%q) should fail", q)
+		}
+	}
+	if err := CheckSQL(`SELECT 'attach', "vacuum" FROM t -- pragma x`); err != nil {
+		t.Errorf("quoted keywords should be allowed: %v", err)
+	}
+
+	tables, err := s.Tables(ctx)
+	if err != nil || len(tables) != 1 || tables[0].Rows != 2 {
+		t.Fatalf("Tables = %+v, %v", tables, err)
+	}
+	dest := filepath.Join(t.TempDir(), "export.db")
+	if err := s.Backup(ctx, dest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Query(ctx, `ATTACH DATABASE '`+dest+`' AS x`, nil, false, 0); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Fatalf("ATTACH should stay blocked after backup, got %v", err)
+	}
+}
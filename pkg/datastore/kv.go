@@ -0,0 +1,224 @@
+package datastore
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// maxKeyLen bounds key length in bytes.
+const maxKeyLen = 256
+
+// KVEntry is one stored value. Value is arbitrary JSON.
+type KVEntry struct {
+	Key       string          `json:"key"`
+	Value     json.RawMessage `json:"value"`
+	UpdatedAt int64           `json:"updatedAt"`           // unix ms
+	ExpiresAt int64           `json:"expiresAt,omitempty"` // unix ms; 0 = never
+}
+
+func (e *KVEntry) expired(now int64) bool {
+	return e.ExpiresAt > 0 && e.ExpiresAt <= now
+}
+
+func (e *KVEntry) size() int64 {
+	return int64(len(e.Key) + len(e.Value))
+}
+
+func (s *Store) kvPath() string {
+	return filepath.Join(s.dir, "kv.json")
+}
+
+func (s *Store) loadKV() error {
+	s.kv = make(map[string]*KVEntry)
+	data, err := os.ReadFile(s.kvPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var list []*KVEntry
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("corrupt %s: %w", s.kvPath(), err)
+	}
+	for _, e := range list {
+		s.kv[e.Key] = e
+		s.kvBytes += e.size()
+	}
+	return nil
+}
+
+// saveKVLocked writes the whole map atomically; caller holds kvMu.
+func (s *Store) saveKVLocked() error {
+	list := make([]*KVEntry, 0, len(s.kv))
+	for _, e := range s.kv {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	data, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	tmp := s.kvPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.kvPath())
+}
+
+func (s *Store) purgeExpiredLocked() bool {
+	now := time.Now().UnixMilli()
+	purged := false
+	for k, e := range s.kv {
+		if e.expired(now) {
+			s.kvBytes -= e.size()
+			delete(s.kv, k)
+			purged = true
+		}
+	}
+	return purged
+}
+
+// ValidateKey checks a key is non-empty, printable and not too long.
+func ValidateKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	if len(key) > maxKeyLen {
+		return fmt.Errorf("key longer than %d bytes", maxKeyLen)
+	}
+	for _, r := range key {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("key contains control characters")
+		}
+	}
+	return nil
+}
+
+// KVGet returns a live entry.
+func (s *Store) KVGet(key string) (*KVEntry, bool) {
+	s.kvMu.Lock()
+	defer s.kvMu.Unlock()
+	e, ok := s.kv[key]
+	if !ok || e.expired(time.Now().UnixMilli()) {
+		return nil, false
+	}
+	cp := *e
+	return &cp, true
+}
+
+// KVSet stores a JSON value; ttl > 0 makes it expire.
+func (s *Store) KVSet(key string, value json.RawMessage, ttl time.Duration) (*KVEntry, error) {
+	if err := ValidateKey(key); err != nil {
+		return nil, err
+	}
+	if !json.Valid(value) {
+		return nil, fmt.Errorf("value is not valid JSON")
+	}
+	if int64(len(value)) > s.limits.MaxValueBytes {
+		return nil, fmt.Errorf("value is %d bytes, limit is %d", len(value), s.limits.MaxValueBytes)
+	}
+	s.kvMu.Lock()
+	defer s.kvMu.Unlock()
+	return s.putLocked(key, value, ttl)
+}
+
+// KVIncr adds delta to a numeric value (missing keys start at 0) and
+// returns the new value. The existing TTL is kept.
+func (s *Store) KVIncr(key string, delta float64) (float64, error) {
+	if err := ValidateKey(key); err != nil {
+		return 0, err
+	}
+	s.kvMu.Lock()
+	defer s.kvMu.Unlock()
+	var cur float64
+	var ttl time.Duration
+	if e, ok := s.kv[key]; ok && !e.expired(time.Now().UnixMilli()) {
+		if err := json.Unmarshal(e.Value, &cur); err != nil {
+			return 0, fmt.Errorf("value of %q is not a number", key)
+		}
+		if e.ExpiresAt > 0 {
+			ttl = time.Until(time.UnixMilli(e.ExpiresAt))
+		}
+	}
+	cur += delta
+	if _, err := s.putLocked(key, json.RawMessage(strconv.FormatFloat(cur, 'f', -1, 64)), ttl); err != nil {
+		return 0, err
+	}
+	return cur, nil
+}
+
+func (s *Store) putLocked(key string, value json.RawMessage, ttl time.Duration) (*KVEntry, error) {
+	s.purgeExpiredLocked()
+	e := &KVEntry{Key: key, Value: append(json.RawMessage(nil), value...), UpdatedAt: time.Now().UnixMilli()}
+	if ttl > 0 {
+		e.ExpiresAt = time.Now().Add(ttl).UnixMilli()
+	}
+	old, exists := s.kv[key]
+	newBytes := s.kvBytes + e.size()
+	if exists {
+		newBytes -= old.size()
+	} else if len(s.kv) >= s.limits.MaxKVKeys {
+		return nil, fmt.Errorf("key limit reached (%d keys); delete unused keys first", s.limits.MaxKVKeys)
+	}
+	if newBytes > s.limits.MaxKVBytes {
+		return nil, fmt.Errorf("store size limit reached (%d KB); delete unused keys first", s.limits.MaxKVBytes>>10)
+	}
+	prevBytes := s.kvBytes
+	s.kv[key] = e
+	s.kvBytes = newBytes
+	if err := s.saveKVLocked(); err != nil {
+		// Roll back so memory matches disk.
+		if exists {
+			s.kv[key] = old
+		} else {
+			delete(s.kv, key)
+		}
+		s.kvBytes = prevBytes
+		return nil, err
+	}
+	cp := *e
+	return &cp, nil
+}
+
+// KVDelete removes a key and reports whether it existed.
+func (s *Store) KVDelete(key string) (bool, error) {
+	s.kvMu.Lock()
+	defer s.kvMu.Unlock()
+	e, ok := s.kv[key]
+	if !ok {
+		return false, nil
+	}
+	delete(s.kv, key)
+	s.kvBytes -= e.size()
+	if err := s.saveKVLocked(); err != nil {
+		s.kv[key] = e
+		s.kvBytes += e.size()
+		return false, err
+	}
+	return !e.expired(time.Now().UnixMilli()), nil
+}
+
+// KVList returns live entries whose key starts with prefix, sorted by key.
+func (s *Store) KVList(prefix string) []KVEntry {
+	s.kvMu.Lock()
+	defer s.kvMu.Unlock()
+	if s.purgeExpiredLocked() {
+		_ = s.saveKVLocked()
+	}
+	out := make([]KVEntry, 0, len(s.kv))
+	for k, e := range s.kv {
+		if strings.HasPrefix(k, prefix) {
+			out = append(out, *e)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
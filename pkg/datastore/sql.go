@@ -0,0 +1,318 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqlitePageSize is the page size used to turn MaxDBBytes into max_page_count.
+const sqlitePageSize = 4096
+
+// Result is the outcome of one Query call.
+type Result struct {
+	Columns      []string `json:"columns,omitempty"`
+	Rows         [][]any  `json:"rows,omitempty"`
+	RowsAffected int64    `json:"rowsAffected"`
+	Truncated    bool     `json:"truncated"` // more rows than maxRows
+	IsQuery      bool     `json:"isQuery"`   // statement returned rows
+}
+
+// TableInfo describes one table in the scratch database.
+type TableInfo struct {
+	Name string `json:"name"`
+	SQL  string `json:"sql"`
+	Rows int64  `json:"rows"`
+}
+
+func (s *Store) dbPath() string {
+	return filepath.Join(s.dir, "scratch.db")
+}
+
+func (s *Store) dbSize() int64 {
+	var total int64
+	for _, suffix := range []string{"", "-wal", "-journal"} {
+		if fi, err := os.Stat(s.dbPath() + suffix); err == nil {
+			total += fi.Size()
+		}
+	}
+	return total
+}
+
+// db returns the read-write or query-only handle, opening both on first use.
+func (s *Store) db(readOnly bool) (*sql.DB, error) {
+	s.dbMu.Lock()
+	defer s.dbMu.Unlock()
+	if s.rw == nil {
+		maxPages := s.limits.MaxDBBytes / sqlitePageSize
+		rw, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(wal)&_pragma=max_page_count(%d)", s.dbPath(), maxPages))
+		if err != nil {
+			return nil, err
+		}
+		rw.SetMaxOpenConns(1) // one writer; SQLite serialises writes anyway
+		ro, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=query_only(1)", s.dbPath()))
+		if err != nil {
+			rw.Close()
+			return nil, err
+		}
+		s.rw, s.ro = rw, ro
+	}
+	if readOnly {
+		return s.ro, nil
+	}
+	return s.rw, nil
+}
+
+// Query runs one SQL statement (or a script of non-query statements) and
+// returns at most maxRows rows. readOnly rejects any write.
+func (s *Store) Query(ctx context.Context, query string, args []any, readOnly bool, maxRows int) (*Result, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, fmt.Errorf("sql is required")
+	}
+	if err := CheckSQL(query); err != nil {
+		return nil, err
+	}
+	db, err := s.db(readOnly)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.limits.QueryTimeout)
+	defer cancel()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	// No ATTACH: the agent must not reach files outside its own database.
+	if _, err := sqlite.Limit(conn, sqlite3.SQLITE_LIMIT_ATTACHED, 0); err != nil {
+		return nil, err
+	}
+
+	if !returnsRows(query) {
+		res, err := conn.ExecContext(ctx, query, args...)
+		if err != nil {
+			return nil, friendlySQLError(err, ctx)
+		}
+		n, _ := res.RowsAffected()
+		return &Result{RowsAffected: n}, nil
+	}
+
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, friendlySQLError(err, ctx)
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	out := &Result{Columns: cols, IsQuery: true}
+	for rows.Next() {
+		if maxRows > 0 && len(out.Rows) >= maxRows {
+			out.Truncated = true
+			break
+		}
+		vals := make([]any, len(cols))
+		ptrs := make([]any, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		for i, v := range vals {
+			vals[i] = displayValue(v)
+		}
+		out.Rows = append(out.Rows, vals)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, friendlySQLError(err, ctx)
+	}
+	return out, nil
+}
+
+// Tables lists user tables with their schema and row counts.
+func (s *Store) Tables(ctx context.Context) ([]TableInfo, error) {
+	if _, err := os.Stat(s.dbPath()); os.IsNotExist(err) {
+		return []TableInfo{}, nil
+	}
+	res, err := s.Query(ctx, `SELECT name, sql FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name`, nil, true, 0)
+	if err != nil {
+		return nil, err
+	}
+	tables := make([]TableInfo, 0, len(res.Rows))
+	for _, row := range res.Rows {
+		t := TableInfo{Name: fmt.Sprint(row[0]), SQL: fmt.Sprint(row[1])}
+		if cnt, err := s.Query(ctx, fmt.Sprintf(`SELECT COUNT(*) FROM "%s"`, strings.ReplaceAll(t.Name, `"`, `""`)), nil, true, 1); err == nil && len(cnt.Rows) == 1 {
+			if n, ok := cnt.Rows[0][0].(int64); ok {
+				t.Rows = n
+			}
+		}
+		tables = append(tables, t)
+	}
+	return tables, nil
+}
+
+// Backup writes a consistent copy of the database to dest (used for export).
+func (s *Store) Backup(ctx context.Context, dest string) error {
+	if _, err := os.Stat(s.dbPath()); os.IsNotExist(err) {
+		return fmt.Errorf("no database yet")
+	}
+	db, err := s.db(false)
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// VACUUM INTO attaches the destination internally; Query resets the limit.
+	if _, err := sqlite.Limit(conn, sqlite3.SQLITE_LIMIT_ATTACHED, 1); err != nil {
+		return err
+	}
+	_ = os.Remove(dest)
+	_, err = conn.ExecContext(ctx, "VACUUM INTO ?", dest)
+	return err
+}
+
+func friendlySQLError(err error, ctx context.Context) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("query timed out")
+	}
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "database or disk is full"):
+		return fmt.Errorf("database size limit reached; delete data or drop tables first")
+	case strings.Contains(msg, "attempt to write a readonly database"):
+		return fmt.Errorf("read-only mode: write statements are not allowed")
+	}
+	return err
+}
+
+// displayValue converts driver values to JSON/Markdown friendly types.
+func displayValue(v any) any {
+	switch x := v.(type) {
+	case []byte:
+		if utf8.Valid(x) {
+			return string(x)
+		}
+		return fmt.Sprintf("<blob %d bytes>", len(x))
+	case time.Time:
+		return x.Format(time.RFC3339)
+	}
+	return v
+}
+
+// returnsRows reports whether a statement produces a result set.
+func returnsRows(query string) bool {
+	words := sqlWords(query)
+	if len(words) == 0 {
+		return false
+	}
+	switch words[0] {
+	case "SELECT", "WITH", "VALUES", "EXPLAIN", "PRAGMA":
+		return true
+	}
+	for _, w := range words {
+		if w == "RETURNING" {
+			return true
+		}
+	}
+	return false
+}
+
+// readOnlyPragmas may be used; all other PRAGMAs could lift the size quota
+// or otherwise escape the sandbox.
+var readOnlyPragmas = map[string]bool{
+	"TABLE_INFO": true, "TABLE_XINFO": true, "TABLE_LIST": true, "INDEX_LIST": true,
+	"INDEX_INFO": true, "INDEX_XINFO": true, "FOREIGN_KEY_LIST": true, "FOREIGN_KEY_CHECK": true,
+	"PAGE_COUNT": true, "FREELIST_COUNT": true, "INTEGRITY_CHECK": true,
+	"QUICK_CHECK": true, "USER_VERSION": true,
+}
+
+// CheckSQL rejects statements that could reach outside the agent's database
+// (ATTACH, VACUUM INTO, extensions) or change connection limits (PRAGMA).
+func CheckSQL(query string) error {
+	words := sqlWords(query)
+	for i, w := range words {
+		switch w {
+		case "ATTACH", "DETACH", "VACUUM", "LOAD_EXTENSION":
+			return fmt.Errorf("%s is not allowed", w)
+		case "PRAGMA":
+			if i+1 >= len(words) || !readOnlyPragmas[words[i+1]] {
+				return fmt.Errorf("only informational PRAGMAs are allowed (e.g. table_info)")
+			}
+		default:
+			// Table-valued pragma functions, e.g. pragma_table_info('t').
+			if name, ok := strings.CutPrefix(w, "PRAGMA_"); ok && !readOnlyPragmas[name] {
+				return fmt.Errorf("%s is not allowed", strings.ToLower(w))
+			}
+		}
+	}
+	return nil
+}
+
+// sqlWords returns the upper-cased keywords/identifiers of a statement,
+// skipping comments and quoted strings/identifiers. "schema.name" yields
+// only "name" so "PRAGMA main.table_info" is checked like "PRAGMA table_info".
+func sqlWords(q string) []string {
+	var words []string
+	rs := []rune(q)
+	for i := 0; i < len(rs); {
+		c := rs[i]
+		switch {
+		case c == '-' && i+1 < len(rs) && rs[i+1] == '-':
+			for i < len(rs) && rs[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(rs) && rs[i+1] == '*':
+			i += 2
+			for i+1 < len(rs) && !(rs[i] == '*' && rs[i+1] == '/') {
+				i++
+			}
+			i += 2
+		case c == '\'' || c == '"' || c == '`' || c == '[':
+			end := c
+			if c == '[' {
+				end = ']'
+			}
+			i++
+			for i < len(rs) {
+				if rs[i] == end {
+					if end != ']' && i+1 < len(rs) && rs[i+1] == end { // doubled quote escape
+						i += 2
+						continue
+					}
+					break
+				}
+				i++
+			}
+			i++
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(rs) && (unicode.IsLetter(rs[i]) || unicode.IsDigit(rs[i]) || rs[i] == '_' || rs[i] == '$') {
+				i++
+			}
+			w := strings.ToUpper(string(rs[start:i]))
+			if len(words) > 0 && start > 0 && rs[start-1] == '.' {
+				words[len(words)-1] = w
+			} else {
+				words = append(words, w)
+			}
+		default:
+			i++
+		}
+	}
+	return words
+}
@@ -0,0 +1,320 @@
+// Package document extracts readable Markdown (text and tables) from PDF,
+// DOCX, XLSX and PPTX files. It is pure Go so it works on any host without
+// poppler, LibreOffice or Python.
+package document
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Format identifies a supported document type.
+type Format string
+
+const (
+	FormatPDF  Format = "pdf"
+	FormatDOCX Format = "docx"
+	FormatXLSX Format = "xlsx"
+	FormatPPTX Format = "pptx"
+)
+
+// MIME types of the supported formats.
+const (
+	MimePDF  = "application/pdf"
+	MimeDOCX = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	MimeXLSX = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	MimePPTX = "application/vnd.openxmlformats-officedocument.presentationml.presentation"
+)
+
+// MaxFileSize is the largest document Extract accepts.
+const MaxFileSize = 50 << 20
+
+// Page is one addressable unit of a document: a PDF page, a worksheet,
+// a slide, or a page-break delimited part of a Word document.
+type Page struct {
+	Number   int    `json:"number"`
+	Title    string `json:"title"`
+	Markdown string `json:"markdown"`
+}
+
+// Document is the extraction result.
+type Document struct {
+	Format     Format `json:"format"`
+	TotalPages int    `json:"totalPages"`
+	Pages      []Page `json:"pages"`     // only the selected pages
+	Truncated  bool   `json:"truncated"` // MaxChars cut the output short
+}
+
+// Options controls what Extract returns.
+type Options struct {
+	// Pages selects pages, e.g. "1-3,5"; empty means all.
+	Pages string
+	// MaxChars caps the total Markdown length (0 = unlimited).
+	MaxChars int
+}
+
+// DetectFormat maps a file name and/or MIME type to a Format.
+// It returns "" for unsupported files.
+func DetectFormat(fileName, contentType string) Format {
+	ct := strings.ToLower(strings.TrimSpace(contentType))
+	if i := strings.Index(ct, ";"); i >= 0 {
+		ct = strings.TrimSpace(ct[:i])
+	}
+	switch ct {
+	case MimePDF:
+		return FormatPDF
+	case MimeDOCX:
+		return FormatDOCX
+	case MimeXLSX:
+		return FormatXLSX
+	case MimePPTX:
+		return FormatPPTX
+	}
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".pdf":
+		return FormatPDF
+	case ".docx":
+		return FormatDOCX
+	case ".xlsx", ".xlsm":
+		return FormatXLSX
+	case ".pptx":
+		return FormatPPTX
+	}
+	return ""
+}
+
+// MimeType returns the canonical MIME type of a format.
+func (f Format) MimeType() string {
+	switch f {
+	case FormatPDF:
+		return MimePDF
+	case FormatDOCX:
+		return MimeDOCX
+	case FormatXLSX:
+		return MimeXLSX
+	case FormatPPTX:
+		return MimePPTX
+	}
+	return "application/octet-stream"
+}
+
+// ExtractFile reads and extracts a document from disk; the format is
+// detected from the file extension.
+func ExtractFile(path string, opts Options) (*Document, error) {
+	format := DetectFormat(path, "")
+	if format == "" {
+		return nil, fmt.Errorf("unsupported document type: %s", filepath.Ext(path))
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > MaxFileSize {
+		return nil, fmt.Errorf("document too large (%d MB, max %d MB)", info.Size()>>20, MaxFileSize>>20)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Extract(data, format, opts)
+}
+
+// Extract converts document bytes of the given format to Markdown pages.
+func Extract(data []byte, format Format, opts Options) (*Document, error) {
+	if len(data) > MaxFileSize {
+		return nil, fmt.Errorf("document too large (%d MB, max %d MB)", len(data)>>20, MaxFileSize>>20)
+	}
+	var (
+		doc *Document
+		err error
+	)
+	switch format {
+	case FormatPDF:
+		doc, err = extractPDF(data, opts.Pages)
+	case FormatDOCX:
+		doc, err = extractDOCX(data)
+	case FormatXLSX:
+		doc, err = extractXLSX(data)
+	case FormatPPTX:
+		doc, err = extractPPTX(data)
+	default:
+		return nil, fmt.Errorf("unsupported document format %q", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("extract %s: %w", format, err)
+	}
+	doc.Format = format
+
+	// PDF selects pages while parsing; everything else is filtered here.
+	if format != FormatPDF && opts.Pages != "" {
+		sel, err := ParsePageRange(opts.Pages, doc.TotalPages)
+		if err != nil {
+			return nil, err
+		}
+		keep := make(map[int]bool, len(sel))
+		for _, n := range sel {
+			keep[n] = true
+		}
+		pages := doc.Pages[:0]
+		for _, p := range doc.Pages {
+			if keep[p.Number] {
+				pages = append(pages, p)
+			}
+		}
+		doc.Pages = pages
+	}
+	if opts.MaxChars > 0 {
+		doc.truncate(opts.MaxChars)
+	}
+	return doc, nil
+}
+
+// Markdown renders the selected pages as one Markdown string, each page
+// introduced by a "## <title>" heading when the document has several.
+func (d *Document) Markdown() string {
+	var sb strings.Builder
+	for i, p := range d.Pages {
+		if i > 0 {
+			sb.WriteString("\n\n")
+		}
+		if d.TotalPages > 1 && p.Title != "" {
+			sb.WriteString("## " + p.Title + "\n\n")
+		}
+		sb.WriteString(p.Markdown)
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// Empty reports whether no text was extracted (e.g. a scanned PDF).
+func (d *Document) Empty() bool {
+	for _, p := range d.Pages {
+		if strings.TrimSpace(p.Markdown) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// PageNumbers returns the numbers of the selected pages.
+func (d *Document) PageNumbers() []int {
+	nums := make([]int, len(d.Pages))
+	for i, p := range d.Pages {
+		nums[i] = p.Number
+	}
+	return nums
+}
+
+func (d *Document) truncate(maxChars int) {
+	used := 0
+	for i := range d.Pages {
+		n := utf8.RuneCountInString(d.Pages[i].Markdown)
+		if used+n <= maxChars {
+			used += n
+			continue
+		}
+		d.Truncated = true
+		rest := maxChars - used
+		if rest <= 0 {
+			d.Pages = d.Pages[:i]
+			return
+		}
+		runes := []rune(d.Pages[i].Markdown)
+		d.Pages[i].Markdown = string(runes[:rest]) + "\n…"
+		d.Pages = d.Pages[:i+1]
+		return
+	}
+}
+
+// ParsePageRange parses a page selection such as "1-3,5,8-" against a
+// document with total pages. The result is sorted and de-duplicated.
+func ParsePageRange(spec string, total int) ([]int, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		all := make([]int, total)
+		for i := range all {
+			all[i] = i + 1
+		}
+		return all, nil
+	}
+	seen := make(map[int]bool)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		lo, hi := part, part
+		if i := strings.Index(part, "-"); i >= 0 {
+			lo, hi = strings.TrimSpace(part[:i]), strings.TrimSpace(part[i+1:])
+		}
+		from, to := 1, total
+		var err error
+		if lo != "" {
+			if from, err = strconv.Atoi(lo); err != nil {
+				return nil, fmt.Errorf("invalid page range %q", part)
+			}
+		}
+		if hi != "" {
+			if to, err = strconv.Atoi(hi); err != nil {
+				return nil, fmt.Errorf("invalid page range %q", part)
+			}
+		}
+		if from < 1 || from > to {
+			return nil, fmt.Errorf("invalid page range %q", part)
+		}
+		if from > total {
+			return nil, fmt.Errorf("page %d out of range (document has %d pages)", from, total)
+		}
+		if to > total {
+			to = total
+		}
+		for n := from; n <= to; n++ {
+			seen[n] = true
+		}
+	}
+	if len(seen) == 0 {
+		return nil, fmt.Errorf("invalid page range %q", spec)
+	}
+	pages := make([]int, 0, len(seen))
+	for n := range seen {
+		pages = append(pages, n)
+	}
+	sort.Ints(pages)
+	return pages, nil
+}
+
+// MarkdownTable renders rows as a Markdown pipe table; the first row is the header.
+func MarkdownTable(rows [][]string) string {
+	if len(rows) == 0 {
+		return ""
+	}
+	cols := 0
+	for _, r := range rows {
+		if len(r) > cols {
+			cols = len(r)
+		}
+	}
+	var sb strings.Builder
+	line := func(r []string) {
+		sb.WriteString("|")
+		for i := 0; i < cols; i++ {
+			cell := ""
+			if i < len(r) {
+				cell = strings.ReplaceAll(r[i], "\n", " ")
+				cell = strings.ReplaceAll(cell, "|", `\|`)
+			}
+			sb.WriteString(" " + cell + " |")
+		}
+		sb.WriteString("\n")
+	}
+	line(rows[0])
+	sb.WriteString("|" + strings.Repeat(" --- |", cols) + "\n")
+	for _, r := range rows[1:] {
+		line(r)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
@@ -0,0 +1,152 @@
+package document
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func zipParts(t *testing.T, parts map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range parts {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(body))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// minimalPDF builds a PDF with one line of text per page and a valid xref table.
+func minimalPDF(pages ...string) []byte {
+	var objs []string
+	n := len(pages)
+	kids := make([]string, n)
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	objs = append(objs,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), n),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	)
+	for i, text := range pages {
+		stream := fmt.Sprintf("BT /F1 12 Tf 72 720 Td (%s) Tj ET", text)
+		objs = append(objs,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", 5+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream),
+		)
+	}
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objs))
+	for i, o := range objs {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objs)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objs)+1, xref)
+	return buf.Bytes()
+}
+
+func TestExtractFormats(t *testing.T) {
+	docx := zipParts(t, map[string]string{
+		"word/document.xml": `<w:document xmlns:w="w"><w:body>
+			<w:p><w:pPr><w:pStyle w:val="Heading1"/></w:pPr><w:r><w:t>Contract</w:t></w:r></w:p>
+			<w:p><w:r><w:t xml:space="preserve">Party A </w:t></w:r><w:r><w:t>pays.</w:t></w:r></w:p>
+			<w:tbl><w:tr><w:tc><w:p><w:r><w:t>Item</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>Price</w:t></w:r></w:p></w:tc></w:tr>
+			<w:tr><w:tc><w:p><w:r><w:t>Desk</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>100</w:t></w:r></w:p></w:tc></w:tr></w:tbl>
+			<w:p><w:r><w:br w:type="page"/><w:t>Signatures</w:t></w:r></w:p>
+		</w:body></w:document>`,
+	})
+	xlsx := zipParts(t, map[string]string{
+		"xl/workbook.xml":            `<workbook xmlns:r="r"><sheets><sheet name="Q1" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships><Relationship Id="rId1" Target="worksheets/sheet1.xml"/></Relationships>`,
+		"xl/sharedStrings.xml":       `<sst><si><t>Name</t></si><si><t>Date</t></si><si><t>Alice</t></si></sst>`,
+		"xl/styles.xml":              `<styleSheet><cellXfs><xf numFmtId="0"/><xf numFmtId="14"/></cellXfs></styleSheet>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData>
+			<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c></row>
+			<row r="3"><c r="A3" t="s"><v>2</v></c><c r="B3" s="1"><v>45292</v></c></row>
+		</sheetData></worksheet>`,
+	})
+	pptx := zipParts(t, map[string]string{
+		"ppt/presentation.xml":            `<p:presentation xmlns:p="p" xmlns:r="r"><p:sldIdLst><p:sldId r:id="rId2"/><p:sldId r:id="rId1"/></p:sldIdLst></p:presentation>`,
+		"ppt/_rels/presentation.xml.rels": `<Relationships><Relationship Id="rId1" Target="slides/slide1.xml"/><Relationship Id="rId2" Target="slides/slide2.xml"/></Relationships>`,
+		"ppt/slides/slide1.xml":           `<p:sld xmlns:p="p" xmlns:a="a"><p:sp><p:txBody><a:p><a:r><a:t>Second</a:t></a:r></a:p></p:txBody></p:sp></p:sld>`,
+		"ppt/slides/slide2.xml": `<p:sld xmlns:p="p" xmlns:a="a">
+			<p:sp><p:nvSpPr><p:nvPr><p:ph type="title"/></p:nvPr></p:nvSpPr><p:txBody><a:p><a:r><a:t>Roadmap</a:t></a:r></a:p></p:txBody></p:sp>
+			<p:sp><p:txBody><a:p><a:r><a:t>Ship v2</a:t></a:r></a:p></p:txBody></p:sp></p:sld>`,
+	})
+
+	tests := []struct {
+		name   string
+		data   []byte
+		format Format
+		opts   Options
+		pages  int
+		want   []string
+		reject []string
+	}{
+		{"docx", docx, FormatDOCX, Options{}, 2,
+			[]string{"# Contract", "Party A pays.", "| Item | Price |", "| Desk | 100 |", "## 第 2 页\n\nSignatures"}, nil},
+		{"docx page range", docx, FormatDOCX, Options{Pages: "2"}, 2,
+			[]string{"Signatures"}, []string{"Contract"}},
+		{"xlsx", xlsx, FormatXLSX, Options{}, 1,
+			[]string{"| Name | Date |", "| Alice | 2024-01-01 |"}, nil},
+		{"pptx order and title", pptx, FormatPPTX, Options{}, 2,
+			[]string{"## 幻灯片 1\n\n### Roadmap\n\nShip v2", "## 幻灯片 2\n\nSecond"}, nil},
+		{"pdf", minimalPDF("Hello page one", "Second page"), FormatPDF, Options{Pages: "2-"}, 2,
+			[]string{"Second page"}, []string{"Hello"}},
+		{"max chars", docx, FormatDOCX, Options{MaxChars: 10}, 2,
+			[]string{"# Contract"}, []string{"Signatures"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Extract(tt.data, tt.format, tt.opts)
+			if err != nil {
+				t.Fatalf("Extract: %v", err)
+			}
+			if doc.TotalPages != tt.pages {
+				t.Errorf("TotalPages = %d, want %d", doc.TotalPages, tt.pages)
+			}
+			md := doc.Markdown()
+			for _, w := range tt.want {
+				if !strings.Contains(md, w) {
+					t.Errorf("missing %q in:\n%s", w, md)
+				}
+			}
+			for _, r := range tt.reject {
+				if strings.Contains(md, r) {
+					t.Errorf("unexpected %q in:\n%s", r, md)
+				}
+			}
+		})
+	}
+}
+
+func TestParsePageRange(t *testing.T) {
+	got, err := ParsePageRange("3, 1-2,2,9-", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got) != "[1 2 3 9 10]" {
+		t.Errorf("got %v", got)
+	}
+	for _, bad := range []string{"0", "5-3", "x", "11"} {
+		if _, err := ParsePageRange(bad, 10); err == nil {
+			t.Errorf("ParsePageRange(%q) should fail", bad)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package document
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// extractDOCX converts word/document.xml to Markdown: headings from
+// paragraph styles, list items, and tables. Pages are split at explicit and
+// last-rendered page breaks, so numbering roughly follows what Word shows.
+func extractDOCX(data []byte) (*Document, error) {
+	o, err := openOOXML(data)
+	if err != nil {
+		return nil, err
+	}
+	body, err := o.read("word/document.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	w := &docxWriter{}
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	var (
+		para     strings.Builder
+		heading  int
+		listItem bool
+		inText   bool
+		runDepth int
+		tblDepth int
+		tbl      *tableBuilder
+	)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("word/document.xml: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "Fallback": // mc:AlternateContent duplicates text boxes
+				_ = dec.Skip()
+			case "p":
+				para.Reset()
+				heading, listItem = 0, false
+			case "pStyle":
+				heading = docxHeadingLevel(attr(t, "val"))
+			case "numPr":
+				listItem = true
+			case "r":
+				runDepth++
+			case "t":
+				inText = true
+			case "tab":
+				if runDepth > 0 {
+					para.WriteString("\t")
+				}
+			case "br":
+				if runDepth == 0 {
+					break
+				}
+				if attr(t, "type") == "page" {
+					if tblDepth == 0 {
+						w.pageBreak(para.Len() == 0)
+					}
+				} else {
+					para.WriteString("\n")
+				}
+			case "lastRenderedPageBreak":
+				if tblDepth == 0 {
+					w.pageBreak(para.Len() == 0)
+				}
+			case "tbl":
+				tblDepth++
+				if tblDepth == 1 {
+					tbl = &tableBuilder{}
+				}
+			case "tr":
+				if tblDepth == 1 {
+					tbl.startRow()
+				}
+			case "tc":
+				if tblDepth == 1 {
+					tbl.startCell()
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "r":
+				runDepth--
+			case "p":
+				if tblDepth > 0 {
+					tbl.appendText(para.String())
+				} else {
+					w.paragraph(para.String(), heading, listItem)
+				}
+				para.Reset()
+			case "tc":
+				if tblDepth == 1 {
+					tbl.endCell()
+				}
+			case "tbl":
+				tblDepth--
+				if tblDepth == 0 {
+					w.block(tbl.markdown())
+					tbl = nil
+				}
+			}
+		case xml.CharData:
+			if inText {
+				para.Write(t)
+			}
+		}
+	}
+	return w.document(), nil
+}
+
+// docxHeadingLevel maps a paragraph style ID to a Markdown heading level.
+func docxHeadingLevel(style string) int {
+	s := strings.ToLower(strings.ReplaceAll(style, " ", ""))
+	switch s {
+	case "title":
+		return 1
+	case "subtitle":
+		return 2
+	}
+	if strings.HasPrefix(s, "heading") {
+		if n, err := strconv.Atoi(strings.TrimPrefix(s, "heading")); err == nil && n >= 1 && n <= 6 {
+			return n
+		}
+	}
+	return 0
+}
+
+// docxWriter accumulates Markdown blocks and splits them into pages.
+type docxWriter struct {
+	pages  []Page
+	blocks []string
+	// pendingBreak is a page break seen inside a paragraph that already had
+	// text; it takes effect after that paragraph.
+	pendingBreak bool
+}
+
+func (w *docxWriter) pageBreak(beforeText bool) {
+	if beforeText {
+		w.flush()
+	} else {
+		w.pendingBreak = true
+	}
+}
+
+func (w *docxWriter) paragraph(text string, heading int, listItem bool) {
+	text = strings.TrimSpace(text)
+	if text != "" {
+		switch {
+		case heading > 0:
+			text = strings.Repeat("#", heading) + " " + strings.ReplaceAll(text, "\n", " ")
+		case listItem:
+			text = "- " + text
+		}
+		w.block(text)
+	}
+	if w.pendingBreak {
+		w.pendingBreak = false
+		w.flush()
+	}
+}
+
+func (w *docxWriter) block(md string) {
+	if md != "" {
+		w.blocks = append(w.blocks, md)
+	}
+}
+
+// flush closes the current page; consecutive breaks do not create empty pages.
+func (w *docxWriter) flush() {
+	if len(w.blocks) == 0 {
+		return
+	}
+	n := len(w.pages) + 1
+	w.pages = append(w.pages, Page{Number: n, Title: fmt.Sprintf("第 %d 页", n), Markdown: joinBlocks(w.blocks)})
+	w.blocks = nil
+}
+
+func (w *docxWriter) document() *Document {
+	w.flush()
+	if len(w.pages) == 0 {
+		w.pages = []Page{{Number: 1, Title: "第 1 页"}}
+	}
+	return &Document{TotalPages: len(w.pages), Pages: w.pages}
+}
+
+// joinBlocks separates Markdown blocks with blank lines, keeping list items
+// of the same list on consecutive lines.
+func joinBlocks(blocks []string) string {
+	var sb strings.Builder
+	for i, b := range blocks {
+		if i > 0 {
+			if strings.HasPrefix(b, "- ") && strings.HasPrefix(blocks[i-1], "- ") {
+				sb.WriteString("\n")
+			} else {
+				sb.WriteString("\n\n")
+			}
+		}
+		sb.WriteString(b)
+	}
+	return sb.String()
+}
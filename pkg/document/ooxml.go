@@ -0,0 +1,146 @@
+package document
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// maxPartSize bounds how much of a single zip part is decompressed, so a
+// zip bomb cannot exhaust memory.
+const maxPartSize = 64 << 20
+
+// ooxml wraps the zip container shared by DOCX, XLSX and PPTX.
+type ooxml struct {
+	zr    *zip.Reader
+	files map[string]*zip.File
+}
+
+func openOOXML(data []byte) (*ooxml, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("not a valid Office Open XML file: %w", err)
+	}
+	o := &ooxml{zr: zr, files: make(map[string]*zip.File, len(zr.File))}
+	for _, f := range zr.File {
+		o.files[strings.TrimPrefix(f.Name, "/")] = f
+	}
+	return o, nil
+}
+
+func (o *ooxml) has(name string) bool {
+	_, ok := o.files[name]
+	return ok
+}
+
+// read returns the decompressed content of a part.
+func (o *ooxml) read(name string) ([]byte, error) {
+	f, ok := o.files[strings.TrimPrefix(name, "/")]
+	if !ok {
+		return nil, fmt.Errorf("missing part %s", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, maxPartSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxPartSize {
+		return nil, fmt.Errorf("part %s too large", name)
+	}
+	return data, nil
+}
+
+// rels parses the relationships of a part (e.g. "xl/workbook.xml") and
+// returns relationship ID → resolved part name.
+func (o *ooxml) rels(part string) map[string]string {
+	dir, file := path.Split(part)
+	data, err := o.read(dir + "_rels/" + file + ".rels")
+	if err != nil {
+		return nil
+	}
+	var doc struct {
+		Rels []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+			Mode   string `xml:"TargetMode,attr"`
+		} `xml:"Relationship"`
+	}
+	if xml.Unmarshal(data, &doc) != nil {
+		return nil
+	}
+	out := make(map[string]string, len(doc.Rels))
+	for _, r := range doc.Rels {
+		if r.Mode == "External" {
+			continue
+		}
+		if strings.HasPrefix(r.Target, "/") {
+			out[r.ID] = strings.TrimPrefix(r.Target, "/")
+		} else {
+			out[r.ID] = path.Clean(dir + r.Target)
+		}
+	}
+	return out
+}
+
+// attr returns the value of the attribute with the given local name.
+func attr(se xml.StartElement, local string) string {
+	for _, a := range se.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// tableBuilder collects rows and cells while streaming table XML.
+type tableBuilder struct {
+	rows [][]string
+	cell strings.Builder
+	open bool // inside a cell
+}
+
+func (t *tableBuilder) startRow() { t.rows = append(t.rows, nil) }
+
+func (t *tableBuilder) startCell() {
+	t.cell.Reset()
+	t.open = true
+}
+
+func (t *tableBuilder) endCell() {
+	if len(t.rows) == 0 {
+		t.startRow()
+	}
+	last := len(t.rows) - 1
+	t.rows[last] = append(t.rows[last], strings.TrimSpace(t.cell.String()))
+	t.open = false
+}
+
+// appendText adds a paragraph to the current cell.
+func (t *tableBuilder) appendText(s string) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return
+	}
+	if t.cell.Len() > 0 {
+		t.cell.WriteString("<br>")
+	}
+	t.cell.WriteString(s)
+}
+
+func (t *tableBuilder) markdown() string {
+	rows := t.rows[:0]
+	for _, r := range t.rows {
+		if len(r) > 0 {
+			rows = append(rows, r)
+		}
+	}
+	return MarkdownTable(rows)
+}
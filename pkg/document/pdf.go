@@ -0,0 +1,90 @@
+package document
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+)
+
+func extractPDF(data []byte, pages string) (doc *Document, err error) {
+	// The PDF parser panics on some malformed files.
+	defer func() {
+		if r := recover(); r != nil {
+			doc, err = nil, fmt.Errorf("malformed PDF: %v", r)
+		}
+	}()
+
+	rd, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		if strings.Contains(err.Error(), "encrypt") {
+			return nil, fmt.Errorf("PDF is encrypted")
+		}
+		return nil, err
+	}
+	total := rd.NumPage()
+	sel, err := ParsePageRange(pages, total)
+	if err != nil {
+		return nil, err
+	}
+	doc = &Document{TotalPages: total}
+	for _, n := range sel {
+		p := rd.Page(n)
+		text := ""
+		if !p.V.IsNull() {
+			text = pdfPageText(p)
+		}
+		doc.Pages = append(doc.Pages, Page{Number: n, Title: fmt.Sprintf("第 %d 页", n), Markdown: text})
+	}
+	return doc, nil
+}
+
+// pdfPageText returns the page text line by line, top to bottom.
+func pdfPageText(p pdf.Page) string {
+	rows, err := p.GetTextByRow()
+	if err != nil || len(rows) == 0 {
+		text, _ := p.GetPlainText(nil)
+		return strings.TrimSpace(text)
+	}
+	lines := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if line := strings.TrimSpace(joinPDFRow(row.Content)); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// joinPDFRow concatenates the text fragments of one row. Fragments carry
+// positions but no widths, so word gaps are detected by comparing each gap
+// with the row's typical per-character advance.
+func joinPDFRow(texts pdf.TextHorizontal) string {
+	var adv []float64
+	for i := 0; i+1 < len(texts); i++ {
+		n := utf8.RuneCountInString(texts[i].S)
+		if d := texts[i+1].X - texts[i].X; n > 0 && d > 0 {
+			adv = append(adv, d/float64(n))
+		}
+	}
+	charW := 0.0
+	if len(adv) > 0 {
+		sort.Float64s(adv)
+		charW = adv[len(adv)/2]
+	}
+
+	var sb strings.Builder
+	for i, t := range texts {
+		if i > 0 && charW > 0 {
+			prev := texts[i-1]
+			expected := prev.X + float64(utf8.RuneCountInString(prev.S))*charW
+			if t.X-expected > charW*0.8 && !strings.HasSuffix(prev.S, " ") && !strings.HasPrefix(t.S, " ") {
+				sb.WriteByte(' ')
+			}
+		}
+		sb.WriteString(t.S)
+	}
+	return sb.String()
+}
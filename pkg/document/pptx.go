@@ -0,0 +1,171 @@
+package document
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var slidePartRe = regexp.MustCompile(`^ppt/slides/slide(\d+)\.xml$`)
+
+// extractPPTX collects the text and tables of each slide; slides are pages.
+func extractPPTX(data []byte) (*Document, error) {
+	o, err := openOOXML(data)
+	if err != nil {
+		return nil, err
+	}
+	parts := pptxSlides(o)
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("presentation has no slides")
+	}
+	doc := &Document{TotalPages: len(parts)}
+	for i, part := range parts {
+		md, err := pptxSlide(o, part)
+		if err != nil {
+			md = fmt.Sprintf("（无法读取：%v）", err)
+		}
+		doc.Pages = append(doc.Pages, Page{Number: i + 1, Title: fmt.Sprintf("幻灯片 %d", i+1), Markdown: md})
+	}
+	return doc, nil
+}
+
+// pptxSlides returns slide parts in presentation order, falling back to
+// file-name order when presentation.xml cannot be read.
+func pptxSlides(o *ooxml) []string {
+	if data, err := o.read("ppt/presentation.xml"); err == nil {
+		rels := o.rels("ppt/presentation.xml")
+		var parts []string
+		dec := xml.NewDecoder(bytes.NewReader(data))
+		for {
+			tok, err := dec.Token()
+			if err != nil {
+				break
+			}
+			if se, ok := tok.(xml.StartElement); ok && se.Name.Local == "sldId" {
+				if part := rels[attr(se, "id")]; part != "" && o.has(part) {
+					parts = append(parts, part)
+				}
+			}
+		}
+		if len(parts) > 0 {
+			return parts
+		}
+	}
+
+	type numbered struct {
+		n    int
+		part string
+	}
+	var found []numbered
+	for name := range o.files {
+		if m := slidePartRe.FindStringSubmatch(name); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			found = append(found, numbered{n, name})
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].n < found[j].n })
+	parts := make([]string, len(found))
+	for i, f := range found {
+		parts[i] = f.part
+	}
+	return parts
+}
+
+// pptxSlide renders one slide: the title placeholder as a heading, other
+// paragraphs as lines, tables as Markdown tables.
+func pptxSlide(o *ooxml, part string) (string, error) {
+	data, err := o.read(part)
+	if err != nil {
+		return "", err
+	}
+	var (
+		blocks   []string
+		para     strings.Builder
+		inText   bool
+		isTitle  bool
+		tblDepth int
+		tbl      *tableBuilder
+	)
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "Fallback":
+				_ = dec.Skip()
+			case "sp":
+				isTitle = false
+			case "ph":
+				typ := attr(t, "type")
+				isTitle = typ == "title" || typ == "ctrTitle"
+			case "p":
+				para.Reset()
+			case "t":
+				inText = true
+			case "br":
+				para.WriteString("\n")
+			case "tbl":
+				tblDepth++
+				if tblDepth == 1 {
+					tbl = &tableBuilder{}
+				}
+			case "tr":
+				if tblDepth == 1 {
+					tbl.startRow()
+				}
+			case "tc":
+				if tblDepth == 1 {
+					tbl.startCell()
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "sp":
+				isTitle = false
+			case "p":
+				text := strings.TrimSpace(para.String())
+				switch {
+				case tblDepth > 0:
+					tbl.appendText(text)
+				case text == "":
+				case isTitle:
+					blocks = append(blocks, "### "+strings.ReplaceAll(text, "\n", " "))
+				default:
+					blocks = append(blocks, text)
+				}
+				para.Reset()
+			case "tc":
+				if tblDepth == 1 {
+					tbl.endCell()
+				}
+			case "tbl":
+				tblDepth--
+				if tblDepth == 0 {
+					if md := tbl.markdown(); md != "" {
+						blocks = append(blocks, md)
+					}
+					tbl = nil
+				}
+			}
+		case xml.CharData:
+			if inText {
+				para.Write(t)
+			}
+		}
+	}
+	return strings.Join(blocks, "\n\n"), nil
+}
@@ -0,0 +1,357 @@
+package document
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sheets larger than this are cut off; the model can still ask for a
+// specific sheet, but a 100k-row export is never useful as Markdown.
+const (
+	maxSheetRows = 2000
+	maxSheetCols = 100
+)
+
+// extractXLSX renders every worksheet as a Markdown table; each sheet is one page.
+func extractXLSX(data []byte) (*Document, error) {
+	o, err := openOOXML(data)
+	if err != nil {
+		return nil, err
+	}
+	sheets, err := xlsxSheets(o)
+	if err != nil {
+		return nil, err
+	}
+	shared := xlsxSharedStrings(o)
+	dateStyles := xlsxDateStyles(o)
+
+	doc := &Document{TotalPages: len(sheets)}
+	for i, sh := range sheets {
+		md, err := xlsxSheet(o, sh.part, shared, dateStyles)
+		if err != nil {
+			md = fmt.Sprintf("（无法读取：%v）", err)
+		}
+		doc.Pages = append(doc.Pages, Page{Number: i + 1, Title: "工作表: " + sh.name, Markdown: md})
+	}
+	return doc, nil
+}
+
+type xlsxSheetRef struct {
+	name string
+	part string
+}
+
+// xlsxSheets lists worksheets in workbook order.
+func xlsxSheets(o *ooxml) ([]xlsxSheetRef, error) {
+	data, err := o.read("xl/workbook.xml")
+	if err != nil {
+		return nil, err
+	}
+	rels := o.rels("xl/workbook.xml")
+	var sheets []xlsxSheetRef
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("xl/workbook.xml: %w", err)
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok || se.Name.Local != "sheet" {
+			continue
+		}
+		part := rels[attr(se, "id")]
+		if part == "" || !o.has(part) {
+			continue // chart sheets and dangling references
+		}
+		sheets = append(sheets, xlsxSheetRef{name: attr(se, "name"), part: part})
+	}
+	if len(sheets) == 0 {
+		return nil, fmt.Errorf("workbook has no worksheets")
+	}
+	return sheets, nil
+}
+
+// xlsxSharedStrings loads the shared string table (missing table = none).
+func xlsxSharedStrings(o *ooxml) []string {
+	data, err := o.read("xl/sharedStrings.xml")
+	if err != nil {
+		return nil
+	}
+	var (
+		out    []string
+		cur    strings.Builder
+		inText bool
+	)
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				cur.Reset()
+			case "t":
+				inText = true
+			case "rPh": // phonetic hints would duplicate East Asian text
+				_ = dec.Skip()
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "si":
+				out = append(out, cur.String())
+			case "t":
+				inText = false
+			}
+		case xml.CharData:
+			if inText {
+				cur.Write(t)
+			}
+		}
+	}
+	return out
+}
+
+// xlsxDateStyles reports, per cell style index, whether the number format is
+// a date or time so serial numbers can be shown as dates.
+func xlsxDateStyles(o *ooxml) []bool {
+	data, err := o.read("xl/styles.xml")
+	if err != nil {
+		return nil
+	}
+	var styles struct {
+		NumFmts []struct {
+			ID   int    `xml:"numFmtId,attr"`
+			Code string `xml:"formatCode,attr"`
+		} `xml:"numFmts>numFmt"`
+		Xfs []struct {
+			NumFmtID int `xml:"numFmtId,attr"`
+		} `xml:"cellXfs>xf"`
+	}
+	if xml.Unmarshal(data, &styles) != nil {
+		return nil
+	}
+	custom := make(map[int]bool)
+	for _, f := range styles.NumFmts {
+		custom[f.ID] = isDateFormatCode(f.Code)
+	}
+	out := make([]bool, len(styles.Xfs))
+	for i, xf := range styles.Xfs {
+		id := xf.NumFmtID
+		if isDate, ok := custom[id]; ok {
+			out[i] = isDate
+		} else {
+			out[i] = (id >= 14 && id <= 22) || (id >= 45 && id <= 47)
+		}
+	}
+	return out
+}
+
+func isDateFormatCode(code string) bool {
+	// Drop quoted literals and bracketed colours/locales before looking for
+	// date tokens, so "[Red]0.00" or "\"days\"" are not mistaken for dates.
+	var sb strings.Builder
+	inQuote, inBracket := false, false
+	for _, r := range code {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+		case inQuote:
+		case r == '[':
+			inBracket = true
+		case r == ']':
+			inBracket = false
+		case !inBracket:
+			sb.WriteRune(r)
+		}
+	}
+	s := strings.ToLower(sb.String())
+	return strings.ContainsAny(s, "ymdh") || strings.Contains(s, "ss")
+}
+
+type xlsxCell struct {
+	col   int
+	value string
+}
+
+type xlsxRow struct {
+	cells []xlsxCell
+}
+
+// xlsxSheet renders one worksheet.
+func xlsxSheet(o *ooxml, part string, shared []string, dateStyles []bool) (string, error) {
+	data, err := o.read(part)
+	if err != nil {
+		return "", err
+	}
+	var (
+		rows      []xlsxRow
+		truncated bool
+		row       *xlsxRow
+		ref, typ  string
+		style     int
+		val       strings.Builder
+		inVal     bool
+		nextCol   int
+		minCol    = math.MaxInt
+		maxCol    = -1
+	)
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "row":
+				if len(rows) >= maxSheetRows {
+					truncated = true
+					_ = dec.Skip()
+					continue
+				}
+				rows = append(rows, xlsxRow{})
+				row = &rows[len(rows)-1]
+				nextCol = 0
+			case "c":
+				ref, typ = attr(t, "r"), attr(t, "t")
+				style, _ = strconv.Atoi(attr(t, "s"))
+				val.Reset()
+			case "v", "t":
+				inVal = true
+			case "rPh":
+				_ = dec.Skip()
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "v", "t":
+				inVal = false
+			case "c":
+				if row == nil {
+					continue
+				}
+				col := nextCol
+				if c, ok := columnIndex(ref); ok {
+					col = c
+				}
+				nextCol = col + 1
+				if col >= maxSheetCols {
+					truncated = true
+					continue
+				}
+				v := xlsxValue(val.String(), typ, style, shared, dateStyles)
+				if v == "" {
+					continue
+				}
+				row.cells = append(row.cells, xlsxCell{col: col, value: v})
+				minCol = min(minCol, col)
+				maxCol = max(maxCol, col)
+			case "row":
+				row = nil
+			}
+		case xml.CharData:
+			if inVal {
+				val.Write(t)
+			}
+		}
+	}
+
+	var grid [][]string
+	for _, r := range rows {
+		if len(r.cells) == 0 {
+			continue // blank spacer rows only add noise
+		}
+		line := make([]string, maxCol-minCol+1)
+		for _, c := range r.cells {
+			line[c.col-minCol] = c.value
+		}
+		grid = append(grid, line)
+	}
+	if len(grid) == 0 {
+		return "（空工作表）", nil
+	}
+	md := MarkdownTable(grid)
+	if truncated {
+		md += fmt.Sprintf("\n\n（工作表过大，仅显示前 %d 行 / %d 列）", maxSheetRows, maxSheetCols)
+	}
+	return md, nil
+}
+
+// xlsxValue turns a raw cell value into display text.
+func xlsxValue(raw, typ string, style int, shared []string, dateStyles []bool) string {
+	switch typ {
+	case "s":
+		i, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil || i < 0 || i >= len(shared) {
+			return ""
+		}
+		return strings.TrimSpace(shared[i])
+	case "b":
+		if raw == "1" {
+			return "TRUE"
+		}
+		return "FALSE"
+	case "str", "inlineStr", "e":
+		return strings.TrimSpace(raw)
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+	if err != nil {
+		return strings.TrimSpace(raw)
+	}
+	if style >= 0 && style < len(dateStyles) && dateStyles[style] {
+		return excelDate(f)
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// excelDate converts an Excel serial date (1900 date system) to text.
+func excelDate(serial float64) string {
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	days := math.Floor(serial)
+	secs := math.Round((serial - days) * 86400)
+	t := epoch.AddDate(0, 0, int(days)).Add(time.Duration(secs) * time.Second)
+	switch {
+	case days == 0:
+		return t.Format("15:04:05")
+	case secs == 0:
+		return t.Format("2006-01-02")
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// columnIndex converts a cell reference such as "AB12" to a 0-based column.
+func columnIndex(ref string) (int, bool) {
+	col, n := 0, 0
+	for _, r := range ref {
+		if r >= 'A' && r <= 'Z' {
+			col = col*26 + int(r-'A'+1)
+			n++
+			continue
+		}
+		if r >= 'a' && r <= 'z' {
+			col = col*26 + int(r-'a'+1)
+			n++
+			continue
+		}
+		break
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return col - 1, true
+}
@@ -0,0 +1,82 @@
+// Package eventbus is an in-process pub/sub hub for live system events
+// (subagent task status, cron runs, Telegram pending users, agent changes,
+// session runs). The WebSocket API relays them to dashboards so they do not
+// have to poll.
+//
+// Delivery is best effort: a subscriber whose buffer is full misses events
+// and should resync through the REST API. Chat output does not go through
+// the bus — it is streamed loss-free by each session's Broadcaster.
+package eventbus
+
+import (
+	"sync"
+	"time"
+)
+
+// Channels published by the server.
+const (
+	Agents     = "agents"      // agent created / updated / removed, channel status
+	Subagents  = "subagents"   // background task status changes
+	Cron       = "cron"        // cron run started / finished
+	Pending    = "pending"     // Telegram users waiting for approval
+	Sessions   = "sessions"    // chat generation started / finished
+	TeamMemory = "team-memory" // team memory proposals awaiting / after review
+)
+
+// Event is a single system event.
+type Event struct {
+	Channel string `json:"channel"`
+	Type    string `json:"event"`
+	Data    any    `json:"data,omitempty"`
+	Time    int64  `json:"time"` // Unix ms
+}
+
+// Bus fans events out to all subscribers. A nil *Bus discards everything,
+// so publishers need no nil checks.
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[int]chan Event
+	next int
+}
+
+// New creates an empty Bus.
+func New() *Bus {
+	return &Bus{subs: make(map[int]chan Event)}
+}
+
+// Publish sends an event to every subscriber without blocking.
+func (b *Bus) Publish(channel, typ string, data any) {
+	if b == nil {
+		return
+	}
+	ev := Event{Channel: channel, Type: typ, Data: data, Time: time.Now().UnixMilli()}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, ch := range b.subs {
+		select {
+		case ch <- ev:
+		default: // slow subscriber; it resyncs via REST
+		}
+	}
+}
+
+// Subscribe registers a subscriber with the given buffer size. Call the
+// returned func to unsubscribe; the channel is closed afterwards.
+func (b *Bus) Subscribe(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+	b.mu.Lock()
+	id := b.next
+	b.next++
+	b.subs[id] = ch
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, id)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
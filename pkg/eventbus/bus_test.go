@@ -0,0 +1,33 @@
+package eventbus
+
+import "testing"
+
+func TestBus(t *testing.T) {
+	var nilBus *Bus
+	nilBus.Publish(Agents, "created", nil) // must not panic
+
+	b := New()
+	a, unsubA := b.Subscribe(1)
+	c, unsubC := b.Subscribe(4)
+	defer unsubC()
+
+	b.Publish(Cron, "run_started", "job-1")
+	b.Publish(Cron, "run_finished", "job-1") // a's buffer is full: dropped for a only
+
+	if ev := <-a; ev.Channel != Cron || ev.Type != "run_started" || ev.Time == 0 {
+		t.Fatalf("a got %+v", ev)
+	}
+	if len(a) != 0 || len(c) != 2 {
+		t.Fatalf("buffered a=%d c=%d", len(a), len(c))
+	}
+
+	unsubA()
+	unsubA() // idempotent
+	if _, ok := <-a; ok {
+		t.Fatal("channel not closed after unsubscribe")
+	}
+	b.Publish(Agents, "updated", nil)
+	if len(c) != 3 {
+		t.Fatalf("c buffered %d", len(c))
+	}
+}
@@ -180,6 +180,28 @@ func normaliseAnthropicModel(model string) string {
 	return strings.TrimPrefix(model, "anthropic/")
 }
 
+// SupportsPDF reports whether a model accepts native PDF "document" content
+// blocks. Only Anthropic models from Claude 3.5 onwards do; other providers
+// and older models get extracted text instead.
+func SupportsPDF(model string) bool {
+	if provider, name, ok := strings.Cut(model, "/"); ok {
+		if provider != "anthropic" {
+			return false
+		}
+		model = name
+	}
+	model = strings.ToLower(model)
+	if !strings.HasPrefix(model, "claude-") {
+		return false
+	}
+	for _, old := range []string{"claude-3-opus", "claude-3-sonnet", "claude-3-haiku", "claude-2", "claude-instant"} {
+		if strings.HasPrefix(model, old) {
+			return false
+		}
+	}
+	return true
+}
+
 // parseAnthropicSSE reads the SSE stream and sends events to the channel.
 // Reference: anthropic.js → anthropicStream event handlers
 //
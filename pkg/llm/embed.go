@@ -0,0 +1,229 @@
+// Embedders — turn text into vectors for semantic search.
+// OpenAIEmbedder calls any OpenAI-compatible /embeddings endpoint;
+// LocalEmbedder hashes character n-grams and needs no network or model.
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Embedder turns texts into fixed-length vectors. Vectors from different
+// embedders are not comparable; Name identifies the embedder and model so
+// stored vectors can be rebuilt when it changes.
+type Embedder interface {
+	Name() string
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// ---- OpenAI-compatible ----------------------------------------------------
+
+const openAIAPIBase = "https://api.openai.com/v1"
+
+// OpenAIEmbedder calls POST {BaseURL}/embeddings (OpenAI, DeepSeek,
+// OpenRouter, Ollama, vLLM, ...).
+type OpenAIEmbedder struct {
+	BaseURL    string // default https://api.openai.com/v1
+	APIKey     string
+	Model      string // default text-embedding-3-small
+	BatchSize  int    // texts per request (default 64)
+	httpClient *http.Client
+}
+
+// NewOpenAIEmbedder creates an embedder for an OpenAI-compatible endpoint.
+func NewOpenAIEmbedder(baseURL, apiKey, model string) *OpenAIEmbedder {
+	if baseURL == "" {
+		baseURL = openAIAPIBase
+	}
+	if model == "" {
+		model = "text-embedding-3-small"
+	}
+	return &OpenAIEmbedder{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		APIKey:     apiKey,
+		Model:      model,
+		BatchSize:  64,
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// Name implements Embedder.
+func (e *OpenAIEmbedder) Name() string { return "openai:" + e.Model }
+
+// Embed implements Embedder.
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	out := make([][]float32, 0, len(texts))
+	batch := e.BatchSize
+	if batch <= 0 {
+		batch = 64
+	}
+	for start := 0; start < len(texts); start += batch {
+		end := min(start+batch, len(texts))
+		vecs, err := e.embedBatch(ctx, texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, vecs...)
+	}
+	return out, nil
+}
+
+func (e *OpenAIEmbedder) embedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	body, _ := json.Marshal(map[string]any{"model": e.Model, "input": texts})
+	req, err := http.NewRequestWithContext(ctx, "POST", e.BaseURL+"/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.APIKey)
+	}
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("http request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		errBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("embeddings api error: status %d: %s", resp.StatusCode, string(errBody))
+	}
+	var parsed struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("decode embeddings: %w", err)
+	}
+	if len(parsed.Data) != len(texts) {
+		return nil, fmt.Errorf("embeddings api returned %d vectors for %d inputs", len(parsed.Data), len(texts))
+	}
+	vecs := make([][]float32, len(texts))
+	for _, d := range parsed.Data {
+		if d.Index < 0 || d.Index >= len(vecs) {
+			return nil, fmt.Errorf("embeddings api returned index %d out of range", d.Index)
+		}
+		vecs[d.Index] = Normalize(d.Embedding)
+	}
+	return vecs, nil
+}
+
+// ---- Local ----------------------------------------------------------------
+
+// LocalEmbedder maps text to a normalised bag of hashed features: latin words,
+// latin character trigrams (for partial and misspelled words) and CJK
+// character unigrams and bigrams. It captures lexical rather than deep
+// semantic similarity, but works offline and costs nothing.
+type LocalEmbedder struct {
+	Dim int // vector length (default 512)
+}
+
+// NewLocalEmbedder creates a LocalEmbedder with the default dimension.
+func NewLocalEmbedder() *LocalEmbedder { return &LocalEmbedder{Dim: 512} }
+
+// Name implements Embedder.
+func (e *LocalEmbedder) Name() string { return fmt.Sprintf("local:hash-%d", e.dim()) }
+
+func (e *LocalEmbedder) dim() int {
+	if e.Dim <= 0 {
+		return 512
+	}
+	return e.Dim
+}
+
+// Embed implements Embedder.
+func (e *LocalEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	for i, t := range texts {
+		out[i] = e.vector(t)
+	}
+	return out, nil
+}
+
+func (e *LocalEmbedder) vector(text string) []float32 {
+	vec := make([]float32, e.dim())
+	add := func(feature string, weight float32) {
+		h := fnv.New64a()
+		h.Write([]byte(feature))
+		sum := h.Sum64()
+		sign := float32(1)
+		if sum>>63 == 1 {
+			sign = -1
+		}
+		vec[sum%uint64(len(vec))] += sign * weight
+	}
+	isCJK := func(r rune) bool {
+		return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+	}
+	var word []rune
+	flushWord := func() {
+		if len(word) == 0 {
+			return
+		}
+		add("w:"+string(word), 1)
+		padded := append(append([]rune{'^'}, word...), '$')
+		for i := 0; i+3 <= len(padded); i++ {
+			add("t:"+string(padded[i:i+3]), 0.5)
+		}
+		word = word[:0]
+	}
+	var prev rune
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			flushWord()
+			add("c:"+string(r), 0.5)
+			if prev != 0 {
+				add("b:"+string([]rune{prev, r}), 1)
+			}
+			prev = r
+			continue
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word = append(word, unicode.ToLower(r))
+		default:
+			flushWord()
+		}
+		prev = 0
+	}
+	flushWord()
+	return Normalize(vec)
+}
+
+// Normalize scales v to unit length in place and returns it.
+func Normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return v
+	}
+	inv := float32(1 / math.Sqrt(sum))
+	for i := range v {
+		v[i] *= inv
+	}
+	return v
+}
+
+// Cosine returns the cosine similarity of two unit vectors (their dot
+// product); 0 when the lengths differ.
+func Cosine(a, b []float32) float32 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot float32
+	for i := range a {
+		dot += a[i] * b[i]
+	}
+	return dot
+}
@@ -15,7 +15,12 @@ type MemConfig struct {
 	Schedule  string `json:"schedule"`  // "hourly" | "every6h" | "daily" | "weekly"
 	KeepTurns int    `json:"keepTurns"` // Q&A pairs to keep per session after trim
 	FocusHint string `json:"focusHint"` // optional hint for what to record
+	Trim      bool   `json:"trim"`      // archive + trim sessions once consolidated (off: sessions are left intact)
 	CronJobID string `json:"cronJobId"` // registered cron job ID (set when enabled)
+
+	Rollup          bool   `json:"rollup"`                // weekly rollup: weekly/monthly summaries, fact promotion, INDEX.md refresh
+	IndexBudget     int    `json:"indexBudget,omitempty"` // max runes of INDEX.md kept by the rollup (0: default 4000)
+	RollupCronJobID string `json:"rollupCronJobId"`       // registered rollup cron job ID (set when rollup is on)
 }
 
 // DefaultMemConfig returns a MemConfig with sensible defaults.
@@ -45,6 +50,10 @@ func ScheduleToCron(schedule string) string {
 	}
 }
 
+// RollupCron is the schedule of the rollup pass: Mondays 03:00, after the
+// last consolidation of the week has run.
+const RollupCron = "0 0 3 * * 1"
+
 // ReadMemConfig reads memory-config.json from the agent workspace.
 func ReadMemConfig(workspaceDir string) (MemConfig, error) {
 	path := filepath.Join(workspaceDir, "memory-config.json")
@@ -80,11 +89,12 @@ func WriteMemConfig(workspaceDir string, cfg MemConfig) error {
 
 // ── Run log ───────────────────────────────────────────────────────────────
 
-// RunLogEntry records one consolidation attempt.
+// RunLogEntry records one consolidation or rollup attempt.
 type RunLogEntry struct {
-	Timestamp int64  `json:"timestamp"` // unix ms
-	Status    string `json:"status"`    // "ok" | "error"
-	Message   string `json:"message"`   // summary preview or error text
+	Timestamp int64  `json:"timestamp"`      // unix ms
+	Kind      string `json:"kind,omitempty"` // "consolidate" (default) | "rollup"
+	Status    string `json:"status"`         // "ok" | "error"
+	Message   string `json:"message"`        // summary preview or error text
 }
 
 const runLogFilename = "memory-run-log.jsonl"
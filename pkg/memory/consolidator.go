@@ -1,11 +1,17 @@
 // Package memory — agent memory consolidation.
-// Reads sessions, deduplicates against today's existing daily log, writes incremental update.
+// Reads messages newer than each session's watermark, deduplicates against
+// today's existing daily log, writes incremental updates.
 package memory
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -14,27 +20,49 @@ import (
 
 // ConsolidateConfig controls how memory consolidation works.
 type ConsolidateConfig struct {
-	KeepTurns int    `json:"keepTurns"` // Q&A pairs to keep per session after trim
-	FocusHint string `json:"focusHint"` // optional hint to LLM on what to record
+	KeepTurns  int    `json:"keepTurns"`            // Q&A pairs to keep per session when trimming
+	FocusHint  string `json:"focusHint"`            // optional hint to LLM on what to record
+	Trim       bool   `json:"trim"`                 // trim fully consolidated sessions (archived first)
+	ChunkRunes int    `json:"chunkRunes,omitempty"` // conversation text per LLM call (default 12000)
+	MaxChunks  int    `json:"maxChunks,omitempty"`  // LLM calls per run (default 10); the rest waits for the next run
 }
 
-// Consolidate reads all sessions for an agent, writes an incremental daily memory entry,
-// and trims sessions to the last N turns.
-//
-// Returns (written bool, err error):
-//   written=true  → new content was appended to today's daily log
-//   written=false → no new content (dedup), nothing written
+// ConsolidateResult summarises one consolidation run.
+type ConsolidateResult struct {
+	File      string `json:"file"`      // today's daily log, relative to memory/
+	Entries   int    `json:"entries"`   // daily entries written
+	Messages  int    `json:"messages"`  // new messages summarised (watermarks advanced past them)
+	Sessions  int    `json:"sessions"`  // sessions with new messages
+	Remaining int    `json:"remaining"` // new messages left for the next run
+	Trimmed   int    `json:"trimmed"`   // sessions archived and trimmed
+}
+
+// pendingMsg is one message newer than its session's watermark.
+type pendingMsg struct {
+	sessionID string
+	title     string
+	ts        int64
+	role      string
+	text      string
+}
+
+// Consolidate summarises the messages each session gained since its
+// watermark into today's daily log, in chunks of about cfg.ChunkRunes,
+// advancing the watermarks after every chunk so a failed run resumes where
+// it stopped. Each entry's source messages are recorded in the provenance
+// log. With cfg.Trim, sessions whose messages are all consolidated are
+// archived to memory-archive/ and trimmed to the last cfg.KeepTurns turns.
 //
 // Dedup logic: reads today's existing daily log and passes it to the LLM as context.
 // The LLM only outputs new information not already recorded — preventing duplicate entries.
 func Consolidate(
 	ctx context.Context,
-	store *session.Store,
+	store session.Store,
 	memTree *MemoryTree,
 	agentName string,
 	cfg ConsolidateConfig,
 	callLLM func(ctx context.Context, system, user string) (string, error),
-) (written bool, err error) {
+) (*ConsolidateResult, error) {
 	// ── 1. Load location (Shanghai) ─────────────────────────────────────────
 	loc, err := time.LoadLocation("Asia/Shanghai")
 	if err != nil {
@@ -44,59 +72,188 @@ func Consolidate(
 	todayStr := now.Format("2006-01-02")
 	dailyRelPath := fmt.Sprintf("daily/%s/%s/%s.md",
 		now.Format("2006"), now.Format("01"), now.Format("02"))
+	res := &ConsolidateResult{File: dailyRelPath}
+	if cfg.ChunkRunes <= 0 {
+		cfg.ChunkRunes = 12000
+	}
+	if cfg.MaxChunks <= 0 {
+		cfg.MaxChunks = 10
+	}
 
-	// ── 2. Gather conversation content from all sessions ─────────────────────
+	// ── 2. Gather messages newer than each session's watermark ───────────────
 	sessions, err := store.ListSessions()
 	if err != nil {
-		return false, fmt.Errorf("list sessions: %w", err)
+		return nil, fmt.Errorf("list sessions: %w", err)
 	}
-
-	var convBuf strings.Builder
-	validCount := 0
+	marks, err := ReadWatermarks(memTree.WorkspaceDir)
+	if err != nil {
+		return nil, fmt.Errorf("read watermarks: %w", err)
+	}
+	live := make(map[string]bool, len(sessions))
+	var pending []pendingMsg
 	for _, sess := range sessions {
-		msgs, existingSummary, err := store.ReadHistory(sess.ID)
-		if err != nil || (len(msgs) == 0 && existingSummary == "") {
-			continue
+		live[sess.ID] = true
+		mark, seen := marks[sess.ID]
+		if seen && sess.LastAt > 0 && sess.LastAt <= mark.LastTimestamp {
+			continue // nothing new
 		}
 		title := sess.Title
 		if title == "" {
 			title = sess.ID
 		}
-		convBuf.WriteString(fmt.Sprintf("### 会话：%s\n", title))
-		if existingSummary != "" {
-			convBuf.WriteString(fmt.Sprintf("[压缩摘要] %s\n\n", existingSummary))
+		msgs, err := readSessionMessages(store, sess.ID)
+		if err != nil {
+			continue
 		}
+		found := false
 		for _, m := range msgs {
-			text := extractMsgText(m.Content)
-			if text == "" {
+			if m.Timestamp <= mark.LastTimestamp {
+				continue
+			}
+			pending = append(pending, pendingMsg{
+				sessionID: sess.ID,
+				title:     title,
+				ts:        m.Timestamp,
+				role:      m.Message.Role,
+				text:      extractMsgText(m.Message.Content),
+			})
+			found = true
+		}
+		if found {
+			res.Sessions++
+		}
+	}
+	for id := range marks {
+		if !live[id] {
+			delete(marks, id)
+		}
+	}
+	if len(pending) == 0 {
+		return res, nil // no new conversation
+	}
+	// Oldest sessions first; messages stay in order within a session.
+	first := make(map[string]int64)
+	for _, m := range pending {
+		if _, ok := first[m.sessionID]; !ok {
+			first[m.sessionID] = m.ts
+		}
+	}
+	sort.SliceStable(pending, func(i, j int) bool {
+		return first[pending[i].sessionID] < first[pending[j].sessionID]
+	})
+
+	// ── 3. Summarise chunk by chunk ──────────────────────────────────────────
+	chunks := chunkPending(pending, cfg.ChunkRunes)
+	for i, chunk := range chunks {
+		if i >= cfg.MaxChunks {
+			res.Remaining += len(chunk)
+			continue
+		}
+		wrote, err := consolidateChunk(ctx, memTree, agentName, cfg, callLLM, chunk, now, todayStr, dailyRelPath, i)
+		if err != nil {
+			_ = WriteWatermarks(memTree.WorkspaceDir, marks)
+			return res, err
+		}
+		if wrote {
+			res.Entries++
+		}
+		res.Messages += len(chunk)
+		for _, m := range chunk {
+			mark := marks[m.sessionID]
+			mark.LastTimestamp = max(mark.LastTimestamp, m.ts)
+			mark.Messages++
+			mark.UpdatedAt = time.Now().UnixMilli()
+			marks[m.sessionID] = mark
+		}
+		if err := WriteWatermarks(memTree.WorkspaceDir, marks); err != nil {
+			return res, fmt.Errorf("write watermarks: %w", err)
+		}
+	}
+
+	// ── 4. Optionally trim fully consolidated sessions (archive first) ───────
+	if cfg.Trim {
+		left := make(map[string]bool)
+		for _, chunk := range chunks[min(cfg.MaxChunks, len(chunks)):] {
+			for _, m := range chunk {
+				left[m.sessionID] = true
+			}
+		}
+		keepMsgs := cfg.KeepTurns * 2
+		if keepMsgs < 2 {
+			keepMsgs = 6 // default 3 turns
+		}
+		done := make(map[string]bool)
+		for _, m := range pending {
+			if left[m.sessionID] || done[m.sessionID] {
 				continue
 			}
-			if m.Role == "user" {
-				convBuf.WriteString(fmt.Sprintf("用户：%s\n", text))
-			} else {
-				convBuf.WriteString(fmt.Sprintf("AI：%s\n\n", text))
+			done[m.sessionID] = true
+			trimmed, err := archiveAndTrim(store, memTree.WorkspaceDir, m.sessionID, keepMsgs)
+			if err != nil {
+				log.Printf("[memory] trim session %s: %v", m.sessionID, err)
+			} else if trimmed {
+				res.Trimmed++
 			}
 		}
-		validCount++
 	}
+	return res, nil
+}
 
-	if validCount == 0 {
-		return false, nil // no conversations
+// consolidateChunk asks the LLM for the new information in one chunk and
+// appends it to today's daily log. It reports whether an entry was written.
+func consolidateChunk(
+	ctx context.Context,
+	memTree *MemoryTree,
+	agentName string,
+	cfg ConsolidateConfig,
+	callLLM func(ctx context.Context, system, user string) (string, error),
+	chunk []pendingMsg,
+	now time.Time,
+	todayStr, dailyRelPath string,
+	seq int,
+) (bool, error) {
+	var convBuf strings.Builder
+	var sources []EntrySource
+	hasText := false
+	for _, m := range chunk {
+		if len(sources) == 0 || sources[len(sources)-1].SessionID != m.sessionID {
+			sources = append(sources, EntrySource{SessionID: m.sessionID, Title: m.title})
+			convBuf.WriteString(fmt.Sprintf("### 会话：%s\n", m.title))
+		}
+		src := &sources[len(sources)-1]
+		src.Messages = append(src.Messages, m.ts)
+		if m.text == "" {
+			continue
+		}
+		hasText = true
+		if m.role == "user" {
+			convBuf.WriteString(fmt.Sprintf("用户：%s\n", m.text))
+		} else {
+			convBuf.WriteString(fmt.Sprintf("AI：%s\n\n", m.text))
+		}
+	}
+	rec := ProvenanceRecord{
+		ID:      fmt.Sprintf("c%d-%d", now.UnixMilli(), seq),
+		Time:    time.Now().UnixMilli(),
+		File:    dailyRelPath,
+		Sources: sources,
+	}
+	if !hasText {
+		return false, nil // tool-only messages: nothing to summarise
 	}
 
-	// ── 3. Read today's existing daily log (for dedup) ───────────────────────
+	// Read today's existing daily log (for dedup)
 	existingToday, _ := memTree.GetFile(dailyRelPath)
 	existingToday = strings.TrimSpace(existingToday)
 
-	// ── 4. Build focus instruction ───────────────────────────────────────────
+	// Build focus instruction
 	focus := cfg.FocusHint
 	if focus == "" {
 		focus = "关键信息、重要决策、任务进展、知识积累"
 	}
 
-	// ── 5. Call LLM (with dedup context if today has existing content) ───────
+	// Call LLM (with dedup context if today has existing content)
 	var systemPrompt, userMsg string
-
 	if existingToday != "" {
 		// Incremental mode: only output NEW content not in existing records
 		systemPrompt = fmt.Sprintf(`你是记忆整理助手。今天（%s）已有如下记忆记录，请对比新对话内容，只输出**尚未记录的新增信息**。
@@ -155,12 +312,14 @@ func Consolidate(
 
 	// Check if LLM signals no new content
 	if summary == "" || strings.Contains(summary, "[无新增]") {
+		_ = AppendProvenance(memTree.WorkspaceDir, rec)
 		return false, nil // dedup: nothing new
 	}
 
-	// ── 6. Write incremental entry to today's daily log ──────────────────────
-	timeStr := now.Format("15:04")
-	entry := fmt.Sprintf("\n## %s 自动整理\n\n%s\n", timeStr, summary)
+	// Write incremental entry to today's daily log
+	rec.Heading = now.Format("15:04") + " 自动整理"
+	rec.Written = true
+	entry := fmt.Sprintf("\n## %s\n<!-- consolidation:%s -->\n\n%s\n", rec.Heading, rec.ID, summary)
 
 	if existingToday == "" {
 		// First entry: create file with date header
@@ -173,17 +332,76 @@ func Consolidate(
 			return false, fmt.Errorf("append daily log: %w", err2)
 		}
 	}
+	if err := AppendProvenance(memTree.WorkspaceDir, rec); err != nil {
+		log.Printf("[memory] provenance: %v", err)
+	}
+	return true, nil
+}
 
-	// ── 7. Trim sessions to last N turns ────────────────────────────────────
-	keepMsgs := cfg.KeepTurns * 2
-	if keepMsgs < 2 {
-		keepMsgs = 6 // default 3 turns
+// readSessionMessages returns every message entry of a session, including
+// those before a compaction and excluding carried copies.
+func readSessionMessages(store session.Store, sessionID string) ([]session.MessageEntry, error) {
+	raw, err := store.ReadAll(sessionID)
+	if err != nil {
+		return nil, err
 	}
-	for _, sess := range sessions {
-		_ = store.TrimToLastN(sess.ID, keepMsgs)
+	var out []session.MessageEntry
+	for _, line := range raw {
+		var e session.MessageEntry
+		if json.Unmarshal(line, &e) != nil || e.Type != session.EntryTypeMessage || e.Carried {
+			continue
+		}
+		out = append(out, e)
 	}
+	return out, nil
+}
 
-	return true, nil
+// chunkPending splits messages into chunks of about maxRunes of text, never
+// between two messages with the same timestamp (the watermark could not
+// tell them apart).
+func chunkPending(pending []pendingMsg, maxRunes int) [][]pendingMsg {
+	var chunks [][]pendingMsg
+	start, runes := 0, 0
+	for i, m := range pending {
+		runes += len([]rune(m.text))
+		next := i + 1
+		if next == len(pending) {
+			break
+		}
+		sameInstant := pending[next].sessionID == m.sessionID && pending[next].ts == m.ts
+		if runes >= maxRunes && !sameInstant {
+			chunks = append(chunks, pending[start:next])
+			start, runes = next, 0
+		}
+	}
+	return append(chunks, pending[start:])
+}
+
+// archiveAndTrim copies a session's full log to memory-archive/ and trims
+// it to the last keepMsgs messages. It reports whether anything was trimmed.
+func archiveAndTrim(store session.Store, workspaceDir, sessionID string, keepMsgs int) (bool, error) {
+	msgs, err := readSessionMessages(store, sessionID)
+	if err != nil || len(msgs) <= keepMsgs {
+		return false, err
+	}
+	raw, err := store.ReadAll(sessionID)
+	if err != nil {
+		return false, err
+	}
+	dir := filepath.Join(workspaceDir, "memory-archive")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return false, err
+	}
+	var buf bytes.Buffer
+	for _, line := range raw {
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	name := fmt.Sprintf("%s-%d.jsonl", sessionID, time.Now().UnixMilli())
+	if err := os.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0644); err != nil {
+		return false, err
+	}
+	return true, store.TrimToLastN(sessionID, keepMsgs)
 }
 
 // extractMsgText pulls plain text from raw message content.
@@ -0,0 +1,70 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sunhuihui6688-star/ai-panel/pkg/session"
+)
+
+func TestConsolidateIncremental(t *testing.T) {
+	dir := t.TempDir()
+	store := session.NewJSONLStore(filepath.Join(dir, "sessions"))
+	tree := NewMemoryTree(dir)
+	say := func(sid, role, text string) {
+		b, _ := json.Marshal(text)
+		_ = store.AppendMessage(sid, role, b)
+		time.Sleep(2 * time.Millisecond) // distinct timestamps
+	}
+	sid, _, _ := store.GetOrCreate("", "a")
+	say(sid, "user", "我叫小王")
+	say(sid, "assistant", "你好小王")
+
+	var prompts []string
+	llm := func(_ context.Context, _, user string) (string, error) {
+		prompts = append(prompts, user)
+		return "### 关键信息\n- 用户叫小王", nil
+	}
+	res, err := Consolidate(context.Background(), store, tree, "a", ConsolidateConfig{}, llm)
+	if err != nil || res.Entries != 1 || res.Messages != 2 {
+		t.Fatalf("first run = %+v, %v", res, err)
+	}
+
+	// Nothing new: no LLM call.
+	res, _ = Consolidate(context.Background(), store, tree, "a", ConsolidateConfig{}, llm)
+	if len(prompts) != 1 || res.Messages != 0 {
+		t.Fatalf("second run called the LLM: %+v", res)
+	}
+
+	// Only the new turn is summarised, in chunks.
+	say(sid, "user", "我住在杭州")
+	say(sid, "assistant", "记住了")
+	res, err = Consolidate(context.Background(), store, tree, "a", ConsolidateConfig{ChunkRunes: 1, Trim: true, KeepTurns: 1}, llm)
+	if err != nil || res.Messages != 2 || len(prompts) != 3 {
+		t.Fatalf("third run = %+v, %v (%d prompts)", res, err, len(prompts))
+	}
+	if strings.Contains(prompts[1], "用户：我叫小王") || !strings.Contains(prompts[1], "杭州") {
+		t.Fatalf("old messages re-read: %q", prompts[1])
+	}
+
+	recs, _ := ReadProvenance(dir, res.File, 0)
+	if len(recs) != 3 || len(recs[0].Sources) != 1 || len(recs[0].Sources[0].Messages) != 1 {
+		t.Fatalf("provenance = %+v", recs)
+	}
+	daily, _ := tree.GetFile(res.File)
+	if !strings.Contains(daily, "<!-- consolidation:"+recs[0].ID+" -->") {
+		t.Fatalf("entry id missing from daily log:\n%s", daily)
+	}
+
+	// Trim kept the last turn and archived the full session first.
+	msgs, _, _ := store.ReadHistory(sid)
+	archived, _ := os.ReadDir(filepath.Join(dir, "memory-archive"))
+	if res.Trimmed != 1 || len(msgs) != 2 || len(archived) != 1 {
+		t.Fatalf("trim: %d msgs, %d archives, result %+v", len(msgs), len(archived), res)
+	}
+}
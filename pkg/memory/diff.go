@@ -0,0 +1,146 @@
+package memory
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxDiffCells bounds the LCS table; larger inputs are diffed as a whole-file
+// replacement of the differing middle section.
+const maxDiffCells = 4_000_000
+
+type diffLine struct {
+	kind byte // ' ', '-', '+'
+	text string
+	a, b int // 1-based line numbers in the old/new file (0 = not present)
+}
+
+// unifiedDiff returns a unified diff of a → b with ctx lines of context and
+// the number of added and removed lines.
+func unifiedDiff(name, a, b string, ctx int) (string, int, int) {
+	if a == b {
+		return "", 0, 0
+	}
+	lines := diffLines(splitLines(a), splitLines(b))
+	added, removed := 0, 0
+	for _, l := range lines {
+		switch l.kind {
+		case '+':
+			added++
+		case '-':
+			removed++
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- a/%s\n+++ b/%s\n", name, name)
+	for i := 0; i < len(lines); {
+		if lines[i].kind == ' ' {
+			i++
+			continue
+		}
+		// Grow the hunk while changes are within 2*ctx lines of each other.
+		start := max(i-ctx, 0)
+		end := i
+		for j := i; j < len(lines); j++ {
+			if lines[j].kind != ' ' {
+				end = j
+			} else if j-end > 2*ctx {
+				break
+			}
+		}
+		end = min(end+ctx, len(lines)-1)
+		hunk := lines[start : end+1]
+		aStart, bStart, aLen, bLen := 0, 0, 0, 0
+		for _, l := range hunk {
+			if l.kind != '+' {
+				if aStart == 0 {
+					aStart = l.a
+				}
+				aLen++
+			}
+			if l.kind != '-' {
+				if bStart == 0 {
+					bStart = l.b
+				}
+				bLen++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", aStart, aLen, bStart, bLen)
+		for _, l := range hunk {
+			sb.WriteByte(l.kind)
+			sb.WriteString(l.text)
+			sb.WriteByte('\n')
+		}
+		i = end + 1
+	}
+	return sb.String(), added, removed
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines aligns two line slices via their longest common subsequence,
+// after trimming the common prefix and suffix.
+func diffLines(a, b []string) []diffLine {
+	var out []diffLine
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		out = append(out, diffLine{kind: ' ', text: a[pre], a: pre + 1, b: pre + 1})
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	ma, mb := a[pre:len(a)-suf], b[pre:len(b)-suf]
+
+	if len(ma)*len(mb) > maxDiffCells {
+		for i, l := range ma {
+			out = append(out, diffLine{kind: '-', text: l, a: pre + i + 1})
+		}
+		for j, l := range mb {
+			out = append(out, diffLine{kind: '+', text: l, b: pre + j + 1})
+		}
+	} else {
+		// lcs[i][j] = LCS length of ma[i:] and mb[j:].
+		lcs := make([][]int, len(ma)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(mb)+1)
+		}
+		for i := len(ma) - 1; i >= 0; i-- {
+			for j := len(mb) - 1; j >= 0; j-- {
+				if ma[i] == mb[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(ma) || j < len(mb) {
+			switch {
+			case i < len(ma) && j < len(mb) && ma[i] == mb[j]:
+				out = append(out, diffLine{kind: ' ', text: ma[i], a: pre + i + 1, b: pre + j + 1})
+				i++
+				j++
+			case i < len(ma) && (j == len(mb) || lcs[i+1][j] >= lcs[i][j+1]):
+				out = append(out, diffLine{kind: '-', text: ma[i], a: pre + i + 1})
+				i++
+			default:
+				out = append(out, diffLine{kind: '+', text: mb[j], b: pre + j + 1})
+				j++
+			}
+		}
+	}
+
+	for k := 0; k < suf; k++ {
+		ai, bi := len(a)-suf+k, len(b)-suf+k
+		out = append(out, diffLine{kind: ' ', text: a[ai], a: ai + 1, b: bi + 1})
+	}
+	return out
+}
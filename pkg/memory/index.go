@@ -0,0 +1,529 @@
+// Memory search index — hybrid keyword (BM25) and vector search over one
+// agent's memory tree, so agents can find the right file instead of guessing
+// from INDEX.md.
+//
+// Files are split into chunks at markdown headings and paragraph breaks.
+// The index is stored at {workspace}/.memindex/index.json and kept current
+// two ways: MemoryTree.WriteFile/AppendToFile re-chunk the written file, and
+// every search first rescans file stamps so edits made with the generic
+// file tools are picked up too. Chunk vectors are computed lazily, in
+// batches, by the configured embedder (see SetEmbedder).
+package memory
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sunhuihui6688-star/ai-panel/pkg/config"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/llm"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/search"
+)
+
+const (
+	indexVersion = 1
+	// chunkRunes is the target chunk size; sections longer than this are
+	// split at paragraph breaks.
+	chunkRunes = 800
+	// minSemantic is the cosine similarity a chunk with no keyword match
+	// needs to be returned at all.
+	minSemantic = 0.25
+	// staleAfter bounds how often searches rescan the memory tree.
+	staleAfter = 10 * time.Second
+)
+
+var (
+	indexMu  sync.Mutex
+	indexes  = make(map[string]*Index)
+	embedder = llm.Embedder(llm.NewLocalEmbedder())
+)
+
+// SetEmbedder selects the embedder used by every memory index; nil disables
+// vector search (keyword ranking only). Call once at startup. Indexes built
+// with a different embedder re-embed their chunks on the next search.
+func SetEmbedder(e llm.Embedder) {
+	indexMu.Lock()
+	defer indexMu.Unlock()
+	embedder = e
+}
+
+// EmbedderFromConfig builds the embedder selected by cfg.Embedder.
+func EmbedderFromConfig(cfg config.MemorySearchConfig) (llm.Embedder, error) {
+	switch strings.ToLower(cfg.Embedder) {
+	case "", "local":
+		return llm.NewLocalEmbedder(), nil
+	case "openai":
+		return llm.NewOpenAIEmbedder(cfg.BaseURL, cfg.APIKey, cfg.Model), nil
+	case "off", "none":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown memorySearch.embedder %q (want local, openai or off)", cfg.Embedder)
+}
+
+func currentEmbedder() llm.Embedder {
+	indexMu.Lock()
+	defer indexMu.Unlock()
+	return embedder
+}
+
+// OpenIndex returns the shared search index of a workspace's memory tree.
+func OpenIndex(workspaceDir string) *Index {
+	key := filepath.Clean(workspaceDir)
+	indexMu.Lock()
+	defer indexMu.Unlock()
+	if idx, ok := indexes[key]; ok {
+		return idx
+	}
+	idx := &Index{workspaceDir: key, path: filepath.Join(key, ".memindex", "index.json")}
+	indexes[key] = idx
+	return idx
+}
+
+// Index is the hybrid search index of one memory tree. Safe for concurrent use.
+type Index struct {
+	workspaceDir string
+	path         string
+
+	mu       sync.Mutex
+	loaded   bool
+	data     indexData
+	lastSync time.Time
+	stats    *bm25Stats // cached; reset when chunks change
+}
+
+type indexData struct {
+	Version  int                  `json:"version"`
+	Embedder string               `json:"embedder,omitempty"` // Embedder.Name() of the stored vectors
+	Files    map[string]fileStamp `json:"files"`
+	Chunks   []*Chunk             `json:"chunks"`
+}
+
+type fileStamp struct {
+	ModTime int64 `json:"modTime"`
+	Size    int64 `json:"size"`
+}
+
+// Chunk is one indexed piece of a memory file.
+type Chunk struct {
+	Path    string `json:"path"` // relative to memory/
+	Heading string `json:"heading,omitempty"`
+	Line    int    `json:"line"` // first line, 1-based
+	Text    string `json:"text"`
+	Vector  vector `json:"vec,omitempty"`
+
+	terms map[string]int
+	size  int
+}
+
+// vector is stored as base64 little-endian float32s to keep the file small.
+type vector []float32
+
+func (v vector) MarshalJSON() ([]byte, error) {
+	buf := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(f))
+	}
+	return json.Marshal(base64.StdEncoding.EncodeToString(buf))
+}
+
+func (v *vector) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	buf, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	out := make(vector, len(buf)/4)
+	for i := range out {
+		out[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	*v = out
+	return nil
+}
+
+// SearchHit is one ranked chunk.
+type SearchHit struct {
+	Path     string  `json:"path"` // relative to memory/
+	Heading  string  `json:"heading,omitempty"`
+	Line     int     `json:"line"`
+	Text     string  `json:"text"`
+	Score    float64 `json:"score"`    // combined, 0..1
+	Keyword  float64 `json:"keyword"`  // normalised BM25, 0..1
+	Semantic float64 `json:"semantic"` // cosine similarity
+}
+
+// load reads the on-disk index once. Must be called with ix.mu held.
+func (ix *Index) load() {
+	if ix.loaded {
+		return
+	}
+	ix.loaded = true
+	if data, err := os.ReadFile(ix.path); err == nil {
+		var d indexData
+		if json.Unmarshal(data, &d) == nil && d.Version == indexVersion {
+			ix.data = d
+		}
+	}
+	if ix.data.Files == nil {
+		ix.data = indexData{Version: indexVersion, Files: make(map[string]fileStamp)}
+	}
+}
+
+// save writes the index atomically. Must be called with ix.mu held.
+func (ix *Index) save() {
+	data, err := json.Marshal(ix.data)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(ix.path), 0755); err != nil {
+		log.Printf("[memindex] %v", err)
+		return
+	}
+	tmp := ix.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		log.Printf("[memindex] %v", err)
+		return
+	}
+	_ = os.Rename(tmp, ix.path)
+}
+
+func (ix *Index) memDir() string { return filepath.Join(ix.workspaceDir, "memory") }
+
+// UpdateFile re-chunks one memory file (relative to memory/) and saves the
+// index. Vectors for the new chunks are computed on the next search.
+func (ix *Index) UpdateFile(relPath string) {
+	rel := filepath.ToSlash(filepath.Clean(relPath))
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.load()
+	if ix.reindex(rel) {
+		ix.save()
+	}
+}
+
+// reindex refreshes rel from disk; it reports whether anything changed.
+// Must be called with ix.mu held.
+func (ix *Index) reindex(rel string) bool {
+	fi, err := os.Stat(filepath.Join(ix.memDir(), filepath.FromSlash(rel)))
+	old, had := ix.data.Files[rel]
+	if err != nil || fi.IsDir() || !indexable(rel) {
+		if !had {
+			return false
+		}
+		ix.dropFile(rel)
+		delete(ix.data.Files, rel)
+		return true
+	}
+	stamp := fileStamp{ModTime: fi.ModTime().UnixNano(), Size: fi.Size()}
+	if had && old == stamp {
+		return false
+	}
+	content, err := os.ReadFile(filepath.Join(ix.memDir(), filepath.FromSlash(rel)))
+	if err != nil {
+		return false
+	}
+	// Keep vectors of unchanged chunks (appends only add new ones).
+	prev := make(map[string]vector)
+	for _, c := range ix.data.Chunks {
+		if c.Path == rel && c.Vector != nil {
+			prev[c.Heading+"\x00"+c.Text] = c.Vector
+		}
+	}
+	ix.dropFile(rel)
+	for _, c := range chunkMarkdown(rel, string(content)) {
+		c.Vector = prev[c.Heading+"\x00"+c.Text]
+		ix.data.Chunks = append(ix.data.Chunks, c)
+	}
+	ix.data.Files[rel] = stamp
+	return true
+}
+
+func (ix *Index) dropFile(rel string) {
+	kept := ix.data.Chunks[:0]
+	for _, c := range ix.data.Chunks {
+		if c.Path != rel {
+			kept = append(kept, c)
+		}
+	}
+	ix.data.Chunks = kept
+	ix.stats = nil
+}
+
+// indexable reports whether a memory file is searched: text files outside
+// hidden directories (e.g. version history).
+func indexable(rel string) bool {
+	for _, part := range strings.Split(rel, "/") {
+		if strings.HasPrefix(part, ".") {
+			return false
+		}
+	}
+	switch strings.ToLower(filepath.Ext(rel)) {
+	case ".md", ".txt", ".markdown":
+		return true
+	}
+	return false
+}
+
+// Sync rescans the memory tree and embeds chunks that have no vector yet.
+func (ix *Index) Sync(ctx context.Context) error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	return ix.sync(ctx)
+}
+
+func (ix *Index) sync(ctx context.Context) error {
+	ix.load()
+	changed := false
+	seen := make(map[string]bool)
+	root := ix.memDir()
+	_ = filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		rel = filepath.ToSlash(rel)
+		if !indexable(rel) {
+			return nil
+		}
+		seen[rel] = true
+		if ix.reindex(rel) {
+			changed = true
+		}
+		return nil
+	})
+	for rel := range ix.data.Files {
+		if !seen[rel] {
+			ix.dropFile(rel)
+			delete(ix.data.Files, rel)
+			changed = true
+		}
+	}
+	if err := ix.embedMissing(ctx, &changed); err != nil {
+		log.Printf("[memindex] embed %s: %v", ix.workspaceDir, err)
+	}
+	if changed {
+		ix.save()
+	}
+	ix.lastSync = time.Now()
+	return nil
+}
+
+// embedMissing computes vectors for chunks without one, re-embedding
+// everything when the embedder changed. Must be called with ix.mu held.
+func (ix *Index) embedMissing(ctx context.Context, changed *bool) error {
+	emb := currentEmbedder()
+	if emb == nil {
+		return nil
+	}
+	if ix.data.Embedder != emb.Name() {
+		for _, c := range ix.data.Chunks {
+			c.Vector = nil
+		}
+		ix.data.Embedder = emb.Name()
+		*changed = true
+	}
+	var todo []*Chunk
+	var texts []string
+	for _, c := range ix.data.Chunks {
+		if c.Vector == nil {
+			todo = append(todo, c)
+			texts = append(texts, embedText(c))
+		}
+	}
+	if len(todo) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	vecs, err := emb.Embed(ctx, texts)
+	if err != nil {
+		return err
+	}
+	for i, c := range todo {
+		c.Vector = vecs[i]
+	}
+	*changed = true
+	return nil
+}
+
+func embedText(c *Chunk) string {
+	if c.Heading != "" {
+		return c.Heading + "\n" + c.Text
+	}
+	return c.Text
+}
+
+// Search returns up to limit chunks ranked by a blend of keyword (BM25)
+// and vector similarity. Without an embedder, ranking is keyword-only.
+func (ix *Index) Search(ctx context.Context, query string, limit int) ([]SearchHit, error) {
+	if limit <= 0 {
+		limit = 5
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if !ix.loaded || time.Since(ix.lastSync) > staleAfter {
+		_ = ix.sync(ctx)
+	}
+	if len(ix.data.Chunks) == 0 || strings.TrimSpace(query) == "" {
+		return []SearchHit{}, nil
+	}
+
+	kw := ix.bm25(search.Terms(query))
+	maxKW := 0.0
+	for _, s := range kw {
+		maxKW = math.Max(maxKW, s)
+	}
+
+	var qvec []float32
+	if emb := currentEmbedder(); emb != nil && emb.Name() == ix.data.Embedder {
+		if vecs, err := emb.Embed(ctx, []string{query}); err == nil && len(vecs) == 1 {
+			qvec = vecs[0]
+		} else if err != nil {
+			log.Printf("[memindex] embed query: %v", err)
+		}
+	}
+
+	hits := make([]SearchHit, 0, len(ix.data.Chunks))
+	for i, c := range ix.data.Chunks {
+		h := SearchHit{Path: c.Path, Heading: c.Heading, Line: c.Line, Text: c.Text}
+		if maxKW > 0 {
+			h.Keyword = kw[i] / maxKW
+		}
+		if qvec != nil && c.Vector != nil {
+			h.Semantic = float64(llm.Cosine(qvec, c.Vector))
+		}
+		switch {
+		case qvec == nil:
+			h.Score = h.Keyword
+		case h.Keyword == 0 && h.Semantic < minSemantic:
+			continue
+		default:
+			h.Score = 0.5*h.Keyword + 0.5*math.Max(h.Semantic, 0)
+		}
+		if h.Score > 0 {
+			hits = append(hits, h)
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+type bm25Stats struct {
+	df     map[string]int
+	avgLen float64
+}
+
+// bm25 scores every chunk against the query terms (k1=1.2, b=0.75).
+func (ix *Index) bm25(terms []string) []float64 {
+	if ix.stats == nil {
+		st := &bm25Stats{df: make(map[string]int)}
+		total := 0
+		for _, c := range ix.data.Chunks {
+			if c.terms == nil {
+				c.terms = make(map[string]int)
+				for _, t := range search.Terms(embedText(c)) {
+					c.terms[t]++
+					c.size++
+				}
+			}
+			total += c.size
+			for t := range c.terms {
+				st.df[t]++
+			}
+		}
+		st.avgLen = float64(total) / float64(max(len(ix.data.Chunks), 1))
+		ix.stats = st
+	}
+	const k1, b = 1.2, 0.75
+	n := float64(len(ix.data.Chunks))
+	scores := make([]float64, len(ix.data.Chunks))
+	for _, t := range uniq(terms) {
+		df := float64(ix.stats.df[t])
+		if df == 0 {
+			continue
+		}
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for i, c := range ix.data.Chunks {
+			tf := float64(c.terms[t])
+			if tf == 0 {
+				continue
+			}
+			norm := 1 - b + b*float64(c.size)/math.Max(ix.stats.avgLen, 1)
+			scores[i] += idf * tf * (k1 + 1) / (tf + k1*norm)
+		}
+	}
+	return scores
+}
+
+func uniq(ss []string) []string {
+	seen := make(map[string]bool, len(ss))
+	out := ss[:0:0]
+	for _, s := range ss {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// chunkMarkdown splits a file into sections at headings, and long sections
+// into pieces of about chunkRunes at blank lines.
+func chunkMarkdown(rel, content string) []*Chunk {
+	var out []*Chunk
+	heading := ""
+	var buf []string
+	start := 1
+	runes := 0
+	flush := func(next int) {
+		text := strings.TrimSpace(strings.Join(buf, "\n"))
+		if text != "" && text != "---" {
+			out = append(out, &Chunk{Path: rel, Heading: heading, Line: start, Text: text})
+		}
+		buf, runes, start = buf[:0], 0, next
+	}
+	for i, line := range strings.Split(content, "\n") {
+		lineNo := i + 1
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "#"):
+			flush(lineNo)
+			heading = strings.TrimSpace(strings.TrimLeft(trimmed, "#"))
+			continue
+		case trimmed == "" && runes >= chunkRunes:
+			flush(lineNo + 1)
+			continue
+		}
+		if len(buf) == 0 {
+			if trimmed == "" {
+				continue
+			}
+			start = lineNo
+		}
+		buf = append(buf, line)
+		runes += len([]rune(line))
+	}
+	flush(0)
+	return out
+}
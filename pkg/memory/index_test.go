@@ -0,0 +1,41 @@
+package memory
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIndexSearch(t *testing.T) {
+	dir := t.TempDir()
+	tree := NewMemoryTree(dir)
+	_ = tree.WriteFile("core/prefs.md", "# 偏好\n\n用户喜欢喝乌龙茶，不喝咖啡。\n\n# Tools\n\nPrefers vim over emacs.\n")
+	_ = tree.WriteFile("projects/panel.md", "# ai-panel\n\n部署在上海服务器，使用 systemd 管理。\n")
+
+	idx := OpenIndex(dir)
+	hits, err := idx.Search(context.Background(), "乌龙茶", 3)
+	if err != nil || len(hits) == 0 || hits[0].Path != "core/prefs.md" || hits[0].Heading != "偏好" || hits[0].Line != 3 {
+		t.Fatalf("hits = %+v, %v", hits, err)
+	}
+
+	// Appends are indexed immediately.
+	_ = tree.AppendToFile("projects/panel.md", "## 数据库\n\n使用 PostgreSQL 16。")
+	hits, _ = idx.Search(context.Background(), "postgresql", 1)
+	if len(hits) != 1 || hits[0].Path != "projects/panel.md" || hits[0].Heading != "数据库" {
+		t.Fatalf("hits after append = %+v", hits)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".memindex", "index.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A fresh index loads vectors from disk and sees deletions on sync.
+	_ = os.Remove(filepath.Join(dir, "memory", "core", "prefs.md"))
+	fresh := &Index{workspaceDir: dir, path: idx.path}
+	hits, _ = fresh.Search(context.Background(), "乌龙茶", 3)
+	for _, h := range hits {
+		if h.Path == "core/prefs.md" {
+			t.Fatalf("deleted file still indexed: %+v", hits)
+		}
+	}
+}
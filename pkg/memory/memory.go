@@ -23,6 +23,7 @@ type FileNode struct {
 // MemoryTree manages hierarchical memory for one agent workspace.
 type MemoryTree struct {
 	WorkspaceDir string
+	Author       Author // recorded on every version this tree writes (default: system)
 }
 
 // NewMemoryTree creates a MemoryTree for the given workspace directory.
@@ -30,6 +31,25 @@ func NewMemoryTree(workspaceDir string) *MemoryTree {
 	return &MemoryTree{WorkspaceDir: workspaceDir}
 }
 
+// As returns a copy of the tree whose writes are attributed to by.
+func (m *MemoryTree) As(by Author) *MemoryTree {
+	return &MemoryTree{WorkspaceDir: m.WorkspaceDir, Author: by}
+}
+
+// track runs write as a versioned change of memory/{relPath} and refreshes
+// the search index.
+func (m *MemoryTree) track(relPath string, write func() error) error {
+	by := m.Author
+	if by.Source == "" {
+		by.Source = SourceSystem
+	}
+	if err := Track(m.WorkspaceDir, "memory/"+filepath.ToSlash(filepath.Clean(relPath)), by, write); err != nil {
+		return err
+	}
+	OpenIndex(m.WorkspaceDir).UpdateFile(relPath)
+	return nil
+}
+
 // memDir returns the absolute path to the memory/ directory.
 func (m *MemoryTree) memDir() string {
 	return filepath.Join(m.WorkspaceDir, "memory")
@@ -108,7 +128,9 @@ func (m *MemoryTree) GetIndex() (string, error) {
 
 // UpdateIndex writes memory/INDEX.md.
 func (m *MemoryTree) UpdateIndex(content string) error {
-	return os.WriteFile(filepath.Join(m.memDir(), "INDEX.md"), []byte(content), 0644)
+	return m.track("INDEX.md", func() error {
+		return os.WriteFile(filepath.Join(m.memDir(), "INDEX.md"), []byte(content), 0644)
+	})
 }
 
 // GetFile reads any file under memory/ by relative path.
@@ -130,10 +152,12 @@ func (m *MemoryTree) WriteFile(relPath, content string) error {
 	if err != nil {
 		return err
 	}
-	if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
-		return err
-	}
-	return os.WriteFile(absPath, []byte(content), 0644)
+	return m.track(relPath, func() error {
+		if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
+			return err
+		}
+		return os.WriteFile(absPath, []byte(content), 0644)
+	})
 }
 
 // AppendToFile appends content to a memory file with a separator.
@@ -142,16 +166,18 @@ func (m *MemoryTree) AppendToFile(relPath, content string) error {
 	if err != nil {
 		return err
 	}
-	if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
-		return err
-	}
-	f, err := os.OpenFile(absPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
+	return m.track(relPath, func() error {
+		if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(absPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = f.WriteString("\n---\n" + content + "\n")
 		return err
-	}
-	defer f.Close()
-	_, err = f.WriteString("\n---\n" + content + "\n")
-	return err
+	})
 }
 
 // WriteDailyLog writes/appends to memory/daily/YYYY/MM/DD.md using Asia/Shanghai time.
@@ -0,0 +1,508 @@
+// Package memory — hierarchical rollups.
+// Summarises completed weeks and months of daily logs into memory/weekly and
+// memory/monthly, promotes recurring facts into memory/core and memory/topics,
+// and keeps a managed, size-bounded directory section in INDEX.md.
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	indexSectionStart = "<!-- rollup:start -->"
+	indexSectionEnd   = "<!-- rollup:end -->"
+)
+
+// RollupConfig controls a rollup pass.
+type RollupConfig struct {
+	MaxPeriods  int       `json:"maxPeriods,omitempty"`  // weekly + monthly summaries written per run (default 4); older backlog waits
+	SourceRunes int       `json:"sourceRunes,omitempty"` // daily log text per summary call (default 16000)
+	IndexBudget int       `json:"indexBudget,omitempty"` // max runes of INDEX.md after the refresh (default 4000)
+	FocusHint   string    `json:"focusHint,omitempty"`   // optional hint for what to keep
+	Now         time.Time `json:"-"`                     // reference time (default: now, Asia/Shanghai)
+}
+
+// RollupResult summarises one rollup pass.
+type RollupResult struct {
+	Weekly       []string `json:"weekly"`       // weekly summaries written, relative to memory/
+	Monthly      []string `json:"monthly"`      // monthly summaries written
+	Promoted     int      `json:"promoted"`     // facts appended to core/ and topics/
+	PromotedTo   []string `json:"promotedTo"`   // files that received facts
+	Remaining    int      `json:"remaining"`    // completed periods still without a summary
+	IndexUpdated bool     `json:"indexUpdated"` // INDEX.md changed
+}
+
+// rollupPeriod is one completed week or month of daily logs.
+type rollupPeriod struct {
+	kind    string // "weekly" | "monthly"
+	key     string // 2026-W07 | 2026-02
+	file    string // weekly/2026-W07.md, relative to memory/
+	start   time.Time
+	end     time.Time // last day (inclusive)
+	dailies []string  // daily logs, relative to memory/, oldest first
+}
+
+// Rollup writes a summary for every completed week and month that has daily
+// logs but no summary yet (oldest first, at most cfg.MaxPeriods per run),
+// asks the LLM which facts in the new summaries recur often enough to belong
+// in core/ or topics/, and refreshes the managed section of INDEX.md. The
+// INDEX.md refresh runs even when nothing new was summarised.
+func Rollup(
+	ctx context.Context,
+	memTree *MemoryTree,
+	agentName string,
+	cfg RollupConfig,
+	callLLM func(ctx context.Context, system, user string) (string, error),
+) (*RollupResult, error) {
+	loc, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		loc = time.UTC
+	}
+	now := cfg.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	now = now.In(loc)
+	if cfg.MaxPeriods <= 0 {
+		cfg.MaxPeriods = 4
+	}
+	if cfg.SourceRunes <= 0 {
+		cfg.SourceRunes = 16000
+	}
+	if cfg.IndexBudget <= 0 {
+		cfg.IndexBudget = 4000
+	}
+	res := &RollupResult{Weekly: []string{}, Monthly: []string{}, PromotedTo: []string{}}
+
+	// ── 1. Find completed periods without a summary ─────────────────────────
+	periods := pendingPeriods(memTree, now)
+	var written []string // summary texts, for promotion
+	for _, p := range periods {
+		if len(written) >= cfg.MaxPeriods {
+			res.Remaining++
+			continue
+		}
+		summary, err := summarisePeriod(ctx, memTree, agentName, cfg, callLLM, p)
+		if err != nil {
+			return res, err
+		}
+		if p.kind == "weekly" {
+			res.Weekly = append(res.Weekly, p.file)
+		} else {
+			res.Monthly = append(res.Monthly, p.file)
+		}
+		written = append(written, summary)
+	}
+
+	// ── 2. Promote recurring facts into core/ and topics/ ───────────────────
+	if len(written) > 0 {
+		files, n, err := promoteFacts(ctx, memTree, agentName, callLLM, written, now)
+		if err != nil {
+			return res, err
+		}
+		res.Promoted = n
+		res.PromotedTo = append(res.PromotedTo, files...)
+	}
+
+	// ── 3. Refresh the managed section of INDEX.md ──────────────────────────
+	updated, err := refreshIndex(memTree, cfg.IndexBudget)
+	if err != nil {
+		return res, fmt.Errorf("refresh INDEX.md: %w", err)
+	}
+	res.IndexUpdated = updated
+	return res, nil
+}
+
+// pendingPeriods lists completed weeks and months that have daily logs but
+// no summary file, oldest first (a week sorts before the month it ends in).
+func pendingPeriods(memTree *MemoryTree, now time.Time) []rollupPeriod {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	weeks := map[string]*rollupPeriod{}
+	months := map[string]*rollupPeriod{}
+	for _, rel := range dailyLogs(memTree) {
+		day, err := time.ParseInLocation("2006/01/02.md", strings.TrimPrefix(rel, "daily/"), now.Location())
+		if err != nil || !day.Before(today) {
+			continue
+		}
+		year, week := day.ISOWeek()
+		wkey := fmt.Sprintf("%d-W%02d", year, week)
+		if weeks[wkey] == nil {
+			start := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7)) // Monday
+			weeks[wkey] = &rollupPeriod{kind: "weekly", key: wkey, file: "weekly/" + wkey + ".md",
+				start: start, end: start.AddDate(0, 0, 6)}
+		}
+		weeks[wkey].dailies = append(weeks[wkey].dailies, rel)
+
+		mkey := day.Format("2006-01")
+		if months[mkey] == nil {
+			start := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, day.Location())
+			months[mkey] = &rollupPeriod{kind: "monthly", key: mkey, file: "monthly/" + mkey + ".md",
+				start: start, end: start.AddDate(0, 1, -1)}
+		}
+		months[mkey].dailies = append(months[mkey].dailies, rel)
+	}
+
+	var out []rollupPeriod
+	for _, set := range []map[string]*rollupPeriod{weeks, months} {
+		for _, p := range set {
+			if !p.end.Before(today) {
+				continue // still running
+			}
+			if _, err := os.Stat(filepath.Join(memTree.memDir(), p.file)); err == nil {
+				continue // already summarised
+			}
+			out = append(out, *p)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].end.Equal(out[j].end) {
+			return out[i].end.Before(out[j].end)
+		}
+		return out[i].kind == "weekly" && out[j].kind != "weekly"
+	})
+	return out
+}
+
+// dailyLogs returns every daily/YYYY/MM/DD.md under memory/, sorted.
+func dailyLogs(memTree *MemoryTree) []string {
+	root := filepath.Join(memTree.memDir(), "daily")
+	var out []string
+	_ = filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(d.Name(), ".md") {
+			return nil
+		}
+		rel, err := filepath.Rel(memTree.memDir(), path)
+		if err == nil {
+			out = append(out, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	sort.Strings(out)
+	return out
+}
+
+// summarisePeriod writes the summary file of one period and returns its body.
+func summarisePeriod(
+	ctx context.Context,
+	memTree *MemoryTree,
+	agentName string,
+	cfg RollupConfig,
+	callLLM func(ctx context.Context, system, user string) (string, error),
+	p rollupPeriod,
+) (string, error) {
+	// Share the source budget evenly so a long day cannot crowd out the rest.
+	per := cfg.SourceRunes / len(p.dailies)
+	var src strings.Builder
+	for _, rel := range p.dailies {
+		content, err := memTree.GetFile(rel)
+		if err != nil {
+			continue
+		}
+		content = strings.TrimSpace(content)
+		if r := []rune(content); len(r) > per {
+			content = string(r[:per]) + "\n…（已截断）"
+		}
+		src.WriteString(fmt.Sprintf("=== %s ===\n%s\n\n", strings.TrimSuffix(strings.TrimPrefix(rel, "daily/"), ".md"), content))
+	}
+
+	focus := cfg.FocusHint
+	if focus == "" {
+		focus = "关键信息、重要决策、任务进展、知识积累"
+	}
+	label := "本周"
+	title := fmt.Sprintf("# %s 周总结", p.key)
+	if p.kind == "monthly" {
+		label = "本月"
+		title = fmt.Sprintf("# %s 月总结", p.key)
+	}
+	systemPrompt := fmt.Sprintf(`你是记忆整理助手。请把%s（%s ~ %s）的每日记忆日志汇总成一份总结，重点关注：%s。
+
+输出格式（只输出有内容的分类，没有则跳过）：
+
+### 概要
+- ...
+
+### 关键信息
+- ...
+
+### 重要决策
+- ...
+
+### 任务进展
+- ...
+
+### 反复出现的事实
+- ...
+
+合并重复内容，条目简洁，每条不超过80字，不要开头说明语。`,
+		label, p.start.Format("2006-01-02"), p.end.Format("2006-01-02"), focus)
+	userMsg := fmt.Sprintf("Agent: %s\n\n%s", agentName, src.String())
+
+	summary, err := callLLM(ctx, systemPrompt, userMsg)
+	if err != nil {
+		return "", fmt.Errorf("llm summarize %s: %w", p.key, err)
+	}
+	summary = strings.TrimSpace(summary)
+	if summary == "" {
+		summary = "（无重要内容）"
+	}
+	content := fmt.Sprintf("%s\n\n> Agent: %s · 范围：%s ~ %s · 来源：%d 篇日志\n<!-- rollup:%s sources=%s -->\n\n%s\n",
+		title, agentName, p.start.Format("2006-01-02"), p.end.Format("2006-01-02"),
+		len(p.dailies), p.kind, strings.Join(p.dailies, ","), summary)
+	if err := memTree.WriteFile(p.file, content); err != nil {
+		return "", fmt.Errorf("write %s: %w", p.file, err)
+	}
+	return title + "\n" + summary, nil
+}
+
+// promotedFact is one fact the LLM proposes to keep long term.
+type promotedFact struct {
+	File string `json:"file"` // core/xxx.md or topics/xxx.md
+	Fact string `json:"fact"`
+}
+
+// promoteFacts asks the LLM which facts of the new summaries recur or are
+// durable, and appends them to core/ and topics/ files under a dated
+// heading. Facts already present in the target file are skipped. It returns
+// the files written and the number of facts promoted.
+func promoteFacts(
+	ctx context.Context,
+	memTree *MemoryTree,
+	agentName string,
+	callLLM func(ctx context.Context, system, user string) (string, error),
+	summaries []string,
+	now time.Time,
+) ([]string, int, error) {
+	var existing strings.Builder
+	for _, rel := range longTermFiles(memTree) {
+		content, _ := memTree.GetFile(rel)
+		if r := []rune(strings.TrimSpace(content)); len(r) > 1500 {
+			content = string(r[:1500]) + "\n…"
+		}
+		existing.WriteString(fmt.Sprintf("=== %s ===\n%s\n\n", rel, strings.TrimSpace(content)))
+	}
+	if existing.Len() == 0 {
+		existing.WriteString("（暂无）\n")
+	}
+
+	systemPrompt := `你是记忆整理助手。下面是最近的周/月总结，以及已有的长期记忆文件。
+请找出总结中反复出现、或长期有效的事实（用户偏好、人物关系、稳定的知识、长期项目），它们值得写入长期记忆。
+
+要求：
+- 已在长期记忆中出现的事实不要重复
+- file 只能是 core/ 或 topics/ 下的 .md 文件；优先使用已有文件，新主题用 topics/<英文小写短名>.md
+- 每条 fact 不超过80字，最多 10 条
+- 只输出 JSON 数组，不要其他内容，例如：
+[{"file":"core/relationships.md","fact":"用户小王是产品经理，偏好简洁回复"}]
+- 没有值得提升的事实时输出：[]`
+	userMsg := fmt.Sprintf("Agent: %s\n\n【已有长期记忆】\n%s\n【最近总结】\n%s",
+		agentName, existing.String(), strings.Join(summaries, "\n\n"))
+
+	reply, err := callLLM(ctx, systemPrompt, userMsg)
+	if err != nil {
+		return nil, 0, fmt.Errorf("llm promote: %w", err)
+	}
+	facts := parsePromotedFacts(reply)
+
+	byFile := map[string][]string{}
+	var order []string
+	for _, f := range facts {
+		if _, seen := byFile[f.File]; !seen {
+			order = append(order, f.File)
+		}
+		byFile[f.File] = append(byFile[f.File], f.Fact)
+	}
+	var files []string
+	total := 0
+	heading := fmt.Sprintf("## 自动归纳 %s", now.Format("2006-01-02"))
+	for _, rel := range order {
+		current, err := memTree.GetFile(rel)
+		exists := err == nil
+		var lines []string
+		for _, fact := range byFile[rel] {
+			if exists && strings.Contains(current, fact) {
+				continue
+			}
+			lines = append(lines, "- "+fact)
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		section := heading + "\n\n" + strings.Join(lines, "\n")
+		if exists {
+			err = memTree.AppendToFile(rel, section)
+		} else {
+			name := strings.TrimSuffix(filepath.Base(rel), ".md")
+			err = memTree.WriteFile(rel, fmt.Sprintf("# %s\n\n%s\n", name, section))
+		}
+		if err != nil {
+			return files, total, fmt.Errorf("write %s: %w", rel, err)
+		}
+		files = append(files, rel)
+		total += len(lines)
+	}
+	return files, total, nil
+}
+
+// parsePromotedFacts extracts the JSON array from the LLM reply and drops
+// facts that do not target a core/ or topics/ markdown file.
+func parsePromotedFacts(reply string) []promotedFact {
+	start, end := strings.Index(reply, "["), strings.LastIndex(reply, "]")
+	if start < 0 || end <= start {
+		return nil
+	}
+	var raw []promotedFact
+	if json.Unmarshal([]byte(reply[start:end+1]), &raw) != nil {
+		return nil
+	}
+	var out []promotedFact
+	for _, f := range raw {
+		f.Fact = strings.TrimSpace(strings.ReplaceAll(f.Fact, "\n", " "))
+		f.File = filepath.ToSlash(filepath.Clean(strings.TrimPrefix(strings.TrimSpace(f.File), "/")))
+		if f.Fact == "" || len([]rune(f.Fact)) > 200 || strings.Contains(f.File, "..") ||
+			!strings.HasSuffix(f.File, ".md") ||
+			!(strings.HasPrefix(f.File, "core/") || strings.HasPrefix(f.File, "topics/")) {
+			continue
+		}
+		out = append(out, f)
+		if len(out) >= 10 {
+			break
+		}
+	}
+	return out
+}
+
+// longTermFiles lists the markdown files under core/ and topics/, sorted.
+func longTermFiles(memTree *MemoryTree) []string {
+	var out []string
+	for _, dir := range []string{"core", "topics"} {
+		out = append(out, listMarkdown(memTree, dir)...)
+	}
+	return out
+}
+
+// listMarkdown returns the .md files directly under memory/{dir}, sorted.
+func listMarkdown(memTree *MemoryTree, dir string) []string {
+	entries, err := os.ReadDir(filepath.Join(memTree.memDir(), dir))
+	if err != nil {
+		return nil
+	}
+	var out []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".md") {
+			out = append(out, dir+"/"+e.Name())
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// refreshIndex rebuilds the managed directory section of INDEX.md (between
+// the rollup markers, appended if missing) and leaves the rest untouched.
+// The oldest weekly, then monthly summaries, then trailing topics are
+// dropped until the whole file fits in budget runes. It reports whether the
+// file changed.
+func refreshIndex(memTree *MemoryTree, budget int) (bool, error) {
+	current, err := memTree.GetIndex()
+	if err != nil {
+		return false, err
+	}
+	before, after := current, ""
+	if i := strings.Index(current, indexSectionStart); i >= 0 {
+		before = current[:i]
+		if j := strings.Index(current[i:], indexSectionEnd); j >= 0 {
+			after = current[i+j+len(indexSectionEnd):]
+		}
+	}
+	before = strings.TrimRight(before, "\n") + "\n\n"
+	after = strings.TrimLeft(after, "\n")
+	if after != "" {
+		after = "\n" + after
+	}
+
+	core := listMarkdown(memTree, "core")
+	topics := listMarkdown(memTree, "topics")
+	monthly := listMarkdown(memTree, "monthly")
+	weekly := listMarkdown(memTree, "weekly")
+	// Newest summaries first.
+	sort.Sort(sort.Reverse(sort.StringSlice(monthly)))
+	sort.Sort(sort.Reverse(sort.StringSlice(weekly)))
+
+	titles := map[string]string{}
+	for _, list := range [][]string{core, topics} {
+		for _, rel := range list {
+			titles[rel] = fileTitle(memTree, rel)
+		}
+	}
+
+	build := func(omitted int) string {
+		var b strings.Builder
+		b.WriteString(indexSectionStart + "\n## 记忆目录（自动维护）\n")
+		group := func(name string, list []string, withTitle bool) {
+			if len(list) == 0 {
+				return
+			}
+			b.WriteString("\n### " + name + "\n")
+			for _, rel := range list {
+				if t := titles[rel]; withTitle && t != "" {
+					b.WriteString(fmt.Sprintf("- %s — %s\n", rel, t))
+				} else {
+					b.WriteString("- " + rel + "\n")
+				}
+			}
+		}
+		group("核心", core, true)
+		group("主题", topics, true)
+		group("月总结", monthly, false)
+		group("周总结", weekly, false)
+		if omitted > 0 {
+			b.WriteString(fmt.Sprintf("\n（另有 %d 个较早的条目未列出，可用 memory_search 查找）\n", omitted))
+		}
+		b.WriteString(indexSectionEnd + "\n")
+		return b.String()
+	}
+
+	omitted := 0
+	next := before + build(0) + after
+fit:
+	for len([]rune(next)) > budget {
+		switch {
+		case len(weekly) > 0:
+			weekly = weekly[:len(weekly)-1]
+		case len(monthly) > 0:
+			monthly = monthly[:len(monthly)-1]
+		case len(topics) > 0:
+			topics = topics[:len(topics)-1]
+		default:
+			break fit // only core files left: keep them even over budget
+		}
+		omitted++
+		next = before + build(omitted) + after
+	}
+	if next == current {
+		return false, nil
+	}
+	return true, memTree.UpdateIndex(next)
+}
+
+// fileTitle returns the first markdown heading of a memory file.
+func fileTitle(memTree *MemoryTree, rel string) string {
+	content, err := memTree.GetFile(rel)
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") {
+			return strings.TrimSpace(strings.TrimLeft(line, "#"))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,74 @@
+package memory
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRollup(t *testing.T) {
+	dir := t.TempDir()
+	tree := NewMemoryTree(dir)
+	if err := tree.Init("a"); err != nil {
+		t.Fatal(err)
+	}
+	// 2026-02-02 is a Monday: week 6 is complete, week 7 (Feb 9–15) is not.
+	for _, day := range []string{"02/02", "02/05", "02/10"} {
+		_ = tree.WriteFile("daily/2026/"+day+".md", "# log\n- 用户喜欢喝茶")
+	}
+	_ = tree.WriteFile("daily/2026/01/30.md", "# log\n- 一月的事")
+
+	var calls int
+	llm := func(_ context.Context, system, _ string) (string, error) {
+		calls++
+		if strings.Contains(system, "JSON") {
+			return `好的：[{"file":"core/personality.md","fact":"用户喜欢喝茶"},{"file":"../SOUL.md","fact":"x"},{"file":"topics/tea.md","fact":"常喝龙井"}]`, nil
+		}
+		return "### 概要\n- 喝茶", nil
+	}
+	now := time.Date(2026, 2, 11, 12, 0, 0, 0, time.UTC)
+	res, err := Rollup(context.Background(), tree, "a", RollupConfig{Now: now}, llm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Weeks 5 and 6 and January are complete; February and week 7 are not.
+	if strings.Join(res.Weekly, ",") != "weekly/2026-W05.md,weekly/2026-W06.md" ||
+		strings.Join(res.Monthly, ",") != "monthly/2026-01.md" {
+		t.Fatalf("summaries = %+v", res)
+	}
+	if res.Promoted != 2 || !res.IndexUpdated {
+		t.Fatalf("result = %+v", res)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "SOUL.md")); err == nil {
+		t.Fatal("promotion escaped core/ and topics/")
+	}
+	topic, _ := tree.GetFile("topics/tea.md")
+	if !strings.Contains(topic, "常喝龙井") {
+		t.Fatalf("topics/tea.md = %q", topic)
+	}
+	index, _ := tree.GetIndex()
+	if !strings.Contains(index, "## Quick Reference") || !strings.Contains(index, "- weekly/2026-W06.md") ||
+		!strings.Contains(index, "topics/tea.md — tea") {
+		t.Fatalf("INDEX.md = %s", index)
+	}
+
+	// Second run: nothing pending, no LLM call, INDEX.md unchanged.
+	calls = 0
+	res, err = Rollup(context.Background(), tree, "a", RollupConfig{Now: now}, llm)
+	if err != nil || calls != 0 || res.IndexUpdated {
+		t.Fatalf("second run = %+v, %v (%d calls)", res, err, calls)
+	}
+
+	// A tight budget drops the summaries but keeps the hand-written part.
+	if _, err := refreshIndex(tree, 400); err != nil {
+		t.Fatal(err)
+	}
+	index, _ = tree.GetIndex()
+	if strings.Contains(index, "weekly/") || !strings.Contains(index, "Quick Reference") ||
+		strings.Count(index, indexSectionStart) != 1 {
+		t.Fatalf("budgeted INDEX.md = %s", index)
+	}
+}
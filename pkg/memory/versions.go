@@ -0,0 +1,434 @@
+// Memory versions — every write to memory/, IDENTITY.md and SOUL.md keeps a
+// snapshot, so a bad rewrite by the agent or the consolidator can be diffed
+// and rolled back.
+//
+// Layout: {workspace}.memversions/{escaped path}/log.jsonl lists versions
+// oldest first; {id}.txt holds each snapshot. The history sits beside the
+// workspace, not in it, so the agent's file tools cannot rewrite it. Writes that bypass Track (bash,
+// manual edits on disk) are picked up as "external" versions the next time
+// the file is written or its history is read.
+package memory
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Version sources.
+const (
+	SourceUser         = "user"         // web UI / API
+	SourceAgent        = "agent"        // the agent's own tools (Detail = tool name)
+	SourceConsolidator = "consolidator" // memory consolidation
+	SourceSystem       = "system"       // baseline of a file that existed before tracking
+	SourceExternal     = "external"     // change made outside the tracked paths (bash, disk)
+)
+
+// Version operations.
+const (
+	OpWrite    = "write"
+	OpDelete   = "delete"
+	OpRestore  = "restore"
+	OpBaseline = "baseline"
+)
+
+// ErrVersionNotFound is returned for an unknown version id.
+var ErrVersionNotFound = errors.New("version not found")
+
+// Author attributes a version to whoever made the change.
+type Author struct {
+	Source string `json:"source"`           // one of the Source* constants
+	Detail string `json:"detail,omitempty"` // tool name, username, ...
+}
+
+// Version is one snapshot of a tracked file.
+type Version struct {
+	ID           int    `json:"id"`   // 1-based, per file
+	Path         string `json:"path"` // relative to the workspace, e.g. memory/core/prefs.md
+	Time         int64  `json:"time"` // unix ms
+	Author       Author `json:"author"`
+	Op           string `json:"op"`
+	Size         int    `json:"size"`
+	Hash         string `json:"hash"`                   // sha256 of the content, first 16 hex chars
+	RestoredFrom int    `json:"restoredFrom,omitempty"` // OpRestore: the version restored
+}
+
+var (
+	versionMu   sync.Mutex
+	maxVersions = 50
+	maxAge      = 90 * 24 * time.Hour
+)
+
+// SetVersionRetention sets how many versions are kept per file and for how
+// many days. Zero keeps the default (50 versions, 90 days); negative removes
+// the limit. The latest version is never pruned.
+func SetVersionRetention(perFile, days int) {
+	versionMu.Lock()
+	defer versionMu.Unlock()
+	switch {
+	case perFile > 0:
+		maxVersions = perFile
+	case perFile < 0:
+		maxVersions = 0
+	}
+	switch {
+	case days > 0:
+		maxAge = time.Duration(days) * 24 * time.Hour
+	case days < 0:
+		maxAge = 0
+	}
+}
+
+// Tracked reports whether a workspace-relative path is versioned.
+func Tracked(relPath string) bool {
+	rel := filepath.ToSlash(filepath.Clean(relPath))
+	switch rel {
+	case "IDENTITY.md", "SOUL.md":
+		return true
+	}
+	return strings.HasPrefix(rel, "memory/") && indexable(strings.TrimPrefix(rel, "memory/"))
+}
+
+// Track runs write, which changes one tracked file, and records the result
+// as a new version attributed to by. Untracked paths just run write.
+func Track(workspaceDir, relPath string, by Author, write func() error) error {
+	rel := filepath.ToSlash(filepath.Clean(relPath))
+	if !Tracked(rel) {
+		return write()
+	}
+	versionMu.Lock()
+	syncVersions(workspaceDir, rel)
+	versionMu.Unlock()
+	if err := write(); err != nil {
+		return err
+	}
+	versionMu.Lock()
+	defer versionMu.Unlock()
+	_, err := recordVersion(workspaceDir, rel, by, "", 0)
+	return err
+}
+
+// ListVersions returns a tracked file's versions, newest first.
+func ListVersions(workspaceDir, relPath string) ([]Version, error) {
+	rel := filepath.ToSlash(filepath.Clean(relPath))
+	if !Tracked(rel) {
+		return nil, fmt.Errorf("%s is not versioned", rel)
+	}
+	versionMu.Lock()
+	defer versionMu.Unlock()
+	syncVersions(workspaceDir, rel)
+	vs, err := readVersionLog(workspaceDir, rel)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Version, len(vs))
+	for i, v := range vs {
+		out[len(vs)-1-i] = v
+	}
+	return out, nil
+}
+
+// ReadVersion returns the content of one version.
+func ReadVersion(workspaceDir, relPath string, id int) (string, Version, error) {
+	rel := filepath.ToSlash(filepath.Clean(relPath))
+	versionMu.Lock()
+	defer versionMu.Unlock()
+	return readVersion(workspaceDir, rel, id)
+}
+
+// Restore writes version id back to the file and records it as a new
+// version, so the restore itself can be undone.
+func Restore(workspaceDir, relPath string, id int, by Author) (*Version, error) {
+	rel := filepath.ToSlash(filepath.Clean(relPath))
+	versionMu.Lock()
+	defer versionMu.Unlock()
+	content, v, err := readVersion(workspaceDir, rel, id)
+	if err != nil {
+		return nil, err
+	}
+	syncVersions(workspaceDir, rel)
+	abs := filepath.Join(workspaceDir, filepath.FromSlash(rel))
+	if v.Op == OpDelete {
+		if err := os.Remove(abs); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	} else {
+		if err := os.MkdirAll(filepath.Dir(abs), 0755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(abs, []byte(content), 0644); err != nil {
+			return nil, err
+		}
+	}
+	if strings.HasPrefix(rel, "memory/") {
+		OpenIndex(workspaceDir).UpdateFile(strings.TrimPrefix(rel, "memory/"))
+	}
+	op := OpRestore
+	if v.Op == OpDelete {
+		op = OpDelete
+	}
+	return recordVersion(workspaceDir, rel, by, op, id)
+}
+
+// DiffResult compares two versions of a file.
+type DiffResult struct {
+	Path    string   `json:"path"`
+	From    *Version `json:"from,omitempty"` // nil = empty file
+	To      *Version `json:"to,omitempty"`   // nil = current file on disk
+	Added   int      `json:"added"`
+	Removed int      `json:"removed"`
+	Unified string   `json:"unified"` // unified diff, 3 lines of context
+}
+
+// DiffVersions diffs version from against version to. from = 0 diffs
+// against an empty file; to = 0 against the current file on disk.
+func DiffVersions(workspaceDir, relPath string, from, to int) (*DiffResult, error) {
+	rel := filepath.ToSlash(filepath.Clean(relPath))
+	versionMu.Lock()
+	defer versionMu.Unlock()
+	res := &DiffResult{Path: rel}
+	var a, b string
+	if from > 0 {
+		content, v, err := readVersion(workspaceDir, rel, from)
+		if err != nil {
+			return nil, err
+		}
+		a, res.From = content, &v
+	}
+	if to > 0 {
+		content, v, err := readVersion(workspaceDir, rel, to)
+		if err != nil {
+			return nil, err
+		}
+		b, res.To = content, &v
+	} else {
+		data, err := os.ReadFile(filepath.Join(workspaceDir, filepath.FromSlash(rel)))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		b = string(data)
+	}
+	res.Unified, res.Added, res.Removed = unifiedDiff(rel, a, b, 3)
+	return res, nil
+}
+
+// ── storage ──────────────────────────────────────────────────────────────────
+
+// migratedRoots records workspaces whose legacy history has been moved.
+var migratedRoots sync.Map
+
+// versionsRoot returns the history directory of a workspace
+// (agents/<id>/workspace -> agents/<id>/workspace.memversions). History from
+// older builds, kept in {workspace}/.memversions, is moved there on first use.
+func versionsRoot(workspaceDir string) string {
+	ws := filepath.Clean(workspaceDir)
+	root := ws + ".memversions"
+	if _, done := migratedRoots.LoadOrStore(ws, true); !done {
+		legacy := filepath.Join(ws, ".memversions")
+		if _, err := os.Stat(legacy); err == nil {
+			if _, err := os.Stat(root); os.IsNotExist(err) {
+				if err := os.Rename(legacy, root); err != nil {
+					log.Printf("[memory] move version history %s: %v", legacy, err)
+				}
+			}
+		}
+	}
+	return root
+}
+
+func versionDir(workspaceDir, rel string) string {
+	return filepath.Join(versionsRoot(workspaceDir), url.PathEscape(rel))
+}
+
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+func readVersionLog(workspaceDir, rel string) ([]Version, error) {
+	f, err := os.Open(filepath.Join(versionDir(workspaceDir, rel), "log.jsonl"))
+	if os.IsNotExist(err) {
+		return []Version{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	vs := []Version{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var v Version
+		if json.Unmarshal(sc.Bytes(), &v) == nil && v.ID > 0 {
+			vs = append(vs, v)
+		}
+	}
+	return vs, sc.Err()
+}
+
+func writeVersionLog(workspaceDir, rel string, vs []Version) error {
+	var sb strings.Builder
+	for _, v := range vs {
+		line, _ := json.Marshal(v)
+		sb.Write(line)
+		sb.WriteByte('\n')
+	}
+	path := filepath.Join(versionDir(workspaceDir, rel), "log.jsonl")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(sb.String()), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func readVersion(workspaceDir, rel string, id int) (string, Version, error) {
+	vs, err := readVersionLog(workspaceDir, rel)
+	if err != nil {
+		return "", Version{}, err
+	}
+	for _, v := range vs {
+		if v.ID == id {
+			data, err := os.ReadFile(filepath.Join(versionDir(workspaceDir, rel), strconv.Itoa(id)+".txt"))
+			if err != nil && !(v.Op == OpDelete && os.IsNotExist(err)) {
+				return "", v, err
+			}
+			return string(data), v, nil
+		}
+	}
+	return "", Version{}, ErrVersionNotFound
+}
+
+// syncVersions records a baseline for a file that predates tracking, or an
+// external version when the file changed since its last version.
+// Must be called with versionMu held.
+func syncVersions(workspaceDir, rel string) {
+	vs, err := readVersionLog(workspaceDir, rel)
+	if err != nil {
+		return
+	}
+	data, err := os.ReadFile(filepath.Join(workspaceDir, filepath.FromSlash(rel)))
+	exists := err == nil
+	switch {
+	case len(vs) == 0 && exists:
+		_, _ = recordVersion(workspaceDir, rel, Author{Source: SourceSystem}, OpBaseline, 0)
+	case len(vs) > 0:
+		last := vs[len(vs)-1]
+		if exists && (last.Op == OpDelete || last.Hash != contentHash(data)) ||
+			!exists && last.Op != OpDelete {
+			_, _ = recordVersion(workspaceDir, rel, Author{Source: SourceExternal}, "", 0)
+		}
+	}
+}
+
+// recordVersion snapshots the file's current content. An empty op means
+// write, or delete when the file is gone. Writes that leave the content
+// unchanged are not recorded. Must be called with versionMu held.
+func recordVersion(workspaceDir, rel string, by Author, op string, restoredFrom int) (*Version, error) {
+	vs, err := readVersionLog(workspaceDir, rel)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(workspaceDir, filepath.FromSlash(rel)))
+	exists := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if op == "" {
+		op = OpWrite
+		if !exists {
+			op = OpDelete
+		}
+	}
+	hash := ""
+	if exists {
+		hash = contentHash(data)
+	}
+	if n := len(vs); n > 0 && restoredFrom == 0 {
+		last := vs[n-1]
+		if (last.Op == OpDelete) == !exists && last.Hash == hash {
+			return &last, nil
+		}
+	}
+	if !exists && len(vs) == 0 {
+		return nil, nil
+	}
+
+	v := Version{
+		ID:           1,
+		Path:         rel,
+		Time:         time.Now().UnixMilli(),
+		Author:       by,
+		Op:           op,
+		Size:         len(data),
+		Hash:         hash,
+		RestoredFrom: restoredFrom,
+	}
+	if n := len(vs); n > 0 {
+		v.ID = vs[n-1].ID + 1
+	}
+	dir := versionDir(workspaceDir, rel)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if exists {
+		if err := os.WriteFile(filepath.Join(dir, strconv.Itoa(v.ID)+".txt"), data, 0644); err != nil {
+			return nil, err
+		}
+	}
+	vs = append(vs, v)
+	vs = pruneVersions(dir, vs, time.Now())
+	if err := writeVersionLog(workspaceDir, rel, vs); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// pruneVersions drops versions over the count and age limits, oldest first,
+// always keeping the latest. Must be called with versionMu held.
+func pruneVersions(dir string, vs []Version, now time.Time) []Version {
+	drop := 0
+	if maxVersions > 0 && len(vs) > maxVersions {
+		drop = len(vs) - maxVersions
+	}
+	if maxAge > 0 {
+		cutoff := now.Add(-maxAge).UnixMilli()
+		for drop < len(vs)-1 && vs[drop].Time < cutoff {
+			drop++
+		}
+	}
+	for _, v := range vs[:drop] {
+		_ = os.Remove(filepath.Join(dir, strconv.Itoa(v.ID)+".txt"))
+	}
+	return vs[drop:]
+}
+
+// VersionedFiles lists the workspace-relative paths that have history,
+// sorted.
+func VersionedFiles(workspaceDir string) ([]string, error) {
+	entries, err := os.ReadDir(versionsRoot(workspaceDir))
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := []string{}
+	for _, e := range entries {
+		if rel, err := url.PathUnescape(e.Name()); err == nil && e.IsDir() {
+			out = append(out, rel)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
@@ -0,0 +1,88 @@
+package memory
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVersions(t *testing.T) {
+	dir := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(dir, "memory", "core"), 0755)
+	_ = os.WriteFile(filepath.Join(dir, "memory", "core", "prefs.md"), []byte("喜欢乌龙茶\n"), 0644)
+
+	tree := NewMemoryTree(dir).As(Author{Source: SourceAgent, Detail: "write"})
+	if err := tree.WriteFile("core/prefs.md", "喜欢乌龙茶\n不喝咖啡\n"); err != nil {
+		t.Fatal(err)
+	}
+	// A change made outside Track is picked up as an external version.
+	_ = os.WriteFile(filepath.Join(dir, "memory", "core", "prefs.md"), []byte("乱码\n"), 0644)
+
+	vs, err := ListVersions(dir, "memory/core/prefs.md")
+	if err != nil || len(vs) != 3 {
+		t.Fatalf("versions = %+v, %v", vs, err)
+	}
+	if vs[2].Op != OpBaseline || vs[1].Author.Source != SourceAgent || vs[0].Author.Source != SourceExternal {
+		t.Fatalf("versions = %+v", vs)
+	}
+
+	diff, err := DiffVersions(dir, "memory/core/prefs.md", 1, 2)
+	if err != nil || diff.Added != 1 || diff.Removed != 0 || !strings.Contains(diff.Unified, "+不喝咖啡") {
+		t.Fatalf("diff = %+v, %v", diff, err)
+	}
+
+	v, err := Restore(dir, "memory/core/prefs.md", 2, Author{Source: SourceUser})
+	if err != nil || v.ID != 4 || v.Op != OpRestore || v.RestoredFrom != 2 {
+		t.Fatalf("restore = %+v, %v", v, err)
+	}
+	if got, _ := tree.GetFile("core/prefs.md"); got != "喜欢乌龙茶\n不喝咖啡\n" {
+		t.Fatalf("restored content = %q", got)
+	}
+	if _, _, err := ReadVersion(dir, "memory/core/prefs.md", 99); err != ErrVersionNotFound {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestVersionRetention(t *testing.T) {
+	SetVersionRetention(3, 0)
+	defer SetVersionRetention(50, 90)
+	dir := t.TempDir()
+	tree := NewMemoryTree(dir)
+	for _, s := range []string{"a", "b", "c", "d", "e"} {
+		_ = tree.WriteFile("topics/x.md", s)
+	}
+	vs, _ := ListVersions(dir, "memory/topics/x.md")
+	if len(vs) != 3 || vs[0].ID != 5 || vs[2].ID != 3 {
+		t.Fatalf("versions = %+v", vs)
+	}
+	if _, err := os.Stat(filepath.Join(versionDir(dir, "memory/topics/x.md"), "1.txt")); !os.IsNotExist(err) {
+		t.Fatal("pruned snapshot still on disk")
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	got, add, del := unifiedDiff("f", "a\nb\nc\nd\n", "a\nx\nc\nd\ne\n", 1)
+	want := "--- a/f\n+++ b/f\n@@ -1,4 +1,5 @@\n a\n-b\n+x\n c\n d\n+e\n"
+	if got != want || add != 2 || del != 1 {
+		t.Fatalf("diff = %q (+%d -%d)", got, add, del)
+	}
+}
+
+func TestVersionsLiveOutsideWorkspace(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "workspace")
+	legacy := filepath.Join(dir, ".memversions", "memory%2Fold.md")
+	_ = os.MkdirAll(legacy, 0755)
+	_ = os.WriteFile(filepath.Join(legacy, "log.jsonl"), nil, 0644)
+
+	_ = NewMemoryTree(dir).WriteFile("topics/x.md", "a")
+	if _, err := os.Stat(filepath.Join(dir, ".memversions")); !os.IsNotExist(err) {
+		t.Fatal("history left inside the workspace")
+	}
+	if vs, _ := ListVersions(dir, "memory/topics/x.md"); len(vs) != 1 {
+		t.Fatalf("versions = %+v", vs)
+	}
+	if files, _ := VersionedFiles(dir); len(files) != 2 {
+		t.Fatalf("versioned files = %v", files)
+	}
+}
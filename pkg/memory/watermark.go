@@ -0,0 +1,114 @@
+// Package memory — consolidation watermarks and entry provenance.
+// memory-watermarks.json remembers, per session, the newest message already
+// summarised so each run only reads what is new; memory-provenance.jsonl
+// records which messages every daily entry was written from.
+package memory
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	watermarkFilename  = "memory-watermarks.json"
+	provenanceFilename = "memory-provenance.jsonl"
+)
+
+// Watermark is the consolidation progress of one session.
+type Watermark struct {
+	LastTimestamp int64 `json:"lastTimestamp"` // newest summarised message (unix ms)
+	Messages      int   `json:"messages"`      // messages summarised so far
+	UpdatedAt     int64 `json:"updatedAt"`     // unix ms
+}
+
+// ReadWatermarks returns the per-session watermarks of a workspace.
+func ReadWatermarks(workspaceDir string) (map[string]Watermark, error) {
+	data, err := os.ReadFile(filepath.Join(workspaceDir, watermarkFilename))
+	if os.IsNotExist(err) {
+		return map[string]Watermark{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	marks := map[string]Watermark{}
+	if err := json.Unmarshal(data, &marks); err != nil {
+		return nil, err
+	}
+	return marks, nil
+}
+
+// WriteWatermarks persists the watermarks atomically.
+func WriteWatermarks(workspaceDir string, marks map[string]Watermark) error {
+	data, err := json.MarshalIndent(marks, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(workspaceDir, watermarkFilename)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// EntrySource lists the messages of one session behind a daily entry.
+type EntrySource struct {
+	SessionID string  `json:"sessionId"`
+	Title     string  `json:"title,omitempty"`
+	Messages  []int64 `json:"messages"` // timestamps (unix ms) of every message summarised
+}
+
+// ProvenanceRecord describes one consolidation chunk and what it produced.
+type ProvenanceRecord struct {
+	ID      string        `json:"id"`   // also written into the entry as <!-- consolidation:ID -->
+	Time    int64         `json:"time"` // unix ms
+	File    string        `json:"file"` // daily log, relative to memory/
+	Heading string        `json:"heading,omitempty"`
+	Written bool          `json:"written"` // false: the model found nothing new
+	Sources []EntrySource `json:"sources"`
+}
+
+// AppendProvenance appends one record to memory-provenance.jsonl.
+func AppendProvenance(workspaceDir string, rec ProvenanceRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(workspaceDir, provenanceFilename), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// ReadProvenance returns provenance records newest first, optionally only
+// those for one daily file. Returns at most n records (0 for all).
+func ReadProvenance(workspaceDir, file string, n int) ([]ProvenanceRecord, error) {
+	data, err := os.ReadFile(filepath.Join(workspaceDir, provenanceFilename))
+	if os.IsNotExist(err) {
+		return []ProvenanceRecord{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	out := []ProvenanceRecord{}
+	for i := len(lines) - 1; i >= 0; i-- {
+		var rec ProvenanceRecord
+		if json.Unmarshal([]byte(lines[i]), &rec) != nil {
+			continue
+		}
+		if file != "" && rec.File != file {
+			continue
+		}
+		out = append(out, rec)
+		if n > 0 && len(out) >= n {
+			break
+		}
+	}
+	return out, nil
+}
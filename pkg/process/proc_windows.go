@@ -0,0 +1,15 @@
+//go:build windows
+
+package process
+
+import "os/exec"
+
+func setProcGroup(_ *exec.Cmd) {}
+
+func terminate(cmd *exec.Cmd) {
+	_ = cmd.Process.Kill()
+}
+
+func forceKill(cmd *exec.Cmd) {
+	_ = cmd.Process.Kill()
+}
@@ -0,0 +1,96 @@
+package process
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// ringLog is an io.Writer that keeps at most maxBytes of output on disk by
+// rotating between two halves: <path> (current) and <path>.1 (previous).
+// Reading the tail concatenates both, so the newest output is always kept.
+type ringLog struct {
+	mu       sync.Mutex
+	path     string
+	half     int64
+	f        *os.File
+	size     int64 // bytes in the current half
+	total    int64 // bytes ever written
+	onUpdate func(total int64)
+}
+
+func openRingLog(path string, maxBytes int64) (*ringLog, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	_ = os.Remove(path + ".1")
+	half := maxBytes / 2
+	if half < 1024 {
+		half = 1024
+	}
+	return &ringLog{path: path, half: half, f: f}, nil
+}
+
+func (l *ringLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return len(p), nil
+	}
+	// A chunk larger than a half keeps only its tail, so the file never
+	// exceeds the cap; the total still counts every byte.
+	data := p
+	if int64(len(data)) > l.half {
+		data = data[int64(len(data))-l.half:]
+	}
+	if l.size+int64(len(data)) > l.half && l.size > 0 {
+		l.f.Close()
+		_ = os.Rename(l.path, l.path+".1")
+		f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			l.f = nil
+			return 0, err
+		}
+		l.f, l.size = f, 0
+	}
+	n, err := l.f.Write(data)
+	l.size += int64(n)
+	if err == nil {
+		n = len(p)
+	}
+	l.total += int64(n)
+	if l.onUpdate != nil {
+		l.onUpdate(l.total)
+	}
+	return n, err
+}
+
+func (l *ringLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+// readTail returns up to n bytes from the end of the log at path (n <= 0 = all kept).
+func readTail(path string, n int64) (string, error) {
+	var buf []byte
+	for _, p := range []string{path + ".1", path} {
+		data, err := os.ReadFile(p)
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		buf = append(buf, data...)
+	}
+	if n > 0 && int64(len(buf)) > n {
+		buf = buf[int64(len(buf))-n:]
+	}
+	return string(buf), nil
+}
+
+var _ io.WriteCloser = (*ringLog)(nil)
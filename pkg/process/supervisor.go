@@ -0,0 +1,395 @@
+package process
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// killGrace is how long Kill waits after SIGTERM before sending SIGKILL.
+const killGrace = 5 * time.Second
+
+// entry is the supervisor's internal record of one process.
+type entry struct {
+	info   Process
+	cmd    *exec.Cmd
+	log    *ringLog
+	done   chan struct{}
+	killed bool
+}
+
+// Supervisor owns all agent background processes.
+type Supervisor struct {
+	mu      sync.RWMutex
+	procs   map[string]*entry
+	dir     string // logs + processes.json
+	limits  Limits
+	persist chan struct{}
+	writeMu sync.Mutex // serialises processes.json writes
+}
+
+// New creates a Supervisor storing logs and metadata under dir. Processes
+// recorded as running by a previous server instance are marked lost.
+func New(dir string, limits Limits) *Supervisor {
+	s := &Supervisor{
+		procs:   make(map[string]*entry),
+		dir:     dir,
+		limits:  limits.withDefaults(),
+		persist: make(chan struct{}, 1),
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("[process] cannot create %s: %v", dir, err)
+	}
+	s.load()
+	go s.persistLoop()
+	return s
+}
+
+// SetLimits replaces the limits applied to future Start calls.
+func (s *Supervisor) SetLimits(l Limits) {
+	s.mu.Lock()
+	s.limits = l.withDefaults()
+	s.mu.Unlock()
+}
+
+// Start launches a command in the background and returns immediately.
+func (s *Supervisor) Start(opts StartOpts) (*Process, error) {
+	if opts.AgentID == "" {
+		return nil, fmt.Errorf("agentID is required")
+	}
+	if opts.Command == "" {
+		return nil, fmt.Errorf("command is required")
+	}
+
+	s.mu.Lock()
+	limits := s.limits
+	running := 0
+	for _, e := range s.procs {
+		if e.info.AgentID == opts.AgentID && e.info.Running() {
+			running++
+		}
+	}
+	if running >= limits.MaxPerAgent {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("agent %q already has %d running processes (limit %d); stop one with process_kill first", opts.AgentID, running, limits.MaxPerAgent)
+	}
+	id := uuid.New().String()[:8]
+	e := &entry{
+		info: Process{
+			ID:        id,
+			AgentID:   opts.AgentID,
+			Label:     opts.Label,
+			Command:   opts.Command,
+			Dir:       opts.Dir,
+			Status:    StatusRunning,
+			StartedAt: time.Now().UnixMilli(),
+		},
+		done: make(chan struct{}),
+	}
+	s.procs[id] = e
+	s.mu.Unlock()
+
+	rl, err := openRingLog(s.logPath(id), limits.MaxLogBytes)
+	if err != nil {
+		s.fail(e, err)
+		return nil, err
+	}
+	rl.onUpdate = func(total int64) {
+		s.mu.Lock()
+		e.info.LogBytes = total
+		s.mu.Unlock()
+	}
+	e.log = rl
+
+	cmd := exec.Command("bash", "-c", opts.Command)
+	cmd.Dir = opts.Dir
+	cmd.Env = opts.Env
+	cmd.Stdout = rl
+	cmd.Stderr = rl
+	setProcGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		rl.Close()
+		s.fail(e, err)
+		return nil, fmt.Errorf("start failed: %w", err)
+	}
+
+	s.mu.Lock()
+	e.cmd = cmd
+	e.info.PID = cmd.Process.Pid
+	info := e.info
+	s.mu.Unlock()
+	s.save()
+
+	log.Printf("[process] %s started: agent=%s pid=%d cmd=%q", id, opts.AgentID, info.PID, opts.Command)
+	go s.wait(e, limits.MaxRuntime)
+	s.prune(opts.AgentID)
+	return &info, nil
+}
+
+// wait reaps the process and records how it ended.
+func (s *Supervisor) wait(e *entry, maxRuntime time.Duration) {
+	var timer *time.Timer
+	if maxRuntime > 0 {
+		timer = time.AfterFunc(maxRuntime, func() {
+			log.Printf("[process] %s exceeded max runtime %s, killing", e.info.ID, maxRuntime)
+			_ = s.Kill(e.info.ID)
+		})
+	}
+	err := e.cmd.Wait()
+	if timer != nil {
+		timer.Stop()
+	}
+	e.log.Close()
+
+	s.mu.Lock()
+	e.info.EndedAt = time.Now().UnixMilli()
+	code := e.cmd.ProcessState.ExitCode()
+	e.info.ExitCode = &code
+	switch {
+	case e.killed:
+		e.info.Status = StatusKilled
+	case err != nil:
+		e.info.Status = StatusFailed
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			e.info.Error = err.Error()
+		}
+	default:
+		e.info.Status = StatusExited
+	}
+	status := e.info.Status
+	s.mu.Unlock()
+	close(e.done)
+	s.save()
+	log.Printf("[process] %s ended: %s (exit %d)", e.info.ID, status, code)
+}
+
+func (s *Supervisor) fail(e *entry, err error) {
+	s.mu.Lock()
+	e.info.Status = StatusFailed
+	e.info.Error = err.Error()
+	e.info.EndedAt = time.Now().UnixMilli()
+	s.mu.Unlock()
+	close(e.done)
+	s.save()
+}
+
+// Kill stops a running process: SIGTERM to its process group, then SIGKILL
+// after a grace period. It returns once the process has exited.
+func (s *Supervisor) Kill(id string) error {
+	s.mu.Lock()
+	e, ok := s.procs[id]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("process %q not found", id)
+	}
+	if !e.info.Running() || e.cmd == nil {
+		status := e.info.Status
+		s.mu.Unlock()
+		return fmt.Errorf("process %q is not running (status: %s)", id, status)
+	}
+	e.killed = true
+	cmd := e.cmd
+	s.mu.Unlock()
+
+	terminate(cmd)
+	select {
+	case <-e.done:
+	case <-time.After(killGrace):
+		forceKill(cmd)
+		<-e.done
+	}
+	return nil
+}
+
+// Wait blocks until the process exits or the timeout elapses; it reports
+// whether the process has exited.
+func (s *Supervisor) Wait(id string, timeout time.Duration) bool {
+	s.mu.RLock()
+	e, ok := s.procs[id]
+	s.mu.RUnlock()
+	if !ok {
+		return true
+	}
+	select {
+	case <-e.done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Remove forgets a finished process and deletes its logs.
+func (s *Supervisor) Remove(id string) error {
+	s.mu.Lock()
+	e, ok := s.procs[id]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("process %q not found", id)
+	}
+	if e.info.Running() {
+		s.mu.Unlock()
+		return fmt.Errorf("process %q is still running", id)
+	}
+	delete(s.procs, id)
+	s.mu.Unlock()
+	s.removeLogs(id)
+	s.save()
+	return nil
+}
+
+// Get returns a copy of a process by ID.
+func (s *Supervisor) Get(id string) (*Process, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, ok := s.procs[id]
+	if !ok {
+		return nil, false
+	}
+	cp := e.info
+	return &cp, true
+}
+
+// List returns processes sorted by start time desc.
+// If agentID is non-empty, filter to that agent's processes.
+func (s *Supervisor) List(agentID string) []*Process {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]*Process, 0, len(s.procs))
+	for _, e := range s.procs {
+		if agentID != "" && e.info.AgentID != agentID {
+			continue
+		}
+		cp := e.info
+		result = append(result, &cp)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].StartedAt > result[j].StartedAt
+	})
+	return result
+}
+
+// Logs returns up to tailBytes of the most recent output (0 = everything kept).
+func (s *Supervisor) Logs(id string, tailBytes int64) (string, error) {
+	if _, ok := s.Get(id); !ok {
+		return "", fmt.Errorf("process %q not found", id)
+	}
+	return readTail(s.logPath(id), tailBytes)
+}
+
+// Shutdown kills every running process; call on server exit.
+func (s *Supervisor) Shutdown() {
+	var wg sync.WaitGroup
+	for _, p := range s.List("") {
+		if p.Running() {
+			wg.Add(1)
+			go func(id string) {
+				defer wg.Done()
+				_ = s.Kill(id)
+			}(p.ID)
+		}
+	}
+	wg.Wait()
+	s.writeState()
+}
+
+// prune drops the oldest finished processes of an agent beyond KeepExited.
+func (s *Supervisor) prune(agentID string) {
+	s.mu.Lock()
+	keep := s.limits.KeepExited
+	var finished []*entry
+	for _, e := range s.procs {
+		if e.info.AgentID == agentID && !e.info.Running() {
+			finished = append(finished, e)
+		}
+	}
+	sort.Slice(finished, func(i, j int) bool { return finished[i].info.StartedAt > finished[j].info.StartedAt })
+	var drop []string
+	for i := keep; i < len(finished); i++ {
+		drop = append(drop, finished[i].info.ID)
+		delete(s.procs, finished[i].info.ID)
+	}
+	s.mu.Unlock()
+	for _, id := range drop {
+		s.removeLogs(id)
+	}
+}
+
+// ── Persistence ──────────────────────────────────────────────────────────────
+
+func (s *Supervisor) logPath(id string) string {
+	return filepath.Join(s.dir, id+".log")
+}
+
+func (s *Supervisor) removeLogs(id string) {
+	_ = os.Remove(s.logPath(id))
+	_ = os.Remove(s.logPath(id) + ".1")
+}
+
+func (s *Supervisor) statePath() string {
+	return filepath.Join(s.dir, "processes.json")
+}
+
+func (s *Supervisor) load() {
+	data, err := os.ReadFile(s.statePath())
+	if err != nil {
+		return
+	}
+	var list []Process
+	if err := json.Unmarshal(data, &list); err != nil {
+		log.Printf("[process] ignoring corrupt %s: %v", s.statePath(), err)
+		return
+	}
+	for _, p := range list {
+		if p.Status == StatusRunning {
+			p.Status = StatusLost
+			p.Error = "server restarted while the process was running"
+			if p.EndedAt == 0 {
+				p.EndedAt = time.Now().UnixMilli()
+			}
+		}
+		done := make(chan struct{})
+		close(done)
+		s.procs[p.ID] = &entry{info: p, done: done}
+	}
+}
+
+// save schedules a debounced write of processes.json.
+func (s *Supervisor) save() {
+	select {
+	case s.persist <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Supervisor) persistLoop() {
+	for range s.persist {
+		s.writeState()
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+func (s *Supervisor) writeState() {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	list := s.List("")
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return
+	}
+	tmp := s.statePath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		log.Printf("[process] persist: %v", err)
+		return
+	}
+	_ = os.Rename(tmp, s.statePath())
+}
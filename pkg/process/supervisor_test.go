@@ -0,0 +1,65 @@
+package process
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSupervisor(t *testing.T) {
+	dir := t.TempDir()
+	s := New(dir, Limits{MaxPerAgent: 1, MaxLogBytes: 4096})
+
+	p, err := s.Start(StartOpts{AgentID: "a1", Command: "echo hello; sleep 30"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Start(StartOpts{AgentID: "a1", Command: "true"}); err == nil {
+		t.Error("per-agent limit should reject a second running process")
+	}
+	if _, err := s.Start(StartOpts{AgentID: "a2", Command: "true"}); err != nil {
+		t.Errorf("other agents are not affected by a1's limit: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		out, _ := s.Logs(p.ID, 0)
+		if strings.Contains(out, "hello") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("output not captured: %q", out)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if err := s.Kill(p.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Get(p.ID); got.Status != StatusKilled {
+		t.Errorf("status = %s, want killed", got.Status)
+	}
+
+	// Output beyond the cap is rotated away; the newest bytes are kept.
+	p2, err := s.Start(StartOpts{AgentID: "a1", Command: "for i in $(seq 1 2000); do echo line-$i; done"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Wait(p2.ID, 5*time.Second) {
+		t.Fatal("process did not exit")
+	}
+	out, _ := s.Logs(p2.ID, 0)
+	if len(out) > 4096 || !strings.HasSuffix(out, "line-2000\n") {
+		t.Errorf("ring log: len=%d tail=%q", len(out), out[len(out)-20:])
+	}
+	if got, _ := s.Get(p2.ID); got.Status != StatusExited || got.LogBytes <= 4096 {
+		t.Errorf("unexpected final state: %+v", got)
+	}
+
+	// A new supervisor over the same directory remembers finished processes.
+	s.Shutdown()
+	s2 := New(dir, Limits{})
+	if _, ok := s2.Get(p2.ID); !ok {
+		t.Error("process metadata should survive a restart")
+	}
+}
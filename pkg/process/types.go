@@ -0,0 +1,87 @@
+// Package process supervises long-running background processes started by
+// agents (dev servers, long builds, crawlers). Output is captured to
+// size-capped log files and process metadata survives across agent turns.
+package process
+
+import (
+	"fmt"
+	"time"
+)
+
+// Status represents the lifecycle state of a managed process.
+type Status string
+
+const (
+	StatusRunning Status = "running"
+	StatusExited  Status = "exited" // exited with code 0
+	StatusFailed  Status = "failed" // exited non-zero or could not be waited on
+	StatusKilled  Status = "killed" // stopped via Kill or runtime limit
+	StatusLost    Status = "lost"   // was running when the server restarted
+)
+
+// Process is the public, JSON-serialisable view of a managed process.
+type Process struct {
+	ID        string `json:"id"`
+	AgentID   string `json:"agentId"`
+	Label     string `json:"label,omitempty"`
+	Command   string `json:"command"`
+	Dir       string `json:"dir,omitempty"`
+	PID       int    `json:"pid"`
+	Status    Status `json:"status"`
+	ExitCode  *int   `json:"exitCode,omitempty"`
+	Error     string `json:"error,omitempty"`
+	LogBytes  int64  `json:"logBytes"`  // total bytes of output produced
+	StartedAt int64  `json:"startedAt"` // unix ms
+	EndedAt   int64  `json:"endedAt,omitempty"`
+}
+
+// Running reports whether the process is still alive.
+func (p *Process) Running() bool { return p.Status == StatusRunning }
+
+// Duration returns a human-readable elapsed time string.
+func (p *Process) Duration() string {
+	end := p.EndedAt
+	if end == 0 {
+		end = time.Now().UnixMilli()
+	}
+	d := time.Duration(end-p.StartedAt) * time.Millisecond
+	switch {
+	case d < time.Second:
+		return "< 1s"
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm%ds", int(d.Minutes()), int(d.Seconds())%60)
+	}
+	return fmt.Sprintf("%dh%dm", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// StartOpts configures a new managed process.
+type StartOpts struct {
+	AgentID string   // owning agent
+	Command string   // shell command, run via bash -c
+	Label   string   // optional human label
+	Dir     string   // working directory
+	Env     []string // full environment (already sanitised by the caller)
+}
+
+// Limits bounds what a single agent may run.
+type Limits struct {
+	MaxPerAgent int           // concurrent running processes per agent (default 3)
+	MaxLogBytes int64         // on-disk log cap per process (default 1 MiB)
+	MaxRuntime  time.Duration // 0 = unlimited
+	KeepExited  int           // finished processes remembered per agent (default 20)
+}
+
+func (l Limits) withDefaults() Limits {
+	if l.MaxPerAgent <= 0 {
+		l.MaxPerAgent = 3
+	}
+	if l.MaxLogBytes <= 0 {
+		l.MaxLogBytes = 1 << 20
+	}
+	if l.KeepExited <= 0 {
+		l.KeepExited = 20
+	}
+	return l
+}
@@ -0,0 +1,360 @@
+// Package retention runs the background janitor that applies the session
+// retention policies (archive after N idle days, delete after M days,
+// per-agent size caps) and trims conversation logs, cron run logs and
+// finished background tasks.
+package retention
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sunhuihui6688-star/ai-panel/pkg/config"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/convlog"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/session"
+)
+
+// activeGrace protects recently used sessions from the size cap.
+const activeGrace = 24 * time.Hour
+
+// Target is one agent the janitor looks after.
+type Target struct {
+	ID         string
+	AgentDir   string // contains convlogs/
+	SessionDir string // subagent sessions live in SessionDir/subagent
+	Policy     *config.RetentionPolicy
+}
+
+// Options wires the janitor to the rest of the server. Any func may be nil.
+type Options struct {
+	Config        func() config.RetentionConfig
+	Agents        func() []Target
+	PruneCronRuns func(before time.Time, dryRun bool) (int, int64, error)
+	PruneTasks    func(before time.Time, dryRun bool) (int, int64)
+}
+
+// Action records one archived or deleted session.
+type Action struct {
+	AgentID   string `json:"agentId"`
+	SessionID string `json:"sessionId"`
+	Channel   string `json:"channel"`
+	Archived  bool   `json:"archived,omitempty"` // the session was already archived
+	Reason    string `json:"reason"`             // "idle" | "quota"
+	Bytes     int64  `json:"bytes"`
+}
+
+// Report summarises one janitor pass.
+type Report struct {
+	StartedAt     int64    `json:"startedAt"`
+	FinishedAt    int64    `json:"finishedAt"`
+	DryRun        bool     `json:"dryRun,omitempty"`
+	Archived      []Action `json:"archived"`
+	Deleted       []Action `json:"deleted"`
+	ConvlogLines  int      `json:"convlogLines"`  // conversation log entries dropped
+	CronRuns      int      `json:"cronRuns"`      // cron run records dropped
+	SubagentTasks int      `json:"subagentTasks"` // background tasks dropped
+	BytesFreed    int64    `json:"bytesFreed"`
+	OverQuota     []string `json:"overQuota,omitempty"` // agents still above MaxSessionsMB
+	Errors        []string `json:"errors,omitempty"`
+}
+
+// Janitor applies retention policies periodically.
+type Janitor struct {
+	opts Options
+
+	runMu  sync.Mutex
+	lastMu sync.Mutex
+	last   *Report
+	stop   chan struct{}
+}
+
+// New creates a Janitor; call Start to run it in the background.
+func New(opts Options) *Janitor {
+	return &Janitor{opts: opts}
+}
+
+// Start runs a pass every IntervalMin minutes (default 60) while retention
+// is enabled. The config is re-read each tick, so enabling it or changing
+// the interval needs no restart.
+func (j *Janitor) Start() {
+	j.stop = make(chan struct{})
+	go func() {
+		// Let startup settle before touching the disk.
+		wait := time.Minute
+		for {
+			select {
+			case <-j.stop:
+				return
+			case <-time.After(wait):
+			}
+			cfg := j.opts.Config()
+			wait = time.Duration(cfg.IntervalMin) * time.Minute
+			if wait <= 0 {
+				wait = time.Hour
+			}
+			if !cfg.Enabled {
+				continue
+			}
+			r := j.Run(false)
+			if len(r.Archived)+len(r.Deleted)+r.ConvlogLines+r.CronRuns+r.SubagentTasks > 0 || len(r.Errors) > 0 {
+				log.Printf("[retention] archived %d, deleted %d sessions; dropped %d log lines, %d cron runs, %d tasks; freed %d KB; %d errors",
+					len(r.Archived), len(r.Deleted), r.ConvlogLines, r.CronRuns, r.SubagentTasks, r.BytesFreed/1024, len(r.Errors))
+			}
+		}
+	}()
+}
+
+// Stop ends the background loop.
+func (j *Janitor) Stop() {
+	if j.stop != nil {
+		close(j.stop)
+	}
+}
+
+// LastReport returns the most recent non-dry-run report, or nil.
+func (j *Janitor) LastReport() *Report {
+	j.lastMu.Lock()
+	defer j.lastMu.Unlock()
+	return j.last
+}
+
+// Run performs one pass now, whether or not retention is enabled. With
+// dryRun it only reports what would be done.
+func (j *Janitor) Run(dryRun bool) *Report {
+	j.runMu.Lock()
+	defer j.runMu.Unlock()
+
+	cfg := j.opts.Config()
+	now := time.Now()
+	r := &Report{StartedAt: now.UnixMilli(), DryRun: dryRun, Archived: []Action{}, Deleted: []Action{}}
+	fail := func(format string, args ...any) {
+		r.Errors = append(r.Errors, fmt.Sprintf(format, args...))
+	}
+
+	if j.opts.Agents != nil {
+		for _, t := range j.opts.Agents() {
+			for _, dir := range []string{t.SessionDir, filepath.Join(t.SessionDir, "subagent")} {
+				j.sweepSessions(r, cfg.Sessions, t, dir, now, fail)
+			}
+			j.enforceQuota(r, cfg.Sessions, t, now, fail)
+			if cfg.ConvlogDays > 0 {
+				n, freed, err := convlog.Prune(t.AgentDir, now.AddDate(0, 0, -cfg.ConvlogDays), dryRun)
+				if err != nil {
+					fail("%s convlogs: %v", t.ID, err)
+				}
+				r.ConvlogLines += n
+				r.BytesFreed += freed
+			}
+		}
+	}
+	if cfg.CronRunDays > 0 && j.opts.PruneCronRuns != nil {
+		n, freed, err := j.opts.PruneCronRuns(now.AddDate(0, 0, -cfg.CronRunDays), dryRun)
+		if err != nil {
+			fail("cron runs: %v", err)
+		}
+		r.CronRuns += n
+		r.BytesFreed += freed
+	}
+	if cfg.SubagentTaskDays > 0 && j.opts.PruneTasks != nil {
+		n, freed := j.opts.PruneTasks(now.AddDate(0, 0, -cfg.SubagentTaskDays), dryRun)
+		r.SubagentTasks += n
+		r.BytesFreed += freed
+	}
+
+	r.FinishedAt = time.Now().UnixMilli()
+	if !dryRun {
+		j.lastMu.Lock()
+		j.last = r
+		j.lastMu.Unlock()
+	}
+	return r
+}
+
+// skipSession reports sessions the janitor never touches: internal
+// skill-studio sandboxes are managed by the skill editor.
+func skipSession(id string) bool {
+	return strings.HasPrefix(id, "skill-studio-")
+}
+
+// sweepSessions applies the idle rules to the live and archived sessions of
+// one session directory.
+func (j *Janitor) sweepSessions(r *Report, global config.RetentionPolicy, t Target, dir string, now time.Time, fail func(string, ...any)) {
+	if _, err := os.Stat(dir); err != nil {
+		return
+	}
+	idleDays := func(lastAt int64) float64 {
+		return now.Sub(time.UnixMilli(lastAt)).Hours() / 24
+	}
+	store := session.NewStore(dir)
+	metas, err := store.ListSessions()
+	if err != nil {
+		fail("%s sessions: %v", t.ID, err)
+		return
+	}
+	for _, m := range metas {
+		if skipSession(m.ID) {
+			continue
+		}
+		ch := session.ChannelOf(m.ID)
+		rule := config.ResolveRetention(global, t.Policy, ch)
+		idle := idleDays(m.LastAt)
+		act := Action{AgentID: t.ID, SessionID: m.ID, Channel: ch, Reason: "idle", Bytes: session.SessionBytes(store, m.ID)}
+		switch {
+		case rule.DeleteAfterDays > 0 && idle >= float64(rule.DeleteAfterDays):
+			if !r.DryRun {
+				if err := store.DeleteSession(m.ID); err != nil {
+					fail("%s/%s delete: %v", t.ID, m.ID, err)
+					continue
+				}
+			}
+			r.Deleted = append(r.Deleted, act)
+			r.BytesFreed += act.Bytes
+		case rule.ArchiveAfterDays > 0 && idle >= float64(rule.ArchiveAfterDays):
+			if !r.DryRun {
+				prev, _ := session.GetArchived(dir, m.ID) // merged into on re-archive
+				a, err := session.Archive(dir, m.ID)
+				if err != nil {
+					fail("%s/%s archive: %v", t.ID, m.ID, err)
+					continue
+				}
+				r.BytesFreed += act.Bytes - (a.CompressedBytes - prev.CompressedBytes)
+			}
+			r.Archived = append(r.Archived, act)
+		}
+	}
+
+	archived, err := session.ListArchived(dir)
+	if err != nil {
+		fail("%s archive: %v", t.ID, err)
+		return
+	}
+	for _, a := range archived {
+		rule := config.ResolveRetention(global, t.Policy, session.ChannelOf(a.ID))
+		if rule.DeleteAfterDays <= 0 || idleDays(a.LastAt) < float64(rule.DeleteAfterDays) {
+			continue
+		}
+		if !r.DryRun {
+			if err := session.DeleteArchived(dir, a.ID); err != nil {
+				fail("%s/%s delete archived: %v", t.ID, a.ID, err)
+				continue
+			}
+		}
+		r.Deleted = append(r.Deleted, Action{AgentID: t.ID, SessionID: a.ID, Channel: session.ChannelOf(a.ID), Archived: true, Reason: "idle", Bytes: a.CompressedBytes})
+		r.BytesFreed += a.CompressedBytes
+	}
+}
+
+// enforceQuota keeps an agent's sessions under MaxSessionsMB: the oldest
+// live sessions are archived first, then the oldest archives deleted.
+// Sessions used within activeGrace are never touched.
+func (j *Janitor) enforceQuota(r *Report, global config.RetentionPolicy, t Target, now time.Time, fail func(string, ...any)) {
+	limitMB := global.MaxSessionsMB
+	if t.Policy != nil && t.Policy.MaxSessionsMB != 0 {
+		limitMB = t.Policy.MaxSessionsMB
+	}
+	if limitMB <= 0 {
+		return
+	}
+	limit := int64(limitMB) << 20
+
+	type item struct {
+		dir    string
+		id     string
+		lastAt int64
+		bytes  int64
+	}
+	// Sessions the idle sweep already handled; only still present in a dry run.
+	handled := map[string]bool{}
+	for _, list := range [][]Action{r.Archived, r.Deleted} {
+		for _, a := range list {
+			if a.AgentID == t.ID {
+				handled[a.SessionID] = true
+			}
+		}
+	}
+	var live, archived []item
+	var total int64
+	for _, dir := range []string{t.SessionDir, filepath.Join(t.SessionDir, "subagent")} {
+		if _, err := os.Stat(dir); err != nil {
+			continue
+		}
+		store := session.NewStore(dir)
+		metas, _ := store.ListSessions()
+		for _, m := range metas {
+			it := item{dir: dir, id: m.ID, lastAt: m.LastAt, bytes: session.SessionBytes(store, m.ID)}
+			if handled[m.ID] {
+				continue
+			}
+			total += it.bytes
+			if !skipSession(m.ID) && now.Sub(time.UnixMilli(m.LastAt)) > activeGrace {
+				live = append(live, it)
+			}
+		}
+		as, _ := session.ListArchived(dir)
+		for _, a := range as {
+			if handled[a.ID] && r.DryRun {
+				continue
+			}
+			archived = append(archived, item{dir: dir, id: a.ID, lastAt: a.LastAt, bytes: a.CompressedBytes})
+			total += a.CompressedBytes
+		}
+	}
+	if total <= limit {
+		return
+	}
+
+	oldestFirst := func(items []item) {
+		sort.Slice(items, func(a, b int) bool { return items[a].lastAt < items[b].lastAt })
+	}
+	oldestFirst(live)
+	oldestFirst(archived)
+	for _, it := range live {
+		if total <= limit {
+			return
+		}
+		act := Action{AgentID: t.ID, SessionID: it.id, Channel: session.ChannelOf(it.id), Reason: "quota", Bytes: it.bytes}
+		saved := it.bytes * 4 / 5 // typical gzip ratio, for dry runs
+		if !r.DryRun {
+			prev, _ := session.GetArchived(it.dir, it.id) // merged into on re-archive
+			a, err := session.Archive(it.dir, it.id)
+			if err != nil {
+				fail("%s/%s archive: %v", t.ID, it.id, err)
+				continue
+			}
+			saved = it.bytes - (a.CompressedBytes - prev.CompressedBytes)
+			kept := archived[:0]
+			for _, old := range archived {
+				if old.dir != it.dir || old.id != it.id {
+					kept = append(kept, old)
+				}
+			}
+			archived = append([]item{{dir: it.dir, id: it.id, lastAt: it.lastAt, bytes: a.CompressedBytes}}, kept...)
+		}
+		total -= saved
+		r.BytesFreed += saved
+		r.Archived = append(r.Archived, act)
+	}
+	oldestFirst(archived)
+	for _, it := range archived {
+		if total <= limit {
+			return
+		}
+		if !r.DryRun {
+			if err := session.DeleteArchived(it.dir, it.id); err != nil {
+				fail("%s/%s delete archived: %v", t.ID, it.id, err)
+				continue
+			}
+		}
+		total -= it.bytes
+		r.BytesFreed += it.bytes
+		r.Deleted = append(r.Deleted, Action{AgentID: t.ID, SessionID: it.id, Channel: session.ChannelOf(it.id), Archived: true, Reason: "quota", Bytes: it.bytes})
+	}
+	if total > limit {
+		r.OverQuota = append(r.OverQuota, t.ID)
+	}
+}
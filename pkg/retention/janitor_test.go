@@ -0,0 +1,165 @@
+package retention
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sunhuihui6688-star/ai-panel/pkg/config"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/convlog"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/session"
+)
+
+// importAged creates a session whose last message is daysAgo old.
+func importAged(t *testing.T, store session.Store, daysAgo int) string {
+	t.Helper()
+	ts := time.Now().AddDate(0, 0, -daysAgo).UnixMilli()
+	entry := json.RawMessage(fmt.Sprintf(`{"type":"message","message":{"role":"user","content":"hello %d"},"timestamp":%d}`, daysAgo, ts))
+	id, err := store.Import("sales", "", []json.RawMessage{entry})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Millisecond) // distinct session IDs
+	return id
+}
+
+func TestJanitor(t *testing.T) {
+	root := t.TempDir()
+	sessDir := filepath.Join(root, "sessions")
+	store := session.NewStore(sessDir)
+	defer session.Release(sessDir)
+
+	fresh := importAged(t, store, 1)
+	idle := importAged(t, store, 45)
+	dead := importAged(t, store, 120)
+	_ = convlog.New(root, "telegram-1").Append(convlog.Entry{Timestamp: time.Now().AddDate(0, 0, -40).Format(time.RFC3339), Role: "user", Content: "old"})
+	_ = convlog.New(root, "telegram-1").Append(convlog.Entry{Timestamp: time.Now().Format(time.RFC3339), Role: "user", Content: "new"})
+
+	cfg := config.RetentionConfig{
+		Sessions:    config.RetentionPolicy{RetentionRule: config.RetentionRule{ArchiveAfterDays: 30, DeleteAfterDays: 90}},
+		ConvlogDays: 30,
+	}
+	j := New(Options{
+		Config: func() config.RetentionConfig { return cfg },
+		Agents: func() []Target { return []Target{{ID: "sales", AgentDir: root, SessionDir: sessDir}} },
+	})
+
+	preview := j.Run(true)
+	if len(preview.Archived) != 1 || len(preview.Deleted) != 1 || preview.ConvlogLines != 1 {
+		t.Fatalf("dry run = %+v", preview)
+	}
+	if _, ok := store.GetMeta(idle); !ok {
+		t.Fatal("dry run archived a session")
+	}
+
+	r := j.Run(false)
+	if len(r.Archived) != 1 || r.Archived[0].SessionID != idle || len(r.Deleted) != 1 || r.Deleted[0].SessionID != dead {
+		t.Fatalf("report = %+v", r)
+	}
+	if _, ok := store.GetMeta(fresh); !ok {
+		t.Fatal("fresh session was touched")
+	}
+	if _, ok := store.GetMeta(idle); ok {
+		t.Fatal("idle session still live")
+	}
+	if entries, err := session.ReadArchived(sessDir, idle); err != nil || len(entries) != 2 {
+		t.Fatalf("ReadArchived = %d entries, %v", len(entries), err)
+	}
+	if msgs, total, _ := convlog.ReadMessages(root, "telegram-1", 0, 0); total != 1 || msgs[0].Content != "new" {
+		t.Fatalf("convlog after prune = %+v", msgs)
+	}
+
+	// An agent override can disable archiving for one channel only.
+	cfg.Sessions.Channels = map[string]config.RetentionRule{"telegram": {ArchiveAfterDays: -1}}
+	if rule := config.ResolveRetention(cfg.Sessions, nil, "telegram"); rule.ArchiveAfterDays != 0 || rule.DeleteAfterDays != 90 {
+		t.Fatalf("ResolveRetention = %+v", rule)
+	}
+
+	// Archived sessions past DeleteAfterDays are removed from the archive.
+	cfg.Sessions.DeleteAfterDays = 40
+	if r := j.Run(false); len(r.Deleted) != 1 || !r.Deleted[0].Archived {
+		t.Fatalf("archive sweep = %+v", r)
+	}
+	if _, ok := session.GetArchived(sessDir, idle); ok {
+		t.Fatal("archived session not deleted")
+	}
+}
+
+// Fixed-ID sessions (telegram-<chat>) come back after being archived; a
+// second archive must keep the earlier history.
+func TestJanitorRearchivesSameID(t *testing.T) {
+	root := t.TempDir()
+	sessDir := filepath.Join(root, "sessions")
+	store := session.NewStore(sessDir)
+	defer session.Release(sessDir)
+	const sid = "telegram-42"
+
+	// chat appends a message and backdates the session so it is idle.
+	chat := func(text string) {
+		t.Helper()
+		if _, _, err := store.GetOrCreate(sid, "sales"); err != nil {
+			t.Fatal(err)
+		}
+		content, _ := json.Marshal(text)
+		if err := store.AppendMessage(sid, "user", content); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(sessDir, "sessions.json")
+		var idx struct {
+			Sessions map[string]session.SessionIndexEntry `json:"sessions"`
+		}
+		data, _ := os.ReadFile(path)
+		if err := json.Unmarshal(data, &idx); err != nil {
+			t.Fatal(err)
+		}
+		m := idx.Sessions[sid]
+		m.LastAt = time.Now().AddDate(0, 0, -45).UnixMilli()
+		idx.Sessions[sid] = m
+		data, _ = json.Marshal(idx)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := config.RetentionConfig{Sessions: config.RetentionPolicy{RetentionRule: config.RetentionRule{ArchiveAfterDays: 30}}}
+	j := New(Options{
+		Config: func() config.RetentionConfig { return cfg },
+		Agents: func() []Target { return []Target{{ID: "sales", AgentDir: root, SessionDir: sessDir}} },
+	})
+	sweep := func() {
+		t.Helper()
+		if r := j.Run(false); len(r.Archived) != 1 || len(r.Errors) != 0 {
+			t.Fatalf("report = %+v", r)
+		}
+	}
+
+	chat("first visit")
+	sweep()
+	chat("second visit")
+	sweep()
+
+	entries, err := session.ReadArchived(sessDir, sid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var all string
+	headers := 0
+	for _, e := range entries {
+		all += string(e) + "\n"
+		if strings.Contains(string(e), `"type":"session"`) {
+			headers++
+		}
+	}
+	if !strings.Contains(all, "first visit") || !strings.Contains(all, "second visit") || headers != 1 {
+		t.Fatalf("merged archive lost history or duplicated the header:\n%s", all)
+	}
+	if a, ok := session.GetArchived(sessDir, sid); !ok || a.MessageCount != 2 {
+		t.Fatalf("archive meta = %+v, %v", a, ok)
+	}
+	if list, _ := session.ListArchived(sessDir); len(list) != 1 {
+		t.Fatalf("archived sessions = %d, want 1", len(list))
+	}
+}
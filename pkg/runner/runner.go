@@ -18,7 +18,10 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/sunhuihui6688-star/ai-panel/pkg/compaction"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/llm"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/memory"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/scheduler"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/session"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/tools"
 )
@@ -32,17 +35,25 @@ type Config struct {
 	SessionID    string // persistent session ID; if set, history is loaded from/saved to JSONL
 	LLM          llm.Client
 	Tools        *tools.Registry
-	Session      *session.Store
+	Session      session.Store
 	// Optional: shared project list injected into the system prompt
 	ProjectContext string
+	// Optional: profile of the person sending this message (contact.Prompt), injected into the system prompt
+	ContactContext string
 	// Optional: extra context injected before the user message (e.g. page context, scenario)
 	ExtraContext string
-	// Optional: base64 image data URIs attached to the user message
+	// Optional: base64 image / PDF data URIs attached to the user message
 	Images []string
 	// Optional: preloaded conversation history (from client-side state, used when SessionID is empty)
 	PreloadedHistory []llm.ChatMessage
 	// Optional: per-agent env vars — tells the agent which credentials/env vars are available
 	AgentEnv map[string]string
+	// Optional: global run scheduler; the priority class comes from ctx (scheduler.WithClass)
+	Scheduler *scheduler.Scheduler
+	// Optional: resolved compaction policy (nil = built-in defaults)
+	Compaction *compaction.Policy
+	// Optional: number of memory_search hits for the user message injected into the system prompt (0 = off)
+	MemoryRecall int
 }
 
 // Runner drives a single agent's conversation lifecycle.
@@ -87,13 +98,15 @@ func New(cfg Config) *Runner {
 
 // RunEvent is emitted to the caller during a conversation turn.
 type RunEvent struct {
-	Type          string // "text_delta" | "tool_call" | "tool_result" | "error" | "done"
+	Type          string // "queued" | "text_delta" | "tool_call" | "tool_result" | "error" | "done"
 	Text          string
 	ToolCall      *llm.ToolCall
 	Error         error
 	// Done event extras
 	SessionID     string
 	TokenEstimate int
+	// Queued event: 1-based position in the scheduler queue
+	Position      int
 }
 
 // Run processes one user message and streams events until the model stops.
@@ -102,6 +115,20 @@ func (r *Runner) Run(ctx context.Context, userMsg string) <-chan RunEvent {
 	out := make(chan RunEvent, 32)
 	go func() {
 		defer close(out)
+		ctx, release, err := r.cfg.Scheduler.Acquire(ctx, scheduler.Request{
+			Class:    scheduler.ClassFrom(ctx),
+			AgentID:  r.cfg.AgentID,
+			Provider: providerOf(r.cfg.Model),
+			APIKey:   r.cfg.APIKey,
+			Label:    r.cfg.SessionID,
+		}, func(pos int) {
+			out <- RunEvent{Type: "queued", Position: pos}
+		})
+		if err != nil {
+			out <- RunEvent{Type: "error", Error: err}
+			return
+		}
+		defer release()
 		if err := r.run(ctx, userMsg, out); err != nil {
 			out <- RunEvent{Type: "error", Error: err}
 		}
@@ -109,6 +136,14 @@ func (r *Runner) Run(ctx context.Context, userMsg string) <-chan RunEvent {
 	return out
 }
 
+// providerOf returns the provider part of a "provider/model" string.
+func providerOf(model string) string {
+	if p, _, ok := strings.Cut(model, "/"); ok {
+		return p
+	}
+	return "anthropic"
+}
+
 // sanitizeHistory fixes Anthropic-incompatible conversation history.
 // Problems handled:
 //  1. Consecutive same-role messages (user→user or assistant→assistant)
@@ -340,7 +375,7 @@ func (r *Runner) run(ctx context.Context, userMsg string, out chan<- RunEvent) e
 	// 1. Append user message to history (with optional images)
 	var userContent json.RawMessage
 	if len(r.cfg.Images) > 0 {
-		// Multimodal: build content array [image, ..., text]
+		// Multimodal: build content array [image|document, ..., text]
 		type imgSrc struct {
 			Type      string `json:"type"`
 			MediaType string `json:"media_type"`
@@ -376,8 +411,13 @@ func (r *Runner) run(ctx context.Context, userMsg string, out chan<- RunEvent) e
 					}
 				}
 			}
+			// PDFs are sent as native document blocks, everything else as images.
+			blockType := "image"
+			if mediaType == "application/pdf" {
+				blockType = "document"
+			}
 			parts = append(parts, imgBlock{
-				Type:   "image",
+				Type:   blockType,
 				Source: imgSrc{Type: "base64", MediaType: mediaType, Data: data},
 			})
 		}
@@ -405,9 +445,16 @@ func (r *Runner) run(ctx context.Context, userMsg string, out chan<- RunEvent) e
 	if r.cfg.ProjectContext != "" {
 		systemPrompt = systemPrompt + "\n\n" + r.cfg.ProjectContext
 	}
+	if r.cfg.ContactContext != "" {
+		systemPrompt = systemPrompt + "\n\n" + r.cfg.ContactContext
+	}
 	if r.cfg.ExtraContext != "" {
 		systemPrompt = systemPrompt + "\n\n---\n" + r.cfg.ExtraContext
 	}
+	if recall := r.recallMemory(ctx, userMsg); recall != "" {
+		systemPrompt = systemPrompt + "\n\n## 相关记忆\n" +
+			"以下是记忆文件中与当前消息最相关的片段（自动检索，可能不完整，需要时用 Read 读取全文）：\n\n" + recall
+	}
 	if len(r.cfg.AgentEnv) > 0 {
 		keys := make([]string, 0, len(r.cfg.AgentEnv))
 		for k := range r.cfg.AgentEnv {
@@ -500,7 +547,11 @@ func (r *Runner) run(ctx context.Context, userMsg string, out chan<- RunEvent) e
 			}
 			// Trigger compaction asynchronously if token budget exceeded
 			if r.cfg.SessionID != "" && r.cfg.Session != nil {
-				session.CompactIfNeeded(r.cfg.Session, r.cfg.SessionID, r.makeSimpleLLMCaller())
+				policy := compaction.Resolve(nil, nil, nil)
+				if r.cfg.Compaction != nil {
+					policy = *r.cfg.Compaction
+				}
+				compaction.CompactIfNeeded(r.cfg.Session, r.cfg.SessionID, policy, r.makeSimpleLLMCaller(policy))
 			}
 			return nil
 		}
@@ -576,13 +627,29 @@ func (r *Runner) executeTools(ctx context.Context, calls []llm.ToolCall, out cha
 }
 
 // makeSimpleLLMCaller returns a function suitable for compaction summarization.
-// It calls the LLM non-streamingly and returns the full response text.
-func (r *Runner) makeSimpleLLMCaller() func(ctx context.Context, system, userMsg string) (string, error) {
+// It calls the LLM non-streamingly and returns the full response text, using
+// the policy's summary model when one is set.
+func (r *Runner) makeSimpleLLMCaller(policy compaction.Policy) compaction.Summarizer {
+	model, apiKey := r.cfg.Model, r.cfg.APIKey
+	if policy.Model != "" {
+		model, apiKey = policy.Model, policy.APIKey
+	}
 	return func(ctx context.Context, system, userMsg string) (string, error) {
+		ctx, release, err := r.cfg.Scheduler.Acquire(ctx, scheduler.Request{
+			Class:    scheduler.Memory,
+			AgentID:  r.cfg.AgentID,
+			Provider: providerOf(model),
+			APIKey:   apiKey,
+			Label:    "compaction",
+		}, nil)
+		if err != nil {
+			return "", err
+		}
+		defer release()
 		userContent, _ := json.Marshal(userMsg)
 		req := &llm.ChatRequest{
-			Model:  r.cfg.Model,
-			APIKey: r.cfg.APIKey,
+			Model:  model,
+			APIKey: apiKey,
 			System: system,
 			Messages: []llm.ChatMessage{
 				{Role: "user", Content: userContent},
@@ -658,3 +725,16 @@ func buildAssistantContent(text string, toolCalls []llm.ToolCall) json.RawMessag
 	}
 	return data
 }
+
+// recallMemory returns the top memory_search hits for userMsg, formatted for
+// the system prompt, or "" when recall is off or nothing relevant was found.
+func (r *Runner) recallMemory(ctx context.Context, userMsg string) string {
+	if r.cfg.MemoryRecall <= 0 || r.cfg.WorkspaceDir == "" || strings.TrimSpace(userMsg) == "" {
+		return ""
+	}
+	hits, err := memory.OpenIndex(r.cfg.WorkspaceDir).Search(ctx, userMsg, r.cfg.MemoryRecall)
+	if err != nil || len(hits) == 0 {
+		return ""
+	}
+	return tools.FormatMemoryHits(hits, 400)
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/sunhuihui6688-star/ai-panel/pkg/memory"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/project"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/skill"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/teammem"
 )
 
 // BuildSystemPrompt reads IDENTITY.md, SOUL.md, and memory/INDEX.md from the
@@ -54,7 +55,7 @@ func BuildSystemPrompt(workspaceDir string) (string, error) {
 	}
 
 	// Memory tree hint for the agent
-	sb.WriteString("[Memory tree available. Use read tool to access: memory/core/, memory/projects/, memory/daily/, memory/topics/]\n\n")
+	sb.WriteString("[Memory tree available. Use memory_search to find relevant notes, then read tool to access: memory/core/, memory/projects/, memory/daily/, memory/topics/]\n\n")
 
 	// Inject RELATIONS.md if it exists
 	relationsContent, err := readFileIfExists(filepath.Join(workspaceDir, "RELATIONS.md"))
@@ -142,3 +143,43 @@ func BuildProjectContext(mgr *project.Manager, agentID string) string {
 	sb.WriteString("\n工具：project_create 新建项目，project_list 列出项目，project_read 读取文件，project_write 写入文件（需写入权限），project_glob 列举文件。")
 	return sb.String()
 }
+
+// teamIndexRunes caps how much of the team INDEX.md goes into every prompt.
+const teamIndexRunes = 2000
+
+// BuildTeamMemoryContext builds the team memory section for system prompt
+// injection: the shared INDEX.md plus the agent's permissions. It returns ""
+// when the agent has no read access.
+func BuildTeamMemoryContext(store *teammem.Store, agentID string) string {
+	if store == nil {
+		return ""
+	}
+	pol := store.Policy()
+	if !pol.CanRead(agentID) {
+		return ""
+	}
+	index, _ := store.Tree(memory.Author{}).GetFile("INDEX.md")
+	if r := []rune(strings.TrimSpace(index)); len(r) > teamIndexRunes {
+		index = string(r[:teamIndexRunes]) + "\n…（已截断，用 team_memory_read 读取全文）"
+	}
+
+	var sb strings.Builder
+	sb.WriteString("--- 团队共享记忆 ---\n")
+	sb.WriteString("团队所有成员共用一份记忆。用 team_memory_read / team_memory_search 查阅")
+	switch {
+	case !pol.CanWrite(agentID):
+		sb.WriteString("（你只有读取权限）。")
+	case pol.Review && !pol.CanApprove(agentID):
+		sb.WriteString("，用 team_memory_propose 提交新内容（需审核人批准后生效）。")
+	default:
+		sb.WriteString("，用 team_memory_propose 写入新内容。")
+	}
+	if pol.CanApprove(agentID) {
+		sb.WriteString("你是审核人，可用 team_memory_review 审核其他成员的提交。")
+	}
+	if strings.TrimSpace(index) != "" {
+		sb.WriteString("\n\n")
+		sb.WriteString(strings.TrimSpace(index))
+	}
+	return sb.String()
+}
@@ -0,0 +1,385 @@
+// Package scheduler admits agent runs under global, per-agent and
+// per-provider-key concurrency limits.
+//
+// Every entry point (web chat, Telegram, subagents, cron, memory
+// consolidation) acquires a slot before talking to the LLM. Waiting runs are
+// ordered by priority class, then arrival; a run blocked only by its own
+// agent or key limit does not hold up runs behind it. Waiters are told
+// their queue position as it changes, and the queue is bounded so bursts
+// are rejected instead of piling up.
+package scheduler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Class is a run's priority class; lower values are admitted first.
+type Class int
+
+const (
+	Interactive Class = iota // web chat and API calls
+	Telegram                 // messages from channel bots
+	Subagent                 // background tasks
+	Cron                     // scheduled jobs
+	Memory                   // memory consolidation
+	numClasses
+)
+
+var classNames = [numClasses]string{"interactive", "telegram", "subagent", "cron", "memory"}
+
+func (c Class) String() string {
+	if c < 0 || c >= numClasses {
+		return "unknown"
+	}
+	return classNames[c]
+}
+
+// MarshalText encodes the class by name.
+func (c Class) MarshalText() ([]byte, error) { return []byte(c.String()), nil }
+
+type classKey struct{}
+type heldKey struct{}
+
+// WithClass tags ctx with the priority class for runs started under it.
+func WithClass(ctx context.Context, c Class) context.Context {
+	return context.WithValue(ctx, classKey{}, c)
+}
+
+// ClassFrom returns the class set by WithClass (Interactive by default).
+func ClassFrom(ctx context.Context) Class {
+	if c, ok := ctx.Value(classKey{}).(Class); ok {
+		return c
+	}
+	return Interactive
+}
+
+// Limits bounds concurrent runs. Values <= 0 mean unlimited.
+type Limits struct {
+	Global   int `json:"global"`
+	PerAgent int `json:"perAgent"`
+	PerKey   int `json:"perKey"`
+	MaxQueue int `json:"maxQueue"` // waiting runs; further requests fail with ErrQueueFull
+}
+
+// Default limits used for zero config values.
+const (
+	DefaultGlobal   = 8
+	DefaultPerAgent = 3
+	DefaultPerKey   = 4
+	DefaultMaxQueue = 100
+)
+
+// LimitsFrom converts config values: 0 selects the default, negative
+// removes the limit.
+func LimitsFrom(global, perAgent, perKey, maxQueue int) Limits {
+	pick := func(v, def int) int {
+		switch {
+		case v == 0:
+			return def
+		case v < 0:
+			return 0
+		}
+		return v
+	}
+	return Limits{
+		Global:   pick(global, DefaultGlobal),
+		PerAgent: pick(perAgent, DefaultPerAgent),
+		PerKey:   pick(perKey, DefaultPerKey),
+		MaxQueue: pick(maxQueue, DefaultMaxQueue),
+	}
+}
+
+// ErrQueueFull is returned when too many runs are already waiting.
+var ErrQueueFull = errors.New("too many runs waiting; please try again later")
+
+// Request describes a run asking for a slot.
+type Request struct {
+	Class    Class
+	AgentID  string
+	Provider string // e.g. "anthropic"; only used for labels
+	APIKey   string // only a fingerprint is kept
+	Label    string // e.g. session ID, shown in metrics
+}
+
+type ticket struct {
+	req      Request
+	key      string // provider:fingerprint
+	seq      uint64
+	queuedAt time.Time
+	started  time.Time
+	pos      int
+	posCh    chan int // latest queue position (buffer 1)
+	ready    chan struct{}
+	admitted bool
+}
+
+type classStats struct {
+	admitted, rejected, cancelled uint64
+	totalWait, maxWait            time.Duration
+}
+
+// Scheduler hands out run slots. A nil *Scheduler admits everything.
+type Scheduler struct {
+	limits func() Limits
+
+	mu       sync.Mutex
+	seq      uint64
+	waiting  []*ticket // ordered by class, then seq
+	running  map[*ticket]struct{}
+	perAgent map[string]int
+	perKey   map[string]int
+	stats    [numClasses]classStats
+}
+
+// New creates a Scheduler; limits is consulted on every decision so config
+// changes apply immediately.
+func New(limits func() Limits) *Scheduler {
+	return &Scheduler{
+		limits:   limits,
+		running:  make(map[*ticket]struct{}),
+		perAgent: make(map[string]int),
+		perKey:   make(map[string]int),
+	}
+}
+
+// KeyLabel identifies a provider key without revealing it.
+func KeyLabel(provider, apiKey string) string {
+	if apiKey == "" {
+		return provider
+	}
+	sum := sha256.Sum256([]byte(apiKey))
+	return provider + ":" + hex.EncodeToString(sum[:4])
+}
+
+// Acquire blocks until the run may start, calling onQueued (if non-nil)
+// with the 1-based queue position whenever it changes. It returns a context
+// to run under and a release func that must be called when the run ends.
+// Runs started under the returned context (e.g. an agent synchronously
+// messaging another agent) bypass the limits so they cannot deadlock.
+func (s *Scheduler) Acquire(ctx context.Context, req Request, onQueued func(position int)) (context.Context, func(), error) {
+	if s == nil || ctx.Value(heldKey{}) != nil {
+		return ctx, func() {}, nil
+	}
+	if req.Class < 0 || req.Class >= numClasses {
+		req.Class = Interactive
+	}
+	t := &ticket{
+		req:      req,
+		key:      KeyLabel(req.Provider, req.APIKey),
+		queuedAt: time.Now(),
+		posCh:    make(chan int, 1),
+		ready:    make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	lim := s.limits()
+	if lim.MaxQueue > 0 && len(s.waiting) >= lim.MaxQueue && !s.admissible(t, lim) {
+		s.stats[req.Class].rejected++
+		s.mu.Unlock()
+		return ctx, nil, ErrQueueFull
+	}
+	s.seq++
+	t.seq = s.seq
+	i := sort.Search(len(s.waiting), func(i int) bool { return s.waiting[i].req.Class > req.Class })
+	s.waiting = append(s.waiting, nil)
+	copy(s.waiting[i+1:], s.waiting[i:])
+	s.waiting[i] = t
+	s.dispatch(lim)
+	s.mu.Unlock()
+
+	var once sync.Once
+	release := func() { once.Do(func() { s.release(t) }) }
+	held := context.WithValue(ctx, heldKey{}, true)
+	for {
+		select {
+		case <-t.ready:
+			return held, release, nil
+		default:
+		}
+		select {
+		case <-t.ready:
+			return held, release, nil
+		case p := <-t.posCh:
+			if onQueued != nil {
+				onQueued(p)
+			}
+		case <-ctx.Done():
+			s.mu.Lock()
+			if t.admitted {
+				s.mu.Unlock()
+				release()
+				return ctx, nil, ctx.Err()
+			}
+			for i, w := range s.waiting {
+				if w == t {
+					s.waiting = append(s.waiting[:i], s.waiting[i+1:]...)
+					break
+				}
+			}
+			s.stats[req.Class].cancelled++
+			s.dispatch(s.limits())
+			s.mu.Unlock()
+			return ctx, nil, ctx.Err()
+		}
+	}
+}
+
+func (s *Scheduler) admissible(t *ticket, lim Limits) bool {
+	if lim.Global > 0 && len(s.running) >= lim.Global {
+		return false
+	}
+	if lim.PerAgent > 0 && s.perAgent[t.req.AgentID] >= lim.PerAgent {
+		return false
+	}
+	if lim.PerKey > 0 && s.perKey[t.key] >= lim.PerKey {
+		return false
+	}
+	return true
+}
+
+// dispatch admits every waiter that fits, in priority order, and publishes
+// the new positions of the rest. Must be called with s.mu held.
+func (s *Scheduler) dispatch(lim Limits) {
+	remaining := s.waiting[:0]
+	for _, t := range s.waiting {
+		if !s.admissible(t, lim) {
+			remaining = append(remaining, t)
+			continue
+		}
+		t.admitted = true
+		t.started = time.Now()
+		s.running[t] = struct{}{}
+		s.perAgent[t.req.AgentID]++
+		s.perKey[t.key]++
+		st := &s.stats[t.req.Class]
+		st.admitted++
+		wait := t.started.Sub(t.queuedAt)
+		st.totalWait += wait
+		if wait > st.maxWait {
+			st.maxWait = wait
+		}
+		close(t.ready)
+	}
+	for i := len(remaining); i < len(s.waiting); i++ {
+		s.waiting[i] = nil
+	}
+	s.waiting = remaining
+	for i, t := range s.waiting {
+		if t.pos == i+1 {
+			continue
+		}
+		t.pos = i + 1
+		select { // keep only the latest position
+		case <-t.posCh:
+		default:
+		}
+		t.posCh <- t.pos
+	}
+}
+
+func (s *Scheduler) release(t *ticket) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.running, t)
+	if s.perAgent[t.req.AgentID]--; s.perAgent[t.req.AgentID] <= 0 {
+		delete(s.perAgent, t.req.AgentID)
+	}
+	if s.perKey[t.key]--; s.perKey[t.key] <= 0 {
+		delete(s.perKey, t.key)
+	}
+	s.dispatch(s.limits())
+}
+
+// RunInfo describes a running or waiting run.
+type RunInfo struct {
+	Class     Class  `json:"class"`
+	AgentID   string `json:"agentId"`
+	Key       string `json:"key"`
+	Label     string `json:"label,omitempty"`
+	Position  int    `json:"position,omitempty"` // waiting runs only
+	QueuedAt  int64  `json:"queuedAt"`
+	StartedAt int64  `json:"startedAt,omitempty"`
+}
+
+// ClassMetrics are per-class counters since startup.
+type ClassMetrics struct {
+	Running   int    `json:"running"`
+	Queued    int    `json:"queued"`
+	Admitted  uint64 `json:"admitted"`
+	Rejected  uint64 `json:"rejected"`
+	Cancelled uint64 `json:"cancelled"`
+	AvgWaitMs int64  `json:"avgWaitMs"`
+	MaxWaitMs int64  `json:"maxWaitMs"`
+}
+
+// Metrics is a snapshot of the scheduler state.
+type Metrics struct {
+	Limits   Limits                  `json:"limits"`
+	Running  []RunInfo               `json:"running"`
+	Queue    []RunInfo               `json:"queue"`
+	PerAgent map[string]int          `json:"perAgent"` // running runs by agent
+	PerKey   map[string]int          `json:"perKey"`   // running runs by provider key
+	Classes  map[string]ClassMetrics `json:"classes"`
+}
+
+// Metrics returns a snapshot of running and waiting runs and counters.
+func (s *Scheduler) Metrics() Metrics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := Metrics{
+		Limits:   s.limits(),
+		Running:  []RunInfo{},
+		Queue:    []RunInfo{},
+		PerAgent: make(map[string]int, len(s.perAgent)),
+		PerKey:   make(map[string]int, len(s.perKey)),
+		Classes:  make(map[string]ClassMetrics, numClasses),
+	}
+	var cm [numClasses]ClassMetrics
+	for t := range s.running {
+		m.Running = append(m.Running, t.info())
+		cm[t.req.Class].Running++
+	}
+	sort.Slice(m.Running, func(i, j int) bool { return m.Running[i].StartedAt < m.Running[j].StartedAt })
+	for _, t := range s.waiting {
+		m.Queue = append(m.Queue, t.info())
+		cm[t.req.Class].Queued++
+	}
+	for k, v := range s.perAgent {
+		m.PerAgent[k] = v
+	}
+	for k, v := range s.perKey {
+		m.PerKey[k] = v
+	}
+	for c := Class(0); c < numClasses; c++ {
+		st := s.stats[c]
+		cm[c].Admitted, cm[c].Rejected, cm[c].Cancelled = st.admitted, st.rejected, st.cancelled
+		if st.admitted > 0 {
+			cm[c].AvgWaitMs = st.totalWait.Milliseconds() / int64(st.admitted)
+		}
+		cm[c].MaxWaitMs = st.maxWait.Milliseconds()
+		m.Classes[c.String()] = cm[c]
+	}
+	return m
+}
+
+func (t *ticket) info() RunInfo {
+	ri := RunInfo{
+		Class:    t.req.Class,
+		AgentID:  t.req.AgentID,
+		Key:      t.key,
+		Label:    t.req.Label,
+		Position: t.pos,
+		QueuedAt: t.queuedAt.UnixMilli(),
+	}
+	if t.admitted {
+		ri.Position = 0
+		ri.StartedAt = t.started.UnixMilli()
+	}
+	return ri
+}
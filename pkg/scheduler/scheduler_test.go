@@ -0,0 +1,99 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func waitAdmitted(t *testing.T, ch <-chan func()) func() {
+	t.Helper()
+	select {
+	case release := <-ch:
+		return release
+	case <-time.After(2 * time.Second):
+		t.Fatal("run was not admitted")
+		return nil
+	}
+}
+
+func TestPriorityAndLimits(t *testing.T) {
+	s := New(func() Limits { return Limits{Global: 2, PerAgent: 1, MaxQueue: 3} })
+	ctx := context.Background()
+
+	_, relA, err := s.Acquire(ctx, Request{Class: Interactive, AgentID: "a"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, relB, _ := s.Acquire(ctx, Request{Class: Interactive, AgentID: "b"}, nil)
+
+	// Global limit reached: a cron run queues first, then an interactive one.
+	start := func(class Class, agent string, positions chan int) <-chan func() {
+		ch := make(chan func(), 1)
+		go func() {
+			_, rel, err := s.Acquire(ctx, Request{Class: class, AgentID: agent}, func(p int) {
+				if positions != nil {
+					positions <- p
+				}
+			})
+			if err == nil {
+				ch <- rel
+			}
+		}()
+		return ch
+	}
+	cronPos := make(chan int, 4)
+	cronRun := start(Cron, "c", cronPos)
+	if p := <-cronPos; p != 1 {
+		t.Fatalf("cron position = %d", p)
+	}
+	chatRun := start(Interactive, "d", nil)
+	if p := <-cronPos; p != 2 {
+		t.Fatalf("cron not pushed back by interactive run: %d", p)
+	}
+	// Agent "a" is at its own limit; it must not block others.
+	blocked := start(Interactive, "a", nil)
+	time.Sleep(20 * time.Millisecond)
+
+	if _, _, err := s.Acquire(ctx, Request{Class: Memory, AgentID: "e"}, nil); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+
+	relB()
+	relD := waitAdmitted(t, chatRun)
+	relD()
+	relC := waitAdmitted(t, cronRun) // "a" is still blocked by its agent limit
+	relA()
+	relA() // idempotent
+	waitAdmitted(t, blocked)()
+	relC()
+
+	m := s.Metrics()
+	if len(m.Running) != 0 || len(m.Queue) != 0 || m.Classes["memory"].Rejected != 1 || m.Classes["interactive"].Admitted != 4 {
+		t.Fatalf("metrics = %+v", m)
+	}
+}
+
+func TestCancelWhileQueued(t *testing.T) {
+	s := New(func() Limits { return LimitsFrom(1, 0, 0, 0) })
+	_, rel, _ := s.Acquire(context.Background(), Request{AgentID: "a"}, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, _, err := s.Acquire(ctx, Request{AgentID: "b"}, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v", err)
+	}
+	rel()
+
+	// Nested runs under a held context bypass the limits.
+	held, rel2, _ := s.Acquire(context.Background(), Request{AgentID: "a"}, nil)
+	if _, nested, err := s.Acquire(held, Request{AgentID: "b"}, nil); err != nil {
+		t.Fatal(err)
+	} else {
+		nested()
+	}
+	rel2()
+	if m := s.Metrics(); m.Classes["interactive"].Cancelled != 1 || len(m.Queue) != 0 {
+		t.Fatalf("metrics = %+v", m)
+	}
+}
@@ -0,0 +1,310 @@
+// Package search maintains an on-disk full-text index over session messages,
+// conversation logs, memory files and project files.
+//
+// The index is a SQLite FTS5 table (pure Go via modernc.org/sqlite). CJK text
+// is indexed as character bigrams so Chinese queries work without a
+// dictionary. Documents are grouped by their origin (a session, a log file,
+// a memory file) so a changed origin can be re-indexed on its own.
+package search
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+)
+
+// Source values stored on each document.
+const (
+	SourceSession = "session"
+	SourceConvlog = "convlog"
+	SourceMemory  = "memory"
+	SourceProject = "project"
+)
+
+// Doc is one indexed unit: a message, a log line or a file chunk.
+type Doc struct {
+	Source    string
+	AgentID   string
+	Channel   string // "web" | "telegram" | ... ; project ID for project files
+	Role      string // "user" | "assistant" for messages
+	SessionID string
+	Path      string // file path (memory/project) relative to its root
+	Title     string
+	Timestamp int64 // unix ms
+	Text      string
+}
+
+// Query filters a search. Empty fields match everything.
+type Query struct {
+	Text    string
+	AgentID string
+	Channel string
+	Role    string
+	Sources []string
+	Since   time.Time
+	Until   time.Time
+	Sort    string // "relevance" (default) | "recent"
+	Limit   int
+	Offset  int
+}
+
+// Hit is one search result.
+type Hit struct {
+	Source    string  `json:"source"`
+	AgentID   string  `json:"agentId,omitempty"`
+	Channel   string  `json:"channel,omitempty"`
+	Role      string  `json:"role,omitempty"`
+	SessionID string  `json:"sessionId,omitempty"`
+	Path      string  `json:"path,omitempty"`
+	Title     string  `json:"title,omitempty"`
+	Timestamp int64   `json:"timestamp"`
+	Snippet   string  `json:"snippet"`
+	Score     float64 `json:"score"`
+	text      string
+}
+
+// Text returns the full indexed text of the hit, for custom snippets.
+func (h Hit) Text() string { return h.text }
+
+const schema = `
+CREATE TABLE IF NOT EXISTS docs (
+	id         INTEGER PRIMARY KEY,
+	grp        TEXT NOT NULL,
+	source     TEXT NOT NULL,
+	agent_id   TEXT NOT NULL DEFAULT '',
+	channel    TEXT NOT NULL DEFAULT '',
+	role       TEXT NOT NULL DEFAULT '',
+	session_id TEXT NOT NULL DEFAULT '',
+	path       TEXT NOT NULL DEFAULT '',
+	title      TEXT NOT NULL DEFAULT '',
+	ts         INTEGER NOT NULL DEFAULT 0,
+	body       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_docs_grp ON docs(grp);
+CREATE INDEX IF NOT EXISTS idx_docs_agent_ts ON docs(agent_id, ts);
+CREATE VIRTUAL TABLE IF NOT EXISTS fts USING fts5(title, body, tokenize = 'unicode61 remove_diacritics 2');
+CREATE TABLE IF NOT EXISTS state (
+	grp   TEXT PRIMARY KEY,
+	pos   INTEGER NOT NULL DEFAULT 0,
+	mark  INTEGER NOT NULL DEFAULT 0
+);
+`
+
+// Index is the on-disk search index.
+type Index struct {
+	db *sql.DB
+	mu sync.Mutex // serialises writers
+}
+
+// Open opens or creates the index database at path.
+func Open(path string) (*Index, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(wal)&_pragma=synchronous(normal)")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("init search index: %w", err)
+	}
+	return &Index{db: db}, nil
+}
+
+// Close closes the database.
+func (ix *Index) Close() error {
+	return ix.db.Close()
+}
+
+// groupState is the incremental-indexing bookmark of one group: pos is a
+// byte offset or entry count, mark a size/mtime/last-activity stamp.
+type groupState struct {
+	pos, mark int64
+	found     bool
+}
+
+func (ix *Index) state(grp string) groupState {
+	var st groupState
+	err := ix.db.QueryRow(`SELECT pos, mark FROM state WHERE grp = ?`, grp).Scan(&st.pos, &st.mark)
+	st.found = err == nil
+	return st
+}
+
+// update replaces (reset=true) or extends a group's documents and stores
+// its new bookmark, all in one transaction.
+func (ix *Index) update(grp string, reset bool, docs []Doc, pos, mark int64) error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	tx, err := ix.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if reset {
+		if err := deleteGroup(tx, grp); err != nil {
+			return err
+		}
+	}
+	for _, d := range docs {
+		if strings.TrimSpace(d.Text) == "" {
+			continue
+		}
+		res, err := tx.Exec(`INSERT INTO docs (grp, source, agent_id, channel, role, session_id, path, title, ts, body) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			grp, d.Source, d.AgentID, d.Channel, d.Role, d.SessionID, d.Path, d.Title, d.Timestamp, d.Text)
+		if err != nil {
+			return err
+		}
+		id, _ := res.LastInsertId()
+		if _, err := tx.Exec(`INSERT INTO fts (rowid, title, body) VALUES (?, ?, ?)`, id, tokenize(d.Title), tokenize(d.Text)); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO state (grp, pos, mark) VALUES (?, ?, ?) ON CONFLICT(grp) DO UPDATE SET pos = excluded.pos, mark = excluded.mark`,
+		grp, pos, mark); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func deleteGroup(tx *sql.Tx, grp string) error {
+	if _, err := tx.Exec(`DELETE FROM fts WHERE rowid IN (SELECT id FROM docs WHERE grp = ?)`, grp); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`DELETE FROM docs WHERE grp = ?`, grp)
+	return err
+}
+
+// removeGroups drops every group under prefix that is not in keep.
+func (ix *Index) removeGroups(prefix string, keep map[string]bool) error {
+	rows, err := ix.db.Query(`SELECT grp FROM state WHERE grp LIKE ? ESCAPE '\'`, likePrefix(prefix))
+	if err != nil {
+		return err
+	}
+	var stale []string
+	for rows.Next() {
+		var g string
+		if rows.Scan(&g) == nil && !keep[g] {
+			stale = append(stale, g)
+		}
+	}
+	rows.Close()
+	if len(stale) == 0 {
+		return nil
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	tx, err := ix.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, g := range stale {
+		if err := deleteGroup(tx, g); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM state WHERE grp = ?`, g); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func likePrefix(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(s) + "%"
+}
+
+// Search runs q and returns one page of hits plus the total match count.
+// Snippets are HTML-escaped with matches wrapped in <mark>.
+func (ix *Index) Search(q Query) ([]Hit, int, error) {
+	expr := matchExpr(q.Text)
+	if expr == "" {
+		return nil, 0, fmt.Errorf("query is empty")
+	}
+	where := []string{"fts MATCH ?"}
+	args := []any{expr}
+	add := func(cond string, v any) {
+		where = append(where, cond)
+		args = append(args, v)
+	}
+	if q.AgentID != "" {
+		add("d.agent_id = ?", q.AgentID)
+	}
+	if q.Channel != "" {
+		add("d.channel = ?", q.Channel)
+	}
+	if q.Role != "" {
+		add("d.role = ?", q.Role)
+	}
+	if !q.Since.IsZero() {
+		add("d.ts >= ?", q.Since.UnixMilli())
+	}
+	if !q.Until.IsZero() {
+		add("d.ts < ?", q.Until.UnixMilli())
+	}
+	if len(q.Sources) > 0 {
+		ph := strings.TrimSuffix(strings.Repeat("?,", len(q.Sources)), ",")
+		where = append(where, "d.source IN ("+ph+")")
+		for _, s := range q.Sources {
+			args = append(args, s)
+		}
+	}
+	from := ` FROM fts JOIN docs d ON d.id = fts.rowid WHERE ` + strings.Join(where, " AND ")
+
+	var total int
+	if err := ix.db.QueryRow(`SELECT COUNT(*)`+from, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	order := "score"
+	if q.Sort == "recent" {
+		order = "d.ts DESC"
+	}
+	if q.Limit <= 0 {
+		q.Limit = 20
+	}
+	rows, err := ix.db.Query(`SELECT d.source, d.agent_id, d.channel, d.role, d.session_id, d.path, d.title, d.ts, d.body, bm25(fts, 2.0, 1.0) AS score`+
+		from+` ORDER BY `+order+` LIMIT ? OFFSET ?`, append(args, q.Limit, q.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	hits := []Hit{}
+	for rows.Next() {
+		var h Hit
+		if err := rows.Scan(&h.Source, &h.AgentID, &h.Channel, &h.Role, &h.SessionID, &h.Path, &h.Title, &h.Timestamp, &h.text, &h.Score); err != nil {
+			return nil, 0, err
+		}
+		h.Score = -h.Score // bm25 is lower-is-better
+		h.Snippet = Snippet(h.text, q.Text, 160, MarkHTML)
+		hits = append(hits, h)
+	}
+	return hits, total, rows.Err()
+}
+
+// Stats reports how many documents each source has.
+func (ix *Index) Stats() (map[string]int, error) {
+	rows, err := ix.db.Query(`SELECT source, COUNT(*) FROM docs GROUP BY source`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]int{}
+	for rows.Next() {
+		var s string
+		var n int
+		if err := rows.Scan(&s, &n); err != nil {
+			return nil, err
+		}
+		out[s] = n
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,386 @@
+package search
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sunhuihui6688-star/ai-panel/pkg/convlog"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/session"
+)
+
+const (
+	// chunkChars splits memory/project files into separately ranked chunks.
+	chunkChars = 2000
+	// maxFileBytes skips large (likely generated or binary) project files.
+	maxFileBytes = 1 << 20
+)
+
+// textExts are the project file types worth indexing.
+var textExts = map[string]bool{
+	".md": true, ".txt": true, ".json": true, ".yaml": true, ".yml": true, ".csv": true,
+	".go": true, ".py": true, ".js": true, ".ts": true, ".vue": true, ".html": true, ".css": true,
+	".sql": true, ".sh": true, ".toml": true, ".ini": true, ".xml": true, ".java": true, ".rs": true,
+}
+
+// AgentSource tells the indexer where one agent keeps its data.
+type AgentSource struct {
+	ID           string
+	AgentDir     string // contains convlogs/
+	SessionDir   string
+	WorkspaceDir string // contains MEMORY.md and memory/
+}
+
+// ProjectSource is a shared project directory.
+type ProjectSource struct {
+	ID  string
+	Dir string
+}
+
+// Sources lists what to index; called on every refresh so new agents and
+// projects are picked up automatically.
+type Sources struct {
+	Agents   func() []AgentSource
+	Projects func() []ProjectSource
+}
+
+// Indexer keeps an Index in sync with the files on disk.
+type Indexer struct {
+	ix  *Index
+	src Sources
+
+	refreshMu sync.Mutex
+	lastMu    sync.Mutex
+	last      time.Time
+	stop      chan struct{}
+}
+
+// NewIndexer creates an Indexer; call Start to refresh in the background.
+func NewIndexer(ix *Index, src Sources) *Indexer {
+	return &Indexer{ix: ix, src: src}
+}
+
+// Index returns the underlying index.
+func (in *Indexer) Index() *Index { return in.ix }
+
+// Start refreshes immediately and then every interval until Stop.
+func (in *Indexer) Start(interval time.Duration) {
+	in.stop = make(chan struct{})
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			if err := in.Refresh(); err != nil {
+				log.Printf("[search] refresh: %v", err)
+			}
+			select {
+			case <-in.stop:
+				return
+			case <-t.C:
+			}
+		}
+	}()
+}
+
+// Stop ends the background loop.
+func (in *Indexer) Stop() {
+	if in.stop != nil {
+		close(in.stop)
+	}
+}
+
+// RefreshIfStale refreshes when the last refresh is older than maxAge, so
+// queries see recent messages without re-scanning on every request.
+func (in *Indexer) RefreshIfStale(maxAge time.Duration) {
+	in.lastMu.Lock()
+	stale := time.Since(in.last) > maxAge
+	in.lastMu.Unlock()
+	if stale {
+		if err := in.Refresh(); err != nil {
+			log.Printf("[search] refresh: %v", err)
+		}
+	}
+}
+
+// Refresh indexes everything that changed since the previous refresh and
+// drops documents whose origin disappeared.
+func (in *Indexer) Refresh() error {
+	in.refreshMu.Lock()
+	defer in.refreshMu.Unlock()
+
+	keep := map[string]bool{}
+	var firstErr error
+	note := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if in.src.Agents != nil {
+		for _, ag := range in.src.Agents() {
+			note(in.indexSessions(ag, ag.SessionDir, keep))
+			note(in.indexSessions(ag, filepath.Join(ag.SessionDir, "subagent"), keep))
+			note(in.indexConvlogs(ag, keep))
+			note(in.indexMemory(ag, keep))
+		}
+	}
+	if in.src.Projects != nil {
+		for _, p := range in.src.Projects() {
+			note(in.indexTree(SourceProject, "", p.ID, p.Dir, "", keep))
+		}
+	}
+	for _, prefix := range []string{"session:", "convlog:", "memory:", "project:"} {
+		note(in.ix.removeGroups(prefix, keep))
+	}
+
+	in.lastMu.Lock()
+	in.last = time.Now()
+	in.lastMu.Unlock()
+	return firstErr
+}
+
+// indexSessions appends new messages of every session in dir. A session
+// whose entry count shrank (trim, compaction rewrite) is re-indexed.
+func (in *Indexer) indexSessions(ag AgentSource, dir string, keep map[string]bool) error {
+	if _, err := os.Stat(dir); err != nil {
+		return nil
+	}
+	store := session.NewStore(dir)
+	metas, err := store.ListSessions()
+	if err != nil {
+		return err
+	}
+	for _, m := range metas {
+		grp := "session:" + dir + ":" + m.ID
+		keep[grp] = true
+		st := in.ix.state(grp)
+		if st.found && st.mark == m.LastAt {
+			continue
+		}
+		entries, err := store.ReadAll(m.ID)
+		if err != nil {
+			continue
+		}
+		reset := !st.found || int64(len(entries)) < st.pos
+		from := int(st.pos)
+		if reset {
+			from = 0
+		}
+		var docs []Doc
+		for _, raw := range entries[from:] {
+			var e session.MessageEntry
+			if json.Unmarshal(raw, &e) != nil || e.Type != session.EntryTypeMessage {
+				continue
+			}
+			docs = append(docs, Doc{
+				Source:    SourceSession,
+				AgentID:   ag.ID,
+				Channel:   session.ChannelOf(m.ID),
+				Role:      e.Message.Role,
+				SessionID: m.ID,
+				Title:     m.Title,
+				Timestamp: e.Timestamp,
+				Text:      messageText(e.Message),
+			})
+		}
+		if err := in.ix.update(grp, reset, docs, int64(len(entries)), m.LastAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexConvlogs reads each channel log from the last byte offset.
+func (in *Indexer) indexConvlogs(ag AgentSource, keep map[string]bool) error {
+	files, _ := filepath.Glob(filepath.Join(ag.AgentDir, "convlogs", "*.jsonl"))
+	for _, path := range files {
+		grp := "convlog:" + path
+		keep[grp] = true
+		fi, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		st := in.ix.state(grp)
+		if st.found && st.pos == fi.Size() {
+			continue
+		}
+		reset := !st.found || fi.Size() < st.pos
+		from := st.pos
+		if reset {
+			from = 0
+		}
+		docs, end, err := readConvlog(path, from, ag.ID)
+		if err != nil {
+			return err
+		}
+		if err := in.ix.update(grp, reset, docs, end, fi.ModTime().UnixMilli()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readConvlog parses complete lines after offset and returns the offset
+// after the last complete line.
+func readConvlog(path string, offset int64, agentID string) ([]Doc, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, offset, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, offset, err
+	}
+	channelID := strings.TrimSuffix(filepath.Base(path), ".jsonl")
+	r := bufio.NewReaderSize(f, 64*1024)
+	var docs []Doc
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			// A partial last line is picked up by the next refresh.
+			break
+		}
+		offset += int64(len(line))
+		var e convlog.Entry
+		if json.Unmarshal(line, &e) != nil {
+			continue
+		}
+		ts, _ := time.Parse(time.RFC3339, e.Timestamp)
+		channel := e.ChannelType
+		if channel == "" {
+			channel = channelID
+		}
+		docs = append(docs, Doc{
+			Source:    SourceConvlog,
+			AgentID:   agentID,
+			Channel:   channel,
+			Role:      e.Role,
+			SessionID: channelID,
+			Title:     e.Sender,
+			Timestamp: ts.UnixMilli(),
+			Text:      e.Content,
+		})
+	}
+	return docs, offset, nil
+}
+
+func (in *Indexer) indexMemory(ag AgentSource, keep map[string]bool) error {
+	if err := in.indexFile(SourceMemory, ag.ID, "", filepath.Join(ag.WorkspaceDir, "MEMORY.md"), "MEMORY.md", keep); err != nil {
+		return err
+	}
+	return in.indexTree(SourceMemory, ag.ID, "", filepath.Join(ag.WorkspaceDir, "memory"), "memory", keep)
+}
+
+// indexTree indexes every text file under root, re-reading files whose
+// size or mtime changed.
+func (in *Indexer) indexTree(source, agentID, channel, root, relPrefix string, keep map[string]bool) error {
+	if _, err := os.Stat(root); err != nil {
+		return nil
+	}
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != root && (strings.HasPrefix(d.Name(), ".") || d.Name() == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !textExts[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		if relPrefix != "" {
+			rel = filepath.Join(relPrefix, rel)
+		}
+		return in.indexFile(source, agentID, channel, path, filepath.ToSlash(rel), keep)
+	})
+}
+
+func (in *Indexer) indexFile(source, agentID, channel, path, rel string, keep map[string]bool) error {
+	fi, err := os.Stat(path)
+	if err != nil || fi.Size() > maxFileBytes {
+		return nil
+	}
+	grp := source + ":" + path
+	keep[grp] = true
+	mark := fi.ModTime().UnixNano()
+	if st := in.ix.state(grp); st.found && st.mark == mark && st.pos == fi.Size() {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || !utf8.Valid(data) {
+		return nil
+	}
+	var docs []Doc
+	for _, chunk := range chunkText(string(data), chunkChars) {
+		docs = append(docs, Doc{
+			Source:    source,
+			AgentID:   agentID,
+			Channel:   channel,
+			Path:      rel,
+			Title:     filepath.Base(rel),
+			Timestamp: fi.ModTime().UnixMilli(),
+			Text:      chunk,
+		})
+	}
+	return in.ix.update(grp, true, docs, fi.Size(), mark)
+}
+
+// chunkText splits text at paragraph boundaries into pieces of about n runes.
+func chunkText(text string, n int) []string {
+	var chunks []string
+	var cur strings.Builder
+	curLen := 0
+	for _, para := range strings.SplitAfter(text, "\n\n") {
+		l := utf8.RuneCountInString(para)
+		if curLen > 0 && curLen+l > n {
+			chunks = append(chunks, cur.String())
+			cur.Reset()
+			curLen = 0
+		}
+		// Hard-split paragraphs longer than n.
+		for l > n {
+			rs := []rune(para)
+			chunks = append(chunks, string(rs[:n]))
+			para = string(rs[n:])
+			l -= n
+		}
+		cur.WriteString(para)
+		curLen += l
+	}
+	if strings.TrimSpace(cur.String()) != "" {
+		chunks = append(chunks, cur.String())
+	}
+	return chunks
+}
+
+// messageText flattens text blocks and tool calls into searchable text.
+func messageText(m session.Message) string {
+	var parts []string
+	var s string
+	if json.Unmarshal(m.Content, &s) == nil {
+		parts = append(parts, s)
+	} else {
+		var blocks []session.ContentBlock
+		if json.Unmarshal(m.Content, &blocks) == nil {
+			for _, b := range blocks {
+				if b.Type == "text" && b.Text != "" {
+					parts = append(parts, b.Text)
+				}
+			}
+		}
+	}
+	for _, tc := range m.ToolCalls {
+		parts = append(parts, "["+tc.Name+"] "+tc.Input)
+	}
+	return strings.Join(parts, "\n")
+}
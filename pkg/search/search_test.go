@@ -0,0 +1,80 @@
+package search
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sunhuihui6688-star/ai-panel/pkg/convlog"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/session"
+)
+
+func TestMatchExpr(t *testing.T) {
+	if got := matchExpr(`价格表 Pricing "x"`); got != `"价格 格表" "pricing"* "x"*` {
+		t.Fatalf("matchExpr = %s", got)
+	}
+	if got := Snippet("Our <b>价格</b> is fine", "价格", 40, MarkHTML); got != "Our &lt;b&gt;<mark>价格</mark>&lt;/b&gt; is fine" {
+		t.Fatalf("Snippet = %s", got)
+	}
+}
+
+func TestIndexer(t *testing.T) {
+	root := t.TempDir()
+	ag := AgentSource{
+		ID:           "sales",
+		AgentDir:     root,
+		SessionDir:   filepath.Join(root, "sessions"),
+		WorkspaceDir: filepath.Join(root, "workspace"),
+	}
+	store := session.NewStore(ag.SessionDir)
+	defer session.Release(ag.SessionDir)
+	sid, _, _ := store.GetOrCreate("telegram-42", "sales")
+	msg, _ := json.Marshal("企业版的价格是每月 99 元")
+	_ = store.AppendMessage(sid, "assistant", msg)
+
+	_ = convlog.New(root, "telegram-42").Append(convlog.Entry{
+		Timestamp: "2026-09-01T10:00:00Z", Role: "user", Content: "how much is the enterprise plan?", ChannelType: "telegram",
+	})
+	_ = os.MkdirAll(filepath.Join(ag.WorkspaceDir, "memory"), 0755)
+	_ = os.WriteFile(filepath.Join(ag.WorkspaceDir, "memory", "clients.md"), []byte("# 客户\n\n张三关心价格"), 0644)
+
+	ix, err := Open(filepath.Join(root, "index.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ix.Close()
+	in := NewIndexer(ix, Sources{Agents: func() []AgentSource { return []AgentSource{ag} }})
+	if err := in.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	hits, total, err := ix.Search(Query{Text: "价格"})
+	if err != nil || total != 2 {
+		t.Fatalf("Search(价格) = %d hits, %v", total, err)
+	}
+	if hits, _, _ := ix.Search(Query{Text: "价格", Sources: []string{SourceSession}, Role: "assistant", Channel: "telegram"}); len(hits) != 1 || !strings.Contains(hits[0].Snippet, "<mark>价格</mark>") {
+		t.Fatalf("filtered search = %+v", hits)
+	}
+	if _, total, _ := ix.Search(Query{Text: "enterp", AgentID: "sales"}); total != 1 {
+		t.Fatalf("prefix search total = %d", total)
+	}
+
+	// Incremental: a new message is picked up, nothing is duplicated.
+	msg2, _ := json.Marshal("价格可以优惠")
+	_ = store.AppendMessage(sid, "assistant", msg2)
+	if err := in.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if _, total, _ = ix.Search(Query{Text: "价格"}); total != 3 {
+		t.Fatalf("after append total = %d, want 3 (%v)", total, hits)
+	}
+
+	// Deleting the session removes its documents.
+	_ = store.DeleteSession(sid)
+	_ = in.Refresh()
+	if _, total, _ = ix.Search(Query{Text: "价格"}); total != 1 {
+		t.Fatalf("after delete total = %d, want 1", total)
+	}
+}
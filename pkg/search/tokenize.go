@@ -0,0 +1,200 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// piece is one searchable unit of text: a latin/digit word or a run of CJK
+// characters.
+type piece struct {
+	text string
+	cjk  bool
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// pieces splits s into lower-cased words and CJK runs, dropping punctuation.
+func pieces(s string) []piece {
+	var out []piece
+	var cur []rune
+	curCJK := false
+	flush := func() {
+		if len(cur) > 0 {
+			out = append(out, piece{text: string(cur), cjk: curCJK})
+			cur = cur[:0]
+		}
+	}
+	for _, r := range s {
+		switch {
+		case isCJK(r):
+			if !curCJK {
+				flush()
+			}
+			curCJK = true
+			cur = append(cur, r)
+		case isWordRune(r):
+			if curCJK {
+				flush()
+			}
+			curCJK = false
+			cur = append(cur, unicode.ToLower(r))
+		default:
+			flush()
+		}
+	}
+	flush()
+	return out
+}
+
+// bigrams turns a CJK run into overlapping two-character tokens, which is
+// enough for word search in Chinese without a dictionary.
+func bigrams(run string) []string {
+	rs := []rune(run)
+	if len(rs) < 2 {
+		return []string{run}
+	}
+	out := make([]string, 0, len(rs)-1)
+	for i := 0; i+1 < len(rs); i++ {
+		out = append(out, string(rs[i:i+2]))
+	}
+	return out
+}
+
+// Terms returns the tokens text is indexed under: lower-cased words and CJK
+// character bigrams.
+func Terms(s string) []string {
+	var out []string
+	for _, p := range pieces(s) {
+		if p.cjk {
+			out = append(out, bigrams(p.text)...)
+		} else {
+			out = append(out, p.text)
+		}
+	}
+	return out
+}
+
+// tokenize renders text as the space-separated token stream stored in FTS.
+func tokenize(s string) string {
+	var sb strings.Builder
+	for _, t := range Terms(s) {
+		sb.WriteString(t)
+		sb.WriteByte(' ')
+	}
+	return sb.String()
+}
+
+// matchExpr builds an FTS5 query requiring every piece of q. Words match by
+// prefix; CJK runs match as a phrase of their bigrams.
+func matchExpr(q string) string {
+	var parts []string
+	for _, p := range pieces(q) {
+		switch {
+		case !p.cjk || len([]rune(p.text)) == 1:
+			parts = append(parts, `"`+p.text+`"*`)
+		default:
+			parts = append(parts, `"`+strings.Join(bigrams(p.text), " ")+`"`)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Mark controls how Snippet highlights matches.
+type Mark struct {
+	Open, Close string
+	HTML        bool // escape the surrounding text for HTML
+}
+
+var (
+	// MarkHTML wraps matches in <mark> and escapes everything else.
+	MarkHTML = Mark{Open: "<mark>", Close: "</mark>", HTML: true}
+	// MarkText brackets matches for plain-text output (tool results).
+	MarkText = Mark{Open: "【", Close: "】"}
+)
+
+// Snippet returns about width runes of text around the first match of q,
+// with every match highlighted.
+func Snippet(text, q string, width int, m Mark) string {
+	rs := []rune(text)
+	lower := make([]rune, len(rs))
+	for i, r := range rs {
+		lower[i] = unicode.ToLower(r)
+		if unicode.IsSpace(r) {
+			rs[i] = ' ' // keep snippets on one line
+		}
+	}
+	var terms [][]rune
+	for _, p := range pieces(q) {
+		terms = append(terms, []rune(p.text))
+	}
+
+	// marked[i] is true for runes inside a match.
+	marked := make([]bool, len(rs))
+	first := -1
+	for _, t := range terms {
+		for i := 0; i+len(t) <= len(lower); i++ {
+			if runesEqual(lower[i:i+len(t)], t) {
+				for j := i; j < i+len(t); j++ {
+					marked[j] = true
+				}
+				if first < 0 || i < first {
+					first = i
+				}
+			}
+		}
+	}
+
+	start := 0
+	if first > width/3 {
+		start = first - width/3
+	}
+	end := start + width
+	if end > len(rs) {
+		end = len(rs)
+		start = max(0, end-width)
+	}
+
+	esc := func(s string) string {
+		if m.HTML {
+			return html.EscapeString(s)
+		}
+		return s
+	}
+	var sb strings.Builder
+	if start > 0 {
+		sb.WriteString("…")
+	}
+	for i := start; i < end; {
+		j := i
+		for j < end && marked[j] == marked[i] {
+			j++
+		}
+		if marked[i] {
+			sb.WriteString(m.Open + esc(string(rs[i:j])) + m.Close)
+		} else {
+			sb.WriteString(esc(string(rs[i:j])))
+		}
+		i = j
+	}
+	if end < len(rs) {
+		sb.WriteString("…")
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+func runesEqual(a, b []rune) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,252 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ArchivedSession is the metadata of a session moved to
+// <dir>/archive/<id>.jsonl.gz. Archives are read-only.
+type ArchivedSession struct {
+	SessionIndexEntry
+	ArchivedAt      int64 `json:"archivedAt"`
+	Bytes           int64 `json:"bytes"`           // uncompressed size
+	CompressedBytes int64 `json:"compressedBytes"` // size on disk
+}
+
+type archiveIndex struct {
+	Sessions map[string]ArchivedSession `json:"sessions"`
+}
+
+// archiveMu serialises archive index updates across all directories.
+var archiveMu sync.Mutex
+
+func archiveDir(dir string) string { return filepath.Join(dir, "archive") }
+
+func archivePath(dir, id string) string {
+	return filepath.Join(archiveDir(dir), id+".jsonl.gz")
+}
+
+func loadArchiveIndex(dir string) (*archiveIndex, error) {
+	idx := &archiveIndex{Sessions: map[string]ArchivedSession{}}
+	data, err := os.ReadFile(filepath.Join(archiveDir(dir), "index.json"))
+	if os.IsNotExist(err) {
+		return idx, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, idx); err != nil {
+		return nil, err
+	}
+	if idx.Sessions == nil {
+		idx.Sessions = map[string]ArchivedSession{}
+	}
+	return idx, nil
+}
+
+func saveArchiveIndex(dir string, idx *archiveIndex) error {
+	data, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(archiveDir(dir), "index.json.tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(archiveDir(dir), "index.json"))
+}
+
+// Archive compresses a live session of the store in dir into the archive
+// and removes it from the store. Sessions with fixed IDs (telegram-<chat>)
+// can be archived repeatedly; later entries are appended to the existing
+// archive so earlier history is kept.
+func Archive(dir, sessionID string) (ArchivedSession, error) {
+	store := NewStore(dir)
+	meta, ok := store.GetMeta(sessionID)
+	if !ok {
+		return ArchivedSession{}, fmt.Errorf("session %s not found", sessionID)
+	}
+	entries, err := store.ReadAll(sessionID)
+	if err != nil {
+		return ArchivedSession{}, err
+	}
+
+	archiveMu.Lock()
+	defer archiveMu.Unlock()
+	idx, err := loadArchiveIndex(dir)
+	if err != nil {
+		return ArchivedSession{}, err
+	}
+	prev, merging := idx.Sessions[sessionID]
+	if merging {
+		old, err := ReadArchived(dir, sessionID)
+		if err != nil {
+			return ArchivedSession{}, fmt.Errorf("read existing archive: %w", err)
+		}
+		entries = append(old, withoutHeader(entries)...)
+		meta.CreatedAt = prev.CreatedAt
+		meta.MessageCount += prev.MessageCount
+		if prev.Title != "" {
+			meta.Title = prev.Title
+		}
+	}
+
+	var raw, gz bytes.Buffer
+	for _, e := range entries {
+		raw.Write(e)
+		raw.WriteByte('\n')
+	}
+	zw := gzip.NewWriter(&gz)
+	zw.Name = sessionID + ".jsonl"
+	if _, err := zw.Write(raw.Bytes()); err != nil {
+		return ArchivedSession{}, err
+	}
+	if err := zw.Close(); err != nil {
+		return ArchivedSession{}, err
+	}
+
+	if err := os.MkdirAll(archiveDir(dir), 0755); err != nil {
+		return ArchivedSession{}, err
+	}
+	path := archivePath(dir, sessionID)
+	if err := os.WriteFile(path+".tmp", gz.Bytes(), 0644); err != nil {
+		return ArchivedSession{}, err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return ArchivedSession{}, err
+	}
+	meta.FilePath = filepath.Join("archive", sessionID+".jsonl.gz")
+	a := ArchivedSession{
+		SessionIndexEntry: meta,
+		ArchivedAt:        nowMs(),
+		Bytes:             int64(raw.Len()),
+		CompressedBytes:   int64(gz.Len()),
+	}
+	idx.Sessions[sessionID] = a
+	if err := saveArchiveIndex(dir, idx); err != nil {
+		return ArchivedSession{}, err
+	}
+	// Only drop the live copy once the archive is safely on disk.
+	return a, store.DeleteSession(sessionID)
+}
+
+// withoutHeader drops the session header entry, for appending a live
+// session's entries to an archive that already has one.
+func withoutHeader(entries []json.RawMessage) []json.RawMessage {
+	out := entries[:0:0]
+	for _, e := range entries {
+		var h struct {
+			Type EntryType `json:"type"`
+		}
+		if json.Unmarshal(e, &h) == nil && h.Type == EntryTypeSession {
+			continue
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// ListArchived returns the archived sessions in dir, most recent first.
+func ListArchived(dir string) ([]ArchivedSession, error) {
+	archiveMu.Lock()
+	idx, err := loadArchiveIndex(dir)
+	archiveMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]ArchivedSession, 0, len(idx.Sessions))
+	for _, a := range idx.Sessions {
+		out = append(out, a)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LastAt > out[j].LastAt })
+	return out, nil
+}
+
+// GetArchived returns the metadata of one archived session.
+func GetArchived(dir, sessionID string) (ArchivedSession, bool) {
+	archiveMu.Lock()
+	defer archiveMu.Unlock()
+	idx, err := loadArchiveIndex(dir)
+	if err != nil {
+		return ArchivedSession{}, false
+	}
+	a, ok := idx.Sessions[sessionID]
+	return a, ok
+}
+
+// ReadArchived decompresses an archived session's entries.
+func ReadArchived(dir, sessionID string) ([]json.RawMessage, error) {
+	if strings.ContainsAny(sessionID, `/\`) {
+		return nil, fmt.Errorf("invalid session id")
+	}
+	f, err := os.Open(archivePath(dir, sessionID))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	var entries []json.RawMessage
+	sc := bufio.NewScanner(zr)
+	sc.Buffer(make([]byte, 8*1024*1024), 8*1024*1024)
+	for sc.Scan() {
+		if line := sc.Bytes(); len(line) > 0 {
+			entries = append(entries, append([]byte{}, line...))
+		}
+	}
+	return entries, sc.Err()
+}
+
+// DeleteArchived removes an archived session.
+func DeleteArchived(dir, sessionID string) error {
+	archiveMu.Lock()
+	defer archiveMu.Unlock()
+	idx, err := loadArchiveIndex(dir)
+	if err != nil {
+		return err
+	}
+	if _, ok := idx.Sessions[sessionID]; !ok {
+		return fmt.Errorf("archived session %s not found", sessionID)
+	}
+	delete(idx.Sessions, sessionID)
+	if err := os.Remove(archivePath(dir, sessionID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return saveArchiveIndex(dir, idx)
+}
+
+// SessionBytes returns the approximate storage used by one live session.
+func SessionBytes(store Store, sessionID string) int64 {
+	switch s := store.(type) {
+	case *JSONLStore:
+		if fi, err := os.Stat(filepath.Join(s.dir, sessionID+".jsonl")); err == nil {
+			return fi.Size()
+		}
+	case *SQLiteStore:
+		var n int64
+		_ = s.db.QueryRow(`SELECT COALESCE(SUM(LENGTH(data)), 0) FROM entries WHERE session_id = ?`, sessionID).Scan(&n)
+		return n
+	}
+	return 0
+}
+
+// ChannelOf derives the channel type from the session ID convention
+// ("telegram-<chat>", "subagent-<task>", "ses-<ms>" for web chats, ...).
+func ChannelOf(sessionID string) string {
+	if prefix, _, ok := strings.Cut(sessionID, "-"); ok && prefix != "ses" {
+		return prefix
+	}
+	return "web"
+}
@@ -0,0 +1,121 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Backend names accepted by SetBackend.
+const (
+	BackendJSONL  = "jsonl"
+	BackendSQLite = "sqlite"
+)
+
+// Store is the session storage used by runners, compaction and the API.
+// Implementations must be safe for concurrent use.
+type Store interface {
+	// GetOrCreate returns sessionID if it exists, otherwise creates it
+	// (generating an ID when empty). The bool reports creation.
+	GetOrCreate(sessionID, agentID string) (string, bool, error)
+	AppendMessage(sessionID, role string, content json.RawMessage) error
+	AppendMessageWithTools(sessionID, role string, content json.RawMessage, toolCalls []ToolCallRecord) error
+	// Append adds a raw entry such as a CompactionEntry.
+	Append(sessionID string, entry any) error
+	// ReadHistory returns user/assistant messages after the latest
+	// compaction, plus that compaction's summary.
+	ReadHistory(sessionID string) ([]Message, string, error)
+	// ReadAll returns every raw entry of a session in order.
+	ReadAll(sessionID string) ([]json.RawMessage, error)
+	EstimateTokens(sessionID string) int
+	SetTokenEstimate(sessionID string, tokens int) error
+	GetMeta(sessionID string) (SessionIndexEntry, bool)
+	ListSessions() ([]SessionIndexEntry, error)
+	UpdateTitle(sessionID, title string) error
+	DeleteSession(sessionID string) error
+	// TrimToLastN keeps only the last keepMsgs messages.
+	TrimToLastN(sessionID string, keepMsgs int) error
+	// Import creates a new session from message and compaction entries
+	// (see ParseImport) and returns its ID.
+	Import(agentID, title string, entries []json.RawMessage) (string, error)
+}
+
+var (
+	storesMu sync.Mutex
+	backend  = BackendJSONL
+	stores   = make(map[string]Store)
+)
+
+// SetBackend selects the implementation returned by NewStore ("jsonl" or
+// "sqlite"). Call once at startup, before any store is opened.
+func SetBackend(name string) error {
+	switch name {
+	case "", BackendJSONL:
+		name = BackendJSONL
+	case BackendSQLite:
+	default:
+		return fmt.Errorf("unknown session backend %q", name)
+	}
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	backend = name
+	return nil
+}
+
+// NewStore returns the store for a session directory. Instances are shared
+// per directory so concurrent handlers serialise on the same lock (and, for
+// SQLite, the same connection pool).
+func NewStore(dir string) Store {
+	key := filepath.Clean(dir)
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	if s, ok := stores[key]; ok {
+		return s
+	}
+	var s Store
+	if backend == BackendSQLite {
+		sq, err := OpenSQLite(dir)
+		if err != nil {
+			// Keep serving from JSONL rather than failing every request.
+			log.Printf("[session] open sqlite store in %s: %v — falling back to jsonl", dir, err)
+			s = NewJSONLStore(dir)
+		} else {
+			s = sq
+		}
+	} else {
+		s = NewJSONLStore(dir)
+	}
+	stores[key] = s
+	return s
+}
+
+// Release drops cached stores for dir and every directory below it,
+// closing SQLite handles. Call before removing an agent's files.
+func Release(dir string) {
+	prefix := filepath.Clean(dir)
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	for key, s := range stores {
+		if key == prefix || strings.HasPrefix(key, prefix+string(filepath.Separator)) {
+			if sq, ok := s.(*SQLiteStore); ok {
+				_ = sq.Close()
+			}
+			delete(stores, key)
+		}
+	}
+}
+
+// CloseAll closes every cached store; call on server exit.
+func CloseAll() {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	for key, s := range stores {
+		if sq, ok := s.(*SQLiteStore); ok {
+			_ = sq.Close()
+		}
+		delete(stores, key)
+	}
+}
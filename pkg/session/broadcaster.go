@@ -6,107 +6,183 @@
 // when a new subscriber joins mid-generation, it first receives all buffered
 // events from the current generation, then live events.
 //
+// Every event carries an ID that increases monotonically for the session, so
+// a client that lost its connection can resume with Last-Event-ID and receive
+// exactly the events it missed. The current and previous generations are
+// kept (and, with an event file, survive worker and server restarts).
+//
 // Lifecycle:
 //
-//	generation starts  → runner calls Publish() repeatedly
+//	generation starts  → StartGen(); previous generation kept for resume
+//	runner              → Publish() repeatedly; never blocks, never drops
 //	browser disconnects → subscriber goroutine exits; runner is unaffected
-//	browser reconnects  → new Subscribe() call replays buffer + continues
+//	browser reconnects  → Subscribe(after) replays missed events + continues
 //	generation done     → Publish("done", ...) → buffer kept until next StartGen()
 package session
 
 import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"os"
 	"sync"
 )
 
 // BroadcastEvent is a single event in a generation turn.
 type BroadcastEvent struct {
-	Type string // "text_delta" | "thinking_delta" | "tool_call" | "tool_result" | "error" | "done"
-	Data []byte // JSON-encoded payload (same as the SSE data field)
+	ID   uint64          `json:"id"`   // monotonically increasing per session
+	Gen  int             `json:"gen"`  // generation turn the event belongs to
+	Type string          `json:"type"` // "text_delta" | "thinking_delta" | "tool_call" | "tool_result" | "error" | "done"
+	Data json.RawMessage `json:"data"` // JSON-encoded payload (same as the SSE data field)
 }
 
 // Broadcaster is a thread-safe fan-out broadcaster with a replay buffer.
 // One Broadcaster exists per session; it is reused across multiple generation turns.
 type Broadcaster struct {
 	mu     sync.RWMutex
-	subs   map[string]chan BroadcastEvent // subscriber id → channel
-	buffer []BroadcastEvent              // events for the current generation
-	genID  int                           // monotonically increasing per generation turn
-	done   bool                          // true if current generation is finished
+	subs   map[string]*subscriber
+	prev   []BroadcastEvent // events of the previous generation (resume only)
+	buffer []BroadcastEvent // events for the current generation
+	genID  int              // monotonically increasing per generation turn
+	lastID uint64           // ID of the most recent event
+	done   bool             // true if current generation is finished
+
+	path string   // event file; empty = memory only
+	file *os.File // open for append while path is set
 }
 
-// NewBroadcaster creates an idle Broadcaster.
+// NewBroadcaster creates an idle, memory-only Broadcaster.
 func NewBroadcaster() *Broadcaster {
 	return &Broadcaster{
-		subs: make(map[string]chan BroadcastEvent),
+		subs: make(map[string]*subscriber),
+	}
+}
+
+// NewPersistentBroadcaster creates a Broadcaster that mirrors the current and
+// previous generation to path (JSONL) and restores them from it, so event IDs
+// stay monotonic and resumable across worker and server restarts.
+func NewPersistentBroadcaster(path string) *Broadcaster {
+	b := NewBroadcaster()
+	b.path = path
+	events, _ := ReadEventFile(path)
+	for _, ev := range events {
+		if ev.Gen != b.genID {
+			b.prev, b.buffer = b.buffer, nil
+			b.genID = ev.Gen
+			b.done = false
+		}
+		b.buffer = append(b.buffer, ev)
+		b.lastID = ev.ID
+		if ev.Type == "done" || ev.Type == "error" {
+			b.done = true
+		}
+	}
+	if len(b.buffer) > 0 && !b.done {
+		// The process died mid-generation; close it so clients stop waiting.
+		data, _ := json.Marshal(map[string]any{"type": "error", "error": "server restarted during generation"})
+		b.Publish(BroadcastEvent{Type: "error", Data: data})
+	}
+	return b
+}
+
+// ReadEventFile loads the events persisted by a Broadcaster.
+func ReadEventFile(path string) ([]BroadcastEvent, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
 	}
+	defer f.Close()
+	var events []BroadcastEvent
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 4*1024*1024), 4*1024*1024)
+	for sc.Scan() {
+		var ev BroadcastEvent
+		if json.Unmarshal(sc.Bytes(), &ev) == nil && ev.ID > 0 {
+			events = append(events, ev)
+		}
+	}
+	return events, sc.Err()
 }
 
-// StartGen marks the beginning of a new generation turn, clearing the old buffer.
+// StartGen marks the beginning of a new generation turn. The finished
+// generation moves to the resume buffer. Calling it again before anything
+// was published is a no-op, so callers may reset eagerly.
 func (b *Broadcaster) StartGen() {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	b.buffer = b.buffer[:0]
+	if len(b.buffer) == 0 && !b.done && b.genID > 0 {
+		return
+	}
+	b.prev = b.buffer
+	b.buffer = nil
 	b.genID++
 	b.done = false
+	b.rewriteLocked()
 }
 
-// Publish sends an event to all current subscribers and appends it to the buffer.
+// Publish assigns the next ID, appends the event to the buffer and queues
+// it for every subscriber. It never blocks and never drops events.
 func (b *Broadcaster) Publish(ev BroadcastEvent) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
+	if b.genID == 0 {
+		b.genID = 1
+	}
+	b.lastID++
+	ev.ID = b.lastID
+	ev.Gen = b.genID
 	b.buffer = append(b.buffer, ev)
 	if ev.Type == "done" || ev.Type == "error" {
 		b.done = true
 	}
-	for _, ch := range b.subs {
-		select {
-		case ch <- ev:
-		default:
-			// slow subscriber — drop rather than block the runner
-		}
+	b.appendLocked(ev)
+	for _, s := range b.subs {
+		s.push(ev)
 	}
 }
 
-// Subscribe registers a new subscriber. It immediately receives all buffered
-// events from the current generation, then live events going forward.
-// Call the returned unsubscribe func when done.
-func (b *Broadcaster) Subscribe(id string) (<-chan BroadcastEvent, func()) {
-	ch := make(chan BroadcastEvent, 256)
+// Subscribe registers a new subscriber. It first receives buffered events —
+// those with an ID greater than after, or the whole current generation when
+// after is 0 — then live events. Call the returned unsubscribe func when done.
+func (b *Broadcaster) Subscribe(id string, after uint64) (<-chan BroadcastEvent, func()) {
+	s := &subscriber{
+		wake: make(chan struct{}, 1),
+		out:  make(chan BroadcastEvent, 64),
+		quit: make(chan struct{}),
+	}
 
 	b.mu.Lock()
-	// Replay buffer first (under lock so no events are missed)
-	snapshot := make([]BroadcastEvent, len(b.buffer))
-	copy(snapshot, b.buffer)
-	isDone := b.done
-	b.subs[id] = ch
-	b.mu.Unlock()
-
-	// Send buffered events without holding the lock to avoid deadlock
-	go func() {
-		for _, ev := range snapshot {
-			ch <- ev
+	// Seed the queue under the lock so replay and live events stay in order.
+	// An ID from the future means the event history was lost; start over.
+	if after == 0 || after > b.lastID {
+		s.queue = append(s.queue, b.buffer...)
+	} else {
+		for _, ev := range b.prev {
+			if ev.ID > after {
+				s.queue = append(s.queue, ev)
+			}
 		}
-		// If generation already finished, signal and close
-		if isDone {
-			// The "done" event is already in snapshot; nothing extra needed.
-			_ = isDone
+		for _, ev := range b.buffer {
+			if ev.ID > after {
+				s.queue = append(s.queue, ev)
+			}
 		}
-	}()
+	}
+	b.subs[id] = s
+	b.mu.Unlock()
+
+	go s.pump()
 
+	var once sync.Once
 	unsub := func() {
-		b.mu.Lock()
-		delete(b.subs, id)
-		b.mu.Unlock()
-		// Drain the channel so the goroutine above doesn't block
-		for {
-			select {
-			case <-ch:
-			default:
-				return
-			}
-		}
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, id)
+			b.mu.Unlock()
+			close(s.quit)
+		})
 	}
-	return ch, unsub
+	return s.out, unsub
 }
 
 // IsDone reports whether the current generation has finished.
@@ -122,3 +198,110 @@ func (b *Broadcaster) BufferLen() int {
 	defer b.mu.RUnlock()
 	return len(b.buffer)
 }
+
+// Gen returns the current generation number.
+func (b *Broadcaster) Gen() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.genID
+}
+
+// LastID returns the ID of the most recent event (0 if none).
+func (b *Broadcaster) LastID() uint64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.lastID
+}
+
+// Close releases the event file; a later Publish reopens it.
+func (b *Broadcaster) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.file != nil {
+		b.file.Close()
+		b.file = nil
+	}
+}
+
+func (b *Broadcaster) appendLocked(ev BroadcastEvent) {
+	if b.path == "" {
+		return
+	}
+	if b.file == nil {
+		f, err := os.OpenFile(b.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Printf("[broadcaster] open %s: %v", b.path, err)
+			return
+		}
+		b.file = f
+	}
+	data, _ := json.Marshal(ev)
+	if _, err := b.file.Write(append(data, '\n')); err != nil {
+		log.Printf("[broadcaster] write %s: %v", b.path, err)
+	}
+}
+
+// rewriteLocked truncates the event file to the previous generation.
+func (b *Broadcaster) rewriteLocked() {
+	if b.path == "" {
+		return
+	}
+	if b.file != nil {
+		b.file.Close()
+		b.file = nil
+	}
+	var buf []byte
+	for _, ev := range b.prev {
+		data, _ := json.Marshal(ev)
+		buf = append(append(buf, data...), '\n')
+	}
+	tmp := b.path + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0644); err != nil {
+		log.Printf("[broadcaster] rewrite %s: %v", b.path, err)
+		return
+	}
+	if err := os.Rename(tmp, b.path); err != nil {
+		log.Printf("[broadcaster] rewrite %s: %v", b.path, err)
+	}
+}
+
+// subscriber has an unbounded queue drained by its own goroutine, so a slow
+// client delays only itself and never loses events.
+type subscriber struct {
+	mu    sync.Mutex
+	queue []BroadcastEvent
+	wake  chan struct{}
+	out   chan BroadcastEvent
+	quit  chan struct{}
+}
+
+func (s *subscriber) push(ev BroadcastEvent) {
+	s.mu.Lock()
+	s.queue = append(s.queue, ev)
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscriber) pump() {
+	for {
+		s.mu.Lock()
+		batch := s.queue
+		s.queue = nil
+		s.mu.Unlock()
+		for _, ev := range batch {
+			select {
+			case s.out <- ev:
+			case <-s.quit:
+				return
+			}
+		}
+		select {
+		case <-s.wake:
+		case <-s.quit:
+			return
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package session
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func publishN(b *Broadcaster, n int, final bool) {
+	for i := 0; i < n; i++ {
+		b.Publish(BroadcastEvent{Type: "text_delta", Data: json.RawMessage(`{"type":"text_delta"}`)})
+	}
+	if final {
+		b.Publish(BroadcastEvent{Type: "done", Data: json.RawMessage(`{"type":"done"}`)})
+	}
+}
+
+func collect(t *testing.T, ch <-chan BroadcastEvent, n int) []BroadcastEvent {
+	t.Helper()
+	var out []BroadcastEvent
+	for len(out) < n {
+		select {
+		case ev := <-ch:
+			out = append(out, ev)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("got %d of %d events", len(out), n)
+		}
+	}
+	return out
+}
+
+func TestBroadcasterResume(t *testing.T) {
+	b := NewBroadcaster()
+	b.StartGen()
+	publishN(b, 3, true) // IDs 1-4
+	b.StartGen()
+	publishN(b, 2, false) // IDs 5-6
+
+	// Resuming from the middle of the previous generation crosses into the current one.
+	ch, unsub := b.Subscribe("a", 2)
+	defer unsub()
+	got := collect(t, ch, 4)
+	for i, ev := range got {
+		if ev.ID != uint64(3+i) {
+			t.Fatalf("event %d has ID %d", i, ev.ID)
+		}
+	}
+	if got[1].Type != "done" || got[1].Gen != 1 || got[2].Gen != 2 {
+		t.Fatalf("generations = %+v", got)
+	}
+
+	// Without an ID only the current generation is replayed.
+	ch2, unsub2 := b.Subscribe("b", 0)
+	defer unsub2()
+	if ev := collect(t, ch2, 1)[0]; ev.ID != 5 {
+		t.Fatalf("first event = %d", ev.ID)
+	}
+}
+
+func TestBroadcasterSlowSubscriber(t *testing.T) {
+	b := NewBroadcaster()
+	ch, unsub := b.Subscribe("slow", 0)
+	defer unsub()
+	publishN(b, 1000, true) // far more than the channel buffer
+	got := collect(t, ch, 1001)
+	for i, ev := range got {
+		if ev.ID != uint64(i+1) {
+			t.Fatalf("event %d has ID %d", i, ev.ID)
+		}
+	}
+}
+
+func TestPersistentBroadcaster(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "s.events.jsonl")
+	b := NewPersistentBroadcaster(path)
+	publishN(b, 2, true)
+	b.StartGen()
+	publishN(b, 2, false) // interrupted generation
+	b.Close()
+
+	r := NewPersistentBroadcaster(path)
+	defer r.Close()
+	// The unfinished generation is closed with an error event.
+	if r.LastID() != 6 || !r.IsDone() || r.Gen() != 2 {
+		t.Fatalf("restored lastID=%d done=%v gen=%d", r.LastID(), r.IsDone(), r.Gen())
+	}
+	ch, unsub := r.Subscribe("c", 1)
+	defer unsub()
+	got := collect(t, ch, 5)
+	if got[0].ID != 2 || got[4].Type != "error" {
+		t.Fatalf("replay = %+v", got)
+	}
+
+	r.StartGen()
+	publishN(r, 0, true)
+	if events, _ := ReadEventFile(path); len(events) != 4 || events[0].ID != 4 {
+		t.Fatalf("event file keeps %d events", len(events))
+	}
+}
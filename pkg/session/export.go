@@ -0,0 +1,511 @@
+package session
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Export formats accepted by Export.
+const (
+	FormatMarkdown  = "md"
+	FormatHTML      = "html"
+	FormatJSON      = "json"
+	FormatOpenAI    = "openai"
+	FormatAnthropic = "anthropic"
+)
+
+// exportToolChars bounds tool inputs/results in human-readable exports.
+const exportToolChars = 2000
+
+// ExportInfo describes the session being exported.
+type ExportInfo struct {
+	Meta      SessionIndexEntry
+	AgentName string
+}
+
+// NativeExport is the FormatJSON document; it is also embedded in HTML
+// exports so they can be imported again without loss.
+type NativeExport struct {
+	Format    string            `json:"format"` // always "aipanel.session"
+	Version   int               `json:"version"`
+	Session   SessionIndexEntry `json:"session"`
+	AgentName string            `json:"agentName,omitempty"`
+	Entries   []json.RawMessage `json:"entries"`
+}
+
+const nativeFormatName = "aipanel.session"
+
+// block is the union of content block shapes stored in sessions
+// (Anthropic message format).
+type block struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   json.RawMessage `json:"content,omitempty"` // tool_result: string or blocks
+	IsError   bool            `json:"is_error,omitempty"`
+	Source    *blockSource    `json:"source,omitempty"` // image / document
+}
+
+type blockSource struct {
+	Type      string `json:"type"` // "base64" | "url"
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// item is one message or compaction, decoded for rendering.
+type item struct {
+	compaction bool
+	summary    string
+	role       string
+	ts         int64
+	content    json.RawMessage
+	blocks     []block
+	toolCalls  []ToolCallRecord
+}
+
+func decodeBlocks(content json.RawMessage) []block {
+	var s string
+	if json.Unmarshal(content, &s) == nil {
+		return []block{{Type: "text", Text: s}}
+	}
+	var blocks []block
+	_ = json.Unmarshal(content, &blocks)
+	return blocks
+}
+
+func decodeItems(entries []json.RawMessage) []item {
+	var items []item
+	for _, raw := range entries {
+		var e struct {
+			Type      EntryType `json:"type"`
+			Summary   string    `json:"summary"`
+			Message   Message   `json:"message"`
+			Timestamp int64     `json:"timestamp"`
+			Carried   bool      `json:"carried"`
+		}
+		if json.Unmarshal(raw, &e) != nil || e.Carried {
+			continue
+		}
+		switch e.Type {
+		case EntryTypeCompaction:
+			items = append(items, item{compaction: true, summary: e.Summary, ts: e.Timestamp})
+		case EntryTypeMessage:
+			items = append(items, item{
+				role:      e.Message.Role,
+				ts:        e.Timestamp,
+				content:   e.Message.Content,
+				blocks:    decodeBlocks(e.Message.Content),
+				toolCalls: e.Message.ToolCalls,
+			})
+		}
+	}
+	return items
+}
+
+// Export renders a session in one of the Format* formats and returns the
+// document and its content type.
+func Export(info ExportInfo, entries []json.RawMessage, format string) ([]byte, string, error) {
+	switch format {
+	case FormatJSON:
+		data, err := json.MarshalIndent(nativeExport(info, entries), "", "  ")
+		return data, "application/json", err
+	case FormatMarkdown:
+		return []byte(exportMarkdown(info, decodeItems(entries))), "text/markdown; charset=utf-8", nil
+	case FormatHTML:
+		data, err := exportHTML(info, entries)
+		return data, "text/html; charset=utf-8", err
+	case FormatOpenAI:
+		data, err := json.MarshalIndent(exportOpenAI(decodeItems(entries)), "", "  ")
+		return data, "application/json", err
+	case FormatAnthropic:
+		data, err := json.MarshalIndent(exportAnthropic(decodeItems(entries)), "", "  ")
+		return data, "application/json", err
+	}
+	return nil, "", fmt.Errorf("unknown export format %q (md, html, json, openai, anthropic)", format)
+}
+
+func nativeExport(info ExportInfo, entries []json.RawMessage) NativeExport {
+	if entries == nil {
+		entries = []json.RawMessage{}
+	}
+	return NativeExport{Format: nativeFormatName, Version: CurrentVersion, Session: info.Meta, AgentName: info.AgentName, Entries: entries}
+}
+
+func exportTitle(info ExportInfo) string {
+	if info.Meta.Title != "" {
+		return info.Meta.Title
+	}
+	return info.Meta.ID
+}
+
+func formatTime(ms int64) string {
+	if ms == 0 {
+		return ""
+	}
+	return time.UnixMilli(ms).Format("2006-01-02 15:04:05")
+}
+
+func clip(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "…（已截断）"
+}
+
+// toolResultText flattens a tool_result content field.
+func toolResultText(content json.RawMessage) string {
+	if len(content) == 0 {
+		return ""
+	}
+	var parts []string
+	for _, b := range decodeBlocks(content) {
+		switch b.Type {
+		case "text":
+			parts = append(parts, b.Text)
+		case "image":
+			parts = append(parts, "[图片]")
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+func prettyJSON(raw json.RawMessage) string {
+	var buf bytes.Buffer
+	if json.Indent(&buf, raw, "", "  ") != nil {
+		return string(raw)
+	}
+	return buf.String()
+}
+
+func mediaLabel(src *blockSource) string {
+	if src == nil {
+		return "附件"
+	}
+	if src.Type == "url" {
+		return src.URL
+	}
+	size := base64.StdEncoding.DecodedLen(len(src.Data))
+	return fmt.Sprintf("%s, %s", src.MediaType, humanBytes(size))
+}
+
+func humanBytes(n int) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.0f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// isToolResultOnly reports a user message that only carries tool results;
+// exports attach it to the preceding assistant turn instead of showing it
+// as something the user said.
+func isToolResultOnly(it item) bool {
+	if it.role != "user" || len(it.blocks) == 0 {
+		return false
+	}
+	for _, b := range it.blocks {
+		if b.Type != "tool_result" {
+			return false
+		}
+	}
+	return true
+}
+
+// hasToolBlocks reports whether tool calls were stored as content blocks;
+// otherwise the display-only ToolCalls records are rendered instead.
+func hasToolBlocks(items []item) bool {
+	for _, it := range items {
+		for _, b := range it.blocks {
+			if b.Type == "tool_use" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func roleLabel(role string) string {
+	switch role {
+	case "user":
+		return "👤 用户"
+	case "assistant":
+		return "🤖 助手"
+	}
+	return role
+}
+
+// ── Markdown ────────────────────────────────────────────────────────────────
+
+func exportMarkdown(info ExportInfo, items []item) string {
+	var sb strings.Builder
+	sb.WriteString("# " + exportTitle(info) + "\n\n")
+	if info.AgentName != "" || info.Meta.AgentID != "" {
+		sb.WriteString(fmt.Sprintf("- 成员: %s (%s)\n", info.AgentName, info.Meta.AgentID))
+	}
+	sb.WriteString(fmt.Sprintf("- 会话: %s\n", info.Meta.ID))
+	if t := formatTime(info.Meta.CreatedAt); t != "" {
+		sb.WriteString("- 创建时间: " + t + "\n")
+	}
+	sb.WriteString(fmt.Sprintf("- 导出时间: %s\n\n---\n", time.Now().Format("2006-01-02 15:04:05")))
+
+	useBlocks := hasToolBlocks(items)
+	for _, it := range items {
+		if it.compaction {
+			sb.WriteString("\n> 📝 **此前对话摘要**\n>\n")
+			for _, line := range strings.Split(strings.TrimSpace(it.summary), "\n") {
+				sb.WriteString("> " + line + "\n")
+			}
+			continue
+		}
+		if !isToolResultOnly(it) {
+			sb.WriteString(fmt.Sprintf("\n### %s · %s\n\n", roleLabel(it.role), formatTime(it.ts)))
+		}
+		for _, b := range it.blocks {
+			switch b.Type {
+			case "text":
+				if strings.TrimSpace(b.Text) != "" {
+					sb.WriteString(b.Text + "\n\n")
+				}
+			case "image":
+				sb.WriteString(fmt.Sprintf("*[🖼 图片: %s]*\n\n", mediaLabel(b.Source)))
+			case "document":
+				sb.WriteString(fmt.Sprintf("*[📎 文档: %s]*\n\n", mediaLabel(b.Source)))
+			case "tool_use":
+				sb.WriteString(fmt.Sprintf("<details><summary>🔧 调用工具 <code>%s</code></summary>\n\n```json\n%s\n```\n\n</details>\n\n",
+					html.EscapeString(b.Name), clip(prettyJSON(b.Input), exportToolChars)))
+			case "tool_result":
+				label := "📤 工具结果"
+				if b.IsError {
+					label = "⚠️ 工具出错"
+				}
+				sb.WriteString(fmt.Sprintf("<details><summary>%s</summary>\n\n```\n%s\n```\n\n</details>\n\n",
+					label, clip(toolResultText(b.Content), exportToolChars)))
+			}
+		}
+		if !useBlocks {
+			for _, tc := range it.toolCalls {
+				sb.WriteString(fmt.Sprintf("<details><summary>🔧 调用工具 <code>%s</code></summary>\n\n```json\n%s\n```\n\n```\n%s\n```\n\n</details>\n\n",
+					html.EscapeString(tc.Name), clip(tc.Input, exportToolChars), clip(tc.Result, exportToolChars)))
+			}
+		}
+	}
+	return sb.String()
+}
+
+// ── HTML ────────────────────────────────────────────────────────────────────
+
+const htmlStyle = `body{font-family:-apple-system,BlinkMacSystemFont,"Segoe UI","PingFang SC","Microsoft YaHei",sans-serif;max-width:860px;margin:0 auto;padding:24px;color:#1f2328;background:#f6f8fa}
+h1{font-size:22px}.meta{color:#57606a;font-size:13px;margin-bottom:24px}
+.msg{background:#fff;border:1px solid #d0d7de;border-radius:8px;padding:12px 16px;margin:12px 0}
+.msg.user{border-left:4px solid #0969da}.msg.assistant{border-left:4px solid #1a7f37}
+.head{font-size:12px;color:#57606a;margin-bottom:6px}.text{white-space:pre-wrap;word-wrap:break-word;line-height:1.6}
+details{margin:6px 0;font-size:13px}summary{cursor:pointer;color:#57606a}pre{background:#f6f8fa;padding:8px;border-radius:6px;overflow:auto;font-size:12px}
+.compaction{background:#fff8c5;border:1px solid #d4a72c;border-radius:8px;padding:12px 16px;margin:12px 0;white-space:pre-wrap}
+img{max-width:100%;border-radius:6px;margin:6px 0}.media{color:#57606a;font-style:italic}`
+
+func exportHTML(info ExportInfo, entries []json.RawMessage) ([]byte, error) {
+	items := decodeItems(entries)
+	esc := html.EscapeString
+	var sb strings.Builder
+	sb.WriteString("<!DOCTYPE html>\n<html lang=\"zh-CN\">\n<head>\n<meta charset=\"utf-8\">\n<meta name=\"viewport\" content=\"width=device-width,initial-scale=1\">\n")
+	sb.WriteString("<title>" + esc(exportTitle(info)) + "</title>\n<style>" + htmlStyle + "</style>\n</head>\n<body>\n")
+	sb.WriteString("<h1>" + esc(exportTitle(info)) + "</h1>\n<div class=\"meta\">")
+	if info.AgentName != "" {
+		sb.WriteString("成员: " + esc(info.AgentName) + " · ")
+	}
+	sb.WriteString("会话: " + esc(info.Meta.ID))
+	if t := formatTime(info.Meta.CreatedAt); t != "" {
+		sb.WriteString(" · 创建于 " + t)
+	}
+	sb.WriteString("</div>\n")
+
+	useBlocks := hasToolBlocks(items)
+	details := func(summary, body string) {
+		sb.WriteString("<details><summary>" + summary + "</summary><pre>" + esc(body) + "</pre></details>\n")
+	}
+	for _, it := range items {
+		if it.compaction {
+			sb.WriteString("<div class=\"compaction\"><strong>📝 此前对话摘要</strong>\n" + esc(strings.TrimSpace(it.summary)) + "</div>\n")
+			continue
+		}
+		if isToolResultOnly(it) {
+			for _, b := range it.blocks {
+				details("📤 工具结果", clip(toolResultText(b.Content), exportToolChars))
+			}
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("<div class=\"msg %s\"><div class=\"head\">%s · %s</div>\n", esc(it.role), roleLabel(it.role), formatTime(it.ts)))
+		for _, b := range it.blocks {
+			switch b.Type {
+			case "text":
+				if strings.TrimSpace(b.Text) != "" {
+					sb.WriteString("<div class=\"text\">" + esc(b.Text) + "</div>\n")
+				}
+			case "image":
+				if b.Source != nil && b.Source.Type == "base64" {
+					// Data can come from an imported file; only emit it once it
+					// is known to be plain base64 that cannot leave the attribute.
+					if _, err := base64.StdEncoding.DecodeString(b.Source.Data); err == nil {
+						sb.WriteString(fmt.Sprintf("<img src=\"data:%s;base64,%s\" alt=\"image\">\n", esc(b.Source.MediaType), b.Source.Data))
+					} else {
+						sb.WriteString("<div class=\"media\">🖼 图片（数据无效，已省略）</div>\n")
+					}
+				} else if b.Source != nil && b.Source.URL != "" {
+					sb.WriteString("<img src=\"" + esc(b.Source.URL) + "\" alt=\"image\">\n")
+				}
+			case "document":
+				sb.WriteString("<div class=\"media\">📎 文档: " + esc(mediaLabel(b.Source)) + "</div>\n")
+			case "tool_use":
+				details("🔧 调用工具 <code>"+esc(b.Name)+"</code>", clip(prettyJSON(b.Input), exportToolChars))
+			case "tool_result":
+				details("📤 工具结果", clip(toolResultText(b.Content), exportToolChars))
+			}
+		}
+		if !useBlocks {
+			for _, tc := range it.toolCalls {
+				details("🔧 调用工具 <code>"+esc(tc.Name)+"</code>", clip(tc.Input, exportToolChars)+"\n\n→ "+clip(tc.Result, exportToolChars))
+			}
+		}
+		sb.WriteString("</div>\n")
+	}
+
+	// Embedded copy for lossless re-import. json.Marshal escapes <, > and &.
+	data, err := json.Marshal(nativeExport(info, entries))
+	if err != nil {
+		return nil, err
+	}
+	sb.WriteString("<script type=\"application/json\" id=\"session-data\">")
+	sb.Write(data)
+	sb.WriteString("</script>\n</body>\n</html>\n")
+	return []byte(sb.String()), nil
+}
+
+// ── OpenAI / Anthropic message formats ─────────────────────────────────────
+
+type openAIMessage struct {
+	Role       string           `json:"role"`
+	Content    any              `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openAIToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"` // "function"
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type openAIPart struct {
+	Type     string `json:"type"` // "text" | "image_url"
+	Text     string `json:"text,omitempty"`
+	ImageURL *struct {
+		URL string `json:"url"`
+	} `json:"image_url,omitempty"`
+}
+
+// exportOpenAI produces {"messages": [...]} in Chat Completions format, the
+// shape used for fine-tuning datasets.
+func exportOpenAI(items []item) map[string]any {
+	msgs := []openAIMessage{}
+	for _, it := range items {
+		if it.compaction {
+			msgs = append(msgs, openAIMessage{Role: "system", Content: "[Previous conversation summary]\n\n" + it.summary})
+			continue
+		}
+		var parts []openAIPart
+		var calls []openAIToolCall
+		hasImage := false
+		for _, b := range it.blocks {
+			switch b.Type {
+			case "text":
+				parts = append(parts, openAIPart{Type: "text", Text: b.Text})
+			case "image":
+				if b.Source == nil {
+					continue
+				}
+				url := b.Source.URL
+				if b.Source.Type == "base64" {
+					url = "data:" + b.Source.MediaType + ";base64," + b.Source.Data
+				}
+				p := openAIPart{Type: "image_url"}
+				p.ImageURL = &struct {
+					URL string `json:"url"`
+				}{URL: url}
+				parts = append(parts, p)
+				hasImage = true
+			case "document":
+				parts = append(parts, openAIPart{Type: "text", Text: "[文档: " + mediaLabel(b.Source) + "]"})
+			case "tool_use":
+				var tc openAIToolCall
+				tc.ID, tc.Type = b.ID, "function"
+				tc.Function.Name = b.Name
+				tc.Function.Arguments = string(b.Input)
+				if tc.Function.Arguments == "" {
+					tc.Function.Arguments = "{}"
+				}
+				calls = append(calls, tc)
+			case "tool_result":
+				msgs = append(msgs, openAIMessage{Role: "tool", ToolCallID: b.ToolUseID, Content: toolResultText(b.Content)})
+			}
+		}
+		if len(parts) == 0 && len(calls) == 0 {
+			continue
+		}
+		m := openAIMessage{Role: it.role, ToolCalls: calls}
+		switch {
+		case hasImage:
+			m.Content = parts
+		case len(parts) > 0:
+			texts := make([]string, len(parts))
+			for i, p := range parts {
+				texts[i] = p.Text
+			}
+			m.Content = strings.Join(texts, "\n")
+		default:
+			m.Content = nil // assistant turn with only tool calls
+		}
+		msgs = append(msgs, m)
+	}
+	return map[string]any{"messages": msgs}
+}
+
+// exportAnthropic produces a Messages API request body. Stored content is
+// already in Anthropic format; compaction summaries go into "system".
+func exportAnthropic(items []item) map[string]any {
+	type anthropicMessage struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	}
+	msgs := []anthropicMessage{}
+	var system []string
+	for _, it := range items {
+		if it.compaction {
+			system = append(system, "[Previous conversation summary]\n\n"+it.summary)
+			continue
+		}
+		if it.role != "user" && it.role != "assistant" {
+			continue
+		}
+		msgs = append(msgs, anthropicMessage{Role: it.role, Content: it.content})
+	}
+	out := map[string]any{"messages": msgs}
+	if len(system) > 0 {
+		out["system"] = strings.Join(system, "\n\n")
+	}
+	return out
+}
@@ -0,0 +1,106 @@
+package session
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	src := NewJSONLStore(t.TempDir())
+	sid, _, _ := src.GetOrCreate("", "sales")
+	_ = src.AppendMessage(sid, "user", json.RawMessage(`[{"type":"image","source":{"type":"base64","media_type":"image/png","data":"iVBORw0KGgo="}},{"type":"text","text":"这张图里是什么？"}]`))
+	_ = src.AppendMessage(sid, "assistant", json.RawMessage(`[{"type":"tool_use","id":"t1","name":"read","input":{"path":"a.md"}}]`))
+	_ = src.AppendMessage(sid, "user", json.RawMessage(`[{"type":"tool_result","tool_use_id":"t1","content":"<b>hello</b>"}]`))
+	_ = src.AppendMessage(sid, "assistant", json.RawMessage(`"是一张 logo"`))
+	_ = src.Append(sid, CompactionEntry{BaseEntry: BaseEntry{Type: EntryTypeCompaction}, Summary: "用户在问图片", Timestamp: nowMs()})
+	meta, _ := src.GetMeta(sid)
+	entries, _ := src.ReadAll(sid)
+	info := ExportInfo{Meta: meta, AgentName: "销售"}
+
+	md, _, err := Export(info, entries, FormatMarkdown)
+	if err != nil || !strings.Contains(string(md), "### 👤 用户") || !strings.Contains(string(md), "🖼 图片") || !strings.Contains(string(md), "此前对话摘要") {
+		t.Fatalf("markdown export:\n%s", md)
+	}
+	page, _, err := Export(info, entries, FormatHTML)
+	if err != nil || strings.Contains(string(page), "<b>hello</b>") || !strings.Contains(string(page), "data:image/png;base64,") {
+		t.Fatalf("html export not escaped / missing image")
+	}
+
+	var oa struct {
+		Messages []struct {
+			Role      string `json:"role"`
+			ToolCalls []struct {
+				Function struct{ Arguments string } `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"messages"`
+	}
+	data, _, _ := Export(info, entries, FormatOpenAI)
+	_ = json.Unmarshal(data, &oa)
+	roles := []string{}
+	for _, m := range oa.Messages {
+		roles = append(roles, m.Role)
+	}
+	if got := strings.Join(roles, ","); got != "user,assistant,tool,assistant,system" {
+		t.Fatalf("openai roles = %s", got)
+	}
+	if oa.Messages[1].ToolCalls[0].Function.Arguments != `{"path":"a.md"}` {
+		t.Fatalf("openai arguments = %q", oa.Messages[1].ToolCalls[0].Function.Arguments)
+	}
+
+	// Every format imports into a new session; lossless ones keep all
+	// messages, OpenAI keeps tool calls and images.
+	sq, err := OpenSQLite(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sq.Close()
+	for _, dst := range []Store{NewJSONLStore(t.TempDir()), sq} {
+		for format, wantMsgs := range map[string]int{FormatJSON: 4, FormatHTML: 4, FormatOpenAI: 4, FormatAnthropic: 4, FormatMarkdown: 2} {
+			data, _, _ := Export(info, entries, format)
+			im, err := ParseImport(data, "s."+exportExts(format))
+			if err != nil {
+				t.Fatalf("%s: ParseImport: %v", format, err)
+			}
+			id, err := dst.Import("support", "", im.Entries)
+			if err != nil {
+				t.Fatalf("%s: Import: %v", format, err)
+			}
+			m, ok := dst.GetMeta(id)
+			if !ok || m.AgentID != "support" || m.MessageCount != wantMsgs {
+				t.Fatalf("%s: imported meta = %+v", format, m)
+			}
+			if _, summary, _ := dst.ReadHistory(id); summary != "用户在问图片" {
+				t.Fatalf("%s: summary = %q", format, summary)
+			}
+		}
+	}
+
+	// pi-coding-agent v3 JSONL: unknown entry types are skipped.
+	jsonl := `{"type":"session","version":3,"id":"x"}
+{"type":"model_change","provider":"anthropic"}
+{"type":"message","message":{"role":"user","content":"hi"},"timestamp":1}`
+	im, err := ParseImport([]byte(jsonl), "x.jsonl")
+	if err != nil || len(im.Entries) != 1 {
+		t.Fatalf("jsonl import = %+v, %v", im, err)
+	}
+}
+
+func exportExts(format string) string {
+	switch format {
+	case FormatOpenAI, FormatAnthropic:
+		return "json"
+	}
+	return format
+}
+
+func TestExportHTMLSkipsInvalidImageData(t *testing.T) {
+	entry := json.RawMessage(`{"type":"message","message":{"role":"user","content":[{"type":"image","source":{"type":"base64","media_type":"image/png","data":"x\"><script>alert(1)</script>"}}]},"timestamp":1}`)
+	page, _, err := Export(ExportInfo{Meta: SessionIndexEntry{ID: "s"}}, []json.RawMessage{entry}, FormatHTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(page), "<script>alert(1)") || !strings.Contains(string(page), "数据无效") {
+		t.Fatalf("invalid image data not skipped:\n%s", page)
+	}
+}
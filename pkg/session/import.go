@@ -0,0 +1,479 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ErrUnknownImportFormat is returned by ParseImport for unrecognised input.
+var ErrUnknownImportFormat = errors.New("unrecognised session format (expected aipanel json/html export, OpenAI or Anthropic messages, v3 JSONL or markdown)")
+
+// Imported is a parsed session ready to be stored with Store.Import.
+type Imported struct {
+	Title   string
+	Entries []json.RawMessage // message and compaction entries, no header
+}
+
+// ParseImport detects the format of an uploaded session and converts it to
+// session entries. Accepted: our json/html exports, OpenAI chat messages,
+// Anthropic Messages API bodies, pi-coding-agent/OpenClaw v3 JSONL and
+// markdown exports (text only).
+func ParseImport(data []byte, filename string) (*Imported, error) {
+	data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("\xef\xbb\xbf"))
+	if len(data) == 0 {
+		return nil, errors.New("empty file")
+	}
+	ext := strings.ToLower(filepath.Ext(filename))
+
+	if ext == ".html" || ext == ".htm" || bytes.HasPrefix(data, []byte("<")) {
+		return parseHTMLImport(data)
+	}
+	if data[0] == '{' || data[0] == '[' {
+		if im, err := parseJSONImport(data); err == nil {
+			return im, nil
+		} else if ext == ".json" || !bytes.Contains(data, []byte("\n")) {
+			return nil, err
+		}
+		// Multi-line input starting with '{' that is not a single document
+		// is JSONL.
+		return parseJSONLImport(data)
+	}
+	if ext == ".md" || ext == ".markdown" || ext == ".txt" || bytes.HasPrefix(data, []byte("#")) {
+		return parseMarkdownImport(data)
+	}
+	return nil, ErrUnknownImportFormat
+}
+
+var sessionDataRe = regexp.MustCompile(`(?s)<script type="application/json" id="session-data">(.*?)</script>`)
+
+func parseHTMLImport(data []byte) (*Imported, error) {
+	m := sessionDataRe.FindSubmatch(data)
+	if m == nil {
+		return nil, errors.New("html file has no embedded session data (only html exports from this panel can be imported)")
+	}
+	return parseJSONImport(m[1])
+}
+
+func parseJSONImport(data []byte) (*Imported, error) {
+	if data[0] == '[' {
+		var msgs []json.RawMessage
+		if err := json.Unmarshal(data, &msgs); err != nil {
+			return nil, err
+		}
+		return convertMessages(msgs, nil)
+	}
+	var doc struct {
+		Format  string            `json:"format"`
+		Session SessionIndexEntry `json:"session"`
+		Entries []json.RawMessage `json:"entries"`
+		// OpenAI / Anthropic
+		Messages []json.RawMessage `json:"messages"`
+		System   json.RawMessage   `json:"system"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	switch {
+	case doc.Entries != nil:
+		im := &Imported{Title: doc.Session.Title}
+		for _, e := range doc.Entries {
+			if keepImportEntry(e) {
+				im.Entries = append(im.Entries, e)
+			}
+		}
+		return im, nil
+	case doc.Messages != nil:
+		return convertMessages(doc.Messages, doc.System)
+	}
+	return nil, ErrUnknownImportFormat
+}
+
+// parseJSONLImport reads a v3 session file (ours or pi-coding-agent /
+// OpenClaw): message and compaction entries are kept, the header and
+// entry types we do not render are dropped.
+func parseJSONLImport(data []byte) (*Imported, error) {
+	im := &Imported{}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 8*1024*1024), 8*1024*1024)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if !json.Valid(line) {
+			return nil, errors.New("invalid JSONL line")
+		}
+		if keepImportEntry(line) {
+			im.Entries = append(im.Entries, append(json.RawMessage{}, line...))
+		}
+	}
+	return im, sc.Err()
+}
+
+func keepImportEntry(raw json.RawMessage) bool {
+	var e struct {
+		Type    EntryType `json:"type"`
+		Message *Message  `json:"message"`
+	}
+	if json.Unmarshal(raw, &e) != nil {
+		return false
+	}
+	switch e.Type {
+	case EntryTypeCompaction:
+		return true
+	case EntryTypeMessage:
+		return e.Message != nil && (e.Message.Role == "user" || e.Message.Role == "assistant")
+	}
+	return false
+}
+
+// convertMessages turns OpenAI or Anthropic message lists into entries.
+// Both shapes are handled by one pass: system messages become compaction
+// summaries, OpenAI tool messages/tool_calls become tool_result/tool_use
+// blocks and image_url parts become image blocks.
+func convertMessages(msgs []json.RawMessage, system json.RawMessage) (*Imported, error) {
+	im := &Imported{}
+	ts := nowMs()
+	next := func() int64 { ts++; return ts }
+	addMsg := func(role string, blocks []block) {
+		if len(blocks) == 0 {
+			return
+		}
+		var content json.RawMessage
+		if len(blocks) == 1 && blocks[0].Type == "text" {
+			content, _ = json.Marshal(blocks[0].Text)
+		} else {
+			content, _ = json.Marshal(blocks)
+		}
+		// Consecutive tool results belong in one user message.
+		if n := len(im.Entries); n > 0 && role == "user" && blocks[0].Type == "tool_result" {
+			var prev MessageEntry
+			if json.Unmarshal(im.Entries[n-1], &prev) == nil && prev.Type == EntryTypeMessage && prev.Message.Role == "user" {
+				if pb := decodeBlocks(prev.Message.Content); len(pb) > 0 && pb[0].Type == "tool_result" {
+					prev.Message.Content, _ = json.Marshal(append(pb, blocks...))
+					im.Entries[n-1], _ = json.Marshal(prev)
+					return
+				}
+			}
+		}
+		e, _ := json.Marshal(MessageEntry{
+			BaseEntry: BaseEntry{Type: EntryTypeMessage},
+			Message:   Message{Role: role, Content: content},
+			Timestamp: next(),
+		})
+		im.Entries = append(im.Entries, e)
+	}
+	addSummary := func(text string) {
+		if strings.TrimSpace(text) == "" {
+			return
+		}
+		text = strings.TrimPrefix(text, "[Previous conversation summary]\n\n")
+		e, _ := json.Marshal(CompactionEntry{BaseEntry: BaseEntry{Type: EntryTypeCompaction}, Summary: text, Timestamp: next()})
+		im.Entries = append(im.Entries, e)
+	}
+
+	if len(system) > 0 {
+		addSummary(flattenText(system))
+	}
+	for _, raw := range msgs {
+		var m struct {
+			Role       string          `json:"role"`
+			Content    json.RawMessage `json:"content"`
+			ToolCallID string          `json:"tool_call_id"`
+			ToolCalls  []struct {
+				ID       string `json:"id"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		}
+		if err := json.Unmarshal(raw, &m); err != nil {
+			return nil, fmt.Errorf("invalid message: %w", err)
+		}
+		switch m.Role {
+		case "system", "developer":
+			addSummary(flattenText(m.Content))
+		case "tool":
+			addMsg("user", []block{{Type: "tool_result", ToolUseID: m.ToolCallID, Content: textContent(flattenText(m.Content))}})
+		case "user", "assistant":
+			blocks := convertParts(m.Content)
+			for _, tc := range m.ToolCalls {
+				input := json.RawMessage(tc.Function.Arguments)
+				if !json.Valid(input) {
+					input = json.RawMessage(`{}`)
+				}
+				blocks = append(blocks, block{Type: "tool_use", ID: tc.ID, Name: tc.Function.Name, Input: input})
+			}
+			addMsg(m.Role, blocks)
+		}
+	}
+	if len(im.Entries) == 0 {
+		return nil, errors.New("no messages found")
+	}
+	return im, nil
+}
+
+// convertParts normalises string, Anthropic block or OpenAI part content.
+func convertParts(content json.RawMessage) []block {
+	var s string
+	if json.Unmarshal(content, &s) == nil {
+		if s == "" {
+			return nil
+		}
+		return []block{{Type: "text", Text: s}}
+	}
+	var parts []struct {
+		block
+		ImageURL *struct {
+			URL string `json:"url"`
+		} `json:"image_url"`
+	}
+	if json.Unmarshal(content, &parts) != nil {
+		return nil
+	}
+	var out []block
+	for _, p := range parts {
+		switch p.Type {
+		case "image_url":
+			if p.ImageURL != nil {
+				out = append(out, block{Type: "image", Source: dataURLSource(p.ImageURL.URL)})
+			}
+		case "input_text", "output_text":
+			out = append(out, block{Type: "text", Text: p.Text})
+		case "text", "image", "document", "tool_use", "tool_result":
+			out = append(out, p.block)
+		}
+	}
+	return out
+}
+
+func dataURLSource(url string) *blockSource {
+	if rest, ok := strings.CutPrefix(url, "data:"); ok {
+		if mt, data, ok := strings.Cut(rest, ";base64,"); ok {
+			return &blockSource{Type: "base64", MediaType: mt, Data: data}
+		}
+	}
+	return &blockSource{Type: "url", URL: url}
+}
+
+func textContent(s string) json.RawMessage {
+	data, _ := json.Marshal(s)
+	return data
+}
+
+// flattenText joins the text of string or block content.
+func flattenText(content json.RawMessage) string {
+	var parts []string
+	for _, b := range convertParts(content) {
+		if b.Type == "text" && b.Text != "" {
+			parts = append(parts, b.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// mdHeadingRe matches the role headings written by exportMarkdown and the
+// common "## User" / "## Assistant" style of other tools.
+var mdHeadingRe = regexp.MustCompile(`(?m)^#{2,4}\s*(?:👤\s*用户|🤖\s*助手|User|Assistant|用户|助手)(?:[\s:：·].*)?$`)
+
+// parseMarkdownImport recovers the text of each turn from a markdown
+// transcript. Tool calls and attachments cannot be restored.
+func parseMarkdownImport(data []byte) (*Imported, error) {
+	text := string(data)
+	im := &Imported{}
+	if first, _, _ := strings.Cut(text, "\n"); strings.HasPrefix(first, "# ") {
+		im.Title = strings.TrimSpace(strings.TrimPrefix(first, "# "))
+	}
+	locs := mdHeadingRe.FindAllStringIndex(text, -1)
+	if len(locs) == 0 {
+		return nil, errors.New("no user/assistant headings found in markdown")
+	}
+	var msgs []json.RawMessage
+	var system strings.Builder
+	for i, loc := range locs {
+		heading := text[loc[0]:loc[1]]
+		end := len(text)
+		if i+1 < len(locs) {
+			end = locs[i+1][0]
+		}
+		body := text[loc[1]:end]
+		// A summary blockquote before the next heading belongs to the session.
+		if idx := strings.Index(body, "> 📝 **此前对话摘要**"); idx >= 0 {
+			system.WriteString(unquote(body[idx:]))
+			body = body[:idx]
+		}
+		body = strings.TrimSpace(stripDetails(body))
+		role := "user"
+		if strings.Contains(heading, "助手") || strings.Contains(heading, "Assistant") {
+			role = "assistant"
+		}
+		msg, _ := json.Marshal(map[string]string{"role": role, "content": body})
+		msgs = append(msgs, msg)
+	}
+	if pre := text[:locs[0][0]]; strings.Contains(pre, "> 📝 **此前对话摘要**") {
+		idx := strings.Index(pre, "> 📝 **此前对话摘要**")
+		system.WriteString(unquote(pre[idx:]))
+	}
+	var sys json.RawMessage
+	if system.Len() > 0 {
+		sys = textContent(system.String())
+	}
+	conv, err := convertMessages(msgs, sys)
+	if err != nil {
+		return nil, err
+	}
+	conv.Title = im.Title
+	return conv, nil
+}
+
+var detailsRe = regexp.MustCompile(`(?s)<details>.*?</details>`)
+
+func stripDetails(s string) string {
+	return html.UnescapeString(detailsRe.ReplaceAllString(s, ""))
+}
+
+// unquote extracts the summary text from a "> ..." blockquote.
+func unquote(s string) string {
+	var lines []string
+	for i, line := range strings.Split(s, "\n") {
+		if !strings.HasPrefix(line, ">") {
+			if i > 0 {
+				break
+			}
+			continue
+		}
+		if i == 0 {
+			continue // the "此前对话摘要" label
+		}
+		lines = append(lines, strings.TrimPrefix(strings.TrimPrefix(line, ">"), " "))
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// prepareImport builds the header and entry list for a new imported session,
+// dropping anything that is not a message or compaction entry.
+func prepareImport(agentID string, entries []json.RawMessage) ([]json.RawMessage, error) {
+	var kept []json.RawMessage
+	created := int64(0)
+	for _, e := range entries {
+		if !keepImportEntry(e) {
+			continue
+		}
+		var head struct {
+			Timestamp int64 `json:"timestamp"`
+		}
+		_ = json.Unmarshal(e, &head)
+		if created == 0 || (head.Timestamp > 0 && head.Timestamp < created) {
+			created = head.Timestamp
+		}
+		// Entries from indented exports must fit on one JSONL line.
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, e); err != nil {
+			return nil, err
+		}
+		kept = append(kept, buf.Bytes())
+	}
+	if len(kept) == 0 {
+		return nil, errors.New("nothing to import")
+	}
+	if created == 0 {
+		created = nowMs()
+	}
+	header, err := json.Marshal(SessionHeader{
+		BaseEntry: BaseEntry{Type: EntryTypeSession},
+		Version:   CurrentVersion,
+		AgentID:   agentID,
+		CreatedAt: created,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append([]json.RawMessage{header}, kept...), nil
+}
+
+// importedMeta is summarize plus the defaults an import needs.
+func importedMeta(id, title string, entries []json.RawMessage) SessionIndexEntry {
+	m := summarize(id, entries)
+	if title != "" {
+		m.Title = truncateRune(title, 60)
+	}
+	if m.LastAt == 0 {
+		m.LastAt = m.CreatedAt
+	}
+	return m
+}
+
+// newImportID returns a fresh session ID in the web-chat namespace.
+func newImportID(exists func(string) bool) string {
+	ms := nowMs()
+	for exists(fmt.Sprintf("ses-%d", ms)) {
+		ms++
+	}
+	return fmt.Sprintf("ses-%d", ms)
+}
+
+// Import implements Store.
+func (s *JSONLStore) Import(agentID, title string, entries []json.RawMessage) (string, error) {
+	all, err := prepareImport(agentID, entries)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return "", err
+	}
+	id := newImportID(func(id string) bool {
+		_, err := os.Stat(filepath.Join(s.dir, id+".jsonl"))
+		return err == nil
+	})
+	var buf bytes.Buffer
+	for _, e := range all {
+		buf.Write(e)
+		buf.WriteByte('\n')
+	}
+	path := filepath.Join(s.dir, id+".jsonl")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return "", err
+	}
+	idx, err := s.loadIndex()
+	if err != nil {
+		return "", err
+	}
+	meta := importedMeta(id, title, all)
+	meta.FilePath = id + ".jsonl"
+	idx.Sessions[id] = meta
+	return id, s.saveIndex(idx)
+}
+
+// Import implements Store.
+func (s *SQLiteStore) Import(agentID, title string, entries []json.RawMessage) (string, error) {
+	all, err := prepareImport(agentID, entries)
+	if err != nil {
+		return "", err
+	}
+	id := newImportID(func(id string) bool { _, ok := s.GetMeta(id); return ok })
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	if err := insertSessionRow(tx, id, importedMeta(id, title, all)); err != nil {
+		return "", err
+	}
+	for _, e := range all {
+		if err := s.insertRaw(tx, id, e); err != nil {
+			return "", err
+		}
+	}
+	return id, tx.Commit()
+}
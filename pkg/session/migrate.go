@@ -0,0 +1,127 @@
+package session
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MigrateResult summarises one MigrateJSONL call.
+type MigrateResult struct {
+	Imported int // sessions copied into SQLite
+	Skipped  int // already present in the database
+	Entries  int // total entries copied
+}
+
+// MigrateJSONL imports every JSONL session in dir into dir/sessions.db.
+// Sessions already in the database are skipped, so it is safe to re-run.
+// The JSONL files and sessions.json are left untouched.
+func MigrateJSONL(dir string) (MigrateResult, error) {
+	var res MigrateResult
+	files, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil || len(files) == 0 {
+		return res, err
+	}
+	idx, err := NewJSONLStore(dir).loadIndex()
+	if err != nil {
+		return res, err
+	}
+	dst, ok := NewStore(dir).(*SQLiteStore)
+	if !ok {
+		// NewStore may hand out JSONL stores when the backend is not sqlite.
+		if dst, err = OpenSQLite(dir); err != nil {
+			return res, err
+		}
+		defer dst.Close()
+	}
+
+	for _, f := range files {
+		id := strings.TrimSuffix(filepath.Base(f), ".jsonl")
+		if _, exists := dst.GetMeta(id); exists {
+			res.Skipped++
+			continue
+		}
+		n, err := dst.importJSONL(id, f, idx.Sessions[id])
+		if err != nil {
+			return res, fmt.Errorf("session %s: %w", id, err)
+		}
+		res.Imported++
+		res.Entries += n
+	}
+	return res, nil
+}
+
+// importJSONL copies one session file in a single transaction. Metadata
+// comes from the sessions.json entry when present, else from the entries.
+func (s *SQLiteStore) importJSONL(id, path string, meta SessionIndexEntry) (int, error) {
+	lines, err := NewJSONLStore(filepath.Dir(path)).ReadAll(id)
+	if err != nil {
+		return 0, err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var kept []json.RawMessage
+	for _, line := range lines {
+		if err := s.insertRaw(tx, id, line); err != nil {
+			continue // skip corrupt lines like ReadHistory does
+		}
+		kept = append(kept, line)
+	}
+	if meta.ID == "" {
+		meta = summarize(id, kept)
+		if fi, err := os.Stat(path); err == nil && meta.LastAt == 0 {
+			meta.LastAt = fi.ModTime().UnixMilli()
+		}
+		if meta.CreatedAt == 0 {
+			meta.CreatedAt = meta.LastAt
+		}
+	}
+	if err := insertSessionRow(tx, id, meta); err != nil {
+		return 0, err
+	}
+	return len(lines), tx.Commit()
+}
+
+// summarize derives session metadata from its raw entries.
+func summarize(id string, entries []json.RawMessage) SessionIndexEntry {
+	m := SessionIndexEntry{ID: id}
+	for _, line := range entries {
+		var e struct {
+			Type      EntryType `json:"type"`
+			AgentID   string    `json:"agentId"`
+			CreatedAt int64     `json:"createdAt"`
+			Timestamp int64     `json:"timestamp"`
+			Message   Message   `json:"message"`
+		}
+		if json.Unmarshal(line, &e) != nil {
+			continue
+		}
+		switch e.Type {
+		case EntryTypeSession:
+			m.AgentID, m.CreatedAt = e.AgentID, e.CreatedAt
+		case EntryTypeMessage:
+			m.MessageCount++
+			m.TokenEstimate += estimateTokensRaw(e.Message.Content)
+			if m.Title == "" && e.Message.Role == "user" {
+				m.Title = extractTitle(e.Message.Content)
+			}
+		}
+		if e.Timestamp > m.LastAt {
+			m.LastAt = e.Timestamp
+		}
+	}
+	return m
+}
+
+func insertSessionRow(tx *sql.Tx, id string, m SessionIndexEntry) error {
+	_, err := tx.Exec(`INSERT INTO sessions (`+sessionColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		id, m.AgentID, m.Title, m.CreatedAt, m.LastAt, m.MessageCount, m.TokenEstimate)
+	return err
+}
@@ -0,0 +1,386 @@
+package session
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	_ "modernc.org/sqlite" // pure-Go driver, registers "sqlite"
+)
+
+// errNoSession is returned when appending to a session without a sessions
+// row; the entries would otherwise be invisible to listing and cleanup.
+func errNoSession(id string) error {
+	return fmt.Errorf("session %s not found", id)
+}
+
+// sqliteFile is the database name inside a session directory.
+const sqliteFile = "sessions.db"
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS sessions (
+	id             TEXT PRIMARY KEY,
+	agent_id       TEXT NOT NULL DEFAULT '',
+	title          TEXT NOT NULL DEFAULT '',
+	created_at     INTEGER NOT NULL,
+	last_at        INTEGER NOT NULL,
+	message_count  INTEGER NOT NULL DEFAULT 0,
+	token_estimate INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_last_at ON sessions(last_at);
+CREATE TABLE IF NOT EXISTS entries (
+	seq        INTEGER PRIMARY KEY AUTOINCREMENT,
+	session_id TEXT NOT NULL,
+	type       TEXT NOT NULL,
+	role       TEXT NOT NULL DEFAULT '',
+	ts         INTEGER NOT NULL DEFAULT 0,
+	data       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_entries_session ON entries(session_id, seq);
+CREATE INDEX IF NOT EXISTS idx_entries_session_type ON entries(session_id, type, seq);
+`
+
+// SQLiteStore keeps all sessions of one directory in <dir>/sessions.db.
+// Entries are stored as the same JSON objects the JSONL files contain, so
+// ReadAll output is identical across backends.
+type SQLiteStore struct {
+	dir string
+	db  *sql.DB
+}
+
+// OpenSQLite opens (creating if needed) the session database in dir.
+func OpenSQLite(dir string) (*SQLiteStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	dsn := "file:" + filepath.Join(dir, sqliteFile) + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(wal)&_pragma=synchronous(normal)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// A single connection serialises writers and avoids SQLITE_BUSY between
+	// our own goroutines; reads are fast enough that this is not a bottleneck.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("init schema: %w", err)
+	}
+	return &SQLiteStore{dir: dir, db: db}, nil
+}
+
+// Close releases the database handle.
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// GetOrCreate implements Store.
+func (s *SQLiteStore) GetOrCreate(sessionID, agentID string) (string, bool, error) {
+	if sessionID != "" {
+		if _, ok := s.GetMeta(sessionID); ok {
+			return sessionID, false, nil
+		}
+	} else {
+		sessionID = fmt.Sprintf("ses-%d", nowMs())
+	}
+	now := nowMs()
+	header := SessionHeader{
+		BaseEntry: BaseEntry{Type: EntryTypeSession},
+		Version:   CurrentVersion,
+		AgentID:   agentID,
+		CreatedAt: now,
+	}
+	data, err := json.Marshal(header)
+	if err != nil {
+		return "", false, err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", false, err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`INSERT OR IGNORE INTO sessions (id, agent_id, created_at, last_at) VALUES (?, ?, ?, ?)`,
+		sessionID, agentID, now, now)
+	if err != nil {
+		return "", false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// Created concurrently by another request.
+		return sessionID, false, nil
+	}
+	if _, err := tx.Exec(`INSERT INTO entries (session_id, type, ts, data) VALUES (?, ?, ?, ?)`,
+		sessionID, EntryTypeSession, now, string(data)); err != nil {
+		return "", false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", false, err
+	}
+	return sessionID, true, nil
+}
+
+// AppendMessage implements Store.
+func (s *SQLiteStore) AppendMessage(sessionID, role string, content json.RawMessage) error {
+	return s.AppendMessageWithTools(sessionID, role, content, nil)
+}
+
+// AppendMessageWithTools implements Store. The entry and the session
+// counters are updated in one transaction.
+func (s *SQLiteStore) AppendMessageWithTools(sessionID, role string, content json.RawMessage, toolCalls []ToolCallRecord) error {
+	now := nowMs()
+	entry := MessageEntry{
+		BaseEntry: BaseEntry{Type: EntryTypeMessage},
+		Message:   Message{Role: role, Content: content, ToolCalls: toolCalls},
+		Timestamp: now,
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("marshal entry: %w", err)
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`UPDATE sessions SET message_count = message_count + 1, last_at = ?, token_estimate = token_estimate + ? WHERE id = ?`,
+		now, estimateTokensRaw(content), sessionID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errNoSession(sessionID)
+	}
+	if _, err := tx.Exec(`INSERT INTO entries (session_id, type, role, ts, data) VALUES (?, ?, ?, ?, ?)`,
+		sessionID, EntryTypeMessage, role, now, string(data)); err != nil {
+		return err
+	}
+	if role == "user" {
+		if title := extractTitle(content); title != "" {
+			if _, err := tx.Exec(`UPDATE sessions SET title = ? WHERE id = ? AND title = ''`, title, sessionID); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// Append implements Store. Like a message, any entry counts as activity.
+func (s *SQLiteStore) Append(sessionID string, entry any) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("marshal entry: %w", err)
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`UPDATE sessions SET last_at = ? WHERE id = ?`, nowMs(), sessionID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errNoSession(sessionID)
+	}
+	if err := s.insertRaw(tx, sessionID, data); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// insertRaw stores one JSON entry, indexing its type, role and timestamp.
+func (s *SQLiteStore) insertRaw(ex execer, sessionID string, data []byte) error {
+	var head struct {
+		Type      EntryType `json:"type"`
+		Timestamp int64     `json:"timestamp"`
+		CreatedAt int64     `json:"createdAt"`
+		Message   struct {
+			Role string `json:"role"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return fmt.Errorf("invalid entry: %w", err)
+	}
+	ts := head.Timestamp
+	if ts == 0 {
+		ts = head.CreatedAt
+	}
+	_, err := ex.Exec(`INSERT INTO entries (session_id, type, role, ts, data) VALUES (?, ?, ?, ?, ?)`,
+		sessionID, head.Type, head.Message.Role, ts, string(data))
+	return err
+}
+
+// ReadHistory implements Store. Only rows after the latest compaction are read.
+func (s *SQLiteStore) ReadHistory(sessionID string) ([]Message, string, error) {
+	var summary string
+	var fromSeq int64
+	var data string
+	err := s.db.QueryRow(`SELECT seq, data FROM entries WHERE session_id = ? AND type = ? ORDER BY seq DESC LIMIT 1`,
+		sessionID, EntryTypeCompaction).Scan(&fromSeq, &data)
+	switch {
+	case err == nil:
+		var ce CompactionEntry
+		if json.Unmarshal([]byte(data), &ce) == nil {
+			summary = ce.Summary
+		}
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, "", err
+	}
+
+	rows, err := s.db.Query(`SELECT data FROM entries WHERE session_id = ? AND type = ? AND seq > ? AND role IN ('user', 'assistant') ORDER BY seq`,
+		sessionID, EntryTypeMessage, fromSeq)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+	var messages []Message
+	for rows.Next() {
+		if err := rows.Scan(&data); err != nil {
+			return nil, "", err
+		}
+		var me MessageEntry
+		if json.Unmarshal([]byte(data), &me) == nil {
+			messages = append(messages, me.Message)
+		}
+	}
+	return messages, summary, rows.Err()
+}
+
+// ReadAll implements Store.
+func (s *SQLiteStore) ReadAll(sessionID string) ([]json.RawMessage, error) {
+	rows, err := s.db.Query(`SELECT data FROM entries WHERE session_id = ? ORDER BY seq`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []json.RawMessage
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		entries = append(entries, json.RawMessage(data))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		if _, ok := s.GetMeta(sessionID); !ok {
+			return nil, fmt.Errorf("session %s not found", sessionID)
+		}
+	}
+	return entries, nil
+}
+
+// EstimateTokens implements Store.
+func (s *SQLiteStore) EstimateTokens(sessionID string) int {
+	var n int
+	_ = s.db.QueryRow(`SELECT token_estimate FROM sessions WHERE id = ?`, sessionID).Scan(&n)
+	return n
+}
+
+// SetTokenEstimate implements Store.
+func (s *SQLiteStore) SetTokenEstimate(sessionID string, tokens int) error {
+	_, err := s.db.Exec(`UPDATE sessions SET token_estimate = ? WHERE id = ?`, tokens, sessionID)
+	return err
+}
+
+const sessionColumns = `id, agent_id, title, created_at, last_at, message_count, token_estimate`
+
+func scanSession(row interface{ Scan(...any) error }) (SessionIndexEntry, error) {
+	var e SessionIndexEntry
+	err := row.Scan(&e.ID, &e.AgentID, &e.Title, &e.CreatedAt, &e.LastAt, &e.MessageCount, &e.TokenEstimate)
+	return e, err
+}
+
+// GetMeta implements Store.
+func (s *SQLiteStore) GetMeta(sessionID string) (SessionIndexEntry, bool) {
+	e, err := scanSession(s.db.QueryRow(`SELECT `+sessionColumns+` FROM sessions WHERE id = ?`, sessionID))
+	if err != nil {
+		return SessionIndexEntry{}, false
+	}
+	return e, true
+}
+
+// ListSessions implements Store, most recent first.
+func (s *SQLiteStore) ListSessions() ([]SessionIndexEntry, error) {
+	rows, err := s.db.Query(`SELECT ` + sessionColumns + ` FROM sessions ORDER BY last_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := []SessionIndexEntry{}
+	for rows.Next() {
+		e, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, e)
+	}
+	return result, rows.Err()
+}
+
+// UpdateTitle implements Store.
+func (s *SQLiteStore) UpdateTitle(sessionID, title string) error {
+	res, err := s.db.Exec(`UPDATE sessions SET title = ? WHERE id = ?`, title, sessionID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("session %s not found", sessionID)
+	}
+	return nil
+}
+
+// DeleteSession implements Store.
+func (s *SQLiteStore) DeleteSession(sessionID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM entries WHERE session_id = ?`, sessionID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM sessions WHERE id = ?`, sessionID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// TrimToLastN implements Store. Like the JSONL rewrite, non-message entries
+// (header, compactions) are kept and the surviving messages are moved after
+// them, so they stay visible to ReadHistory.
+func (s *SQLiteStore) TrimToLastN(sessionID string, keepMsgs int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var maxSeq int64
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(seq), 0) FROM entries WHERE session_id = ?`, sessionID).Scan(&maxSeq); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO entries (session_id, type, role, ts, data)
+		SELECT session_id, type, role, ts, data FROM (
+			SELECT * FROM entries WHERE session_id = ? AND type = ? ORDER BY seq DESC LIMIT ?
+		) ORDER BY seq`, sessionID, EntryTypeMessage, keepMsgs); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM entries WHERE session_id = ? AND type = ? AND seq <= ?`,
+		sessionID, EntryTypeMessage, maxSeq); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE sessions SET
+		message_count = (SELECT COUNT(*) FROM entries WHERE session_id = ?1 AND type = ?2),
+		token_estimate = (SELECT COALESCE(SUM(LENGTH(CAST(data AS BLOB))), 0) / 4 FROM entries WHERE session_id = ?1 AND type = ?2)
+		WHERE id = ?1`, sessionID, EntryTypeMessage); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
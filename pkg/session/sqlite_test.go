@@ -0,0 +1,145 @@
+package session
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func text(s string) json.RawMessage {
+	b, _ := json.Marshal(s)
+	return b
+}
+
+// exercise runs the same sequence against any backend and returns the
+// resulting metadata and history.
+func exercise(t *testing.T, s Store) (SessionIndexEntry, []Message, string) {
+	t.Helper()
+	id, created, err := s.GetOrCreate("", "a1")
+	if err != nil || !created {
+		t.Fatalf("GetOrCreate = %q, %v, %v", id, created, err)
+	}
+	if again, created, _ := s.GetOrCreate(id, "a1"); again != id || created {
+		t.Fatalf("existing session recreated")
+	}
+	for i, m := range []string{"hello there", "hi", "second question", "answer"} {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		if err := s.AppendMessage(id, role, text(m)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Append(id, CompactionEntry{BaseEntry: BaseEntry{Type: EntryTypeCompaction}, Summary: "sum"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AppendMessage(id, "user", text("after")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.TrimToLastN(id, 3); err != nil {
+		t.Fatal(err)
+	}
+	msgs, summary, err := s.ReadHistory(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, ok := s.GetMeta(id)
+	if !ok {
+		t.Fatal("GetMeta: not found")
+	}
+	return meta, msgs, summary
+}
+
+func TestSQLiteMatchesJSONL(t *testing.T) {
+	sq, err := OpenSQLite(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sq.Close()
+
+	wantMeta, wantMsgs, wantSummary := exercise(t, NewJSONLStore(t.TempDir()))
+	meta, msgs, summary := exercise(t, sq)
+
+	// Trimming moves the kept messages after the compaction marker.
+	if summary != wantSummary || len(msgs) != len(wantMsgs) || len(msgs) != 3 || string(msgs[2].Content) != `"after"` {
+		t.Fatalf("history = %d msgs, %q; want %d, %q", len(msgs), summary, len(wantMsgs), wantSummary)
+	}
+	if meta.Title != wantMeta.Title || meta.MessageCount != wantMeta.MessageCount || meta.MessageCount != 3 {
+		t.Fatalf("meta = %+v, want %+v", meta, wantMeta)
+	}
+
+	if err := sq.DeleteSession(meta.ID); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := sq.ListSessions(); len(list) != 0 {
+		t.Fatalf("ListSessions after delete = %d", len(list))
+	}
+	if _, err := sq.ReadAll(meta.ID); err == nil {
+		t.Fatal("ReadAll of deleted session should fail")
+	}
+}
+
+func TestMigrateJSONL(t *testing.T) {
+	dir := t.TempDir()
+	js := NewJSONLStore(dir)
+	id, _, _ := js.GetOrCreate("ses-1", "a1")
+	_ = js.AppendMessage(id, "user", text("migrate me"))
+	_ = js.AppendMessage(id, "assistant", text("ok"))
+	want, _ := js.ReadAll(id)
+
+	res, err := MigrateJSONL(dir)
+	if err != nil || res.Imported != 1 || res.Entries != 3 {
+		t.Fatalf("MigrateJSONL = %+v, %v", res, err)
+	}
+	if res, _ := MigrateJSONL(dir); res.Imported != 0 || res.Skipped != 1 {
+		t.Fatalf("second run = %+v, want skip", res)
+	}
+	defer Release(dir)
+
+	sq, err := OpenSQLite(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sq.Close()
+	got, err := sq.ReadAll(id)
+	if err != nil || len(got) != len(want) {
+		t.Fatalf("ReadAll = %d, %v", len(got), err)
+	}
+	for i := range want {
+		if string(got[i]) != string(want[i]) {
+			t.Errorf("entry %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+	meta, ok := sq.GetMeta(id)
+	if !ok || meta.Title != "migrate me" || meta.MessageCount != 2 {
+		t.Fatalf("meta = %+v", meta)
+	}
+}
+
+func TestSQLiteRejectsUnknownSession(t *testing.T) {
+	s, err := OpenSQLite(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.AppendMessage("ghost", "assistant", text("hi")); err == nil {
+		t.Error("AppendMessage to a missing session should fail")
+	}
+	if err := s.Append("ghost", CompactionEntry{BaseEntry: BaseEntry{Type: EntryTypeCompaction}, Summary: "x"}); err == nil {
+		t.Error("Append to a missing session should fail")
+	}
+	var n int
+	_ = s.db.QueryRow(`SELECT COUNT(*) FROM entries WHERE session_id = 'ghost'`).Scan(&n)
+	if n != 0 {
+		t.Errorf("orphan entries = %d", n)
+	}
+
+	id, _, _ := s.GetOrCreate("", "a1")
+	_, _ = s.db.Exec(`UPDATE sessions SET last_at = 1 WHERE id = ?`, id)
+	if err := s.Append(id, CompactionEntry{BaseEntry: BaseEntry{Type: EntryTypeCompaction}, Summary: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := s.GetMeta(id); m.LastAt <= 1 {
+		t.Errorf("Append did not bump last_at: %d", m.LastAt)
+	}
+}
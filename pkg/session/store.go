@@ -1,4 +1,4 @@
-// Store provides append-only JSONL session read/write.
+// JSONLStore provides append-only JSONL session read/write.
 // Reference: pi-coding-agent/dist/core/session-manager.js
 package session
 
@@ -20,20 +20,21 @@ type SessionIndex struct {
 	Sessions map[string]SessionIndexEntry `json:"sessions"`
 }
 
-// Store manages session files for one agent.
-type Store struct {
+// JSONLStore keeps each session in <dir>/<id>.jsonl with a sessions.json index.
+type JSONLStore struct {
 	dir string
 	mu  sync.Mutex
 }
 
-// NewStore creates a Store backed by the given directory.
-func NewStore(dir string) *Store {
-	return &Store{dir: dir}
+// NewJSONLStore creates a JSONLStore backed by the given directory.
+// Prefer NewStore, which shares one instance per directory.
+func NewJSONLStore(dir string) *JSONLStore {
+	return &JSONLStore{dir: dir}
 }
 
 // GetOrCreate returns a session ID, creating a new session if sessionID is empty or not found.
 // Returns the resolved sessionID and whether it was newly created.
-func (s *Store) GetOrCreate(sessionID, agentID string) (string, bool, error) {
+func (s *JSONLStore) GetOrCreate(sessionID, agentID string) (string, bool, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -82,19 +83,19 @@ func (s *Store) GetOrCreate(sessionID, agentID string) (string, bool, error) {
 }
 
 // Create initialises a new session file and returns its path (legacy compat).
-func (s *Store) Create(sessionID, agentID string) (string, error) {
+func (s *JSONLStore) Create(sessionID, agentID string) (string, error) {
 	id, _, err := s.GetOrCreate(sessionID, agentID)
 	return filepath.Join(s.dir, id+".jsonl"), err
 }
 
 // AppendMessage appends a user or assistant message and updates session metadata.
-func (s *Store) AppendMessage(sessionID, role string, content json.RawMessage) error {
+func (s *JSONLStore) AppendMessage(sessionID, role string, content json.RawMessage) error {
 	return s.AppendMessageWithTools(sessionID, role, content, nil)
 }
 
 // AppendMessageWithTools appends a message and optionally attaches display-only tool call metadata.
 // ToolCalls are NOT sent to the LLM — they are stored only for UI timeline reconstruction.
-func (s *Store) AppendMessageWithTools(sessionID, role string, content json.RawMessage, toolCalls []ToolCallRecord) error {
+func (s *JSONLStore) AppendMessageWithTools(sessionID, role string, content json.RawMessage, toolCalls []ToolCallRecord) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -133,7 +134,7 @@ func (s *Store) AppendMessageWithTools(sessionID, role string, content json.RawM
 // Returns messages in chronological order, suitable for LLM context.
 // If a compaction entry is found, the summary is returned as a synthetic "system" entry
 // and only messages after the compaction boundary are included.
-func (s *Store) ReadHistory(sessionID string) ([]Message, string, error) {
+func (s *JSONLStore) ReadHistory(sessionID string) ([]Message, string, error) {
 	path := filepath.Join(s.dir, sessionID+".jsonl")
 	f, err := os.Open(path)
 	if err != nil {
@@ -183,7 +184,7 @@ func (s *Store) ReadHistory(sessionID string) ([]Message, string, error) {
 }
 
 // EstimateTokens returns a rough token estimate for a session (from the index).
-func (s *Store) EstimateTokens(sessionID string) int {
+func (s *JSONLStore) EstimateTokens(sessionID string) int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	idx, err := s.loadIndex()
@@ -193,8 +194,25 @@ func (s *Store) EstimateTokens(sessionID string) int {
 	return idx.Sessions[sessionID].TokenEstimate
 }
 
+// SetTokenEstimate overwrites the token estimate, e.g. after compaction.
+func (s *JSONLStore) SetTokenEstimate(sessionID string, tokens int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idx, err := s.loadIndex()
+	if err != nil {
+		return err
+	}
+	meta, ok := idx.Sessions[sessionID]
+	if !ok {
+		return nil
+	}
+	meta.TokenEstimate = tokens
+	idx.Sessions[sessionID] = meta
+	return s.saveIndex(idx)
+}
+
 // GetMeta returns the index entry for a session.
-func (s *Store) GetMeta(sessionID string) (SessionIndexEntry, bool) {
+func (s *JSONLStore) GetMeta(sessionID string) (SessionIndexEntry, bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	idx, err := s.loadIndex()
@@ -206,7 +224,7 @@ func (s *Store) GetMeta(sessionID string) (SessionIndexEntry, bool) {
 }
 
 // Append adds a raw entry to an existing session file (legacy compat).
-func (s *Store) Append(sessionID string, entry any) error {
+func (s *JSONLStore) Append(sessionID string, entry any) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	path := filepath.Join(s.dir, sessionID+".jsonl")
@@ -214,7 +232,7 @@ func (s *Store) Append(sessionID string, entry any) error {
 }
 
 // ReadAll parses all raw JSON lines from a session file.
-func (s *Store) ReadAll(sessionID string) ([]json.RawMessage, error) {
+func (s *JSONLStore) ReadAll(sessionID string) ([]json.RawMessage, error) {
 	path := filepath.Join(s.dir, sessionID+".jsonl")
 	f, err := os.Open(path)
 	if err != nil {
@@ -236,7 +254,7 @@ func (s *Store) ReadAll(sessionID string) ([]json.RawMessage, error) {
 }
 
 // DeleteSession removes a session file and its index entry.
-func (s *Store) DeleteSession(sessionID string) error {
+func (s *JSONLStore) DeleteSession(sessionID string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -256,7 +274,7 @@ func (s *Store) DeleteSession(sessionID string) error {
 }
 
 // UpdateTitle updates the title of a session in the index.
-func (s *Store) UpdateTitle(sessionID, title string) error {
+func (s *JSONLStore) UpdateTitle(sessionID, title string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -274,7 +292,7 @@ func (s *Store) UpdateTitle(sessionID, title string) error {
 }
 
 // ListSessions returns all session entries from the index file.
-func (s *Store) ListSessions() ([]SessionIndexEntry, error) {
+func (s *JSONLStore) ListSessions() ([]SessionIndexEntry, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	idx, err := s.loadIndex()
@@ -289,7 +307,7 @@ func (s *Store) ListSessions() ([]SessionIndexEntry, error) {
 }
 
 // updateIndex adds or updates a session entry in sessions.json (internal, no lock).
-func (s *Store) updateIndex(sessionID, agentID, filePath string) error {
+func (s *JSONLStore) updateIndex(sessionID, agentID, filePath string) error {
 	idx, err := s.loadIndex()
 	if err != nil {
 		return err
@@ -305,7 +323,7 @@ func (s *Store) updateIndex(sessionID, agentID, filePath string) error {
 }
 
 // loadIndex reads sessions.json or returns an empty index.
-func (s *Store) loadIndex() (*SessionIndex, error) {
+func (s *JSONLStore) loadIndex() (*SessionIndex, error) {
 	indexPath := filepath.Join(s.dir, "sessions.json")
 	data, err := os.ReadFile(indexPath)
 	if err != nil {
@@ -325,7 +343,7 @@ func (s *Store) loadIndex() (*SessionIndex, error) {
 }
 
 // saveIndex writes sessions.json to disk.
-func (s *Store) saveIndex(idx *SessionIndex) error {
+func (s *JSONLStore) saveIndex(idx *SessionIndex) error {
 	data, err := json.MarshalIndent(idx, "", "  ")
 	if err != nil {
 		return err
@@ -384,7 +402,7 @@ func truncateRune(s string, maxRunes int) string {
 // TrimToLastN rewrites the session JSONL keeping only the last keepMsgs messages.
 // keepMsgs = keepTurns * 2 (each turn = 1 user + 1 assistant message).
 // Non-message entries (session header, compaction) are preserved.
-func (s *Store) TrimToLastN(sessionID string, keepMsgs int) error {
+func (s *JSONLStore) TrimToLastN(sessionID string, keepMsgs int) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
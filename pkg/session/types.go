@@ -1,4 +1,4 @@
-// Package session handles JSONL-based session storage.
+// Package session handles session storage (JSONL files or embedded SQLite).
 // Reference: pi-coding-agent/dist/core/session-manager.js
 // Session format is compatible with OpenClaw/pi-coding-agent v3.
 package session
@@ -36,6 +36,10 @@ type MessageEntry struct {
 	BaseEntry
 	Message   Message `json:"message"`
 	Timestamp int64   `json:"timestamp"`
+	// Carried marks a copy re-appended after a compaction entry so the kept
+	// turns stay in the LLM context. Display and export skip it; the
+	// original appears before the compaction.
+	Carried bool `json:"carried,omitempty"`
 }
 
 // ToolCallRecord persists tool call display metadata alongside a message.
@@ -77,9 +81,14 @@ type CompactionEntry struct {
 	TokensBefore     int    `json:"tokensBefore,omitempty"`
 	TokensAfter      int    `json:"tokensAfter,omitempty"`
 	Timestamp        int64  `json:"timestamp"`
+	Reason           string `json:"reason,omitempty"`     // "auto" | "manual"
+	Model            string `json:"model,omitempty"`      // model that wrote the summary
+	Summarized       int    `json:"summarized,omitempty"` // messages folded into the summary
+	Kept             int    `json:"kept,omitempty"`       // recent messages carried over verbatim
+	Pinned           int    `json:"pinned,omitempty"`     // older messages copied into the summary verbatim
 }
 
-// SessionIndexEntry is one entry in the sessions.json index.
+// SessionIndexEntry is the per-session metadata (sessions.json index or sessions table).
 // Stored in sessions.json — lightweight metadata, no message bodies.
 type SessionIndexEntry struct {
 	ID            string `json:"id"`
@@ -13,6 +13,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -46,15 +49,22 @@ type SessionWorker struct {
 	stopCh    chan struct{}
 	busy      atomic.Bool
 
+	cancelMu sync.Mutex
+	cancel   context.CancelFunc // cancels the running request; nil when idle
+
 	pool *WorkerPool // back-reference for self-removal
 }
 
 const workerIdleTimeout = 30 * time.Minute
 
 func newSessionWorker(sessionID string, pool *WorkerPool) *SessionWorker {
+	bc := NewBroadcaster()
+	if path := pool.eventPath(sessionID); path != "" {
+		bc = NewPersistentBroadcaster(path)
+	}
 	w := &SessionWorker{
 		sessionID:   sessionID,
-		Broadcaster: NewBroadcaster(),
+		Broadcaster: bc,
 		inputChan:   make(chan RunRequest, 8),
 		stopCh:      make(chan struct{}),
 		pool:        pool,
@@ -80,6 +90,18 @@ func (w *SessionWorker) IsBusy() bool {
 	return w.busy.Load()
 }
 
+// Cancel aborts the request being processed. It reports whether a run was
+// in progress; the runner then ends the generation with an error event.
+func (w *SessionWorker) Cancel() bool {
+	w.cancelMu.Lock()
+	defer w.cancelMu.Unlock()
+	if w.cancel == nil {
+		return false
+	}
+	w.cancel()
+	return true
+}
+
 // Stop shuts down the worker goroutine (idempotent).
 func (w *SessionWorker) Stop() {
 	w.stopOnce.Do(func() {
@@ -87,6 +109,7 @@ func (w *SessionWorker) Stop() {
 		if w.pool != nil {
 			w.pool.remove(w.sessionID)
 		}
+		w.Broadcaster.Close()
 	})
 }
 
@@ -110,11 +133,26 @@ func (w *SessionWorker) process(req RunRequest) {
 	w.busy.Store(true)
 	defer w.busy.Store(false)
 
-	// Signal start of a new generation (clears replay buffer)
+	// Signal start of a new generation (no-op if the handler already did)
 	w.Broadcaster.StartGen()
 
 	// Use background context — runner is NOT tied to any HTTP request lifecycle.
-	ctx := context.Background()
+	// It can only be aborted explicitly via Cancel.
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancelMu.Lock()
+	w.cancel = cancel
+	w.cancelMu.Unlock()
+	defer func() {
+		w.cancelMu.Lock()
+		w.cancel = nil
+		w.cancelMu.Unlock()
+		cancel()
+	}()
+
+	if fn := w.pool.runHook(); fn != nil {
+		fn(req.AgentID, w.sessionID, true)
+		defer fn(req.AgentID, w.sessionID, false)
+	}
 
 	if err := req.RunFn(ctx, req.SessionID, req.Message, w.Broadcaster); err != nil {
 		log.Printf("[worker %s] run error: %v", w.sessionID, err)
@@ -130,8 +168,77 @@ func (w *SessionWorker) process(req RunRequest) {
 // WorkerPool manages a pool of SessionWorkers, one per session.
 // Workers are created lazily and removed after idle timeout.
 type WorkerPool struct {
-	mu      sync.Mutex
-	workers map[string]*SessionWorker
+	mu       sync.Mutex
+	workers  map[string]*SessionWorker
+	eventDir string                                        // persisted broadcaster events; empty = memory only
+	onRun    func(agentID, sessionID string, running bool) // optional; see SetOnRun
+}
+
+// eventFileMaxAge is how long event files of idle sessions are kept for
+// Last-Event-ID resume.
+const eventFileMaxAge = 24 * time.Hour
+
+// SetEventDir persists each session's last two generations of events under
+// dir, so clients can resume after the worker or the server restarted.
+// Call before the first GetOrCreate. Stale event files are removed.
+func (p *WorkerPool) SetEventDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.eventDir = dir
+	p.mu.Unlock()
+	files, _ := filepath.Glob(filepath.Join(dir, "*.events.jsonl"))
+	for _, f := range files {
+		if fi, err := os.Stat(f); err == nil && time.Since(fi.ModTime()) > eventFileMaxAge {
+			_ = os.Remove(f)
+		}
+	}
+	return nil
+}
+
+// SetOnRun registers a callback invoked when a worker starts (running=true)
+// and finishes processing a request.
+func (p *WorkerPool) SetOnRun(fn func(agentID, sessionID string, running bool)) {
+	p.mu.Lock()
+	p.onRun = fn
+	p.mu.Unlock()
+}
+
+func (p *WorkerPool) runHook() func(agentID, sessionID string, running bool) {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.onRun
+}
+
+func (p *WorkerPool) eventPath(sessionID string) string {
+	if p == nil || p.eventDir == "" {
+		return ""
+	}
+	safe := strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(sessionID)
+	return filepath.Join(p.eventDir, safe+".events.jsonl")
+}
+
+// Replay returns persisted events with an ID greater than after for a
+// session that has no live worker (nil when nothing is stored).
+func (p *WorkerPool) Replay(sessionID string, after uint64) []BroadcastEvent {
+	p.mu.Lock()
+	path := p.eventPath(sessionID)
+	p.mu.Unlock()
+	if path == "" {
+		return nil
+	}
+	events, _ := ReadEventFile(path)
+	var out []BroadcastEvent
+	for _, ev := range events {
+		if ev.ID > after {
+			out = append(out, ev)
+		}
+	}
+	return out
 }
 
 // NewWorkerPool creates an empty WorkerPool.
@@ -36,6 +36,7 @@ type Manager struct {
 	cancels  map[string]context.CancelFunc
 	run      RunFunc
 	notify   NotifyFunc // optional
+	onChange func(Task) // optional; called on every status change
 	storeDir string     // for persistence (optional)
 }
 
@@ -61,6 +62,12 @@ func (m *Manager) SetNotify(fn NotifyFunc) {
 	m.notify = fn
 }
 
+// SetOnChange registers a callback that receives a copy of a task whenever
+// its status changes (spawned, started, finished, killed).
+func (m *Manager) SetOnChange(fn func(Task)) {
+	m.onChange = fn
+}
+
 // Spawn creates and starts a new background task. Returns the task immediately.
 func (m *Manager) Spawn(opts SpawnOpts) (*Task, error) {
 	if opts.AgentID == "" {
@@ -223,15 +230,47 @@ func (m *Manager) runTask(ctx context.Context, task *Task) {
 	}
 }
 
+// Prune forgets finished tasks that ended before the cutoff and deletes
+// their files. With dryRun nothing is removed. Returns tasks and bytes dropped.
+func (m *Manager) Prune(before time.Time, dryRun bool) (int, int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cutoff := before.UnixMilli()
+	n, freed := 0, int64(0)
+	for id, t := range m.tasks {
+		if t.Status == TaskRunning || t.Status == TaskPending || t.EndedAt == 0 || t.EndedAt >= cutoff {
+			continue
+		}
+		n++
+		if m.storeDir != "" {
+			path := filepath.Join(m.storeDir, id+".json")
+			if fi, err := os.Stat(path); err == nil {
+				freed += fi.Size()
+			}
+			if !dryRun {
+				_ = os.Remove(path)
+			}
+		}
+		if !dryRun {
+			delete(m.tasks, id)
+		}
+	}
+	return n, freed
+}
+
 // ── Persistence ────────────────────────────────────────────────────────────────
 
 func (m *Manager) persist(task *Task) {
+	m.mu.RLock()
+	cp := *task
+	m.mu.RUnlock()
+	if m.onChange != nil {
+		m.onChange(cp)
+	}
 	if m.storeDir == "" {
 		return
 	}
-	m.mu.RLock()
-	data, err := json.Marshal(task)
-	m.mu.RUnlock()
+	data, err := json.Marshal(cp)
 	if err != nil {
 		return
 	}
@@ -0,0 +1,358 @@
+// Package teammem is the team-shared memory space: one memory tree that every
+// agent may read and contribute to, subject to a per-agent access policy.
+// Agent contributions are proposals; with review enabled they stay invisible
+// until an approver agent or a human accepts them.
+//
+// Layout (root is usually "team-memory"):
+//
+//	memory/            the shared tree (INDEX.md, core/, topics/, ...)
+//	policy.json        Policy
+//	proposals.json     all proposals, newest last
+//
+// The tree is an ordinary memory.MemoryTree rooted at root, so writes are
+// versioned and indexed for search exactly like an agent's own memory.
+package teammem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sunhuihui6688-star/ai-panel/pkg/memory"
+)
+
+// NoAgents is the grant list entry that denies a permission to every agent
+// (an empty list allows all), as with project.Project.Editors.
+const NoAgents = "__none__"
+
+// Proposal statuses.
+const (
+	StatusPending  = "pending"
+	StatusApplied  = "applied" // visible in the tree
+	StatusRejected = "rejected"
+)
+
+// ErrNotFound is returned for unknown proposals.
+var ErrNotFound = errors.New("proposal not found")
+
+// Policy controls which agents may read, write and approve.
+type Policy struct {
+	// Readers: agent IDs that can read and search. Empty = all agents.
+	Readers []string `json:"readers,omitempty"`
+	// Writers: agent IDs that can propose entries. Empty = all agents;
+	// ["__none__"] = read-only for every agent.
+	Writers []string `json:"writers,omitempty"`
+	// Approvers: agent IDs that can approve or reject proposals. Humans can
+	// always review from the panel. Their own proposals apply directly.
+	Approvers []string `json:"approvers,omitempty"`
+	// Review: agent proposals wait for approval before becoming visible.
+	Review bool `json:"review"`
+}
+
+func granted(list []string, agentID string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, id := range list {
+		if id == agentID {
+			return true
+		}
+	}
+	return false
+}
+
+// CanRead reports whether agentID may read and search the team memory.
+func (p Policy) CanRead(agentID string) bool { return granted(p.Readers, agentID) }
+
+// CanWrite reports whether agentID may propose entries.
+func (p Policy) CanWrite(agentID string) bool {
+	return p.CanRead(agentID) && granted(p.Writers, agentID)
+}
+
+// CanApprove reports whether agentID may review proposals.
+func (p Policy) CanApprove(agentID string) bool {
+	for _, id := range p.Approvers {
+		if id == agentID {
+			return true
+		}
+	}
+	return false
+}
+
+// Proposal is a suggested change to one team memory file.
+type Proposal struct {
+	ID         string `json:"id"`
+	Path       string `json:"path"` // relative to memory/
+	Mode       string `json:"mode"` // "append" | "replace"
+	Content    string `json:"content"`
+	Reason     string `json:"reason,omitempty"`
+	AgentID    string `json:"agentId"` // proposer
+	Status     string `json:"status"`
+	CreatedAt  int64  `json:"createdAt"`            // unix ms
+	ReviewedBy string `json:"reviewedBy,omitempty"` // agent ID or "user"
+	ReviewedAt int64  `json:"reviewedAt,omitempty"`
+	ReviewNote string `json:"reviewNote,omitempty"`
+}
+
+// Store is the team memory space.
+type Store struct {
+	root      string
+	mu        sync.Mutex
+	onPropose func(Proposal) // optional; called for proposals that wait for review
+}
+
+// Open prepares the team memory under root, creating memory/INDEX.md on
+// first use.
+func Open(root string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Join(root, "memory"), 0755); err != nil {
+		return nil, err
+	}
+	index := filepath.Join(root, "memory", "INDEX.md")
+	if _, err := os.Stat(index); os.IsNotExist(err) {
+		content := "# 团队记忆索引\n\n(全体成员共享的知识：价格、流程、约定、客户信息等。此文件会注入每个成员的对话。)\n"
+		if err := os.WriteFile(index, []byte(content), 0644); err != nil {
+			return nil, err
+		}
+	}
+	return &Store{root: root}, nil
+}
+
+// Root returns the directory that holds memory/.
+func (s *Store) Root() string { return s.root }
+
+// SetOnPropose registers a callback for new proposals awaiting review.
+func (s *Store) SetOnPropose(fn func(Proposal)) {
+	s.mu.Lock()
+	s.onPropose = fn
+	s.mu.Unlock()
+}
+
+// Tree returns the shared tree; writes are attributed to by.
+func (s *Store) Tree(by memory.Author) *memory.MemoryTree {
+	return memory.NewMemoryTree(s.root).As(by)
+}
+
+// Policy returns the access policy (default: open, no review).
+func (s *Store) Policy() Policy {
+	var p Policy
+	data, err := os.ReadFile(filepath.Join(s.root, "policy.json"))
+	if err == nil {
+		_ = json.Unmarshal(data, &p)
+	}
+	return p
+}
+
+// SetPolicy persists the access policy.
+func (s *Store) SetPolicy(p Policy) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.root, "policy.json"), data, 0644)
+}
+
+// Search runs a memory search over the team tree.
+func (s *Store) Search(ctx context.Context, query string, limit int) ([]memory.SearchHit, error) {
+	return memory.OpenIndex(s.root).Search(ctx, query, limit)
+}
+
+// CleanPath validates a path relative to memory/ (markdown or text only).
+func CleanPath(rel string) (string, error) {
+	rel = filepath.ToSlash(filepath.Clean(strings.TrimPrefix(strings.TrimSpace(rel), "/")))
+	rel = strings.TrimPrefix(rel, "memory/")
+	if rel == "." || rel == "" || strings.HasPrefix(rel, "..") || strings.HasPrefix(rel, ".") {
+		return "", fmt.Errorf("invalid path %q", rel)
+	}
+	if ext := filepath.Ext(rel); ext != ".md" && ext != ".txt" {
+		return "", fmt.Errorf("team memory files must be .md or .txt")
+	}
+	return rel, nil
+}
+
+// Delete removes one file from the tree (versioned and dropped from the
+// search index). INDEX.md cannot be deleted.
+func (s *Store) Delete(rel string, by memory.Author) error {
+	rel, err := CleanPath(rel)
+	if err != nil {
+		return err
+	}
+	if rel == "INDEX.md" {
+		return fmt.Errorf("INDEX.md cannot be deleted")
+	}
+	abs := filepath.Join(s.root, "memory", filepath.FromSlash(rel))
+	if _, err := os.Stat(abs); err != nil {
+		return err
+	}
+	err = memory.Track(s.root, "memory/"+rel, by, func() error { return os.Remove(abs) })
+	if err != nil {
+		return err
+	}
+	memory.OpenIndex(s.root).UpdateFile(rel)
+	return nil
+}
+
+// Propose records a change from agentID. Without review, or when the
+// proposer is an approver, it is applied at once; otherwise it stays pending.
+func (s *Store) Propose(agentID, rel, mode, content, reason string) (*Proposal, error) {
+	pol := s.Policy()
+	if !pol.CanWrite(agentID) {
+		return nil, fmt.Errorf("agent %s has no write access to team memory", agentID)
+	}
+	rel, err := CleanPath(rel)
+	if err != nil {
+		return nil, err
+	}
+	if mode == "" {
+		mode = "append"
+	}
+	if mode != "append" && mode != "replace" {
+		return nil, fmt.Errorf("mode must be append or replace")
+	}
+	if strings.TrimSpace(content) == "" {
+		return nil, fmt.Errorf("content required")
+	}
+	now := time.Now().UnixMilli()
+	p := Proposal{
+		ID: fmt.Sprintf("p%d", now), Path: rel, Mode: mode, Content: content,
+		Reason: strings.TrimSpace(reason), AgentID: agentID, Status: StatusPending, CreatedAt: now,
+	}
+
+	s.mu.Lock()
+	list, err := s.load()
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	for _, q := range list {
+		if q.ID == p.ID {
+			p.ID = fmt.Sprintf("p%d-%d", now, len(list))
+		}
+	}
+	if !pol.Review || pol.CanApprove(agentID) {
+		if err := s.apply(p, agentID); err != nil {
+			s.mu.Unlock()
+			return nil, err
+		}
+		p.Status = StatusApplied
+		p.ReviewedAt = now
+		if pol.Review {
+			p.ReviewedBy = agentID
+		}
+	}
+	list = append(list, p)
+	err = s.save(list)
+	onPropose := s.onPropose
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if p.Status == StatusPending && onPropose != nil {
+		onPropose(p)
+	}
+	return &p, nil
+}
+
+// Review approves (applying the change) or rejects a pending proposal.
+// reviewer is an approver agent ID, or "user" for a human.
+func (s *Store) Review(id, reviewer string, approve bool, note string) (*Proposal, error) {
+	if reviewer != "user" {
+		if !s.Policy().CanApprove(reviewer) {
+			return nil, fmt.Errorf("agent %s is not a team memory approver", reviewer)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		p := &list[i]
+		if p.ID != id {
+			continue
+		}
+		if p.Status != StatusPending {
+			return nil, fmt.Errorf("proposal %s is already %s", id, p.Status)
+		}
+		if reviewer == p.AgentID {
+			return nil, fmt.Errorf("proposals cannot be reviewed by their author")
+		}
+		if approve {
+			if err := s.apply(*p, p.AgentID+" (approved by "+reviewer+")"); err != nil {
+				return nil, err
+			}
+			p.Status = StatusApplied
+		} else {
+			p.Status = StatusRejected
+		}
+		p.ReviewedBy = reviewer
+		p.ReviewedAt = time.Now().UnixMilli()
+		p.ReviewNote = strings.TrimSpace(note)
+		if err := s.save(list); err != nil {
+			return nil, err
+		}
+		out := *p
+		return &out, nil
+	}
+	return nil, ErrNotFound
+}
+
+// Proposals returns proposals newest first, optionally of one status.
+func (s *Store) Proposals(status string) ([]Proposal, error) {
+	s.mu.Lock()
+	list, err := s.load()
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Proposal, 0, len(list))
+	for i := len(list) - 1; i >= 0; i-- {
+		if status == "" || list[i].Status == status {
+			out = append(out, list[i])
+		}
+	}
+	return out, nil
+}
+
+// apply writes a proposal into the tree; callers hold s.mu.
+func (s *Store) apply(p Proposal, detail string) error {
+	tree := s.Tree(memory.Author{Source: memory.SourceAgent, Detail: detail})
+	if p.Mode == "replace" {
+		return tree.WriteFile(p.Path, p.Content)
+	}
+	return tree.AppendToFile(p.Path, p.Content)
+}
+
+func (s *Store) load() ([]Proposal, error) {
+	data, err := os.ReadFile(filepath.Join(s.root, "proposals.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []Proposal
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *Store) save(list []Proposal) error {
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.root, "proposals.json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,85 @@
+package teammem
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sunhuihui6688-star/ai-panel/pkg/memory"
+)
+
+func TestPolicyGrants(t *testing.T) {
+	p := Policy{Writers: []string{NoAgents}}
+	if !p.CanRead("a") || p.CanWrite("a") || p.CanApprove("a") {
+		t.Fatalf("read-only policy: %+v", p)
+	}
+	p = Policy{Readers: []string{"a", "b"}, Writers: []string{"a", "c"}, Approvers: []string{"b"}}
+	if p.CanRead("c") || p.CanWrite("c") {
+		t.Fatal("c writes without read access")
+	}
+	if !p.CanWrite("a") || p.CanWrite("b") || !p.CanApprove("b") {
+		t.Fatalf("grants: %+v", p)
+	}
+}
+
+func TestReviewFlow(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := s.Tree(memory.Author{})
+
+	// No review: applied at once.
+	p, err := s.Propose("a", "topics/pricing.md", "", "基础版 99 元/月", "")
+	if err != nil || p.Status != StatusApplied {
+		t.Fatalf("propose = %+v, %v", p, err)
+	}
+	if got, _ := tree.GetFile("topics/pricing.md"); !strings.Contains(got, "99 元") {
+		t.Fatalf("not applied: %q", got)
+	}
+
+	if err := s.SetPolicy(Policy{Approvers: []string{"boss"}, Review: true}); err != nil {
+		t.Fatal(err)
+	}
+	var notified []string
+	s.SetOnPropose(func(p Proposal) { notified = append(notified, p.ID) })
+
+	p, err = s.Propose("a", "memory/topics/pricing.md", "replace", "基础版 129 元/月", "涨价通知")
+	if err != nil || p.Status != StatusPending || len(notified) != 1 {
+		t.Fatalf("propose = %+v, %v, notified %v", p, err, notified)
+	}
+	if got, _ := tree.GetFile("topics/pricing.md"); strings.Contains(got, "129") {
+		t.Fatal("pending proposal is visible")
+	}
+	if _, err := s.Review(p.ID, "a", true, ""); err == nil {
+		t.Fatal("non-approver reviewed")
+	}
+	p, err = s.Review(p.ID, "boss", true, "确认")
+	if err != nil || p.Status != StatusApplied || p.ReviewedBy != "boss" {
+		t.Fatalf("review = %+v, %v", p, err)
+	}
+	if got, _ := tree.GetFile("topics/pricing.md"); strings.TrimSpace(got) != "基础版 129 元/月" {
+		t.Fatalf("after approve: %q", got)
+	}
+
+	// Approver's own proposals skip the queue; others can be rejected.
+	if p, _ := s.Propose("boss", "topics/rules.md", "", "周末不发货", ""); p.Status != StatusApplied {
+		t.Fatalf("approver proposal = %+v", p)
+	}
+	p, _ = s.Propose("a", "topics/rules.md", "", "随便写的", "")
+	if p, err = s.Review(p.ID, "user", false, "不准确"); err != nil || p.Status != StatusRejected {
+		t.Fatalf("reject = %+v, %v", p, err)
+	}
+	if got, _ := tree.GetFile("topics/rules.md"); strings.Contains(got, "随便") {
+		t.Fatal("rejected proposal applied")
+	}
+	if pending, _ := s.Proposals(StatusPending); len(pending) != 0 {
+		t.Fatalf("pending = %+v", pending)
+	}
+
+	if _, err := s.Propose("a", "../escape.md", "", "x", ""); err == nil {
+		t.Fatal("path escape accepted")
+	}
+	if err := s.Delete("INDEX.md", memory.Author{}); err == nil {
+		t.Fatal("INDEX.md deleted")
+	}
+}
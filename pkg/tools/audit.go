@@ -0,0 +1,88 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/sunhuihui6688-star/ai-panel/pkg/audit"
+)
+
+// WithAudit records every tool invocation to the given audit log.
+func (r *Registry) WithAudit(l *audit.Logger) {
+	r.auditLog = l
+}
+
+// recordAudit appends one tool call to the audit log (no-op without a logger).
+func (r *Registry) recordAudit(ctx context.Context, name string, input json.RawMessage, start time.Time, out string, err error) {
+	if r.auditLog == nil {
+		return
+	}
+	meta := audit.MetaFrom(ctx)
+	e := audit.Entry{
+		Timestamp:   start,
+		AgentID:     r.agentID,
+		SessionID:   meta.SessionID,
+		Channel:     meta.Channel,
+		Source:      meta.Source,
+		Tool:        name,
+		Input:       input,
+		OutputBytes: len(out),
+		DurationMs:  time.Since(start).Milliseconds(),
+		Status:      "ok",
+		Paths:       touchedPaths(name, input),
+	}
+	if e.SessionID == "" {
+		e.SessionID = r.sessionID
+	}
+	if !json.Valid(input) {
+		e.Input, _ = json.Marshal(string(input))
+	}
+	if err != nil {
+		e.Status = "error"
+		e.Error = err.Error()
+	}
+	if werr := r.auditLog.Append(e); werr != nil {
+		log.Printf("[audit] append failed: %v", werr)
+	}
+}
+
+// touchedPaths extracts the files a file tool reads or writes.
+func touchedPaths(name string, input json.RawMessage) []string {
+	var m struct {
+		FilePath  string `json:"file_path"`
+		Path      string `json:"path"`
+		ProjectID string `json:"project_id"`
+		Patch     string `json:"patch"`
+	}
+	if json.Unmarshal(input, &m) != nil {
+		return nil
+	}
+	prefix := ""
+	if m.ProjectID != "" {
+		prefix = "project:" + m.ProjectID + "/"
+	}
+	var paths []string
+	switch name {
+	case "apply_patch":
+		ops, err := parsePatch(m.Patch)
+		if err != nil {
+			return nil
+		}
+		for _, op := range ops {
+			paths = append(paths, prefix+op.path)
+			if op.moveTo != "" {
+				paths = append(paths, prefix+op.moveTo)
+			}
+		}
+	default:
+		if m.FilePath != "" {
+			paths = append(paths, prefix+m.FilePath)
+		}
+		if m.Path != "" {
+			paths = append(paths, prefix+m.Path)
+		}
+	}
+	return paths
+}
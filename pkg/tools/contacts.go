@@ -0,0 +1,188 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/sunhuihui6688-star/ai-panel/pkg/contact"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/llm"
+)
+
+// WithContacts registers contact_get / contact_update backed by the agent's
+// contact store. Without an id they act on the sender of the current message.
+func (r *Registry) WithContacts(mgr *contact.Manager) {
+	r.withContacts(mgr, false)
+}
+
+// WithSenderContacts is WithContacts for public channels: both tools only
+// see and edit the sender of the current message, never other contacts.
+func (r *Registry) WithSenderContacts(mgr *contact.Manager) {
+	r.withContacts(mgr, true)
+}
+
+func (r *Registry) withContacts(mgr *contact.Manager, senderOnly bool) {
+	if mgr == nil || r.agentID == "" {
+		return
+	}
+	store, err := mgr.Get(r.agentID)
+	if err != nil {
+		log.Printf("[tools] contacts for agent %s unavailable: %v", r.agentID, err)
+		return
+	}
+	r.contacts = store
+	r.senderOnly = senderOnly
+
+	if senderOnly {
+		r.register(llm.ToolDef{
+			Name:        "contact_get",
+			Description: "查看当前对话对象的联系人档案（资料、偏好、备注、互动记录）。",
+			InputSchema: json.RawMessage(`{"type":"object","properties":{}}`),
+		}, r.handleContactGet)
+		r.register(llm.ToolDef{
+			Name: "contact_update",
+			Description: "更新当前对话对象的联系人档案，只需传入要改的字段。profile 记录事实，preferences 记录沟通偏好；" +
+				"字段值传空字符串表示删除该项。note 追加一条备注。",
+			InputSchema: json.RawMessage(`{
+				"type":"object",
+				"properties":{
+					"name":{"type":"string","description":"姓名或称呼"},
+					"profile":{"type":"object","additionalProperties":{"type":"string"}},
+					"preferences":{"type":"object","additionalProperties":{"type":"string"}},
+					"note":{"type":"string","description":"追加的备注"}
+				}
+			}`),
+		}, r.handleContactUpdate)
+		return
+	}
+
+	r.register(llm.ToolDef{
+		Name: "contact_get",
+		Description: "查看联系人档案（资料、偏好、备注、关联身份、互动记录）。" +
+			"不传参数时返回当前对话对象；传 query 按姓名、用户名、资料或备注搜索联系人。",
+		InputSchema: json.RawMessage(`{
+			"type":"object",
+			"properties":{
+				"id":{"type":"string","description":"联系人 ID（可选）"},
+				"query":{"type":"string","description":"搜索关键词（可选）"}
+			}
+		}`),
+	}, r.handleContactGet)
+
+	r.register(llm.ToolDef{
+		Name: "contact_update",
+		Description: "更新联系人档案，只需传入要改的字段。profile 记录事实（如 职业、城市），preferences 记录沟通偏好（如 称呼、语言、回复风格）；" +
+			"字段值传空字符串表示删除该项。note 追加一条备注。不传 id 时更新当前对话对象。",
+		InputSchema: json.RawMessage(`{
+			"type":"object",
+			"properties":{
+				"id":{"type":"string","description":"联系人 ID（默认当前对话对象）"},
+				"name":{"type":"string","description":"姓名或称呼"},
+				"profile":{"type":"object","additionalProperties":{"type":"string"},"description":"资料，如 {\"职业\":\"产品经理\"}"},
+				"preferences":{"type":"object","additionalProperties":{"type":"string"},"description":"偏好，如 {\"回复风格\":\"简洁\"}"},
+				"note":{"type":"string","description":"追加的备注"}
+			}
+		}`),
+	}, r.handleContactUpdate)
+}
+
+// currentContactID resolves the contact of the message sender in ctx.
+func (r *Registry) currentContactID(ctx context.Context) (string, error) {
+	s, ok := contact.SenderFrom(ctx)
+	if !ok {
+		return "", fmt.Errorf("当前对话没有关联的联系人，请指定 id（可先用 contact_get 的 query 搜索）")
+	}
+	c, err := r.contacts.Lookup(s.Key)
+	if err != nil {
+		return "", fmt.Errorf("当前对话对象尚未建档")
+	}
+	return c.ID, nil
+}
+
+func (r *Registry) handleContactGet(ctx context.Context, input json.RawMessage) (string, error) {
+	var p struct {
+		ID    string `json:"id"`
+		Query string `json:"query"`
+	}
+	if len(input) > 0 {
+		if err := json.Unmarshal(input, &p); err != nil {
+			return "", err
+		}
+	}
+	if r.senderOnly && (p.ID != "" || p.Query != "") {
+		return "", fmt.Errorf("只能查看当前对话对象的档案")
+	}
+	if p.ID == "" && strings.TrimSpace(p.Query) != "" {
+		list := r.contacts.List(p.Query)
+		if len(list) == 0 {
+			return "没有匹配的联系人。", nil
+		}
+		const maxList = 20
+		var sb strings.Builder
+		for i, c := range list {
+			if i == maxList {
+				sb.WriteString(fmt.Sprintf("…… 另有 %d 个联系人未列出\n", len(list)-maxList))
+				break
+			}
+			keys := make([]string, 0, len(c.Identities))
+			for _, id := range c.Identities {
+				keys = append(keys, id.Key)
+			}
+			sb.WriteString(fmt.Sprintf("[%s] %s — %s，最近 %s\n", c.ID, c.Name, strings.Join(keys, ", "),
+				time.UnixMilli(c.LastSeen()).Format("2006-01-02 15:04")))
+		}
+		return sb.String(), nil
+	}
+	id := p.ID
+	if id == "" {
+		var err error
+		if id, err = r.currentContactID(ctx); err != nil {
+			return "", err
+		}
+	}
+	c, err := r.contacts.Get(id)
+	if err != nil {
+		return "", fmt.Errorf("联系人 %q 不存在", id)
+	}
+	data, _ := json.MarshalIndent(c, "", "  ")
+	return string(data), nil
+}
+
+func (r *Registry) handleContactUpdate(ctx context.Context, input json.RawMessage) (string, error) {
+	var p struct {
+		ID          string            `json:"id"`
+		Name        *string           `json:"name"`
+		Profile     map[string]string `json:"profile"`
+		Preferences map[string]string `json:"preferences"`
+		Note        string            `json:"note"`
+	}
+	if err := json.Unmarshal(input, &p); err != nil {
+		return "", err
+	}
+	if p.Name == nil && len(p.Profile) == 0 && len(p.Preferences) == 0 && strings.TrimSpace(p.Note) == "" {
+		return "", fmt.Errorf("nothing to update: pass name, profile, preferences or note")
+	}
+	if r.senderOnly && p.ID != "" {
+		return "", fmt.Errorf("只能更新当前对话对象的档案")
+	}
+	id := p.ID
+	if id == "" {
+		var err error
+		if id, err = r.currentContactID(ctx); err != nil {
+			return "", err
+		}
+	}
+	c, err := r.contacts.Update(id, contact.Patch{
+		Name:        p.Name,
+		Profile:     p.Profile,
+		Preferences: p.Preferences,
+		AddNote:     p.Note,
+	}, "agent")
+	if err != nil {
+		return "", fmt.Errorf("联系人 %q 不存在", id)
+	}
+	return fmt.Sprintf("✅ 已更新联系人 %s（%s）", c.Name, c.ID), nil
+}
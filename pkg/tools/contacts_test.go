@@ -0,0 +1,55 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sunhuihui6688-star/ai-panel/pkg/contact"
+)
+
+func TestSenderOnlyContacts(t *testing.T) {
+	dir := t.TempDir()
+	mgr := contact.NewManager(dir)
+	store, err := mgr.Get("a1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := store.Touch(contact.Sender{Key: contact.TelegramKey(7), Channel: "telegram", Username: "alice"}, "telegram-7", "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	visitor := contact.Sender{Key: contact.WebKey("web1", "tok"), Channel: "web"}
+	if _, err := store.Touch(visitor, "s1", "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	r := New(t.TempDir(), t.TempDir(), "a1")
+	r.WithSenderContacts(mgr)
+	ctx := contact.WithSender(context.Background(), visitor)
+	call := func(name string, in map[string]any) (string, error) {
+		raw, _ := json.Marshal(in)
+		return r.Execute(ctx, name, raw)
+	}
+
+	if out, err := call("contact_get", map[string]any{"query": "telegram"}); err == nil {
+		t.Errorf("query should be rejected, got %q", out)
+	}
+	if out, err := call("contact_get", map[string]any{"id": other.ID}); err == nil {
+		t.Errorf("id should be rejected, got %q", out)
+	}
+	if _, err := call("contact_update", map[string]any{"id": other.ID, "note": "x"}); err == nil {
+		t.Error("updating another contact should be rejected")
+	}
+	if _, err := call("contact_update", map[string]any{"note": "likes tea"}); err != nil {
+		t.Fatal(err)
+	}
+	out, err := call("contact_get", map[string]any{})
+	if err != nil || !strings.Contains(out, "likes tea") || strings.Contains(out, "alice") {
+		t.Fatalf("own profile = %q, %v", out, err)
+	}
+	if c, _ := store.Get(other.ID); len(c.Notes) != 0 {
+		t.Errorf("other contact modified: %+v", c.Notes)
+	}
+}
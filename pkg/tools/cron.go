@@ -0,0 +1,364 @@
+// Cron tools: let an agent schedule, list, update and delete its own jobs.
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sunhuihui6688-star/ai-panel/pkg/audit"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/config"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/cron"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/llm"
+)
+
+// memoryConsolidateMsg and memoryRollupMsg mark the system-managed memory
+// jobs, which agents may see but not modify.
+const (
+	memoryConsolidateMsg = "__MEMORY_CONSOLIDATE__"
+	memoryRollupMsg      = "__MEMORY_ROLLUP__"
+)
+
+// isMemoryJobMsg reports whether a payload message belongs to a system memory job.
+func isMemoryJobMsg(msg string) bool {
+	return msg == memoryConsolidateMsg || msg == memoryRollupMsg
+}
+
+// WithCronEngine registers cron_create / cron_list / cron_update / cron_delete.
+// Agents only see and modify jobs they own. A negative MaxJobsPerAgent
+// disables the tools entirely.
+func (r *Registry) WithCronEngine(engine *cron.Engine, policy config.CronConfig) {
+	if engine == nil || policy.MaxJobsPerAgent < 0 {
+		return
+	}
+	r.cronEngine = engine
+	r.cronPolicy = policy
+
+	r.register(llm.ToolDef{
+		Name: "cron_create",
+		Description: "创建定时任务：到点时以 message 作为指令运行你自己，结果默认发回当前对话。" +
+			"kind=cron（默认）时 schedule 为 cron 表达式（5 段：分 时 日 月 周，或 6 段含秒），例如每周一 9 点：0 9 * * 1；" +
+			"kind=every 时为固定间隔，如 30m、2h、1d；kind=at 时为一次性时间，如 2026-05-01 09:00，运行后自动停用。",
+		InputSchema: json.RawMessage(`{
+			"type":"object",
+			"properties":{
+				"name":{"type":"string","description":"任务名称"},
+				"kind":{"type":"string","enum":["cron","every","at"],"description":"调度类型（默认 cron）"},
+				"schedule":{"type":"string","description":"cron 表达式、间隔或时间，见上"},
+				"tz":{"type":"string","description":"时区，如 Asia/Shanghai（默认服务器时区）"},
+				"jitter":{"type":"string","description":"随机延迟上限，如 5m，避免整点集中运行（可选，at 不支持）"},
+				"message":{"type":"string","description":"到点时发给你自己的指令，如：整理本周数据并发送周报"},
+				"remark":{"type":"string","description":"备注（可选）"},
+				"deliver":{"type":"boolean","description":"是否把运行结果发回当前对话（默认 true）"},
+				"only_on_error":{"type":"boolean","description":"仅在运行失败时发送结果（可选）"},
+				"skip_empty":{"type":"boolean","description":"结果为空或“无事可报”时不发送（可选，适合巡检类任务）"},
+				"match":{"type":"string","description":"正则表达式，仅当结果匹配时才发送（可选）"}
+			},
+			"required":["name","schedule","message"]
+		}`),
+	}, r.handleCronCreate)
+
+	r.register(llm.ToolDef{
+		Name:        "cron_list",
+		Description: "列出你名下的定时任务（ID、调度、下次运行时间、最近状态）。",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{}}`),
+	}, r.handleCronList)
+
+	r.register(llm.ToolDef{
+		Name:        "cron_update",
+		Description: "修改你名下的定时任务，只需传入要改的字段；enabled=false 可暂停任务。",
+		InputSchema: json.RawMessage(`{
+			"type":"object",
+			"properties":{
+				"id":{"type":"string","description":"任务 ID"},
+				"name":{"type":"string"},
+				"kind":{"type":"string","enum":["cron","every","at"]},
+				"schedule":{"type":"string","description":"新的 cron 表达式、间隔或时间"},
+				"jitter":{"type":"string"},
+				"tz":{"type":"string"},
+				"message":{"type":"string"},
+				"remark":{"type":"string"},
+				"enabled":{"type":"boolean"}
+			},
+			"required":["id"]
+		}`),
+	}, r.handleCronUpdate)
+
+	r.register(llm.ToolDef{
+		Name:        "cron_delete",
+		Description: "删除你名下的定时任务。",
+		InputSchema: json.RawMessage(`{
+			"type":"object",
+			"properties":{"id":{"type":"string","description":"任务 ID"}},
+			"required":["id"]
+		}`),
+	}, r.handleCronDelete)
+}
+
+func (r *Registry) handleCronCreate(ctx context.Context, input json.RawMessage) (string, error) {
+	var p struct {
+		Name        string `json:"name"`
+		Kind        string `json:"kind"`
+		Schedule    string `json:"schedule"`
+		TZ          string `json:"tz"`
+		Jitter      string `json:"jitter"`
+		Message     string `json:"message"`
+		Remark      string `json:"remark"`
+		Deliver     *bool  `json:"deliver"`
+		OnlyOnError bool   `json:"only_on_error"`
+		SkipEmpty   bool   `json:"skip_empty"`
+		Match       string `json:"match"`
+	}
+	if err := json.Unmarshal(input, &p); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(p.Name) == "" || strings.TrimSpace(p.Message) == "" {
+		return "", fmt.Errorf("name and message are required")
+	}
+	if isMemoryJobMsg(p.Message) {
+		return "", fmt.Errorf("reserved message")
+	}
+	if p.Kind == "" {
+		p.Kind = "cron"
+	}
+	sched := cron.Schedule{Kind: p.Kind, Expr: strings.TrimSpace(p.Schedule), TZ: p.TZ, Jitter: strings.TrimSpace(p.Jitter)}
+	next, err := r.checkCronSchedule(sched)
+	if err != nil {
+		return "", err
+	}
+
+	job := &cron.Job{
+		Name:      p.Name,
+		Remark:    p.Remark,
+		Enabled:   true,
+		Schedule:  sched,
+		Payload:   cron.Payload{Kind: "agentTurn", Message: p.Message},
+		Delivery:  cron.Delivery{Mode: "none"},
+		AgentID:   r.agentID,
+		CreatedBy: "agent",
+	}
+	if p.Deliver == nil || *p.Deliver {
+		if target := deliveryTargetFrom(audit.MetaFrom(ctx), r.sessionID); target != nil {
+			job.Delivery = cron.Delivery{Mode: "announce", Target: target,
+				OnlyOnError: p.OnlyOnError, SkipEmpty: p.SkipEmpty, Match: strings.TrimSpace(p.Match)}
+		}
+	}
+	max := r.maxCronJobs()
+	if err := r.cronEngine.AddLimited(job, max); err != nil {
+		if errors.Is(err, cron.ErrJobLimit) {
+			return "", fmt.Errorf("已达到定时任务上限（%d 个），请先用 cron_delete 删除不需要的任务", max)
+		}
+		return "", err
+	}
+
+	deliver := "仅记录在运行日志"
+	if job.Delivery.Target != nil {
+		deliver = "发回当前对话"
+		switch d := job.Delivery; {
+		case d.OnlyOnError:
+			deliver += "（仅失败时）"
+		case d.SkipEmpty && d.Match != "":
+			deliver += "（有内容且匹配 " + d.Match + " 时）"
+		case d.SkipEmpty:
+			deliver += "（有内容时）"
+		case d.Match != "":
+			deliver += "（匹配 " + d.Match + " 时）"
+		}
+	}
+	return fmt.Sprintf("✅ 已创建定时任务\nID: %s\n调度: %s\n下次运行: %s\n结果: %s",
+		job.ID, formatSchedule(sched), next.Format("2006-01-02 15:04:05 MST"), deliver), nil
+}
+
+func (r *Registry) handleCronList(_ context.Context, _ json.RawMessage) (string, error) {
+	jobs := r.cronEngine.ListJobsByAgent(r.agentID)
+	if len(jobs) == 0 {
+		return "暂无定时任务。", nil
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAtMs < jobs[j].CreatedAtMs })
+	var sb strings.Builder
+	for _, j := range jobs {
+		status := "启用"
+		if !j.Enabled {
+			status = "暂停"
+		}
+		sb.WriteString(fmt.Sprintf("[%s] %s — %s（%s）", j.ID, j.Name, formatSchedule(j.Schedule), status))
+		if isMemoryJobMsg(j.Payload.Message) {
+			sb.WriteString(" [系统记忆任务，只读]")
+		}
+		if next, err := cron.NextRuns(j.Schedule, time.Now(), 1); err == nil && len(next) > 0 && j.Enabled {
+			sb.WriteString("\n  下次运行: " + next[0].Format("2006-01-02 15:04"))
+		}
+		if j.State.LastRunAtMs > 0 {
+			sb.WriteString(fmt.Sprintf("\n  最近运行: %s (%s)", time.UnixMilli(j.State.LastRunAtMs).Format("2006-01-02 15:04"), j.State.LastStatus))
+		}
+		if !isMemoryJobMsg(j.Payload.Message) {
+			sb.WriteString("\n  指令: " + truncateUTF8(j.Payload.Message, 200))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String(), nil
+}
+
+func (r *Registry) handleCronUpdate(_ context.Context, input json.RawMessage) (string, error) {
+	var p struct {
+		ID       string  `json:"id"`
+		Name     *string `json:"name"`
+		Kind     *string `json:"kind"`
+		Schedule *string `json:"schedule"`
+		TZ       *string `json:"tz"`
+		Jitter   *string `json:"jitter"`
+		Message  *string `json:"message"`
+		Remark   *string `json:"remark"`
+		Enabled  *bool   `json:"enabled"`
+	}
+	if err := json.Unmarshal(input, &p); err != nil {
+		return "", err
+	}
+	job, err := r.ownCronJob(p.ID)
+	if err != nil {
+		return "", err
+	}
+	if p.Name != nil && *p.Name != "" {
+		job.Name = *p.Name
+	}
+	if p.Remark != nil {
+		job.Remark = *p.Remark
+	}
+	if p.Message != nil && *p.Message != "" {
+		job.Payload.Message = *p.Message
+	}
+	if p.Enabled != nil {
+		job.Enabled = *p.Enabled
+	}
+	if p.Schedule != nil || p.TZ != nil || p.Kind != nil || p.Jitter != nil {
+		if p.Kind != nil {
+			job.Schedule.Kind = *p.Kind
+		}
+		if p.Schedule != nil {
+			job.Schedule.Expr = strings.TrimSpace(*p.Schedule)
+		}
+		if p.TZ != nil {
+			job.Schedule.TZ = *p.TZ
+		}
+		if p.Jitter != nil {
+			job.Schedule.Jitter = strings.TrimSpace(*p.Jitter)
+		}
+		if _, err := r.checkCronSchedule(job.Schedule); err != nil {
+			return "", err
+		}
+	}
+	if err := r.cronEngine.Update(job.ID, job); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("✅ 已更新定时任务 %s（%s，%s）", job.ID, formatSchedule(job.Schedule), map[bool]string{true: "启用", false: "暂停"}[job.Enabled]), nil
+}
+
+func (r *Registry) handleCronDelete(_ context.Context, input json.RawMessage) (string, error) {
+	var p struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(input, &p); err != nil {
+		return "", err
+	}
+	job, err := r.ownCronJob(p.ID)
+	if err != nil {
+		return "", err
+	}
+	if err := r.cronEngine.Remove(job.ID); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("✅ 已删除定时任务 %s（%s）", job.ID, job.Name), nil
+}
+
+// ownCronJob returns a modifiable job owned by the calling agent.
+func (r *Registry) ownCronJob(id string) (*cron.Job, error) {
+	if id == "" {
+		return nil, fmt.Errorf("id is required")
+	}
+	job, ok := r.cronEngine.Get(id)
+	if !ok || job.AgentID != r.agentID {
+		return nil, fmt.Errorf("定时任务 %q 不存在", id)
+	}
+	if isMemoryJobMsg(job.Payload.Message) {
+		return nil, fmt.Errorf("系统记忆任务只能在管理面板中修改")
+	}
+	return job, nil
+}
+
+// checkCronSchedule validates an expression and enforces the minimum interval.
+// It returns the next fire time.
+func (r *Registry) checkCronSchedule(s cron.Schedule) (time.Time, error) {
+	if s.Expr == "" {
+		return time.Time{}, fmt.Errorf("schedule is required")
+	}
+	runs, err := cron.NextRuns(s, time.Now(), 3)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(runs) == 0 {
+		return time.Time{}, fmt.Errorf("schedule %q never fires (time already passed?)", s.Expr)
+	}
+	minGap := time.Duration(r.cronPolicy.MinIntervalSec) * time.Second
+	if minGap <= 0 {
+		minGap = time.Minute
+	}
+	for i := 1; i < len(runs); i++ {
+		if runs[i].Sub(runs[i-1]) < minGap {
+			return time.Time{}, fmt.Errorf("schedule %q runs more often than the allowed minimum interval of %s", s.Expr, minGap)
+		}
+	}
+	return runs[0], nil
+}
+
+func (r *Registry) maxCronJobs() int {
+	if r.cronPolicy.MaxJobsPerAgent > 0 {
+		return r.cronPolicy.MaxJobsPerAgent
+	}
+	return 10
+}
+
+// deliveryTargetFrom derives where job output should go from the run origin.
+func deliveryTargetFrom(meta audit.Meta, fallbackSession string) *cron.DeliveryTarget {
+	sessionID := meta.SessionID
+	if sessionID == "" {
+		sessionID = fallbackSession
+	}
+	switch {
+	case meta.Source == "telegram":
+		chatID, err := strconv.ParseInt(strings.TrimPrefix(sessionID, "telegram-"), 10, 64)
+		if err != nil {
+			return nil
+		}
+		return &cron.DeliveryTarget{Kind: "telegram", ChannelID: meta.Channel, ChatID: chatID}
+	case meta.Source == "cron" || meta.Source == "subagent":
+		return nil
+	case sessionID != "":
+		return &cron.DeliveryTarget{Kind: "session", ChannelID: meta.Channel, SessionID: sessionID}
+	}
+	return nil
+}
+
+func formatSchedule(s cron.Schedule) string {
+	out := s.Expr
+	switch s.Kind {
+	case "every":
+		out = "每 " + s.Expr
+		if s.Offset != "" {
+			out += "，偏移 " + s.Offset
+		}
+	case "at":
+		out = "一次性 " + s.Expr
+	}
+	if s.Jitter != "" {
+		out += "，随机延迟 ≤" + s.Jitter
+	}
+	if s.TZ != "" {
+		out += " (" + s.TZ + ")"
+	}
+	return out
+}
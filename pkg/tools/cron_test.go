@@ -0,0 +1,92 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sunhuihui6688-star/ai-panel/pkg/audit"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/config"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/cron"
+)
+
+func TestCronTools(t *testing.T) {
+	engine := cron.NewEngine(t.TempDir(), nil)
+	if err := engine.Load(); err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Stop()
+	r := New(t.TempDir(), t.TempDir(), "a1")
+	r.WithCronEngine(engine, config.CronConfig{MaxJobsPerAgent: 1})
+
+	call := func(ctx context.Context, name string, in map[string]any) (string, error) {
+		raw, _ := json.Marshal(in)
+		return r.Execute(ctx, name, raw)
+	}
+	ctx := audit.WithMeta(context.Background(), audit.Meta{Source: "telegram", Channel: "ch1", SessionID: "telegram-42"})
+
+	if _, err := call(ctx, "cron_create", map[string]any{"name": "spam", "schedule": "* * * * * *", "message": "hi"}); err == nil {
+		t.Error("every-second schedule should violate the minimum interval")
+	}
+	out, err := call(ctx, "cron_create", map[string]any{"name": "weekly", "schedule": "0 9 * * 1", "tz": "Asia/Shanghai", "message": "send the report"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs := engine.ListJobsByAgent("a1")
+	if len(jobs) != 1 {
+		t.Fatalf("jobs = %d\n%s", len(jobs), out)
+	}
+	job := jobs[0]
+	if tgt := job.Delivery.Target; tgt == nil || tgt.Kind != "telegram" || tgt.ChatID != 42 || tgt.ChannelID != "ch1" {
+		t.Errorf("delivery target = %+v", job.Delivery.Target)
+	}
+	if _, err := call(ctx, "cron_create", map[string]any{"name": "second", "schedule": "0 10 * * *", "message": "x"}); err == nil {
+		t.Error("per-agent job limit should apply")
+	}
+
+	if _, err := call(ctx, "cron_update", map[string]any{"id": job.ID, "enabled": false}); err != nil {
+		t.Fatal(err)
+	}
+	if j, _ := engine.Get(job.ID); j.Enabled || j.Payload.Message != "send the report" {
+		t.Errorf("update should only pause the job: %+v", j)
+	}
+
+	// Other agents' jobs are invisible.
+	_ = engine.Add(&cron.Job{ID: "other", AgentID: "a2", Schedule: cron.Schedule{Expr: "0 9 * * *"}})
+	if out, _ := call(ctx, "cron_list", map[string]any{}); strings.Contains(out, "other") {
+		t.Errorf("cron_list leaked another agent's job:\n%s", out)
+	}
+	if _, err := call(ctx, "cron_delete", map[string]any{"id": "other"}); err == nil {
+		t.Error("deleting another agent's job should fail")
+	}
+	if _, err := call(ctx, "cron_delete", map[string]any{"id": job.ID}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCronCreateLimitIsAtomic(t *testing.T) {
+	engine := cron.NewEngine(t.TempDir(), nil)
+	if err := engine.Load(); err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Stop()
+	r := New(t.TempDir(), t.TempDir(), "a1")
+	r.WithCronEngine(engine, config.CronConfig{MaxJobsPerAgent: 2})
+
+	raw, _ := json.Marshal(map[string]any{"name": "n", "schedule": "0 9 * * *", "message": "hi"})
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = r.Execute(context.Background(), "cron_create", raw)
+			_, _ = r.Execute(context.Background(), "cron_list", nil)
+		}()
+	}
+	wg.Wait()
+	if jobs := engine.ListJobsByAgent("a1"); len(jobs) != 2 {
+		t.Fatalf("jobs = %d, want 2", len(jobs))
+	}
+}
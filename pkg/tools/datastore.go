@@ -0,0 +1,240 @@
+// Data store tools: a persistent key-value map and a SQLite scratch database
+// per agent, for state that must survive across sessions (counters, seen IDs,
+// small tables).
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/sunhuihui6688-star/ai-panel/pkg/datastore"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/document"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/llm"
+)
+
+const (
+	sqlDefaultRows = 100
+	sqlMaxRows     = 1000
+)
+
+// WithDataStore registers kv_get / kv_set / kv_list / kv_delete / sql_query
+// backed by the agent's own store.
+func (r *Registry) WithDataStore(mgr *datastore.Manager) {
+	if mgr == nil || r.agentID == "" {
+		return
+	}
+	store, err := mgr.Get(r.agentID)
+	if err != nil {
+		log.Printf("[tools] datastore for agent %s unavailable: %v", r.agentID, err)
+		return
+	}
+	r.dataStore = store
+
+	r.register(llm.ToolDef{
+		Name:        "kv_get",
+		Description: "读取持久化键值存储中的一个值（跨会话保留）。",
+		InputSchema: json.RawMessage(`{
+			"type":"object",
+			"properties":{"key":{"type":"string","description":"键名，如 user:123:lang"}},
+			"required":["key"]
+		}`),
+	}, r.handleKVGet)
+
+	r.register(llm.ToolDef{
+		Name: "kv_set",
+		Description: "写入持久化键值存储（跨会话保留）。value 可以是任意 JSON（字符串、数字、对象、数组）；" +
+			"传 increment 则把数值累加到现有值上（计数器）。ttl_seconds 设置过期时间。",
+		InputSchema: json.RawMessage(`{
+			"type":"object",
+			"properties":{
+				"key":{"type":"string","description":"键名，建议用冒号分组，如 seen:rss:123"},
+				"value":{"description":"要保存的 JSON 值"},
+				"increment":{"type":"number","description":"数值累加量（与 value 二选一）"},
+				"ttl_seconds":{"type":"integer","description":"过期秒数（默认永不过期）"}
+			},
+			"required":["key"]
+		}`),
+	}, r.handleKVSet)
+
+	r.register(llm.ToolDef{
+		Name:        "kv_list",
+		Description: "列出键值存储中的键（可按前缀过滤），附带值预览和用量。",
+		InputSchema: json.RawMessage(`{
+			"type":"object",
+			"properties":{"prefix":{"type":"string","description":"键名前缀（可选）"}}
+		}`),
+	}, r.handleKVList)
+
+	r.register(llm.ToolDef{
+		Name:        "kv_delete",
+		Description: "删除键值存储中的一个键。",
+		InputSchema: json.RawMessage(`{
+			"type":"object",
+			"properties":{"key":{"type":"string"}},
+			"required":["key"]
+		}`),
+	}, r.handleKVDelete)
+
+	r.register(llm.ToolDef{
+		Name: "sql_query",
+		Description: "在你专属的 SQLite 数据库中执行 SQL（跨会话保留），适合保存表格型数据并做查询统计。" +
+			"可执行 CREATE TABLE / INSERT / UPDATE / SELECT 等；参数用 ? 占位并通过 params 传入。" +
+			"read_only=true 时拒绝任何写操作。不支持 ATTACH 和修改配置的 PRAGMA。",
+		InputSchema: json.RawMessage(`{
+			"type":"object",
+			"properties":{
+				"sql":{"type":"string","description":"SQL 语句；非查询语句可用分号连写多条"},
+				"params":{"type":"array","description":"? 占位参数","items":{}},
+				"read_only":{"type":"boolean","description":"只读模式（默认 false）"},
+				"max_rows":{"type":"integer","description":"最多返回行数（默认 100，最大 1000）"}
+			},
+			"required":["sql"]
+		}`),
+	}, r.handleSQLQuery)
+}
+
+func (r *Registry) handleKVGet(_ context.Context, input json.RawMessage) (string, error) {
+	var p struct {
+		Key string `json:"key"`
+	}
+	if err := json.Unmarshal(input, &p); err != nil {
+		return "", err
+	}
+	e, ok := r.dataStore.KVGet(p.Key)
+	if !ok {
+		return fmt.Sprintf("键 %q 不存在", p.Key), nil
+	}
+	out := string(e.Value)
+	if e.ExpiresAt > 0 {
+		out += fmt.Sprintf("\n（过期时间: %s）", time.UnixMilli(e.ExpiresAt).Format("2006-01-02 15:04:05"))
+	}
+	return out, nil
+}
+
+func (r *Registry) handleKVSet(_ context.Context, input json.RawMessage) (string, error) {
+	var p struct {
+		Key        string          `json:"key"`
+		Value      json.RawMessage `json:"value"`
+		Increment  *float64        `json:"increment"`
+		TTLSeconds int64           `json:"ttl_seconds"`
+	}
+	if err := json.Unmarshal(input, &p); err != nil {
+		return "", err
+	}
+	if p.Increment != nil {
+		n, err := r.dataStore.KVIncr(p.Key, *p.Increment)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("✅ %s = %v", p.Key, n), nil
+	}
+	if len(p.Value) == 0 {
+		return "", fmt.Errorf("value or increment is required")
+	}
+	e, err := r.dataStore.KVSet(p.Key, p.Value, time.Duration(p.TTLSeconds)*time.Second)
+	if err != nil {
+		return "", err
+	}
+	msg := fmt.Sprintf("✅ 已保存 %s（%d 字节）", e.Key, len(e.Value))
+	if e.ExpiresAt > 0 {
+		msg += "，过期时间 " + time.UnixMilli(e.ExpiresAt).Format("2006-01-02 15:04:05")
+	}
+	return msg, nil
+}
+
+func (r *Registry) handleKVList(_ context.Context, input json.RawMessage) (string, error) {
+	var p struct {
+		Prefix string `json:"prefix"`
+	}
+	if len(input) > 0 {
+		if err := json.Unmarshal(input, &p); err != nil {
+			return "", err
+		}
+	}
+	entries := r.dataStore.KVList(p.Prefix)
+	u := r.dataStore.Usage()
+	usage := fmt.Sprintf("用量: %d/%d 个键，%d/%d KB", u.KVKeys, u.MaxKVKeys, u.KVBytes>>10, u.MaxKVBytes>>10)
+	if len(entries) == 0 {
+		return "没有匹配的键。\n" + usage, nil
+	}
+	const maxList = 200
+	var sb strings.Builder
+	for i, e := range entries {
+		if i == maxList {
+			sb.WriteString(fmt.Sprintf("…… 另有 %d 个键未列出，请用 prefix 缩小范围\n", len(entries)-maxList))
+			break
+		}
+		sb.WriteString(e.Key + " = " + truncateUTF8(string(e.Value), 120) + "\n")
+	}
+	sb.WriteString(usage)
+	return sb.String(), nil
+}
+
+func (r *Registry) handleKVDelete(_ context.Context, input json.RawMessage) (string, error) {
+	var p struct {
+		Key string `json:"key"`
+	}
+	if err := json.Unmarshal(input, &p); err != nil {
+		return "", err
+	}
+	ok, err := r.dataStore.KVDelete(p.Key)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return fmt.Sprintf("键 %q 不存在", p.Key), nil
+	}
+	return "✅ 已删除 " + p.Key, nil
+}
+
+func (r *Registry) handleSQLQuery(ctx context.Context, input json.RawMessage) (string, error) {
+	var p struct {
+		SQL      string `json:"sql"`
+		Params   []any  `json:"params"`
+		ReadOnly bool   `json:"read_only"`
+		MaxRows  int    `json:"max_rows"`
+	}
+	if err := json.Unmarshal(input, &p); err != nil {
+		return "", err
+	}
+	if p.MaxRows <= 0 {
+		p.MaxRows = sqlDefaultRows
+	}
+	if p.MaxRows > sqlMaxRows {
+		p.MaxRows = sqlMaxRows
+	}
+	res, err := r.dataStore.Query(ctx, p.SQL, p.Params, p.ReadOnly, p.MaxRows)
+	if err != nil {
+		return "", err
+	}
+	if !res.IsQuery {
+		return fmt.Sprintf("✅ 影响 %d 行", res.RowsAffected), nil
+	}
+	if len(res.Rows) == 0 {
+		return "（无结果）列: " + strings.Join(res.Columns, ", "), nil
+	}
+	rows := make([][]string, 0, len(res.Rows)+1)
+	rows = append(rows, res.Columns)
+	for _, row := range res.Rows {
+		cells := make([]string, len(row))
+		for i, v := range row {
+			if v == nil {
+				cells[i] = "NULL"
+			} else {
+				cells[i] = truncateUTF8(fmt.Sprint(v), 500)
+			}
+		}
+		rows = append(rows, cells)
+	}
+	out := document.MarkdownTable(rows)
+	if res.Truncated {
+		out += fmt.Sprintf("\n[仅显示前 %d 行，可用 max_rows 或 LIMIT/OFFSET 分页]", p.MaxRows)
+	} else {
+		out += fmt.Sprintf("\n共 %d 行", len(res.Rows))
+	}
+	return out, nil
+}
@@ -0,0 +1,95 @@
+// read_document: PDF / Word / Excel / PowerPoint text extraction.
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/sunhuihui6688-star/ai-panel/pkg/document"
+	lllm "github.com/sunhuihui6688-star/ai-panel/pkg/llm"
+)
+
+const (
+	readDocumentDefaultChars = 20000
+	readDocumentMaxChars     = 100000
+)
+
+var readDocumentToolDef = lllm.ToolDef{
+	Name: "read_document",
+	Description: "读取 PDF、Word（.docx）、Excel（.xlsx）、PowerPoint（.pptx）文档，返回 Markdown 格式的正文和表格。" +
+		"PDF 按页、Excel 按工作表、PPT 按幻灯片分页，可用 pages 指定范围（如 1-3,5）。用户上传的文件保存在 uploads/ 目录。",
+	InputSchema: json.RawMessage(`{
+		"type":"object",
+		"properties":{
+			"file_path":{"type":"string","description":"文档路径（相对工作区或绝对路径）"},
+			"pages":{"type":"string","description":"页码范围，如 1-3,5 或 10-（默认全部）"},
+			"max_chars":{"type":"number","description":"最多返回的字符数（默认 20000，上限 100000）"}
+		},
+		"required":["file_path"]
+	}`),
+}
+
+func (r *Registry) handleReadDocument(_ context.Context, input json.RawMessage) (string, error) {
+	var p struct {
+		FilePath string `json:"file_path"`
+		Pages    string `json:"pages"`
+		MaxChars int    `json:"max_chars"`
+	}
+	if err := json.Unmarshal(input, &p); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(p.FilePath) == "" {
+		return "", fmt.Errorf("file_path is required")
+	}
+	if p.MaxChars <= 0 {
+		p.MaxChars = readDocumentDefaultChars
+	}
+	if p.MaxChars > readDocumentMaxChars {
+		p.MaxChars = readDocumentMaxChars
+	}
+
+	path := r.resolvePath(p.FilePath)
+	doc, err := document.ExtractFile(path, document.Options{Pages: p.Pages, MaxChars: p.MaxChars})
+	if err != nil {
+		return "", err
+	}
+	return formatDocument(filepath.Base(path), doc, p.Pages), nil
+}
+
+// formatDocument renders an extracted document with a short header the
+// model can use to decide whether to request more pages.
+func formatDocument(name string, doc *document.Document, pages string) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("文件: %s（%s，共 %d %s", name, strings.ToUpper(string(doc.Format)), doc.TotalPages, pageUnit(doc.Format)))
+	if pages != "" {
+		sb.WriteString("，当前范围: " + pages)
+	}
+	sb.WriteString("）\n\n")
+	if doc.Empty() {
+		if doc.Format == document.FormatPDF {
+			sb.WriteString("（未提取到文本，可能是扫描件或图片型 PDF）")
+		} else {
+			sb.WriteString("（文档中没有可提取的文本）")
+		}
+		return sb.String()
+	}
+	sb.WriteString(doc.Markdown())
+	if doc.Truncated {
+		nums := doc.PageNumbers()
+		sb.WriteString(fmt.Sprintf("\n\n[已截断：显示到第 %d %s，可用 pages 参数继续读取后续内容]", nums[len(nums)-1], pageUnit(doc.Format)))
+	}
+	return sb.String()
+}
+
+func pageUnit(f document.Format) string {
+	switch f {
+	case document.FormatXLSX:
+		return "个工作表"
+	case document.FormatPPTX:
+		return "张幻灯片"
+	}
+	return "页"
+}
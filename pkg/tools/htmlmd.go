@@ -0,0 +1,383 @@
+// HTML → Markdown conversion with main-content extraction, used by web_fetch.
+package tools
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/sunhuihui6688-star/ai-panel/pkg/document"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// skipElements are never rendered: scripts, chrome and interactive widgets.
+var skipElements = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Svg: true, atom.Iframe: true, atom.Form: true, atom.Button: true,
+	atom.Select: true, atom.Input: true, atom.Textarea: true, atom.Canvas: true,
+	atom.Nav: true, atom.Footer: true, atom.Aside: true, atom.Head: true,
+}
+
+// boilerplateAttr matches class/id values of typical non-content containers.
+var boilerplateAttr = regexp.MustCompile(`(?i)\b(nav|navbar|menu|footer|sidebar|breadcrumb|cookie|banner|advert|ads?|promo|share|social|comment|related|subscribe|popup|modal)\b`)
+
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// HTMLToMarkdown extracts the main content of an HTML document and renders it
+// as Markdown. Relative links are resolved against base (may be nil).
+func HTMLToMarkdown(r io.Reader, base *url.URL) (title, markdown string, err error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return "", "", err
+	}
+	title = strings.TrimSpace(textContent(findFirst(doc, atom.Title)))
+
+	root := mainContent(doc)
+	c := &mdConverter{base: base}
+	c.render(root)
+	markdown = tidyMarkdown(c.sb.String())
+	return title, markdown, nil
+}
+
+// mainContent picks the node most likely to hold the page's main content:
+// <article> or <main> / role=main if present, otherwise the block with the
+// most paragraph text.
+func mainContent(doc *html.Node) *html.Node {
+	if n := findFirst(doc, atom.Article); n != nil && len(textContent(n)) > 200 {
+		return n
+	}
+	if n := findFirst(doc, atom.Main); n != nil {
+		return n
+	}
+	var roleMain *html.Node
+	walk(doc, func(n *html.Node) bool {
+		if roleMain == nil && n.Type == html.ElementNode && attr(n, "role") == "main" {
+			roleMain = n
+		}
+		return roleMain == nil
+	})
+	if roleMain != nil {
+		return roleMain
+	}
+
+	// Score each container by the text of its direct <p> children.
+	best, bestScore := (*html.Node)(nil), 0
+	walk(doc, func(n *html.Node) bool {
+		if n.Type != html.ElementNode {
+			return true
+		}
+		if skipElements[n.DataAtom] || isBoilerplate(n) {
+			return false
+		}
+		if n.DataAtom == atom.Div || n.DataAtom == atom.Section || n.DataAtom == atom.Td || n.DataAtom == atom.Body {
+			score := 0
+			for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+				if ch.Type == html.ElementNode && (ch.DataAtom == atom.P || ch.DataAtom == atom.Pre || ch.DataAtom == atom.Blockquote) {
+					score += len(textContent(ch))
+				}
+			}
+			if score > bestScore {
+				best, bestScore = n, score
+			}
+		}
+		return true
+	})
+	if best != nil && bestScore > 200 {
+		return best
+	}
+	if body := findFirst(doc, atom.Body); body != nil {
+		return body
+	}
+	return doc
+}
+
+type mdConverter struct {
+	sb     strings.Builder
+	base   *url.URL
+	inPre  bool
+	lists  []listState
+	prefix string // blockquote prefix
+}
+
+type listState struct {
+	ordered bool
+	index   int
+}
+
+func (c *mdConverter) write(s string) {
+	if c.prefix != "" {
+		s = strings.ReplaceAll(s, "\n", "\n"+c.prefix)
+	}
+	c.sb.WriteString(s)
+}
+
+func (c *mdConverter) block() { c.write("\n\n") }
+
+func (c *mdConverter) render(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		if c.inPre {
+			c.write(n.Data)
+			return
+		}
+		text := collapseSpace(n.Data)
+		if cur := c.sb.String(); cur == "" || strings.HasSuffix(cur, " ") || strings.HasSuffix(cur, "\n") {
+			text = strings.TrimLeft(text, " ")
+		}
+		c.write(text)
+		return
+	case html.DocumentNode:
+		c.children(n)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+	if skipElements[n.DataAtom] || isBoilerplate(n) {
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level := int(n.Data[1] - '0')
+		c.block()
+		c.write(strings.Repeat("#", level) + " " + strings.TrimSpace(collapseSpace(textContent(n))))
+		c.block()
+	case atom.P, atom.Div, atom.Section, atom.Article, atom.Main, atom.Header, atom.Figure, atom.Figcaption, atom.Dl:
+		c.block()
+		c.children(n)
+		c.block()
+	case atom.Br:
+		c.write("\n")
+	case atom.Hr:
+		c.block()
+		c.write("---")
+		c.block()
+	case atom.Strong, atom.B:
+		if t := strings.TrimSpace(collapseSpace(textContent(n))); t != "" {
+			c.write("**" + t + "**")
+		}
+	case atom.Em, atom.I:
+		if t := strings.TrimSpace(collapseSpace(textContent(n))); t != "" {
+			c.write("_" + t + "_")
+		}
+	case atom.Code:
+		if c.inPre {
+			c.children(n)
+		} else {
+			c.write("`" + textContent(n) + "`")
+		}
+	case atom.Pre:
+		c.block()
+		c.write("```\n")
+		c.inPre = true
+		c.children(n)
+		c.inPre = false
+		c.write("\n```")
+		c.block()
+	case atom.Blockquote:
+		c.block()
+		saved := c.prefix
+		c.prefix += "> "
+		c.write("> ")
+		c.children(n)
+		c.prefix = saved
+		c.block()
+	case atom.A:
+		text := strings.TrimSpace(collapseSpace(textContent(n)))
+		href := c.resolve(attr(n, "href"))
+		switch {
+		case text == "":
+		case href == "" || strings.HasPrefix(href, "javascript:") || strings.HasPrefix(href, "#"):
+			c.write(text)
+		default:
+			c.write("[" + text + "](" + href + ")")
+		}
+	case atom.Img:
+		if src := c.resolve(attr(n, "src")); src != "" && !strings.HasPrefix(src, "data:") {
+			c.write("![" + attr(n, "alt") + "](" + src + ")")
+		}
+	case atom.Ul, atom.Ol:
+		c.block()
+		c.lists = append(c.lists, listState{ordered: n.DataAtom == atom.Ol})
+		c.children(n)
+		c.lists = c.lists[:len(c.lists)-1]
+		c.block()
+	case atom.Li:
+		indent := ""
+		marker := "- "
+		if depth := len(c.lists); depth > 0 {
+			indent = strings.Repeat("  ", depth-1)
+			ls := &c.lists[depth-1]
+			if ls.ordered {
+				ls.index++
+				marker = fmt.Sprintf("%d. ", ls.index)
+			}
+		}
+		c.write("\n" + indent + marker)
+		c.children(n)
+	case atom.Dt:
+		c.write("\n**" + strings.TrimSpace(collapseSpace(textContent(n))) + "**")
+	case atom.Dd:
+		c.write("\n: ")
+		c.children(n)
+	case atom.Table:
+		c.block()
+		c.table(n)
+		c.block()
+	default:
+		c.children(n)
+	}
+}
+
+func (c *mdConverter) children(n *html.Node) {
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		c.render(ch)
+	}
+}
+
+// table renders a <table> as a Markdown pipe table (first row is the header).
+func (c *mdConverter) table(n *html.Node) {
+	var rows [][]string
+	walk(n, func(x *html.Node) bool {
+		if x.Type == html.ElementNode && x.DataAtom == atom.Tr {
+			var row []string
+			for cell := x.FirstChild; cell != nil; cell = cell.NextSibling {
+				if cell.Type == html.ElementNode && (cell.DataAtom == atom.Td || cell.DataAtom == atom.Th) {
+					text := strings.TrimSpace(collapseSpace(textContent(cell)))
+					row = append(row, strings.ReplaceAll(text, "|", `\|`))
+				}
+			}
+			if len(row) > 0 {
+				rows = append(rows, row)
+			}
+			return false
+		}
+		return true
+	})
+	if len(rows) == 0 {
+		return
+	}
+	c.write(document.MarkdownTable(rows))
+}
+
+func (c *mdConverter) resolve(href string) string {
+	href = strings.TrimSpace(href)
+	if href == "" || c.base == nil {
+		return href
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		return href
+	}
+	return c.base.ResolveReference(u).String()
+}
+
+// ── DOM helpers ──────────────────────────────────────────────────────────────
+
+func walk(n *html.Node, fn func(*html.Node) bool) {
+	if !fn(n) {
+		return
+	}
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		walk(ch, fn)
+	}
+}
+
+func findFirst(n *html.Node, a atom.Atom) *html.Node {
+	var found *html.Node
+	walk(n, func(x *html.Node) bool {
+		if found != nil {
+			return false
+		}
+		if x.Type == html.ElementNode && x.DataAtom == a {
+			found = x
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+func textContent(n *html.Node) string {
+	if n == nil {
+		return ""
+	}
+	var sb strings.Builder
+	walk(n, func(x *html.Node) bool {
+		if x.Type == html.ElementNode && skipElements[x.DataAtom] {
+			return false
+		}
+		if x.Type == html.TextNode {
+			sb.WriteString(x.Data)
+		}
+		return true
+	})
+	return sb.String()
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func isBoilerplate(n *html.Node) bool {
+	if n.DataAtom == atom.Body || n.DataAtom == atom.Main || n.DataAtom == atom.Article {
+		return false
+	}
+	if attr(n, "aria-hidden") == "true" {
+		return true
+	}
+	for _, a := range n.Attr {
+		if a.Key == "hidden" {
+			return true
+		}
+	}
+	return boilerplateAttr.MatchString(attr(n, "class") + " " + attr(n, "id"))
+}
+
+// collapseSpace folds whitespace runs into single spaces, keeping one leading or
+// trailing space so that "foo <a>bar</a>" does not collapse into "foobar".
+func collapseSpace(s string) string {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		if s != "" {
+			return " "
+		}
+		return ""
+	}
+	out := strings.Join(fields, " ")
+	if isSpaceByte(s[0]) {
+		out = " " + out
+	}
+	if isSpaceByte(s[len(s)-1]) {
+		out += " "
+	}
+	return out
+}
+
+func isSpaceByte(b byte) bool {
+	return b == ' ' || b == '\n' || b == '\t' || b == '\r' || b == '\f'
+}
+
+// tidyMarkdown trims trailing spaces outside code fences and squeezes blank lines.
+func tidyMarkdown(s string) string {
+	lines := strings.Split(s, "\n")
+	inFence := false
+	for i, l := range lines {
+		if strings.HasPrefix(strings.TrimSpace(l), "```") {
+			inFence = !inFence
+		}
+		if !inFence {
+			lines[i] = strings.TrimRight(l, " ")
+		}
+	}
+	return blankLines.ReplaceAllString(strings.TrimSpace(strings.Join(lines, "\n")), "\n\n")
+}
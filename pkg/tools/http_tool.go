@@ -0,0 +1,269 @@
+// Declarative HTTP tools — config.ToolEntry of type "custom" with an HTTP spec.
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/sunhuihui6688-star/ai-panel/pkg/config"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/llm"
+)
+
+const httpToolMaxChars = 50000
+
+var toolNameSanitizer = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// HTTPRequestPreview is the rendered form of a declarative HTTP tool call.
+// Secrets are masked so the preview can be shown in the UI.
+type HTTPRequestPreview struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+}
+
+// WithCustomTools registers the declarative HTTP tools (ToolEntry.Type "custom")
+// that are enabled globally and listed in the agent's toolIDs.
+// Must be called after WithEnv so that {{.env.X}} templates see the agent env.
+func (r *Registry) WithCustomTools(entries []config.ToolEntry, toolIDs []string) {
+	for _, e := range selectToolEntries(entries, toolIDs, "custom") {
+		if e.HTTP == nil {
+			continue
+		}
+		entry := e
+		def := HTTPToolDef(entry)
+		if _, exists := r.handlers[def.Name]; exists {
+			log.Printf("[tools] custom tool %q (entry %s) conflicts with an existing tool, skipped", def.Name, entry.ID)
+			continue
+		}
+		r.register(def, func(ctx context.Context, input json.RawMessage) (string, error) {
+			return ExecuteHTTPTool(ctx, entry, input, r.agentEnv)
+		})
+	}
+}
+
+// selectToolEntries returns the enabled entries of the given type whose IDs appear in toolIDs.
+func selectToolEntries(entries []config.ToolEntry, toolIDs []string, typ string) []config.ToolEntry {
+	wanted := make(map[string]bool, len(toolIDs))
+	for _, id := range toolIDs {
+		wanted[id] = true
+	}
+	var out []config.ToolEntry
+	for _, e := range entries {
+		if e.Enabled && e.Type == typ && wanted[e.ID] {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// HTTPToolDef builds the LLM tool definition for a custom HTTP tool entry.
+func HTTPToolDef(entry config.ToolEntry) llm.ToolDef {
+	spec := entry.HTTP
+	name := spec.ToolName
+	if name == "" {
+		name = entry.ID
+	}
+	name = toolNameSanitizer.ReplaceAllString(name, "_")
+	desc := spec.Description
+	if desc == "" {
+		desc = entry.Name
+	}
+	schema := spec.InputSchema
+	if len(bytes.TrimSpace(schema)) == 0 {
+		schema = json.RawMessage(`{"type":"object","properties":{}}`)
+	}
+	return llm.ToolDef{Name: name, Description: desc, InputSchema: schema}
+}
+
+// ValidateHTTPTool checks that the spec's schema is valid JSON and all templates parse.
+func ValidateHTTPTool(entry config.ToolEntry) error {
+	spec := entry.HTTP
+	if spec == nil {
+		return fmt.Errorf("custom tool %s has no http spec", entry.ID)
+	}
+	if strings.TrimSpace(spec.URL) == "" {
+		return fmt.Errorf("http.url is required")
+	}
+	if len(bytes.TrimSpace(spec.InputSchema)) > 0 && !json.Valid(spec.InputSchema) {
+		return fmt.Errorf("http.inputSchema is not valid JSON")
+	}
+	if _, err := parseToolTemplate("url", spec.URL); err != nil {
+		return err
+	}
+	if _, err := parseToolTemplate("body", spec.Body); err != nil {
+		return err
+	}
+	for k, v := range spec.Headers {
+		if _, err := parseToolTemplate("header "+k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RenderHTTPTool renders the request a custom tool would send for the given input.
+// When mask is true, the API key is replaced by a placeholder (used for dry runs).
+func RenderHTTPTool(entry config.ToolEntry, input json.RawMessage, env map[string]string, mask bool) (*HTTPRequestPreview, error) {
+	if err := ValidateHTTPTool(entry); err != nil {
+		return nil, err
+	}
+	spec := entry.HTTP
+
+	args := map[string]any{}
+	if len(bytes.TrimSpace(input)) > 0 {
+		if err := json.Unmarshal(input, &args); err != nil {
+			return nil, fmt.Errorf("invalid tool input: %w", err)
+		}
+	}
+	// Optional schema properties that the model omitted render as "" instead of "<no value>".
+	var schema struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	if json.Unmarshal(spec.InputSchema, &schema) == nil {
+		for k := range schema.Properties {
+			if _, ok := args[k]; !ok {
+				args[k] = ""
+			}
+		}
+	}
+
+	apiKey := entry.APIKey
+	if mask && apiKey != "" {
+		apiKey = "***"
+	}
+	envData := map[string]string{}
+	for k, v := range env {
+		envData[k] = v
+		if mask {
+			envData[k] = "***"
+		}
+	}
+	data := map[string]any{
+		"input":   args,
+		"apiKey":  apiKey,
+		"baseUrl": strings.TrimRight(entry.BaseURL, "/"),
+		"env":     envData,
+	}
+
+	render := func(name, text string) (string, error) {
+		t, err := parseToolTemplate(name, text)
+		if err != nil {
+			return "", err
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, data); err != nil {
+			return "", fmt.Errorf("render %s: %w", name, err)
+		}
+		return buf.String(), nil
+	}
+
+	method := strings.ToUpper(strings.TrimSpace(spec.Method))
+	if method == "" {
+		method = http.MethodGet
+	}
+	u, err := render("url", spec.URL)
+	if err != nil {
+		return nil, err
+	}
+	body, err := render("body", spec.Body)
+	if err != nil {
+		return nil, err
+	}
+	headers := make(map[string]string, len(spec.Headers))
+	for k, v := range spec.Headers {
+		hv, err := render("header "+k, v)
+		if err != nil {
+			return nil, err
+		}
+		headers[k] = hv
+	}
+	return &HTTPRequestPreview{Method: method, URL: strings.TrimSpace(u), Headers: headers, Body: body}, nil
+}
+
+// ExecuteHTTPTool renders and sends a custom tool request, returning the
+// (optionally JSONPath-extracted) response as the tool result.
+func ExecuteHTTPTool(ctx context.Context, entry config.ToolEntry, input json.RawMessage, env map[string]string) (string, error) {
+	req, err := RenderHTTPTool(entry, input, env, false)
+	if err != nil {
+		return "", err
+	}
+	timeout := time.Duration(entry.HTTP.TimeoutSec) * time.Second
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var bodyReader io.Reader
+	if req.Body != "" {
+		bodyReader = strings.NewReader(req.Body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, req.URL, bodyReader)
+	if err != nil {
+		return "", err
+	}
+	for k, v := range req.Headers {
+		httpReq.Header.Set(k, v)
+	}
+	if req.Body != "" && httpReq.Header.Get("Content-Type") == "" && json.Valid([]byte(req.Body)) {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 4*httpToolMaxChars))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode >= 400 {
+		return "", fmt.Errorf("HTTP %d: %s", resp.StatusCode, truncate(string(raw), 500))
+	}
+
+	out := string(raw)
+	if entry.HTTP.ResponsePath != "" {
+		var doc any
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			return "", fmt.Errorf("response is not JSON, cannot apply responsePath: %w", err)
+		}
+		v, err := evalJSONPath(doc, entry.HTTP.ResponsePath)
+		if err != nil {
+			return "", err
+		}
+		if s, ok := v.(string); ok {
+			out = s
+		} else {
+			b, _ := json.MarshalIndent(v, "", "  ")
+			out = string(b)
+		}
+	}
+	if len(out) > httpToolMaxChars {
+		out = truncateUTF8(out, httpToolMaxChars) + "\n[已截断]"
+	}
+	return out, nil
+}
+
+func parseToolTemplate(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s template: %w", name, err)
+	}
+	return t, nil
+}
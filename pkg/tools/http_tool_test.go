@@ -0,0 +1,105 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/sunhuihui6688-star/ai-panel/pkg/config"
+)
+
+func TestExecuteHTTPTool(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret-key" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":{"items":[{"name":"` + r.URL.Query().Get("q") + `"},{"name":"b"}]}}`))
+	}))
+	defer srv.Close()
+
+	entry := config.ToolEntry{
+		ID:      "search-api",
+		Type:    "custom",
+		APIKey:  "secret-key",
+		BaseURL: srv.URL,
+		Enabled: true,
+		HTTP: &config.HTTPToolSpec{
+			ToolName:     "item_search",
+			InputSchema:  json.RawMessage(`{"type":"object","properties":{"q":{"type":"string"},"page":{"type":"number"}}}`),
+			URL:          "{{.baseUrl}}/items?q={{urlquery .input.q}}&page={{.input.page}}",
+			Headers:      map[string]string{"Authorization": "Bearer {{.apiKey}}"},
+			ResponsePath: "$.data.items[*].name",
+		},
+	}
+
+	preview, err := RenderHTTPTool(entry, json.RawMessage(`{"q":"a b"}`), nil, true)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if preview.Headers["Authorization"] != "Bearer ***" {
+		t.Errorf("secret not masked in dry run: %q", preview.Headers["Authorization"])
+	}
+	if !strings.HasSuffix(preview.URL, "/items?q=a+b&page=") {
+		t.Errorf("unexpected url %q", preview.URL)
+	}
+
+	out, err := ExecuteHTTPTool(context.Background(), entry, json.RawMessage(`{"q":"a"}`), nil)
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	var names []string
+	if err := json.Unmarshal([]byte(out), &names); err != nil || len(names) != 2 || names[0] != "a" {
+		t.Errorf("unexpected result %q", out)
+	}
+
+	r := New(t.TempDir(), t.TempDir(), "agent1")
+	r.WithCustomTools([]config.ToolEntry{entry}, []string{"search-api"})
+	if _, ok := r.handlers["item_search"]; !ok {
+		t.Error("custom tool not registered for agent listing it in toolIds")
+	}
+}
+
+func TestHTTPToolTruncatesOnRuneBoundary(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("x" + strings.Repeat("中", httpToolMaxChars/3+1)))
+	}))
+	defer srv.Close()
+
+	entry := config.ToolEntry{ID: "big", Type: "custom", BaseURL: srv.URL, Enabled: true,
+		HTTP: &config.HTTPToolSpec{ToolName: "big", URL: "{{.baseUrl}}/"}}
+	out, err := ExecuteHTTPTool(context.Background(), entry, json.RawMessage(`{}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(out, "[已截断]") || !utf8.ValidString(out) {
+		t.Fatalf("truncated output is not valid UTF-8 (len %d)", len(out))
+	}
+}
+
+func TestEvalJSONPath(t *testing.T) {
+	var doc any
+	_ = json.Unmarshal([]byte(`{"a":{"b":[1,2,3]},"c":"x"}`), &doc)
+	cases := map[string]string{
+		"$.c":         `"x"`,
+		"a.b[-1]":     `3`,
+		"$.a.b[*]":    `[1,2,3]`,
+		"$['a'].b[0]": `1`,
+	}
+	for path, want := range cases {
+		v, err := evalJSONPath(doc, path)
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+			continue
+		}
+		got, _ := json.Marshal(v)
+		if string(got) != want {
+			t.Errorf("%s: got %s, want %s", path, got, want)
+		}
+	}
+}
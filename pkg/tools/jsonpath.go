@@ -0,0 +1,125 @@
+// Minimal JSONPath evaluator used to extract fields from HTTP tool responses.
+package tools
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// evalJSONPath evaluates a JSONPath subset against a decoded JSON document.
+// Supported syntax: "$" root, ".key", "['key']", "[n]" (negative counts from
+// the end), "[*]" and ".*" wildcards. Once a wildcard has been applied the
+// result is always a list, so "$.items[*].name" yields every name.
+func evalJSONPath(doc any, path string) (any, error) {
+	path = strings.TrimSpace(path)
+	if path == "" || path == "$" {
+		return doc, nil
+	}
+	path = strings.TrimPrefix(path, "$")
+
+	nodes := []any{doc}
+	multi := false
+	for len(path) > 0 {
+		var seg string
+		wildcard := false
+		index, hasIndex := 0, false
+
+		switch {
+		case strings.HasPrefix(path, ".*"):
+			wildcard = true
+			path = path[2:]
+		case path[0] == '.':
+			path = path[1:]
+			end := strings.IndexAny(path, ".[")
+			if end < 0 {
+				end = len(path)
+			}
+			seg, path = path[:end], path[end:]
+			if seg == "" {
+				return nil, fmt.Errorf("jsonpath: empty key")
+			}
+		case path[0] == '[':
+			end := strings.IndexByte(path, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("jsonpath: unclosed '['")
+			}
+			inner := strings.TrimSpace(path[1:end])
+			path = path[end+1:]
+			switch {
+			case inner == "*":
+				wildcard = true
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				seg = inner[1 : len(inner)-1]
+			default:
+				n, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("jsonpath: invalid index %q", inner)
+				}
+				index, hasIndex = n, true
+			}
+		default:
+			// Allow paths written without the leading "$." (e.g. "data.items").
+			path = "." + path
+			continue
+		}
+
+		var next []any
+		for _, n := range nodes {
+			switch {
+			case wildcard:
+				switch v := n.(type) {
+				case []any:
+					next = append(next, v...)
+				case map[string]any:
+					for _, k := range sortedKeys(v) {
+						next = append(next, v[k])
+					}
+				}
+			case hasIndex:
+				arr, ok := n.([]any)
+				if !ok {
+					continue
+				}
+				i := index
+				if i < 0 {
+					i += len(arr)
+				}
+				if i >= 0 && i < len(arr) {
+					next = append(next, arr[i])
+				}
+			default:
+				if obj, ok := n.(map[string]any); ok {
+					if v, ok := obj[seg]; ok {
+						next = append(next, v)
+					}
+				}
+			}
+		}
+		if wildcard {
+			multi = true
+		}
+		nodes = next
+	}
+
+	if multi {
+		if nodes == nil {
+			nodes = []any{}
+		}
+		return nodes, nil
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("jsonpath: no match")
+	}
+	return nodes[0], nil
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
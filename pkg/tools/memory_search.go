@@ -0,0 +1,75 @@
+// memory_search: ranked semantic + keyword search over the agent's own
+// memory tree, so it can find the right memory file without guessing.
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sunhuihui6688-star/ai-panel/pkg/llm"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/memory"
+)
+
+var memorySearchToolDef = llm.ToolDef{
+	Name: "memory_search",
+	Description: "在你自己的记忆文件（memory/ 下的 core、projects、daily、topics 等）中按语义和关键词检索，" +
+		"返回最相关的片段及其文件路径、标题和行号。回答涉及过去的事实、偏好、项目细节时先用它找记忆，再用 Read 读取完整文件。",
+	InputSchema: json.RawMessage(`{
+		"type":"object",
+		"properties":{
+			"query":{"type":"string","description":"要找的内容，可以是自然语言描述，如：用户喜欢的饮料"},
+			"limit":{"type":"integer","description":"返回片段数（默认 5，最多 20）"}
+		},
+		"required":["query"]
+	}`),
+}
+
+func (r *Registry) handleMemorySearch(ctx context.Context, input json.RawMessage) (string, error) {
+	var p struct {
+		Query string `json:"query"`
+		Limit int    `json:"limit"`
+	}
+	if err := json.Unmarshal(input, &p); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(p.Query) == "" {
+		return "", fmt.Errorf("query is required")
+	}
+	if p.Limit <= 0 {
+		p.Limit = 5
+	}
+	if p.Limit > 20 {
+		p.Limit = 20
+	}
+	hits, err := memory.OpenIndex(r.workspaceDir).Search(ctx, p.Query, p.Limit)
+	if err != nil {
+		return "", err
+	}
+	if len(hits) == 0 {
+		return "没有找到相关记忆。", nil
+	}
+	return FormatMemoryHits(hits, 600), nil
+}
+
+// FormatMemoryHits renders search hits for the model, truncating each chunk
+// to maxRunes.
+func FormatMemoryHits(hits []memory.SearchHit, maxRunes int) string {
+	var sb strings.Builder
+	for i, h := range hits {
+		loc := fmt.Sprintf("memory/%s:%d", h.Path, h.Line)
+		if h.Heading != "" {
+			loc += " · " + h.Heading
+		}
+		text := h.Text
+		if rs := []rune(text); len(rs) > maxRunes {
+			text = string(rs[:maxRunes]) + "…"
+		}
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(fmt.Sprintf("[%d] %s（相关度 %.2f）\n%s\n", i+1, loc, h.Score, text))
+	}
+	return sb.String()
+}
@@ -0,0 +1,671 @@
+// apply_patch: multi-file edits from a unified diff or a structured patch.
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	lllm "github.com/sunhuihui6688-star/ai-panel/pkg/llm"
+)
+
+var applyPatchToolDef = lllm.ToolDef{
+	Name: "apply_patch",
+	Description: "Apply a multi-file patch atomically (all files or none). Accepts a unified diff (git diff / diff -u) " +
+		"or the structured format:\n" +
+		"*** Begin Patch\n*** Update File: path\n@@ optional context line\n ctx\n-old\n+new\n" +
+		"*** Add File: path\n+content\n*** Delete File: path\n*** Update File: old\n*** Move to: new\n*** End Patch\n" +
+		"Hunks are located by their context lines (whitespace-tolerant), so line numbers may be approximate. " +
+		"Paths are relative to the workspace, or to the project when project_id is set. Use dry_run to validate first.",
+	InputSchema: json.RawMessage(`{
+		"type":"object",
+		"properties":{
+			"patch":{"type":"string","description":"Unified diff or structured patch text"},
+			"dry_run":{"type":"boolean","description":"Validate and report what would change without writing"},
+			"project_id":{"type":"string","description":"Apply inside this shared project instead of the workspace (requires edit permission)"}
+		},
+		"required":["patch"]
+	}`),
+}
+
+type patchOpKind int
+
+const (
+	patchUpdate patchOpKind = iota
+	patchAdd
+	patchDelete
+)
+
+// patchOp is one file operation parsed from a patch.
+type patchOp struct {
+	kind    patchOpKind
+	path    string
+	moveTo  string // rename target (update only)
+	hunks   []patchHunk
+	content string // add only
+}
+
+type patchHunk struct {
+	oldStart int      // 1-based hint from "@@ -l,s", 0 if unknown
+	anchor   string   // structured "@@ context" line, searched for before the hunk
+	lines    []string // each prefixed with ' ', '-' or '+'
+	noEOL    bool     // "\ No newline at end of file" after the new side
+}
+
+func (h patchHunk) side(keep byte) []string {
+	var out []string
+	for _, l := range h.lines {
+		if l[0] == ' ' || l[0] == keep {
+			out = append(out, l[1:])
+		}
+	}
+	return out
+}
+
+func (r *Registry) handleApplyPatch(_ context.Context, input json.RawMessage) (string, error) {
+	var p struct {
+		Patch     string `json:"patch"`
+		DryRun    bool   `json:"dry_run"`
+		ProjectID string `json:"project_id"`
+	}
+	if err := json.Unmarshal(input, &p); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(p.Patch) == "" {
+		return "", fmt.Errorf("patch is required")
+	}
+
+	root := r.workspaceDir
+	if p.ProjectID != "" {
+		if r.projectMgr == nil {
+			return "", fmt.Errorf("project manager not available")
+		}
+		proj, ok := r.projectMgr.Get(p.ProjectID)
+		if !ok {
+			return "", fmt.Errorf("项目 %q 不存在", p.ProjectID)
+		}
+		if !proj.CanWrite(r.agentID) {
+			return "", fmt.Errorf("🚫 权限不足：你没有编辑项目 %q 的权限", p.ProjectID)
+		}
+		root = proj.FilesDir
+	}
+	if root == "" {
+		return "", fmt.Errorf("no workspace configured")
+	}
+
+	ops, err := parsePatch(p.Patch)
+	if err != nil {
+		return "", err
+	}
+	changes, err := planPatch(root, ops)
+	if err != nil {
+		return "", err
+	}
+	summary := summarizePatch(root, changes)
+	if p.DryRun {
+		return "✅ 补丁校验通过（dry run，未写入）：\n" + summary, nil
+	}
+	commit := func() error { return commitPatch(changes) }
+	if root == r.workspaceDir {
+		// Version every touched memory/identity file.
+		for _, ch := range changes {
+			paths := []string{ch.path}
+			if ch.dest != ch.path {
+				paths = append(paths, ch.dest)
+			}
+			for _, path := range paths {
+				inner, path := commit, path
+				commit = func() error { return r.trackWrite(path, "apply_patch", inner) }
+			}
+		}
+	}
+	if err := commit(); err != nil {
+		return "", err
+	}
+	return "✅ 补丁已应用：\n" + summary, nil
+}
+
+// ── Parsing ──────────────────────────────────────────────────────────────────
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,\d+)? \+\d+(?:,\d+)? @@`)
+
+// parsePatch detects the patch format and parses it into file operations.
+func parsePatch(text string) ([]patchOp, error) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if strings.Contains(text, "*** Begin Patch") || regexp.MustCompile(`(?m)^\*\*\* (Add|Update|Delete) File: `).MatchString(text) {
+		return parseStructuredPatch(text)
+	}
+	return parseUnifiedDiff(text)
+}
+
+func parseStructuredPatch(text string) ([]patchOp, error) {
+	var ops []patchOp
+	var cur *patchOp
+	var hunk *patchHunk
+	flushHunk := func() {
+		if cur != nil && hunk != nil && len(hunk.lines) > 0 {
+			cur.hunks = append(cur.hunks, *hunk)
+		}
+		hunk = nil
+	}
+	flush := func() {
+		flushHunk()
+		if cur != nil {
+			ops = append(ops, *cur)
+		}
+		cur = nil
+	}
+
+	for i, line := range strings.Split(text, "\n") {
+		switch {
+		case line == "*** Begin Patch" || line == "*** End of File":
+		case line == "*** End Patch":
+			flush()
+		case strings.HasPrefix(line, "*** Add File: "):
+			flush()
+			cur = &patchOp{kind: patchAdd, path: strings.TrimSpace(line[len("*** Add File: "):])}
+		case strings.HasPrefix(line, "*** Delete File: "):
+			flush()
+			cur = &patchOp{kind: patchDelete, path: strings.TrimSpace(line[len("*** Delete File: "):])}
+		case strings.HasPrefix(line, "*** Update File: "):
+			flush()
+			cur = &patchOp{kind: patchUpdate, path: strings.TrimSpace(line[len("*** Update File: "):])}
+		case strings.HasPrefix(line, "*** Move to: "):
+			if cur == nil || cur.kind != patchUpdate {
+				return nil, fmt.Errorf("line %d: Move to without Update File", i+1)
+			}
+			cur.moveTo = strings.TrimSpace(line[len("*** Move to: "):])
+		case cur == nil:
+			if strings.TrimSpace(line) != "" {
+				return nil, fmt.Errorf("line %d: content outside of a file section", i+1)
+			}
+		case cur.kind == patchAdd:
+			if !strings.HasPrefix(line, "+") {
+				if line == "" {
+					continue
+				}
+				return nil, fmt.Errorf("line %d: Add File lines must start with '+'", i+1)
+			}
+			cur.content += line[1:] + "\n"
+		case cur.kind == patchDelete:
+		case strings.HasPrefix(line, "@@"):
+			flushHunk()
+			hunk = &patchHunk{anchor: strings.TrimSpace(strings.TrimPrefix(line, "@@"))}
+		default:
+			if hunk == nil {
+				hunk = &patchHunk{}
+			}
+			if line == "" {
+				line = " "
+			}
+			if c := line[0]; c != ' ' && c != '-' && c != '+' {
+				return nil, fmt.Errorf("line %d: hunk lines must start with ' ', '-' or '+'", i+1)
+			}
+			hunk.lines = append(hunk.lines, line)
+		}
+	}
+	flush()
+	if len(ops) == 0 {
+		return nil, fmt.Errorf("patch contains no file operations")
+	}
+	return ops, nil
+}
+
+func parseUnifiedDiff(text string) ([]patchOp, error) {
+	var ops []patchOp
+	var cur *patchOp
+	var hunk *patchHunk
+	var renameFrom, renameTo string
+	flushHunk := func() {
+		if cur != nil && hunk != nil {
+			cur.hunks = append(cur.hunks, *hunk)
+		}
+		hunk = nil
+	}
+	flush := func() {
+		flushHunk()
+		if cur != nil {
+			ops = append(ops, *cur)
+		} else if renameFrom != "" && renameTo != "" {
+			// pure rename (git diff with 100% similarity) has no ---/+++ lines
+			ops = append(ops, patchOp{kind: patchUpdate, path: renameFrom, moveTo: renameTo})
+		}
+		cur, renameFrom, renameTo = nil, "", ""
+	}
+
+	lines := strings.Split(text, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			flush()
+		case strings.HasPrefix(line, "rename from "):
+			renameFrom = strings.TrimSpace(line[len("rename from "):])
+		case strings.HasPrefix(line, "rename to "):
+			renameTo = strings.TrimSpace(line[len("rename to "):])
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			if cur != nil {
+				flush()
+			}
+			oldPath := diffPath(line[4:])
+			newPath := diffPath(lines[i+1][4:])
+			i++
+			switch {
+			case oldPath == "":
+				cur = &patchOp{kind: patchAdd, path: newPath}
+			case newPath == "":
+				cur = &patchOp{kind: patchDelete, path: oldPath}
+			default:
+				cur = &patchOp{kind: patchUpdate, path: oldPath}
+				if newPath != oldPath {
+					cur.moveTo = newPath
+				}
+			}
+			if renameFrom != "" && renameTo != "" {
+				cur.path, cur.moveTo = renameFrom, renameTo
+			}
+		case strings.HasPrefix(line, "@@"):
+			if cur == nil {
+				return nil, fmt.Errorf("line %d: hunk without file header", i+1)
+			}
+			flushHunk()
+			hunk = &patchHunk{}
+			if m := hunkHeader.FindStringSubmatch(line); m != nil {
+				hunk.oldStart, _ = strconv.Atoi(m[1])
+			}
+		case strings.HasPrefix(line, `\ `):
+			if hunk != nil {
+				hunk.noEOL = true
+			}
+		case hunk != nil && line != "" && (line[0] == ' ' || line[0] == '-' || line[0] == '+'):
+			hunk.lines = append(hunk.lines, line)
+		case hunk != nil && line == "" && i < len(lines)-1:
+			// Some tools strip the leading space of empty context lines.
+			hunk.lines = append(hunk.lines, " ")
+		}
+	}
+	flush()
+	if len(ops) == 0 {
+		return nil, fmt.Errorf("could not find any file changes in patch (expected unified diff or *** Begin Patch format)")
+	}
+	// Added files in unified diffs carry their content as a single all-'+' hunk.
+	for i := range ops {
+		if ops[i].kind == patchAdd {
+			var sb strings.Builder
+			for _, h := range ops[i].hunks {
+				for _, l := range h.side('+') {
+					sb.WriteString(l + "\n")
+				}
+			}
+			ops[i].content = sb.String()
+			ops[i].hunks = nil
+		}
+	}
+	return ops, nil
+}
+
+// diffPath strips the a/ b/ prefixes and timestamps from ---/+++ header paths.
+func diffPath(s string) string {
+	if i := strings.IndexByte(s, '\t'); i >= 0 {
+		s = s[:i]
+	}
+	s = strings.TrimSpace(s)
+	if s == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(s, "a/") || strings.HasPrefix(s, "b/") {
+		s = s[2:]
+	}
+	return s
+}
+
+// ── Planning (in memory, nothing written) ────────────────────────────────────
+
+// fileChange is the fully computed effect of one operation.
+type fileChange struct {
+	kind    patchOpKind
+	path    string // absolute source path
+	dest    string // absolute destination path (== path unless renamed)
+	content string
+	added   int
+	removed int
+}
+
+// planPatch resolves paths and applies every hunk in memory. Any failure
+// aborts the whole patch before a single file is touched.
+func planPatch(root string, ops []patchOp) ([]fileChange, error) {
+	var changes []fileChange
+	touched := map[string]bool{}
+	for _, op := range ops {
+		src, err := confinePath(root, op.path)
+		if err != nil {
+			return nil, err
+		}
+		dest := src
+		if op.moveTo != "" {
+			if dest, err = confinePath(root, op.moveTo); err != nil {
+				return nil, err
+			}
+		}
+		for _, p := range []string{src, dest} {
+			if touched[p] {
+				return nil, fmt.Errorf("%s: file appears more than once in the patch", op.path)
+			}
+		}
+		touched[src], touched[dest] = true, true
+
+		switch op.kind {
+		case patchAdd:
+			if _, err := os.Stat(src); err == nil {
+				return nil, fmt.Errorf("%s: cannot add, file already exists", op.path)
+			}
+			changes = append(changes, fileChange{kind: patchAdd, path: src, dest: src, content: op.content, added: strings.Count(op.content, "\n")})
+		case patchDelete:
+			data, err := os.ReadFile(src)
+			if err != nil {
+				return nil, fmt.Errorf("%s: cannot delete: %w", op.path, err)
+			}
+			changes = append(changes, fileChange{kind: patchDelete, path: src, dest: src, removed: strings.Count(string(data), "\n")})
+		case patchUpdate:
+			data, err := os.ReadFile(src)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", op.path, err)
+			}
+			if dest != src {
+				if _, err := os.Stat(dest); err == nil {
+					return nil, fmt.Errorf("%s: cannot move, %s already exists", op.path, op.moveTo)
+				}
+			}
+			content, added, removed, err := applyHunks(string(data), op.hunks)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", op.path, err)
+			}
+			changes = append(changes, fileChange{kind: patchUpdate, path: src, dest: dest, content: content, added: added, removed: removed})
+		}
+	}
+	return changes, nil
+}
+
+// confinePath resolves p under root and rejects anything that escapes it.
+func confinePath(root, p string) (string, error) {
+	if strings.TrimSpace(p) == "" {
+		return "", fmt.Errorf("empty path in patch")
+	}
+	rootAbs, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	full := p
+	if !filepath.IsAbs(p) {
+		full = filepath.Join(rootAbs, p)
+	}
+	full = filepath.Clean(full)
+	if full != rootAbs && !strings.HasPrefix(full, rootAbs+string(filepath.Separator)) {
+		return "", fmt.Errorf("🚫 路径越界：%s 不在 %s 内", p, rootAbs)
+	}
+	// Refuse to follow symlinks that point outside the root. Missing parents
+	// are created later by MkdirAll, which follows any symlink above them, so
+	// resolve the nearest existing ancestor (or the file itself).
+	rootResolved, _ := filepath.EvalSymlinks(rootAbs)
+	if rootResolved == "" {
+		return full, nil
+	}
+	existing := full
+	for existing != rootAbs {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		existing = filepath.Dir(existing)
+	}
+	resolved, err := filepath.EvalSymlinks(existing)
+	if err != nil || (resolved != rootResolved && !strings.HasPrefix(resolved, rootResolved+string(filepath.Separator))) {
+		return "", fmt.Errorf("🚫 路径越界：%s 经符号链接指向工作区之外", p)
+	}
+	return full, nil
+}
+
+// applyHunks applies hunks in order, locating each by fuzzy context matching.
+func applyHunks(src string, hunks []patchHunk) (string, int, int, error) {
+	hadEOL := strings.HasSuffix(src, "\n")
+	lines := strings.Split(strings.TrimSuffix(src, "\n"), "\n")
+	if src == "" {
+		lines = nil
+	}
+	added, removed := 0, 0
+	offset := 0 // line shift caused by earlier hunks
+	cursor := 0 // hunks apply in order; never match before the previous hunk
+	for n, h := range hunks {
+		oldSide, newSide := h.side('-'), h.side('+')
+		start := cursor
+		if h.anchor != "" {
+			if idx := findBlock(lines, []string{h.anchor}, cursor, cursor); idx >= 0 {
+				start = idx + 1
+			}
+		}
+		hint := start
+		if h.oldStart > 0 {
+			hint = h.oldStart - 1 + offset
+		}
+		var at int
+		if len(oldSide) == 0 {
+			at = hint
+			if h.oldStart == 0 && h.anchor == "" {
+				at = len(lines) // pure insertion without position: append
+			}
+			if at > len(lines) {
+				at = len(lines)
+			}
+		} else {
+			at = findBlock(lines, oldSide, hint, start)
+			if at < 0 {
+				return "", 0, 0, fmt.Errorf("hunk %d does not match the file (context not found):\n%s", n+1, strings.Join(oldSide, "\n"))
+			}
+		}
+		next := make([]string, 0, len(lines)-len(oldSide)+len(newSide))
+		next = append(next, lines[:at]...)
+		next = append(next, newSide...)
+		next = append(next, lines[at+len(oldSide):]...)
+		lines = next
+		cursor = at + len(newSide)
+		offset += len(newSide) - len(oldSide)
+		for _, l := range h.lines {
+			switch l[0] {
+			case '+':
+				added++
+			case '-':
+				removed++
+			}
+		}
+		if h.noEOL && n == len(hunks)-1 {
+			hadEOL = false
+		}
+	}
+	out := strings.Join(lines, "\n")
+	if hadEOL && len(lines) > 0 {
+		out += "\n"
+	}
+	return out, added, removed, nil
+}
+
+// findBlock finds block in lines at or after min, preferring the position
+// closest to hint. It tries exact, trailing-whitespace-insensitive and fully
+// whitespace-insensitive comparisons in that order.
+func findBlock(lines, block []string, hint, min int) int {
+	normalizers := []func(string) string{
+		func(s string) string { return s },
+		func(s string) string { return strings.TrimRight(s, " \t") },
+		func(s string) string { return strings.Join(strings.Fields(s), " ") },
+	}
+	for _, norm := range normalizers {
+		best, bestDist := -1, 0
+		for i := min; i+len(block) <= len(lines); i++ {
+			match := true
+			for j := range block {
+				if norm(lines[i+j]) != norm(block[j]) {
+					match = false
+					break
+				}
+			}
+			if !match {
+				continue
+			}
+			dist := i - hint
+			if dist < 0 {
+				dist = -dist
+			}
+			if best < 0 || dist < bestDist {
+				best, bestDist = i, dist
+			}
+		}
+		if best >= 0 {
+			return best
+		}
+	}
+	return -1
+}
+
+// ── Commit (all or nothing) ──────────────────────────────────────────────────
+
+// commitPatch writes every change via temp files + rename. If any step fails,
+// files already modified are restored from their in-memory backups.
+func commitPatch(changes []fileChange) error {
+	type backup struct {
+		path    string
+		data    []byte
+		mode    os.FileMode
+		existed bool
+	}
+	var done []backup
+	var dirs []string // directories created for new files, parents first
+	rollback := func() {
+		for i := len(done) - 1; i >= 0; i-- {
+			b := done[i]
+			if b.existed {
+				_ = os.WriteFile(b.path, b.data, b.mode)
+				_ = os.Chmod(b.path, b.mode)
+			} else {
+				_ = os.Remove(b.path)
+			}
+		}
+		for i := len(dirs) - 1; i >= 0; i-- {
+			_ = os.Remove(dirs[i]) // fails, as intended, if something else lives there
+		}
+	}
+	snapshot := func(path string) error {
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			done = append(done, backup{path: path})
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		done = append(done, backup{path: path, data: data, mode: info.Mode().Perm(), existed: true})
+		return nil
+	}
+
+	for _, ch := range changes {
+		var err error
+		switch ch.kind {
+		case patchDelete:
+			if err = snapshot(ch.path); err == nil {
+				err = os.Remove(ch.path)
+			}
+		default:
+			if err = snapshot(ch.dest); err == nil && ch.dest != ch.path {
+				err = snapshot(ch.path)
+			}
+			if err == nil {
+				dirs = append(dirs, missingDirs(filepath.Dir(ch.dest))...)
+				err = writeFileAtomic(ch.dest, []byte(ch.content))
+			}
+			if err == nil && ch.dest != ch.path {
+				err = os.Remove(ch.path)
+			}
+		}
+		if err != nil {
+			rollback()
+			return fmt.Errorf("apply %s: %w（已回滚全部修改）", ch.path, err)
+		}
+	}
+	return nil
+}
+
+// missingDirs lists dir and its ancestors that do not exist yet, parents first.
+func missingDirs(dir string) []string {
+	var out []string
+	for {
+		if _, err := os.Lstat(dir); err == nil {
+			break
+		}
+		out = append([]string{dir}, out...)
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return out
+}
+
+// writeFileAtomic writes data to a temp file in the same directory and renames it into place.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".patch-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	_ = os.Chmod(tmp.Name(), mode)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+func summarizePatch(root string, changes []fileChange) string {
+	var sb strings.Builder
+	rel := func(p string) string {
+		if r, err := filepath.Rel(root, p); err == nil {
+			return r
+		}
+		return p
+	}
+	for _, ch := range changes {
+		switch {
+		case ch.kind == patchAdd:
+			sb.WriteString(fmt.Sprintf("A %s (+%d)\n", rel(ch.dest), ch.added))
+		case ch.kind == patchDelete:
+			sb.WriteString(fmt.Sprintf("D %s (-%d)\n", rel(ch.path), ch.removed))
+		case ch.dest != ch.path:
+			sb.WriteString(fmt.Sprintf("R %s → %s (+%d -%d)\n", rel(ch.path), rel(ch.dest), ch.added, ch.removed))
+		default:
+			sb.WriteString(fmt.Sprintf("M %s (+%d -%d)\n", rel(ch.path), ch.added, ch.removed))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,161 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sunhuihui6688-star/ai-panel/pkg/project"
+)
+
+func TestApplyPatch(t *testing.T) {
+	ws := t.TempDir()
+	r := New(ws, t.TempDir(), "agent1")
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(ws, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(name string) string {
+		data, _ := os.ReadFile(filepath.Join(ws, name))
+		return string(data)
+	}
+	apply := func(patch string, dry bool) (string, error) {
+		in, _ := json.Marshal(map[string]any{"patch": patch, "dry_run": dry})
+		return r.Execute(context.Background(), "apply_patch", in)
+	}
+
+	write("a.go", "package a\n\nfunc A() int {\n\treturn 1\n}\n")
+	write("old.txt", "keep\n")
+	write("gone.txt", "bye\n")
+
+	// Unified diff with a wrong line number and trailing-whitespace drift.
+	unified := `--- a/a.go
++++ b/a.go
+@@ -10,3 +10,3 @@
+ func A() int {  
+-	return 1
++	return 2
+ }
+`
+	if _, err := apply(unified, true); err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if strings.Contains(read("a.go"), "return 2") {
+		t.Fatal("dry run must not write")
+	}
+	if _, err := apply(unified, false); err != nil {
+		t.Fatalf("unified: %v", err)
+	}
+	if got := read("a.go"); !strings.Contains(got, "\treturn 2\n") {
+		t.Fatalf("unified not applied:\n%s", got)
+	}
+
+	structured := `*** Begin Patch
+*** Add File: sub/new.txt
++hello
+*** Update File: old.txt
+*** Move to: renamed.txt
+@@
+-keep
++kept
+*** Delete File: gone.txt
+*** End Patch`
+	if _, err := apply(structured, false); err != nil {
+		t.Fatalf("structured: %v", err)
+	}
+	if read("sub/new.txt") != "hello\n" || read("renamed.txt") != "kept\n" {
+		t.Fatalf("structured not applied: %q %q", read("sub/new.txt"), read("renamed.txt"))
+	}
+	for _, name := range []string{"old.txt", "gone.txt"} {
+		if _, err := os.Stat(filepath.Join(ws, name)); !os.IsNotExist(err) {
+			t.Errorf("%s should be gone", name)
+		}
+	}
+
+	// A failing hunk leaves every file untouched.
+	atomic := `*** Begin Patch
+*** Add File: partial.txt
++x
+*** Update File: a.go
+-no such line
++y
+*** End Patch`
+	if _, err := apply(atomic, false); err == nil {
+		t.Fatal("expected mismatch error")
+	}
+	if _, err := os.Stat(filepath.Join(ws, "partial.txt")); !os.IsNotExist(err) {
+		t.Error("partial.txt must not be created when another file fails")
+	}
+
+	if _, err := apply("*** Begin Patch\n*** Add File: ../escape.txt\n+x\n*** End Patch", false); err == nil {
+		t.Error("paths outside the workspace must be rejected")
+	}
+}
+
+func TestApplyPatchConfinement(t *testing.T) {
+	ws, outside := t.TempDir(), t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(ws, "link")); err != nil {
+		t.Skip("symlinks unsupported:", err)
+	}
+	r := New(ws, t.TempDir(), "agent1")
+	apply := func(in map[string]any) (string, error) {
+		raw, _ := json.Marshal(in)
+		return r.Execute(context.Background(), "apply_patch", raw)
+	}
+
+	// The parent does not exist yet; MkdirAll would follow link outside.
+	escape := "*** Begin Patch\n*** Add File: link/newdir/f.txt\n+x\n*** End Patch"
+	if _, err := apply(map[string]any{"patch": escape}); err == nil {
+		t.Error("symlinked ancestor outside the workspace must be rejected")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "newdir")); !os.IsNotExist(err) {
+		t.Error("nothing may be created outside the workspace")
+	}
+
+	mgr := project.NewManager(t.TempDir())
+	if err := mgr.LoadAll(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mgr.Create(project.CreateOpts{ID: "p1", Name: "P1", Editors: []string{"someone-else"}}); err != nil {
+		t.Fatal(err)
+	}
+	r.WithProjectAccess(mgr)
+	add := "*** Begin Patch\n*** Add File: a.txt\n+x\n*** End Patch"
+	if _, err := apply(map[string]any{"patch": add, "project_id": "p1"}); err == nil || !strings.Contains(err.Error(), "权限不足") {
+		t.Errorf("non-editor write: err = %v", err)
+	}
+	proj, _ := mgr.Get("p1")
+	if _, err := os.Stat(filepath.Join(proj.FilesDir, "a.txt")); !os.IsNotExist(err) {
+		t.Error("denied patch must not write into the project")
+	}
+}
+
+func TestCommitPatchRollback(t *testing.T) {
+	ws := t.TempDir()
+	script := filepath.Join(ws, "run.sh")
+	_ = os.WriteFile(script, []byte("echo hi\n"), 0755)
+	_ = os.WriteFile(filepath.Join(ws, "blocker"), []byte("x"), 0644)
+
+	err := commitPatch([]fileChange{
+		{kind: patchDelete, path: script, dest: script},
+		{kind: patchAdd, path: filepath.Join(ws, "new", "deep", "a.txt"), dest: filepath.Join(ws, "new", "deep", "a.txt"), content: "a"},
+		{kind: patchAdd, path: filepath.Join(ws, "blocker", "b.txt"), dest: filepath.Join(ws, "blocker", "b.txt"), content: "b"},
+	})
+	if err == nil {
+		t.Fatal("expected the last change to fail")
+	}
+	info, err := os.Stat(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Fatalf("restored mode = %v, want 0755", info.Mode().Perm())
+	}
+	if _, err := os.Stat(filepath.Join(ws, "new")); !os.IsNotExist(err) {
+		t.Fatal("directories created by the patch were left behind")
+	}
+}
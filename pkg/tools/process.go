@@ -0,0 +1,225 @@
+// Background process tools: process_start / process_status / process_logs / process_kill.
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sunhuihui6688-star/ai-panel/pkg/llm"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/process"
+)
+
+// WithProcessSupervisor registers the managed background process tools.
+// Processes outlive the current turn; agents only see their own processes.
+func (r *Registry) WithProcessSupervisor(sup *process.Supervisor) {
+	r.processSup = sup
+
+	r.register(llm.ToolDef{
+		Name: "process_start",
+		Description: "在后台启动一个长时间运行的命令（开发服务器、长时间构建、爬虫等），不受 exec 120 秒限制。" +
+			"立即返回进程 ID；输出写入日志，可用 process_logs 查看。工作目录为当前工作区。",
+		InputSchema: json.RawMessage(`{
+			"type":"object",
+			"properties":{
+				"command":{"type":"string","description":"要执行的 shell 命令"},
+				"label":{"type":"string","description":"简短标签，便于识别（可选）"},
+				"wait_seconds":{"type":"number","description":"启动后等待几秒并返回初始输出（0-30，默认 3）"}
+			},
+			"required":["command"]
+		}`),
+	}, r.handleProcessStart)
+
+	r.register(llm.ToolDef{
+		Name:        "process_status",
+		Description: "查看后台进程状态。不填 id 则列出本成员的全部进程。",
+		InputSchema: json.RawMessage(`{
+			"type":"object",
+			"properties":{
+				"id":{"type":"string","description":"进程 ID（可选）"}
+			}
+		}`),
+	}, r.handleProcessStatus)
+
+	r.register(llm.ToolDef{
+		Name:        "process_logs",
+		Description: "读取后台进程最近的输出（stdout+stderr）。",
+		InputSchema: json.RawMessage(`{
+			"type":"object",
+			"properties":{
+				"id":{"type":"string","description":"进程 ID"},
+				"tail_lines":{"type":"number","description":"只返回最后 N 行（默认 100）"}
+			},
+			"required":["id"]
+		}`),
+	}, r.handleProcessLogs)
+
+	r.register(llm.ToolDef{
+		Name:        "process_kill",
+		Description: "停止一个后台进程（先 SIGTERM，5 秒后 SIGKILL，包括其子进程）。",
+		InputSchema: json.RawMessage(`{
+			"type":"object",
+			"properties":{
+				"id":{"type":"string","description":"进程 ID"}
+			},
+			"required":["id"]
+		}`),
+	}, r.handleProcessKill)
+}
+
+// maxProcessLogOutput caps what process_logs returns to the model.
+const maxProcessLogOutput = 30000
+
+func (r *Registry) handleProcessStart(_ context.Context, input json.RawMessage) (string, error) {
+	var p struct {
+		Command     string   `json:"command"`
+		Label       string   `json:"label"`
+		WaitSeconds *float64 `json:"wait_seconds"`
+	}
+	if err := json.Unmarshal(input, &p); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(p.Command) == "" {
+		return "", fmt.Errorf("command is required")
+	}
+	proc, err := r.processSup.Start(process.StartOpts{
+		AgentID: r.agentID,
+		Command: p.Command,
+		Label:   p.Label,
+		Dir:     r.workspaceDir,
+		Env:     r.execEnv(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	wait := 3 * time.Second
+	if p.WaitSeconds != nil {
+		wait = time.Duration(*p.WaitSeconds * float64(time.Second))
+	}
+	if wait > 30*time.Second {
+		wait = 30 * time.Second
+	}
+	if wait > 0 {
+		r.processSup.Wait(proc.ID, wait)
+	}
+	if cur, ok := r.processSup.Get(proc.ID); ok {
+		proc = cur
+	}
+	out, _ := r.processSup.Logs(proc.ID, 4000)
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("✅ 进程已启动\nID: %s\nPID: %d\n状态: %s\n", proc.ID, proc.PID, formatProcStatus(proc)))
+	if out != "" {
+		sb.WriteString("\n初始输出:\n" + out)
+	}
+	return sb.String(), nil
+}
+
+func (r *Registry) handleProcessStatus(_ context.Context, input json.RawMessage) (string, error) {
+	var p struct {
+		ID string `json:"id"`
+	}
+	_ = json.Unmarshal(input, &p)
+	if p.ID != "" {
+		proc, err := r.ownProcess(p.ID)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("ID: %s\n命令: %s\nPID: %d\n状态: %s\n运行时长: %s\n输出: %d 字节",
+			proc.ID, proc.Command, proc.PID, formatProcStatus(proc), proc.Duration(), proc.LogBytes), nil
+	}
+
+	procs := r.processSup.List(r.agentID)
+	if len(procs) == 0 {
+		return "暂无后台进程。", nil
+	}
+	var sb strings.Builder
+	for _, proc := range procs {
+		label := proc.Command
+		if proc.Label != "" {
+			label = proc.Label
+		}
+		sb.WriteString(fmt.Sprintf("[%s] %s — %s (%s)\n", proc.ID, label, formatProcStatus(proc), proc.Duration()))
+	}
+	return sb.String(), nil
+}
+
+func (r *Registry) handleProcessLogs(_ context.Context, input json.RawMessage) (string, error) {
+	var p struct {
+		ID        string `json:"id"`
+		TailLines int    `json:"tail_lines"`
+	}
+	if err := json.Unmarshal(input, &p); err != nil {
+		return "", err
+	}
+	proc, err := r.ownProcess(p.ID)
+	if err != nil {
+		return "", err
+	}
+	out, err := r.processSup.Logs(proc.ID, 0)
+	if err != nil {
+		return "", err
+	}
+	if p.TailLines <= 0 {
+		p.TailLines = 100
+	}
+	lines := strings.Split(strings.TrimRight(out, "\n"), "\n")
+	if len(lines) > p.TailLines {
+		lines = lines[len(lines)-p.TailLines:]
+	}
+	out = strings.Join(lines, "\n")
+	if len(out) > maxProcessLogOutput {
+		out = "...\n" + out[len(out)-maxProcessLogOutput:]
+	}
+	if strings.TrimSpace(out) == "" {
+		out = "（暂无输出）"
+	}
+	return fmt.Sprintf("[%s] %s\n\n%s", proc.ID, formatProcStatus(proc), out), nil
+}
+
+func (r *Registry) handleProcessKill(_ context.Context, input json.RawMessage) (string, error) {
+	var p struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(input, &p); err != nil {
+		return "", err
+	}
+	if _, err := r.ownProcess(p.ID); err != nil {
+		return "", err
+	}
+	if err := r.processSup.Kill(p.ID); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("✅ 进程 %s 已停止", p.ID), nil
+}
+
+// ownProcess looks up a process and checks it belongs to the calling agent.
+func (r *Registry) ownProcess(id string) (*process.Process, error) {
+	if id == "" {
+		return nil, fmt.Errorf("id is required")
+	}
+	proc, ok := r.processSup.Get(id)
+	if !ok || proc.AgentID != r.agentID {
+		return nil, fmt.Errorf("进程 %q 不存在", id)
+	}
+	return proc, nil
+}
+
+func formatProcStatus(p *process.Process) string {
+	switch {
+	case p.Running():
+		return "运行中"
+	case p.Status == process.StatusKilled:
+		return "已停止"
+	case p.Status == process.StatusLost:
+		return "已丢失（服务重启）"
+	case p.Error != "":
+		return fmt.Sprintf("失败: %s", p.Error)
+	case p.ExitCode != nil:
+		return fmt.Sprintf("已退出 (exit %d)", *p.ExitCode)
+	}
+	return string(p.Status)
+}
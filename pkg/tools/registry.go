@@ -12,10 +12,18 @@ import (
 	"strings"
 	"time"
 
+	"github.com/sunhuihui6688-star/ai-panel/pkg/audit"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/config"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/contact"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/cron"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/datastore"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/llm"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/memory"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/process"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/project"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/skill"
 	"github.com/sunhuihui6688-star/ai-panel/pkg/subagent"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/teammem"
 )
 
 // Handler executes a tool call and returns the result string.
@@ -37,6 +45,15 @@ type Registry struct {
 	serverBaseURL string                                         // base URL for generating download links (files > 50 MB)
 	authToken     string                                         // auth token for download link generation
 	envUpdater    func(key, value string, remove bool) error     // optional: lets the agent update its own env vars
+	webFetch      config.WebFetchConfig                          // web_fetch policy (SSRF guard, allowlist, UA, cache)
+	processSup    *process.Supervisor                            // background process supervisor (nil = no process tools)
+	auditLog      *audit.Logger                                  // tool-call audit trail (nil = not recorded)
+	cronEngine    *cron.Engine                                   // scheduler for cron_* tools (nil = not registered)
+	cronPolicy    config.CronConfig                              // job limits for cron_* tools
+	dataStore     *datastore.Store                               // per-agent kv_* / sql_query storage (nil = not registered)
+	contacts      *contact.Store                                 // per-agent contact_* profiles (nil = not registered)
+	senderOnly    bool                                           // contact_* limited to the current sender (public channels)
+	teamMem       *teammem.Store                                 // team-shared memory for team_memory_* (nil = not registered)
 }
 
 // AgentSummary is the minimal agent info exposed through the agent_list tool.
@@ -58,13 +75,16 @@ func New(workspaceDir, agentDir, agentID string) *Registry {
 		agentID:      agentID,
 	}
 	r.register(readToolDef, r.handleReadWS)
+	r.register(readDocumentToolDef, r.handleReadDocument)
 	r.register(writeToolDef, r.handleWriteWS)
 	r.register(editToolDef, r.handleEditWS)
+	r.register(applyPatchToolDef, r.handleApplyPatch)
 	r.register(bashToolDef, r.handleBashWS)
 	r.register(grepToolDef, r.handleGrepWS)
 	r.register(globToolDef, r.handleGlobWS)
-	r.register(webFetchToolDef, handleWebFetch)
+	r.register(webFetchToolDef, r.handleWebFetch)
 	r.register(showImageDef, func(ctx context.Context, input json.RawMessage) (string, error) { return handleShowImage(ctx, input) })
+	r.register(memorySearchToolDef, r.handleMemorySearch)
 	// Self-management tools (available to all agents)
 	r.register(selfListSkillsDef, r.handleSelfListSkills)
 	r.register(selfInstallSkillDef, r.handleSelfInstallSkill)
@@ -118,9 +138,10 @@ func NewSkillStudio(workspaceDir, agentDir, agentID, skillID string) *Registry {
 
 	// Read and search: allowed everywhere (read-only is safe)
 	r.register(readToolDef, r.handleReadWS)
+	r.register(readDocumentToolDef, r.handleReadDocument)
 	r.register(grepToolDef, r.handleGrepWS)
 	r.register(globToolDef, r.handleGlobWS)
-	r.register(webFetchToolDef, handleWebFetch)
+	r.register(webFetchToolDef, r.handleWebFetch)
 	r.register(showImageDef, func(ctx context.Context, input json.RawMessage) (string, error) { return handleShowImage(ctx, input) })
 	// List skills is read-only, allow it
 	r.register(selfListSkillsDef, r.handleSelfListSkills)
@@ -138,6 +159,20 @@ func (r *Registry) WithEnv(env map[string]string) {
 	r.agentEnv = env
 }
 
+// WithWebFetch sets the web_fetch policy (user agent, SSRF guard, domain
+// allowlist, cache TTL). Without it web_fetch runs with safe defaults.
+func (r *Registry) WithWebFetch(cfg config.WebFetchConfig) {
+	r.webFetch = cfg
+}
+
+// WithToolEntries registers the tools backed by global ToolEntry registry entries
+// that the agent has enabled via toolIDs: web_search (brave_search / searxng /
+// json_search) and declarative HTTP tools (custom).
+func (r *Registry) WithToolEntries(entries []config.ToolEntry, toolIDs []string) {
+	r.WithWebSearch(entries, toolIDs)
+	r.WithCustomTools(entries, toolIDs)
+}
+
 // WithSessionID records the current session ID so agent_spawn can include it
 // in SpawnOpts, enabling the NotifyFunc to deliver results back to this session.
 func (r *Registry) WithSessionID(id string) {
@@ -499,13 +534,19 @@ func (r *Registry) Definitions() []llm.ToolDef {
 	return r.defs
 }
 
-// Execute runs the named tool with the given input.
+// Execute runs the named tool with the given input; the call is recorded to
+// the audit log when one is configured.
 func (r *Registry) Execute(ctx context.Context, name string, input json.RawMessage) (string, error) {
+	start := time.Now()
 	h, ok := r.handlers[name]
 	if !ok {
-		return "", fmt.Errorf("unknown tool: %s", name)
+		err := fmt.Errorf("unknown tool: %s", name)
+		r.recordAudit(ctx, name, input, start, "", err)
+		return "", err
 	}
-	return h(ctx, input)
+	out, err := h(ctx, input)
+	r.recordAudit(ctx, name, input, start, out, err)
+	return out, err
 }
 
 func (r *Registry) register(def llm.ToolDef, h Handler) {
@@ -547,11 +588,45 @@ func (r *Registry) handleReadWS(ctx context.Context, input json.RawMessage) (str
 }
 
 func (r *Registry) handleWriteWS(ctx context.Context, input json.RawMessage) (string, error) {
-	return handleWrite(ctx, r.resolveFilePathInInput(input, "file_path"))
+	resolved := r.resolveFilePathInInput(input, "file_path")
+	var out string
+	err := r.trackWrite(filePathOf(resolved), "write", func() (err error) {
+		out, err = handleWrite(ctx, resolved)
+		return err
+	})
+	return out, err
 }
 
 func (r *Registry) handleEditWS(ctx context.Context, input json.RawMessage) (string, error) {
-	return handleEdit(ctx, r.resolveFilePathInInput(input, "file_path"))
+	resolved := r.resolveFilePathInInput(input, "file_path")
+	var out string
+	err := r.trackWrite(filePathOf(resolved), "edit", func() (err error) {
+		out, err = handleEdit(ctx, resolved)
+		return err
+	})
+	return out, err
+}
+
+// trackWrite runs write, which changes absPath, recording a memory version
+// when absPath is a versioned workspace file (memory/, IDENTITY.md, SOUL.md).
+func (r *Registry) trackWrite(absPath, tool string, write func() error) error {
+	if r.workspaceDir == "" || absPath == "" {
+		return write()
+	}
+	rel, err := filepath.Rel(r.workspaceDir, absPath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return write()
+	}
+	return memory.Track(r.workspaceDir, rel, memory.Author{Source: memory.SourceAgent, Detail: tool}, write)
+}
+
+// filePathOf returns the "file_path" field of a tool input, or "".
+func filePathOf(input json.RawMessage) string {
+	var p struct {
+		FilePath string `json:"file_path"`
+	}
+	_ = json.Unmarshal(input, &p)
+	return p.FilePath
 }
 
 func (r *Registry) handleGrepWS(ctx context.Context, input json.RawMessage) (string, error) {
@@ -611,12 +686,7 @@ func (r *Registry) handleBashWS(_ context.Context, input json.RawMessage) (strin
 
 	cmd := exec.CommandContext(ctx, "bash", "-c", command)
 
-	// Start with sanitized system env, then overlay agent-configured env vars
-	env := sanitizeEnv(os.Environ())
-	for k, v := range r.agentEnv {
-		env = append(env, k+"="+v)
-	}
-	cmd.Env = env
+	cmd.Env = r.execEnv()
 
 	out, err := cmd.CombinedOutput()
 	if err != nil {
@@ -625,6 +695,15 @@ func (r *Registry) handleBashWS(_ context.Context, input json.RawMessage) (strin
 	return string(out), nil
 }
 
+// execEnv returns the sanitized system env overlaid with agent-configured env vars.
+func (r *Registry) execEnv() []string {
+	env := sanitizeEnv(os.Environ())
+	for k, v := range r.agentEnv {
+		env = append(env, k+"="+v)
+	}
+	return env
+}
+
 // ── Self-Management Handlers ─────────────────────────────────────────────────
 
 func (r *Registry) handleSelfListSkills(_ context.Context, _ json.RawMessage) (string, error) {
@@ -734,7 +813,9 @@ func (r *Registry) handleSelfUpdateSoul(_ context.Context, input json.RawMessage
 		return "", err
 	}
 	soulPath := filepath.Join(r.workspaceDir, "SOUL.md")
-	if err := os.WriteFile(soulPath, []byte(p.Content), 0644); err != nil {
+	if err := r.trackWrite(soulPath, "self_update_soul", func() error {
+		return os.WriteFile(soulPath, []byte(p.Content), 0644)
+	}); err != nil {
 		return "", fmt.Errorf("write SOUL.md: %w", err)
 	}
 	return "SOUL.md 已更新", nil
@@ -0,0 +1,109 @@
+// search_history: full-text search over the agent's own past sessions and
+// memory files. Conversation logs stay admin-only.
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sunhuihui6688-star/ai-panel/pkg/llm"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/search"
+)
+
+// WithSearch registers search_history backed by the global search index.
+func (r *Registry) WithSearch(in *search.Indexer) {
+	if in == nil || r.agentID == "" {
+		return
+	}
+	r.register(llm.ToolDef{
+		Name: "search_history",
+		Description: "全文搜索你自己过去的对话记录和记忆文件，用于回忆之前和某人聊过什么、答应过什么。" +
+			"支持中英文关键词（多个词之间为“且”关系），可按来源、角色、渠道和日期过滤。",
+		InputSchema: json.RawMessage(`{
+			"type":"object",
+			"properties":{
+				"query":{"type":"string","description":"关键词，如：报价 企业版"},
+				"source":{"type":"string","enum":["session","memory"],"description":"只搜对话(session)或记忆(memory)，默认都搜"},
+				"role":{"type":"string","enum":["user","assistant"],"description":"只看用户或你自己的发言"},
+				"channel":{"type":"string","description":"渠道，如 telegram、web"},
+				"since":{"type":"string","description":"起始日期 YYYY-MM-DD"},
+				"until":{"type":"string","description":"截止日期 YYYY-MM-DD（含当天）"},
+				"limit":{"type":"integer","description":"返回条数（默认 10，最多 30）"}
+			},
+			"required":["query"]
+		}`),
+	}, func(_ context.Context, input json.RawMessage) (string, error) {
+		var p struct {
+			Query   string `json:"query"`
+			Source  string `json:"source"`
+			Role    string `json:"role"`
+			Channel string `json:"channel"`
+			Since   string `json:"since"`
+			Until   string `json:"until"`
+			Limit   int    `json:"limit"`
+		}
+		if err := json.Unmarshal(input, &p); err != nil {
+			return "", err
+		}
+		q := search.Query{
+			Text:    p.Query,
+			AgentID: r.agentID,
+			Role:    p.Role,
+			Channel: p.Channel,
+			Sources: []string{search.SourceSession, search.SourceMemory},
+			Limit:   p.Limit,
+		}
+		if p.Source == search.SourceSession || p.Source == search.SourceMemory {
+			q.Sources = []string{p.Source}
+		}
+		if q.Limit <= 0 {
+			q.Limit = 10
+		}
+		if q.Limit > 30 {
+			q.Limit = 30
+		}
+		var err error
+		if q.Since, err = parseDay(p.Since); err != nil {
+			return "", fmt.Errorf("invalid since: %w", err)
+		}
+		if q.Until, err = parseDay(p.Until); err != nil {
+			return "", fmt.Errorf("invalid until: %w", err)
+		}
+		if !q.Until.IsZero() {
+			q.Until = q.Until.AddDate(0, 0, 1)
+		}
+
+		in.RefreshIfStale(10 * time.Second)
+		hits, total, err := in.Index().Search(q)
+		if err != nil {
+			return "", err
+		}
+		if total == 0 {
+			return "没有找到相关记录。", nil
+		}
+		var sb strings.Builder
+		sb.WriteString(fmt.Sprintf("共 %d 条匹配，显示前 %d 条：\n", total, len(hits)))
+		for _, h := range hits {
+			when := time.UnixMilli(h.Timestamp).Format("2006-01-02 15:04")
+			switch h.Source {
+			case search.SourceMemory:
+				sb.WriteString(fmt.Sprintf("\n[%s] 记忆 %s\n", when, h.Path))
+			default:
+				sb.WriteString(fmt.Sprintf("\n[%s] %s · %s（会话 %s）\n", when, h.Channel, h.Role, h.SessionID))
+			}
+			sb.WriteString(search.Snippet(h.Text(), p.Query, 200, search.MarkText) + "\n")
+		}
+		return sb.String(), nil
+	})
+}
+
+// parseDay parses an optional YYYY-MM-DD date in local time.
+func parseDay(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.ParseInLocation("2006-01-02", s, time.Local)
+}
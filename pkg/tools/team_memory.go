@@ -0,0 +1,230 @@
+// team_memory_*: read, search and propose entries in the team-shared memory
+// space, and review proposals when the agent is an approver.
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sunhuihui6688-star/ai-panel/pkg/llm"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/memory"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/teammem"
+)
+
+// WithTeamMemory registers team_memory_read / team_memory_search /
+// team_memory_propose / team_memory_review. Permissions come from the
+// store's policy and are checked at execute time.
+func (r *Registry) WithTeamMemory(store *teammem.Store) {
+	if store == nil || r.agentID == "" {
+		return
+	}
+	r.WithTeamMemoryReadOnly(store)
+
+	r.register(llm.ToolDef{
+		Name: "team_memory_propose",
+		Description: "向团队共享记忆提交一条内容（需要写入权限）。适合所有成员都应知道的事实，如价格调整、流程变更、客户约定。" +
+			"开启审核时提交后需审核人批准才会生效。mode=append 追加到文件末尾（默认），replace 覆盖整个文件。",
+		InputSchema: json.RawMessage(`{
+			"type":"object",
+			"properties":{
+				"path":{"type":"string","description":"目标文件，如 topics/pricing.md"},
+				"content":{"type":"string","description":"要写入的内容（Markdown）"},
+				"mode":{"type":"string","enum":["append","replace"],"description":"append（默认）或 replace"},
+				"reason":{"type":"string","description":"提交原因或信息来源，便于审核"}
+			},
+			"required":["path","content"]
+		}`),
+	}, r.handleTeamMemoryPropose)
+
+	r.register(llm.ToolDef{
+		Name:        "team_memory_review",
+		Description: "审核团队记忆的待定提交（仅审核人可用）。action=list 列出待审核提交；approve 批准并生效；reject 拒绝。",
+		InputSchema: json.RawMessage(`{
+			"type":"object",
+			"properties":{
+				"action":{"type":"string","enum":["list","approve","reject"]},
+				"id":{"type":"string","description":"提交 ID（approve / reject 时必填）"},
+				"note":{"type":"string","description":"审核意见（可选）"}
+			},
+			"required":["action"]
+		}`),
+	}, r.handleTeamMemoryReview)
+}
+
+// WithTeamMemoryReadOnly registers only team_memory_read / team_memory_search,
+// for runs driven by untrusted users (public chat).
+func (r *Registry) WithTeamMemoryReadOnly(store *teammem.Store) {
+	if store == nil || r.agentID == "" {
+		return
+	}
+	r.teamMem = store
+
+	r.register(llm.ToolDef{
+		Name: "team_memory_read",
+		Description: "读取团队共享记忆（全体成员共用的知识库）。不传 path 时列出所有文件；传 path 读取文件内容，" +
+			"如 INDEX.md、topics/pricing.md。",
+		InputSchema: json.RawMessage(`{
+			"type":"object",
+			"properties":{"path":{"type":"string","description":"团队记忆内的文件路径（可选）"}}
+		}`),
+	}, r.handleTeamMemoryRead)
+
+	r.register(llm.ToolDef{
+		Name:        "team_memory_search",
+		Description: "在团队共享记忆中按语义和关键词检索，返回最相关的片段及文件路径。",
+		InputSchema: json.RawMessage(`{
+			"type":"object",
+			"properties":{
+				"query":{"type":"string","description":"要找的内容，如：最新的价格政策"},
+				"limit":{"type":"integer","description":"返回片段数（默认 5，最多 20）"}
+			},
+			"required":["query"]
+		}`),
+	}, r.handleTeamMemorySearch)
+}
+
+func (r *Registry) checkTeamRead() error {
+	if !r.teamMem.Policy().CanRead(r.agentID) {
+		return fmt.Errorf("你没有团队记忆的读取权限")
+	}
+	return nil
+}
+
+func (r *Registry) handleTeamMemoryRead(_ context.Context, input json.RawMessage) (string, error) {
+	if err := r.checkTeamRead(); err != nil {
+		return "", err
+	}
+	var p struct {
+		Path string `json:"path"`
+	}
+	if len(input) > 0 {
+		if err := json.Unmarshal(input, &p); err != nil {
+			return "", err
+		}
+	}
+	tree := r.teamMem.Tree(memory.Author{})
+	if strings.TrimSpace(p.Path) == "" {
+		nodes, err := tree.ListTree()
+		if err != nil {
+			return "", err
+		}
+		var sb strings.Builder
+		sb.WriteString("团队记忆文件：\n")
+		var walk func([]memory.FileNode)
+		walk = func(ns []memory.FileNode) {
+			for _, n := range ns {
+				if n.IsDir {
+					walk(n.Children)
+					continue
+				}
+				sb.WriteString(fmt.Sprintf("- %s（%d 字节）\n", n.Path, n.Size))
+			}
+		}
+		walk(nodes)
+		return sb.String(), nil
+	}
+	rel, err := teammem.CleanPath(p.Path)
+	if err != nil {
+		return "", err
+	}
+	content, err := tree.GetFile(rel)
+	if err != nil {
+		return "", fmt.Errorf("团队记忆文件 %s 不存在", rel)
+	}
+	return content, nil
+}
+
+func (r *Registry) handleTeamMemorySearch(ctx context.Context, input json.RawMessage) (string, error) {
+	if err := r.checkTeamRead(); err != nil {
+		return "", err
+	}
+	var p struct {
+		Query string `json:"query"`
+		Limit int    `json:"limit"`
+	}
+	if err := json.Unmarshal(input, &p); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(p.Query) == "" {
+		return "", fmt.Errorf("query is required")
+	}
+	p.Limit = min(max(p.Limit, 5), 20)
+	hits, err := r.teamMem.Search(ctx, p.Query, p.Limit)
+	if err != nil {
+		return "", err
+	}
+	if len(hits) == 0 {
+		return "团队记忆中没有找到相关内容。", nil
+	}
+	return "以下路径位于团队记忆中，用 team_memory_read 读取完整文件：\n\n" + FormatMemoryHits(hits, 600), nil
+}
+
+func (r *Registry) handleTeamMemoryPropose(_ context.Context, input json.RawMessage) (string, error) {
+	var p struct {
+		Path    string `json:"path"`
+		Content string `json:"content"`
+		Mode    string `json:"mode"`
+		Reason  string `json:"reason"`
+	}
+	if err := json.Unmarshal(input, &p); err != nil {
+		return "", err
+	}
+	prop, err := r.teamMem.Propose(r.agentID, p.Path, p.Mode, p.Content, p.Reason)
+	if err != nil {
+		return "", err
+	}
+	if prop.Status == teammem.StatusPending {
+		return fmt.Sprintf("📝 已提交（ID: %s），等待审核人批准后生效", prop.ID), nil
+	}
+	return fmt.Sprintf("✅ 已写入团队记忆 %s", prop.Path), nil
+}
+
+func (r *Registry) handleTeamMemoryReview(_ context.Context, input json.RawMessage) (string, error) {
+	var p struct {
+		Action string `json:"action"`
+		ID     string `json:"id"`
+		Note   string `json:"note"`
+	}
+	if err := json.Unmarshal(input, &p); err != nil {
+		return "", err
+	}
+	if !r.teamMem.Policy().CanApprove(r.agentID) {
+		return "", fmt.Errorf("你不是团队记忆的审核人")
+	}
+	switch p.Action {
+	case "list":
+		list, err := r.teamMem.Proposals(teammem.StatusPending)
+		if err != nil {
+			return "", err
+		}
+		if len(list) == 0 {
+			return "没有待审核的提交。", nil
+		}
+		var sb strings.Builder
+		for _, prop := range list {
+			sb.WriteString(fmt.Sprintf("[%s] %s %s（来自 %s，%s）\n", prop.ID, prop.Mode, prop.Path, prop.AgentID,
+				time.UnixMilli(prop.CreatedAt).Format("2006-01-02 15:04")))
+			if prop.Reason != "" {
+				sb.WriteString("  原因: " + prop.Reason + "\n")
+			}
+			sb.WriteString("  内容: " + truncateUTF8(prop.Content, 500) + "\n")
+		}
+		return sb.String(), nil
+	case "approve", "reject":
+		if p.ID == "" {
+			return "", fmt.Errorf("id is required")
+		}
+		prop, err := r.teamMem.Review(p.ID, r.agentID, p.Action == "approve", p.Note)
+		if err != nil {
+			return "", err
+		}
+		if prop.Status == teammem.StatusApplied {
+			return fmt.Sprintf("✅ 已批准，%s 已更新", prop.Path), nil
+		}
+		return "已拒绝提交 " + prop.ID, nil
+	}
+	return "", fmt.Errorf("unknown action %q", p.Action)
+}
@@ -6,8 +6,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
@@ -267,46 +265,6 @@ func handleGlob(_ context.Context, input json.RawMessage) (string, error) {
 	return strings.Join(matches, "\n"), nil
 }
 
-// ── Web Fetch ────────────────────────────────────────────────────────────────
-
-var webFetchToolDef = lllm.ToolDef{
-	Name:        "web_fetch",
-	Description: "Fetch and extract readable content from a URL.",
-	InputSchema: json.RawMessage(`{
-		"type":"object",
-		"properties":{
-			"url":{"type":"string"},
-			"max_chars":{"type":"number"}
-		},
-		"required":["url"]
-	}`),
-}
-
-func handleWebFetch(_ context.Context, input json.RawMessage) (string, error) {
-	var p struct {
-		URL      string `json:"url"`
-		MaxChars int    `json:"max_chars"`
-	}
-	if err := json.Unmarshal(input, &p); err != nil {
-		return "", err
-	}
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Get(p.URL)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-	maxChars := p.MaxChars
-	if maxChars <= 0 {
-		maxChars = 50000
-	}
-	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(maxChars)))
-	if err != nil {
-		return "", err
-	}
-	return string(body), nil
-}
-
 // ── Self-Management Tools ────────────────────────────────────────────────────
 // These tools let an agent manage its own skills, name, and soul.
 
@@ -0,0 +1,410 @@
+// web_fetch: readable page extraction with an SSRF guard, domain allowlist and cache.
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/html/charset"
+
+	"github.com/sunhuihui6688-star/ai-panel/pkg/config"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/document"
+	lllm "github.com/sunhuihui6688-star/ai-panel/pkg/llm"
+)
+
+const (
+	webFetchDefaultUA   = "Mozilla/5.0 (compatible; ZyHive-WebFetch/1.0)"
+	webFetchMaxBody     = 10 << 20 // bytes downloaded at most
+	webFetchMaxRedirect = 5
+	webFetchDefaultTTL  = 15 * time.Minute
+	webFetchCacheSize   = 128
+)
+
+var webFetchToolDef = lllm.ToolDef{
+	Name: "web_fetch",
+	Description: "Fetch a URL and return its readable content. HTML pages are reduced to their main content as Markdown; " +
+		"JSON and plain text are returned as-is; PDF/DOCX/XLSX/PPTX documents are converted to Markdown and saved to the workspace. Private/internal addresses are blocked.",
+	InputSchema: json.RawMessage(`{
+		"type":"object",
+		"properties":{
+			"url":{"type":"string","description":"http(s) URL to fetch"},
+			"max_chars":{"type":"number","description":"Maximum characters to return (default 50000)"},
+			"raw":{"type":"boolean","description":"Return the raw response body instead of extracted Markdown (text types only)"}
+		},
+		"required":["url"]
+	}`),
+}
+
+// fetchedPage is the processed result of a fetch, cached by URL.
+type fetchedPage struct {
+	FinalURL    string
+	ContentType string
+	Title       string
+	Content     string // extracted Markdown / text
+	Raw         string // decoded body for text types
+	fetchedAt   time.Time
+	cacheable   bool // false for results tied to one workspace (saved downloads)
+}
+
+var webFetchCache = struct {
+	sync.Mutex
+	pages map[string]*fetchedPage
+}{pages: make(map[string]*fetchedPage)}
+
+// storeFetchedPage caches a page, evicting expired entries (or the oldest one) when full.
+func storeFetchedPage(key string, page *fetchedPage, ttl time.Duration) {
+	webFetchCache.Lock()
+	defer webFetchCache.Unlock()
+	if len(webFetchCache.pages) >= webFetchCacheSize {
+		oldestKey, oldest := "", time.Now()
+		for k, v := range webFetchCache.pages {
+			if time.Since(v.fetchedAt) >= ttl {
+				delete(webFetchCache.pages, k)
+			} else if v.fetchedAt.Before(oldest) {
+				oldestKey, oldest = k, v.fetchedAt
+			}
+		}
+		if len(webFetchCache.pages) >= webFetchCacheSize {
+			delete(webFetchCache.pages, oldestKey)
+		}
+	}
+	webFetchCache.pages[key] = page
+}
+
+func (r *Registry) handleWebFetch(ctx context.Context, input json.RawMessage) (string, error) {
+	var p struct {
+		URL      string `json:"url"`
+		MaxChars int    `json:"max_chars"`
+		Raw      bool   `json:"raw"`
+	}
+	if err := json.Unmarshal(input, &p); err != nil {
+		return "", err
+	}
+	maxChars := p.MaxChars
+	if maxChars <= 0 {
+		maxChars = 50000
+	}
+
+	page, err := r.fetchPage(ctx, p.URL)
+	if err != nil {
+		return "", err
+	}
+
+	body := page.Content
+	if p.Raw && page.Raw != "" {
+		body = page.Raw
+	}
+	if total := len(body); total > maxChars {
+		body = truncateUTF8(body, maxChars) + fmt.Sprintf("\n\n[已截断：共 %d 字符，可用 max_chars 调整]", total)
+	}
+	var sb strings.Builder
+	sb.WriteString("URL: " + page.FinalURL + "\n")
+	if page.Title != "" {
+		sb.WriteString("Title: " + page.Title + "\n")
+	}
+	sb.WriteString("Content-Type: " + page.ContentType + "\n\n")
+	sb.WriteString(body)
+	return sb.String(), nil
+}
+
+// fetchPage downloads and processes a URL, consulting the cache first.
+func (r *Registry) fetchPage(ctx context.Context, rawURL string) (*fetchedPage, error) {
+	policy := r.webFetch
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid URL %q: only http(s) URLs are supported", rawURL)
+	}
+	if err := checkFetchHost(u, policy); err != nil {
+		return nil, err
+	}
+
+	ttl := webFetchDefaultTTL
+	if policy.CacheTTLSec > 0 {
+		ttl = time.Duration(policy.CacheTTLSec) * time.Second
+	}
+	// Pages are shared between agents only under the same host policy, since
+	// redirects were checked against the policy of whoever fetched first.
+	cacheKey := fmt.Sprintf("%t|%s|%s", policy.AllowPrivate, domainPolicyKey(policy.AllowedDomains), u.String())
+	if policy.CacheTTLSec >= 0 {
+		webFetchCache.Lock()
+		cached, ok := webFetchCache.pages[cacheKey]
+		webFetchCache.Unlock()
+		if ok && time.Since(cached.fetchedAt) < ttl {
+			if final, err := url.Parse(cached.FinalURL); err == nil && checkFetchHost(final, policy) == nil {
+				return cached, nil
+			}
+		}
+	}
+
+	client := newFetchClient(policy)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	ua := policy.UserAgent
+	if ua == "" {
+		ua = webFetchDefaultUA
+	}
+	req.Header.Set("User-Agent", ua)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/json,text/plain;q=0.9,*/*;q=0.8")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 500))
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(snippet)))
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, webFetchMaxBody))
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := r.processBody(resp, data)
+	if err != nil {
+		return nil, err
+	}
+	page.fetchedAt = time.Now()
+
+	if policy.CacheTTLSec >= 0 && page.cacheable {
+		storeFetchedPage(cacheKey, page, ttl)
+	}
+	return page, nil
+}
+
+// processBody converts a response body into readable text according to its content type.
+func (r *Registry) processBody(resp *http.Response, data []byte) (*fetchedPage, error) {
+	finalURL := resp.Request.URL
+	ct := resp.Header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(ct)
+	if mediaType == "" || mediaType == "application/octet-stream" {
+		mediaType, _, _ = mime.ParseMediaType(http.DetectContentType(data))
+	}
+	page := &fetchedPage{FinalURL: finalURL.String(), ContentType: mediaType, cacheable: true}
+
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		decoded, err := decodeCharset(data, ct)
+		if err != nil {
+			return nil, err
+		}
+		title, md, err := HTMLToMarkdown(strings.NewReader(decoded), finalURL)
+		if err != nil {
+			return nil, fmt.Errorf("parse html: %w", err)
+		}
+		page.Title, page.Content, page.Raw = title, md, decoded
+
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		var buf bytes.Buffer
+		if json.Indent(&buf, data, "", "  ") == nil {
+			page.Content = buf.String()
+		} else {
+			page.Content = string(data)
+		}
+		page.Raw = string(data)
+
+	case strings.HasPrefix(mediaType, "text/") || mediaType == "application/xml" || strings.HasSuffix(mediaType, "+xml"):
+		decoded, err := decodeCharset(data, ct)
+		if err != nil {
+			return nil, err
+		}
+		page.Content, page.Raw = decoded, decoded
+
+	case document.DetectFormat(finalURL.Path, mediaType) != "":
+		// PDF / Office documents: save the original so read_document can page
+		// through it later, and return the extracted text right away.
+		format := document.DetectFormat(finalURL.Path, mediaType)
+		saved, err := r.saveDownload(finalURL, data, "."+string(format))
+		if err != nil {
+			return nil, err
+		}
+		page.cacheable = false
+		doc, err := document.Extract(data, format, document.Options{})
+		if err != nil || doc.Empty() {
+			page.Content = fmt.Sprintf("%s 文档（%.1f KB）已保存到工作区：%s（未能提取文本）",
+				strings.ToUpper(string(format)), float64(len(data))/1024, saved)
+			break
+		}
+		page.Content = doc.Markdown() + fmt.Sprintf("\n\n（原文件已保存到 %s，共 %d 页，可用 read_document 按页读取）", saved, doc.TotalPages)
+
+	default:
+		page.Content = fmt.Sprintf("二进制内容（%s，%.1f KB），未返回正文。", mediaType, float64(len(data))/1024)
+	}
+	return page, nil
+}
+
+// saveDownload stores a fetched binary document under workspace/downloads/.
+func (r *Registry) saveDownload(u *url.URL, data []byte, ext string) (string, error) {
+	if r.workspaceDir == "" {
+		return "", fmt.Errorf("no workspace to save download")
+	}
+	name := path.Base(u.Path)
+	if name == "" || name == "/" || name == "." {
+		name = "download"
+	}
+	name = toolNameSanitizer.ReplaceAllString(strings.TrimSuffix(name, filepath.Ext(name)), "_")
+	dir := filepath.Join(r.workspaceDir, "downloads")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	// Never overwrite an earlier download: name.pdf, name-1.pdf, name-2.pdf, ...
+	for i := 0; ; i++ {
+		dest := filepath.Join(dir, name+ext)
+		if i > 0 {
+			dest = filepath.Join(dir, fmt.Sprintf("%s-%d%s", name, i, ext))
+		}
+		f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		_, err = f.Write(data)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return "", err
+		}
+		return dest, nil
+	}
+}
+
+// decodeCharset converts the body to UTF-8 using the Content-Type header,
+// <meta charset> or content sniffing.
+func decodeCharset(data []byte, contentType string) (string, error) {
+	rd, err := charset.NewReader(bytes.NewReader(data), contentType)
+	if err != nil {
+		return string(data), nil
+	}
+	out, err := io.ReadAll(rd)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// ── SSRF guard / allowlist ───────────────────────────────────────────────────
+
+// newFetchClient returns an HTTP client that re-checks every redirect hop
+// against the policy and refuses to dial private addresses.
+func newFetchClient(policy config.WebFetchConfig) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if !policy.AllowPrivate {
+		// Checked at connect time, after DNS resolution, so rebinding tricks are covered too.
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip != nil && isPrivateIP(ip) {
+				return fmt.Errorf("web_fetch: blocked private address %s", host)
+			}
+			return nil
+		}
+	}
+	transport := &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 20 * time.Second,
+	}
+	return &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= webFetchMaxRedirect {
+				return fmt.Errorf("stopped after %d redirects", webFetchMaxRedirect)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+			}
+			return checkFetchHost(req.URL, policy)
+		},
+	}
+}
+
+// checkFetchHost enforces the domain allowlist and rejects literal private IPs
+// and well-known internal host names before any connection is made.
+func checkFetchHost(u *url.URL, policy config.WebFetchConfig) error {
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if len(policy.AllowedDomains) > 0 && !domainAllowed(host, policy.AllowedDomains) {
+		return fmt.Errorf("web_fetch: host %q is not in this agent's allowed domains", host)
+	}
+	if policy.AllowPrivate {
+		return nil
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") || strings.HasSuffix(host, ".internal") || host == "metadata.google.internal" {
+		return fmt.Errorf("web_fetch: blocked internal host %q", host)
+	}
+	if ip := net.ParseIP(host); ip != nil && isPrivateIP(ip) {
+		return fmt.Errorf("web_fetch: blocked private address %s", host)
+	}
+	return nil
+}
+
+// domainPolicyKey normalises an allowlist for use in cache keys.
+func domainPolicyKey(allowed []string) string {
+	keys := make([]string, 0, len(allowed))
+	for _, d := range allowed {
+		if d = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(d), "*.")); d != "" {
+			keys = append(keys, d)
+		}
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+func domainAllowed(host string, allowed []string) bool {
+	for _, d := range allowed {
+		d = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(d), "*."))
+		if d != "" && (host == d || strings.HasSuffix(host, "."+d)) {
+			return true
+		}
+	}
+	return false
+}
+
+var cgnatNet = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// isPrivateIP reports loopback, RFC 1918 / ULA, link-local (incl. cloud
+// metadata 169.254.169.254), CGNAT, unspecified and multicast addresses.
+func isPrivateIP(ip net.IP) bool {
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+		if v4[0] == 0 || cgnatNet.Contains(v4) {
+			return true
+		}
+	}
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified()
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a multi-byte rune.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && (s[n]&0xC0) == 0x80 {
+		n--
+	}
+	return s[:n]
+}
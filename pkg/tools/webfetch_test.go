@@ -0,0 +1,146 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sunhuihui6688-star/ai-panel/pkg/config"
+)
+
+func TestWebFetchBlocksPrivateAddresses(t *testing.T) {
+	r := New(t.TempDir(), t.TempDir(), "agent1")
+	for _, u := range []string{
+		"http://169.254.169.254/latest/meta-data/",
+		"http://localhost:8080/api/agents",
+		"http://10.0.0.1/",
+		"http://[::1]/",
+		"file:///etc/passwd",
+	} {
+		in, _ := json.Marshal(map[string]string{"url": u})
+		if _, err := r.Execute(context.Background(), "web_fetch", in); err == nil {
+			t.Errorf("%s: expected to be blocked", u)
+		}
+	}
+
+	// Redirects into private space are blocked at dial time as well.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("internal"))
+	}))
+	defer srv.Close()
+	in, _ := json.Marshal(map[string]string{"url": srv.URL})
+	if _, err := r.Execute(context.Background(), "web_fetch", in); err == nil {
+		t.Error("loopback test server should be blocked by default")
+	}
+}
+
+func TestWebFetchExtractsMarkdown(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/moved" {
+			http.Redirect(w, req, "/page", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=iso-8859-1")
+		// "Café" encoded as Latin-1
+		_, _ = w.Write([]byte("<html><head><title>Caf\xe9</title><script>var x=1</script></head><body>" +
+			"<nav><a href='/'>Home</a></nav>" +
+			"<article><h1>Caf\xe9 guide</h1><p>Some <b>bold</b> text with a <a href='/more'>link</a>.</p>" +
+			"<ul><li>one</li><li>two</li></ul>" + strings.Repeat("<p>filler paragraph text</p>", 10) + "</article>" +
+			"<footer>copyright</footer></body></html>"))
+	}))
+	defer srv.Close()
+
+	r := New(t.TempDir(), t.TempDir(), "agent1")
+	r.WithWebFetch(config.WebFetchConfig{AllowPrivate: true, CacheTTLSec: -1})
+	in, _ := json.Marshal(map[string]string{"url": srv.URL + "/moved"})
+	out, err := r.Execute(context.Background(), "web_fetch", in)
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	for _, want := range []string{"Title: Café", "# Café guide", "**bold**", "[link](" + srv.URL + "/more)", "- one", "URL: " + srv.URL + "/page"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	for _, bad := range []string{"var x", "copyright", "Home"} {
+		if strings.Contains(out, bad) {
+			t.Errorf("output should not contain %q:\n%s", bad, out)
+		}
+	}
+
+	r.WithWebFetch(config.WebFetchConfig{AllowPrivate: true, AllowedDomains: []string{"example.com"}})
+	if _, err := r.Execute(context.Background(), "web_fetch", in); err == nil {
+		t.Error("host outside allowedDomains should be rejected")
+	}
+}
+
+func TestWebFetchTruncationAndDownloads(t *testing.T) {
+	page := "<html><body><article><p>" + strings.Repeat("word ", 400) + "</p></article></body></html>"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(page))
+	}))
+	defer srv.Close()
+
+	ws := t.TempDir()
+	r := New(ws, t.TempDir(), "agent1")
+	r.WithWebFetch(config.WebFetchConfig{AllowPrivate: true, CacheTTLSec: -1})
+	in, _ := json.Marshal(map[string]any{"url": srv.URL, "raw": true, "max_chars": 100})
+	out, err := r.Execute(context.Background(), "web_fetch", in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("共 %d 字符", len(page)); !strings.Contains(out, want) {
+		t.Errorf("raw truncation note should report %q:\n%s", want, out)
+	}
+
+	u, _ := url.Parse(srv.URL + "/files/report.pdf")
+	first, err := r.saveDownload(u, []byte("one"), ".pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := r.saveDownload(u, []byte("two"), ".pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second || filepath.Base(second) != "report-1.pdf" {
+		t.Fatalf("downloads = %s, %s", first, second)
+	}
+	if data, _ := os.ReadFile(first); string(data) != "one" {
+		t.Errorf("first download overwritten: %q", data)
+	}
+}
+
+func TestWebFetchCacheRespectsDomainPolicy(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/go" {
+			u, _ := url.Parse(srv.URL)
+			http.Redirect(w, req, "http://localhost:"+u.Port()+"/page", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("secret page"))
+	}))
+	defer srv.Close()
+	in, _ := json.Marshal(map[string]string{"url": srv.URL + "/go"})
+
+	a := New(t.TempDir(), t.TempDir(), "a")
+	a.WithWebFetch(config.WebFetchConfig{AllowPrivate: true, AllowedDomains: []string{"127.0.0.1", "localhost"}})
+	if out, err := a.Execute(context.Background(), "web_fetch", in); err != nil || !strings.Contains(out, "secret page") {
+		t.Fatalf("agent a: %q, %v", out, err)
+	}
+
+	b := New(t.TempDir(), t.TempDir(), "b")
+	b.WithWebFetch(config.WebFetchConfig{AllowPrivate: true, AllowedDomains: []string{"127.0.0.1"}})
+	if out, err := b.Execute(context.Background(), "web_fetch", in); err == nil {
+		t.Fatalf("agent b followed a redirect outside its allowlist via the cache: %q", out)
+	}
+}
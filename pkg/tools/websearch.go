@@ -0,0 +1,355 @@
+// web_search tool with pluggable search providers (Brave, SearXNG, generic JSON).
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sunhuihui6688-star/ai-panel/pkg/config"
+	"github.com/sunhuihui6688-star/ai-panel/pkg/llm"
+)
+
+// SearchResult is one normalised web search hit.
+type SearchResult struct {
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+	Snippet string `json:"snippet"`
+}
+
+// SearchOptions controls a single search request.
+type SearchOptions struct {
+	Count     int    // number of results wanted (1-20)
+	Freshness string // "" | "day" | "week" | "month" | "year"
+}
+
+// SearchProvider is a web search backend.
+type SearchProvider interface {
+	Name() string
+	Search(ctx context.Context, query string, opts SearchOptions) ([]SearchResult, error)
+}
+
+// searchToolTypes lists the ToolEntry types that can back the web_search tool.
+var searchToolTypes = []string{"brave_search", "searxng", "json_search"}
+
+// IsSearchToolType reports whether a ToolEntry type is a web search provider.
+func IsSearchToolType(typ string) bool {
+	for _, t := range searchToolTypes {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// NewSearchProvider builds the search provider described by a ToolEntry.
+// BaseURL overrides the provider endpoint, which also allows pointing at a local stand-in server.
+func NewSearchProvider(entry config.ToolEntry) (SearchProvider, error) {
+	client := &http.Client{Timeout: 20 * time.Second}
+	switch entry.Type {
+	case "brave_search":
+		if entry.APIKey == "" {
+			return nil, fmt.Errorf("brave_search: apiKey is required")
+		}
+		base := entry.BaseURL
+		if base == "" {
+			base = "https://api.search.brave.com/res/v1/web/search"
+		}
+		return &braveSearch{endpoint: base, apiKey: entry.APIKey, client: client}, nil
+	case "searxng":
+		if entry.BaseURL == "" {
+			return nil, fmt.Errorf("searxng: baseUrl is required")
+		}
+		return &searxngSearch{baseURL: strings.TrimRight(entry.BaseURL, "/"), apiKey: entry.APIKey, client: client}, nil
+	case "json_search":
+		if entry.BaseURL == "" {
+			return nil, fmt.Errorf("json_search: baseUrl is required")
+		}
+		return &jsonSearch{endpoint: entry.BaseURL, apiKey: entry.APIKey, opts: entry.Config, client: client}, nil
+	}
+	return nil, fmt.Errorf("unsupported search provider type %q", entry.Type)
+}
+
+var webSearchToolDef = llm.ToolDef{
+	Name:        "web_search",
+	Description: "Search the web. Returns a list of results with title, URL and snippet. Use web_fetch to read a result page.",
+	InputSchema: json.RawMessage(`{
+		"type":"object",
+		"properties":{
+			"query":{"type":"string","description":"Search query"},
+			"count":{"type":"number","description":"Number of results (1-20, default 5)"},
+			"freshness":{"type":"string","enum":["day","week","month","year"],"description":"Only return results published within this period (optional)"}
+		},
+		"required":["query"]
+	}`),
+}
+
+// WithWebSearch registers the web_search tool backed by the first enabled
+// search provider entry listed in the agent's toolIDs.
+func (r *Registry) WithWebSearch(entries []config.ToolEntry, toolIDs []string) {
+	for _, typ := range searchToolTypes {
+		for _, e := range selectToolEntries(entries, toolIDs, typ) {
+			provider, err := NewSearchProvider(e)
+			if err != nil {
+				continue
+			}
+			r.register(webSearchToolDef, func(ctx context.Context, input json.RawMessage) (string, error) {
+				return handleWebSearch(ctx, provider, input)
+			})
+			return
+		}
+	}
+}
+
+func handleWebSearch(ctx context.Context, provider SearchProvider, input json.RawMessage) (string, error) {
+	var p struct {
+		Query     string `json:"query"`
+		Count     int    `json:"count"`
+		Freshness string `json:"freshness"`
+	}
+	if err := json.Unmarshal(input, &p); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(p.Query) == "" {
+		return "", fmt.Errorf("query is required")
+	}
+	results, err := provider.Search(ctx, p.Query, SearchOptions{Count: p.Count, Freshness: p.Freshness})
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", provider.Name(), err)
+	}
+	return FormatSearchResults(results), nil
+}
+
+// FormatSearchResults renders results as a numbered Markdown list for the model.
+func FormatSearchResults(results []SearchResult) string {
+	if len(results) == 0 {
+		return "（没有搜索结果）"
+	}
+	var sb strings.Builder
+	for i, res := range results {
+		sb.WriteString(fmt.Sprintf("%d. **%s**\n   %s\n", i+1, res.Title, res.URL))
+		if res.Snippet != "" {
+			sb.WriteString("   " + res.Snippet + "\n")
+		}
+	}
+	return sb.String()
+}
+
+func (o SearchOptions) count() int {
+	switch {
+	case o.Count <= 0:
+		return 5
+	case o.Count > 20:
+		return 20
+	}
+	return o.Count
+}
+
+// ── Brave ────────────────────────────────────────────────────────────────────
+
+type braveSearch struct {
+	endpoint string
+	apiKey   string
+	client   *http.Client
+}
+
+func (b *braveSearch) Name() string { return "brave_search" }
+
+func (b *braveSearch) Search(ctx context.Context, query string, opts SearchOptions) ([]SearchResult, error) {
+	q := url.Values{}
+	q.Set("q", query)
+	q.Set("count", strconv.Itoa(opts.count()))
+	if f, ok := map[string]string{"day": "pd", "week": "pw", "month": "pm", "year": "py"}[opts.Freshness]; ok {
+		q.Set("freshness", f)
+	}
+	var resp struct {
+		Web struct {
+			Results []struct {
+				Title       string `json:"title"`
+				URL         string `json:"url"`
+				Description string `json:"description"`
+			} `json:"results"`
+		} `json:"web"`
+	}
+	headers := map[string]string{"X-Subscription-Token": b.apiKey}
+	if err := getSearchJSON(ctx, b.client, b.endpoint, q, headers, &resp); err != nil {
+		return nil, err
+	}
+	out := make([]SearchResult, 0, len(resp.Web.Results))
+	for _, r := range resp.Web.Results {
+		out = append(out, SearchResult{Title: r.Title, URL: r.URL, Snippet: stripTags(r.Description)})
+	}
+	return out, nil
+}
+
+// ── SearXNG ──────────────────────────────────────────────────────────────────
+
+type searxngSearch struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+func (s *searxngSearch) Name() string { return "searxng" }
+
+func (s *searxngSearch) Search(ctx context.Context, query string, opts SearchOptions) ([]SearchResult, error) {
+	q := url.Values{}
+	q.Set("q", query)
+	q.Set("format", "json")
+	if opts.Freshness != "" {
+		q.Set("time_range", opts.Freshness)
+	}
+	var resp struct {
+		Results []struct {
+			Title   string `json:"title"`
+			URL     string `json:"url"`
+			Content string `json:"content"`
+		} `json:"results"`
+	}
+	var headers map[string]string
+	if s.apiKey != "" {
+		headers = map[string]string{"Authorization": "Bearer " + s.apiKey}
+	}
+	if err := getSearchJSON(ctx, s.client, s.baseURL+"/search", q, headers, &resp); err != nil {
+		return nil, err
+	}
+	out := make([]SearchResult, 0, opts.count())
+	for _, r := range resp.Results {
+		if len(out) >= opts.count() {
+			break
+		}
+		out = append(out, SearchResult{Title: r.Title, URL: r.URL, Snippet: r.Content})
+	}
+	return out, nil
+}
+
+// ── Generic JSON endpoint ────────────────────────────────────────────────────
+
+// jsonSearch queries an arbitrary JSON search API. Options (ToolEntry.Config):
+//
+//	queryParam / countParam / freshnessParam — query string names (default q / count / freshness)
+//	resultsPath — JSONPath to the result array (default "$.results")
+//	titleField / urlField / snippetField — field names in each result (default title / url / snippet)
+//	authHeader — header carrying the API key (default "Authorization: Bearer <key>")
+type jsonSearch struct {
+	endpoint string
+	apiKey   string
+	opts     map[string]string
+	client   *http.Client
+}
+
+func (j *jsonSearch) Name() string { return "json_search" }
+
+func (j *jsonSearch) opt(key, def string) string {
+	if v := j.opts[key]; v != "" {
+		return v
+	}
+	return def
+}
+
+func (j *jsonSearch) Search(ctx context.Context, query string, opts SearchOptions) ([]SearchResult, error) {
+	q := url.Values{}
+	q.Set(j.opt("queryParam", "q"), query)
+	q.Set(j.opt("countParam", "count"), strconv.Itoa(opts.count()))
+	if opts.Freshness != "" {
+		q.Set(j.opt("freshnessParam", "freshness"), opts.Freshness)
+	}
+	headers := map[string]string{}
+	if j.apiKey != "" {
+		if h := j.opts["authHeader"]; h != "" {
+			headers[h] = j.apiKey
+		} else {
+			headers["Authorization"] = "Bearer " + j.apiKey
+		}
+	}
+	var doc any
+	if err := getSearchJSON(ctx, j.client, j.endpoint, q, headers, &doc); err != nil {
+		return nil, err
+	}
+	v, err := evalJSONPath(doc, j.opt("resultsPath", "$.results"))
+	if err != nil {
+		return nil, err
+	}
+	items, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("resultsPath does not point to an array")
+	}
+	field := func(m map[string]any, key string) string {
+		s, _ := m[key].(string)
+		return s
+	}
+	titleKey, urlKey, snippetKey := j.opt("titleField", "title"), j.opt("urlField", "url"), j.opt("snippetField", "snippet")
+	out := make([]SearchResult, 0, opts.count())
+	for _, it := range items {
+		m, ok := it.(map[string]any)
+		if !ok {
+			continue
+		}
+		if len(out) >= opts.count() {
+			break
+		}
+		out = append(out, SearchResult{Title: field(m, titleKey), URL: field(m, urlKey), Snippet: field(m, snippetKey)})
+	}
+	return out, nil
+}
+
+// getSearchJSON performs a GET request and decodes the JSON response into v.
+func getSearchJSON(ctx context.Context, client *http.Client, endpoint string, q url.Values, headers map[string]string, v any) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+	merged := u.Query()
+	for k, vals := range q {
+		merged[k] = vals
+	}
+	u.RawQuery = merged.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, val := range headers {
+		req.Header.Set(k, val)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 2<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, truncate(string(body), 300))
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+// stripTags removes simple inline HTML markup (Brave wraps matches in <strong>).
+func stripTags(s string) string {
+	var sb strings.Builder
+	inTag := false
+	for _, r := range s {
+		switch {
+		case r == '<':
+			inTag = true
+		case r == '>' && inTag:
+			inTag = false
+		case !inTag:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,63 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sunhuihui6688-star/ai-panel/pkg/config"
+)
+
+func TestSearchProviders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch r.URL.Path {
+		case "/brave":
+			if r.Header.Get("X-Subscription-Token") != "k" || q.Get("freshness") != "pw" || q.Get("count") != "2" {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			_, _ = w.Write([]byte(`{"web":{"results":[{"title":"Go","url":"https://go.dev","description":"The <strong>Go</strong> language"}]}}`))
+		case "/search":
+			if q.Get("format") != "json" || q.Get("time_range") != "week" {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			_, _ = w.Write([]byte(`{"results":[{"title":"Go","url":"https://go.dev","content":"The Go language"},{"title":"x","url":"y","content":"z"},{"title":"dropped"}]}`))
+		case "/json":
+			_, _ = w.Write([]byte(`{"data":{"hits":[{"name":"Go","link":"https://go.dev","text":"The Go language"}]}}`))
+		}
+	}))
+	defer srv.Close()
+
+	entries := []config.ToolEntry{
+		{ID: "brave", Type: "brave_search", APIKey: "k", BaseURL: srv.URL + "/brave", Enabled: true},
+		{ID: "searx", Type: "searxng", BaseURL: srv.URL, Enabled: true},
+		{ID: "generic", Type: "json_search", BaseURL: srv.URL + "/json", Enabled: true, Config: map[string]string{
+			"resultsPath": "$.data.hits", "titleField": "name", "urlField": "link", "snippetField": "text",
+		}},
+	}
+	for _, e := range entries {
+		p, err := NewSearchProvider(e)
+		if err != nil {
+			t.Fatalf("%s: %v", e.ID, err)
+		}
+		res, err := p.Search(context.Background(), "golang", SearchOptions{Count: 2, Freshness: "week"})
+		if err != nil {
+			t.Fatalf("%s: %v", e.ID, err)
+		}
+		if len(res) == 0 || len(res) > 2 || res[0].Title != "Go" || res[0].URL != "https://go.dev" || res[0].Snippet != "The Go language" {
+			t.Errorf("%s: unexpected results %+v", e.ID, res)
+		}
+	}
+
+	r := New(t.TempDir(), t.TempDir(), "agent1")
+	r.WithToolEntries(entries, []string{"searx"})
+	out, err := r.Execute(context.Background(), "web_search", json.RawMessage(`{"query":"golang","freshness":"week"}`))
+	if err != nil || !strings.Contains(out, "https://go.dev") {
+		t.Errorf("web_search via registry: %q, %v", out, err)
+	}
+}
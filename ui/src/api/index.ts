@@ -35,6 +35,8 @@ export interface AgentInfo {
   status: string
   workspaceDir: string
   env?: Record<string, string>  // per-agent env vars for exec tool
+  retention?: RetentionPolicy   // per-agent session retention override
+  compaction?: CompactionPolicy // per-agent context compaction override
 }
 
 export interface ModelEntry {
@@ -46,6 +48,7 @@ export interface ModelEntry {
   baseUrl?: string
   isDefault: boolean
   status: string // "ok" | "error" | "untested"
+  contextWindow?: number // tokens; sets the default compaction threshold
 }
 
 export interface ProbeModelInfo {
@@ -104,15 +107,56 @@ export interface FileNode {
   children?: FileNode[]
 }
 
+export interface CronSchedule {
+  kind: 'cron' | 'every' | 'at' | ''
+  expr: string     // cron expression | interval ("30m", "1d") | time ("2026-05-01 09:00")
+  tz: string
+  offset?: string  // every: shifts the interval grid
+  jitter?: string  // cron / every: random delay up to this duration
+}
+
+export interface CronDeliveryTarget {
+  kind: 'telegram' | 'session' | 'webhook' | 'email'
+  channelId?: string
+  chatId?: number
+  threadId?: number
+  sessionId?: string
+  url?: string      // webhook endpoint
+  secret?: string   // webhook HMAC-SHA256 key (X-Cron-Signature)
+  to?: string[]     // email recipients
+  subject?: string  // email subject
+}
+
+export interface CronDelivery {
+  mode: string      // "announce" | "none"
+  target?: CronDeliveryTarget
+  onlyOnError?: boolean
+  skipEmpty?: boolean // suppress empty / "nothing to report" output
+  match?: string      // regexp the output must match
+}
+
+export interface CronRunRecord {
+  jobId: string
+  runId: string
+  startedAt: number
+  endedAt: number
+  status: string
+  output: string
+  error?: string
+  delivery?: { target: string; status: 'sent' | 'skipped' | 'failed'; detail?: string; at: number }
+}
+
 export interface CronJob {
   id: string
   name: string
   remark?: string
   enabled: boolean
-  schedule: { kind: string; expr: string; tz: string }
+  schedule: CronSchedule
   payload: { kind: string; message: string; model?: string }
-  delivery: { mode: string }
+  delivery: CronDelivery
   agentId?: string
+  createdBy?: string   // "agent" when created through the cron_create tool
+  deleteAfterRun?: boolean // at: delete instead of disabling after it fires
   createdAtMs: number
   state?: {
     nextRunAtMs?: number
@@ -243,7 +287,11 @@ export const cron = {
   update: (jobId: string, job: Partial<CronJob>) => api.patch<CronJob>(`/cron/${jobId}`, job),
   delete: (jobId: string) => api.delete(`/cron/${jobId}`),
   run: (jobId: string) => api.post(`/cron/${jobId}/run`),
-  runs: (jobId: string) => api.get(`/cron/${jobId}/runs`),
+  runs: (jobId: string) => api.get<CronRunRecord[]>(`/cron/${jobId}/runs`),
+  /** Next fire times (unix ms) of a saved job, jitter included. */
+  next: (jobId: string, n = 5) => api.get<{ runs: number[] }>(`/cron/${jobId}/next`, { params: { n } }),
+  /** Next fire times (unix ms) of an unsaved schedule. */
+  preview: (schedule: CronSchedule, n = 5) => api.post<{ runs: number[] }>('/cron/preview', { schedule, n }),
 }
 
 // ChatParams are optional extra parameters passed through to the model.
@@ -253,6 +301,7 @@ export interface ChatParams {
   scenario?: string  // label e.g. "agent-creation", "general"
   skillId?: string   // skill-studio: restrict tools to this skill directory (sandbox)
   images?: string[]  // base64 data URIs
+  attachments?: { name: string; data: string }[]  // PDF/DOCX/XLSX/PPTX as data URIs, extracted server-side
   history?: { role: 'user' | 'assistant'; content: string }[]  // prior turns for multi-turn context
 }
 
@@ -284,6 +333,7 @@ export function chatSSE(agentId: string, message: string, onEvent: (ev: any) =>
     if (!reader) return
     const decoder = new TextDecoder()
     let buffer = ''
+    let eventId = 0
     while (true) {
       const { done, value } = await reader.read()
       if (done) {
@@ -295,9 +345,12 @@ export function chatSSE(agentId: string, message: string, onEvent: (ev: any) =>
       buffer = parts.pop() || ''
       for (const line of parts) {
         const trimmed = line.trim()
-        if (trimmed.startsWith('data: ')) {
+        if (trimmed.startsWith('id: ')) {
+          eventId = Number(trimmed.slice(4)) || eventId
+        } else if (trimmed.startsWith('data: ')) {
           try {
             const data = JSON.parse(trimmed.slice(6))
+            if (eventId) data._eventId = eventId
             onEvent(data)
             if (data.type === 'done' || data.type === 'error') return
           } catch {}
@@ -315,14 +368,16 @@ export function chatSSE(agentId: string, message: string, onEvent: (ev: any) =>
 // Resume an existing generation by subscribing to the session's broadcaster.
 // Returns buffered events first (replay), then live events.
 // If the worker no longer exists, receives {type:"idle"} immediately.
-export function resumeSSE(agentId: string, sessionId: string, onEvent: (ev: any) => void): AbortController {
+// Pass the last seen event's _eventId to receive only the events after it.
+export function resumeSSE(agentId: string, sessionId: string, onEvent: (ev: any) => void, lastEventId?: number): AbortController {
   const ctrl = new AbortController()
   const token = localStorage.getItem('aipanel_token')
 
   fetch(`/api/agents/${agentId}/chat/stream?sessionId=${encodeURIComponent(sessionId)}`, {
     method: 'GET',
     headers: {
-      ...(token ? { Authorization: `Bearer ${token}` } : {})
+      ...(token ? { Authorization: `Bearer ${token}` } : {}),
+      ...(lastEventId ? { 'Last-Event-ID': String(lastEventId) } : {})
     },
     signal: ctrl.signal
   }).then(async res => {
@@ -334,6 +389,7 @@ export function resumeSSE(agentId: string, sessionId: string, onEvent: (ev: any)
     if (!reader) { onEvent({ type: 'idle' }); return }
     const decoder = new TextDecoder()
     let buffer = ''
+    let eventId = 0
     while (true) {
       const { done, value } = await reader.read()
       if (done) break
@@ -342,9 +398,12 @@ export function resumeSSE(agentId: string, sessionId: string, onEvent: (ev: any)
       buffer = parts.pop() || ''
       for (const line of parts) {
         const trimmed = line.trim()
-        if (trimmed.startsWith('data: ')) {
+        if (trimmed.startsWith('id: ')) {
+          eventId = Number(trimmed.slice(4)) || eventId
+        } else if (trimmed.startsWith('data: ')) {
           try {
             const data = JSON.parse(trimmed.slice(6))
+            if (eventId) data._eventId = eventId
             onEvent(data)
             if (data.type === 'done' || data.type === 'error' || data.type === 'idle') return
           } catch {}
@@ -398,6 +457,48 @@ export interface ParsedMessage {
   timestamp: number
   isCompact?: boolean
   toolCalls?: SavedToolCall[]
+  compaction?: CompactionEntry
+}
+
+export interface CompactionEntry {
+  summary: string
+  timestamp: number
+  tokensBefore?: number
+  tokensAfter?: number
+  reason?: 'auto' | 'manual'
+  model?: string
+  summarized?: number
+  kept?: number
+  pinned?: number
+}
+
+export interface CompactionMessagePreview {
+  role: 'user' | 'assistant'
+  text: string
+  timestamp: number
+}
+
+// Result of POST /sessions/:agentId/:sid/compact (or its dry run).
+export interface CompactionResult {
+  compacted: boolean
+  messages: number
+  summarized: number
+  kept: number
+  pinned: CompactionMessagePreview[]
+  firstKept?: CompactionMessagePreview
+  tokensBefore: number
+  tokensAfter?: number
+  summary?: string
+  policy: { threshold: number; keepTurns: number; model?: string; prompt: string; preserve?: string[] }
+}
+
+// Per-agent (AgentInfo.compaction) or global (config.compaction) policy.
+export interface CompactionPolicy {
+  threshold?: number      // tokens; negative disables automatic compaction
+  keepTurns?: number
+  summaryModelId?: string
+  prompt?: string
+  preserve?: string[]     // regexps; matching messages are pinned
 }
 
 export interface SessionDetail {
@@ -417,6 +518,81 @@ export const sessions = {
     api.delete(`/sessions/${agentId}/${sid}`),
   rename: (agentId: string, sid: string, title: string) =>
     api.patch(`/sessions/${agentId}/${sid}`, { title }),
+  // Summarise older turns now; dryRun only previews. pinned = message timestamps to keep verbatim.
+  compact: (agentId: string, sid: string, opts?: { dryRun?: boolean; pinned?: number[] }) =>
+    api.post<CompactionResult>(`/sessions/${agentId}/${sid}/compact`, opts ?? {}),
+  compactions: (agentId: string, sid: string) =>
+    api.get<{ compactions: CompactionEntry[] }>(`/sessions/${agentId}/${sid}/compactions`),
+  // Sessions moved to the archive by the retention janitor (still readable via get/export).
+  archived: (params?: { agentId?: string }) =>
+    api.get<{ sessions: ArchivedSessionSummary[]; total: number }>('/sessions/archived', { params }),
+  export: (agentId: string, sid: string, format: SessionExportFormat = 'md') =>
+    api.get<Blob>(`/sessions/${agentId}/${sid}/export`, { params: { format }, responseType: 'blob' }),
+  // Accepts our md/html/json exports, OpenAI/Anthropic message JSON and v3 JSONL.
+  import: (agentId: string, file: File, title?: string) => {
+    const form = new FormData()
+    form.append('file', file)
+    form.append('agentId', agentId)
+    if (title) form.append('title', title)
+    return api.post<{ session: SessionSummary; agentId: string }>('/sessions/import', form)
+  },
+}
+
+export type SessionExportFormat = 'md' | 'html' | 'json' | 'openai' | 'anthropic'
+
+export interface ArchivedSessionSummary extends SessionSummary {
+  archivedAt: number
+  bytes: number
+  compressedBytes: number
+}
+
+// ── Retention ────────────────────────────────────────────────────────────
+
+export interface RetentionRule {
+  archiveAfterDays?: number
+  deleteAfterDays?: number
+}
+
+export interface RetentionPolicy extends RetentionRule {
+  maxSessionsMb?: number
+  channels?: Record<string, RetentionRule>
+}
+
+export interface RetentionConfig {
+  enabled?: boolean
+  intervalMin?: number
+  sessions?: RetentionPolicy
+  convlogDays?: number
+  cronRunDays?: number
+  subagentTaskDays?: number
+}
+
+export interface RetentionAction {
+  agentId: string
+  sessionId: string
+  channel: string
+  archived?: boolean
+  reason: 'idle' | 'quota'
+  bytes: number
+}
+
+export interface RetentionReport {
+  startedAt: number
+  finishedAt: number
+  dryRun?: boolean
+  archived: RetentionAction[]
+  deleted: RetentionAction[]
+  convlogLines: number
+  cronRuns: number
+  subagentTasks: number
+  bytesFreed: number
+  overQuota?: string[]
+  errors?: string[]
+}
+
+export const retentionApi = {
+  get: () => api.get<{ config: RetentionConfig; lastReport: RetentionReport | null }>('/retention'),
+  run: (dryRun = false) => api.post<RetentionReport>('/retention/run', null, { params: { dryRun } }),
 }
 
 // ── Stats API ─────────────────────────────────────────────────────────────
@@ -489,23 +665,77 @@ export interface MemConfig {
   schedule: 'hourly' | 'every6h' | 'daily' | 'weekly'
   keepTurns: number
   focusHint: string
+  trim: boolean // archive + trim sessions once consolidated
   cronJobId: string
+  rollup: boolean // weekly rollup: weekly/monthly summaries, fact promotion, INDEX.md refresh
+  indexBudget?: number // max characters of INDEX.md kept by the rollup
+  rollupCronJobId: string
 }
 
 export interface MemRunLog {
   timestamp: number // unix ms
+  kind?: 'consolidate' | 'rollup'
   status: 'ok' | 'error'
   message: string
 }
 
+export interface MemProvenance {
+  id: string
+  time: number // unix ms
+  file: string // daily log, relative to memory/
+  heading?: string
+  written: boolean
+  sources: { sessionId: string; title?: string; messages: number[] }[]
+}
+
 export const memoryConfigApi = {
   getConfig: (agentId: string) => api.get<MemConfig>(`/agents/${agentId}/memory/config`),
   setConfig: (agentId: string, cfg: Partial<MemConfig>) =>
     api.put<MemConfig>(`/agents/${agentId}/memory/config`, cfg),
   consolidate: (agentId: string) =>
     api.post<{ ok: boolean; message: string }>(`/agents/${agentId}/memory/consolidate`),
+  rollup: (agentId: string) =>
+    api.post<{ ok: boolean; message: string }>(`/agents/${agentId}/memory/rollup`),
   runLog: (agentId: string) =>
     api.get<MemRunLog[]>(`/agents/${agentId}/memory/run-log`),
+  provenance: (agentId: string, file?: string) =>
+    api.get<{ records: MemProvenance[]; watermarks: Record<string, { lastTimestamp: number; messages: number; updatedAt: number }> }>(
+      `/agents/${agentId}/memory/provenance`, { params: file ? { file } : undefined }),
+}
+
+// ── Memory Versions API ───────────────────────────────────────────────────
+
+export interface MemoryVersion {
+  id: number
+  path: string // workspace-relative, e.g. memory/core/prefs.md, SOUL.md
+  time: number // unix ms
+  author: { source: 'user' | 'agent' | 'consolidator' | 'system' | 'external'; detail?: string }
+  op: 'write' | 'delete' | 'restore' | 'baseline'
+  size: number
+  hash: string
+  restoredFrom?: number
+}
+
+export interface MemoryDiff {
+  path: string
+  from?: MemoryVersion
+  to?: MemoryVersion
+  added: number
+  removed: number
+  unified: string
+}
+
+export const memoryVersionsApi = {
+  files: (agentId: string) => api.get<{ files: string[] }>(`/agents/${agentId}/versions`),
+  list: (agentId: string, path: string) =>
+    api.get<{ path: string; versions: MemoryVersion[] }>(`/agents/${agentId}/versions`, { params: { path } }),
+  get: (agentId: string, path: string, id: number) =>
+    api.get<{ version: MemoryVersion; content: string }>(`/agents/${agentId}/versions/${id}`, { params: { path } }),
+  // to = 0 compares against the current file
+  diff: (agentId: string, path: string, from: number, to = 0) =>
+    api.get<MemoryDiff>(`/agents/${agentId}/versions/diff`, { params: { path, from, to } }),
+  restore: (agentId: string, path: string, id: number) =>
+    api.post<{ ok: boolean; version: MemoryVersion }>(`/agents/${agentId}/versions/${id}/restore`, null, { params: { path } }),
 }
 
 // ── Conversation Log API ──────────────────────────────────────────────────
@@ -625,4 +855,235 @@ export const tasks = {
     api.get<EligibleTarget[]>('/tasks/eligible', { params: { from, mode } }),
 }
 
+// ── Background processes ─────────────────────────────────────────────────
+
+export interface ProcessInfo {
+  id: string
+  agentId: string
+  label?: string
+  command: string
+  dir?: string
+  pid: number
+  status: 'running' | 'exited' | 'failed' | 'killed' | 'lost'
+  exitCode?: number
+  error?: string
+  logBytes: number
+  startedAt: number
+  endedAt?: number
+}
+
+export const processes = {
+  list: (params?: { agentId?: string; status?: string }) =>
+    api.get<ProcessInfo[]>('/processes', { params }),
+  get: (id: string) => api.get<ProcessInfo>(`/processes/${id}`),
+  logs: (id: string, tail?: number) =>
+    api.get<{ output: string }>(`/processes/${id}/logs`, { params: { tail } }),
+  kill: (id: string) => api.post(`/processes/${id}/kill`),
+  remove: (id: string) => api.delete(`/processes/${id}`),
+}
+
+// ── Agent data store (kv_* / sql_query tools) ────────────────────────────
+
+export interface KVEntry {
+  key: string
+  value: unknown
+  updatedAt: number
+  expiresAt?: number
+}
+
+export interface DataStoreUsage {
+  kvKeys: number
+  kvBytes: number
+  dbBytes: number
+  maxKvKeys: number
+  maxKvBytes: number
+  maxValueBytes: number
+  maxDbBytes: number
+}
+
+export interface DataStoreTable {
+  name: string
+  sql: string
+  rows: number
+}
+
+export interface SQLResult {
+  columns?: string[]
+  rows?: unknown[][]
+  rowsAffected: number
+  truncated: boolean
+  isQuery: boolean
+}
+
+export const dataStore = {
+  overview: (agentId: string) =>
+    api.get<{ usage: DataStoreUsage; tables: DataStoreTable[] }>(`/agents/${agentId}/datastore`),
+  listKV: (agentId: string, prefix?: string) =>
+    api.get<KVEntry[]>(`/agents/${agentId}/datastore/kv`, { params: { prefix } }),
+  deleteKV: (agentId: string, key: string) =>
+    api.delete(`/agents/${agentId}/datastore/kv/${encodeURIComponent(key)}`),
+  query: (agentId: string, sql: string, opts?: { params?: unknown[]; readOnly?: boolean; maxRows?: number }) =>
+    api.post<SQLResult>(`/agents/${agentId}/datastore/sql`, { sql, ...opts }),
+  export: (agentId: string, format: 'json' | 'sqlite' = 'json') =>
+    api.get<Blob>(`/agents/${agentId}/datastore/export`, { params: { format }, responseType: 'blob' }),
+}
+
+// ── Contacts API ───────────────────────────────────────────────────────────
+
+export interface ContactIdentity {
+  key: string // telegram:<userID> | web:<channelID>:<token>
+  channel: string
+  username?: string
+  displayName?: string
+  firstSeen: number // unix ms
+  lastSeen: number
+}
+
+export interface Contact {
+  id: string
+  name: string
+  profile?: Record<string, string>
+  preferences?: Record<string, string>
+  notes?: { time: number; by: 'agent' | 'user'; text: string }[]
+  identities: ContactIdentity[]
+  interactions?: { time: number; channel: string; sessionId: string; messages: number; preview?: string }[]
+  messages: number
+  createdAt: number
+  updatedAt: number
+}
+
+export interface ContactPatch {
+  name?: string
+  profile?: Record<string, string> // empty value deletes the key
+  preferences?: Record<string, string>
+  addNote?: string
+  deleteNote?: number
+}
+
+export const contactsApi = {
+  list: (agentId: string, q?: string) =>
+    api.get<Contact[]>(`/agents/${agentId}/contacts`, { params: q ? { q } : undefined }),
+  get: (agentId: string, cid: string) => api.get<Contact>(`/agents/${agentId}/contacts/${cid}`),
+  update: (agentId: string, cid: string, patch: ContactPatch) =>
+    api.patch<Contact>(`/agents/${agentId}/contacts/${cid}`, patch),
+  delete: (agentId: string, cid: string) => api.delete(`/agents/${agentId}/contacts/${cid}`),
+  link: (agentId: string, cid: string, key: string) =>
+    api.post<Contact>(`/agents/${agentId}/contacts/${cid}/link`, { key }),
+  unlink: (agentId: string, cid: string, key: string) =>
+    api.post<Contact>(`/agents/${agentId}/contacts/${cid}/unlink`, { key }),
+}
+
+// ── Team memory ──────────────────────────────────────────────────────────
+
+export interface TeamMemoryPolicy {
+  readers?: string[]   // empty = all agents
+  writers?: string[]   // empty = all agents; ['__none__'] = read-only
+  approvers?: string[] // agents that can review proposals
+  review: boolean      // agent proposals need approval before they apply
+}
+
+export interface TeamMemoryProposal {
+  id: string
+  path: string
+  mode: 'append' | 'replace'
+  content: string
+  reason?: string
+  agentId: string
+  status: 'pending' | 'applied' | 'rejected'
+  createdAt: number
+  reviewedBy?: string
+  reviewedAt?: number
+  reviewNote?: string
+}
+
+export interface MemorySearchHit {
+  path: string
+  heading?: string
+  line: number
+  text: string
+  score: number
+  keyword: number
+  semantic: number
+}
+
+export const teamMemoryApi = {
+  getPolicy: () => api.get<TeamMemoryPolicy>('/team-memory/policy'),
+  setPolicy: (p: TeamMemoryPolicy) => api.put<TeamMemoryPolicy>('/team-memory/policy', p),
+  tree: () => api.get<FileNode[]>('/team-memory/tree'),
+  readFile: (path: string) =>
+    api.get<{ path: string; content: string; size: number }>('/team-memory/file', { params: { path } }),
+  writeFile: (path: string, content: string) =>
+    api.put('/team-memory/file', content, { params: { path }, headers: { 'Content-Type': 'text/plain; charset=utf-8' } }),
+  deleteFile: (path: string) => api.delete('/team-memory/file', { params: { path } }),
+  search: (q: string, limit = 10) =>
+    api.get<MemorySearchHit[]>('/team-memory/search', { params: { q, limit } }),
+  proposals: (status?: string) =>
+    api.get<TeamMemoryProposal[]>('/team-memory/proposals', { params: status ? { status } : {} }),
+  approve: (id: string, note = '') =>
+    api.post<TeamMemoryProposal>(`/team-memory/proposals/${id}/approve`, { note }),
+  reject: (id: string, note = '') =>
+    api.post<TeamMemoryProposal>(`/team-memory/proposals/${id}/reject`, { note }),
+}
+
+// ── Global search ────────────────────────────────────────────────────────
+
+export interface SearchHit {
+  source: 'session' | 'convlog' | 'memory' | 'project'
+  agentId?: string
+  channel?: string
+  role?: string
+  sessionId?: string
+  path?: string
+  title?: string
+  timestamp: number
+  snippet: string // HTML: matches wrapped in <mark>, everything else escaped
+  score: number
+}
+
+export interface SearchParams {
+  q: string
+  agentId?: string
+  channel?: string
+  role?: string
+  source?: string // comma-separated
+  since?: string
+  until?: string
+  sort?: 'relevance' | 'recent'
+  limit?: number
+  offset?: number
+}
+
+export const searchApi = {
+  search: (params: SearchParams) =>
+    api.get<{ hits: SearchHit[]; total: number }>('/search', { params }),
+}
+
+// ── Run scheduler ────────────────────────────────────────────────────────
+
+export interface SchedulerRun {
+  class: 'interactive' | 'telegram' | 'subagent' | 'cron' | 'memory'
+  agentId: string
+  key: string
+  label?: string
+  position?: number
+  queuedAt: number
+  startedAt?: number
+}
+
+export interface SchedulerMetrics {
+  limits: { global: number; perAgent: number; perKey: number; maxQueue: number } // 0 = unlimited
+  running: SchedulerRun[]
+  queue: SchedulerRun[]
+  perAgent: Record<string, number>
+  perKey: Record<string, number>
+  classes: Record<string, {
+    running: number; queued: number; admitted: number; rejected: number
+    cancelled: number; avgWaitMs: number; maxWaitMs: number
+  }>
+}
+
+export const schedulerApi = {
+  metrics: () => api.get<SchedulerMetrics>('/scheduler'),
+}
+
 export default api
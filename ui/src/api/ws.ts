@@ -0,0 +1,87 @@
+// WebSocket client for GET /ws — live system events, chat and control messages.
+// Reconnects automatically and re-subscribes its channels.
+
+export interface WsEvent {
+  type: 'event'
+  channel: string   // agents | subagents | cron | pending | sessions | stats | session:<id>
+  event: string     // e.g. snapshot, update, run_started, running, done, text_delta
+  eventId?: number  // session:<id> only
+  data?: any
+  time?: number
+}
+
+type Handler = (ev: WsEvent) => void
+
+let socket: WebSocket | null = null
+let seq = 0
+let retry = 0
+const handlers = new Map<string, Set<Handler>>()
+const pending = new Map<string, { resolve: (v: any) => void; reject: (e: Error) => void }>()
+
+function wsURL(): string {
+  const proto = location.protocol === 'https:' ? 'wss:' : 'ws:'
+  const token = localStorage.getItem('aipanel_token') || ''
+  return `${proto}//${location.host}/ws?token=${encodeURIComponent(token)}`
+}
+
+function connect() {
+  if (socket) return
+  const ws = new WebSocket(wsURL())
+  socket = ws
+  ws.onopen = () => {
+    retry = 0
+    if (handlers.size) ws.send(JSON.stringify({ type: 'subscribe', channels: [...handlers.keys()] }))
+  }
+  ws.onmessage = (msg) => {
+    const m = JSON.parse(msg.data)
+    if (m.type === 'event') {
+      handlers.get(m.channel)?.forEach(h => h(m))
+    } else if ((m.type === 'ack' || m.type === 'error') && m.id && pending.has(m.id)) {
+      const p = pending.get(m.id)!
+      pending.delete(m.id)
+      m.type === 'ack' ? p.resolve(m.data) : p.reject(new Error(m.error))
+    }
+  }
+  ws.onclose = () => {
+    socket = null
+    pending.forEach(p => p.reject(new Error('连接已断开')))
+    pending.clear()
+    if (handlers.size) setTimeout(connect, Math.min(30000, 1000 * 2 ** retry++))
+  }
+}
+
+// Send a request and resolve with the ack payload.
+export function wsRequest(type: string, body: Record<string, any> = {}): Promise<any> {
+  connect()
+  const id = String(++seq)
+  return new Promise((resolve, reject) => {
+    pending.set(id, { resolve, reject })
+    const send = () => socket!.send(JSON.stringify({ id, type, ...body }))
+    if (socket!.readyState === WebSocket.OPEN) send()
+    else socket!.addEventListener('open', send, { once: true })
+  })
+}
+
+// Subscribe to a channel; returns an unsubscribe function.
+export function subscribe(channel: string, handler: Handler): () => void {
+  let set = handlers.get(channel)
+  const isNew = !set
+  if (!set) {
+    set = new Set()
+    handlers.set(channel, set)
+  }
+  set.add(handler)
+  if (isNew && socket?.readyState === WebSocket.OPEN) {
+    socket.send(JSON.stringify({ type: 'subscribe', channels: [channel] }))
+  } else {
+    connect() // subscribes on open
+  }
+  return () => {
+    set!.delete(handler)
+    if (set!.size) return
+    handlers.delete(channel)
+    if (socket?.readyState === WebSocket.OPEN) {
+      socket.send(JSON.stringify({ type: 'unsubscribe', channels: [channel] }))
+    }
+  }
+}
@@ -79,6 +79,12 @@ const router = createRouter({
       component: () => import('../views/SubagentsView.vue'),
       meta: { requiresAuth: true }
     },
+    {
+      path: '/processes',
+      name: 'processes',
+      component: () => import('../views/ProcessesView.vue'),
+      meta: { requiresAuth: true }
+    },
     {
       path: '/logs',
       name: 'logs',
@@ -103,6 +109,12 @@ const router = createRouter({
       component: () => import('../views/ProjectsView.vue'),
       meta: { requiresAuth: true }
     },
+    {
+      path: '/team-memory',
+      name: 'team-memory',
+      component: () => import('../views/TeamMemoryView.vue'),
+      meta: { requiresAuth: true }
+    },
     // Public chat page (web channel — no auth required)
     {
       path: '/chat/:agentId/:channelId',